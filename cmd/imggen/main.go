@@ -4,28 +4,57 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 
 	"github.com/manash/imggen/internal/batch"
+	"github.com/manash/imggen/internal/cache"
+	"github.com/manash/imggen/internal/config"
+	"github.com/manash/imggen/internal/cost"
 	"github.com/manash/imggen/internal/display"
+	"github.com/manash/imggen/internal/doctor"
+	"github.com/manash/imggen/internal/drift"
+	"github.com/manash/imggen/internal/events"
 	"github.com/manash/imggen/internal/image"
 	"github.com/manash/imggen/internal/keys"
+	"github.com/manash/imggen/internal/ocrcsv"
+	"github.com/manash/imggen/internal/progress"
 	"github.com/manash/imggen/internal/provider"
 	"github.com/manash/imggen/internal/provider/openai"
+	"github.com/manash/imggen/internal/provider/stability"
+	"github.com/manash/imggen/internal/query"
+	"github.com/manash/imggen/internal/reflow"
 	"github.com/manash/imggen/internal/register"
 	"github.com/manash/imggen/internal/repl"
+	"github.com/manash/imggen/internal/schemagen"
+	"github.com/manash/imggen/internal/security"
 	"github.com/manash/imggen/internal/session"
+	"github.com/manash/imggen/internal/suggest"
+	"github.com/manash/imggen/internal/throttle"
+	"github.com/manash/imggen/internal/update"
 	"github.com/manash/imggen/pkg/models"
 )
 
@@ -35,20 +64,60 @@ var (
 )
 
 var (
-	flagModel       string
-	flagSize        string
-	flagQuality     string
-	flagCount       int
-	flagOutput      string
-	flagFormat      string
-	flagStyle       string
-	flagTransparent bool
-	flagAPIKey      string
-	flagShow        bool
-	flagInteractive bool
-	flagVerbose     bool
-	flagPrompts     []string
-	flagParallel    int
+	flagModel          string
+	flagSize           string
+	flagQuality        string
+	flagCount          int
+	flagOutput         string
+	flagFormat         string
+	flagStyle          string
+	flagSeed           int64
+	flagTransparent    bool
+	flagAPIKey         string
+	flagShow           bool
+	flagInteractive    bool
+	flagResumeLast     bool
+	flagVerbose        bool
+	flagPrompts        []string
+	flagCombinePrompts bool
+	flagCombineSep     string
+	flagParallel       int
+	flagMinInterval    time.Duration
+	flagPreviewQuality string
+	flagExplain        bool
+	flagDryRun         bool
+	flagRetries        int
+	flagLocale         string
+	flagConfigProfile  string
+	flagBaseURL        string
+	flagProxy          string
+	flagCACert         string
+	flagTimeout        time.Duration
+
+	flagMaxInflightPerHost int
+	flagSaveRequest        string
+	flagSaveResponse       string
+	flagEventLog           string
+	flagEventLogPrompts    string
+	flagJSON               bool
+	flagShowProtocol       = display.ProtocolAuto
+	flagCache              bool
+	flagCacheMaxMB         int64
+	flagNoRevise           bool
+	flagStripWeights       bool
+	flagStdoutBase64       bool
+	flagEmbedMetadata      bool
+	flagNameTemplate       string
+	flagProvenance         bool
+	flagJPEGQuality        int
+	flagWebPQuality        int
+	flagWebPLossless       bool
+	flagMaxPromptDrift     float64
+	flagStrict             bool
+	flagQuiet              bool
+	flagConfirmAbove       float64
+	// flagYes is --yes on every command that asks before going ahead.
+	flagYes bool
 )
 
 var (
@@ -60,6 +129,12 @@ var (
 	flagBatchParallel    int
 	flagBatchStopOnError bool
 	flagBatchDelay       int
+	flagBatchRetryFailed string
+	flagBatchRPM         int
+	flagBatchResume      bool
+	flagBatchBudget      float64
+	flagBatchDedupe      bool
+	flagContactSheet     string
 )
 
 var (
@@ -70,6 +145,16 @@ var (
 	flagOCRPrompt        string
 	flagOCROutput        string
 	flagOCRURL           string
+	flagOCRConfidence    float64
+	flagOCRStream        bool
+	flagOCRSplitFields   bool
+	flagOCRBatch         string
+	flagOCRParallel      int
+	flagOCRReflow        bool
+	flagOCROutputFormat  string
+	flagOCRMaxTokens     int
+	flagOCRBudget        float64
+	flagOCRSchemaOutput  string
 )
 
 var (
@@ -79,7 +164,57 @@ var (
 	flagVideoOutput   string
 )
 
+var (
+	flagAnimateOutput string
+	flagAnimateFPS    int
+)
+
+var (
+	flagMontageOutput string
+	flagSheetColumns  int
+)
+
+var (
+	flagIconOutput  string
+	flagIconModel   string
+	flagIconQuality string
+	flagIconSizes   []int
+	flagIconICO     bool
+	flagIconICNS    bool
+)
+
+var (
+	flagVaryModel  string
+	flagVaryCount  int
+	flagVarySize   string
+	flagVaryOutput string
+)
+
+var (
+	flagEditModel  string
+	flagEditMask   string
+	flagEditCount  int
+	flagEditSize   string
+	flagEditOutput string
+	flagEditResize bool
+	flagEditAlpha  bool
+	flagEditEXIF   string
+	flagEditInEXIF bool
+)
+
+var (
+	flagStripOutput  string
+	flagStripInPlace bool
+)
+
+var (
+	flagKeysMigrateFrom   string
+	flagKeysMigrateTo     string
+	flagKeysWhichProvider string
+)
+
 type App struct {
+	In           io.Reader
 	Out          io.Writer
 	Err          io.Writer
 	Registry     *models.ModelRegistry
@@ -87,15 +222,40 @@ type App struct {
 	NewProvider  func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error)
 	NewSaver     func() *image.Saver
 	NewDisplayer func(io.Writer) *display.Displayer
+	// Quiet drops progress, cost, and warning lines so only errors and
+	// saved paths are printed. It is set from --quiet.
+	Quiet bool
+}
+
+// info returns where progress and cost lines go: Out, or nowhere when
+// Quiet.
+func (app *App) info() io.Writer {
+	if app.Quiet {
+		return io.Discard
+	}
+	return app.Out
+}
+
+// warn returns where warnings go: Err, or nowhere when Quiet. Errors are
+// always written to Err.
+func (app *App) warn() io.Writer {
+	if app.Quiet {
+		return io.Discard
+	}
+	return app.Err
 }
 
 func DefaultApp() *App {
 	return &App{
+		In:       os.Stdin,
 		Out:      os.Stdout,
 		Err:      os.Stderr,
 		Registry: models.DefaultRegistry(),
 		GetEnv:   os.Getenv,
 		NewProvider: func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+			if cfg.Provider == models.ProviderStability {
+				return stability.New(cfg, registry)
+			}
 			return openai.New(cfg, registry)
 		},
 		NewSaver:     image.NewSaver,
@@ -116,6 +276,118 @@ func run() error {
 	return rootCmd.Execute()
 }
 
+// applyConfig loads ~/.imggen/config.yaml and applies it before cmd runs,
+// merging in the profile chosen by --config-profile or IMGGEN_PROFILE.
+// A broken config file is reported but never blocks a command, so that
+// `imggen config` can still be used to fix it; an unknown profile is an
+// error, since running with the wrong setup could be costly, except for
+// `imggen config` itself, which runs on the base settings.
+func applyConfig(cmd *cobra.Command, app *App) error {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(app.warn(), "Warning: %v\n", err)
+		return nil
+	}
+	profiled, err := cfg.WithProfile(configProfile(app))
+	if err != nil {
+		if !isConfigCmd(cmd) {
+			return err
+		}
+		fmt.Fprintf(app.warn(), "Warning: %v\n", err)
+		profiled = cfg
+	}
+	cfg = profiled
+	applyConfigAliases(app, cfg)
+	applyConfigDefaults(cmd, cfg)
+	return nil
+}
+
+// isConfigCmd reports whether cmd is `imggen config` or one of its
+// subcommands.
+func isConfigCmd(cmd *cobra.Command) bool {
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		if c.Name() == "config" && c.Parent() == c.Root() {
+			return true
+		}
+	}
+	return false
+}
+
+// configProfile returns the selected config profile: --config-profile,
+// then IMGGEN_PROFILE, or "" for none.
+func configProfile(app *App) string {
+	if flagConfigProfile != "" {
+		return flagConfigProfile
+	}
+	return app.GetEnv("IMGGEN_PROFILE")
+}
+
+// applyConfigDefaults fills in generate and batch flags the user did not
+// pass from the config file, giving flag > config file > built-in default.
+// The base URL, event log, and confirm-above settings apply to every
+// command.
+func applyConfigDefaults(cmd *cobra.Command, cfg *config.Config) {
+	confirmAbove, _ := cfg.Get("confirm_above")
+	setUnchangedFlags(cmd, map[string]string{
+		"base-url":          cfg.BaseURL,
+		"proxy":             cfg.Proxy,
+		"ca-cert":           cfg.CACert,
+		"event-log":         cfg.EventLog,
+		"event-log-prompts": cfg.EventLogPrompts,
+		"confirm-above":     confirmAbove,
+	})
+
+	isBatch := cmd.Name() == "batch"
+	if cmd != cmd.Root() && !isBatch {
+		return
+	}
+
+	values := map[string]string{
+		"model":   cfg.Model,
+		"size":    cfg.Size,
+		"quality": cfg.Quality,
+		"format":  cfg.Format,
+	}
+	if cfg.Parallel > 0 {
+		values["parallel"] = strconv.Itoa(cfg.Parallel)
+	}
+	if cfg.ResumeLast {
+		values["resume-last"] = "true"
+	}
+	// The root command's -o names a file unless --prompt is used, and a
+	// retry writes next to the results it retries, so the configured
+	// output directory only applies to the remaining cases.
+	if (isBatch && flagBatchRetryFailed == "") || (!isBatch && fanOut()) {
+		values["output"] = cfg.Output
+	}
+	setUnchangedFlags(cmd, values)
+}
+
+// setUnchangedFlags sets each named flag of cmd that was not passed on the
+// command line. Empty values and unknown flags are skipped.
+func setUnchangedFlags(cmd *cobra.Command, values map[string]string) {
+	for name, value := range values {
+		f := cmd.Flags().Lookup(name)
+		if value == "" || f == nil || f.Changed {
+			continue
+		}
+		if err := f.Value.Set(value); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: ignoring config %s %q: %v\n", name, value, err)
+		}
+	}
+}
+
+// applyConfigAliases registers the model aliases from the config file.
+// Invalid entries are reported and skipped so a bad alias never blocks
+// unrelated commands.
+func applyConfigAliases(app *App, cfg *config.Config) {
+	for alias, model := range cfg.Aliases {
+		if err := app.Registry.RegisterAlias(alias, model); err != nil {
+			fmt.Fprintf(app.warn(), "Warning: ignoring config alias: %v\n", err)
+		}
+	}
+}
+
 func newRootCmd(app *App) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "imggen [prompt]",
@@ -133,12 +405,17 @@ Image Generation Examples:
   imggen -m dall-e-3 -s 1792x1024 -q hd "panoramic cityscape"
   imggen -m gpt-image-1 -n 3 --transparent "logo design"
   imggen --prompt "a sunset" --prompt "a cat" -o ./output
+  echo "a cat" | imggen -o cat.png  # prompt from stdin
   imggen -i  # start interactive mode
 
 Video Generation Examples:
   imggen video "a cat walking on a beach"
   imggen video -m sora-2-pro -d 8 "sunset over mountains"
-  imggen video -s 1280x720 -o myvideo.mp4 "dancing robot"`,
+  imggen video -s 1280x720 -o myvideo.mp4 "dancing robot"
+
+Defaults for model, size, quality, format, and parallelism can be set in
+~/.imggen/config.yaml (see "imggen config"), with named profiles selected by
+--config-profile or IMGGEN_PROFILE. Flags always take precedence.`,
 		Args: func(cmd *cobra.Command, args []string) error {
 			if flagInteractive {
 				return nil
@@ -146,43 +423,124 @@ Video Generation Examples:
 			if len(flagPrompts) > 0 {
 				return nil
 			}
+			if len(args) == 0 && stdinIsPiped(app) {
+				return nil // the prompt is read from stdin
+			}
 			return cobra.ExactArgs(1)(cmd, args)
 		},
 		Version: fmt.Sprintf("%s (commit: %s)", version, commit),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			app.Quiet = flagQuiet
+			if flagTimeout < 0 {
+				return fmt.Errorf("--timeout must not be negative")
+			}
+			if err := applyConfig(cmd, app); err != nil {
+				return err
+			}
+			applyPricing(app)
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if flagInteractive {
+				if err := checkConflicts(app, args, generateConflicts); err != nil {
+					return err
+				}
 				return runInteractive(cmd, app)
 			}
 			return runGenerate(cmd, args, app)
 		},
 	}
 
-	cmd.Flags().StringVarP(&flagModel, "model", "m", "gpt-image-1", "model to use (gpt-image-1, dall-e-3, dall-e-2)")
-	cmd.Flags().StringVarP(&flagSize, "size", "s", "", "image size (e.g., 1024x1024)")
-	cmd.Flags().StringVarP(&flagQuality, "quality", "q", "", "quality level")
+	cmd.Flags().StringVarP(&flagModel, "model", "m", "gpt-image-1", "model to use (gpt-image-1, dall-e-3, dall-e-2, ...) or an alias such as 4o or sdxl; overrides config")
+	cmd.Flags().StringVarP(&flagSize, "size", "s", "", "image size (e.g., 1024x1024, or square, landscape, portrait); overrides config")
+	cmd.Flags().StringVarP(&flagQuality, "quality", "q", "", "quality level; overrides config")
 	cmd.Flags().IntVarP(&flagCount, "count", "n", 1, "number of images to generate")
-	cmd.Flags().StringVarP(&flagOutput, "output", "o", "", "output filename or directory (directory when using --prompt)")
-	cmd.Flags().StringVarP(&flagFormat, "format", "f", "png", "output format (png, jpeg, webp)")
+	cmd.Flags().StringVarP(&flagOutput, "output", "o", "", "output filename or directory (directory when using --prompt; overrides config there), or - for stdout")
+	cmd.Flags().BoolVar(&flagStdoutBase64, "stdout-base64", false, "write the image to stdout as base64 instead of saving it")
+	cmd.Flags().BoolVar(&flagEmbedMetadata, "embed-metadata", false, "record the prompt and settings in PNG and JPEG files (see imggen inspect)")
+	cmd.Flags().BoolVar(&flagProvenance, "provenance", false, "mark PNG and JPEG files as AI-generated with the model, time, and a prompt hash (see imggen inspect)")
+	addEncodeFlags(cmd)
+	cmd.Flags().StringVar(&flagNameTemplate, "name-template", "", "name files saved into a directory from {index}, {prompt}, {model}, {size}, {date}, and {seed}")
+	cmd.Flags().StringVarP(&flagFormat, "format", "f", "", "output format (png, jpeg, webp, auto; default: the model's format, else png); overrides config")
 	cmd.Flags().StringVar(&flagStyle, "style", "", "style for dall-e-3 (vivid, natural)")
+	cmd.Flags().Int64Var(&flagSeed, "seed", 0, "seed for reproducible results (Stability models, 0 = random)")
 	cmd.Flags().BoolVarP(&flagTransparent, "transparent", "t", false, "transparent background (gpt-image-1 only)")
-	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key (defaults to OPENAI_API_KEY)")
-	cmd.Flags().BoolVarP(&flagShow, "show", "S", false, "display image in terminal (Kitty graphics protocol)")
+	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key (defaults to OPENAI_API_KEY, or STABILITY_API_KEY for Stability models)")
+	cmd.Flags().BoolVarP(&flagShow, "show", "S", false, "display image in terminal (Kitty, sixel, or iTerm2 protocol; see --show-protocol)")
 	cmd.Flags().BoolVarP(&flagInteractive, "interactive", "i", false, "start interactive editing mode")
+	cmd.Flags().BoolVar(&flagResumeLast, "resume-last", false, "with -i, continue the most recently updated session (config: resume_last)")
 	cmd.Flags().BoolVarP(&flagVerbose, "verbose", "v", false, "log HTTP requests and responses (API keys redacted)")
 	cmd.Flags().StringArrayVarP(&flagPrompts, "prompt", "P", nil, "prompt for image generation (can be specified multiple times)")
-	cmd.Flags().IntVarP(&flagParallel, "parallel", "p", 1, "number of parallel workers for multiple prompts")
+	cmd.Flags().BoolVar(&flagCombinePrompts, "combine-prompts", false, "join the prompt argument and every --prompt into one prompt for a single generation")
+	cmd.Flags().StringVar(&flagCombineSep, "combine-separator", ", ", "text placed between prompts joined by --combine-prompts")
+	cmd.Flags().IntVarP(&flagParallel, "parallel", "p", 1, "number of parallel workers for multiple prompts; overrides config")
+	cmd.Flags().BoolVar(&flagNoRevise, "no-revise", false, "ask dall-e-3 to use the prompt as written instead of rewriting it")
+	cmd.Flags().BoolVar(&flagStripWeights, "strip-weights", false, "remove weighted terms like (term:1.2) from prompts for models that do not support them")
+	cmd.Flags().Float64Var(&flagMaxPromptDrift, "max-prompt-drift", 0, "fail when the revised prompt drifts further than this from the original (0-1, 0 = off)")
+	cmd.Flags().StringVar(&flagPreviewQuality, "preview-quality", "", "generate a cheap preview at this quality first and confirm before the final generation")
+	cmd.Flags().BoolVar(&flagExplain, "explain", false, "print the resolved request and estimated cost before generating")
+	cmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "validate and print the resolved request and estimated cost without an API key or API call")
+	cmd.Flags().BoolVar(&flagDryRun, "explain-only", false, "alias for --dry-run")
+	cmd.Flags().BoolVarP(&flagYes, "yes", "y", false, "generate without confirming a cost above --confirm-above")
+	cmd.PersistentFlags().IntVar(&flagRetries, "retries", 0, "retry rate-limited (429) and server (5xx) errors up to this many times with backoff")
+	cmd.PersistentFlags().StringVar(&flagConfigProfile, "config-profile", "", "merge the named profile from config.yaml over the base settings (default $IMGGEN_PROFILE)")
+	cmd.PersistentFlags().StringVar(&flagBaseURL, "base-url", "", "send API requests to this base URL instead of the provider's, e.g. a proxy; overrides config")
+	cmd.PersistentFlags().StringVar(&flagProxy, "proxy", "", "send API requests through this HTTP proxy instead of the one in HTTPS_PROXY; overrides config")
+	cmd.PersistentFlags().StringVar(&flagCACert, "ca-cert", "", "PEM file of CA certificates to trust besides the system roots, e.g. for a TLS-intercepting proxy; overrides config")
+	cmd.PersistentFlags().DurationVar(&flagTimeout, "timeout", 0, "limit each generate, edit, download, or OCR call, retries included, e.g. 5m (0 = defaults of 3m, 3m, 2m, and 90s)")
+	cmd.PersistentFlags().StringVar(&flagLocale, "locale", "", "format cost amounts for a locale, e.g. en-US (1,234.5678) or de-DE (1.234,5678)")
+	cmd.PersistentFlags().IntVar(&flagMaxInflightPerHost, "max-inflight-per-host", 0, "maximum concurrent requests to one API host, shared by parallel workers (0 = unlimited)")
+	cmd.PersistentFlags().StringVar(&flagSaveRequest, "save-request", "", "write the last API request (credentials redacted) to this JSON file")
+	cmd.PersistentFlags().StringVar(&flagSaveResponse, "save-response", "", "write the last raw API response to this JSON file")
+	cmd.PersistentFlags().DurationVar(&flagMinInterval, "min-interval", 0, "minimum time between API requests, shared across imggen processes (e.g. 2s)")
+	cmd.PersistentFlags().StringVar(&flagEventLog, "event-log", "", "append a JSON line per generate, edit, or OCR call to this file, e.g. ~/.imggen/events.jsonl; overrides config")
+	cmd.PersistentFlags().Var(protocolValue{&flagShowProtocol}, "show-protocol", "image protocol for --show and interactive mode: kitty, sixel, iterm2, or auto")
+	cmd.PersistentFlags().BoolVar(&flagJSON, "json", false, "print a JSON result to stdout instead of progress lines (generate, batch, ocr, models, inspect, cost breakdown; batch prints one line per item)")
+	cmd.PersistentFlags().StringVar(&flagEventLogPrompts, "event-log-prompts", "hash", "how prompts are recorded in the event log (hash, plain, omit); overrides config")
+	cmd.PersistentFlags().BoolVar(&flagCache, "cache", false, "reuse images from ~/.imggen/cache for identical requests instead of calling the API (generate, batch)")
+	cmd.PersistentFlags().BoolVar(&flagStrict, "strict", false, "fail instead of warning when cost logging, --show display, or a batch item fails")
+	cmd.PersistentFlags().BoolVar(&flagQuiet, "quiet", false, "print only errors and saved paths, leaving out progress, cost, and warning lines")
+	cmd.PersistentFlags().Float64Var(&flagConfirmAbove, "confirm-above", 0, "ask before a generate, edit, or batch run estimated to cost more than this many dollars (0 = never); overrides config")
+	cmd.PersistentFlags().Int64Var(&flagCacheMaxMB, "cache-max-mb", cache.DefaultMaxBytes>>20, "evict the least recently used cached images once the cache exceeds this size in MB")
 
 	cmd.AddCommand(newCostCmd(app))
 	cmd.AddCommand(newDBCmd(app))
+	cmd.AddCommand(newHistoryCmd(app))
+	cmd.AddCommand(newPromptsCmd(app))
+	cmd.AddCommand(newModelsCmd(app))
+	cmd.AddCommand(newPriceCmd(app))
+	cmd.AddCommand(newSessionCmd(app))
 	cmd.AddCommand(newBatchCmd(app))
 	cmd.AddCommand(newRegisterCmd(app))
 	cmd.AddCommand(newKeysCmd(app))
 	cmd.AddCommand(newOCRCmd(app))
 	cmd.AddCommand(newVideoCmd(app))
+	cmd.AddCommand(newAnimateCmd(app))
+	cmd.AddCommand(newMontageCmd(app))
+	cmd.AddCommand(newIconCmd(app))
+	cmd.AddCommand(newVaryCmd(app))
+	cmd.AddCommand(newEditCmd(app))
+	cmd.AddCommand(newConfigCmd(app))
+	cmd.AddCommand(newCacheCmd(app))
+	cmd.AddCommand(newStripMetadataCmd(app))
+	cmd.AddCommand(newInspectCmd(app))
+	cmd.AddCommand(newSelfUpdateCmd(app))
+	cmd.AddCommand(newDoctorCmd(app))
 
 	return cmd
 }
 
+var (
+	flagCostTZ           string
+	flagCostExportFormat string
+	flagCostExportFrom   string
+	flagCostExportTo     string
+	flagCostExportOutput string
+
+	flagCostBreakdownBy     string
+	flagCostBreakdownPeriod string
+)
+
 func newCostCmd(app *App) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "cost [today|week|month|total|provider]",
@@ -195,19 +553,133 @@ Subcommands:
   month     - Show this month's costs (last 30 days)
   total     - Show all-time total costs (default)
   provider  - Show costs broken down by provider
+  breakdown - Group a period's costs by model, day, or provider
+  export    - Write every cost entry as CSV or JSON
+
+Days start at midnight in the local time zone, or in the zone named by
+--tz. Costs are stored with UTC timestamps, so changing zones never
+double counts or drops entries.
 
 Examples:
   imggen cost           # show total costs
   imggen cost today     # show today's costs
-  imggen cost provider  # show costs by provider`,
+  imggen cost today --tz UTC
+  imggen cost provider  # show costs by provider
+  imggen cost breakdown --by model --period month
+  imggen cost export --from 2025-06-01 --to 2025-06-30 -o costs.csv`,
 		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runCost(app, args)
 		},
 	}
+	cmd.Flags().StringVar(&flagCostTZ, "tz", "", "IANA time zone for day boundaries, e.g. UTC or Europe/Berlin (default local)")
+	cmd.AddCommand(newCostBreakdownCmd(app))
+	cmd.AddCommand(newCostExportCmd(app))
+	return cmd
+}
+
+func newCostBreakdownCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "breakdown",
+		Short: "Show a period's costs grouped by model, day, or provider",
+		Long: `Show a table of the costs in a period grouped by model, calendar day, or
+provider, with a total. Models and providers are listed most expensive
+first, days in order.
+
+Periods match the cost subcommands: today, week (last 7 days), month
+(last 30 days), and total (all time). Days start at midnight in the local
+time zone, or in the zone named by --tz.
+
+Examples:
+  imggen cost breakdown                         # per-model spend, last 30 days
+  imggen cost breakdown --by day --period week
+  imggen cost breakdown --by provider --period total --json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCostBreakdown(app)
+		},
+	}
+	cmd.Flags().StringVar(&flagCostBreakdownBy, "by", "model", "group by model, day, or provider")
+	cmd.Flags().StringVar(&flagCostBreakdownPeriod, "period", "month", "period to cover: today, week, month, or total")
+	cmd.Flags().StringVar(&flagCostTZ, "tz", "", "IANA time zone for day boundaries, e.g. UTC or Europe/Berlin (default local)")
+	return cmd
+}
+
+func newCostExportCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export every cost entry as CSV or JSON",
+		Long: `Export the raw cost log for accounting: one row per logged cost with
+its timestamp, provider, model, cost, and image count.
+
+--from and --to are dates (YYYY-MM-DD) in the local time zone, or in the
+zone named by --tz, and both are inclusive. Leave either out for an
+open-ended range.
+
+Examples:
+  imggen cost export -o costs.csv
+  imggen cost export --from 2025-06-01 --to 2025-06-30 -o june.csv
+  imggen cost export --format json --from 2025-06-01`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCostExport(app)
+		},
+	}
+	cmd.Flags().StringVar(&flagCostExportFormat, "format", "csv", "output format: csv or json")
+	cmd.Flags().StringVar(&flagCostExportFrom, "from", "", "first day to include, YYYY-MM-DD (default: the first entry)")
+	cmd.Flags().StringVar(&flagCostExportTo, "to", "", "last day to include, YYYY-MM-DD (default: the latest entry)")
+	cmd.Flags().StringVarP(&flagCostExportOutput, "output", "o", "", "file to write (default stdout)")
+	cmd.Flags().StringVar(&flagCostTZ, "tz", "", "IANA time zone for --from and --to, e.g. UTC or Europe/Berlin (default local)")
 	return cmd
 }
 
+// costPeriodNames describe the periods of the cost subcommands.
+var costPeriodNames = map[string]string{
+	"today": "today",
+	"week":  "the last 7 days",
+	"month": "the last 30 days",
+	"total": "all time",
+}
+
+// costPeriod returns the range [start, end) of a named period at now:
+// today from midnight, week and month as the last 7 and 30 days, and total
+// as an open range, given as zero times.
+func costPeriod(period string, now time.Time) (time.Time, time.Time, error) {
+	switch period {
+	case "today":
+		start, end := dayRange(now)
+		return start, end, nil
+	case "week":
+		return now.AddDate(0, 0, -7), now, nil
+	case "month":
+		return now.AddDate(0, 0, -30), now, nil
+	case "total":
+		return time.Time{}, time.Time{}, nil
+	}
+	hint := suggest.DidYouMean(period, []string{"today", "week", "month", "total"})
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid --period %q%s: use today, week, month, or total", period, hint)
+}
+
+// costLocation returns the time zone named by --tz, or the local zone.
+func costLocation() (*time.Location, error) {
+	if flagCostTZ == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(flagCostTZ)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --tz %q: %w", flagCostTZ, err)
+	}
+	return loc, nil
+}
+
+// dayRange returns the start of the calendar day containing t and the start
+// of the next day, both in t's location. Days around a DST change are not
+// 24 hours long, so the end is found by date rather than by duration.
+func dayRange(t time.Time) (time.Time, time.Time) {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
 func runCost(app *App, args []string) error {
 	ctx := context.Background()
 
@@ -227,43 +699,52 @@ func runCost(app *App, args []string) error {
 		subcommand = args[0]
 	}
 
+	money, err := cost.NewFormatter(flagLocale)
+	if err != nil {
+		return err
+	}
+
+	loc, err := costLocation()
+	if err != nil {
+		return err
+	}
+
 	fmt.Fprintln(app.Out, "\033[33mNote: Costs estimated from https://openai.com/api/pricing (not returned by API)\033[0m")
 	fmt.Fprintln(app.Out)
 
-	now := time.Now()
+	now := time.Now().In(loc)
 
 	switch subcommand {
 	case "today":
-		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-		end := start.Add(24 * time.Hour)
+		start, end, _ := costPeriod(subcommand, now)
 		summary, err := store.GetCostByDateRange(ctx, start, end)
 		if err != nil {
 			return fmt.Errorf("failed to get costs: %w", err)
 		}
-		fmt.Fprintf(app.Out, "Today's cost: $%.4f (%d image(s))\n", summary.TotalCost, summary.ImageCount)
+		fmt.Fprintf(app.Out, "Today's cost: %s (%d image(s))\n", money.USD(summary.TotalCost, 4), summary.ImageCount)
 
 	case "week":
-		start := now.AddDate(0, 0, -7)
-		summary, err := store.GetCostByDateRange(ctx, start, now)
+		start, end, _ := costPeriod(subcommand, now)
+		summary, err := store.GetCostByDateRange(ctx, start, end)
 		if err != nil {
 			return fmt.Errorf("failed to get costs: %w", err)
 		}
-		fmt.Fprintf(app.Out, "This week's cost: $%.4f (%d image(s))\n", summary.TotalCost, summary.ImageCount)
+		fmt.Fprintf(app.Out, "This week's cost: %s (%d image(s))\n", money.USD(summary.TotalCost, 4), summary.ImageCount)
 
 	case "month":
-		start := now.AddDate(0, 0, -30)
-		summary, err := store.GetCostByDateRange(ctx, start, now)
+		start, end, _ := costPeriod(subcommand, now)
+		summary, err := store.GetCostByDateRange(ctx, start, end)
 		if err != nil {
 			return fmt.Errorf("failed to get costs: %w", err)
 		}
-		fmt.Fprintf(app.Out, "This month's cost: $%.4f (%d image(s))\n", summary.TotalCost, summary.ImageCount)
+		fmt.Fprintf(app.Out, "This month's cost: %s (%d image(s))\n", money.USD(summary.TotalCost, 4), summary.ImageCount)
 
 	case "total":
 		summary, err := store.GetTotalCost(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to get costs: %w", err)
 		}
-		fmt.Fprintf(app.Out, "Total cost: $%.4f (%d image(s))\n", summary.TotalCost, summary.ImageCount)
+		fmt.Fprintf(app.Out, "Total cost: %s (%d image(s))\n", money.USD(summary.TotalCost, 4), summary.ImageCount)
 
 	case "provider":
 		summaries, err := store.GetCostByProvider(ctx)
@@ -275,1357 +756,6203 @@ func runCost(app *App, args []string) error {
 		var totalImages int
 		var totalCost float64
 		for _, s := range summaries {
-			fmt.Fprintf(app.Out, "%-12s %8d %10s\n", s.Provider, s.ImageCount, fmt.Sprintf("$%.4f", s.TotalCost))
+			fmt.Fprintf(app.Out, "%-12s %8d %10s\n", s.Provider, s.ImageCount, money.USD(s.TotalCost, 4))
 			totalImages += s.ImageCount
 			totalCost += s.TotalCost
 		}
 		fmt.Fprintln(app.Out, "--------------------------------")
-		fmt.Fprintf(app.Out, "%-12s %8d %10s\n", "Total", totalImages, fmt.Sprintf("$%.4f", totalCost))
+		fmt.Fprintf(app.Out, "%-12s %8d %10s\n", "Total", totalImages, money.USD(totalCost, 4))
 
 	default:
-		return fmt.Errorf("unknown subcommand %q: use today, week, month, total, or provider", subcommand)
+		hint := suggest.DidYouMean(subcommand, []string{"today", "week", "month", "total", "provider"})
+		return fmt.Errorf("unknown subcommand %q%s: use today, week, month, total, or provider", subcommand, hint)
 	}
 
 	return nil
 }
 
-func runGenerate(_ *cobra.Command, args []string, app *App) error {
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+// costBreakdownJSON is the --json output of `cost breakdown`.
+type costBreakdownJSON struct {
+	By         string          `json:"by"`
+	Period     string          `json:"period"`
+	Groups     []costGroupJSON `json:"groups"`
+	TotalCost  float64         `json:"total_cost"`
+	ImageCount int             `json:"image_count"`
+}
 
-	// Get API key using priority: --api-key flag > stored key > env var
-	apiKey, _, err := keys.GetAPIKey(flagAPIKey, "openai", "OPENAI_API_KEY")
+// costGroupJSON is one row of a cost breakdown.
+type costGroupJSON struct {
+	Key        string  `json:"key"`
+	Cost       float64 `json:"cost"`
+	ImageCount int     `json:"image_count"`
+	Entries    int     `json:"entries"`
+}
+
+func runCostBreakdown(app *App) error {
+	app, jsonOut := withJSONOutput(app)
+	ctx := context.Background()
+
+	column := map[string]string{"model": "Model", "day": "Day", "provider": "Provider"}[flagCostBreakdownBy]
+	if column == "" {
+		hint := suggest.DidYouMean(flagCostBreakdownBy, []string{"model", "day", "provider"})
+		return fmt.Errorf("invalid --by %q%s: use model, day, or provider", flagCostBreakdownBy, hint)
+	}
+	loc, err := costLocation()
 	if err != nil {
 		return err
 	}
-
-	format := models.OutputFormat(flagFormat)
-	if !format.IsValid() {
-		return fmt.Errorf("invalid format %q: must be one of %v", flagFormat, models.ValidFormats())
+	start, end, err := costPeriod(flagCostBreakdownPeriod, time.Now().In(loc))
+	if err != nil {
+		return err
+	}
+	money, err := cost.NewFormatter(flagLocale)
+	if err != nil {
+		return err
 	}
 
-	// Handle multiple prompts via --prompt flag
-	if len(flagPrompts) > 0 {
-		return runMultiPrompt(ctx, app, apiKey, format)
+	dbPath, err := getDBPath()
+	if err != nil {
+		return err
+	}
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
 	}
+	defer store.Close()
 
-	// Single prompt mode (positional argument)
-	prompt := args[0]
+	var groups []session.CostGroup
+	switch flagCostBreakdownBy {
+	case "model":
+		groups, err = store.GetCostByModel(ctx, start, end)
+	case "day":
+		groups, err = store.GetCostByDay(ctx, start, end, loc)
+	case "provider":
+		groups, err = store.GetCostByProviderRange(ctx, start, end)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get costs: %w", err)
+	}
 
-	req := models.NewRequest(prompt)
-	req.Model = flagModel
-	req.Size = flagSize
-	req.Quality = flagQuality
-	req.Count = flagCount
-	req.Style = flagStyle
-	req.Format = format
-	req.Transparent = flagTransparent
+	result := costBreakdownJSON{By: flagCostBreakdownBy, Period: flagCostBreakdownPeriod, Groups: []costGroupJSON{}}
+	width := len(column)
+	for _, g := range groups {
+		result.Groups = append(result.Groups, costGroupJSON{Key: g.Key, Cost: g.TotalCost, ImageCount: g.ImageCount, Entries: g.EntryCount})
+		result.TotalCost += g.TotalCost
+		result.ImageCount += g.ImageCount
+		width = max(width, len(g.Key))
+	}
+	if jsonOut != nil {
+		return writeJSON(jsonOut, result)
+	}
 
-	caps, ok := app.Registry.Get(flagModel)
-	if !ok {
-		return fmt.Errorf("unknown model %q: available models: %v", flagModel, app.Registry.List())
+	period := costPeriodNames[flagCostBreakdownPeriod]
+	if len(groups) == 0 {
+		fmt.Fprintf(app.Out, "No costs logged for %s\n", period)
+		return nil
 	}
+	fmt.Fprintf(app.Out, "Cost by %s for %s:\n\n", flagCostBreakdownBy, period)
+	rule := strings.Repeat("-", width+20)
+	fmt.Fprintf(app.Out, "%-*s %8s %10s\n", width, column, "Images", "Cost")
+	fmt.Fprintln(app.Out, rule)
+	for _, g := range groups {
+		fmt.Fprintf(app.Out, "%-*s %8d %10s\n", width, g.Key, g.ImageCount, money.USD(g.TotalCost, 4))
+	}
+	fmt.Fprintln(app.Out, rule)
+	fmt.Fprintf(app.Out, "%-*s %8d %10s\n", width, "Total", result.ImageCount, money.USD(result.TotalCost, 4))
+	return nil
+}
 
-	caps.ApplyDefaults(req)
+// costCSVHeader is the header row of `cost export --format csv`. Columns
+// are only ever added at the end, so spreadsheets keyed on them keep
+// working.
+var costCSVHeader = []string{"timestamp", "provider", "model", "cost", "image_count", "session_id", "iteration_id", "cache_hit"}
+
+// costExportEntry is one cost entry in `cost export --format json`.
+type costExportEntry struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Provider    string    `json:"provider"`
+	Model       string    `json:"model"`
+	Cost        float64   `json:"cost"`
+	ImageCount  int       `json:"image_count"`
+	SessionID   string    `json:"session_id,omitempty"`
+	IterationID string    `json:"iteration_id,omitempty"`
+	CacheHit    bool      `json:"cache_hit"`
+}
 
-	if err := caps.Validate(req); err != nil {
-		return fmt.Errorf("invalid request: %w", err)
+func runCostExport(app *App) error {
+	if flagCostExportFormat != "csv" && flagCostExportFormat != "json" {
+		return fmt.Errorf("invalid --format %q: must be csv or json", flagCostExportFormat)
 	}
-
-	providerCfg := &provider.Config{APIKey: apiKey, Verbose: flagVerbose}
-	prov, err := app.NewProvider(providerCfg, app.Registry)
+	loc, err := costLocation()
 	if err != nil {
-		return fmt.Errorf("failed to create provider: %w", err)
+		return err
+	}
+	var start, end time.Time
+	if flagCostExportFrom != "" {
+		day, err := time.ParseInLocation(time.DateOnly, flagCostExportFrom, loc)
+		if err != nil {
+			return fmt.Errorf("invalid --from %q: want a date like 2025-06-01", flagCostExportFrom)
+		}
+		start, _ = dayRange(day)
+	}
+	if flagCostExportTo != "" {
+		day, err := time.ParseInLocation(time.DateOnly, flagCostExportTo, loc)
+		if err != nil {
+			return fmt.Errorf("invalid --to %q: want a date like 2025-06-30", flagCostExportTo)
+		}
+		_, end = dayRange(day)
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		return fmt.Errorf("--from %s is after --to %s", flagCostExportFrom, flagCostExportTo)
 	}
 
-	fmt.Fprintf(app.Out, "Generating %d image(s) with %s...\n", req.Count, req.Model)
+	dbPath, err := getDBPath()
+	if err != nil {
+		return err
+	}
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer store.Close()
 
-	resp, err := prov.Generate(ctx, req)
+	entries, err := store.ListCostEntries(context.Background(), start, end)
 	if err != nil {
-		return fmt.Errorf("generation failed: %w", err)
+		return fmt.Errorf("failed to get costs: %w", err)
 	}
 
-	saver := app.NewSaver()
-	paths, err := saver.SaveAll(ctx, resp, flagOutput, format)
+	var buf bytes.Buffer
+	if flagCostExportFormat == "json" {
+		err = writeCostJSON(&buf, entries)
+	} else {
+		err = writeCostCSV(&buf, entries)
+	}
 	if err != nil {
 		return err
 	}
 
-	for _, path := range paths {
-		fmt.Fprintf(app.Out, "Saved: %s\n", path)
+	if flagCostExportOutput == "" {
+		_, err := app.Out.Write(buf.Bytes())
+		return err
 	}
+	if err := os.WriteFile(flagCostExportOutput, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", flagCostExportOutput, err)
+	}
+	fmt.Fprintf(app.Out, "Exported %d cost entries to %s\n", len(entries), flagCostExportOutput)
+	return nil
+}
 
-	if resp.Cost != nil {
-		fmt.Fprintf(app.Out, "Cost: $%.4f (%d image(s) @ $%.4f/image, %s %s %s)\n",
-			resp.Cost.Total, len(resp.Images), resp.Cost.PerImage,
-			req.Model, req.Size, req.Quality)
+// writeCostCSV writes entries under costCSVHeader, with UTC RFC 3339
+// timestamps and costs in full precision.
+func writeCostCSV(w io.Writer, entries []session.CostEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write(costCSVHeader)
+	for _, e := range entries {
+		cw.Write([]string{
+			e.Timestamp.UTC().Format(time.RFC3339),
+			e.Provider,
+			e.Model,
+			strconv.FormatFloat(e.Cost, 'f', -1, 64),
+			strconv.Itoa(e.ImageCount),
+			e.SessionID,
+			e.IterationID,
+			strconv.FormatBool(e.CacheHit),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
 
-		// Log cost to database (empty strings for iteration/session as CLI mode doesn't have sessions)
-		store, err := session.NewStore()
-		if err == nil {
-			defer store.Close()
-			costEntry := &session.CostEntry{
-				IterationID: "",
-				SessionID:   "",
-				Provider:    string(prov.Name()),
-				Model:       req.Model,
-				Cost:        resp.Cost.Total,
-				ImageCount:  len(resp.Images),
-				Timestamp:   time.Now(),
-			}
-			if logErr := store.LogCost(ctx, costEntry); logErr != nil {
-				fmt.Fprintf(app.Err, "Warning: failed to log cost: %v\n", logErr)
-			}
+// writeCostJSON writes entries as an indented JSON array; an empty range
+// is [].
+func writeCostJSON(w io.Writer, entries []session.CostEntry) error {
+	out := make([]costExportEntry, len(entries))
+	for i, e := range entries {
+		out[i] = costExportEntry{
+			Timestamp:   e.Timestamp.UTC(),
+			Provider:    e.Provider,
+			Model:       e.Model,
+			Cost:        e.Cost,
+			ImageCount:  e.ImageCount,
+			SessionID:   e.SessionID,
+			IterationID: e.IterationID,
+			CacheHit:    e.CacheHit,
 		}
 	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
 
-	if flagShow {
-		if !display.IsTerminalSupported() {
-			fmt.Fprintln(app.Err, "Warning: terminal may not support Kitty graphics protocol")
-		}
-		displayer := app.NewDisplayer(app.Out)
-		if err := displayer.DisplayAll(ctx, resp); err != nil {
-			fmt.Fprintf(app.Err, "Warning: failed to display image: %v\n", err)
+// conflictCheck reports a combination of flags and arguments that cannot be
+// used together, or nil when there is none.
+type conflictCheck func(app *App, args []string) error
+
+// checkConflicts runs checks before a command does any work and reports
+// every conflict it finds in a single error.
+func checkConflicts(app *App, args []string, checks []conflictCheck) error {
+	var errs []error
+	for _, check := range checks {
+		if err := check(app, args); err != nil {
+			errs = append(errs, err)
 		}
 	}
-
-	if resp.RevisedPrompt != "" {
-		fmt.Fprintf(app.Out, "Revised prompt: %s\n", resp.RevisedPrompt)
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return fmt.Errorf("%d conflicting flag combinations:\n%w", len(errs), errors.Join(errs...))
 	}
-
-	fmt.Fprintln(app.Out, "Done!")
-	return nil
 }
 
-func runMultiPrompt(ctx context.Context, app *App, apiKey string, format models.OutputFormat) error {
-	outputDir := flagOutput
-	if outputDir == "" {
-		outputDir = "."
-		fmt.Fprintln(app.Out, "\033[33mWarning: No output directory specified. Images will be saved to current directory.\033[0m")
-
-		if isTerminal() {
-			fmt.Fprint(app.Out, "Continue? [Y/n] ")
-			reader := bufio.NewReader(os.Stdin)
-			response, _ := reader.ReadString('\n')
-			response = strings.TrimSpace(strings.ToLower(response))
-			if response == "n" || response == "no" {
-				fmt.Fprintln(app.Out, "Aborted.")
-				return nil
-			}
+// generateConflicts are the flag combinations the root command rejects.
+var generateConflicts = []conflictCheck{
+	checkEncodeOptions,
+	func(*App, []string) error {
+		if flagStdoutBase64 && flagOutput != "" && flagOutput != image.StdoutPath {
+			return fmt.Errorf("--stdout-base64 cannot be used with --output %s", flagOutput)
 		}
-	} else {
-		if _, err := os.Stat(outputDir); os.IsNotExist(err) {
-			if isTerminal() {
-				fmt.Fprintf(app.Out, "Directory %q does not exist. Create it? [Y/n] ", outputDir)
-				reader := bufio.NewReader(os.Stdin)
-				response, _ := reader.ReadString('\n')
-				response = strings.TrimSpace(strings.ToLower(response))
-				if response == "n" || response == "no" {
-					fmt.Fprintln(app.Out, "Aborted.")
-					return nil
-				}
-			}
-			if err := os.MkdirAll(outputDir, 0755); err != nil {
-				return fmt.Errorf("failed to create output directory: %w", err)
-			}
-			fmt.Fprintf(app.Out, "Created directory: %s\n", outputDir)
+		return nil
+	},
+	func(*App, []string) error {
+		if writesStdout() && flagCount > 1 {
+			return fmt.Errorf("%s writes a single image, got --count %d; use an output file for more", stdoutFlag(), flagCount)
 		}
-	}
-
-	items := make([]batch.Item, len(flagPrompts))
-	for i, prompt := range flagPrompts {
-		items[i] = batch.Item{
-			Index:  i + 1,
-			Prompt: prompt,
+		return nil
+	},
+	func(*App, []string) error {
+		if writesStdout() && fanOut() {
+			return fmt.Errorf("%s writes a single image and cannot be used with --prompt", stdoutFlag())
 		}
-	}
-
-	fmt.Fprintf(app.Out, "Generating %d images with %s\n", len(items), flagModel)
-	fmt.Fprintf(app.Out, "Output directory: %s\n\n", outputDir)
+		return nil
+	},
+	func(*App, []string) error {
+		if writesStdout() && flagPreviewQuality != "" {
+			return fmt.Errorf("%s cannot be used with --preview-quality, which saves a preview file", stdoutFlag())
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		for _, other := range []struct {
+			set  bool
+			flag string
+		}{{flagJSON, "--json"}, {flagShow, "--show"}, {flagInteractive, "-i/--interactive"}} {
+			if writesStdout() && other.set {
+				return fmt.Errorf("%s cannot be used with %s, which also writes to stdout", stdoutFlag(), other.flag)
+			}
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagNameTemplate != "" && writesStdout() {
+			return fmt.Errorf("--name-template cannot be used with %s, which saves no file", stdoutFlag())
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagNameTemplate != "" && !fanOut() && !image.IsOutputDir(flagOutput) {
+			return fmt.Errorf("--name-template names files saved into a directory, but --output %s is a file; end it with %c to save into a directory", flagOutput, filepath.Separator)
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		_, err := nameTemplate(fanOut())
+		return err
+	},
+	func(_ *App, args []string) error {
+		if flagInteractive && (len(args) > 0 || len(flagPrompts) > 0) {
+			return fmt.Errorf("-i/--interactive cannot be used with a prompt; enter prompts in the session instead")
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagInteractive && flagJSON {
+			return fmt.Errorf("-i/--interactive cannot be used with --json")
+		}
+		return nil
+	},
+	func(_ *App, args []string) error {
+		if fanOut() && len(args) > 0 {
+			return fmt.Errorf("use either --prompt or a positional prompt, not both")
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagCombinePrompts && len(flagPrompts) == 0 {
+			return fmt.Errorf("--combine-prompts joins --prompt values; pass at least one --prompt")
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagPreviewQuality != "" && fanOut() {
+			return fmt.Errorf("--preview-quality cannot be used with --prompt")
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagPreviewQuality != "" && flagJSON {
+			return fmt.Errorf("--preview-quality cannot be used with --json")
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagPreviewQuality != "" && flagDryRun {
+			return fmt.Errorf("--preview-quality cannot be used with --dry-run, which generates nothing")
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		format := models.OutputFormat(flagFormat)
+		if flagTransparent && format != "" && !format.IsAuto() && format != models.FormatPNG && format != models.FormatWebP {
+			return fmt.Errorf("--transparent cannot be used with --format %s: %w", format, models.ErrInvalidTransparencyFormat)
+		}
+		return nil
+	},
+	func(app *App, _ []string) error {
+		return modelFlagConflict(app, flagStyle != "", "--style", models.ErrStyleNotSupported,
+			func(c *models.ModelCapabilities) bool { return c.SupportsStyle })
+	},
+	func(app *App, _ []string) error {
+		return modelFlagConflict(app, flagSeed != 0, "--seed", models.ErrSeedNotSupported,
+			func(c *models.ModelCapabilities) bool { return c.SupportsSeed })
+	},
+	func(app *App, _ []string) error {
+		return modelFlagConflict(app, flagTransparent, "--transparent", models.ErrTransparencyNotSupported,
+			func(c *models.ModelCapabilities) bool { return c.SupportsTransparency })
+	},
+}
 
-	providerCfg := &provider.Config{APIKey: apiKey, Verbose: flagVerbose}
-	prov, err := app.NewProvider(providerCfg, app.Registry)
+// modelFlagConflict reports flag, when set, as a conflict with the selected
+// model if the model lacks the capability supports checks for. Unknown
+// models are left for request validation to report.
+func modelFlagConflict(app *App, set bool, flag string, sentinel error, supports func(*models.ModelCapabilities) bool) error {
+	if !set {
+		return nil
+	}
+	model, err := app.Registry.Resolve(flagModel)
 	if err != nil {
-		return fmt.Errorf("failed to create provider: %w", err)
+		return nil
+	}
+	caps, ok := app.Registry.Get(model)
+	if !ok || supports(caps) {
+		return nil
 	}
 
-	processor := batch.NewProcessor(prov, app.NewSaver(), app.Registry, app.Out, app.Err)
-
-	opts := &batch.Options{
-		OutputDir:      outputDir,
-		DefaultModel:   flagModel,
-		DefaultSize:    flagSize,
-		DefaultQuality: flagQuality,
-		Format:         format,
-		Parallel:       flagParallel,
-		StopOnError:    false,
-		DelayMs:        0,
+	var capable []string
+	for _, name := range app.Registry.List() {
+		if c, ok := app.Registry.Get(name); ok && supports(c) {
+			capable = append(capable, name)
+		}
 	}
+	slices.Sort(capable)
+	return fmt.Errorf("%s cannot be used with %s (%w); models that support it: %s",
+		flag, model, sentinel, strings.Join(capable, ", "))
+}
 
-	results, err := processor.Process(ctx, items, opts)
+// outputFormat returns the format an -o path's extension names, so edit and
+// vary can save as jpeg or webp; anything else is saved as png.
+func outputFormat(path string) models.OutputFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return models.FormatJPEG
+	case ".webp":
+		return models.FormatWebP
+	default:
+		return models.FormatPNG
+	}
+}
 
-	processor.PrintSummary(results)
+// addEncodeFlags registers --jpeg-quality, --webp-quality, and
+// --webp-lossless on a command that saves images.
+func addEncodeFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&flagJPEGQuality, "jpeg-quality", image.DefaultEncodeOptions.JPEGQuality, "JPEG quality (1-100) for images imggen re-encodes as jpeg")
+	cmd.Flags().IntVar(&flagWebPQuality, "webp-quality", image.DefaultEncodeOptions.WebPQuality, "WebP quality (0-100); files stay lossless VP8L, not lossy WebP, and lower values posterize colors for smaller files")
+	cmd.Flags().BoolVar(&flagWebPLossless, "webp-lossless", false, "keep WebP pixels exact, including under transparent areas (ignores --webp-quality)")
+}
 
-	if err != nil {
-		return err
+// encodeOptions returns the --jpeg-quality, --webp-quality, and
+// --webp-lossless settings.
+func encodeOptions() image.EncodeOptions {
+	return image.EncodeOptions{
+		JPEGQuality:  flagJPEGQuality,
+		WebPQuality:  flagWebPQuality,
+		WebPLossless: flagWebPLossless,
 	}
+}
 
-	var totalCost float64
-	for _, r := range results {
-		if r.Error == nil {
-			totalCost += r.Cost
-		}
-	}
-	if totalCost > 0 {
-		store, storeErr := session.NewStore()
-		if storeErr == nil {
-			defer store.Close()
-			costEntry := &session.CostEntry{
-				IterationID: "",
-				SessionID:   "",
-				Provider:    string(prov.Name()),
-				Model:       flagModel,
-				Cost:        totalCost,
-				ImageCount:  countSuccessful(results),
-				Timestamp:   time.Now(),
-			}
-			if logErr := store.LogCost(ctx, costEntry); logErr != nil {
-				fmt.Fprintf(app.Err, "Warning: failed to log cost: %v\n", logErr)
-			}
-		}
+// checkEncodeOptions reports a --jpeg-quality or --webp-quality out of range.
+func checkEncodeOptions(*App, []string) error {
+	if err := encodeOptions().Validate(); err != nil {
+		return fmt.Errorf("invalid encoding options: %w", err)
 	}
-
 	return nil
 }
 
-func runInteractive(_ *cobra.Command, app *App) error {
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+// newSaver returns the app's Saver, re-encoding with the encoding flags.
+func newSaver(app *App) *image.Saver {
+	return app.NewSaver().WithEncodeOptions(encodeOptions()).WithDownloader(newDownloader())
+}
 
-	// Get API key using priority: --api-key flag > stored key > env var
-	apiKey, _, err := keys.GetAPIKey(flagAPIKey, "openai", "OPENAI_API_KEY")
-	if err != nil {
-		return err
+// newDownloader returns the downloader for images a model returns as URLs,
+// retrying failed downloads as --retries says and bounded by --timeout.
+func newDownloader() *provider.Downloader {
+	cfg := newProviderConfig("", "")
+	// The URLs come from a provider built with the same --proxy and
+	// --ca-cert, which has already reported them if they are invalid.
+	transport, _ := provider.HTTPTransport(cfg)
+	d := &provider.Downloader{
+		Client:     &http.Client{Transport: transport},
+		MaxRetries: flagRetries,
+		Timeout:    cfg.Timeouts().Download,
 	}
-
-	prov, err := app.NewProvider(&provider.Config{APIKey: apiKey, Verbose: flagVerbose}, app.Registry)
-	if err != nil {
-		return fmt.Errorf("failed to create provider: %w", err)
+	if flagVerbose {
+		d.Log = os.Stderr
 	}
+	return d
+}
 
-	store, err := session.NewStore()
+// nameTemplate parses --name-template, returning "" when it is unset. Runs
+// that save one file per prompt need {index} so prompts cannot overwrite
+// each other's files.
+func nameTemplate(perPrompt bool) (image.NameTemplate, error) {
+	if flagNameTemplate == "" {
+		return "", nil
+	}
+	tmpl, err := image.ParseNameTemplate(flagNameTemplate)
 	if err != nil {
-		return fmt.Errorf("failed to initialize session store: %w", err)
+		return "", fmt.Errorf("--name-template: %w", err)
 	}
-	defer store.Close()
+	if perPrompt && !tmpl.Has("index") {
+		return "", fmt.Errorf("--name-template %q must include {index} so each prompt gets its own file", flagNameTemplate)
+	}
+	return tmpl, nil
+}
 
-	sessionMgr := session.NewManager(store, flagModel)
+// writesStdout reports whether generate writes its image to stdout, with
+// -o - or --stdout-base64, instead of saving it.
+func writesStdout() bool {
+	return flagOutput == image.StdoutPath || flagStdoutBase64
+}
 
-	replCfg := &repl.Config{
-		In:         os.Stdin,
-		Out:        app.Out,
-		Err:        app.Err,
-		Provider:   prov,
-		Registry:   app.Registry,
-		SessionMgr: sessionMgr,
-		Displayer:  app.NewDisplayer(app.Out),
-		Saver:      app.NewSaver(),
+// stdoutFlag names the flag that sent the image to stdout, for errors.
+func stdoutFlag() string {
+	if flagStdoutBase64 {
+		return "--stdout-base64"
 	}
+	return "-o -"
+}
 
-	r := repl.New(replCfg)
-	return r.Run(ctx)
+// withStdoutOutput returns the App generate should use and, when the image
+// goes to stdout, the writer for it. Progress lines such as "Saved:" move to
+// Err so stdout carries only the image.
+func withStdoutOutput(app *App) (*App, io.Writer) {
+	if !writesStdout() {
+		return app, nil
+	}
+	quiet := *app
+	quiet.Out = app.Err
+	return &quiet, app.Out
 }
 
-var flagDBBackup bool
+// writeStdout writes the single image in resp to w, as base64 with
+// --stdout-base64 and as raw bytes otherwise.
+func writeStdout(ctx context.Context, saver *image.Saver, resp *models.Response, w io.Writer, format models.OutputFormat) error {
+	if !flagStdoutBase64 {
+		return saver.WriteImage(ctx, resp, w, format)
+	}
+	enc := base64.NewEncoder(base64.StdEncoding, w)
+	if err := saver.WriteImage(ctx, resp, enc, format); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to write image: %w", err)
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
 
-func newDBCmd(app *App) *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "db",
-		Short: "Database management commands",
-		Long:  `Manage the SQLite database storing sessions and cost data.`,
+func runGenerate(_ *cobra.Command, args []string, app *App) error {
+	if err := checkConflicts(app, args, generateConflicts); err != nil {
+		return err
 	}
 
-	infoCmd := &cobra.Command{
-		Use:   "info",
-		Short: "Show database location and statistics",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return runDBInfo(app)
-		},
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	app, jsonOut := withJSONOutput(app)
+	app, stdout := withStdoutOutput(app)
+
+	model, err := app.Registry.Resolve(flagModel)
+	if err != nil {
+		return err
 	}
+	flagModel = model
 
-	resetCmd := &cobra.Command{
-		Use:   "reset",
-		Short: "Reset database (delete all data)",
-		Long: `Reset the database by deleting all data.
+	// A dry run never reaches the API, so it needs no key.
+	var apiKey string
+	if !flagDryRun {
+		apiKey, err = apiKeyForProvider(providerForModel(app.Registry, flagModel))
+		if err != nil {
+			return err
+		}
+	}
 
-Use --backup to save the old database before resetting.
-The backup will be saved as sessions.db.backup-TIMESTAMP`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return runDBReset(app)
-		},
+	// An empty format is settled per model by ApplyDefaults.
+	format := models.OutputFormat(flagFormat)
+	if format != "" && !format.IsValid() && !format.IsAuto() {
+		return invalidFormatError(flagFormat)
+	}
+	if format.IsAuto() && flagTransparent {
+		format = models.FormatPNG
 	}
-	resetCmd.Flags().BoolVar(&flagDBBackup, "backup", false, "backup old database before reset")
 
-	cmd.AddCommand(infoCmd)
-	cmd.AddCommand(resetCmd)
+	// Handle multiple prompts via --prompt flag
+	if fanOut() {
+		if flagDryRun {
+			return dryRunItems(app, jsonOut, promptItems(), multiPromptOptions(format))
+		}
+		return runMultiPrompt(ctx, app, jsonOut, format)
+	}
+	if flagMaxPromptDrift < 0 || flagMaxPromptDrift > 1 {
+		return fmt.Errorf("--max-prompt-drift must be between 0 and 1, got %g", flagMaxPromptDrift)
+	}
 
-	return cmd
-}
+	// Single prompt mode (positional argument, or stdin when none is given)
+	var prompt string
+	if flagCombinePrompts {
+		prompt = combinedPrompt(args)
+	} else if len(args) > 0 {
+		prompt = args[0]
+	} else {
+		if flagPreviewQuality != "" {
+			return fmt.Errorf("--preview-quality asks for confirmation on stdin; pass the prompt as an argument instead")
+		}
+		prompt, err = readStdinPrompt(app)
+		if err != nil {
+			return err
+		}
+	}
 
-func runDBInfo(app *App) error {
-	ctx := context.Background()
+	req := models.NewRequest(prompt)
+	req.Model = flagModel
+	req.Size = flagSize
+	req.Quality = flagQuality
+	req.Count = flagCount
+	req.Style = flagStyle
+	req.Seed = flagSeed
+	req.Format = format
+	req.Transparent = flagTransparent
+	req.NoRevise = flagNoRevise
 
-	dbPath, err := getDBPath()
-	if err != nil {
-		return err
+	caps, ok := app.Registry.Get(flagModel)
+	if !ok {
+		return fmt.Errorf("unknown model %q: available models: %v", flagModel, app.Registry.List())
 	}
 
-	fmt.Fprintf(app.Out, "Database location: %s\n\n", dbPath)
+	caps.ApplyDefaults(req)
+	if format == "" {
+		format = req.Format
+	}
+	if flagStripWeights {
+		var stripped bool
+		if req.Prompt, stripped = caps.StripWeights(req.Prompt); stripped {
+			fmt.Fprintf(app.warn(), "Warning: removed prompt weights; %s does not support weighted terms\n", req.Model)
+		}
+	}
 
-	// Check if file exists
-	info, err := os.Stat(dbPath)
-	if os.IsNotExist(err) {
-		fmt.Fprintln(app.Out, "Database does not exist yet (will be created on first use)")
+	if err := caps.Validate(req); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+
+	if flagDryRun {
+		if jsonOut != nil {
+			return printDryRun(app, jsonOut, []dryRunRequest{newDryRunRequest(0, req, format)})
+		}
+		fmt.Fprintln(app.Out, "Dry run: nothing will be sent to the API.")
+		explainRequest(app.Out, req, caps, format)
 		return nil
 	}
-	if err != nil {
-		return fmt.Errorf("failed to stat database: %w", err)
+
+	if flagExplain {
+		explainOut := app.Out
+		if jsonOut != nil {
+			explainOut = app.Err
+		}
+		explainRequest(explainOut, req, caps, format)
 	}
 
-	fmt.Fprintf(app.Out, "Database size: %.2f KB\n", float64(info.Size())/1024)
-	fmt.Fprintf(app.Out, "Last modified: %s\n\n", info.ModTime().Format("2006-01-02 15:04:05"))
+	estimate := calculator().Estimate(req.Model, req.Size, req.Quality, req.Count).Total
+	if !confirmCost(app, estimate, flagYes || jsonOut != nil) {
+		fmt.Fprintln(app.Out, "Aborted.")
+		return nil
+	}
 
-	store, err := session.NewStoreWithPath(dbPath)
+	providerCfg := newProviderConfig(caps.Provider, apiKey)
+	prov, err := app.NewProvider(providerCfg, app.Registry)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return fmt.Errorf("failed to create provider: %w", err)
 	}
-	defer store.Close()
-
-	// Get session count
-	sessions, err := store.ListSessions(ctx)
+	prov, err = withCache(app, prov)
 	if err != nil {
-		return fmt.Errorf("failed to list sessions: %w", err)
+		return err
 	}
 
-	// Get cost summary
-	costSummary, err := store.GetTotalCost(ctx)
+	eventLog, err := newEventLogger()
 	if err != nil {
-		return fmt.Errorf("failed to get cost summary: %w", err)
+		return err
 	}
 
-	fmt.Fprintln(app.Out, "Statistics:")
-	fmt.Fprintf(app.Out, "  Sessions: %d\n", len(sessions))
-	fmt.Fprintf(app.Out, "  Total images generated: %d\n", costSummary.ImageCount)
-	fmt.Fprintf(app.Out, "  Total cost: $%.4f\n", costSummary.TotalCost)
-
-	return nil
-}
-
-func runDBReset(app *App) error {
-	dbPath, err := getDBPath()
+	thr, err := newThrottle()
 	if err != nil {
 		return err
 	}
-
-	// Check if file exists
-	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		fmt.Fprintln(app.Out, "Database does not exist, nothing to reset")
-		return nil
+	if err := thr.Wait(ctx); err != nil {
+		return fmt.Errorf("throttle: %w", err)
 	}
 
-	if flagDBBackup {
-		backupPath := dbPath + ".backup-" + time.Now().Format("20060102-150405")
-		data, err := os.ReadFile(dbPath)
+	if flagPreviewQuality != "" {
+		proceed, err := runPreview(ctx, app, prov, eventLog, caps, req, format)
 		if err != nil {
-			return fmt.Errorf("failed to read database for backup: %w", err)
+			return err
 		}
-		if err := os.WriteFile(backupPath, data, 0600); err != nil {
-			return fmt.Errorf("failed to write backup: %w", err)
+		if !proceed {
+			fmt.Fprintln(app.info(), "Skipped final generation.")
+			return nil
+		}
+		if err := thr.Wait(ctx); err != nil {
+			return fmt.Errorf("throttle: %w", err)
 		}
-		fmt.Fprintf(app.Out, "Backup saved to: %s\n", backupPath)
-	}
-
-	if err := os.Remove(dbPath); err != nil {
-		return fmt.Errorf("failed to delete database: %w", err)
 	}
 
-	fmt.Fprintln(app.Out, "Database deleted successfully")
+	fmt.Fprintf(app.info(), "Generating %d image(s) with %s...\n", req.Count, req.Model)
+	warnNoRevise(app, req.Model)
 
-	// Create fresh database
-	store, err := session.NewStoreWithPath(dbPath)
+	start := time.Now()
+	spinner := progress.Start(app.Out, showSpinner(app))
+	resp, err := prov.Generate(ctx, req)
+	spinner.Stop()
+	logGenerateEvent(app, eventLog, req, resp, start, err)
 	if err != nil {
-		return fmt.Errorf("failed to create new database: %w", err)
+		return fmt.Errorf("generation failed: %w", err)
 	}
-	store.Close()
-
-	fmt.Fprintln(app.Out, "Fresh database created")
-	return nil
-}
 
-var getDBPath = func() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
+	saver := newSaver(app)
+	if flagEmbedMetadata {
+		saver = saver.WithParams(image.NewGenerationParams(req, resp))
+	}
+	if flagProvenance {
+		saver = saver.WithProvenance(image.NewProvenance(req, resp))
+	}
+	if flagNameTemplate != "" {
+		saver = saver.WithNameTemplate(image.NameTemplate(flagNameTemplate), image.NameFields{
+			Prompt: req.Prompt,
+			Model:  req.Model,
+			Size:   req.Size,
+			Seed:   req.Seed,
+			Time:   start,
+		})
+	}
+	var paths []string
+	if stdout != nil {
+		if err := writeStdout(ctx, saver, resp, stdout, format); err != nil {
+			return err
+		}
+		fmt.Fprintln(app.Out, "Saved: stdout")
+	} else {
+		// Report whatever was written even if saving was interrupted part way.
+		paths, err = saver.SaveAll(ctx, resp, flagOutput, format)
+		for _, path := range paths {
+			fmt.Fprintf(app.Out, "Saved: %s\n", path)
+		}
+		if err != nil {
+			return err
+		}
 	}
-	return filepath.Join(homeDir, ".imggen", "sessions.db"), nil
-}
-
-func newBatchCmd(app *App) *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "batch <input-file>",
-		Short: "Generate images in batch from a file",
-		Long: `Generate multiple images from a file containing prompts.
 
-Input formats:
-  .txt - One prompt per line (lines starting with # are ignored)
-  .json - JSON array of objects with prompt/model/size/quality fields
+	if resp.Cost != nil {
+		fmt.Fprintf(app.info(), "Cost: $%.4f (%d image(s) @ $%.4f/image, %s %s %s)\n",
+			resp.Cost.Total, len(resp.Images), resp.Cost.PerImage,
+			req.Model, req.Size, req.Quality)
+		switch resp.Cost.Source {
+		case models.CostSourceUsage:
+			fmt.Fprintln(app.info(), "      (priced from API token usage)")
+		case models.CostSourceCache:
+			fmt.Fprintln(app.info(), "      (cache hit, no API call)")
+		case models.CostSourceOverride:
+			fmt.Fprintln(app.info(), "      (priced from ~/.imggen/pricing.json)")
+		}
+		if err := logGenerationCost(ctx, app, prov, req.Model, resp); err != nil {
+			return err
+		}
+	}
+	printTiming(app, resp)
 
-Examples:
-  imggen batch prompts.txt
-  imggen batch prompts.txt -o ./output
-  imggen batch prompts.json -o ./output -p 3
-  imggen batch prompts.txt -o ./output -m dall-e-3 -q hd`,
-		Args: cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return runBatch(cmd, args, app)
-		},
+	if flagShow {
+		if _, ok := display.IsTerminalSupported(); !ok && flagShowProtocol == display.ProtocolAuto {
+			if err := softFail(app, "no inline image protocol detected, trying Kitty (set --show-protocol to choose)"); err != nil {
+				return err
+			}
+		}
+		displayer := newDisplayer(app)
+		if err := displayer.DisplayAll(ctx, resp); err != nil {
+			if err := softFail(app, "failed to display image: %w", err); err != nil {
+				return err
+			}
+		}
 	}
 
-	cmd.Flags().StringVarP(&flagBatchOutput, "output", "o", "", "output directory for generated images")
-	cmd.Flags().StringVarP(&flagBatchModel, "model", "m", "gpt-image-1", "default model for prompts without model specified")
-	cmd.Flags().StringVarP(&flagBatchSize, "size", "s", "", "default image size")
-	cmd.Flags().StringVarP(&flagBatchQuality, "quality", "q", "", "default quality level")
-	cmd.Flags().StringVarP(&flagBatchFormat, "format", "f", "png", "output format (png, jpeg, webp)")
-	cmd.Flags().IntVarP(&flagBatchParallel, "parallel", "p", 1, "number of parallel workers (1 = sequential)")
-	cmd.Flags().BoolVar(&flagBatchStopOnError, "stop-on-error", false, "stop batch on first error")
-	cmd.Flags().IntVar(&flagBatchDelay, "delay", 0, "delay between requests in milliseconds")
-	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key (defaults to OPENAI_API_KEY)")
-	cmd.Flags().BoolVarP(&flagVerbose, "verbose", "v", false, "log HTTP requests and responses")
+	if resp.RevisedPrompt != "" {
+		fmt.Fprintf(app.info(), "Revised prompt: %s\n", resp.RevisedPrompt)
+	}
+	// The images are already saved; a drifted prompt fails the run so
+	// scripts notice, but keeps what was paid for.
+	if err := checkPromptDrift(app, req.Prompt, resp.RevisedPrompt); err != nil {
+		return err
+	}
 
-	return cmd
+	fmt.Fprintln(app.info(), "Done!")
+
+	if jsonOut != nil {
+		return writeJSON(jsonOut, newGenerateJSON(req, resp, paths))
+	}
+	return nil
 }
 
-func runBatch(_ *cobra.Command, args []string, app *App) error {
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+// printTiming reports how long resp took with --verbose, when the provider
+// measured it.
+func printTiming(app *App, resp *models.Response) {
+	if flagVerbose && resp.Timing.TotalDuration > 0 {
+		fmt.Fprintf(app.info(), "Time: %s\n", resp.Timing)
+	}
+}
+
+// checkPromptDrift fails when --max-prompt-drift is set and the model's
+// revised prompt has moved further than that from the original.
+func checkPromptDrift(app *App, original, revised string) error {
+	if flagMaxPromptDrift == 0 || revised == "" {
+		return nil
+	}
+	score := drift.Score(original, revised)
+	if score <= flagMaxPromptDrift {
+		return nil
+	}
+	fmt.Fprintf(app.warn(), "Warning: revised prompt drifted %.2f from the original (limit %.2f)\n", score, flagMaxPromptDrift)
+	return fmt.Errorf("revised prompt drift %.2f exceeds --max-prompt-drift %.2f", score, flagMaxPromptDrift)
+}
 
-	inputFile := args[0]
+// generateJSON is the --json output of a single-prompt generation. Scripts
+// depend on these field names, so add fields rather than renaming them.
+type generateJSON struct {
+	Model         string   `json:"model"`
+	ModelUsed     string   `json:"model_used,omitempty"`
+	CreatedAt     string   `json:"created_at,omitempty"`
+	Prompt        string   `json:"prompt"`
+	RevisedPrompt string   `json:"revised_prompt,omitempty"`
+	Size          string   `json:"size,omitempty"`
+	Quality       string   `json:"quality,omitempty"`
+	Paths         []string `json:"paths"`
+	Cost          float64  `json:"cost"`
+	CostPerImage  float64  `json:"cost_per_image"`
+	InputTokens   int      `json:"input_tokens"`
+	OutputTokens  int      `json:"output_tokens"`
+
+	Timing *timingJSON `json:"timing,omitempty"`
+}
 
-	// Get API key using priority: --api-key flag > stored key > env var
-	apiKey, _, err := keys.GetAPIKey(flagAPIKey, "openai", "OPENAI_API_KEY")
-	if err != nil {
-		return err
+// timingJSON is models.Timing in milliseconds.
+type timingJSON struct {
+	RequestMs  int64 `json:"request_ms"`
+	DownloadMs int64 `json:"download_ms"`
+	TotalMs    int64 `json:"total_ms"`
+}
+
+func newGenerateJSON(req *models.Request, resp *models.Response, paths []string) *generateJSON {
+	out := &generateJSON{
+		Model:         req.Model,
+		Prompt:        req.Prompt,
+		RevisedPrompt: resp.RevisedPrompt,
+		Size:          req.Size,
+		Quality:       req.Quality,
+		Paths:         paths,
+		InputTokens:   resp.InputTokens,
+		OutputTokens:  resp.OutputTokens,
+		ModelUsed:     resp.ModelUsed,
 	}
+	if !resp.CreatedAt.IsZero() {
+		out.CreatedAt = resp.CreatedAt.Format(time.RFC3339)
+	}
+	if t := resp.Timing; t.TotalDuration > 0 {
+		out.Timing = &timingJSON{
+			RequestMs:  t.RequestDuration.Milliseconds(),
+			DownloadMs: t.DownloadDuration.Milliseconds(),
+			TotalMs:    t.TotalDuration.Milliseconds(),
+		}
+	}
+	if resp.Cost != nil {
+		out.Cost = resp.Cost.Total
+		out.CostPerImage = resp.Cost.PerImage
+	}
+	return out
+}
 
-	format := models.OutputFormat(flagBatchFormat)
-	if !format.IsValid() {
-		return fmt.Errorf("invalid format %q: must be one of %v", flagBatchFormat, models.ValidFormats())
+// ocrJSON is the --json output of the ocr command. Schema is only set by
+// --suggest-schema, which sets nothing else but the model and source.
+type ocrJSON struct {
+	Model        string             `json:"model"`
+	Source       string             `json:"source"`
+	Text         string             `json:"text,omitempty"`
+	Structured   json.RawMessage    `json:"structured,omitempty"`
+	Confidence   map[string]float64 `json:"confidence,omitempty"`
+	Schema       json.RawMessage    `json:"schema,omitempty"`
+	OutputPath   string             `json:"output_path,omitempty"`
+	FieldPaths   map[string]string  `json:"field_paths,omitempty"`
+	Cost         float64            `json:"cost"`
+	InputTokens  int                `json:"input_tokens"`
+	OutputTokens int                `json:"output_tokens"`
+	Truncated    bool               `json:"truncated,omitempty"`
+	Error        string             `json:"error,omitempty"`
+}
+
+// withJSONOutput returns the App a command should use and, under --json,
+// the writer for its JSON result. The returned App discards the usual
+// progress lines so stdout carries only JSON; warnings still go to Err.
+func withJSONOutput(app *App) (*App, io.Writer) {
+	if !flagJSON {
+		return app, nil
 	}
+	quiet := *app
+	quiet.Out = io.Discard
+	return &quiet, app.Out
+}
 
-	items, err := batch.ParseFile(inputFile)
-	if err != nil {
-		return fmt.Errorf("failed to parse input file: %w", err)
+// writeJSON prints v as a single line of JSON.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write JSON output: %w", err)
 	}
+	return nil
+}
 
-	fmt.Fprintf(app.Out, "Batch generation: %d prompts\n", len(items))
+// processBatch runs items and returns their results in item order. With
+// --json, each item's line is printed as soon as it finishes, and items the
+// run never reached follow once it ends. A failure to write JSON takes
+// precedence over the run's own error.
+func processBatch(ctx context.Context, processor *batch.Processor, items []batch.Item, opts *batch.Options, jsonOut io.Writer, defaultModel string) ([]batch.Result, error) {
+	stream, err := processor.ProcessStream(ctx, items, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	outputDir := flagBatchOutput
-	if outputDir == "" {
-		outputDir = "."
-		fmt.Fprintln(app.Out, "\033[33mWarning: No output directory specified. Images will be saved to current directory.\033[0m")
+	byIndex := make(map[int]batch.Item, len(items))
+	for _, item := range items {
+		byIndex[item.Index] = item
+	}
+	written := make(map[int]bool)
+	var jsonErr error
 
-		if isTerminal() {
-			fmt.Fprint(app.Out, "Continue? [Y/n] ")
-			reader := bufio.NewReader(os.Stdin)
-			response, _ := reader.ReadString('\n')
-			response = strings.TrimSpace(strings.ToLower(response))
-			if response == "n" || response == "no" {
-				fmt.Fprintln(app.Out, "Aborted.")
-				return nil
-			}
+	results, err := batch.Collect(ctx, items, opts, stream, func(r batch.Result) {
+		if jsonOut == nil || jsonErr != nil {
+			return
 		}
-	} else {
-		if _, err := os.Stat(outputDir); os.IsNotExist(err) {
-			if isTerminal() {
-				fmt.Fprintf(app.Out, "Directory %q does not exist. Create it? [Y/n] ", outputDir)
-				reader := bufio.NewReader(os.Stdin)
-				response, _ := reader.ReadString('\n')
-				response = strings.TrimSpace(strings.ToLower(response))
-				if response == "n" || response == "no" {
-					fmt.Fprintln(app.Out, "Aborted.")
-					return nil
-				}
+		jsonErr = writeBatchJSON(jsonOut, defaultModel, []batch.Item{byIndex[r.Index]}, []batch.Result{r})
+		written[r.Index] = true
+	})
+
+	if jsonOut != nil && jsonErr == nil {
+		for i, item := range items {
+			if written[item.Index] {
+				continue
 			}
-			if err := os.MkdirAll(outputDir, 0755); err != nil {
-				return fmt.Errorf("failed to create output directory: %w", err)
+			if jsonErr = writeBatchJSON(jsonOut, defaultModel, items[i:i+1], results[i:i+1]); jsonErr != nil {
+				break
 			}
-			fmt.Fprintf(app.Out, "Created directory: %s\n", outputDir)
 		}
 	}
-
-	fmt.Fprintf(app.Out, "Output directory: %s\n\n", outputDir)
-
-	providerCfg := &provider.Config{APIKey: apiKey, Verbose: flagVerbose}
-	prov, err := app.NewProvider(providerCfg, app.Registry)
-	if err != nil {
-		return fmt.Errorf("failed to create provider: %w", err)
+	if jsonErr != nil {
+		return results, jsonErr
 	}
+	return results, err
+}
 
-	processor := batch.NewProcessor(prov, app.NewSaver(), app.Registry, app.Out, app.Err)
+// writeBatchJSON prints one JSON line per batch item using the schema of
+// the batch results file, filling in the model items inherited.
+func writeBatchJSON(w io.Writer, defaultModel string, items []batch.Item, results []batch.Result) error {
+	for _, entry := range batch.NewResultsFile("", items, results).Items {
+		if entry.Model == "" {
+			entry.Model = defaultModel
+		}
+		if err := writeJSON(w, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	opts := &batch.Options{
-		OutputDir:      outputDir,
-		DefaultModel:   flagBatchModel,
-		DefaultSize:    flagBatchSize,
-		DefaultQuality: flagBatchQuality,
-		Format:         format,
-		Parallel:       flagBatchParallel,
-		StopOnError:    flagBatchStopOnError,
-		DelayMs:        flagBatchDelay,
+// warnNoRevise reports what --no-revise does for model: dall-e-3 is told
+// not to rewrite the prompt, and other models never rewrite prompts.
+func warnNoRevise(app *App, model string) {
+	if !flagNoRevise {
+		return
+	}
+	if model == "dall-e-3" {
+		fmt.Fprintln(app.info(), "Prompt revision suppressed (--no-revise)")
+		return
 	}
+	fmt.Fprintf(app.warn(), "Warning: --no-revise only affects dall-e-3, ignoring it for %s\n", model)
+}
 
-	results, err := processor.Process(ctx, items, opts)
+// dryRunRequest is one fully resolved request as printed by --dry-run.
+// Index is the batch item number, or zero for a single generation.
+type dryRunRequest struct {
+	Index         int     `json:"index,omitempty"`
+	Prompt        string  `json:"prompt"`
+	Model         string  `json:"model"`
+	Size          string  `json:"size"`
+	Quality       string  `json:"quality,omitempty"`
+	Format        string  `json:"format"`
+	Count         int     `json:"count"`
+	EstimatedCost float64 `json:"estimated_cost"`
+}
 
-	processor.PrintSummary(results)
+// dryRunJSON is the --json output of --dry-run.
+type dryRunJSON struct {
+	Requests      []dryRunRequest `json:"requests"`
+	EstimatedCost float64         `json:"estimated_cost"`
+}
 
-	if err != nil {
-		return err
+// newDryRunRequest describes req, already resolved and validated. format is
+// the requested output format, which may be auto.
+func newDryRunRequest(index int, req *models.Request, format models.OutputFormat) dryRunRequest {
+	saveFormat := req.Format.String()
+	if format.IsAuto() {
+		saveFormat = string(format)
 	}
+	return dryRunRequest{
+		Index:         index,
+		Prompt:        req.Prompt,
+		Model:         req.Model,
+		Size:          req.Size,
+		Quality:       req.Quality,
+		Format:        saveFormat,
+		Count:         req.Count,
+		EstimatedCost: calculator().Estimate(req.Model, req.Size, req.Quality, req.Count).Total,
+	}
+}
 
-	var totalCost float64
-	for _, r := range results {
-		if r.Error == nil {
-			totalCost += r.Cost
-		}
-	}
-	if totalCost > 0 {
-		store, storeErr := session.NewStore()
-		if storeErr == nil {
-			defer store.Close()
-			costEntry := &session.CostEntry{
-				IterationID: "",
-				SessionID:   "",
-				Provider:    string(prov.Name()),
-				Model:       flagBatchModel,
-				Cost:        totalCost,
-				ImageCount:  countSuccessful(results),
-				Timestamp:   time.Now(),
-			}
-			if logErr := store.LogCost(ctx, costEntry); logErr != nil {
-				fmt.Fprintf(app.Err, "Warning: failed to log cost: %v\n", logErr)
-			}
+// dryRunItems resolves and validates every batch item for --dry-run and
+// prints the valid ones. Invalid items are reported on app.Err and fail the
+// run once the rest are printed.
+func dryRunItems(app *App, jsonOut io.Writer, items []batch.Item, opts *batch.Options) error {
+	reqs := make([]dryRunRequest, 0, len(items))
+	var invalid int
+	for _, item := range items {
+		req, err := batch.Resolve(item, opts, app.Registry)
+		if err != nil {
+			fmt.Fprintf(app.Err, "item %d: %v\n", item.Index, err)
+			invalid++
+			continue
 		}
+		reqs = append(reqs, newDryRunRequest(item.Index, req, opts.Format))
+	}
+	if err := printDryRun(app, jsonOut, reqs); err != nil {
+		return err
+	}
+	if invalid > 0 {
+		return fmt.Errorf("invalid request: %d of %d item(s) failed validation", invalid, len(items))
 	}
-
 	return nil
 }
 
-func isTerminal() bool {
-	return term.IsTerminal(int(os.Stdin.Fd()))
-}
+// printDryRun prints the requests a run would send and their estimated
+// cost, as JSON to jsonOut with --json and as a table otherwise.
+func printDryRun(app *App, jsonOut io.Writer, reqs []dryRunRequest) error {
+	var total float64
+	for _, r := range reqs {
+		total += r.EstimatedCost
+	}
+	if jsonOut != nil {
+		return writeJSON(jsonOut, dryRunJSON{Requests: reqs, EstimatedCost: total})
+	}
 
-func countSuccessful(results []batch.Result) int {
-	count := 0
-	for _, r := range results {
-		if r.Error == nil {
-			count++
+	fmt.Fprintln(app.Out, "Dry run: nothing will be sent to the API.")
+	tw := tabwriter.NewWriter(app.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tMODEL\tSIZE\tQUALITY\tFORMAT\tCOUNT\tCOST\tPROMPT")
+	for i, r := range reqs {
+		index := r.Index
+		if index == 0 {
+			index = i + 1
+		}
+		quality := r.Quality
+		if quality == "" {
+			quality = "-"
 		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t$%.4f\t%s\n",
+			index, r.Model, r.Size, quality, r.Format, r.Count, r.EstimatedCost, truncate(r.Prompt, 50))
 	}
-	return count
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(app.Out, "Estimated cost: $%.4f for %d request(s)\n", total, len(reqs))
+	return nil
 }
 
-var (
-	flagRegisterDryRun bool
-	flagRegisterForce  bool
-)
+// explainRequest prints a request as it will be sent, after defaults have been
+// applied and validation has passed, along with its estimated cost.
+func explainRequest(w io.Writer, req *models.Request, caps *models.ModelCapabilities, format models.OutputFormat) {
+	saveFormat := format.String()
+	if format.IsAuto() {
+		saveFormat = fmt.Sprintf("auto (requested as %s, saved as png or jpeg per image)", req.Format)
+	}
 
-func newRegisterCmd(app *App) *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "register [integration...]",
-		Short: "Register imggen with AI CLI tools",
-		Long: `Register imggen with AI CLI tools so they know how to use it.
+	quality := req.Quality
+	if quality == "" {
+		quality = "(not supported by model)"
+	}
+	style := req.Style
+	if style == "" {
+		style = "(none)"
+	}
+	seed := "(random)"
+	if req.Seed != 0 {
+		seed = strconv.FormatInt(req.Seed, 10)
+	}
 
-Supported integrations:
-  claude  - Claude Code (~/.claude/skills/imggen/SKILL.md)
-  codex   - OpenAI Codex CLI (~/.codex/AGENTS.md)
-  cursor  - Cursor (~/.cursor/rules/imggen.mdc)
-  gemini  - Gemini CLI (~/.gemini/GEMINI.md)
+	fmt.Fprintln(w, "Resolved request:")
+	fmt.Fprintf(w, "  prompt:      %s\n", req.Prompt)
+	fmt.Fprintf(w, "  provider:    %s\n", caps.Provider)
+	fmt.Fprintf(w, "  model:       %s\n", req.Model)
+	fmt.Fprintf(w, "  size:        %s\n", req.Size)
+	fmt.Fprintf(w, "  quality:     %s\n", quality)
+	fmt.Fprintf(w, "  format:      %s\n", saveFormat)
+	fmt.Fprintf(w, "  transparent: %t\n", req.Transparent)
+	fmt.Fprintf(w, "  style:       %s\n", style)
+	fmt.Fprintf(w, "  count:       %d\n", req.Count)
+	fmt.Fprintf(w, "  seed:        %s\n", seed)
+
+	estimate := calculator().Calculate(caps.Provider, req.Model, req.Size, req.Quality, req.Count)
+	fmt.Fprintf(w, "Estimated cost: $%.4f (%d image(s) @ $%.4f/image)\n", estimate.Total, req.Count, estimate.PerImage)
+}
 
-Examples:
-  imggen register --all              # Register with all supported CLIs
-  imggen register claude codex       # Register with specific CLIs
-  imggen register --dry-run --all    # Preview what would happen
-  imggen register status             # Show registration status
-  imggen register unregister claude  # Remove from Claude Code
+// runPreview generates req at --preview-quality, saves and optionally displays
+// it, and asks whether to go ahead with the final-quality generation. OpenAI
+// image models do not accept a seed, so the final image is a fresh sample of
+// the same prompt and settings rather than an upscale of the preview.
+func runPreview(ctx context.Context, app *App, prov provider.Provider, eventLog *events.Logger, caps *models.ModelCapabilities, req *models.Request, format models.OutputFormat) (bool, error) {
+	preview := *req
+	preview.Quality = flagPreviewQuality
+	preview.Count = 1
+
+	if len(caps.SupportedQualities) == 0 {
+		return false, fmt.Errorf("model %s has no quality levels to preview with", req.Model)
+	}
+	if err := caps.Validate(&preview); err != nil {
+		return false, fmt.Errorf("invalid preview quality: %w", err)
+	}
 
-The command will:
-  1. Show what changes will be made
-  2. Create a backup of any existing config
-  3. Ask for confirmation before proceeding`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return runRegister(app, args)
-		},
+	fmt.Fprintf(app.info(), "Generating preview with %s (quality: %s)...\n", preview.Model, preview.Quality)
+
+	start := time.Now()
+	resp, err := prov.Generate(ctx, &preview)
+	logGenerateEvent(app, eventLog, &preview, resp, start, err)
+	if err != nil {
+		return false, fmt.Errorf("preview generation failed: %w", err)
 	}
 
-	cmd.Flags().BoolVar(&flagRegisterDryRun, "dry-run", false, "show what would happen without making changes")
-	cmd.Flags().BoolVar(&flagRegisterForce, "force", false, "overwrite existing registration")
-	cmd.Flags().Bool("all", false, "register with all supported integrations")
+	paths, err := newSaver(app).SaveAll(ctx, resp, previewPath(flagOutput), format)
+	if err != nil {
+		return false, fmt.Errorf("failed to save preview: %w", err)
+	}
+	for _, path := range paths {
+		fmt.Fprintf(app.Out, "Preview: %s\n", path)
+	}
 
-	cmd.AddCommand(newRegisterStatusCmd(app))
-	cmd.AddCommand(newRegisterUnregisterCmd(app))
-	cmd.AddCommand(newRegisterBackupsCmd(app))
-	cmd.AddCommand(newRegisterRollbackCmd(app))
+	if resp.Cost != nil {
+		fmt.Fprintf(app.info(), "Preview cost: $%.4f\n", resp.Cost.Total)
+		if err := logGenerationCost(ctx, app, prov, preview.Model, resp); err != nil {
+			return false, err
+		}
+	}
 
-	return cmd
+	if flagShow {
+		if err := newDisplayer(app).DisplayAll(ctx, resp); err != nil {
+			if err := softFail(app, "failed to display preview: %w", err); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return confirm(app, fmt.Sprintf("Generate %d image(s) at quality %s?", req.Count, req.Quality)), nil
 }
 
-func newRegisterStatusCmd(app *App) *cobra.Command {
-	return &cobra.Command{
-		Use:   "status",
-		Short: "Show registration status for all integrations",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return runRegisterStatus(app)
-		},
+// previewPath derives the preview filename from the final output path so the
+// preview never overwrites the final image.
+func previewPath(output string) string {
+	if output == "" {
+		return ""
 	}
+	ext := filepath.Ext(output)
+	return output[:len(output)-len(ext)] + "-preview" + ext
 }
 
-func newRegisterUnregisterCmd(app *App) *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "unregister [integration...]",
-		Short: "Remove imggen from AI CLI tools",
-		Args:  cobra.MinimumNArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return runUnregister(app, args)
-		},
-	}
-	cmd.Flags().BoolVar(&flagRegisterDryRun, "dry-run", false, "show what would happen without making changes")
-	return cmd
+// logGenerationCost records a generation's cost in the cost log. CLI runs have
+// no session, so iteration and session IDs are left empty.
+func logGenerationCost(ctx context.Context, app *App, prov provider.Provider, model string, resp *models.Response) error {
+	return logCost(ctx, app, &session.CostEntry{
+		Provider:   string(prov.Name()),
+		Model:      model,
+		Cost:       resp.Cost.Total,
+		ImageCount: len(resp.Images),
+		Timestamp:  time.Now(),
+		CacheHit:   resp.Cost.Source == models.CostSourceCache,
+	})
 }
 
-func newRegisterBackupsCmd(app *App) *cobra.Command {
-	return &cobra.Command{
-		Use:   "backups [integration]",
-		Short: "List backup files for an integration",
-		Args:  cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return runListBackups(app, args[0])
-		},
+// logCost records entry in the cost log. Failing to do so is a soft failure:
+// a warning, or the command's error under --strict.
+func logCost(ctx context.Context, app *App, entry *session.CostEntry) error {
+	store, err := session.NewStore()
+	if err != nil {
+		return softFail(app, "failed to log cost: %w", err)
 	}
-}
+	defer store.Close()
 
-func newRegisterRollbackCmd(app *App) *cobra.Command {
-	return &cobra.Command{
-		Use:   "rollback <backup-path>",
-		Short: "Restore a backup file",
-		Args:  cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return runRollback(app, args[0])
-		},
+	if err := store.LogCost(ctx, entry); err != nil {
+		return softFail(app, "failed to log cost: %w", err)
 	}
+	return nil
 }
 
-func runRegister(app *App, args []string) error {
-	registrar := register.NewRegistrar(app.Out, app.Err, os.Stdin)
-	registrar.DryRun = flagRegisterDryRun
-	registrar.Force = flagRegisterForce
+// softFail reports a problem that does not stop the command as a warning
+// and returns nil, or returns it as the command's error under --strict.
+func softFail(app *App, format string, args ...any) error {
+	err := fmt.Errorf(format, args...)
+	if flagStrict {
+		return err
+	}
+	fmt.Fprintf(app.warn(), "Warning: %v\n", err)
+	return nil
+}
+
+// checkBatchFailures fails a batch run with failed items under --strict.
+// Without it, failed items are only reported in the summary.
+func checkBatchFailures(results []batch.Result) error {
+	if !flagStrict {
+		return nil
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Error != nil || r.Path == "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d batch items failed (--strict)", failed, len(results))
+	}
+	return nil
+}
+
+// newDisplayer returns app's displayer using the --show-protocol choice.
+func newDisplayer(app *App) *display.Displayer {
+	d := app.NewDisplayer(app.Out)
+	if flagShowProtocol != display.ProtocolAuto {
+		d.SetProtocol(flagShowProtocol)
+	}
+	return d
+}
+
+// protocolValue adapts display.Protocol to a command-line flag so invalid
+// names are rejected while parsing.
+type protocolValue struct {
+	p *display.Protocol
+}
+
+func (v protocolValue) String() string {
+	if v.p == nil {
+		return string(display.ProtocolAuto)
+	}
+	return string(*v.p)
+}
+
+func (v protocolValue) Set(s string) error {
+	p, err := display.ParseProtocol(s)
+	if err != nil {
+		return err
+	}
+	*v.p = p
+	return nil
+}
+
+func (v protocolValue) Type() string { return "protocol" }
+
+// newEventLogger opens the --event-log file, or returns nil when none is
+// set. A leading ~/ is expanded so the config file can use it too.
+func newEventLogger() (*events.Logger, error) {
+	mode, err := events.ParsePromptMode(flagEventLogPrompts)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := expandHome(flagEventLog)
+	if err != nil {
+		return nil, err
+	}
+	return events.NewLogger(path, mode), nil
+}
+
+// expandHome replaces a leading ~/ in path with the home directory.
+func expandHome(path string) (string, error) {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, rest), nil
+}
+
+// logGenerateEvent records a Generate call for req in the event log.
+func logGenerateEvent(app *App, l *events.Logger, req *models.Request, resp *models.Response, start time.Time, err error) {
+	var costInfo *models.CostInfo
+	if resp != nil {
+		costInfo = resp.Cost
+	}
+	e := events.Event{Op: events.OpGenerate, Model: req.Model, Size: req.Size, Quality: req.Quality}
+	l.Record(app.warn(), e, req.Prompt, costInfo, start, err)
+}
+
+// confirm asks a yes/no question on app.In, treating anything but yes as no.
+func confirm(app *App, question string) bool {
+	in := app.In
+	if in == nil {
+		in = os.Stdin
+	}
+
+	fmt.Fprintf(app.Out, "%s [y/N] ", question)
+	response, _ := bufio.NewReader(in).ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes"
+}
+
+// confirmDefaultYes is confirm for questions where pressing enter goes ahead.
+func confirmDefaultYes(app *App, question string) bool {
+	in := app.In
+	if in == nil {
+		in = os.Stdin
+	}
+
+	fmt.Fprintf(app.Out, "%s [Y/n] ", question)
+	response, _ := bufio.NewReader(in).ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response != "n" && response != "no"
+}
+
+// aboveConfirmLimit reports whether an estimated cost in USD is above
+// --confirm-above.
+func aboveConfirmLimit(estimate float64) bool {
+	return flagConfirmAbove > 0 && estimate > flagConfirmAbove
+}
+
+// confirmCost asks before a run estimated to cost more than
+// --confirm-above, defaulting to no. It goes ahead without asking when yes
+// is set or stdin is not a terminal, since no one is there to answer.
+func confirmCost(app *App, estimate float64, yes bool) bool {
+	if !aboveConfirmLimit(estimate) || yes || !isTerminal() {
+		return true
+	}
+	return confirm(app, fmt.Sprintf("Estimated cost $%.4f is above the $%.2f --confirm-above limit. Continue?", estimate, flagConfirmAbove))
+}
+
+// warnUnpriced warns about the items a cost estimate had to leave out
+// because their price is unknown.
+func warnUnpriced(app *App, est batch.CostEstimate) {
+	if len(est.Unpriced) == 0 {
+		return
+	}
+	indexes := make([]string, len(est.Unpriced))
+	for i, index := range est.Unpriced {
+		indexes[i] = strconv.Itoa(index)
+	}
+	fmt.Fprintf(app.warn(), "Warning: no known price for %d item(s) (%s); the estimate leaves them out\n", len(indexes), strings.Join(indexes, ", "))
+}
+
+// promptItems returns the --prompt flags as batch items.
+func promptItems() []batch.Item {
+	items := make([]batch.Item, len(flagPrompts))
+	for i, prompt := range flagPrompts {
+		items[i] = batch.Item{
+			Index:  i + 1,
+			Prompt: prompt,
+		}
+	}
+	return items
+}
+
+// fanOut reports whether --prompt generates one image per prompt, rather
+// than one image from prompts joined by --combine-prompts.
+func fanOut() bool {
+	return len(flagPrompts) > 0 && !flagCombinePrompts
+}
+
+// combinedPrompt joins the prompt argument, if any, and the --prompt values
+// with --combine-separator, skipping blank fragments.
+func combinedPrompt(args []string) string {
+	var parts []string
+	for _, p := range append(slices.Clone(args), flagPrompts...) {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, flagCombineSep)
+}
+
+// multiPromptOptions returns the batch options --prompt items are resolved
+// with, before any output or scheduling settings.
+func multiPromptOptions(format models.OutputFormat) *batch.Options {
+	return &batch.Options{
+		DefaultModel:   flagModel,
+		DefaultSize:    flagSize,
+		DefaultQuality: flagQuality,
+		Format:         format,
+		NoRevise:       flagNoRevise,
+		StripWeights:   flagStripWeights,
+		EmbedMetadata:  flagEmbedMetadata,
+		Provenance:     flagProvenance,
+		NameTemplate:   image.NameTemplate(flagNameTemplate),
+		PriceOverrides: priceOverrides,
+	}
+}
+
+func runMultiPrompt(ctx context.Context, app *App, jsonOut io.Writer, format models.OutputFormat) error {
+	outputDir := flagOutput
+	if outputDir == "" {
+		outputDir = "."
+		fmt.Fprintln(app.warn(), "\033[33mWarning: No output directory specified. Images will be saved to current directory.\033[0m")
+
+		if isTerminal() && jsonOut == nil {
+			fmt.Fprint(app.Out, "Continue? [Y/n] ")
+			reader := bufio.NewReader(os.Stdin)
+			response, _ := reader.ReadString('\n')
+			response = strings.TrimSpace(strings.ToLower(response))
+			if response == "n" || response == "no" {
+				fmt.Fprintln(app.Out, "Aborted.")
+				return nil
+			}
+		}
+	} else {
+		if _, err := os.Stat(outputDir); os.IsNotExist(err) {
+			if isTerminal() && jsonOut == nil {
+				fmt.Fprintf(app.Out, "Directory %q does not exist. Create it? [Y/n] ", outputDir)
+				reader := bufio.NewReader(os.Stdin)
+				response, _ := reader.ReadString('\n')
+				response = strings.TrimSpace(strings.ToLower(response))
+				if response == "n" || response == "no" {
+					fmt.Fprintln(app.Out, "Aborted.")
+					return nil
+				}
+			}
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				return fmt.Errorf("failed to create output directory: %w", err)
+			}
+			fmt.Fprintf(app.Out, "Created directory: %s\n", outputDir)
+		}
+	}
+
+	items := promptItems()
+
+	fmt.Fprintf(app.info(), "Generating %d images with %s\n", len(items), flagModel)
+	fmt.Fprintf(app.info(), "Output directory: %s\n\n", outputDir)
+
+	prov, err := newProviderRouter(app, flagModel)
+	if err != nil {
+		return err
+	}
+
+	thr, err := newThrottle()
+	if err != nil {
+		return err
+	}
+
+	money, err := cost.NewFormatter(flagLocale)
+	if err != nil {
+		return err
+	}
+
+	eventLog, err := newEventLogger()
+	if err != nil {
+		return err
+	}
+
+	processor := batch.NewProcessor(prov, newSaver(app), app.Registry, app.Out, app.Err)
+	processor.SetCostFormatter(money)
+	processor.SetEventLogger(eventLog)
+	processor.SetQuiet(app.Quiet)
+
+	opts := multiPromptOptions(format)
+	opts.OutputDir = outputDir
+	opts.Parallel = flagParallel
+	opts.Throttle = thr
+
+	est := processor.EstimateCost(items, opts)
+	warnUnpriced(app, est)
+	if !confirmCost(app, est.Total, flagYes || jsonOut != nil) {
+		fmt.Fprintln(app.Out, "Aborted.")
+		return nil
+	}
+	warnNoRevise(app, flagModel)
+
+	results, err := processBatch(ctx, processor, items, opts, jsonOut, flagModel)
+
+	processor.PrintSummary(results)
+
+	if err != nil {
+		return err
+	}
+
+	if err := logBatchCost(ctx, app, results, flagModel); err != nil {
+		return err
+	}
+
+	return checkBatchFailures(results)
+}
+
+func runInteractive(_ *cobra.Command, app *App) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// Get API key using priority: --api-key flag > stored key > env var
+	providerType := providerForModel(app.Registry, flagModel)
+	apiKey, err := apiKeyForProvider(providerType)
+	if err != nil {
+		return err
+	}
+
+	prov, err := app.NewProvider(newProviderConfig(providerType, apiKey), app.Registry)
+	if err != nil {
+		return fmt.Errorf("failed to create provider: %w", err)
+	}
+
+	store, err := session.NewStore()
+	if err != nil {
+		return fmt.Errorf("failed to initialize session store: %w", err)
+	}
+	defer store.Close()
+
+	sessionMgr := session.NewManager(store, flagModel)
+
+	eventLog, err := newEventLogger()
+	if err != nil {
+		return err
+	}
+
+	replCfg := &repl.Config{
+		In:         os.Stdin,
+		Out:        app.Out,
+		Err:        app.Err,
+		Provider:   prov,
+		Registry:   app.Registry,
+		SessionMgr: sessionMgr,
+		Displayer:  newDisplayer(app),
+		Saver:      newSaver(app),
+		Events:     eventLog,
+		ResumeLast: flagResumeLast,
+		Spinner:    showSpinner(app),
+		Quiet:      app.Quiet,
+
+		PriceOverrides: priceOverrides,
+	}
+
+	r := repl.New(replCfg)
+	return r.Run(ctx)
+}
+
+var (
+	flagHistoryWhere   string
+	flagHistorySession string
+	flagHistoryTree    bool
+)
+
+// historyFields are the iteration fields `history --where` can filter on.
+var historyFields = query.Schema{
+	"model":     query.Text,
+	"operation": query.Text,
+	"prompt":    query.Text,
+	"provider":  query.Text,
+	"size":      query.Text,
+	"quality":   query.Text,
+	"cost":      query.Number,
+	"date":      query.Date,
+}
+
+func newHistoryCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List generations and edits from interactive sessions",
+		Long: `List the iterations recorded by interactive sessions, oldest first.
+
+--where filters them with an expression over the fields model, operation,
+prompt, provider, size, quality, cost, and date. Compare fields with
+=, !=, <, <=, >, >= (or ~ for "contains" on text fields) and combine
+comparisons with and, or, not, and parentheses. Text matches ignore case
+and dates are written as YYYY-MM-DD.
+
+Examples:
+  imggen history --where "model=dall-e-3 and cost>0.1"
+  imggen history --where "operation=edit or prompt~'red fox'"
+  imggen history --where "date>=2025-01-01 and not quality=low"
+  imggen history --tree --session <id>   # show branches made with "branch"`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runHistory(app)
+		},
+	}
+	cmd.Flags().StringVarP(&flagHistoryWhere, "where", "w", "", "only show iterations matching this expression")
+	cmd.Flags().StringVar(&flagHistorySession, "session", "", "only show iterations from this session ID")
+	cmd.Flags().BoolVar(&flagHistoryTree, "tree", false, "draw each session's iterations as a tree of branches")
+	cmd.AddCommand(newHistorySearchCmd(app))
+	return cmd
+}
+
+func newHistorySearchCmd(app *App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "search <text>",
+		Short: "Find iterations in any session by prompt text",
+		Long: `Search the prompts and revised prompts of every session for text,
+ignoring case. Matches are listed most recent first with their session ID,
+which "session export" and the interactive "session load" accept.
+
+Examples:
+  imggen history search logo
+  imggen history search "red fox"`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runHistorySearch(app, strings.Join(args, " "))
+		},
+	}
+}
+
+func runHistorySearch(app *App, text string) error {
+	ctx := context.Background()
+
+	dbPath, err := getDBPath()
+	if err != nil {
+		return err
+	}
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer store.Close()
+
+	results, err := store.SearchIterations(ctx, text)
+	if err != nil {
+		return fmt.Errorf("failed to search history: %w", err)
+	}
+
+	if len(results) == 0 {
+		fmt.Fprintf(app.Out, "No prompts match %q\n", text)
+		return nil
+	}
+	for _, iter := range results {
+		fmt.Fprintf(app.Out, "%s  %s  %-8s %q\n",
+			iter.SessionID,
+			session.FormatTimestamp(iter.Timestamp.Local()),
+			iter.Operation,
+			session.Snippet(iter, text, 60))
+	}
+	fmt.Fprintf(app.Out, "\n%d match(es)\n", len(results))
+	return nil
+}
+
+func runHistory(app *App) error {
+	ctx := context.Background()
+
+	if flagHistoryTree && flagHistoryWhere != "" {
+		return fmt.Errorf("--tree cannot be used with --where")
+	}
+
+	var q *query.Query
+	if flagHistoryWhere != "" {
+		var err error
+		if q, err = query.Parse(flagHistoryWhere, historyFields); err != nil {
+			return err
+		}
+	}
+
+	dbPath, err := getDBPath()
+	if err != nil {
+		return err
+	}
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer store.Close()
+
+	var iterations []*session.Iteration
+	if flagHistorySession != "" {
+		iterations, err = store.ListIterations(ctx, flagHistorySession)
+	} else {
+		iterations, err = store.ListAllIterations(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list history: %w", err)
+	}
+
+	money, err := cost.NewFormatter(flagLocale)
+	if err != nil {
+		return err
+	}
+
+	if flagHistoryTree {
+		return printHistoryTree(app, money, iterations)
+	}
+
+	var shown int
+	var total float64
+	for _, iter := range iterations {
+		if q != nil && !q.Match(iterationRecord(iter)) {
+			continue
+		}
+		shown++
+		total += iter.Metadata.Cost
+		fmt.Fprintf(app.Out, "%s  %-8s %-20s %10s  %q\n",
+			session.FormatTimestamp(iter.Timestamp.Local()),
+			iter.Operation,
+			iter.Model,
+			money.USD(iter.Metadata.Cost, 4),
+			truncate(iter.Prompt, 50))
+	}
+
+	if shown == 0 {
+		fmt.Fprintln(app.Out, "No matching history")
+		return nil
+	}
+	fmt.Fprintf(app.Out, "\n%d iteration(s), %s total\n", shown, money.USD(total, 4))
+	return nil
+}
+
+// printHistoryTree draws the iterations of each session as a tree, with the
+// sessions in the order of their first iteration.
+func printHistoryTree(app *App, money *cost.Formatter, iterations []*session.Iteration) error {
+	if len(iterations) == 0 {
+		fmt.Fprintln(app.Out, "No matching history")
+		return nil
+	}
+
+	var order []string
+	bySession := make(map[string][]*session.Iteration)
+	for _, iter := range iterations {
+		if _, ok := bySession[iter.SessionID]; !ok {
+			order = append(order, iter.SessionID)
+		}
+		bySession[iter.SessionID] = append(bySession[iter.SessionID], iter)
+	}
+
+	label := func(iter *session.Iteration) string {
+		line := fmt.Sprintf("%s  %-8s %-20s %10s  %q",
+			session.FormatTimestamp(iter.Timestamp.Local()),
+			iter.Operation,
+			iter.Model,
+			money.USD(iter.Metadata.Cost, 4),
+			truncate(iter.Prompt, 50))
+		if iter.BranchPoint {
+			line += "  [branch]"
+		}
+		return line
+	}
+	for i, id := range order {
+		if i > 0 {
+			fmt.Fprintln(app.Out)
+		}
+		fmt.Fprintf(app.Out, "Session %s\n", id)
+		for _, line := range session.TreeLines(session.BuildTree(bySession[id]), label) {
+			fmt.Fprintf(app.Out, "  %s\n", line)
+		}
+	}
+	return nil
+}
+
+// iterationRecord exposes an iteration's fields to a history query.
+func iterationRecord(iter *session.Iteration) query.Record {
+	return query.Record{
+		"model":     iter.Model,
+		"operation": iter.Operation,
+		"prompt":    iter.Prompt,
+		"provider":  iter.Metadata.Provider,
+		"size":      iter.Metadata.Size,
+		"quality":   iter.Metadata.Quality,
+		"cost":      iter.Metadata.Cost,
+		"date":      iter.Timestamp.Local(),
+	}
+}
+
+var (
+	flagPromptsTop     int
+	flagPromptsSession string
+)
+
+func newPromptsCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prompts",
+		Short: "Rank previously used prompts by frequency and recency",
+		Long: `Rank the prompts recorded by interactive sessions so favorites are easy
+to reuse. Repeated prompts are counted once, ignoring differences in
+whitespace; the most used come first and ties go to the most recent.
+
+Examples:
+  imggen prompts
+  imggen prompts --top 5 --session <id>`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPrompts(app)
+		},
+	}
+	cmd.Flags().IntVar(&flagPromptsTop, "top", 10, "number of prompts to show")
+	cmd.Flags().StringVar(&flagPromptsSession, "session", "", "only rank prompts from this session ID")
+	return cmd
+}
+
+func runPrompts(app *App) error {
+	ctx := context.Background()
+
+	if flagPromptsTop < 1 {
+		return fmt.Errorf("--top must be at least 1, got %d", flagPromptsTop)
+	}
+
+	dbPath, err := getDBPath()
+	if err != nil {
+		return err
+	}
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer store.Close()
+
+	var iterations []*session.Iteration
+	if flagPromptsSession != "" {
+		iterations, err = store.ListIterations(ctx, flagPromptsSession)
+	} else {
+		iterations, err = store.ListAllIterations(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list history: %w", err)
+	}
+
+	ranked := rankPrompts(iterations)
+	if len(ranked) == 0 {
+		fmt.Fprintln(app.Out, "No prompts yet")
+		return nil
+	}
+	if len(ranked) > flagPromptsTop {
+		ranked = ranked[:flagPromptsTop]
+	}
+
+	for i, p := range ranked {
+		fmt.Fprintf(app.Out, "%3d. %4dx  %s  %q\n",
+			i+1, p.Count, session.FormatTimestamp(p.LastUsed.Local()), truncate(p.Prompt, 60))
+	}
+	return nil
+}
+
+// promptUsage is how often and how recently a prompt was used.
+type promptUsage struct {
+	Prompt   string
+	Count    int
+	LastUsed time.Time
+}
+
+// rankPrompts counts each distinct prompt across iterations and orders them
+// by use count, breaking ties by the most recent use. Prompts differing only
+// in whitespace count as the same prompt.
+func rankPrompts(iterations []*session.Iteration) []promptUsage {
+	byKey := make(map[string]*promptUsage)
+	var ranked []*promptUsage
+	for _, iter := range iterations {
+		key := strings.Join(strings.Fields(iter.Prompt), " ")
+		if key == "" {
+			continue
+		}
+		u, ok := byKey[key]
+		if !ok {
+			u = &promptUsage{Prompt: key}
+			byKey[key] = u
+			ranked = append(ranked, u)
+		}
+		u.Count++
+		if iter.Timestamp.After(u.LastUsed) {
+			u.LastUsed = iter.Timestamp
+		}
+	}
+
+	slices.SortStableFunc(ranked, func(a, b *promptUsage) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return b.LastUsed.Compare(a.LastUsed)
+	})
+
+	out := make([]promptUsage, len(ranked))
+	for i, u := range ranked {
+		out[i] = *u
+	}
+	return out
+}
+
+func newModelsCmd(app *App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "models",
+		Short: "List image models and their capabilities",
+		Long: `List the image models imggen knows about with their provider, supported
+sizes and qualities, whether they can edit images or produce transparent
+backgrounds, and the estimated price per image for each size at the
+model's default quality.
+
+Examples:
+  imggen models
+  imggen models --json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runModels(app)
+		},
+	}
+}
+
+// modelInfo is the --json form of a model's capabilities.
+type modelInfo struct {
+	Name           string             `json:"name"`
+	Provider       string             `json:"provider"`
+	Sizes          []string           `json:"sizes"`
+	Qualities      []string           `json:"qualities,omitempty"`
+	DefaultSize    string             `json:"default_size"`
+	DefaultQuality string             `json:"default_quality,omitempty"`
+	MaxImages      int                `json:"max_images"`
+	Edit           bool               `json:"edit"`
+	Transparency   bool               `json:"transparency"`
+	Variations     bool               `json:"variations"`
+	Prices         map[string]float64 `json:"prices"`
+	SizeAliases    map[string]string  `json:"size_aliases,omitempty"`
+}
+
+// newModelInfo describes caps, pricing each concrete size at the model's
+// default quality.
+func newModelInfo(caps *models.ModelCapabilities) modelInfo {
+	calc := calculator()
+	prices := make(map[string]float64)
+	for _, size := range caps.SupportedSizes {
+		if size == "auto" {
+			continue
+		}
+		prices[size] = calc.Calculate(caps.Provider, caps.Name, size, caps.DefaultQuality, 1).PerImage
+	}
+	return modelInfo{
+		Name:           caps.Name,
+		Provider:       string(caps.Provider),
+		Sizes:          caps.SupportedSizes,
+		Qualities:      caps.SupportedQualities,
+		DefaultSize:    caps.DefaultSize,
+		DefaultQuality: caps.DefaultQuality,
+		MaxImages:      caps.MaxImages,
+		Edit:           caps.SupportsEdit,
+		Transparency:   caps.SupportsTransparency,
+		Variations:     caps.SupportsVariations,
+		Prices:         prices,
+		SizeAliases:    caps.SizeAliases,
+	}
+}
+
+func runModels(app *App) error {
+	names := app.Registry.List()
+	slices.Sort(names)
+
+	infos := make([]modelInfo, 0, len(names))
+	for _, name := range names {
+		caps, ok := app.Registry.Get(name)
+		if !ok {
+			continue
+		}
+		infos = append(infos, newModelInfo(caps))
+	}
+
+	if flagJSON {
+		return writeJSON(app.Out, infos)
+	}
+
+	money, err := cost.NewFormatter(flagLocale)
+	if err != nil {
+		return err
+	}
+
+	yesNo := map[bool]string{true: "yes", false: "no"}
+	tw := tabwriter.NewWriter(app.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tPROVIDER\tEDIT\tTRANSPARENT\tQUALITIES\tSIZE\tPRICE")
+	for _, info := range infos {
+		qualities := strings.Join(info.Qualities, ",")
+		if qualities == "" {
+			qualities = "-"
+		}
+		for i, size := range info.Sizes {
+			price := "-"
+			if p, ok := info.Prices[size]; ok {
+				price = money.USD(p, 4)
+			}
+			if i == 0 {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					info.Name, info.Provider, yesNo[info.Edit], yesNo[info.Transparency], qualities, size, price)
+			} else {
+				fmt.Fprintf(tw, "\t\t\t\t\t%s\t%s\n", size, price)
+			}
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(app.Out, "\nPrices are estimates per image at each model's default quality.")
+	return nil
+}
+
+// priceOverrides are the prices in ~/.imggen/pricing.json, loaded by
+// applyPricing before each command runs.
+var priceOverrides cost.Overrides
+
+// applyPricing loads the price overrides in ~/.imggen/pricing.json so
+// every cost estimate and logged cost uses them. A broken file is reported
+// and the built-in prices are used instead.
+func applyPricing(app *App) {
+	priceOverrides = nil
+	path, err := cost.PricingPath()
+	if err != nil {
+		fmt.Fprintf(app.warn(), "Warning: %v\n", err)
+		return
+	}
+	overrides, err := cost.LoadOverrides(path, app.Registry)
+	if err != nil {
+		fmt.Fprintf(app.warn(), "Warning: ignoring price overrides: %v\n", err)
+		return
+	}
+	priceOverrides = overrides
+}
+
+// calculator returns a cost calculator that applies the price overrides.
+func calculator() *cost.Calculator {
+	return cost.NewCalculator(cost.WithOverrides(priceOverrides))
+}
+
+func newPriceCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "price",
+		Short: "Show or change price overrides",
+		Long: `Show the per-image prices set in ~/.imggen/pricing.json.
+
+Prices in the pricing file replace imggen's built-in rates for cost
+estimates, budgets, and logged costs, including for models that report
+token usage. Entries that are not listed keep the built-in price. Use "*"
+as the size or quality to cover every size or quality of a model, e.g. for
+dall-e-2, which has no quality setting.
+
+Examples:
+  imggen price                                     # List overrides
+  imggen price set gpt-image-1 1024x1024 high 0.19
+  imggen price set dall-e-2 '*' '*' 0.02
+  imggen price reset gpt-image-1                   # Drop one model's overrides
+  imggen price reset                               # Drop all overrides`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPriceList(app)
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set <model> <size> <quality> <usd>",
+		Short: "Override the price per image of a model, size, and quality",
+		Args:  cobra.ExactArgs(4),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPriceSet(app, args)
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "reset [model]",
+		Short: "Remove the overrides for a model, or all of them",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPriceReset(app, args)
+		},
+	})
+
+	return cmd
+}
+
+func runPriceList(app *App) error {
+	path, err := cost.PricingPath()
+	if err != nil {
+		return err
+	}
+	overrides, err := cost.LoadOverrides(path, app.Registry)
+	if err != nil {
+		return err
+	}
+	money, err := cost.NewFormatter(flagLocale)
+	if err != nil {
+		return err
+	}
+
+	entries := overrides.Entries()
+	if len(entries) == 0 {
+		fmt.Fprintln(app.Out, "No price overrides; using built-in prices.")
+	} else {
+		tw := tabwriter.NewWriter(app.Out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "MODEL\tSIZE\tQUALITY\tPRICE")
+		for _, e := range entries {
+			quality := e.Quality
+			if quality == "" {
+				quality = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Model, e.Size, quality, money.USD(e.Price, 4))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(app.Out, "\nPricing file: %s\n", path)
+	return nil
+}
+
+func runPriceSet(app *App, args []string) error {
+	model, err := app.Registry.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+	size, quality := args[1], args[2]
+	price, err := strconv.ParseFloat(args[3], 64)
+	if err != nil {
+		return fmt.Errorf("invalid price %q: must be a number of USD per image", args[3])
+	}
+
+	path, err := cost.PricingPath()
+	if err != nil {
+		return err
+	}
+	overrides, err := cost.LoadOverrides(path, app.Registry)
+	if err != nil {
+		return fmt.Errorf("%w (fix the file or run 'imggen price reset')", err)
+	}
+
+	overrides.Set(model, size, quality, price)
+	if err := overrides.Validate(app.Registry); err != nil {
+		return err
+	}
+	if err := cost.SaveOverrides(path, overrides); err != nil {
+		return err
+	}
+	priceOverrides = overrides
+
+	fmt.Fprintf(app.Out, "Set %s %s %s to $%.4f per image\n", model, size, quality, price)
+	return nil
+}
+
+func runPriceReset(app *App, args []string) error {
+	path, err := cost.PricingPath()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove pricing file: %w", err)
+		}
+		priceOverrides = nil
+		fmt.Fprintln(app.Out, "Removed all price overrides; using built-in prices.")
+		return nil
+	}
+
+	model, err := app.Registry.Resolve(args[0])
+	if err != nil {
+		return err
+	}
+	overrides, err := cost.LoadOverrides(path, app.Registry)
+	if err != nil {
+		return fmt.Errorf("%w (run 'imggen price reset' to remove every override)", err)
+	}
+	if !overrides.Reset(model) {
+		fmt.Fprintf(app.Out, "No price overrides for %s\n", model)
+		return nil
+	}
+	if err := cost.SaveOverrides(path, overrides); err != nil {
+		return err
+	}
+	priceOverrides = overrides
+
+	fmt.Fprintf(app.Out, "Removed price overrides for %s; using built-in prices.\n", model)
+	return nil
+}
+
+var (
+	flagSessionExportOutput string
+	flagSessionListTag      string
+)
+
+func newSessionCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "session",
+		Short: "List interactive sessions and share them as archives",
+		Long: `List interactive sessions, optionally only those with a tag, export a
+session with its iterations and images to a zip archive, or import an
+archive exported on another machine. Tag sessions in interactive mode with
+"session tag <name>".
+
+An archive holds a manifest.json describing the session and every
+iteration, plus the image files they reference. Images that were deleted
+before export are recorded as missing in the manifest. Imported sessions get
+new IDs, so importing the same archive twice creates two sessions.
+
+Examples:
+  imggen session list --tag client-a
+  imggen session export 3f2a9c1e-... -o session.zip
+  imggen session import session.zip`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List sessions, most recently updated first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSessionList(app)
+		},
+	}
+	listCmd.Flags().StringVar(&flagSessionListTag, "tag", "", "only list sessions with this tag")
+
+	exportCmd := &cobra.Command{
+		Use:   "export <session-id>",
+		Short: "Write a session and its images to a zip archive",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSessionExport(app, args[0])
+		},
+	}
+	exportCmd.Flags().StringVarP(&flagSessionExportOutput, "output", "o", "", "archive path (default session-<id>.zip)")
+
+	cmd.AddCommand(listCmd, exportCmd)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "import <archive>",
+		Short: "Recreate a session from a zip archive",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSessionImport(app, args[0])
+		},
+	})
+
+	return cmd
+}
+
+func runSessionList(app *App) error {
+	ctx := context.Background()
+
+	dbPath, err := getDBPath()
+	if err != nil {
+		return err
+	}
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer store.Close()
+
+	var sessions []*session.Session
+	if flagSessionListTag != "" {
+		sessions, err = store.ListByTag(ctx, flagSessionListTag)
+	} else {
+		sessions, err = store.ListSessions(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	if len(sessions) == 0 {
+		if flagSessionListTag != "" {
+			fmt.Fprintf(app.Out, "No sessions tagged %q\n", flagSessionListTag)
+		} else {
+			fmt.Fprintln(app.Out, "No sessions found")
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(app.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tUPDATED\tMODEL\tTAGS")
+	for _, sess := range sessions {
+		name := sess.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		tags := strings.Join(sess.Tags, ",")
+		if tags == "" {
+			tags = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", sess.ID, truncate(name, 30),
+			session.FormatTimestamp(sess.UpdatedAt.Local()), sess.Model, tags)
+	}
+	return tw.Flush()
+}
+
+func runSessionExport(app *App, id string) error {
+	ctx := context.Background()
+
+	dbPath, err := getDBPath()
+	if err != nil {
+		return err
+	}
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer store.Close()
+
+	output := flagSessionExportOutput
+	if output == "" {
+		output = fmt.Sprintf("session-%s.zip", id[:min(len(id), 8)])
+	}
+
+	var buf bytes.Buffer
+	manifest, err := session.Export(ctx, store, id, &buf)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	missing := 0
+	for _, iter := range manifest.Iterations {
+		if iter.ImageMissing {
+			missing++
+		}
+	}
+	fmt.Fprintf(app.Out, "Exported %d iteration(s) to %s\n", len(manifest.Iterations), output)
+	if missing > 0 {
+		fmt.Fprintf(app.Out, "%d image(s) were missing and are recorded as absent\n", missing)
+	}
+	return nil
+}
+
+func runSessionImport(app *App, archive string) error {
+	ctx := context.Background()
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+
+	dbPath, err := getDBPath()
+	if err != nil {
+		return err
+	}
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer store.Close()
+
+	sess, manifest, err := session.Import(ctx, store, f, info.Size())
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(app.Out, "Imported session %s with %d iteration(s)\n", sess.ID, len(manifest.Iterations))
+	fmt.Fprintf(app.Out, "Resume it in interactive mode (imggen -i) with: session load %s\n", sess.ID)
+	return nil
+}
+
+var flagDBBackup bool
+
+func newDBCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Database management commands",
+		Long:  `Manage the SQLite database storing sessions and cost data.`,
+	}
+
+	infoCmd := &cobra.Command{
+		Use:   "info",
+		Short: "Show database location and statistics",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDBInfo(app)
+		},
+	}
+
+	resetCmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Reset database (delete all data)",
+		Long: `Reset the database by deleting all data.
+
+Use --backup to save the old database before resetting.
+The backup will be saved as sessions.db.backup-TIMESTAMP`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDBReset(app)
+		},
+	}
+	resetCmd.Flags().BoolVar(&flagDBBackup, "backup", false, "backup old database before reset")
+
+	vacuumCmd := &cobra.Command{
+		Use:   "vacuum",
+		Short: "Compact the database file",
+		Long: `Rebuild the database with SQLite's VACUUM, returning the space left by
+deleted sessions and iterations, and report its size before and after.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDBVacuum(app)
+		},
+	}
+
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check the database for corruption",
+		Long: `Run SQLite's integrity check on the database and report any problems.
+Exits with an error if the check fails.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDBCheck(app)
+		},
+	}
+
+	cmd.AddCommand(infoCmd)
+	cmd.AddCommand(resetCmd)
+	cmd.AddCommand(vacuumCmd)
+	cmd.AddCommand(checkCmd)
+
+	return cmd
+}
+
+func runDBInfo(app *App) error {
+	ctx := context.Background()
+
+	dbPath, err := getDBPath()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(app.Out, "Database location: %s\n\n", dbPath)
+
+	// Check if file exists
+	info, err := os.Stat(dbPath)
+	if os.IsNotExist(err) {
+		fmt.Fprintln(app.Out, "Database does not exist yet (will be created on first use)")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat database: %w", err)
+	}
+
+	fmt.Fprintf(app.Out, "Database size: %.2f KB\n", float64(info.Size())/1024)
+	fmt.Fprintf(app.Out, "Last modified: %s\n\n", info.ModTime().Format("2006-01-02 15:04:05"))
+
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer store.Close()
+
+	// Get session count
+	sessions, err := store.ListSessions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	// Get cost summary
+	costSummary, err := store.GetTotalCost(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get cost summary: %w", err)
+	}
+
+	version, err := store.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(app.Out, "Statistics:")
+	fmt.Fprintf(app.Out, "  Sessions: %d\n", len(sessions))
+	fmt.Fprintf(app.Out, "  Total images generated: %d\n", costSummary.ImageCount)
+	fmt.Fprintf(app.Out, "  Total cost: $%.4f\n", costSummary.TotalCost)
+	fmt.Fprintf(app.Out, "  Schema version: %d\n", version)
+
+	return nil
+}
+
+func runDBReset(app *App) error {
+	dbPath, err := getDBPath()
+	if err != nil {
+		return err
+	}
+
+	// Check if file exists
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		fmt.Fprintln(app.Out, "Database does not exist, nothing to reset")
+		return nil
+	}
+
+	if flagDBBackup {
+		backupPath := dbPath + ".backup-" + time.Now().Format("20060102-150405")
+		data, err := os.ReadFile(dbPath)
+		if err != nil {
+			return fmt.Errorf("failed to read database for backup: %w", err)
+		}
+		if err := os.WriteFile(backupPath, data, 0600); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+		fmt.Fprintf(app.Out, "Backup saved to: %s\n", backupPath)
+	}
+
+	if err := os.Remove(dbPath); err != nil {
+		return fmt.Errorf("failed to delete database: %w", err)
+	}
+
+	fmt.Fprintln(app.Out, "Database deleted successfully")
+
+	// Create fresh database
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to create new database: %w", err)
+	}
+	store.Close()
+
+	fmt.Fprintln(app.Out, "Fresh database created")
+	return nil
+}
+
+func runDBVacuum(app *App) error {
+	dbPath, err := getDBPath()
+	if err != nil {
+		return err
+	}
+
+	before, err := os.Stat(dbPath)
+	if os.IsNotExist(err) {
+		fmt.Fprintln(app.Out, "Database does not exist, nothing to vacuum")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat database: %w", err)
+	}
+
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	err = store.Vacuum(context.Background())
+	store.Close()
+	if err != nil {
+		return err
+	}
+
+	after, err := os.Stat(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat database: %w", err)
+	}
+
+	fmt.Fprintf(app.Out, "Database size before: %.2f KB\n", float64(before.Size())/1024)
+	fmt.Fprintf(app.Out, "Database size after:  %.2f KB\n", float64(after.Size())/1024)
+	fmt.Fprintf(app.Out, "Reclaimed: %.2f KB\n", float64(max(before.Size()-after.Size(), 0))/1024)
+	return nil
+}
+
+func runDBCheck(app *App) error {
+	dbPath, err := getDBPath()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		fmt.Fprintln(app.Out, "Database does not exist, nothing to check")
+		return nil
+	}
+
+	// Checking must not change the file, so it is not migrated first.
+	store, err := session.OpenReadOnly(dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	problems, err := store.IntegrityCheck(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(app.Out, "Integrity check passed")
+		return nil
+	}
+
+	fmt.Fprintf(app.Out, "Integrity check found %d problem(s):\n", len(problems))
+	for _, p := range problems {
+		fmt.Fprintf(app.Out, "  %s\n", p)
+	}
+	return fmt.Errorf("database integrity check failed")
+}
+
+var getDBPath = func() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".imggen", "sessions.db"), nil
+}
+
+func newBatchCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "batch <input-file>",
+		Short: "Generate images in batch from a file",
+		Long: `Generate multiple images from a file containing prompts.
+
+Input formats:
+  .txt - One prompt per line (lines starting with # are ignored)
+  .json - JSON array of objects with prompt/model/size/quality fields, or
+          {"template": "a {{.color}} {{.item}}", "items": [{...}, ...]}
+          to render one prompt per entry with text/template
+  -     - Read the prompts from stdin, as JSON if they start with [ or {
+          and as text otherwise; confirmations are skipped
+
+Progress is checkpointed to .imggen-batch-state.json in the output
+directory; after an interruption, run the same command with --resume to
+skip the items that already completed.
+
+Each run writes batch-results.json to the output directory. Pass it to
+--retry-failed to re-run only the items that failed; the retry saves into
+the same output directory and writes a new, merged results file.
+
+Examples:
+  imggen batch prompts.txt
+  imggen batch prompts.txt -o ./output
+  imggen batch prompts.json -o ./output -p 3
+  imggen batch prompts.txt -o ./output -m dall-e-3 -q hd
+  imggen batch prompts.txt -o ./output --resume
+  imggen batch scraped.txt -o ./output --dedupe-prompts
+  cat prompts.txt | imggen batch - -o ./output
+  imggen batch prompts.txt -o ./output --contact-sheet sheet.png --cols 5
+  imggen batch --retry-failed ./output/batch-results.json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBatch(cmd, args, app)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flagBatchOutput, "output", "o", "", "output directory for generated images; overrides config")
+	cmd.Flags().StringVarP(&flagBatchModel, "model", "m", "gpt-image-1", "default model for prompts without model specified; overrides config")
+	cmd.Flags().StringVarP(&flagBatchSize, "size", "s", "", "default image size or alias (square, landscape, portrait); overrides config")
+	cmd.Flags().StringVarP(&flagBatchQuality, "quality", "q", "", "default quality level; overrides config")
+	cmd.Flags().StringVarP(&flagBatchFormat, "format", "f", "", "output format (png, jpeg, webp, auto; default: each model's format, else png); overrides config")
+	cmd.Flags().IntVarP(&flagBatchParallel, "parallel", "p", 1, "number of parallel workers (1 = sequential); overrides config")
+	cmd.Flags().BoolVar(&flagBatchStopOnError, "stop-on-error", false, "stop batch on first error")
+	cmd.Flags().IntVar(&flagBatchDelay, "delay", 0, "delay between requests in milliseconds")
+	cmd.Flags().IntVar(&flagBatchRPM, "requests-per-minute", 0, "maximum requests started per minute across all workers (0 = unlimited)")
+	cmd.Flags().BoolVar(&flagBatchResume, "resume", false, "skip items an interrupted run already completed in the output directory")
+	cmd.Flags().StringVar(&flagBatchRetryFailed, "retry-failed", "", "retry the failed items listed in a batch results file")
+	cmd.Flags().BoolVarP(&flagYes, "yes", "y", false, "start without confirming the estimated cost")
+	cmd.Flags().BoolVar(&flagBatchDedupe, "dedupe-prompts", false, "skip items repeating an earlier item's prompt, model, size, and quality")
+	cmd.Flags().BoolVar(&flagStripWeights, "strip-weights", false, "remove weighted terms like (term:1.2) from prompts for models that do not support them")
+	cmd.Flags().BoolVar(&flagEmbedMetadata, "embed-metadata", false, "record each item's prompt and settings in its PNG or JPEG file")
+	cmd.Flags().BoolVar(&flagProvenance, "provenance", false, "mark each item's PNG or JPEG file as AI-generated with the model, time, and a prompt hash")
+	addEncodeFlags(cmd)
+	cmd.Flags().StringVar(&flagNameTemplate, "name-template", "", "name each item's file from {index}, {prompt}, {model}, {size}, {date}, and {seed} (default \"{index}-{prompt}\")")
+	cmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "validate every item and print the resolved requests and estimated cost without an API key or API call")
+	cmd.Flags().StringVar(&flagContactSheet, "contact-sheet", "", "also tile the saved images, captioned with their prompts, into this .png, .jpg, or .webp file")
+	cmd.Flags().IntVar(&flagSheetColumns, "cols", 4, "columns of the --contact-sheet grid")
+	cmd.Flags().Float64Var(&flagBatchBudget, "budget", 0, "stop before a request would take the run's spend past this many USD (0 = no limit)")
+	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key (defaults to OPENAI_API_KEY, or STABILITY_API_KEY for Stability models)")
+	cmd.Flags().BoolVarP(&flagVerbose, "verbose", "v", false, "log HTTP requests and responses")
+
+	return cmd
+}
+
+// dedupeItems drops items repeating an earlier one for --dedupe-prompts,
+// reporting how many were removed.
+func dedupeItems(app *App, items []batch.Item, opts *batch.Options) []batch.Item {
+	items, removed := batch.Dedupe(items, opts, app.Registry)
+	fmt.Fprintf(app.info(), "Removed %d duplicate prompt(s); %d left\n", removed, len(items))
+	return items
+}
+
+// batchConflicts are the flag combinations the batch command rejects.
+var batchConflicts = []conflictCheck{
+	checkEncodeOptions,
+	func(*App, []string) error {
+		if flagContactSheet == "" {
+			return nil
+		}
+		return checkContactSheet(flagContactSheet)
+	},
+	func(_ *App, args []string) error {
+		if flagBatchRetryFailed != "" && len(args) > 0 {
+			return fmt.Errorf("cannot use an input file with --retry-failed")
+		}
+		return nil
+	},
+}
+
+func runBatch(_ *cobra.Command, args []string, app *App) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := checkConflicts(app, args, batchConflicts); err != nil {
+		return err
+	}
+
+	app, jsonOut := withJSONOutput(app)
+
+	if flagBatchRetryFailed == "" && len(args) == 0 {
+		return fmt.Errorf("requires an input file or --retry-failed")
+	}
+
+	// Get API key using priority: --api-key flag > stored key > env var.
+	// A dry run never reaches the API, so it needs none.
+	// Items naming another provider's model have their key checked when
+	// they first need it.
+	if !flagDryRun {
+		if _, err := apiKeyForProvider(providerForModel(app.Registry, flagBatchModel)); err != nil {
+			return err
+		}
+	}
+
+	format := models.OutputFormat(flagBatchFormat)
+	if format != "" && !format.IsValid() && !format.IsAuto() {
+		return invalidFormatError(flagBatchFormat)
+	}
+	if flagBatchBudget < 0 {
+		return fmt.Errorf("--budget must not be negative, got %g", flagBatchBudget)
+	}
+	tmpl, err := nameTemplate(true)
+	if err != nil {
+		return err
+	}
+
+	// With the prompts read from stdin there is no one left to answer
+	// questions, so every confirmation takes its default.
+	fromStdin := len(args) > 0 && args[0] == "-"
+	prompting := isTerminal() && jsonOut == nil && !fromStdin
+
+	var (
+		items    []batch.Item
+		previous *batch.ResultsFile
+	)
+	if flagBatchRetryFailed != "" {
+		previous, err = batch.ReadResults(flagBatchRetryFailed)
+		if err != nil {
+			return err
+		}
+		items = previous.FailedItems()
+		if len(items) == 0 {
+			fmt.Fprintln(app.Out, "No failed items to retry.")
+			return nil
+		}
+		fmt.Fprintf(app.info(), "Retrying %d failed prompts from %s\n", len(items), flagBatchRetryFailed)
+	} else {
+		if fromStdin {
+			items, err = batch.Parse(app.In)
+		} else {
+			items, err = batch.ParseFile(args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse input file: %w", err)
+		}
+		fmt.Fprintf(app.info(), "Batch generation: %d prompts\n", len(items))
+	}
+
+	if flagDryRun {
+		opts := &batch.Options{
+			DefaultModel:   flagBatchModel,
+			DefaultSize:    flagBatchSize,
+			DefaultQuality: flagBatchQuality,
+			Format:         format,
+			StripWeights:   flagStripWeights,
+		}
+		if flagBatchDedupe {
+			items = dedupeItems(app, items, opts)
+		}
+		return dryRunItems(app, jsonOut, items, opts)
+	}
+
+	outputDir := flagBatchOutput
+	if outputDir == "" && previous != nil {
+		outputDir = previous.OutputDir
+	}
+	if outputDir == "" {
+		outputDir = "."
+		fmt.Fprintln(app.warn(), "\033[33mWarning: No output directory specified. Images will be saved to current directory.\033[0m")
+
+		if prompting {
+			fmt.Fprint(app.Out, "Continue? [Y/n] ")
+			reader := bufio.NewReader(os.Stdin)
+			response, _ := reader.ReadString('\n')
+			response = strings.TrimSpace(strings.ToLower(response))
+			if response == "n" || response == "no" {
+				fmt.Fprintln(app.Out, "Aborted.")
+				return nil
+			}
+		}
+	} else {
+		if _, err := os.Stat(outputDir); os.IsNotExist(err) {
+			if prompting {
+				fmt.Fprintf(app.Out, "Directory %q does not exist. Create it? [Y/n] ", outputDir)
+				reader := bufio.NewReader(os.Stdin)
+				response, _ := reader.ReadString('\n')
+				response = strings.TrimSpace(strings.ToLower(response))
+				if response == "n" || response == "no" {
+					fmt.Fprintln(app.Out, "Aborted.")
+					return nil
+				}
+			}
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				return fmt.Errorf("failed to create output directory: %w", err)
+			}
+			fmt.Fprintf(app.Out, "Created directory: %s\n", outputDir)
+		}
+	}
+
+	fmt.Fprintf(app.info(), "Output directory: %s\n\n", outputDir)
+
+	prov, err := newProviderRouter(app, flagBatchModel)
+	if err != nil {
+		return err
+	}
+
+	thr, err := newThrottle()
+	if err != nil {
+		return err
+	}
+
+	money, err := cost.NewFormatter(flagLocale)
+	if err != nil {
+		return err
+	}
+
+	eventLog, err := newEventLogger()
+	if err != nil {
+		return err
+	}
+
+	processor := batch.NewProcessor(prov, newSaver(app), app.Registry, app.Out, app.Err)
+	processor.SetCostFormatter(money)
+	processor.SetEventLogger(eventLog)
+	processor.SetQuiet(app.Quiet)
+
+	opts := &batch.Options{
+		OutputDir:         outputDir,
+		DefaultModel:      flagBatchModel,
+		DefaultSize:       flagBatchSize,
+		DefaultQuality:    flagBatchQuality,
+		Format:            format,
+		Parallel:          flagBatchParallel,
+		StopOnError:       flagBatchStopOnError,
+		DelayMs:           flagBatchDelay,
+		RequestsPerMinute: flagBatchRPM,
+		Checkpoint:        true,
+		Resume:            flagBatchResume,
+		Throttle:          thr,
+		StripWeights:      flagStripWeights,
+		EmbedMetadata:     flagEmbedMetadata,
+		Provenance:        flagProvenance,
+		NameTemplate:      tmpl,
+		PriceOverrides:    priceOverrides,
+	}
+	if flagBatchBudget > 0 {
+		opts.Budget = cost.NewBudget(flagBatchBudget)
+	}
+
+	if flagBatchDedupe {
+		items = dedupeItems(app, items, opts)
+	}
+
+	est := processor.EstimateCost(items, opts)
+	estimate := est.Total
+	fmt.Fprintf(app.info(), "Estimated cost: %s\n", money.USD(estimate, 2))
+	warnUnpriced(app, est)
+	if opts.Budget != nil && estimate > flagBatchBudget {
+		fmt.Fprintf(app.warn(), "Warning: estimate is over the %s budget; the batch will stop when the budget is reached\n", money.USD(flagBatchBudget, 2))
+	}
+	if prompting && !flagYes {
+		// Above --confirm-above the question defaults to no.
+		var proceed bool
+		if aboveConfirmLimit(estimate) {
+			proceed = confirmCost(app, estimate, false)
+		} else {
+			proceed = confirmDefaultYes(app, "Continue?")
+		}
+		if !proceed {
+			fmt.Fprintln(app.Out, "Aborted.")
+			return nil
+		}
+	}
+
+	results, err := processBatch(ctx, processor, items, opts, jsonOut, flagBatchModel)
+
+	processor.PrintSummary(results)
+	rf, writeErr := writeBatchResults(app, outputDir, items, results, previous)
+
+	// The images made before the budget ran out were paid for, so they are
+	// still logged and shown before the budget error is returned.
+	budgetErr := err
+	if err != nil && !errors.Is(err, cost.ErrBudgetExceeded) {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	if flagContactSheet != "" {
+		if err := writeContactSheet(app, flagContactSheet, sheetTiles(rf, outputDir)); err != nil {
+			if err := softFail(app, "%w", err); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := logBatchCost(ctx, app, results, flagBatchModel); err != nil {
+		return err
+	}
+	if budgetErr != nil {
+		return budgetErr
+	}
+
+	return checkBatchFailures(results)
+}
+
+// writeBatchResults saves the results sidecar for a batch run. A retry run
+// merges its results into the previous file's and writes them to a new file,
+// leaving the file being retried untouched. Failing to write it is a soft
+// failure. The results written are returned either way.
+func writeBatchResults(app *App, outputDir string, items []batch.Item, results []batch.Result, previous *batch.ResultsFile) (*batch.ResultsFile, error) {
+	rf := batch.NewResultsFile(outputDir, items, results)
+	path := filepath.Join(outputDir, batch.ResultsFileName)
+	if previous != nil {
+		rf = previous.Merge(rf)
+		rf.OutputDir = outputDir
+		path = batch.RetryResultsPath(outputDir, time.Now())
+	}
+
+	if err := batch.WriteResults(path, rf); err != nil {
+		return rf, softFail(app, "%w", err)
+	}
+	fmt.Fprintf(app.Out, "Results: %s\n", path)
+	return rf, nil
+}
+
+// newProviderConfig builds the provider configuration shared by all commands
+// from the global flags.
+func newProviderConfig(providerType models.ProviderType, apiKey string) *provider.Config {
+	// A ~ that cannot be expanded is left for the provider to report when
+	// it fails to read the file.
+	caCert, err := expandHome(flagCACert)
+	if err != nil {
+		caCert = flagCACert
+	}
+	return &provider.Config{
+		Provider:   providerType,
+		APIKey:     apiKey,
+		BaseURL:    flagBaseURL,
+		Verbose:    flagVerbose,
+		MaxRetries: flagRetries,
+		HTTPProxy:  flagProxy,
+		CACertFile: caCert,
+
+		GenerateTimeout: flagTimeout,
+		EditTimeout:     flagTimeout,
+		DownloadTimeout: flagTimeout,
+		OCRTimeout:      flagTimeout,
+
+		MaxInflightPerHost: flagMaxInflightPerHost,
+		SaveRequestPath:    flagSaveRequest,
+		SaveResponsePath:   flagSaveResponse,
+		PriceOverrides:     priceOverrides,
+	}
+}
+
+// invalidFormatError reports an unsupported --format value, suggesting the
+// closest valid format when the value looks like a typo.
+func invalidFormatError(format string) error {
+	names := []string{"auto"}
+	for _, f := range models.ValidFormats() {
+		names = append(names, string(f))
+	}
+	return fmt.Errorf("invalid format %q%s: must be one of %v or auto", format, suggest.DidYouMean(format, names), models.ValidFormats())
+}
+
+// providerForModel returns the provider that serves model. Unknown models
+// resolve to OpenAI so that validation can report them with the model list.
+func providerForModel(registry *models.ModelRegistry, model string) models.ProviderType {
+	if caps, ok := registry.Get(model); ok {
+		return caps.Provider
+	}
+	return models.ProviderOpenAI
+}
+
+// newProviderRouter returns the provider for runs whose items may name
+// different models. Each backend is created, with its own API key and the
+// response cache, when an item first needs it; the one serving
+// defaultModel is created up front so a bad key fails before any work.
+func newProviderRouter(app *App, defaultModel string) (*provider.Router, error) {
+	router := provider.NewRouter(app.Registry, models.ProviderOpenAI, func(providerType models.ProviderType) (provider.Provider, error) {
+		apiKey, err := apiKeyForProvider(providerType)
+		if err != nil {
+			return nil, err
+		}
+		prov, err := app.NewProvider(newProviderConfig(providerType, apiKey), app.Registry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create provider: %w", err)
+		}
+		return withCache(app, prov)
+	})
+	if _, err := router.For(defaultModel); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// logBatchCost records the cost of a batch's successful results, one
+// entry per model so items sent to different providers are attributed to
+// the right one. Results without a resolved model count as defaultModel.
+func logBatchCost(ctx context.Context, app *App, results []batch.Result, defaultModel string) error {
+	type total struct {
+		cost   float64
+		images int
+	}
+	totals := make(map[string]*total)
+	var order []string
+	for _, r := range results {
+		if r.Error != nil || r.Skipped || r.Path == "" {
+			continue
+		}
+		model := r.Model
+		if model == "" {
+			model = defaultModel
+		}
+		t, ok := totals[model]
+		if !ok {
+			t = &total{}
+			totals[model] = t
+			order = append(order, model)
+		}
+		t.cost += r.Cost
+		t.images++
+	}
+	for _, model := range order {
+		if totals[model].cost == 0 {
+			continue
+		}
+		err := logCost(ctx, app, &session.CostEntry{
+			Provider:   string(providerForModel(app.Registry, model)),
+			Model:      model,
+			Cost:       totals[model].cost,
+			ImageCount: totals[model].images,
+			Timestamp:  time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apiKeyForProvider resolves the API key for a provider using priority:
+// --api-key flag > stored key > environment variable.
+func apiKeyForProvider(providerType models.ProviderType) (string, error) {
+	apiKey, _, err := keys.GetAPIKey(flagAPIKey, string(providerType), apiKeyEnvVar(providerType))
+	return apiKey, err
+}
+
+// apiKeyEnvVar returns the environment variable holding a provider's key.
+func apiKeyEnvVar(providerType models.ProviderType) string {
+	if providerType == models.ProviderStability {
+		return "STABILITY_API_KEY"
+	}
+	return "OPENAI_API_KEY"
+}
+
+// httpTransport returns the transport for requests made outside a
+// provider, such as update checks, so they use the same --proxy and
+// --ca-cert as API calls.
+func httpTransport() (http.RoundTripper, error) {
+	return provider.HTTPTransport(newProviderConfig("", ""))
+}
+
+// newThrottle returns the cross-process request throttle configured by
+// --min-interval, or nil when throttling is disabled.
+func newThrottle() (*throttle.Throttle, error) {
+	if flagMinInterval <= 0 {
+		return nil, nil
+	}
+	path, err := throttle.DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return throttle.New(path, flagMinInterval), nil
+}
+
+// withCache wraps prov in the on-disk response cache when --cache is set.
+func withCache(app *App, prov provider.Provider) (provider.Provider, error) {
+	if !flagCache {
+		return prov, nil
+	}
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return cache.NewProvider(prov, cache.New(dir, flagCacheMaxMB<<20), app.Err), nil
+}
+
+// stdinIsPiped reports whether app.In is redirected from a pipe or file
+// rather than a terminal, so input can be read from it without a user.
+func stdinIsPiped(app *App) bool {
+	if app.In == nil {
+		return false
+	}
+	if f, ok := app.In.(*os.File); ok {
+		return !term.IsTerminal(int(f.Fd()))
+	}
+	return true
+}
+
+// readStdinPrompt reads a single prompt from app.In, trimming surrounding
+// whitespace so `echo` output works as is.
+func readStdinPrompt(app *App) (string, error) {
+	data, err := io.ReadAll(app.In)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt from stdin: %w", err)
+	}
+	prompt := strings.TrimSpace(string(data))
+	if prompt == "" {
+		return "", fmt.Errorf("no prompt given: pass one as an argument or on stdin")
+	}
+	return prompt, nil
+}
+
+// showSpinner reports whether a progress spinner may redraw a line of
+// app.Out: only when it is a terminal, which --json output never is,
+// --verbose is not logging requests to the same screen meanwhile, and
+// --quiet is not set.
+func showSpinner(app *App) bool {
+	return progress.IsTerminal(app.Out) && !flagVerbose && !app.Quiet
+}
+
+// isTerminal reports whether stdin is a terminal someone can answer
+// questions on. Tests replace it.
+var isTerminal = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+func truncate(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen-3] + "..."
+}
+
+func countSuccessful(results []batch.Result) int {
+	count := 0
+	for _, r := range results {
+		if r.Error == nil && !r.Skipped {
+			count++
+		}
+	}
+	return count
+}
+
+var (
+	flagRegisterDryRun bool
+	flagRegisterForce  bool
+
+	flagRegisterBackupsAll bool
+)
+
+func newRegisterCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "register [integration...]",
+		Short: "Register imggen with AI CLI tools",
+		Long: `Register imggen with AI CLI tools so they know how to use it.
+
+Supported integrations:
+  claude  - Claude Code (~/.claude/skills/imggen/SKILL.md)
+  codex   - OpenAI Codex CLI (~/.codex/AGENTS.md)
+  cursor  - Cursor (~/.cursor/rules/imggen.mdc)
+  gemini  - Gemini CLI (~/.gemini/GEMINI.md)
+
+Examples:
+  imggen register --all              # Register with all supported CLIs
+  imggen register claude codex       # Register with specific CLIs
+  imggen register --dry-run --all    # Preview what would happen
+  imggen register status             # Show registration status
+  imggen register unregister claude  # Remove from Claude Code
+
+The command will:
+  1. Show what changes will be made
+  2. Create a backup of any existing config
+  3. Ask for confirmation before proceeding`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRegister(app, args)
+		},
+	}
+
+	cmd.Flags().BoolVar(&flagRegisterDryRun, "dry-run", false, "show what would happen without making changes")
+	cmd.Flags().BoolVar(&flagRegisterForce, "force", false, "overwrite existing registration")
+	cmd.Flags().Bool("all", false, "register with all supported integrations")
+
+	cmd.AddCommand(newRegisterStatusCmd(app))
+	cmd.AddCommand(newRegisterUnregisterCmd(app))
+	cmd.AddCommand(newRegisterBackupsCmd(app))
+	cmd.AddCommand(newRegisterRollbackCmd(app))
+
+	return cmd
+}
+
+func newRegisterStatusCmd(app *App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show registration status for all integrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRegisterStatus(app)
+		},
+	}
+}
+
+func newRegisterUnregisterCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unregister [integration...]",
+		Short: "Remove imggen from AI CLI tools",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runUnregister(app, args)
+		},
+	}
+	cmd.Flags().BoolVar(&flagRegisterDryRun, "dry-run", false, "show what would happen without making changes")
+	return cmd
+}
+
+func newRegisterBackupsCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backups [integration]",
+		Short: "List backup files for an integration",
+		Long: `List backup files for an integration, or for every integration with --all.
+
+Examples:
+  imggen register backups claude
+  imggen register backups --all`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if flagRegisterBackupsAll {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if flagRegisterBackupsAll {
+				return runListAllBackups(app)
+			}
+			return runListBackups(app, args[0])
+		},
+	}
+	cmd.Flags().BoolVar(&flagRegisterBackupsAll, "all", false, "list backups for all integrations")
+	return cmd
+}
+
+func newRegisterRollbackCmd(app *App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rollback <backup-path>",
+		Short: "Restore a backup file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRollback(app, args[0])
+		},
+	}
+}
+
+func runRegister(app *App, args []string) error {
+	registrar := register.NewRegistrar(app.Out, app.Err, os.Stdin)
+	registrar.DryRun = flagRegisterDryRun
+	registrar.Force = flagRegisterForce
 
 	var integrations []register.Integration
 
-	// Check for --all flag
-	allFlag := false
-	for _, arg := range os.Args {
-		if arg == "--all" {
-			allFlag = true
-			break
-		}
+	// Check for --all flag
+	allFlag := false
+	for _, arg := range os.Args {
+		if arg == "--all" {
+			allFlag = true
+			break
+		}
+	}
+
+	if allFlag {
+		integrations = register.AllIntegrations()
+	} else if len(args) == 0 {
+		// Show help if no integrations specified
+		fmt.Fprintln(app.Out, "Available integrations:")
+		for _, i := range register.AllIntegrations() {
+			registered, _, _ := registrar.Status(i)
+			status := "not registered"
+			if registered {
+				status = "registered"
+			}
+			fmt.Fprintf(app.Out, "  %-8s  %s (%s)\n", i, i.Description(), status)
+		}
+		fmt.Fprintln(app.Out, "\nUsage:")
+		fmt.Fprintln(app.Out, "  imggen register --all           # Register with all integrations")
+		fmt.Fprintln(app.Out, "  imggen register claude codex    # Register with specific integrations")
+		fmt.Fprintln(app.Out, "  imggen register status          # Show detailed status")
+		fmt.Fprintln(app.Out, "\nUse 'imggen register --help' for more options.")
+		return nil
+	} else {
+		for _, arg := range args {
+			i := register.Integration(arg)
+			valid := false
+			for _, all := range register.AllIntegrations() {
+				if i == all {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return fmt.Errorf("unknown integration %q: valid options are %v", arg, register.AllIntegrations())
+			}
+			integrations = append(integrations, i)
+		}
+	}
+
+	if flagRegisterDryRun {
+		fmt.Fprintln(app.Out, "DRY RUN - no changes will be made")
+	}
+
+	results := registrar.Register(integrations)
+
+	// Summary
+	fmt.Fprintln(app.Out, "\nSummary:")
+	var succeeded, skipped, failed int
+	for _, r := range results {
+		if r.Error != nil {
+			fmt.Fprintf(app.Out, "  ✗ %s: %v\n", r.Integration.DisplayName(), r.Error)
+			failed++
+		} else if r.WasSkipped {
+			fmt.Fprintf(app.Out, "  - %s: %s\n", r.Integration.DisplayName(), r.SkipReason)
+			skipped++
+		} else {
+			fmt.Fprintf(app.Out, "  ✓ %s: %s\n", r.Integration.DisplayName(), r.ConfigPath)
+			succeeded++
+		}
+	}
+
+	fmt.Fprintf(app.Out, "\n%d succeeded, %d skipped, %d failed\n", succeeded, skipped, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d registration(s) failed", failed)
+	}
+
+	return nil
+}
+
+func runRegisterStatus(app *App) error {
+	registrar := register.NewRegistrar(app.Out, app.Err, os.Stdin)
+
+	fmt.Fprintln(app.Out, "Registration Status:")
+	fmt.Fprintln(app.Out, "")
+
+	for _, i := range register.AllIntegrations() {
+		registered, configPath, err := registrar.Status(i)
+		if err != nil {
+			fmt.Fprintf(app.Out, "%-15s  Error: %v\n", i.DisplayName(), err)
+			continue
+		}
+
+		status := "✗ Not registered"
+		if registered {
+			status = "✓ Registered"
+		}
+
+		fmt.Fprintf(app.Out, "%-15s  %s\n", i.DisplayName(), status)
+		fmt.Fprintf(app.Out, "                 %s\n", configPath)
+
+		// List backups
+		backups, _ := registrar.ListBackups(i)
+		if len(backups) > 0 {
+			fmt.Fprintf(app.Out, "                 Backups: %d\n", len(backups))
+		}
+		fmt.Fprintln(app.Out, "")
+	}
+
+	return nil
+}
+
+func runUnregister(app *App, args []string) error {
+	registrar := register.NewRegistrar(app.Out, app.Err, os.Stdin)
+	registrar.DryRun = flagRegisterDryRun
+
+	for _, arg := range args {
+		i := register.Integration(arg)
+		valid := false
+		for _, all := range register.AllIntegrations() {
+			if i == all {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("unknown integration %q", arg)
+		}
+
+		if err := registrar.Unregister(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runListBackups(app *App, integration string) error {
+	registrar := register.NewRegistrar(app.Out, app.Err, os.Stdin)
+
+	i := register.Integration(integration)
+	valid := false
+	for _, all := range register.AllIntegrations() {
+		if i == all {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return fmt.Errorf("unknown integration %q", integration)
+	}
+
+	backups, err := registrar.ListBackups(i)
+	if err != nil {
+		return err
+	}
+
+	if len(backups) == 0 {
+		fmt.Fprintf(app.Out, "No backups found for %s\n", i.DisplayName())
+		return nil
+	}
+
+	fmt.Fprintf(app.Out, "Backups for %s:\n", i.DisplayName())
+	for _, b := range backups {
+		printBackup(app.Out, b)
+	}
+
+	fmt.Fprintln(app.Out, "\nTo restore a backup:")
+	fmt.Fprintln(app.Out, "  imggen register rollback <backup-path>")
+
+	return nil
+}
+
+// runListAllBackups lists backups for every integration, grouped by
+// integration.
+func runListAllBackups(app *App) error {
+	registrar := register.NewRegistrar(app.Out, app.Err, os.Stdin)
+
+	total := 0
+	for _, i := range register.AllIntegrations() {
+		backups, err := registrar.ListBackups(i)
+		if err != nil {
+			fmt.Fprintf(app.warn(), "Warning: %s: %v\n", i, err)
+			continue
+		}
+
+		fmt.Fprintf(app.Out, "%s (%s):\n", i.DisplayName(), i)
+		if len(backups) == 0 {
+			fmt.Fprintln(app.Out, "  (none)")
+		}
+		for _, b := range backups {
+			printBackup(app.Out, b)
+		}
+		total += len(backups)
+	}
+
+	if total == 0 {
+		fmt.Fprintln(app.Out, "\nNo backups found")
+		return nil
+	}
+
+	fmt.Fprintf(app.Out, "\n%d backup(s). To restore a backup:\n", total)
+	fmt.Fprintln(app.Out, "  imggen register rollback <backup-path>")
+
+	return nil
+}
+
+// printBackup prints a backup path with its timestamp and size.
+func printBackup(w io.Writer, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(w, "  %s\n", path)
+		return
+	}
+	fmt.Fprintf(w, "  %s (%s, %s)\n", path, info.ModTime().Format("2006-01-02 15:04:05"), formatFileSize(info.Size()))
+}
+
+// formatFileSize renders a byte count as B, KB, or MB.
+func formatFileSize(n int64) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+func runRollback(app *App, backupPath string) error {
+	registrar := register.NewRegistrar(app.Out, app.Err, os.Stdin)
+	return registrar.Rollback(backupPath)
+}
+
+// OCR command
+
+func newOCRCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ocr <image-path>...",
+		Short: "Extract text from images using OCR",
+		Long: `Extract text from images using OpenAI's vision API.
+
+Supports structured output with JSON schemas. If no schema is provided,
+you can use --suggest-schema to have the AI suggest an appropriate schema.
+
+Input:
+  Provide an image file path as argument, or use --url for remote images.
+  Several paths, or --batch with a directory, process each image in turn
+  (up to --parallel at once).
+
+Output:
+  By default, outputs plain text. Use --schema for structured JSON output.
+  With several images, each one's result is written to <name>.txt (or
+  <name>.json with --schema) in the -o directory, or beside the image, and
+  the total tokens and cost are printed at the end.
+
+Examples:
+  imggen ocr image.png                              # Extract text from image
+  imggen ocr --url https://example.com/image.png    # Extract from URL
+  imggen ocr image.png --schema schema.json         # Structured output
+  imggen ocr image.png --suggest-schema             # Suggest a JSON schema
+  imggen ocr image.png -o output.txt                # Save to file
+  imggen ocr receipt.jpg --schema invoice.json -o data.json
+  imggen ocr invoice.png --schema invoice.json --split-fields  # invoice.total.txt, ...
+  imggen ocr --batch ./receipts --schema receipt.json -o ./extracted --parallel 4
+  imggen ocr scan1.png scan2.png scan3.png
+  imggen ocr --batch ./receipts --schema receipt.json --output-format csv -o receipts.csv
+  imggen ocr article.png --reflow -o article.txt     # Join wrapped lines`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if flagOCRURL != "" || flagOCRBatch != "" {
+				return nil
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runOCR(cmd, args, app)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flagOCRModel, "model", "m", "gpt-5-mini", "model to use (gpt-5.2, gpt-5-mini, gpt-5-nano)")
+	cmd.Flags().StringVarP(&flagOCRSchema, "schema", "s", "", "JSON schema file for structured output")
+	cmd.Flags().StringVar(&flagOCRSchemaName, "schema-name", "", "name for the JSON schema (default: extracted_data)")
+	cmd.Flags().BoolVar(&flagOCRSuggestSchema, "suggest-schema", false, "suggest a JSON schema based on image content")
+	cmd.Flags().StringVarP(&flagOCRPrompt, "prompt", "p", "", "custom extraction prompt")
+	cmd.Flags().StringVarP(&flagOCROutput, "output", "o", "", "output file (default: stdout); with several images, the output directory (default: beside each image)")
+	cmd.Flags().StringVar(&flagOCRBatch, "batch", "", "extract text from every image in this directory")
+	cmd.Flags().IntVar(&flagOCRParallel, "parallel", 1, "images to process at once with several images")
+	cmd.Flags().StringVar(&flagOCROutputFormat, "output-format", "json", "with several images and --schema: json (a file per image) or csv (one row per image in the -o file)")
+	cmd.Flags().StringVar(&flagOCRURL, "url", "", "image URL instead of file path")
+	cmd.Flags().Float64Var(&flagOCRConfidence, "confidence-threshold", 0, "re-prompt once for schema fields scoring below this confidence (0-1)")
+	cmd.Flags().IntVar(&flagOCRMaxTokens, "max-output-tokens", 0, "cap on output tokens per image to bound cost and latency (default: 16384)")
+	cmd.Flags().Float64Var(&flagOCRBudget, "budget", 0, "stop before an image's worst-case cost would take the run's spend past this many USD (0 = no limit)")
+	cmd.Flags().BoolVar(&flagOCRStream, "stream", false, "print the extracted text as it arrives")
+	cmd.Flags().BoolVar(&flagOCRReflow, "reflow", false, "join hard-wrapped lines into paragraphs in plain text output")
+	cmd.Flags().BoolVar(&flagOCRSplitFields, "split-fields", false, "also write each top-level schema field to <base>.<field>.txt next to -o (or the image)")
+	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key (defaults to OPENAI_API_KEY)")
+	cmd.Flags().BoolVarP(&flagVerbose, "verbose", "v", false, "log HTTP requests and responses")
+
+	cmd.AddCommand(newOCRSchemaCmd(app))
+
+	return cmd
+}
+
+func newOCRSchemaCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Build JSON schemas for structured OCR output",
+	}
+
+	fromExampleCmd := &cobra.Command{
+		Use:   "from-example <example.json>",
+		Short: "Infer a JSON schema from an example of the output",
+		Long: `Infer a JSON schema for --schema from an example JSON document, offline.
+
+The schema follows the example's types, key order, nested objects, and
+arrays, and is ready for strict structured output: every key is required.
+Keys that are null, or missing from some objects of an array, become
+nullable. Unlike --suggest-schema, no image or API call is needed.
+
+Examples:
+  imggen ocr schema from-example receipt.json -o receipt-schema.json
+  imggen ocr receipt.png --schema receipt-schema.json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runOCRSchemaFromExample(app, args[0])
+		},
+	}
+	fromExampleCmd.Flags().StringVarP(&flagOCRSchemaOutput, "output", "o", "", "schema file to write (default: stdout)")
+
+	cmd.AddCommand(fromExampleCmd)
+
+	return cmd
+}
+
+func runOCRSchemaFromExample(app *App, examplePath string) error {
+	example, err := os.ReadFile(examplePath)
+	if err != nil {
+		return fmt.Errorf("failed to read example: %w", err)
+	}
+	schema, err := schemagen.FromExample(example)
+	if err != nil {
+		return fmt.Errorf("%s: %w", examplePath, err)
+	}
+
+	if flagOCRSchemaOutput == "" {
+		fmt.Fprintln(app.Out, string(schema))
+		return nil
+	}
+	if err := os.WriteFile(flagOCRSchemaOutput, append(schema, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write schema file: %w", err)
+	}
+	fmt.Fprintf(app.Out, "Schema saved to: %s\n", flagOCRSchemaOutput)
+	return nil
+}
+
+// ocrConflicts are the flag combinations the ocr command rejects.
+var ocrConflicts = []conflictCheck{
+	func(_ *App, args []string) error {
+		if flagOCRURL != "" && len(args) > 0 {
+			return fmt.Errorf("use either an image file or --url, not both")
+		}
+		return nil
+	},
+	func(_ *App, args []string) error {
+		if flagOCRBatch != "" && (len(args) > 0 || flagOCRURL != "") {
+			return fmt.Errorf("use either --batch or image files and --url, not both")
+		}
+		return nil
+	},
+	func(_ *App, args []string) error {
+		if !ocrBatchMode(args) {
+			return nil
+		}
+		for _, flag := range []struct {
+			name string
+			set  bool
+		}{
+			{"--suggest-schema", flagOCRSuggestSchema},
+			{"--stream", flagOCRStream},
+			{"--split-fields", flagOCRSplitFields},
+		} {
+			if flag.set {
+				return fmt.Errorf("%s works on a single image, not --batch or several files", flag.name)
+			}
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if !flagOCRReflow {
+			return nil
+		}
+		switch {
+		case flagOCRSchema != "" || flagOCRSuggestSchema:
+			return fmt.Errorf("--reflow applies to plain text and cannot be used with --schema or --suggest-schema")
+		case flagOCRStream:
+			return fmt.Errorf("--reflow cannot be used with --stream")
+		}
+		return nil
+	},
+	func(_ *App, args []string) error {
+		switch flagOCROutputFormat {
+		case "json":
+			return nil
+		case "csv":
+		default:
+			return fmt.Errorf("invalid --output-format %q: must be json or csv", flagOCROutputFormat)
+		}
+		switch {
+		case !ocrBatchMode(args):
+			return fmt.Errorf("--output-format csv needs several images or --batch")
+		case flagOCRSchema == "":
+			return fmt.Errorf("--output-format csv requires --schema")
+		case flagOCROutput == "":
+			return fmt.Errorf("--output-format csv requires -o for the CSV file")
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagOCRBudget < 0 {
+			return fmt.Errorf("--budget must not be negative, got %g", flagOCRBudget)
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagOCRMaxTokens < 0 {
+			return fmt.Errorf("--max-output-tokens must be positive, got %d", flagOCRMaxTokens)
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagOCRConfidence < 0 || flagOCRConfidence > 1 {
+			return fmt.Errorf("--confidence-threshold must be between 0 and 1, got %g", flagOCRConfidence)
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagOCRParallel < 1 {
+			return fmt.Errorf("--parallel must be at least 1, got %d", flagOCRParallel)
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagOCRSuggestSchema && flagOCRSchema != "" {
+			return fmt.Errorf("--suggest-schema cannot be used with --schema")
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagOCRSplitFields && flagOCRSchema == "" {
+			return fmt.Errorf("--split-fields requires --schema")
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagOCRStream && flagJSON {
+			return fmt.Errorf("--stream cannot be used with --json")
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagOCRStream && flagOCRSuggestSchema {
+			return fmt.Errorf("--stream cannot be used with --suggest-schema")
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagOCRStream && flagOCRConfidence > 0 {
+			return fmt.Errorf("--stream cannot be used with --confidence-threshold")
+		}
+		return nil
+	},
+}
+
+func runOCR(_ *cobra.Command, args []string, app *App) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := checkConflicts(app, args, ocrConflicts); err != nil {
+		return err
+	}
+
+	app, jsonOut := withJSONOutput(app)
+
+	var batchPaths, batchOutputs []string
+	if ocrBatchMode(args) {
+		var err error
+		if batchPaths, batchOutputs, err = ocrBatchFiles(args); err != nil {
+			return err
+		}
+	}
+
+	apiKey, _, err := keys.GetAPIKey(flagAPIKey, "openai", "OPENAI_API_KEY")
+	if err != nil {
+		return err
+	}
+
+	providerCfg := newProviderConfig(models.ProviderOpenAI, apiKey)
+	prov, err := app.NewProvider(providerCfg, app.Registry)
+	if err != nil {
+		return fmt.Errorf("failed to create provider: %w", err)
+	}
+
+	ocrProv, ok := prov.(interface {
+		OCR(ctx context.Context, req *models.OCRRequest) (*models.OCRResponse, error)
+		SuggestSchema(ctx context.Context, req *models.OCRRequest) (json.RawMessage, error)
+	})
+	if !ok {
+		return fmt.Errorf("provider does not support OCR")
+	}
+
+	req := models.NewOCRRequest()
+	req.Model = flagOCRModel
+	req.Prompt = flagOCRPrompt
+	if flagOCRMaxTokens > 0 {
+		req.MaxTokens = flagOCRMaxTokens
+	}
+
+	if flagOCRURL != "" {
+		req.ImageURL = flagOCRURL
+	} else if len(args) == 1 {
+		req.ImagePath = args[0]
+		if _, err := os.Stat(req.ImagePath); os.IsNotExist(err) {
+			return fmt.Errorf("image file not found: %s", req.ImagePath)
+		}
+	}
+
+	// Load schema if provided
+	if flagOCRSchema != "" {
+		schemaData, err := os.ReadFile(flagOCRSchema)
+		if err != nil {
+			return fmt.Errorf("failed to read schema file: %w", err)
+		}
+		req.Schema = schemaData
+		req.SchemaName = flagOCRSchemaName
+	}
+
+	if flagOCRConfidence > 0 {
+		if len(req.Schema) == 0 {
+			return fmt.Errorf("--confidence-threshold requires --schema")
+		}
+		req.ConfidenceThreshold = flagOCRConfidence
+	}
+
+	if batchPaths != nil {
+		return runOCRBatch(ctx, app, jsonOut, ocrProv.OCR, req, batchPaths, batchOutputs)
+	}
+
+	var streamProv interface {
+		StreamOCR(ctx context.Context, req *models.OCRRequest, onDelta func(string)) (*models.OCRResponse, error)
+	}
+	if flagOCRStream {
+		streamProv, ok = prov.(interface {
+			StreamOCR(ctx context.Context, req *models.OCRRequest, onDelta func(string)) (*models.OCRResponse, error)
+		})
+		if !ok {
+			return fmt.Errorf("provider does not support streaming OCR")
+		}
+	}
+
+	source := req.ImagePath
+	if source == "" {
+		source = req.ImageURL
+	}
+
+	// Suggest schema mode
+	if flagOCRSuggestSchema {
+		fmt.Fprintln(app.info(), "Analyzing image to suggest JSON schema...")
+		schema, err := ocrProv.SuggestSchema(ctx, req)
+		if err != nil {
+			return fmt.Errorf("failed to suggest schema: %w", err)
+		}
+
+		// Pretty print the schema
+		var prettySchema bytes.Buffer
+		if err := json.Indent(&prettySchema, schema, "", "  "); err != nil {
+			fmt.Fprintln(app.Out, string(schema))
+		} else {
+			fmt.Fprintln(app.Out, prettySchema.String())
+		}
+
+		// Save to file if output specified
+		if flagOCROutput != "" {
+			if err := os.WriteFile(flagOCROutput, prettySchema.Bytes(), 0644); err != nil {
+				return fmt.Errorf("failed to write schema file: %w", err)
+			}
+			fmt.Fprintf(app.Out, "\nSchema saved to: %s\n", flagOCROutput)
+		}
+
+		if jsonOut != nil {
+			return writeJSON(jsonOut, &ocrJSON{Model: req.Model, Source: source, Schema: schema, OutputPath: flagOCROutput})
+		}
+		return nil
+	}
+
+	// Regular OCR extraction
+	fmt.Fprintf(app.info(), "Extracting text from %s using %s...\n", source, req.Model)
+
+	eventLog, err := newEventLogger()
+	if err != nil {
+		return err
+	}
+
+	if flagOCRBudget > 0 {
+		if err := cost.NewBudget(flagOCRBudget).Reserve(ocrEstimate(req)); err != nil {
+			return fmt.Errorf("%w; a lower --max-output-tokens lowers the estimate", err)
+		}
+	}
+
+	thr, err := newThrottle()
+	if err != nil {
+		return err
+	}
+	if err := thr.Wait(ctx); err != nil {
+		return fmt.Errorf("throttle: %w", err)
+	}
+
+	start := time.Now()
+	var resp *models.OCRResponse
+	if streamProv != nil {
+		fmt.Fprintln(app.Out, "")
+		resp, err = streamProv.StreamOCR(ctx, req, func(text string) {
+			fmt.Fprint(app.Out, text)
+		})
+		fmt.Fprintln(app.Out, "")
+	} else {
+		resp, err = ocrProv.OCR(ctx, req)
+	}
+	var ocrCost *models.CostInfo
+	if resp != nil {
+		ocrCost = resp.Cost
+	}
+	eventLog.Record(app.warn(), events.Event{Op: events.OpOCR, Model: req.Model}, req.Prompt, ocrCost, start, err)
+	if err != nil {
+		return fmt.Errorf("OCR failed: %w", err)
+	}
+	if resp.Truncated {
+		warnOCRTruncated(app, source, req.MaxTokens)
+	}
+	if flagOCRReflow {
+		resp.Text = reflow.Reflow(resp.Text)
+	}
+
+	output := ocrOutputText(resp)
+
+	// Write output
+	if flagOCROutput != "" {
+		if err := os.WriteFile(flagOCROutput, []byte(output), 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		fmt.Fprintf(app.Out, "Output saved to: %s\n", flagOCROutput)
+	} else if streamProv == nil {
+		fmt.Fprintln(app.Out, "")
+		fmt.Fprintln(app.Out, output)
+	}
+
+	var fieldPaths map[string]string
+	if flagOCRSplitFields {
+		dir, base := splitFieldsBase(flagOCROutput, source)
+		fieldPaths, err = writeSplitFields(dir, base, resp.Structured)
+		if err != nil {
+			return err
+		}
+		for _, field := range slices.Sorted(maps.Keys(fieldPaths)) {
+			fmt.Fprintf(app.Out, "Field %s saved to: %s\n", field, fieldPaths[field])
+		}
+	}
+
+	if len(resp.Confidence) > 0 {
+		fields := make([]string, 0, len(resp.Confidence))
+		for field := range resp.Confidence {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		fmt.Fprintln(app.Out, "\nConfidence:")
+		for _, field := range fields {
+			marker := ""
+			if resp.Confidence[field] < req.ConfidenceThreshold {
+				marker = " (low)"
+			}
+			fmt.Fprintf(app.Out, "  %s: %.2f%s\n", field, resp.Confidence[field], marker)
+		}
+	}
+
+	// Show cost info
+	if resp.Cost != nil {
+		fmt.Fprintf(app.info(), "\nCost: $%.6f (input: %d tokens, output: %d tokens)\n",
+			resp.Cost.Total, resp.InputTokens, resp.OutputTokens)
+
+		err := logCost(ctx, app, &session.CostEntry{
+			Provider:   "openai",
+			Model:      req.Model,
+			Cost:       resp.Cost.Total,
+			ImageCount: 1,
+			Timestamp:  time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if jsonOut != nil {
+		result := &ocrJSON{
+			Model:        req.Model,
+			Source:       source,
+			Structured:   resp.Structured,
+			Confidence:   resp.Confidence,
+			OutputPath:   flagOCROutput,
+			FieldPaths:   fieldPaths,
+			InputTokens:  resp.InputTokens,
+			OutputTokens: resp.OutputTokens,
+			Truncated:    resp.Truncated,
+		}
+		if len(resp.Structured) == 0 {
+			result.Text = resp.Text
+		}
+		if resp.Cost != nil {
+			result.Cost = resp.Cost.Total
+		}
+		return writeJSON(jsonOut, result)
+	}
+	return nil
+}
+
+// ocrBatchMode reports whether ocr processes several images: a --batch
+// directory or more than one path.
+func ocrBatchMode(args []string) bool {
+	return flagOCRBatch != "" || len(args) > 1
+}
+
+// ocrBatchResult is the outcome of one image of an OCR batch.
+type ocrBatchResult struct {
+	source     string
+	outputPath string
+	resp       *models.OCRResponse
+	err        error
+}
+
+// runOCRBatch extracts text from each image in paths with base's settings,
+// running up to --parallel requests at once like batch generation, and
+// writes each result beside its image or into the -o directory, or with
+// --output-format csv as one row per image in the -o file. Failed images
+// are reported and skipped; the cost of the rest is logged as one entry
+// and summarized at the end.
+func runOCRBatch(ctx context.Context, app *App, jsonOut io.Writer, ocr func(context.Context, *models.OCRRequest) (*models.OCRResponse, error), base *models.OCRRequest, paths, outputs []string) error {
+	var columns []string
+	if flagOCROutputFormat == "csv" {
+		var err error
+		if columns, err = ocrcsv.Columns(base.Schema); err != nil {
+			return fmt.Errorf("%s: %w", flagOCRSchema, err)
+		}
+	} else if flagOCROutput != "" {
+		if err := os.MkdirAll(flagOCROutput, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	eventLog, err := newEventLogger()
+	if err != nil {
+		return err
+	}
+	thr, err := newThrottle()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(app.info(), "OCR batch: %d images using %s\n", len(paths), base.Model)
+
+	var mu sync.Mutex
+	done := 0
+	report := func(r *ocrBatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		switch {
+		case r.err != nil:
+			fmt.Fprintf(app.Out, "[%d/%d] %s: failed: %v\n", done, len(paths), r.source, r.err)
+		case r.outputPath == "":
+			fmt.Fprintf(app.info(), "[%d/%d] %s\n", done, len(paths), r.source)
+		default:
+			fmt.Fprintf(app.Out, "[%d/%d] %s -> %s\n", done, len(paths), r.source, r.outputPath)
+		}
+		if r.err == nil && r.resp.Truncated {
+			warnOCRTruncated(app, r.source, base.MaxTokens)
+		}
+		if jsonOut != nil {
+			result := &ocrJSON{Model: base.Model, Source: r.source}
+			if r.err != nil {
+				result.Error = r.err.Error()
+			} else {
+				result.OutputPath = r.outputPath
+				result.Structured = r.resp.Structured
+				result.Confidence = r.resp.Confidence
+				result.InputTokens = r.resp.InputTokens
+				result.OutputTokens = r.resp.OutputTokens
+				result.Truncated = r.resp.Truncated
+				if len(r.resp.Structured) == 0 {
+					result.Text = r.resp.Text
+				}
+				if r.resp.Cost != nil {
+					result.Cost = r.resp.Cost.Total
+				}
+			}
+			if err := writeJSON(jsonOut, result); err != nil {
+				fmt.Fprintf(app.warn(), "Warning: %v\n", err)
+			}
+		}
+	}
+
+	var (
+		budget    *cost.Budget
+		budgetHit atomic.Bool
+	)
+	if flagOCRBudget > 0 {
+		budget = cost.NewBudget(flagOCRBudget)
+	}
+
+	process := func(i int) *ocrBatchResult {
+		r := &ocrBatchResult{source: paths[i], outputPath: outputs[i]}
+		req := *base
+		req.ImagePath = paths[i]
+
+		estimate := ocrEstimate(&req)
+		if err := budget.Reserve(estimate); err != nil {
+			r.err = err
+			budgetHit.Store(true)
+			return r
+		}
+		// Whatever happens next, the reservation becomes the actual cost.
+		var spent float64
+		defer func() { budget.Settle(estimate, spent) }()
+
+		if err := thr.Wait(ctx); err != nil {
+			r.err = fmt.Errorf("throttle: %w", err)
+			return r
+		}
+
+		start := time.Now()
+		r.resp, r.err = ocr(ctx, &req)
+		var ocrCost *models.CostInfo
+		if r.resp != nil {
+			ocrCost = r.resp.Cost
+		}
+		if ocrCost != nil {
+			spent = ocrCost.Total
+		}
+		eventLog.Record(app.warn(), events.Event{Op: events.OpOCR, Model: req.Model}, req.Prompt, ocrCost, start, r.err)
+		if r.err != nil {
+			return r
+		}
+		if flagOCRReflow {
+			r.resp.Text = reflow.Reflow(r.resp.Text)
+		}
+		if r.outputPath == "" {
+			return r
+		}
+
+		if err := os.WriteFile(r.outputPath, []byte(ocrOutputText(r.resp)), 0644); err != nil {
+			r.err = fmt.Errorf("failed to write output file: %w", err)
+		}
+		return r
+	}
+
+	results := make([]*ocrBatchResult, len(paths))
+	jobs := make(chan int, len(paths))
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	for range min(flagOCRParallel, len(paths)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil || budgetHit.Load() {
+					return
+				}
+				results[i] = process(i)
+				report(results[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	var (
+		succeeded, failed         int
+		inputTokens, outputTokens int
+		total                     float64
+	)
+	for _, r := range results {
+		switch {
+		case r == nil:
+		case r.err != nil:
+			failed++
+		default:
+			succeeded++
+			inputTokens += r.resp.InputTokens
+			outputTokens += r.resp.OutputTokens
+			if r.resp.Cost != nil {
+				total += r.resp.Cost.Total
+			}
+		}
+	}
+
+	if columns != nil {
+		if err := writeOCRCSV(app, flagOCROutput, columns, results); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(app.info(), "\nProcessed %d of %d images: %d succeeded, %d failed\n", succeeded+failed, len(paths), succeeded, failed)
+	fmt.Fprintf(app.info(), "Tokens: %d input, %d output\n", inputTokens, outputTokens)
+	fmt.Fprintf(app.info(), "Total cost: $%.6f\n", total)
+	if budgetHit.Load() {
+		fmt.Fprintf(app.Err, "Stopped: the next image could cost more than the $%.4f --budget has left\n", flagOCRBudget)
+	}
+
+	if total > 0 {
+		err := logCost(ctx, app, &session.CostEntry{
+			Provider:   "openai",
+			Model:      base.Model,
+			Cost:       total,
+			ImageCount: succeeded,
+			Timestamp:  time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if failed > 0 && flagStrict {
+		return fmt.Errorf("%d of %d images failed (--strict)", failed, len(paths))
+	}
+	return nil
+}
+
+// writeOCRCSV writes the structured result of every image that succeeded
+// to path as CSV, in image order. A result that is not a JSON object is
+// left out with a warning.
+func writeOCRCSV(app *App, path string, columns []string, results []*ocrBatchResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	defer f.Close()
+
+	w, err := ocrcsv.NewWriter(f, columns)
+	if err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	rows := 0
+	for _, r := range results {
+		if r == nil || r.err != nil {
+			continue
+		}
+		if err := w.Write(r.source, r.resp.Structured); err != nil {
+			fmt.Fprintf(app.warn(), "Warning: %s left out of the csv: %v\n", r.source, err)
+			continue
+		}
+		rows++
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	fmt.Fprintf(app.Out, "CSV saved to: %s (%d rows)\n", path, rows)
+	return nil
+}
+
+// ocrBatchFiles lists the images of an OCR batch, from --batch or args, and
+// the result file each is written to, which is none with --output-format
+// csv.
+func ocrBatchFiles(args []string) (paths, outputs []string, err error) {
+	paths = args
+	if flagOCRBatch != "" {
+		if paths, err = imageFiles(flagOCRBatch); err != nil {
+			return nil, nil, err
+		}
+		if len(paths) == 0 {
+			return nil, nil, fmt.Errorf("no images found in %s", flagOCRBatch)
+		}
+	}
+	if flagOCROutputFormat == "csv" {
+		return paths, make([]string, len(paths)), nil
+	}
+
+	ext := ".txt"
+	if flagOCRSchema != "" {
+		ext = ".json"
+	}
+	outputs, err = ocrOutputPaths(paths, flagOCROutput, ext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return paths, outputs, nil
+}
+
+// ocrOutputPaths names the result file of each image: its name with ext,
+// in dir or, when dir is empty, beside the image. Two images that would
+// write the same file are rejected.
+func ocrOutputPaths(paths []string, dir, ext string) ([]string, error) {
+	outputs := make([]string, len(paths))
+	seen := make(map[string]string, len(paths))
+	for i, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ext
+		out := filepath.Join(filepath.Dir(path), name)
+		if dir != "" {
+			out = filepath.Join(dir, name)
+		}
+		if prev, ok := seen[out]; ok {
+			return nil, fmt.Errorf("%s and %s would both write %s", prev, path, out)
+		}
+		seen[out] = path
+		outputs[i] = out
+	}
+	return outputs, nil
+}
+
+// ocrEstimate is the most req can cost, reserved against --budget before it
+// is sent. An image whose size cannot be read is priced as the largest
+// image, and a confidence threshold may send a second request.
+func ocrEstimate(req *models.OCRRequest) float64 {
+	var width, height int
+	if req.ImagePath != "" {
+		width, height, _ = image.FileDimensions(req.ImagePath)
+	}
+	estimate := cost.EstimateOCRCost(req.Model, width, height, len(req.Prompt)+len(req.Schema), req.MaxTokens).Total
+	if req.ConfidenceThreshold > 0 {
+		estimate *= 2
+	}
+	return estimate
+}
+
+// warnOCRTruncated reports a reply that stopped at the output token cap,
+// whose text or JSON is likely incomplete.
+func warnOCRTruncated(app *App, source string, maxTokens int) {
+	fmt.Fprintf(app.warn(), "Warning: %s: output was cut off at %d tokens; raise --max-output-tokens for the full result\n", source, maxTokens)
+}
+
+// ocrOutputText returns what ocr writes for resp: the structured result
+// indented, or the plain text.
+func ocrOutputText(resp *models.OCRResponse) string {
+	if len(resp.Structured) == 0 {
+		return resp.Text
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, resp.Structured, "", "  "); err != nil {
+		return string(resp.Structured)
+	}
+	return pretty.String()
+}
+
+// splitFieldsBase returns the directory and file name prefix --split-fields
+// writes to: beside -o when it is given, otherwise in the current directory
+// named after the image file or URL.
+func splitFieldsBase(output, source string) (dir, base string) {
+	if output != "" {
+		return filepath.Dir(output), strings.TrimSuffix(filepath.Base(output), filepath.Ext(output))
+	}
+	if u, err := url.Parse(source); err == nil && u.Scheme != "" {
+		source = u.Path
+	}
+	base = strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	if base == "" || base == "." || base == "/" {
+		base = "ocr"
+	}
+	return ".", base
+}
+
+// writeSplitFields writes each top-level field of structured to
+// dir/<base>.<field>.txt and returns the paths by field. Strings are written
+// as plain text and other values as JSON. Field names come from the model,
+// so names that would leave dir are rejected before anything is written.
+func writeSplitFields(dir, base string, structured json.RawMessage) (map[string]string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(structured, &fields); err != nil || fields == nil {
+		return nil, fmt.Errorf("--split-fields needs a JSON object result, got %s", truncate(string(structured), 40))
+	}
+
+	paths := make(map[string]string, len(fields))
+	for field := range fields {
+		name := fmt.Sprintf("%s.%s.txt", base, field)
+		if field == "" || strings.ContainsAny(field, `/\`) || filepath.Base(name) != name {
+			return nil, fmt.Errorf("--split-fields: field %q is not a valid file name", field)
+		}
+		if err := security.ValidateSavePath(name); err != nil {
+			return nil, fmt.Errorf("--split-fields: field %q: %w", field, err)
+		}
+		paths[field] = filepath.Join(dir, name)
+	}
+
+	for field, path := range paths {
+		if err := os.WriteFile(path, fieldText(fields[field]), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write field %s: %w", field, err)
+		}
+	}
+	return paths, nil
+}
+
+// fieldText renders one structured field for its own file.
+func fieldText(value json.RawMessage) []byte {
+	var text string
+	if json.Unmarshal(value, &text) == nil {
+		return []byte(text + "\n")
+	}
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, value, "", "  ") != nil {
+		return append(value, '\n')
+	}
+	pretty.WriteByte('\n')
+	return pretty.Bytes()
+}
+
+// Video command
+
+func newVideoCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "video <prompt>",
+		Short: "Generate videos using AI video generation APIs",
+		Long: `Generate videos using OpenAI's Sora video generation API.
+
+Supported models:
+  - sora-2 (default): Standard quality, up to 12 seconds
+  - sora-2-pro: Higher quality, up to 20 seconds
+
+Examples:
+  imggen video "a cat walking on a beach"
+  imggen video -m sora-2-pro -d 8 "sunset over mountains"
+  imggen video -s 1280x720 -o myvideo.mp4 "dancing robot"`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVideo(cmd, args, app)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flagVideoModel, "model", "m", "sora-2", "model to use (sora-2, sora-2-pro)")
+	cmd.Flags().IntVarP(&flagVideoDuration, "duration", "d", 0, "video duration in seconds (default: model default)")
+	cmd.Flags().StringVarP(&flagVideoSize, "size", "s", "", "video size (e.g., 1280x720)")
+	cmd.Flags().StringVarP(&flagVideoOutput, "output", "o", "", "output filename")
+	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key (defaults to OPENAI_API_KEY)")
+	cmd.Flags().BoolVarP(&flagVerbose, "verbose", "v", false, "log HTTP requests and responses")
+
+	return cmd
+}
+
+func runVideo(_ *cobra.Command, args []string, app *App) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// Get API key using priority: --api-key flag > stored key > env var
+	apiKey, _, err := keys.GetAPIKey(flagAPIKey, "openai", "OPENAI_API_KEY")
+	if err != nil {
+		return err
+	}
+
+	prompt := args[0]
+
+	req := models.NewVideoRequest(prompt)
+	req.Model = flagVideoModel
+	req.Duration = flagVideoDuration
+	req.Size = flagVideoSize
+
+	caps, ok := app.Registry.GetVideo(flagVideoModel)
+	if !ok {
+		return fmt.Errorf("unknown video model %q: available models: %v", flagVideoModel, app.Registry.ListVideoModels())
+	}
+
+	caps.ApplyDefaults(req)
+
+	if err := caps.Validate(req); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+
+	providerCfg := newProviderConfig(models.ProviderOpenAI, apiKey)
+	prov, err := app.NewProvider(providerCfg, app.Registry)
+	if err != nil {
+		return fmt.Errorf("failed to create provider: %w", err)
+	}
+
+	videoProv, ok := prov.(provider.VideoProvider)
+	if !ok {
+		return fmt.Errorf("provider does not support video generation")
+	}
+
+	thr, err := newThrottle()
+	if err != nil {
+		return err
+	}
+	if err := thr.Wait(ctx); err != nil {
+		return fmt.Errorf("throttle: %w", err)
+	}
+
+	fmt.Fprintf(app.info(), "Generating video with %s (%d seconds)...\n", req.Model, req.Duration)
+
+	resp, err := videoProv.GenerateVideo(ctx, req)
+	if err != nil {
+		return fmt.Errorf("video generation failed: %w", err)
+	}
+
+	saver := newSaver(app)
+
+	// Determine output path
+	outputPath := flagVideoOutput
+	if outputPath == "" {
+		outputPath = image.GenerateVideoFilename(0)
+	}
+
+	if len(resp.Videos) > 0 {
+		if err := saver.SaveVideo(ctx, &resp.Videos[0], outputPath); err != nil {
+			return fmt.Errorf("failed to save video: %w", err)
+		}
+		fmt.Fprintf(app.Out, "Saved: %s\n", outputPath)
+	}
+
+	if resp.Cost != nil {
+		fmt.Fprintf(app.info(), "Cost: $%.4f (%d seconds @ $%.4f/second, %s)\n",
+			resp.Cost.Total, req.Duration, resp.Cost.PerImage, req.Model)
+
+		err := logCost(ctx, app, &session.CostEntry{
+			Provider:   string(prov.Name()),
+			Model:      req.Model,
+			Cost:       resp.Cost.Total,
+			ImageCount: 1, // Count as 1 item for video
+			Timestamp:  time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(app.info(), "Done!")
+	return nil
+}
+
+// Animate command
+
+func newAnimateCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "animate <frame> <frame>...",
+		Short: "Assemble image frames into an animated GIF",
+		Long: `Assemble a sequence of images into a looping animated GIF.
+
+Frames are played in the order given and sized to the first frame.
+
+Examples:
+  imggen animate frame1.png frame2.png frame3.png -o out.gif
+  imggen animate frames/*.png -o out.gif --fps 8`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAnimate(cmd, args, app)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flagAnimateOutput, "output", "o", "animation.gif", "output file (.gif)")
+	cmd.Flags().IntVar(&flagAnimateFPS, "fps", 4, "frames per second (1-100)")
+
+	return cmd
+}
+
+func runAnimate(_ *cobra.Command, args []string, app *App) error {
+	switch strings.ToLower(filepath.Ext(flagAnimateOutput)) {
+	case ".gif":
+	case ".webp":
+		return fmt.Errorf("animated webp output is not supported yet: use a .gif output path")
+	default:
+		return fmt.Errorf("unsupported animation format %q: use a .gif output path", filepath.Ext(flagAnimateOutput))
+	}
+
+	frames := make([][]byte, 0, len(args))
+	for _, path := range args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read frame: %w", err)
+		}
+		frames = append(frames, data)
+	}
+
+	data, err := image.AssembleGIF(frames, flagAnimateFPS)
+	if err != nil {
+		return fmt.Errorf("failed to assemble animation: %w", err)
+	}
+
+	if err := os.WriteFile(flagAnimateOutput, data, 0644); err != nil {
+		return fmt.Errorf("failed to write animation: %w", err)
+	}
+
+	fmt.Fprintf(app.Out, "Saved: %s (%d frames @ %d fps)\n", flagAnimateOutput, len(frames), flagAnimateFPS)
+	return nil
+}
+
+func newMontageCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "montage <dir>",
+		Short: "Tile a directory of images into a captioned contact sheet",
+		Long: `Tile the images in a directory into one overview image.
+
+Images are scaled to fit uniform cells, in a grid --cols wide. For a batch
+output directory the order and captions come from batch-results.json, so
+each image is captioned with its prompt. Otherwise every PNG, JPEG, WebP,
+and GIF file is used in name order, captioned with the prompt recorded by
+--embed-metadata or else its file name.
+
+Examples:
+  imggen montage ./output -o sheet.png
+  imggen montage ./output -o sheet.jpg --cols 6`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMontage(cmd, args, app)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flagMontageOutput, "output", "o", "contact-sheet.png", "output file (.png, .jpg, or .webp)")
+	cmd.Flags().IntVar(&flagSheetColumns, "cols", 4, "columns of the grid")
+
+	return cmd
+}
+
+func runMontage(_ *cobra.Command, args []string, app *App) error {
+	if err := checkContactSheet(flagMontageOutput); err != nil {
+		return err
+	}
+
+	dir := args[0]
+	var tiles []image.SheetTile
+	rf, err := batch.ReadResults(filepath.Join(dir, batch.ResultsFileName))
+	switch {
+	case err == nil:
+		tiles = sheetTiles(rf, dir)
+	case errors.Is(err, os.ErrNotExist):
+		if tiles, err = dirTiles(dir); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	if len(tiles) == 0 {
+		return fmt.Errorf("no images found in %s", dir)
+	}
+
+	return writeContactSheet(app, flagMontageOutput, tiles)
+}
+
+// checkContactSheet validates the contact sheet path and --cols before any
+// work is done.
+func checkContactSheet(path string) error {
+	if flagSheetColumns < 1 {
+		return fmt.Errorf("--cols must be at least 1, got %d", flagSheetColumns)
+	}
+	_, err := image.SheetFormat(path)
+	return err
+}
+
+// sheetTiles lists the images a batch saved, captioned with their prompts.
+// Saved paths are taken relative to the run's output directory, so a batch
+// directory that has since moved to dir still resolves.
+func sheetTiles(rf *batch.ResultsFile, dir string) []image.SheetTile {
+	var tiles []image.SheetTile
+	for _, e := range rf.Items {
+		if !e.Success {
+			continue
+		}
+		path := e.Path
+		if rel, err := filepath.Rel(rf.OutputDir, e.Path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = filepath.Join(dir, rel)
+		}
+		tiles = append(tiles, image.SheetTile{Path: path, Caption: e.Prompt})
+	}
+	return tiles
+}
+
+// dirTiles lists the images in dir by name, captioned with their embedded
+// prompt or file name.
+func dirTiles(dir string) ([]image.SheetTile, error) {
+	paths, err := imageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var tiles []image.SheetTile
+	for _, path := range paths {
+		caption := filepath.Base(path)
+		if data, err := os.ReadFile(path); err == nil {
+			if params, err := image.ReadParams(data); err == nil && params != nil && params.Prompt != "" {
+				caption = params.Prompt
+			}
+		}
+		tiles = append(tiles, image.SheetTile{Path: path, Caption: caption})
+	}
+	return tiles, nil
+}
+
+// imageFiles lists the PNG, JPEG, WebP, and GIF files directly in dir, in
+// name order.
+func imageFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".png", ".jpg", ".jpeg", ".webp", ".gif":
+		default:
+			continue
+		}
+		if !e.IsDir() {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// writeContactSheet renders tiles into a contact sheet at path.
+func writeContactSheet(app *App, path string, tiles []image.SheetTile) error {
+	format, err := image.SheetFormat(path)
+	if err != nil {
+		return err
+	}
+	data, err := image.ContactSheet(tiles, image.SheetOptions{Columns: flagSheetColumns}, format)
+	if err != nil {
+		return fmt.Errorf("failed to build contact sheet: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write contact sheet: %w", err)
+	}
+	fmt.Fprintf(app.Out, "Contact sheet: %s (%d images)\n", path, len(tiles))
+	return nil
+}
+
+func newIconCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "icon <prompt>",
+		Short: "Generate a transparent icon set at standard sizes",
+		Long: `Generate one transparent square image and resample it to icon sizes.
+
+Each size is written as icon-<size>.png in the output directory. --ico
+also packs the sizes up to 256 into icon.ico for Windows, and --icns packs
+the sizes macOS has PNG slots for (16, 32, 64, 128, 256, 512, and 1024)
+into icon.icns.
+
+Examples:
+  imggen icon "a fox logo, flat design" -o ./icons
+  imggen icon "a paper plane" -o ./icons --ico --icns
+  imggen icon "a rocket" --sizes 16,32,64 -q high`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIcon(cmd, args, app)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flagIconOutput, "output", "o", "icons", "output directory")
+	cmd.Flags().StringVarP(&flagIconModel, "model", "m", "gpt-image-1", "model to use; must support transparent backgrounds")
+	cmd.Flags().StringVarP(&flagIconQuality, "quality", "q", "", "quality level (defaults to the model's default)")
+	cmd.Flags().IntSliceVar(&flagIconSizes, "sizes", image.IconSizes, "icon sizes in pixels")
+	cmd.Flags().BoolVar(&flagIconICO, "ico", false, "also write icon.ico with the sizes up to 256")
+	cmd.Flags().BoolVar(&flagIconICNS, "icns", false, "also write icon.icns for macOS")
+	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key (defaults to OPENAI_API_KEY)")
+	cmd.Flags().BoolVarP(&flagVerbose, "verbose", "v", false, "log HTTP requests and responses")
+
+	return cmd
+}
+
+// iconConflicts are the flag combinations the icon command rejects. They
+// are checked before the image is paid for.
+var iconConflicts = []conflictCheck{
+	func(*App, []string) error {
+		if len(flagIconSizes) == 0 {
+			return fmt.Errorf("--sizes needs at least one size")
+		}
+		for _, size := range flagIconSizes {
+			if size < 1 {
+				return fmt.Errorf("--sizes must be positive, got %d", size)
+			}
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagIconICO && len(image.ICOSizes(flagIconSizes)) == 0 {
+			return fmt.Errorf("--ico needs a size of 256 or less in --sizes")
+		}
+		if flagIconICNS && len(image.ICNSSizes(flagIconSizes)) == 0 {
+			return fmt.Errorf("--icns needs one of 16, 32, 64, 128, 256, 512, or 1024 in --sizes")
+		}
+		return nil
+	},
+	func(app *App, _ []string) error {
+		caps, ok := app.Registry.Get(flagIconModel)
+		if !ok {
+			return fmt.Errorf("unknown model %q: available models: %v", flagIconModel, app.Registry.List())
+		}
+		if !caps.SupportsTransparency {
+			return fmt.Errorf("%w: %s (use gpt-image-1)", models.ErrTransparencyNotSupported, flagIconModel)
+		}
+		return nil
+	},
+}
+
+func runIcon(_ *cobra.Command, args []string, app *App) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := checkConflicts(app, args, iconConflicts); err != nil {
+		return err
+	}
+	caps, _ := app.Registry.Get(flagIconModel)
+
+	req := models.NewRequest(args[0])
+	req.Model = caps.Name
+	req.Size = "1024x1024"
+	req.Quality = flagIconQuality
+	req.Format = models.FormatPNG
+	req.Transparent = true
+	caps.ApplyDefaults(req)
+	if err := caps.Validate(req); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+
+	apiKey, err := apiKeyForProvider(caps.Provider)
+	if err != nil {
+		return err
+	}
+
+	prov, err := app.NewProvider(newProviderConfig(caps.Provider, apiKey), app.Registry)
+	if err != nil {
+		return fmt.Errorf("failed to create provider: %w", err)
+	}
+
+	eventLog, err := newEventLogger()
+	if err != nil {
+		return err
+	}
+
+	thr, err := newThrottle()
+	if err != nil {
+		return err
+	}
+	if err := thr.Wait(ctx); err != nil {
+		return fmt.Errorf("throttle: %w", err)
+	}
+
+	fmt.Fprintf(app.info(), "Generating icon with %s...\n", req.Model)
+
+	start := time.Now()
+	resp, err := prov.Generate(ctx, req)
+	logGenerateEvent(app, eventLog, req, resp, start, err)
+	if err != nil {
+		return fmt.Errorf("generation failed: %w", err)
+	}
+	if len(resp.Images) == 0 {
+		return fmt.Errorf("generation failed: no image returned")
+	}
+
+	if resp.Cost != nil {
+		if err := logGenerationCost(ctx, app, prov, req.Model, resp); err != nil {
+			return err
+		}
+	}
+
+	data, err := newSaver(app).Fetch(ctx, &resp.Images[0])
+	if err != nil {
+		return err
+	}
+	icons, err := image.IconSet(data, flagIconSizes)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(flagIconOutput, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	type iconFile struct {
+		name string
+		data []byte
+	}
+	var files []iconFile
+	for _, icon := range icons {
+		files = append(files, iconFile{fmt.Sprintf("icon-%d.png", icon.Size), icon.PNG})
+	}
+	if flagIconICO {
+		data, err := image.EncodeICO(icons)
+		if err != nil {
+			return err
+		}
+		files = append(files, iconFile{"icon.ico", data})
+	}
+	if flagIconICNS {
+		data, err := image.EncodeICNS(icons)
+		if err != nil {
+			return err
+		}
+		files = append(files, iconFile{"icon.icns", data})
+	}
+	for _, f := range files {
+		path := filepath.Join(flagIconOutput, f.name)
+		if err := os.WriteFile(path, f.data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		fmt.Fprintf(app.Out, "Saved: %s\n", path)
+	}
+
+	if resp.Cost != nil {
+		fmt.Fprintf(app.info(), "Cost: $%.4f (%s %s %s)\n", resp.Cost.Total, req.Model, req.Size, req.Quality)
+	}
+	fmt.Fprintln(app.info(), "Done!")
+	return nil
+}
+
+func newVaryCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "vary <image>",
+		Short: "Generate variations of an existing image",
+		Long: `Generate variations of an existing image without a prompt.
+
+Only dall-e-2 supports variations. The source should be a square PNG
+under 4MB.
+
+Examples:
+  imggen vary photo.png -n 4
+  imggen vary logo.png -n 2 -s 512x512 -o logo-variant.png`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVary(cmd, args, app)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flagVaryModel, "model", "m", "dall-e-2", "model to use")
+	cmd.Flags().IntVarP(&flagVaryCount, "count", "n", 1, "number of variations")
+	cmd.Flags().StringVarP(&flagVarySize, "size", "s", "", "image size (256x256, 512x512, 1024x1024)")
+	cmd.Flags().StringVarP(&flagVaryOutput, "output", "o", "", "output file path")
+	addEncodeFlags(cmd)
+	cmd.Flags().BoolVar(&flagShow, "show", false, "display images in terminal")
+	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key (defaults to OPENAI_API_KEY)")
+	cmd.Flags().BoolVarP(&flagVerbose, "verbose", "v", false, "log HTTP requests and responses")
+
+	return cmd
+}
+
+func runVary(_ *cobra.Command, args []string, app *App) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := checkConflicts(app, args, []conflictCheck{checkEncodeOptions}); err != nil {
+		return err
+	}
+
+	caps, ok := app.Registry.Get(flagVaryModel)
+	if !ok {
+		return fmt.Errorf("unknown model %q: available models: %v", flagVaryModel, app.Registry.List())
+	}
+	if !caps.SupportsVariations {
+		return fmt.Errorf("%w: %s (use dall-e-2)", models.ErrVariationsNotSupported, flagVaryModel)
+	}
+
+	imageData, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read image: %w", err)
+	}
+
+	req := models.NewVariationRequest(imageData)
+	req.Model = flagVaryModel
+	req.Count = flagVaryCount
+	req.Size = caps.ResolveSize(flagVarySize)
+	if req.Size == "" {
+		req.Size = caps.DefaultSize
+	}
+
+	if err := req.Validate(); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	if req.Count > caps.MaxImages {
+		return fmt.Errorf("invalid request: %w: max %d, got %d", models.ErrCountExceedsMax, caps.MaxImages, req.Count)
+	}
+	if !slices.Contains(caps.SupportedSizes, req.Size) {
+		return fmt.Errorf("invalid request: %w", caps.SizeError(req.Size))
+	}
+
+	apiKey, err := apiKeyForProvider(caps.Provider)
+	if err != nil {
+		return err
+	}
+
+	prov, err := app.NewProvider(newProviderConfig(caps.Provider, apiKey), app.Registry)
+	if err != nil {
+		return fmt.Errorf("failed to create provider: %w", err)
+	}
+
+	varyProv, ok := prov.(provider.VariationProvider)
+	if !ok {
+		return fmt.Errorf("%w: %s", models.ErrVariationsNotSupported, req.Model)
+	}
+
+	thr, err := newThrottle()
+	if err != nil {
+		return err
+	}
+	if err := thr.Wait(ctx); err != nil {
+		return fmt.Errorf("throttle: %w", err)
+	}
+
+	fmt.Fprintf(app.info(), "Generating %d variation(s) with %s...\n", req.Count, req.Model)
+
+	resp, err := varyProv.Variations(ctx, req)
+	if err != nil {
+		return fmt.Errorf("variation failed: %w", err)
+	}
+
+	saver := newSaver(app)
+	paths, err := saver.SaveAll(ctx, resp, flagVaryOutput, outputFormat(flagVaryOutput))
+	for _, path := range paths {
+		fmt.Fprintf(app.Out, "Saved: %s\n", path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if resp.Cost != nil {
+		fmt.Fprintf(app.info(), "Cost: $%.4f (%d image(s) @ $%.4f/image, %s %s)\n",
+			resp.Cost.Total, len(resp.Images), resp.Cost.PerImage, req.Model, req.Size)
+		if err := logGenerationCost(ctx, app, prov, req.Model, resp); err != nil {
+			return err
+		}
+	}
+
+	if flagShow {
+		displayer := newDisplayer(app)
+		if err := displayer.DisplayAll(ctx, resp); err != nil {
+			if err := softFail(app, "failed to display image: %w", err); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Fprintln(app.info(), "Done!")
+	return nil
+}
+
+func newEditCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "edit <image>... <prompt>",
+		Short: "Edit an existing image with a prompt",
+		Long: `Edit an existing image with a prompt, optionally limited to a mask.
+
+The mask is a PNG the same size as the image whose fully transparent
+pixels mark the area to change. gpt-image-1 and dall-e-2 support editing.
+
+--mask-from-alpha builds the mask from the image's own alpha channel
+instead, so an image whose edit area is already transparent needs no
+separate mask.
+
+--auto-resize shrinks inputs larger than the model accepts, keeping their
+aspect ratio, and uploads them as PNG.
+
+gpt-image-1 can combine up to 16 images into one edit: list them all before
+the prompt. A mask applies to the first image.
+
+Examples:
+  imggen edit photo.png "make the sky purple" -o purple.png
+  imggen edit a.png b.png "combine them into one scene" -o out.png
+  imggen edit photo.png --mask sky.png "add a rainbow" -o rainbow.png
+  imggen edit cutout.png --mask-from-alpha "fill the hole with a window"
+  imggen edit logo.png -m dall-e-2 -s 512x512 -n 2 "in neon colors"
+  imggen edit huge-photo.png --auto-resize "add snow"
+  imggen edit photo.jpg --copy-exif "remove the tourists" -o clean.jpg
+  imggen edit photo.png --copy-exif-from original.jpg "warmer light"`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runEdit(cmd, args, app)
+		},
+	}
+
+	cmd.Flags().StringVarP(&flagEditModel, "model", "m", "gpt-image-1", "model to use (gpt-image-1, dall-e-2)")
+	cmd.Flags().StringVar(&flagEditMask, "mask", "", "PNG mask whose transparent pixels mark the area to edit")
+	cmd.Flags().BoolVar(&flagEditAlpha, "mask-from-alpha", false, "use the image's transparent pixels as the mask")
+	cmd.Flags().IntVarP(&flagEditCount, "count", "n", 1, "number of edited images")
+	cmd.Flags().StringVarP(&flagEditSize, "size", "s", "", "image size or alias such as square (defaults to the model's default)")
+	cmd.Flags().StringVarP(&flagEditOutput, "output", "o", "", "output file path")
+	cmd.Flags().BoolVar(&flagEditResize, "auto-resize", false, "downscale the image and mask to fit the model's upload limits")
+	cmd.Flags().BoolVarP(&flagYes, "yes", "y", false, "edit without confirming a cost above --confirm-above")
+	cmd.Flags().BoolVar(&flagEditInEXIF, "copy-exif", false, "copy EXIF metadata from the (first) edit input into the output")
+	cmd.Flags().StringVar(&flagEditEXIF, "copy-exif-from", "", "copy EXIF metadata from this image into the output")
+	addEncodeFlags(cmd)
+	cmd.Flags().BoolVar(&flagShow, "show", false, "display images in terminal")
+	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key (defaults to OPENAI_API_KEY)")
+	cmd.Flags().BoolVarP(&flagVerbose, "verbose", "v", false, "log HTTP requests and responses")
+
+	return cmd
+}
+
+// editConflicts are the flag combinations the edit command rejects.
+var editConflicts = []conflictCheck{
+	checkEncodeOptions,
+	func(*App, []string) error {
+		if flagEditAlpha && flagEditMask != "" {
+			return fmt.Errorf("--mask-from-alpha cannot be used with --mask")
+		}
+		return nil
+	},
+	func(*App, []string) error {
+		if flagEditInEXIF && flagEditEXIF != "" {
+			return fmt.Errorf("--copy-exif cannot be used with --copy-exif-from")
+		}
+		return nil
+	},
+}
+
+func runEdit(_ *cobra.Command, args []string, app *App) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := checkConflicts(app, args, editConflicts); err != nil {
+		return err
+	}
+
+	model, err := app.Registry.Resolve(flagEditModel)
+	if err != nil {
+		return err
+	}
+	caps, ok := app.Registry.Get(model)
+	if !ok {
+		return fmt.Errorf("unknown model %q: available models: %v", model, app.Registry.List())
+	}
+	if !caps.SupportsEdit {
+		return fmt.Errorf("%w: %s (use gpt-image-1 or dall-e-2)", models.ErrEditNotSupported, model)
+	}
+
+	inputs, prompt := args[:len(args)-1], args[len(args)-1]
+	if limit := caps.EditImageLimit(); len(inputs) > limit {
+		return fmt.Errorf("%w: %s combines at most %d, got %d", models.ErrTooManyEditImages, model, limit, len(inputs))
+	}
+	images := make([][]byte, len(inputs))
+	for i, input := range inputs {
+		if images[i], err = os.ReadFile(input); err != nil {
+			return fmt.Errorf("failed to read image: %w", err)
+		}
+	}
+	imageData := images[0]
+
+	req := models.NewMultiImageEditRequest(images, prompt)
+	req.Model = model
+	req.Count = flagEditCount
+	req.Format = outputFormat(flagEditOutput)
+	req.Size = caps.ResolveSize(flagEditSize)
+	if req.Size == "" {
+		req.Size = caps.DefaultSize
+	}
+	if flagEditMask != "" {
+		req.Mask, err = os.ReadFile(flagEditMask)
+		if err != nil {
+			return fmt.Errorf("failed to read mask: %w", err)
+		}
+	}
+	if flagEditAlpha {
+		req.Mask, err = image.MaskFromAlpha(imageData)
+		if err != nil {
+			return fmt.Errorf("--mask-from-alpha: %w", err)
+		}
+	}
+	var exif []byte
+	if flagEditInEXIF || flagEditEXIF != "" {
+		if exif, err = readEXIFSource(app, flagEditEXIF, args[0], imageData); err != nil {
+			return err
+		}
+	}
+
+	if flagEditResize {
+		maxDim := maxSizeDimension(caps.SupportedSizes)
+		maxBytes := int(openai.EditInputLimits(model).MaxBytes)
+		for i := range req.Images {
+			name := "image"
+			if len(req.Images) > 1 {
+				name = inputs[i]
+			}
+			if req.Images[i], err = fitEditInput(app, name, req.Images[i], maxDim, maxBytes); err != nil {
+				return err
+			}
+		}
+		req.Image = req.Images[0]
+		if len(req.Mask) > 0 {
+			if req.Mask, err = fitEditMask(app, req.Mask, req.Image); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := req.Validate(); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	if req.Count < 1 {
+		return fmt.Errorf("invalid request: %w", models.ErrInvalidCount)
+	}
+	if req.Count > caps.MaxImages {
+		return fmt.Errorf("invalid request: %w: max %d, got %d", models.ErrCountExceedsMax, caps.MaxImages, req.Count)
+	}
+	if !slices.Contains(caps.SupportedSizes, req.Size) {
+		return fmt.Errorf("invalid request: %w", caps.SizeError(req.Size))
+	}
+
+	// Edits take no quality setting, so they are priced at the model's
+	// default.
+	if !confirmCost(app, calculator().Estimate(req.Model, req.Size, caps.DefaultQuality, req.Count).Total, flagYes) {
+		fmt.Fprintln(app.Out, "Aborted.")
+		return nil
+	}
+
+	apiKey, err := apiKeyForProvider(caps.Provider)
+	if err != nil {
+		return err
+	}
+
+	prov, err := app.NewProvider(newProviderConfig(caps.Provider, apiKey), app.Registry)
+	if err != nil {
+		return fmt.Errorf("failed to create provider: %w", err)
+	}
+	if !prov.SupportsEdit(req.Model) {
+		return fmt.Errorf("%w: %s", models.ErrEditNotSupported, req.Model)
+	}
+
+	eventLog, err := newEventLogger()
+	if err != nil {
+		return err
+	}
+
+	thr, err := newThrottle()
+	if err != nil {
+		return err
+	}
+	if err := thr.Wait(ctx); err != nil {
+		return fmt.Errorf("throttle: %w", err)
+	}
+
+	fmt.Fprintf(app.info(), "Editing %s with %s...\n", strings.Join(inputs, ", "), req.Model)
+
+	start := time.Now()
+	resp, err := prov.Edit(ctx, req)
+	var costInfo *models.CostInfo
+	if resp != nil {
+		costInfo = resp.Cost
+	}
+	eventLog.Record(app.warn(), events.Event{Op: events.OpEdit, Model: req.Model, Size: req.Size}, req.Prompt, costInfo, start, err)
+	if err != nil {
+		return fmt.Errorf("edit failed: %w", err)
+	}
+
+	saver := newSaver(app)
+	paths, err := saver.SaveAll(ctx, resp, flagEditOutput, req.Format)
+	for _, path := range paths {
+		fmt.Fprintf(app.Out, "Saved: %s\n", path)
+	}
+	if err != nil {
+		return err
+	}
+	if exif != nil {
+		for _, path := range paths {
+			if err := copyEXIF(path, exif); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(app.info(), "Copied EXIF metadata to %d image(s)\n", len(paths))
+	}
+
+	if resp.Cost != nil {
+		fmt.Fprintf(app.info(), "Cost: $%.4f (%d image(s) @ $%.4f/image, %s %s)\n",
+			resp.Cost.Total, len(resp.Images), resp.Cost.PerImage, req.Model, req.Size)
+		if err := logGenerationCost(ctx, app, prov, req.Model, resp); err != nil {
+			return err
+		}
+	}
+	printTiming(app, resp)
+
+	if flagShow {
+		displayer := newDisplayer(app)
+		if err := displayer.DisplayAll(ctx, resp); err != nil {
+			if err := softFail(app, "failed to display image: %w", err); err != nil {
+				return err
+			}
+		}
+	}
+
+	if resp.RevisedPrompt != "" {
+		fmt.Fprintf(app.info(), "Revised prompt: %s\n", resp.RevisedPrompt)
+	}
+
+	fmt.Fprintln(app.info(), "Done!")
+	return nil
+}
+
+// readEXIFSource reads the EXIF metadata to copy for --copy-exif-from from
+// source, or for --copy-exif from the edit input when source is empty. It
+// returns nil, noting it on app.Out, when the source has none.
+func readEXIFSource(app *App, source, input string, inputData []byte) ([]byte, error) {
+	data := inputData
+	if source == "" {
+		source = input
+	} else {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, fmt.Errorf("failed to read --copy-exif-from image: %w", err)
+		}
+	}
+	exif, err := image.ReadEXIF(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EXIF from %s: %w", source, err)
+	}
+	if exif == nil {
+		fmt.Fprintf(app.info(), "No EXIF metadata in %s; nothing to copy\n", source)
+	}
+	return exif, nil
+}
+
+// copyEXIF embeds exif in the saved image at path.
+func copyEXIF(path string, exif []byte) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	data, err = image.WriteEXIF(data, exif)
+	if err != nil {
+		return fmt.Errorf("failed to copy EXIF to %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// fitEditInput downscales an edit input to the given limits for
+// --auto-resize, noting on app.Out when it had to.
+func fitEditInput(app *App, input string, data []byte, maxDim, maxBytes int) ([]byte, error) {
+	fitted, err := image.FitToLimit(data, maxDim, maxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resize %s: %w", input, err)
+	}
+	if !bytes.Equal(fitted, data) {
+		fmt.Fprintf(app.info(), "Resized %s to fit model limits (%d -> %d bytes)\n", input, len(data), len(fitted))
+	}
+	return fitted, nil
+}
+
+// fitEditMask resizes mask to the exact dimensions of the already fitted
+// image. Fitting the two separately can leave them different sizes, since
+// the image may be shrunk further to meet the byte limit, and the API
+// rejects a mask that does not match its image.
+func fitEditMask(app *App, mask, img []byte) ([]byte, error) {
+	fitted, err := image.MatchSize(mask, img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resize mask: %w", err)
+	}
+	if !bytes.Equal(fitted, mask) {
+		fmt.Fprintln(app.info(), "Resized mask to match the image")
+	}
+	return fitted, nil
+}
+
+// maxSizeDimension returns the longest side among sizes written as WxH,
+// ignoring entries such as "auto".
+func maxSizeDimension(sizes []string) int {
+	var longest int
+	for _, size := range sizes {
+		var w, h int
+		if _, err := fmt.Sscanf(size, "%dx%d", &w, &h); err == nil {
+			longest = max(longest, w, h)
+		}
+	}
+	return longest
+}
+
+// Keys command
+
+func newKeysCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage API keys",
+		Long: `Manage API keys for image generation providers.
+
+Keys are stored securely in a local configuration file and are used
+automatically when generating images. This is useful for CLI tools
+that don't pass environment variables (like Codex CLI).
+
+Key lookup order:
+  1. --api-key flag (highest priority)
+  2. Stored key in keys.json
+  3. OPENAI_API_KEY environment variable
+
+Examples:
+  imggen keys set              # Save your OpenAI API key
+  imggen keys                  # List stored keys
+  imggen keys path             # Show keys.json location
+  imggen keys delete           # Remove stored key
+  imggen keys which            # Show which key would be used`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeysList(app)
+		},
+	}
+
+	cmd.AddCommand(newKeysSetCmd(app))
+	cmd.AddCommand(newKeysPathCmd(app))
+	cmd.AddCommand(newKeysDeleteCmd(app))
+	cmd.AddCommand(newKeysMigrateCmd(app))
+	cmd.AddCommand(newKeysWhichCmd(app))
+
+	return cmd
+}
+
+func newKeysSetCmd(app *App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "set",
+		Short: "Save an API key",
+		Long: `Save an API key for OpenAI.
+
+The key will be stored in a local configuration file and used
+automatically when generating images. This is an alternative to
+setting the OPENAI_API_KEY environment variable.
+
+Example:
+  imggen keys set`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeysSet(app)
+		},
+	}
+}
+
+func newKeysPathCmd(app *App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "path",
+		Short: "Show the keys.json file location",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeysPath(app)
+		},
+	}
+}
+
+func newKeysDeleteCmd(app *App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete",
+		Short: "Delete a stored API key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeysDelete(app)
+		},
 	}
+}
 
-	if allFlag {
-		integrations = register.AllIntegrations()
-	} else if len(args) == 0 {
-		// Show help if no integrations specified
-		fmt.Fprintln(app.Out, "Available integrations:")
-		for _, i := range register.AllIntegrations() {
-			registered, _, _ := registrar.Status(i)
-			status := "not registered"
-			if registered {
-				status = "registered"
-			}
-			fmt.Fprintf(app.Out, "  %-8s  %s (%s)\n", i, i.Description(), status)
-		}
-		fmt.Fprintln(app.Out, "\nUsage:")
-		fmt.Fprintln(app.Out, "  imggen register --all           # Register with all integrations")
-		fmt.Fprintln(app.Out, "  imggen register claude codex    # Register with specific integrations")
-		fmt.Fprintln(app.Out, "  imggen register status          # Show detailed status")
-		fmt.Fprintln(app.Out, "\nUse 'imggen register --help' for more options.")
-		return nil
-	} else {
-		for _, arg := range args {
-			i := register.Integration(arg)
-			valid := false
-			for _, all := range register.AllIntegrations() {
-				if i == all {
-					valid = true
-					break
-				}
-			}
-			if !valid {
-				return fmt.Errorf("unknown integration %q: valid options are %v", arg, register.AllIntegrations())
-			}
-			integrations = append(integrations, i)
-		}
+func newKeysMigrateCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Move a stored API key to another backend",
+		Long: `Move the OpenAI API key from one storage backend to another.
+
+The key is read from the source backend (or OPENAI_API_KEY when the
+source has none), written to the target, and read back to verify it.
+You are then asked whether to remove the plaintext source entry.
+
+Backends: file (keys.json). Keychain and encrypted storage are not
+supported in this build; naming them reports an error and moves nothing.
+
+Example:
+  imggen keys migrate --from file --to <backend>`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeysMigrate(app)
+		},
 	}
 
-	if flagRegisterDryRun {
-		fmt.Fprintln(app.Out, "DRY RUN - no changes will be made")
+	cmd.Flags().StringVar(&flagKeysMigrateFrom, "from", "file", "Backend to read the key from")
+	cmd.Flags().StringVar(&flagKeysMigrateTo, "to", "", "Backend to move the key to (required)")
+	cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+// openKeyBackend is a variable so tests can substitute fake backends.
+var openKeyBackend = keys.OpenBackend
+
+func runKeysMigrate(app *App) error {
+	if flagKeysMigrateFrom == flagKeysMigrateTo {
+		return fmt.Errorf("--from and --to must be different backends")
 	}
 
-	results := registrar.Register(integrations)
+	from, err := openKeyBackend(flagKeysMigrateFrom)
+	if err != nil {
+		return err
+	}
+	to, err := openKeyBackend(flagKeysMigrateTo)
+	if err != nil {
+		return err
+	}
 
-	// Summary
-	fmt.Fprintln(app.Out, "\nSummary:")
-	var succeeded, skipped, failed int
-	for _, r := range results {
-		if r.Error != nil {
-			fmt.Fprintf(app.Out, "  ✗ %s: %v\n", r.Integration.DisplayName(), r.Error)
-			failed++
-		} else if r.WasSkipped {
-			fmt.Fprintf(app.Out, "  - %s: %s\n", r.Integration.DisplayName(), r.SkipReason)
-			skipped++
-		} else {
-			fmt.Fprintf(app.Out, "  ✓ %s: %s\n", r.Integration.DisplayName(), r.ConfigPath)
-			succeeded++
-		}
+	provider := "openai"
+	m, err := keys.Migrate(provider, from, "OPENAI_API_KEY", to)
+	if err != nil {
+		return err
 	}
 
-	fmt.Fprintf(app.Out, "\n%d succeeded, %d skipped, %d failed\n", succeeded, skipped, failed)
+	fmt.Fprintf(app.Out, "Moved key for %s: %s -> %s (%s)\n", provider, m.Source, m.Target, keys.MaskKey(m.Key))
+	fmt.Fprintf(app.Out, "Verified: %s returns the same key\n", m.Target)
 
-	if failed > 0 {
-		return fmt.Errorf("%d registration(s) failed", failed)
+	if m.FromEnv {
+		fmt.Fprintln(app.Out, "The key came from the environment; unset OPENAI_API_KEY to stop using it.")
+		return nil
 	}
 
+	if !confirm(app, fmt.Sprintf("Remove the key from %s?", m.Source)) {
+		fmt.Fprintf(app.Out, "Kept the key in %s.\n", m.Source)
+		return nil
+	}
+	if err := from.Delete(provider); err != nil {
+		return fmt.Errorf("failed to remove key from %s: %w", m.Source, err)
+	}
+	fmt.Fprintf(app.Out, "Removed key from %s\n", m.Source)
 	return nil
 }
 
-func runRegisterStatus(app *App) error {
-	registrar := register.NewRegistrar(app.Out, app.Err, os.Stdin)
+func newKeysWhichCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "which",
+		Short: "Show which API key would be used and where it comes from",
+		Long: `Resolve the API key the same way generation does and report its
+source (flag, stored key, or environment) with a masked value.
 
-	fmt.Fprintln(app.Out, "Registration Status:")
-	fmt.Fprintln(app.Out, "")
+Examples:
+  imggen keys which
+  imggen keys which --provider stability`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeysWhich(app)
+		},
+	}
 
-	for _, i := range register.AllIntegrations() {
-		registered, configPath, err := registrar.Status(i)
-		if err != nil {
-			fmt.Fprintf(app.Out, "%-15s  Error: %v\n", i.DisplayName(), err)
-			continue
-		}
+	cmd.Flags().StringVar(&flagKeysWhichProvider, "provider", "openai", "provider to resolve the key for (openai, stability)")
+	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key, to check that the flag takes precedence")
 
-		status := "✗ Not registered"
-		if registered {
-			status = "✓ Registered"
-		}
+	return cmd
+}
 
-		fmt.Fprintf(app.Out, "%-15s  %s\n", i.DisplayName(), status)
-		fmt.Fprintf(app.Out, "                 %s\n", configPath)
+func runKeysWhich(app *App) error {
+	providerType := models.ProviderType(flagKeysWhichProvider)
+	if providerType != models.ProviderOpenAI && providerType != models.ProviderStability {
+		return fmt.Errorf("unknown provider %q: must be openai or stability", flagKeysWhichProvider)
+	}
 
-		// List backups
-		backups, _ := registrar.ListBackups(i)
-		if len(backups) > 0 {
-			fmt.Fprintf(app.Out, "                 Backups: %d\n", len(backups))
-		}
+	key, source, err := keys.GetAPIKey(flagAPIKey, string(providerType), apiKeyEnvVar(providerType))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(app.Out, "Provider: %s\n", providerType)
+	fmt.Fprintf(app.Out, "Source:   %s\n", source)
+	fmt.Fprintf(app.Out, "Key:      %s\n", keys.MaskKey(key))
+	return nil
+}
+
+func runKeysList(app *App) error {
+	store, err := keys.NewStore()
+	if err != nil {
+		return err
+	}
+
+	providers, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	if len(providers) == 0 {
+		fmt.Fprintln(app.Out, "No API keys stored.")
 		fmt.Fprintln(app.Out, "")
+		fmt.Fprintln(app.Out, "To save a key:")
+		fmt.Fprintln(app.Out, "  imggen keys set")
+		return nil
+	}
+
+	fmt.Fprintln(app.Out, "Stored API keys:")
+	fmt.Fprintln(app.Out, "")
+	for _, provider := range providers {
+		key, _ := store.Get(provider)
+		fmt.Fprintf(app.Out, "  %-10s  %s\n", provider, keys.MaskKey(key))
 	}
+	fmt.Fprintln(app.Out, "")
+	fmt.Fprintf(app.Out, "Keys file: %s\n", store.Path())
 
 	return nil
 }
 
-func runUnregister(app *App, args []string) error {
-	registrar := register.NewRegistrar(app.Out, app.Err, os.Stdin)
-	registrar.DryRun = flagRegisterDryRun
+func runKeysSet(app *App) error {
+	store, err := keys.NewStore()
+	if err != nil {
+		return err
+	}
 
-	for _, arg := range args {
-		i := register.Integration(arg)
-		valid := false
-		for _, all := range register.AllIntegrations() {
-			if i == all {
-				valid = true
-				break
-			}
-		}
-		if !valid {
-			return fmt.Errorf("unknown integration %q", arg)
+	provider := "openai"
+	envVar := "OPENAI_API_KEY"
+
+	// Check if key already exists in store
+	existing, _ := store.Get(provider)
+	if existing != "" {
+		fmt.Fprintf(app.Out, "Existing key for %s: %s\n", provider, keys.MaskKey(existing))
+		fmt.Fprint(app.Out, "Replace it? [y/N] ")
+
+		reader := bufio.NewReader(os.Stdin)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+		if response != "y" && response != "yes" {
+			fmt.Fprintln(app.Out, "Cancelled.")
+			return nil
 		}
+	}
 
-		if err := registrar.Unregister(i); err != nil {
-			return err
+	// Check if key exists in environment variable
+	var key string
+	if envKey := os.Getenv(envVar); envKey != "" {
+		fmt.Fprintf(app.Out, "Found %s in environment: %s\n", envVar, keys.MaskKey(envKey))
+		fmt.Fprint(app.Out, "Import this key? [Y/n] ")
+
+		reader := bufio.NewReader(os.Stdin)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+		if response == "" || response == "y" || response == "yes" {
+			key = envKey
 		}
 	}
 
-	return nil
-}
+	// If not imported from env, prompt for key
+	if key == "" {
+		fmt.Fprintf(app.Out, "Enter API key for %s: ", provider)
 
-func runListBackups(app *App, integration string) error {
-	registrar := register.NewRegistrar(app.Out, app.Err, os.Stdin)
+		// Read key (hide input if terminal)
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			keyBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+			if err != nil {
+				return fmt.Errorf("failed to read key: %w", err)
+			}
+			key = string(keyBytes)
+			fmt.Fprintln(app.Out, "") // newline after hidden input
+		} else {
+			reader := bufio.NewReader(os.Stdin)
+			key, _ = reader.ReadString('\n')
+		}
 
-	i := register.Integration(integration)
-	valid := false
-	for _, all := range register.AllIntegrations() {
-		if i == all {
-			valid = true
-			break
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return fmt.Errorf("no key provided")
 		}
 	}
-	if !valid {
-		return fmt.Errorf("unknown integration %q", integration)
+
+	if err := store.Set(provider, key); err != nil {
+		return err
 	}
 
-	backups, err := registrar.ListBackups(i)
+	fmt.Fprintf(app.Out, "Saved key for %s: %s\n", provider, keys.MaskKey(key))
+	fmt.Fprintf(app.Out, "Keys file: %s\n", store.Path())
+
+	return nil
+}
+
+func runKeysPath(app *App) error {
+	store, err := keys.NewStore()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(app.Out, store.Path())
+	return nil
+}
+
+func runKeysDelete(app *App) error {
+	store, err := keys.NewStore()
 	if err != nil {
 		return err
 	}
 
-	if len(backups) == 0 {
-		fmt.Fprintf(app.Out, "No backups found for %s\n", i.DisplayName())
+	provider := "openai"
+
+	// Check if key exists
+	existing, _ := store.Get(provider)
+	if existing == "" {
+		fmt.Fprintf(app.Out, "No key stored for %s\n", provider)
 		return nil
 	}
 
-	fmt.Fprintf(app.Out, "Backups for %s:\n", i.DisplayName())
-	for _, b := range backups {
-		info, err := os.Stat(b)
-		if err != nil {
-			fmt.Fprintf(app.Out, "  %s\n", b)
-		} else {
-			fmt.Fprintf(app.Out, "  %s (%s)\n", b, info.ModTime().Format("2006-01-02 15:04:05"))
-		}
+	fmt.Fprintf(app.Out, "Delete key for %s? (%s) [y/N] ", provider, keys.MaskKey(existing))
+
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+	if response != "y" && response != "yes" {
+		fmt.Fprintln(app.Out, "Cancelled.")
+		return nil
 	}
 
-	fmt.Fprintln(app.Out, "\nTo restore a backup:")
-	fmt.Fprintln(app.Out, "  imggen register rollback <backup-path>")
+	if err := store.Delete(provider); err != nil {
+		return err
+	}
 
+	fmt.Fprintf(app.Out, "Deleted key for %s\n", provider)
 	return nil
 }
 
-func runRollback(app *App, backupPath string) error {
-	registrar := register.NewRegistrar(app.Out, app.Err, os.Stdin)
-	return registrar.Rollback(backupPath)
-}
-
-// OCR command
+// Config command
 
-func newOCRCmd(app *App) *cobra.Command {
+func newConfigCmd(app *App) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "ocr <image-path>",
-		Short: "Extract text from images using OCR",
-		Long: `Extract text from images using OpenAI's vision API.
+		Use:   "config",
+		Short: "Manage default settings",
+		Long: `Manage default settings stored in ~/.imggen/config.yaml.
 
-Supports structured output with JSON schemas. If no schema is provided,
-you can use --suggest-schema to have the AI suggest an appropriate schema.
+The config file sets defaults for model, size, quality, format, output
+directory, and parallelism used by generation and batch commands.
 
-Input:
-  Provide an image file path as argument, or use --url for remote images.
+Setting precedence:
+  1. Command-line flags (highest priority)
+  2. The selected profile in ~/.imggen/config.yaml
+  3. The rest of ~/.imggen/config.yaml
+  4. Built-in defaults
 
-Output:
-  By default, outputs plain text. Use --schema for structured JSON output.
+The output directory applies to batch and --prompt runs, where -o names a
+directory.
+
+Profiles are named groups of settings under "profiles:" in config.yaml,
+selected with --config-profile or the IMGGEN_PROFILE environment variable:
+
+  model: gpt-image-1
+  profiles:
+    work:
+      quality: medium
+      output: ~/work/images
+    art:
+      model: dall-e-3
+      quality: hd
+
+"config get" and "config set" read and write the base settings.
 
 Examples:
-  imggen ocr image.png                              # Extract text from image
-  imggen ocr --url https://example.com/image.png    # Extract from URL
-  imggen ocr image.png --schema schema.json         # Structured output
-  imggen ocr image.png --suggest-schema             # Suggest a JSON schema
-  imggen ocr image.png -o output.txt                # Save to file
-  imggen ocr receipt.jpg --schema invoice.json -o data.json`,
-		Args: func(cmd *cobra.Command, args []string) error {
-			if flagOCRURL != "" {
-				return nil
-			}
-			return cobra.ExactArgs(1)(cmd, args)
-		},
+  imggen config                    # List settings
+  imggen config set model dall-e-3 # Use dall-e-3 unless -m is given
+  imggen config set quality hd
+  imggen config get model
+  imggen config set quality ""     # Clear a setting
+  imggen config path               # Show config.yaml location`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runOCR(cmd, args, app)
+			return runConfigList(app)
 		},
 	}
 
-	cmd.Flags().StringVarP(&flagOCRModel, "model", "m", "gpt-5-mini", "model to use (gpt-5.2, gpt-5-mini, gpt-5-nano)")
-	cmd.Flags().StringVarP(&flagOCRSchema, "schema", "s", "", "JSON schema file for structured output")
-	cmd.Flags().StringVar(&flagOCRSchemaName, "schema-name", "", "name for the JSON schema (default: extracted_data)")
-	cmd.Flags().BoolVar(&flagOCRSuggestSchema, "suggest-schema", false, "suggest a JSON schema based on image content")
-	cmd.Flags().StringVarP(&flagOCRPrompt, "prompt", "p", "", "custom extraction prompt")
-	cmd.Flags().StringVarP(&flagOCROutput, "output", "o", "", "output file (default: stdout)")
-	cmd.Flags().StringVar(&flagOCRURL, "url", "", "image URL instead of file path")
-	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key (defaults to OPENAI_API_KEY)")
-	cmd.Flags().BoolVarP(&flagVerbose, "verbose", "v", false, "log HTTP requests and responses")
+	cmd.AddCommand(newConfigGetCmd(app))
+	cmd.AddCommand(newConfigSetCmd(app))
+	cmd.AddCommand(newConfigPathCmd(app))
 
 	return cmd
 }
 
-func runOCR(_ *cobra.Command, args []string, app *App) error {
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
-
-	apiKey, _, err := keys.GetAPIKey(flagAPIKey, "openai", "OPENAI_API_KEY")
-	if err != nil {
-		return err
-	}
-
-	providerCfg := &provider.Config{APIKey: apiKey, Verbose: flagVerbose}
-	prov, err := app.NewProvider(providerCfg, app.Registry)
-	if err != nil {
-		return fmt.Errorf("failed to create provider: %w", err)
-	}
-
-	ocrProv, ok := prov.(interface {
-		OCR(ctx context.Context, req *models.OCRRequest) (*models.OCRResponse, error)
-		SuggestSchema(ctx context.Context, req *models.OCRRequest) (json.RawMessage, error)
-	})
-	if !ok {
-		return fmt.Errorf("provider does not support OCR")
-	}
-
-	req := models.NewOCRRequest()
-	req.Model = flagOCRModel
-	req.Prompt = flagOCRPrompt
-
-	if flagOCRURL != "" {
-		req.ImageURL = flagOCRURL
-	} else if len(args) > 0 {
-		req.ImagePath = args[0]
-		if _, err := os.Stat(req.ImagePath); os.IsNotExist(err) {
-			return fmt.Errorf("image file not found: %s", req.ImagePath)
-		}
+func newConfigGetCmd(app *App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print a setting",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigGet(app, args[0])
+		},
 	}
+}
 
-	// Load schema if provided
-	if flagOCRSchema != "" {
-		schemaData, err := os.ReadFile(flagOCRSchema)
-		if err != nil {
-			return fmt.Errorf("failed to read schema file: %w", err)
-		}
-		req.Schema = schemaData
-		req.SchemaName = flagOCRSchemaName
+func newConfigSetCmd(app *App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Save a setting (an empty value clears it)",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigSet(app, args[0], args[1])
+		},
 	}
+}
 
-	// Suggest schema mode
-	if flagOCRSuggestSchema {
-		fmt.Fprintln(app.Out, "Analyzing image to suggest JSON schema...")
-		schema, err := ocrProv.SuggestSchema(ctx, req)
-		if err != nil {
-			return fmt.Errorf("failed to suggest schema: %w", err)
-		}
-
-		// Pretty print the schema
-		var prettySchema bytes.Buffer
-		if err := json.Indent(&prettySchema, schema, "", "  "); err != nil {
-			fmt.Fprintln(app.Out, string(schema))
-		} else {
-			fmt.Fprintln(app.Out, prettySchema.String())
-		}
-
-		// Save to file if output specified
-		if flagOCROutput != "" {
-			if err := os.WriteFile(flagOCROutput, prettySchema.Bytes(), 0644); err != nil {
-				return fmt.Errorf("failed to write schema file: %w", err)
-			}
-			fmt.Fprintf(app.Out, "\nSchema saved to: %s\n", flagOCROutput)
-		}
-
-		return nil
+func newConfigPathCmd(app *App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "path",
+		Short: "Show the config.yaml file location",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigPath(app)
+		},
 	}
+}
 
-	// Regular OCR extraction
-	source := req.ImagePath
-	if source == "" {
-		source = req.ImageURL
+func runConfigList(app *App) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
 	}
-	fmt.Fprintf(app.Out, "Extracting text from %s using %s...\n", source, req.Model)
-
-	resp, err := ocrProv.OCR(ctx, req)
+	path, err := config.Path()
 	if err != nil {
-		return fmt.Errorf("OCR failed: %w", err)
+		return err
 	}
 
-	var output string
-	if len(resp.Structured) > 0 {
-		var prettyJSON bytes.Buffer
-		if err := json.Indent(&prettyJSON, resp.Structured, "", "  "); err != nil {
-			output = string(resp.Structured)
-		} else {
-			output = prettyJSON.String()
+	for _, key := range config.Keys() {
+		value, _ := cfg.Get(key)
+		if value == "" {
+			value = "(not set)"
 		}
-	} else {
-		output = resp.Text
+		fmt.Fprintf(app.Out, "  %-10s  %s\n", key, value)
 	}
-
-	// Write output
-	if flagOCROutput != "" {
-		if err := os.WriteFile(flagOCROutput, []byte(output), 0644); err != nil {
-			return fmt.Errorf("failed to write output file: %w", err)
-		}
-		fmt.Fprintf(app.Out, "Output saved to: %s\n", flagOCROutput)
-	} else {
-		fmt.Fprintln(app.Out, "")
-		fmt.Fprintln(app.Out, output)
+	if len(cfg.Aliases) > 0 {
+		fmt.Fprintf(app.Out, "  %-10s  %d defined\n", "aliases", len(cfg.Aliases))
 	}
-
-	// Show cost info
-	if resp.Cost != nil {
-		fmt.Fprintf(app.Out, "\nCost: $%.6f (input: %d tokens, output: %d tokens)\n",
-			resp.Cost.Total, resp.InputTokens, resp.OutputTokens)
-
-		// Log cost to database
-		store, err := session.NewStore()
-		if err == nil {
-			defer store.Close()
-			costEntry := &session.CostEntry{
-				IterationID: "",
-				SessionID:   "",
-				Provider:    "openai",
-				Model:       req.Model,
-				Cost:        resp.Cost.Total,
-				ImageCount:  1,
-				Timestamp:   time.Now(),
-			}
-			if logErr := store.LogCost(ctx, costEntry); logErr != nil {
-				fmt.Fprintf(app.Err, "Warning: failed to log cost: %v\n", logErr)
-			}
+	if len(cfg.Profiles) > 0 {
+		fmt.Fprintf(app.Out, "  %-10s  %s\n", "profiles", strings.Join(cfg.ProfileNames(), ", "))
+	}
+	fmt.Fprintln(app.Out, "")
+	fmt.Fprintf(app.Out, "Config file: %s\n", path)
+	if name := configProfile(app); name != "" {
+		if _, ok := cfg.Profiles[name]; !ok {
+			name += " (not defined)"
 		}
+		fmt.Fprintf(app.Out, "Active profile: %s\n", name)
 	}
 
 	return nil
 }
 
-// Video command
-
-func newVideoCmd(app *App) *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "video <prompt>",
-		Short: "Generate videos using AI video generation APIs",
-		Long: `Generate videos using OpenAI's Sora video generation API.
-
-Supported models:
-  - sora-2 (default): Standard quality, up to 12 seconds
-  - sora-2-pro: Higher quality, up to 20 seconds
-
-Examples:
-  imggen video "a cat walking on a beach"
-  imggen video -m sora-2-pro -d 8 "sunset over mountains"
-  imggen video -s 1280x720 -o myvideo.mp4 "dancing robot"`,
-		Args: cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return runVideo(cmd, args, app)
-		},
+func runConfigGet(app *App, key string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
 	}
 
-	cmd.Flags().StringVarP(&flagVideoModel, "model", "m", "sora-2", "model to use (sora-2, sora-2-pro)")
-	cmd.Flags().IntVarP(&flagVideoDuration, "duration", "d", 0, "video duration in seconds (default: model default)")
-	cmd.Flags().StringVarP(&flagVideoSize, "size", "s", "", "video size (e.g., 1280x720)")
-	cmd.Flags().StringVarP(&flagVideoOutput, "output", "o", "", "output filename")
-	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key (defaults to OPENAI_API_KEY)")
-	cmd.Flags().BoolVarP(&flagVerbose, "verbose", "v", false, "log HTTP requests and responses")
-
-	return cmd
+	value, err := cfg.Get(key)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(app.Out, value)
+	return nil
 }
 
-func runVideo(_ *cobra.Command, args []string, app *App) error {
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
-
-	// Get API key using priority: --api-key flag > stored key > env var
-	apiKey, _, err := keys.GetAPIKey(flagAPIKey, "openai", "OPENAI_API_KEY")
+func runConfigSet(app *App, key, value string) error {
+	cfg, err := config.Load()
 	if err != nil {
 		return err
 	}
 
-	prompt := args[0]
-
-	req := models.NewVideoRequest(prompt)
-	req.Model = flagVideoModel
-	req.Duration = flagVideoDuration
-	req.Size = flagVideoSize
-
-	caps, ok := app.Registry.GetVideo(flagVideoModel)
-	if !ok {
-		return fmt.Errorf("unknown video model %q: available models: %v", flagVideoModel, app.Registry.ListVideoModels())
+	if key == "model" && value != "" {
+		model, err := app.Registry.Resolve(value)
+		if err != nil {
+			return err
+		}
+		value = model
 	}
 
-	caps.ApplyDefaults(req)
+	if err := cfg.Set(key, value); err != nil {
+		return err
+	}
+	if err := config.Save(cfg); err != nil {
+		return err
+	}
 
-	if err := caps.Validate(req); err != nil {
-		return fmt.Errorf("invalid request: %w", err)
+	if value == "" {
+		fmt.Fprintf(app.Out, "Cleared %s\n", key)
+	} else {
+		fmt.Fprintf(app.Out, "Set %s = %s\n", key, value)
 	}
+	return nil
+}
 
-	providerCfg := &provider.Config{APIKey: apiKey, Verbose: flagVerbose}
-	prov, err := app.NewProvider(providerCfg, app.Registry)
+func runConfigPath(app *App) error {
+	path, err := config.Path()
 	if err != nil {
-		return fmt.Errorf("failed to create provider: %w", err)
+		return err
 	}
 
-	videoProv, ok := prov.(provider.VideoProvider)
-	if !ok {
-		return fmt.Errorf("provider does not support video generation")
-	}
+	fmt.Fprintln(app.Out, path)
+	return nil
+}
 
-	fmt.Fprintf(app.Out, "Generating video with %s (%d seconds)...\n", req.Model, req.Duration)
+func newCacheCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Show or clear the local image cache",
+		Long: `Show the location and size of the image cache used by --cache.
 
-	resp, err := videoProv.GenerateVideo(ctx, req)
-	if err != nil {
-		return fmt.Errorf("video generation failed: %w", err)
+With --cache, generation and batch runs store each result in ~/.imggen/cache,
+keyed by model, prompt, size, quality, style, transparency, seed, count, and
+format. Repeating an identical request returns the stored images without
+calling the API and logs a $0 cost entry marked as a cache hit. Once the
+cache grows past --cache-max-mb, the least recently used entries are removed.
+
+Examples:
+  imggen --cache "a lighthouse at dusk"   # Calls the API and caches the result
+  imggen --cache "a lighthouse at dusk"   # Served from the cache
+  imggen cache                            # Show cache size
+  imggen cache clear                      # Remove all cached images`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheInfo(app)
+		},
 	}
 
-	saver := app.NewSaver()
+	cmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Remove all cached images",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheClear(app)
+		},
+	})
 
-	// Determine output path
-	outputPath := flagVideoOutput
-	if outputPath == "" {
-		outputPath = image.GenerateVideoFilename(0)
-	}
+	return cmd
+}
 
-	if len(resp.Videos) > 0 {
-		if err := saver.SaveVideo(ctx, &resp.Videos[0], outputPath); err != nil {
-			return fmt.Errorf("failed to save video: %w", err)
-		}
-		fmt.Fprintf(app.Out, "Saved: %s\n", outputPath)
+func runCacheInfo(app *App) error {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return err
 	}
-
-	if resp.Cost != nil {
-		fmt.Fprintf(app.Out, "Cost: $%.4f (%d seconds @ $%.4f/second, %s)\n",
-			resp.Cost.Total, req.Duration, resp.Cost.PerImage, req.Model)
-
-		// Log cost to database
-		store, err := session.NewStore()
-		if err == nil {
-			defer store.Close()
-			costEntry := &session.CostEntry{
-				IterationID: "",
-				SessionID:   "",
-				Provider:    string(prov.Name()),
-				Model:       req.Model,
-				Cost:        resp.Cost.Total,
-				ImageCount:  1, // Count as 1 item for video
-				Timestamp:   time.Now(),
-			}
-			if logErr := store.LogCost(ctx, costEntry); logErr != nil {
-				fmt.Fprintf(app.Err, "Warning: failed to log cost: %v\n", logErr)
-			}
-		}
+	count, size, err := cache.New(dir, 0).Stats()
+	if err != nil {
+		return fmt.Errorf("failed to read cache: %w", err)
 	}
 
-	fmt.Fprintln(app.Out, "Done!")
+	fmt.Fprintf(app.Out, "Cache location: %s\n", dir)
+	fmt.Fprintf(app.Out, "Entries: %d\n", count)
+	fmt.Fprintf(app.Out, "Size: %.2f MB (limit %d MB)\n", float64(size)/(1<<20), flagCacheMaxMB)
 	return nil
 }
 
-// Keys command
+func runCacheClear(app *App) error {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return err
+	}
+	count, size, err := cache.New(dir, 0).Clear()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(app.Out, "Removed %d cached response(s), freed %.2f MB\n", count, float64(size)/(1<<20))
+	return nil
+}
 
-func newKeysCmd(app *App) *cobra.Command {
+func newStripMetadataCmd(app *App) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "keys",
-		Short: "Manage API keys",
-		Long: `Manage API keys for image generation providers.
-
-Keys are stored securely in a local configuration file and are used
-automatically when generating images. This is useful for CLI tools
-that don't pass environment variables (like Codex CLI).
+		Use:   "strip-metadata <image>",
+		Short: "Remove metadata from an image before sharing",
+		Long: `Remove text, EXIF, XMP, and comment metadata from a PNG, JPEG, or WebP
+image, including any prompt imggen recorded. Pixel data is copied unchanged;
+only metadata chunks are dropped. Color profiles are kept.
 
-Key lookup order:
-  1. --api-key flag (highest priority)
-  2. Stored key in keys.json
-  3. OPENAI_API_KEY environment variable
+With --in-place the original is first copied to <image>.backup-<timestamp>.
 
 Examples:
-  imggen keys set              # Save your OpenAI API key
-  imggen keys                  # List stored keys
-  imggen keys path             # Show keys.json location
-  imggen keys delete           # Remove stored key`,
+  imggen strip-metadata photo.png -o clean.png
+  imggen strip-metadata photo.jpg --in-place`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runKeysList(app)
+			return runStripMetadata(app, args[0])
 		},
 	}
 
-	cmd.AddCommand(newKeysSetCmd(app))
-	cmd.AddCommand(newKeysPathCmd(app))
-	cmd.AddCommand(newKeysDeleteCmd(app))
+	cmd.Flags().StringVarP(&flagStripOutput, "output", "o", "", "write the cleaned image to this path")
+	cmd.Flags().BoolVar(&flagStripInPlace, "in-place", false, "overwrite the image, keeping a backup of the original")
+	cmd.MarkFlagsMutuallyExclusive("output", "in-place")
+	cmd.MarkFlagsOneRequired("output", "in-place")
 
 	return cmd
 }
 
-func newKeysSetCmd(app *App) *cobra.Command {
-	return &cobra.Command{
-		Use:   "set",
-		Short: "Save an API key",
-		Long: `Save an API key for OpenAI.
+func runStripMetadata(app *App, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read image: %w", err)
+	}
 
-The key will be stored in a local configuration file and used
-automatically when generating images. This is an alternative to
-setting the OPENAI_API_KEY environment variable.
+	cleaned, removed, err := image.StripMetadata(data)
+	if err != nil {
+		return fmt.Errorf("failed to strip metadata from %s: %w", path, err)
+	}
 
-Example:
-  imggen keys set`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return runKeysSet(app)
-		},
+	output := flagStripOutput
+	if flagStripInPlace {
+		output = path
+		backupPath := path + ".backup-" + time.Now().Format("20060102-150405")
+		if err := os.WriteFile(backupPath, data, 0600); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+		fmt.Fprintf(app.Out, "Backup saved to: %s\n", backupPath)
 	}
-}
 
-func newKeysPathCmd(app *App) *cobra.Command {
-	return &cobra.Command{
-		Use:   "path",
-		Short: "Show the keys.json file location",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return runKeysPath(app)
-		},
+	if err := os.WriteFile(output, cleaned, 0644); err != nil {
+		return fmt.Errorf("failed to write image: %w", err)
 	}
+
+	fmt.Fprintf(app.Out, "Removed %d metadata chunk(s), saved %s (%s -> %s)\n",
+		removed, output, formatFileSize(int64(len(data))), formatFileSize(int64(len(cleaned))))
+	return nil
 }
 
-func newKeysDeleteCmd(app *App) *cobra.Command {
+func newInspectCmd(app *App) *cobra.Command {
 	return &cobra.Command{
-		Use:   "delete",
-		Short: "Delete a stored API key",
+		Use:   "inspect <image>",
+		Short: "Show the generation parameters and provenance embedded in an image",
+		Long: `Print the prompt, revised prompt, model, size, quality, seed, and creation
+time that --embed-metadata recorded in a PNG or JPEG image, and the
+provenance block --provenance added.
+
+Examples:
+  imggen inspect cat.png
+  imggen inspect cat.jpg --json`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runKeysDelete(app)
+			return runInspect(app, args[0])
 		},
 	}
 }
 
-func runKeysList(app *App) error {
-	store, err := keys.NewStore()
+// inspectJSON is what inspect --json prints: the generation parameters at
+// the top level, as before provenance existed, and the provenance block.
+type inspectJSON struct {
+	*image.GenerationParams
+	Provenance *image.Provenance `json:"provenance,omitempty"`
+}
+
+func runInspect(app *App, path string) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to read image: %w", err)
 	}
-
-	providers, err := store.List()
+	params, err := image.ReadParams(data)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to read metadata from %s: %w", path, err)
+	}
+	prov, err := image.ReadProvenance(data)
+	if err != nil {
+		return fmt.Errorf("failed to read provenance from %s: %w", path, err)
+	}
+	if params == nil && prov == nil {
+		return fmt.Errorf("no imggen metadata in %s (generate with --embed-metadata or --provenance to record it)", path)
 	}
 
-	if len(providers) == 0 {
-		fmt.Fprintln(app.Out, "No API keys stored.")
-		fmt.Fprintln(app.Out, "")
-		fmt.Fprintln(app.Out, "To save a key:")
-		fmt.Fprintln(app.Out, "  imggen keys set")
-		return nil
+	if flagJSON {
+		return writeJSON(app.Out, inspectJSON{GenerationParams: params, Provenance: prov})
+	}
+	tw := tabwriter.NewWriter(app.Out, 0, 0, 2, ' ', 0)
+	if params != nil {
+		fmt.Fprintf(tw, "Prompt:\t%s\n", params.Prompt)
+		if params.RevisedPrompt != "" {
+			fmt.Fprintf(tw, "Revised prompt:\t%s\n", params.RevisedPrompt)
+		}
+		fmt.Fprintf(tw, "Model:\t%s\n", params.Model)
+		if params.Size != "" {
+			fmt.Fprintf(tw, "Size:\t%s\n", params.Size)
+		}
+		if params.Quality != "" {
+			fmt.Fprintf(tw, "Quality:\t%s\n", params.Quality)
+		}
+		if params.Seed != 0 {
+			fmt.Fprintf(tw, "Seed:\t%d\n", params.Seed)
+		}
+		if !params.CreatedAt.IsZero() {
+			fmt.Fprintf(tw, "Created:\t%s\n", params.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+	}
+	if prov != nil {
+		if params != nil {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintln(tw, "Provenance:")
+		fmt.Fprintf(tw, "  Generator:\t%s\n", prov.Generator)
+		fmt.Fprintf(tw, "  Model:\t%s\n", prov.Model)
+		if !prov.CreatedAt.IsZero() {
+			fmt.Fprintf(tw, "  Created:\t%s\n", prov.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		fmt.Fprintf(tw, "  Prompt hash:\t%s\n", prov.PromptHash)
+		fmt.Fprintf(tw, "  Source type:\t%s\n", prov.DigitalSourceType)
 	}
+	return tw.Flush()
+}
 
-	fmt.Fprintln(app.Out, "Stored API keys:")
-	fmt.Fprintln(app.Out, "")
-	for _, provider := range providers {
-		key, _ := store.Get(provider)
-		fmt.Fprintf(app.Out, "  %-10s  %s\n", provider, keys.MaskKey(key))
+var (
+	flagSelfUpdateCheck bool
+)
+
+// updateAPIURL is the release endpoint self-update reads; tests point it at
+// a local server.
+var updateAPIURL = update.DefaultAPIURL
+
+func newSelfUpdateCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "self-update",
+		Short: "Update imggen to the latest release",
+		Long: `Check GitHub for the latest imggen release and, if it is newer than this
+binary, download the build for this platform, verify it against the
+release's checksums.txt, and replace the running executable.
+
+Installs managed by a package manager such as Homebrew should be upgraded
+with that package manager instead.
+
+Examples:
+  imggen self-update --check   # Report whether an update is available
+  imggen self-update           # Ask, then update
+  imggen self-update --yes     # Update without asking`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSelfUpdate(cmd.Context(), app)
+		},
 	}
-	fmt.Fprintln(app.Out, "")
-	fmt.Fprintf(app.Out, "Keys file: %s\n", store.Path())
 
-	return nil
+	cmd.Flags().BoolVar(&flagSelfUpdateCheck, "check", false, "only report whether a newer release is available")
+	cmd.Flags().BoolVarP(&flagYes, "yes", "y", false, "update without confirming")
+
+	return cmd
 }
 
-func runKeysSet(app *App) error {
-	store, err := keys.NewStore()
+func runSelfUpdate(ctx context.Context, app *App) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	transport, err := httpTransport()
+	if err != nil {
+		return err
+	}
+	u := update.New(updateAPIURL, transport)
+	rel, err := u.Latest(ctx)
 	if err != nil {
 		return err
 	}
 
-	provider := "openai"
-	envVar := "OPENAI_API_KEY"
-
-	// Check if key already exists in store
-	existing, _ := store.Get(provider)
-	if existing != "" {
-		fmt.Fprintf(app.Out, "Existing key for %s: %s\n", provider, keys.MaskKey(existing))
-		fmt.Fprint(app.Out, "Replace it? [y/N] ")
+	fmt.Fprintf(app.Out, "Current version: %s\n", version)
+	fmt.Fprintf(app.Out, "Latest release:  %s\n", rel.Tag)
 
-		reader := bufio.NewReader(os.Stdin)
-		response, _ := reader.ReadString('\n')
-		response = strings.TrimSpace(strings.ToLower(response))
-		if response != "y" && response != "yes" {
-			fmt.Fprintln(app.Out, "Cancelled.")
+	cmp, err := update.CompareVersions(version, rel.Tag)
+	if err != nil {
+		if flagSelfUpdateCheck {
+			fmt.Fprintln(app.Out, "This is a development build; install a release to use self-update.")
 			return nil
 		}
+		return fmt.Errorf("cannot self-update a development build (version %q)", version)
 	}
-
-	// Check if key exists in environment variable
-	var key string
-	if envKey := os.Getenv(envVar); envKey != "" {
-		fmt.Fprintf(app.Out, "Found %s in environment: %s\n", envVar, keys.MaskKey(envKey))
-		fmt.Fprint(app.Out, "Import this key? [Y/n] ")
-
-		reader := bufio.NewReader(os.Stdin)
-		response, _ := reader.ReadString('\n')
-		response = strings.TrimSpace(strings.ToLower(response))
-		if response == "" || response == "y" || response == "yes" {
-			key = envKey
-		}
+	if cmp >= 0 {
+		fmt.Fprintln(app.Out, "imggen is up to date.")
+		return nil
+	}
+	if flagSelfUpdateCheck {
+		fmt.Fprintf(app.Out, "Update available. Run 'imggen self-update' to install %s.\n", rel.Tag)
+		return nil
 	}
 
-	// If not imported from env, prompt for key
-	if key == "" {
-		fmt.Fprintf(app.Out, "Enter API key for %s: ", provider)
-
-		// Read key (hide input if terminal)
-		if term.IsTerminal(int(os.Stdin.Fd())) {
-			keyBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
-			if err != nil {
-				return fmt.Errorf("failed to read key: %w", err)
-			}
-			key = string(keyBytes)
-			fmt.Fprintln(app.Out, "") // newline after hidden input
-		} else {
-			reader := bufio.NewReader(os.Stdin)
-			key, _ = reader.ReadString('\n')
+	// Replacing the binary is never done without an explicit yes.
+	if !flagYes {
+		if !isTerminal() {
+			return fmt.Errorf("stdin is not a terminal; pass --yes to update to %s without confirming", rel.Tag)
 		}
-
-		key = strings.TrimSpace(key)
-		if key == "" {
-			return fmt.Errorf("no key provided")
+		if !confirm(app, fmt.Sprintf("Update to %s?", rel.Tag)) {
+			fmt.Fprintln(app.Out, "Cancelled.")
+			return nil
 		}
 	}
 
-	if err := store.Set(provider, key); err != nil {
-		return err
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
 	}
 
-	fmt.Fprintf(app.Out, "Saved key for %s: %s\n", provider, keys.MaskKey(key))
-	fmt.Fprintf(app.Out, "Keys file: %s\n", store.Path())
+	binary, err := u.Download(ctx, rel, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+	if err := update.Replace(exe, binary); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", exe, err)
+	}
 
+	fmt.Fprintf(app.Out, "Updated imggen to %s\n", rel.Tag)
 	return nil
 }
 
-func runKeysPath(app *App) error {
-	store, err := keys.NewStore()
-	if err != nil {
-		return err
+func newDoctorCmd(app *App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the setup for common problems",
+		Long: `Run a series of checks on the local setup and print a fix for each one
+that fails:
+
+  API key            resolved like generation does: --api-key, then the
+                     key store, then OPENAI_API_KEY (shown masked)
+  Data directory     ~/.imggen exists as a private, writable directory
+  Database           the session database can be opened or created
+  Terminal graphics  --show can display images inline
+  Connectivity       the OpenAI API (or --base-url) answers requests; no
+                     key is sent
+
+doctor exits with an error if any check that generation depends on fails.
+A terminal without inline image support is only a warning.
+
+Examples:
+  imggen doctor
+  imggen doctor --base-url https://proxy.example.com/v1`,
+		Args: cobra.NoArgs,
+		// A failed check is a finding, not a usage mistake.
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor(cmd.Context(), app)
+		},
 	}
 
-	fmt.Fprintln(app.Out, store.Path())
-	return nil
+	cmd.Flags().StringVar(&flagAPIKey, "api-key", "", "API key, to check that the flag takes precedence")
+
+	return cmd
 }
 
-func runKeysDelete(app *App) error {
-	store, err := keys.NewStore()
+func runDoctor(ctx context.Context, app *App) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	dbPath, err := getDBPath()
 	if err != nil {
 		return err
 	}
-
-	provider := "openai"
-
-	// Check if key exists
-	existing, _ := store.Get(provider)
-	if existing == "" {
-		fmt.Fprintf(app.Out, "No key stored for %s\n", provider)
-		return nil
+	baseURL := flagBaseURL
+	if baseURL == "" {
+		baseURL = openai.DefaultBaseURL
 	}
 
-	fmt.Fprintf(app.Out, "Delete key for %s? (%s) [y/N] ", provider, keys.MaskKey(existing))
+	connCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
 
-	reader := bufio.NewReader(os.Stdin)
-	response, _ := reader.ReadString('\n')
-	response = strings.TrimSpace(strings.ToLower(response))
-	if response != "y" && response != "yes" {
-		fmt.Fprintln(app.Out, "Cancelled.")
-		return nil
+	results := []doctor.Result{
+		doctor.APIKey(func() (string, string, error) {
+			return keys.GetAPIKey(flagAPIKey, string(models.ProviderOpenAI), apiKeyEnvVar(models.ProviderOpenAI))
+		}, apiKeyEnvVar(models.ProviderOpenAI)),
+		doctor.DataDir(filepath.Dir(dbPath)),
+		doctor.Database(dbPath),
+		doctor.Terminal(display.IsTerminalSupported),
+		connectivity(connCtx, baseURL),
 	}
 
-	if err := store.Delete(provider); err != nil {
-		return err
+	var critical, warnings int
+	for _, r := range results {
+		mark := "✓"
+		if !r.OK {
+			mark = "✗"
+			if r.Critical {
+				critical++
+			} else {
+				warnings++
+			}
+		}
+		fmt.Fprintf(app.Out, "%s %-18s %s\n", mark, r.Name, r.Detail)
+		if !r.OK && r.Hint != "" {
+			fmt.Fprintf(app.Out, "  %-18s → %s\n", "", r.Hint)
+		}
 	}
 
-	fmt.Fprintf(app.Out, "Deleted key for %s\n", provider)
+	fmt.Fprintln(app.Out)
+	switch {
+	case critical > 0:
+		return fmt.Errorf("%d check(s) failed", critical)
+	case warnings > 0:
+		fmt.Fprintf(app.Out, "Ready to generate images, with %d warning(s).\n", warnings)
+	default:
+		fmt.Fprintln(app.Out, "All checks passed.")
+	}
 	return nil
 }
+
+// connectivity runs doctor's connectivity check through --proxy and
+// --ca-cert, as generation would connect.
+func connectivity(ctx context.Context, baseURL string) doctor.Result {
+	transport, err := httpTransport()
+	if err != nil {
+		return doctor.Result{
+			Name:     "Connectivity",
+			Critical: true,
+			Detail:   err.Error(),
+			Hint:     "check --proxy and --ca-cert",
+		}
+	}
+	return doctor.Connectivity(ctx, &http.Client{Transport: transport}, baseURL)
+}
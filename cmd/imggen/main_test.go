@@ -3,18 +3,39 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/manash/imggen/internal/batch"
+	"github.com/manash/imggen/internal/cache"
+	"github.com/manash/imggen/internal/config"
+	"github.com/manash/imggen/internal/cost"
 	"github.com/manash/imggen/internal/display"
+	"github.com/manash/imggen/internal/events"
 	"github.com/manash/imggen/internal/image"
+	"github.com/manash/imggen/internal/keys"
+	"github.com/manash/imggen/internal/ocrcsv"
 	"github.com/manash/imggen/internal/provider"
+	"github.com/manash/imggen/internal/schemagen"
 	"github.com/manash/imggen/internal/session"
 	"github.com/manash/imggen/pkg/models"
 )
@@ -57,20 +78,91 @@ func (m *mockProvider) ListModels() []string {
 
 // resetFlags resets all global flags to their default values.
 func resetFlags() {
+	priceOverrides = nil
 	flagModel = "gpt-image-1"
 	flagSize = ""
 	flagQuality = ""
 	flagCount = 1
 	flagOutput = ""
-	flagFormat = "png"
+	flagFormat = ""
 	flagStyle = ""
+	flagSeed = 0
 	flagTransparent = false
 	flagAPIKey = ""
 	flagShow = false
+	flagPrompts = nil
+	flagCombinePrompts = false
+	flagCombineSep = ", "
+	flagShowProtocol = display.ProtocolAuto
+	flagCache = false
+	flagNoRevise = false
+	flagMaxPromptDrift = 0
+	flagStrict = false
+	flagQuiet = false
+	flagConfirmAbove = 0
+	flagYes = false
+	flagCacheMaxMB = cache.DefaultMaxBytes >> 20
 	flagInteractive = false
+	flagResumeLast = false
+	flagPreviewQuality = ""
+	flagExplain = false
+	flagDryRun = false
+	flagStripWeights = false
+	flagStdoutBase64 = false
+	flagEmbedMetadata = false
+	flagNameTemplate = ""
+	flagProvenance = false
+	flagJPEGQuality = image.DefaultEncodeOptions.JPEGQuality
+	flagWebPQuality = image.DefaultEncodeOptions.WebPQuality
+	flagWebPLossless = false
+	flagLocale = ""
+	flagConfigProfile = ""
+	flagBaseURL = ""
+	flagProxy = ""
+	flagCACert = ""
+	flagTimeout = 0
+	flagCostTZ = ""
+	flagCostExportFormat = "csv"
+	flagCostExportFrom = ""
+	flagCostExportTo = ""
+	flagCostExportOutput = ""
+	flagCostBreakdownBy = "model"
+	flagCostBreakdownPeriod = "month"
+	flagMaxInflightPerHost = 0
+	flagSaveRequest = ""
+	flagSaveResponse = ""
+	flagEventLog = ""
+	flagEventLogPrompts = "hash"
+	flagJSON = false
+	flagHistoryWhere = ""
+	flagHistorySession = ""
+	flagHistoryTree = false
+	flagPromptsTop = 10
+	flagPromptsSession = ""
+	flagVaryModel = "dall-e-2"
+	flagVaryCount = 1
+	flagVarySize = ""
+	flagVaryOutput = ""
+	flagEditModel = "gpt-image-1"
+	flagEditMask = ""
+	flagEditCount = 1
+	flagEditSize = ""
+	flagEditOutput = ""
+	flagEditResize = false
+	flagEditAlpha = false
+	flagEditEXIF = ""
+	flagEditInEXIF = false
+	flagStripOutput = ""
+	flagStripInPlace = false
+	flagSelfUpdateCheck = false
+	flagSessionExportOutput = ""
+	flagKeysMigrateFrom = "file"
+	flagKeysMigrateTo = ""
+	flagKeysWhichProvider = "openai"
 	flagDBBackup = false
 	flagRegisterDryRun = false
 	flagRegisterForce = false
+	flagRegisterBackupsAll = false
 	// Video flags
 	flagVideoModel = "sora-2"
 	flagVideoDuration = 0
@@ -389,6 +481,139 @@ func TestRunGenerate_SuccessWithOutput(t *testing.T) {
 	if !strings.Contains(output, "Done!") {
 		t.Error("output missing 'Done!' message")
 	}
+	// Output that is not a terminal gets no spinner.
+	if strings.Contains(output, "\r") || strings.Contains(output, "elapsed") {
+		t.Errorf("output has spinner frames: %q", output)
+	}
+}
+
+func TestRunGenerate_Quiet(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.Err = errOut
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{generateFunc: func(_ context.Context, req *models.Request) (*models.Response, error) {
+			return &models.Response{
+				Images:        []models.GeneratedImage{{Data: []byte("img")}},
+				Cost:          &models.CostInfo{Total: 0.04, PerImage: 0.04},
+				RevisedPrompt: "a red fox in the snow",
+			}, nil
+		}}, nil
+	}
+
+	output := filepath.Join(t.TempDir(), "fox.png")
+	root := newRootCmd(app)
+	root.SetArgs([]string{"(red:1.2) fox", "--quiet", "--strip-weights", "--no-revise", "-o", output, "--api-key", "test-key"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	// Progress, cost, and revised prompt lines are dropped; the saved path
+	// is kept.
+	if want := "Saved: " + output + "\n"; out.String() != want {
+		t.Errorf("stdout = %q, want only %q", out.String(), want)
+	}
+	// So are the strip-weights and --no-revise warnings.
+	if errOut.Len() != 0 {
+		t.Errorf("stderr = %q, want no warnings", errOut.String())
+	}
+	if showSpinner(app) {
+		t.Error("showSpinner() = true with --quiet")
+	}
+}
+
+func TestRunGenerate_ConfirmAbove(t *testing.T) {
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+	defer func(orig func() bool) { isTerminal = orig }(isTerminal)
+	isTerminal = func() bool { return true }
+
+	tests := []struct {
+		name       string
+		args       []string
+		answer     string
+		wantAsked  bool
+		wantCalled bool
+	}{
+		{"expensive request asks and stops on no", []string{"-n", "10", "-q", "high"}, "n\n", true, false},
+		{"expensive request asks and goes ahead on yes", []string{"-n", "10", "-q", "high"}, "y\n", true, true},
+		{"cheap request does not ask", []string{"-q", "low"}, "", false, true},
+		{"--yes skips the question", []string{"-n", "10", "-q", "high", "--yes"}, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			called := false
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			app.In = strings.NewReader(tt.answer)
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				return &mockProvider{generateFunc: func(_ context.Context, req *models.Request) (*models.Response, error) {
+					called = true
+					return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+				}}, nil
+			}
+
+			args := append([]string{"a lighthouse", "--confirm-above", "1", "-o", filepath.Join(t.TempDir(), "out.png"), "--api-key", "test-key"}, tt.args...)
+			root := newRootCmd(app)
+			root.SetArgs(args)
+			if err := root.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v\n%s", err, out.String())
+			}
+
+			asked := strings.Contains(out.String(), "above the $1.00 --confirm-above limit. Continue? [y/N]")
+			if asked != tt.wantAsked {
+				t.Errorf("asked = %v, want %v:\n%s", asked, tt.wantAsked, out.String())
+			}
+			if called != tt.wantCalled {
+				t.Errorf("generated = %v, want %v", called, tt.wantCalled)
+			}
+		})
+	}
+}
+
+func TestConfirmCost_NotATerminal(t *testing.T) {
+	defer resetFlags()
+	defer func(orig func() bool) { isTerminal = orig }(isTerminal)
+	isTerminal = func() bool { return false }
+
+	resetFlags()
+	flagConfirmAbove = 1
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.In = strings.NewReader("n\n")
+	if !confirmCost(app, 5, false) {
+		t.Error("confirmCost() = false without a terminal, want it to go ahead")
+	}
+	if out.Len() != 0 {
+		t.Errorf("confirmCost() asked %q without a terminal", out.String())
+	}
+}
+
+func TestShowSpinner(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, w := range []io.Writer{&bytes.Buffer{}, io.Discard, f} {
+		if showSpinner(&App{Out: w}) {
+			t.Errorf("showSpinner(%T) = true, want false for output that is not a terminal", w)
+		}
+	}
+	flagJSON = true
+	jsonApp, _ := withJSONOutput(&App{Out: os.Stdout})
+	if showSpinner(jsonApp) {
+		t.Error("showSpinner() = true with --json output")
+	}
 }
 
 func TestRunGenerate_SuccessWithRevisedPrompt(t *testing.T) {
@@ -637,7 +862,7 @@ func TestRootCmd_FlagDefaults(t *testing.T) {
 		{"quality", ""},
 		{"count", "1"},
 		{"output", ""},
-		{"format", "png"},
+		{"format", ""},
 		{"style", ""},
 		{"transparent", "false"},
 		{"api-key", ""},
@@ -656,6 +881,54 @@ func TestRootCmd_FlagDefaults(t *testing.T) {
 	}
 }
 
+func TestRunGenerate_ModelDefaultFormat(t *testing.T) {
+	tests := []struct {
+		model         string
+		defaultFormat models.OutputFormat
+		format        string
+		want          string
+	}{
+		{"dall-e-3", "", "", ".png"},
+		{"gpt-image-1", "", "", ".png"},
+		{"dall-e-3", models.FormatJPEG, "", ".jpeg"},
+		{"dall-e-3", models.FormatJPEG, "webp", ".webp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model+"/"+string(tt.defaultFormat)+"/"+tt.format, func(t *testing.T) {
+			resetFlags()
+			tmpDir := t.TempDir()
+			t.Setenv("HOME", tmpDir)
+			oldWd, _ := os.Getwd()
+			os.Chdir(tmpDir)
+			defer os.Chdir(oldWd)
+
+			app := newTestApp(&bytes.Buffer{})
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				return &mockProvider{}, nil
+			}
+			if tt.defaultFormat != "" {
+				cap, _ := app.Registry.Get(tt.model)
+				custom := *cap
+				custom.DefaultFormat = tt.defaultFormat
+				app.Registry.Register(&custom)
+			}
+			flagAPIKey = "test-key"
+			flagModel = tt.model
+			flagFormat = tt.format
+
+			if err := runGenerate(&cobra.Command{}, []string{"a lighthouse"}, app); err != nil {
+				t.Fatalf("runGenerate() error = %v", err)
+			}
+
+			saved, _ := filepath.Glob(filepath.Join(tmpDir, "image-*"))
+			if len(saved) != 1 || filepath.Ext(saved[0]) != tt.want {
+				t.Errorf("saved files = %v, want one %s file", saved, tt.want)
+			}
+		})
+	}
+}
+
 func TestRunGenerate_DallE3WithStyle(t *testing.T) {
 	resetFlags()
 	out := &bytes.Buffer{}
@@ -980,6 +1253,271 @@ func TestRunCost_Today(t *testing.T) {
 	}
 }
 
+func TestDayRange(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	tests := []struct {
+		name      string
+		t         time.Time
+		wantStart time.Time
+	}{
+		{"just before midnight", time.Date(2025, 3, 14, 23, 59, 59, 0, berlin), time.Date(2025, 3, 14, 0, 0, 0, 0, berlin)},
+		{"at midnight", time.Date(2025, 3, 15, 0, 0, 0, 0, berlin), time.Date(2025, 3, 15, 0, 0, 0, 0, berlin)},
+		{"same instant in UTC", time.Date(2025, 3, 15, 0, 0, 0, 0, berlin).UTC(), time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := dayRange(tt.t)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantStart.AddDate(0, 0, 1)) {
+				t.Errorf("dayRange() = %v, %v; want %v and a day later", start, end, tt.wantStart)
+			}
+		})
+	}
+}
+
+func TestRunCost_TZ(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	oldGetDBPath := getDBPath
+	getDBPath = func() (string, error) { return dbPath, nil }
+	defer func() { getDBPath = oldGetDBPath }()
+
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.LogCost(context.Background(), &session.CostEntry{Provider: "openai", Model: "dall-e-3", Cost: 0.04, ImageCount: 1, Timestamp: time.Now()})
+	store.Close()
+
+	out := &bytes.Buffer{}
+	flagCostTZ = "UTC"
+	if err := runCost(newTestApp(out), []string{"today"}); err != nil {
+		t.Fatalf("runCost() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Today's cost: $0.0400") {
+		t.Errorf("output = %q, want today's cost in UTC", out.String())
+	}
+
+	flagCostTZ = "Mars/Olympus_Mons"
+	if err := runCost(newTestApp(&bytes.Buffer{}), []string{"today"}); err == nil || !strings.Contains(err.Error(), "invalid --tz") {
+		t.Errorf("runCost() error = %v, want invalid --tz", err)
+	}
+}
+
+func TestRunCostBreakdown(t *testing.T) {
+	defer resetFlags()
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	oldGetDBPath := getDBPath
+	getDBPath = func() (string, error) { return dbPath, nil }
+	defer func() { getDBPath = oldGetDBPath }()
+
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	today, _ := dayRange(time.Now().UTC())
+	for _, e := range []session.CostEntry{
+		{Provider: "openai", Model: "dall-e-3", Cost: 0.04, ImageCount: 1, Timestamp: today.Add(-47 * time.Hour)},
+		{Provider: "openai", Model: "gpt-image-1", Cost: 0.167, ImageCount: 1, Timestamp: today.Add(-46 * time.Hour)},
+		{Provider: "openai", Model: "dall-e-3", Cost: 0.08, ImageCount: 2, Timestamp: today.Add(-23 * time.Hour)},
+		{Provider: "stability", Model: "stable-diffusion-xl", Cost: 0.01, ImageCount: 1, Timestamp: today.Add(-22 * time.Hour)},
+		{Provider: "openai", Model: "dall-e-2", Cost: 0.02, ImageCount: 1, Timestamp: today.AddDate(0, 0, -40)},
+	} {
+		if err := store.LogCost(ctx, &e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	day := func(n int) string { return today.AddDate(0, 0, n).Format(time.DateOnly) }
+	tests := []struct {
+		by, period string
+		want       []string
+	}{
+		{"model", "month", []string{
+			"Cost by model for the last 30 days:",
+			"Model                 Images       Cost",
+			"gpt-image-1                1    $0.1670",
+			"dall-e-3                   3    $0.1200",
+			"stable-diffusion-xl        1    $0.0100",
+			"Total                      5    $0.2970",
+		}},
+		{"day", "week", []string{
+			"Day          Images       Cost",
+			day(-2) + "        2    $0.2070",
+			day(-1) + "        3    $0.0900",
+		}},
+		{"provider", "total", []string{
+			"Cost by provider for all time:",
+			"openai           5    $0.3070",
+			"stability        1    $0.0100",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			resetFlags()
+			flagCostTZ = "UTC"
+			flagCostBreakdownBy, flagCostBreakdownPeriod = tt.by, tt.period
+			out := &bytes.Buffer{}
+			if err := runCostBreakdown(newTestApp(out)); err != nil {
+				t.Fatalf("runCostBreakdown() error = %v", err)
+			}
+			lines := strings.Split(out.String(), "\n")
+			for _, want := range tt.want {
+				if !slices.Contains(lines, want) {
+					t.Errorf("output missing line %q:\n%s", want, out.String())
+				}
+			}
+			if tt.period != "total" && strings.Contains(out.String(), "dall-e-2") {
+				t.Errorf("output includes an entry from before the period:\n%s", out.String())
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		resetFlags()
+		flagCostTZ = "UTC"
+		flagCostBreakdownBy = "day"
+		flagJSON = true
+		out := &bytes.Buffer{}
+		if err := runCostBreakdown(newTestApp(out)); err != nil {
+			t.Fatalf("runCostBreakdown() error = %v", err)
+		}
+		var got costBreakdownJSON
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+		}
+		if got.By != "day" || got.Period != "month" || len(got.Groups) != 2 || got.Groups[0].Key != day(-2) || got.Groups[0].Entries != 2 || got.ImageCount != 5 {
+			t.Errorf("json = %+v", got)
+		}
+	})
+
+	t.Run("empty period", func(t *testing.T) {
+		resetFlags()
+		flagCostBreakdownPeriod = "today"
+		out := &bytes.Buffer{}
+		if err := runCostBreakdown(newTestApp(out)); err != nil {
+			t.Fatalf("runCostBreakdown() error = %v", err)
+		}
+		if out.String() != "No costs logged for today\n" {
+			t.Errorf("output = %q", out.String())
+		}
+	})
+}
+
+func TestRunCostBreakdown_Invalid(t *testing.T) {
+	defer resetFlags()
+	resetFlags()
+	flagCostBreakdownBy = "modle"
+	if err := runCostBreakdown(newTestApp(&bytes.Buffer{})); err == nil || !strings.Contains(err.Error(), `invalid --by "modle"; did you mean "model"?`) {
+		t.Errorf("runCostBreakdown(--by modle) error = %v", err)
+	}
+	resetFlags()
+	flagCostBreakdownPeriod = "year"
+	if err := runCostBreakdown(newTestApp(&bytes.Buffer{})); err == nil || !strings.Contains(err.Error(), "invalid --period") {
+		t.Errorf("runCostBreakdown(--period year) error = %v", err)
+	}
+}
+
+func TestRunCostExport(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	oldGetDBPath := getDBPath
+	getDBPath = func() (string, error) { return dbPath, nil }
+	defer func() { getDBPath = oldGetDBPath }()
+
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	store.LogCost(ctx, &session.CostEntry{Provider: "openai", Model: "dall-e-3", Cost: 0.04, ImageCount: 1, Timestamp: time.Date(2025, 5, 31, 23, 30, 0, 0, time.UTC)})
+	store.LogCost(ctx, &session.CostEntry{Provider: "openai", Model: "gpt-image-1", Cost: 0.167, ImageCount: 1, Timestamp: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)})
+	store.LogCost(ctx, &session.CostEntry{Provider: "stability", Model: "sd3", Cost: 0.065, ImageCount: 2, Timestamp: time.Date(2025, 6, 30, 23, 59, 0, 0, time.UTC)})
+	store.LogCost(ctx, &session.CostEntry{Provider: "openai", Model: "dall-e-2", Cost: 0.02, ImageCount: 1, Timestamp: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)})
+	store.Close()
+
+	flagCostTZ = "UTC"
+	flagCostExportFrom = "2025-06-01"
+	flagCostExportTo = "2025-06-30"
+	out := &bytes.Buffer{}
+	if err := runCostExport(newTestApp(out)); err != nil {
+		t.Fatalf("runCostExport() error = %v", err)
+	}
+	want := "timestamp,provider,model,cost,image_count,session_id,iteration_id,cache_hit\n" +
+		"2025-06-01T00:00:00Z,openai,gpt-image-1,0.167,1,,,false\n" +
+		"2025-06-30T23:59:00Z,stability,sd3,0.065,2,,,false\n"
+	if out.String() != want {
+		t.Errorf("csv =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	// An open-ended range runs to the latest entry.
+	flagCostExportTo = ""
+	flagCostExportFormat = "json"
+	flagCostExportOutput = filepath.Join(t.TempDir(), "costs.json")
+	out.Reset()
+	if err := runCostExport(newTestApp(out)); err != nil {
+		t.Fatalf("runCostExport() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Exported 3 cost entries to ") {
+		t.Errorf("output = %q, want the export count", out.String())
+	}
+	data, err := os.ReadFile(flagCostExportOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []costExportEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("export is not a JSON array: %v\n%s", err, data)
+	}
+	if len(entries) != 3 || entries[0].Model != "gpt-image-1" || entries[2].Model != "dall-e-2" || entries[1].ImageCount != 2 {
+		t.Errorf("entries = %+v, want gpt-image-1, sd3, dall-e-2", entries)
+	}
+
+	// An empty range still has the header, or an empty array.
+	flagCostExportFrom = "2026-01-01"
+	flagCostExportOutput = ""
+	out.Reset()
+	if err := runCostExport(newTestApp(out)); err != nil {
+		t.Fatalf("runCostExport() error = %v", err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("empty json = %q, want []", out.String())
+	}
+	flagCostExportFormat = "csv"
+	out.Reset()
+	if err := runCostExport(newTestApp(out)); err != nil {
+		t.Fatalf("runCostExport() error = %v", err)
+	}
+	if out.String() != want[:strings.Index(want, "\n")+1] {
+		t.Errorf("empty csv = %q, want only the header", out.String())
+	}
+}
+
+func TestRunCostExport_Invalid(t *testing.T) {
+	defer resetFlags()
+	tests := []struct {
+		name, format, from, to, wantErr string
+	}{
+		{"format", "xlsx", "", "", "invalid --format"},
+		{"from", "csv", "June 1", "", "invalid --from"},
+		{"to", "csv", "", "2025-13-01", "invalid --to"},
+		{"reversed", "csv", "2025-06-30", "2025-06-01", "is after --to"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			flagCostExportFormat, flagCostExportFrom, flagCostExportTo = tt.format, tt.from, tt.to
+			err := runCostExport(newTestApp(&bytes.Buffer{}))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("runCostExport() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestRunCost_Week(t *testing.T) {
 	resetFlags()
 	out := &bytes.Buffer{}
@@ -1131,6 +1669,14 @@ func TestRunCost_UnknownSubcommand(t *testing.T) {
 	if !strings.Contains(err.Error(), "unknown subcommand") {
 		t.Errorf("error = %v, want 'unknown subcommand'", err)
 	}
+	if strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("error = %v, want no suggestion for far-off input", err)
+	}
+
+	err = runCost(app, []string{"weak"})
+	if err == nil || !strings.Contains(err.Error(), `did you mean "week"?`) {
+		t.Errorf("runCost() error = %v, want suggestion for week", err)
+	}
 }
 
 // DB command tests
@@ -1162,96 +1708,464 @@ func TestNewDBCmd(t *testing.T) {
 	}
 }
 
-func TestRunDBInfo_NoDatabase(t *testing.T) {
-	resetFlags()
-	out := &bytes.Buffer{}
-	app := newTestApp(out)
-
-	tmpDir := t.TempDir()
-	dbPath := filepath.Join(tmpDir, "nonexistent.db")
+// setupHistoryDB points getDBPath at a temporary database holding a few
+// iterations across two sessions.
+func setupHistoryDB(t *testing.T) {
+	t.Helper()
 
+	dbPath := filepath.Join(t.TempDir(), "test.db")
 	oldGetDBPath := getDBPath
 	getDBPath = func() (string, error) { return dbPath, nil }
-	defer func() { getDBPath = oldGetDBPath }()
+	t.Cleanup(func() { getDBPath = oldGetDBPath })
 
-	err := runDBInfo(app)
+	store, err := session.NewStoreWithPath(dbPath)
 	if err != nil {
-		t.Errorf("runDBInfo() error = %v", err)
+		t.Fatalf("Failed to create store: %v", err)
 	}
+	defer store.Close()
 
-	output := out.String()
-	if !strings.Contains(output, "Database location:") {
-		t.Error("output missing database location")
+	ctx := context.Background()
+	now := time.Date(2025, 3, 14, 12, 0, 0, 0, time.Local)
+	for _, id := range []string{"s1", "s2"} {
+		if err := store.CreateSession(ctx, &session.Session{ID: id, CreatedAt: now, UpdatedAt: now, Model: "gpt-image-1"}); err != nil {
+			t.Fatal(err)
+		}
 	}
-	if !strings.Contains(output, "does not exist") {
-		t.Error("output should indicate database doesn't exist")
+	iterations := []*session.Iteration{
+		{ID: "i1", SessionID: "s1", Operation: "generate", Prompt: "a red fox", Model: "dall-e-3", ImagePath: "/1.png", Timestamp: now,
+			Metadata: session.IterationMetadata{Size: "1024x1024", Quality: "hd", Cost: 0.08}},
+		{ID: "i2", SessionID: "s1", ParentID: "i1", Operation: "edit", Prompt: "make it blue", Model: "gpt-image-1", ImagePath: "/2.png", Timestamp: now.Add(time.Minute),
+			Metadata: session.IterationMetadata{Size: "1024x1024", Cost: 0.04}},
+		{ID: "i3", SessionID: "s2", Operation: "generate", Prompt: "a lighthouse", Model: "dall-e-3", ImagePath: "/3.png", Timestamp: now.AddDate(0, 0, 1),
+			Metadata: session.IterationMetadata{Size: "1792x1024", Quality: "hd", Cost: 0.12}},
+	}
+	for _, iter := range iterations {
+		if err := store.CreateIteration(ctx, iter); err != nil {
+			t.Fatal(err)
+		}
 	}
 }
 
-func TestRunDBInfo_WithDatabase(t *testing.T) {
+func TestRunHistory_Where(t *testing.T) {
+	setupHistoryDB(t)
+
+	tests := []struct {
+		where   string
+		session string
+		want    []string
+		notWant []string
+	}{
+		{"", "", []string{"a red fox", "make it blue", "a lighthouse", "3 iteration(s), $0.2400 total"}, nil},
+		{"model=dall-e-3 and cost>0.1", "", []string{"a lighthouse", "1 iteration(s)"}, []string{"a red fox"}},
+		{"operation=edit or prompt~fox", "", []string{"a red fox", "make it blue"}, []string{"a lighthouse"}},
+		{"date=2025-03-15", "", []string{"a lighthouse"}, []string{"a red fox"}},
+		{"model=dall-e-3", "s1", []string{"a red fox"}, []string{"a lighthouse"}},
+		{"cost>1", "", []string{"No matching history"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			out := &bytes.Buffer{}
+			flagHistoryWhere = tt.where
+			flagHistorySession = tt.session
+
+			if err := runHistory(newTestApp(out)); err != nil {
+				t.Fatalf("runHistory() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, out.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out.String(), notWant) {
+					t.Errorf("output should not contain %q:\n%s", notWant, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRunHistory_InvalidWhere(t *testing.T) {
 	resetFlags()
-	out := &bytes.Buffer{}
-	app := newTestApp(out)
+	defer resetFlags()
+	setupHistoryDB(t)
+	flagHistoryWhere = "modle=dall-e-3"
 
-	tmpDir := t.TempDir()
-	dbPath := filepath.Join(tmpDir, "test.db")
+	err := runHistory(newTestApp(&bytes.Buffer{}))
+	if err == nil || !strings.Contains(err.Error(), `did you mean "model"?`) {
+		t.Errorf("runHistory() error = %v, want unknown field suggestion", err)
+	}
+}
+
+func TestRunHistory_Tree(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	setupHistoryDB(t)
+
+	// Branch s1 at its first iteration with a second edit.
+	dbPath, _ := getDBPath()
 	store, err := session.NewStoreWithPath(dbPath)
 	if err != nil {
-		t.Fatalf("Failed to create store: %v", err)
+		t.Fatal(err)
 	}
-
 	ctx := context.Background()
-	store.LogCost(ctx, &session.CostEntry{
-		Provider:   "openai",
-		Model:      "gpt-image-1",
-		Cost:       0.042,
-		ImageCount: 1,
-		Timestamp:  time.Now(),
-	})
+	first, _ := store.GetIteration(ctx, "i1")
+	alt := &session.Iteration{ID: "i4", SessionID: "s1", ParentID: "i1", Operation: "edit", Prompt: "make it green",
+		Model: "gpt-image-1", ImagePath: "/4.png", Timestamp: first.Timestamp.Add(2 * time.Minute)}
+	if err := store.CreateIteration(ctx, alt); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetBranchPoint(ctx, "i1", true); err != nil {
+		t.Fatal(err)
+	}
 	store.Close()
 
-	oldGetDBPath := getDBPath
-	getDBPath = func() (string, error) { return dbPath, nil }
-	defer func() { getDBPath = oldGetDBPath }()
+	out := &bytes.Buffer{}
+	flagHistoryTree = true
+	if err := runHistory(newTestApp(out)); err != nil {
+		t.Fatalf("runHistory() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	want := []struct{ prefix, suffix string }{
+		{"Session s1", ""},
+		{"  2025-03-14", `"a red fox"  [branch]`},
+		{"  ├─ 2025-03-14", `"make it blue"`},
+		{"  └─ 2025-03-14", `"make it green"`},
+		{"", ""},
+		{"Session s2", ""},
+		{"  2025-03-15", `"a lighthouse"`},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("runHistory() printed %d lines, want %d:\n%s", len(lines), len(want), out.String())
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i], w.prefix) || !strings.HasSuffix(lines[i], w.suffix) {
+			t.Errorf("line %d = %q, want %q...%q", i+1, lines[i], w.prefix, w.suffix)
+		}
+	}
 
-	err = runDBInfo(app)
-	if err != nil {
-		t.Errorf("runDBInfo() error = %v", err)
+	flagHistoryWhere = "model=dall-e-3"
+	if err := runHistory(newTestApp(&bytes.Buffer{})); err == nil || !strings.Contains(err.Error(), "--tree cannot be used with --where") {
+		t.Errorf("runHistory(--tree --where) error = %v", err)
 	}
+}
 
-	output := out.String()
-	if !strings.Contains(output, "Database location:") {
-		t.Error("output missing database location")
+func TestRunHistorySearch(t *testing.T) {
+	setupHistoryDB(t)
+
+	out := &bytes.Buffer{}
+	root := newRootCmd(newTestApp(out))
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"history", "search", "A "})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
 	}
-	if !strings.Contains(output, "Database size:") {
-		t.Error("output missing database size")
+
+	got := out.String()
+	lighthouse, fox := strings.Index(got, "a lighthouse"), strings.Index(got, "a red fox")
+	if lighthouse < 0 || fox < 0 || lighthouse > fox {
+		t.Errorf("want both matches, most recent first:\n%s", got)
 	}
-	if !strings.Contains(output, "Statistics:") {
-		t.Error("output missing statistics")
+	if !strings.Contains(got, "s2  ") || !strings.Contains(got, "2 match(es)") {
+		t.Errorf("output missing session ID or count:\n%s", got)
 	}
-	if !strings.Contains(output, "Sessions:") {
-		t.Error("output missing session count")
+
+	out.Reset()
+	if err := runHistorySearch(newTestApp(out), "zebra"); err != nil {
+		t.Fatalf("runHistorySearch() error = %v", err)
 	}
-	if !strings.Contains(output, "Total cost:") {
-		t.Error("output missing total cost")
+	if !strings.Contains(out.String(), `No prompts match "zebra"`) {
+		t.Errorf("output = %q, want no-match message", out.String())
 	}
 }
 
-func TestRunDBReset_NoDatabase(t *testing.T) {
+func TestRunSessionList_Tag(t *testing.T) {
 	resetFlags()
-	out := &bytes.Buffer{}
-	app := newTestApp(out)
-
-	tmpDir := t.TempDir()
-	dbPath := filepath.Join(tmpDir, "nonexistent.db")
-
-	oldGetDBPath := getDBPath
-	getDBPath = func() (string, error) { return dbPath, nil }
-	defer func() { getDBPath = oldGetDBPath }()
+	defer resetFlags()
+	setupHistoryDB(t)
+	flagSessionListTag = ""
 
-	err := runDBReset(app)
+	dbPath, _ := getDBPath()
+	store, err := session.NewStoreWithPath(dbPath)
 	if err != nil {
-		t.Errorf("runDBReset() error = %v", err)
+		t.Fatal(err)
+	}
+	if err := store.AddTag(context.Background(), "s2", "client-a"); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	out := &bytes.Buffer{}
+	root := newRootCmd(newTestApp(out))
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"session", "list", "--tag", "client-a"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "s2") || strings.Contains(out.String(), "s1 ") {
+		t.Errorf("want only the tagged session:\n%s", out.String())
+	}
+
+	out.Reset()
+	flagSessionListTag = "nobody"
+	if err := runSessionList(newTestApp(out)); err != nil {
+		t.Fatalf("runSessionList() error = %v", err)
+	}
+	if !strings.Contains(out.String(), `No sessions tagged "nobody"`) {
+		t.Errorf("output = %q, want no-match message", out.String())
+	}
+	flagSessionListTag = ""
+}
+
+func TestRankPrompts(t *testing.T) {
+	now := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	iterations := []*session.Iteration{
+		{Prompt: "a red fox", Timestamp: now},
+		{Prompt: "a lighthouse", Timestamp: now.Add(time.Minute)},
+		{Prompt: "a  red fox ", Timestamp: now.Add(2 * time.Minute)},
+		{Prompt: "make it blue", Timestamp: now.Add(3 * time.Minute)},
+		{Prompt: "", Timestamp: now.Add(4 * time.Minute)},
+		{Prompt: "a lighthouse", Timestamp: now.Add(5 * time.Minute)},
+		{Prompt: "a castle", Timestamp: now.Add(6 * time.Minute)},
+	}
+
+	got := rankPrompts(iterations)
+	want := []promptUsage{
+		{Prompt: "a lighthouse", Count: 2, LastUsed: now.Add(5 * time.Minute)},
+		{Prompt: "a red fox", Count: 2, LastUsed: now.Add(2 * time.Minute)},
+		{Prompt: "a castle", Count: 1, LastUsed: now.Add(6 * time.Minute)},
+		{Prompt: "make it blue", Count: 1, LastUsed: now.Add(3 * time.Minute)},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("rankPrompts() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRunPrompts_Top(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	setupHistoryDB(t)
+
+	dbPath, err := getDBPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 3, 16, 12, 0, 0, 0, time.Local)
+	if err := store.CreateIteration(context.Background(), &session.Iteration{
+		ID: "i4", SessionID: "s2", Operation: "generate", Prompt: "a lighthouse", Model: "dall-e-3", ImagePath: "/4.png", Timestamp: now,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	out := &bytes.Buffer{}
+	flagPromptsTop = 2
+	if err := runPrompts(newTestApp(out)); err != nil {
+		t.Fatalf("runPrompts() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), out.String())
+	}
+	if !strings.Contains(lines[0], "2x") || !strings.Contains(lines[0], "a lighthouse") {
+		t.Errorf("first line = %q, want a lighthouse used twice", lines[0])
+	}
+	if !strings.Contains(lines[1], "make it blue") {
+		t.Errorf("second line = %q, want the most recent single-use prompt", lines[1])
+	}
+}
+
+func TestPromptsCmd_TopFlag(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	promptsCmd, _, err := newRootCmd(newTestApp(&bytes.Buffer{})).Find([]string{"prompts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := promptsCmd.ParseFlags([]string{"--top", "5"}); err != nil {
+		t.Fatalf("ParseFlags(--top 5) error = %v", err)
+	}
+	if flagPromptsTop != 5 {
+		t.Errorf("--top 5 parsed as %d, want 5", flagPromptsTop)
+	}
+}
+
+func TestRunPrompts_InvalidTop(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	flagPromptsTop = 0
+
+	if err := runPrompts(newTestApp(&bytes.Buffer{})); err == nil {
+		t.Error("runPrompts() expected error for --top 0")
+	}
+}
+
+func TestRunModels(t *testing.T) {
+	resetFlags()
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+
+	if err := runModels(app); err != nil {
+		t.Fatalf("runModels() error = %v", err)
+	}
+
+	rows := make(map[string][]string)
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 7 {
+			rows[fields[0]] = fields
+		}
+	}
+	for _, name := range app.Registry.List() {
+		caps, _ := app.Registry.Get(name)
+		fields, ok := rows[name]
+		if !ok {
+			t.Errorf("output missing model %s:\n%s", name, out.String())
+			continue
+		}
+		wantEdit := map[bool]string{true: "yes", false: "no"}[caps.SupportsEdit]
+		if fields[1] != string(caps.Provider) || fields[2] != wantEdit {
+			t.Errorf("%s row = %v, want provider %s and edit %s", name, fields, caps.Provider, wantEdit)
+		}
+	}
+	if !strings.Contains(out.String(), "1792x1024  $0.0800") {
+		t.Errorf("output missing dall-e-3 wide price:\n%s", out.String())
+	}
+}
+
+func TestRunModels_JSON(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	flagJSON = true
+
+	if err := runModels(app); err != nil {
+		t.Fatalf("runModels() error = %v", err)
+	}
+
+	var infos []modelInfo
+	if err := json.Unmarshal(out.Bytes(), &infos); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if len(infos) != len(app.Registry.List()) {
+		t.Fatalf("got %d models, want %d", len(infos), len(app.Registry.List()))
+	}
+	for _, info := range infos {
+		caps, ok := app.Registry.Get(info.Name)
+		if !ok {
+			t.Errorf("unknown model %s in output", info.Name)
+			continue
+		}
+		if info.Edit != caps.SupportsEdit || info.Transparency != caps.SupportsTransparency {
+			t.Errorf("%s: edit=%t transparency=%t, want %t and %t", info.Name, info.Edit, info.Transparency, caps.SupportsEdit, caps.SupportsTransparency)
+		}
+	}
+}
+
+func TestRunDBInfo_NoDatabase(t *testing.T) {
+	resetFlags()
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "nonexistent.db")
+
+	oldGetDBPath := getDBPath
+	getDBPath = func() (string, error) { return dbPath, nil }
+	defer func() { getDBPath = oldGetDBPath }()
+
+	err := runDBInfo(app)
+	if err != nil {
+		t.Errorf("runDBInfo() error = %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "Database location:") {
+		t.Error("output missing database location")
+	}
+	if !strings.Contains(output, "does not exist") {
+		t.Error("output should indicate database doesn't exist")
+	}
+}
+
+func TestRunDBInfo_WithDatabase(t *testing.T) {
+	resetFlags()
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	ctx := context.Background()
+	store.LogCost(ctx, &session.CostEntry{
+		Provider:   "openai",
+		Model:      "gpt-image-1",
+		Cost:       0.042,
+		ImageCount: 1,
+		Timestamp:  time.Now(),
+	})
+	store.Close()
+
+	oldGetDBPath := getDBPath
+	getDBPath = func() (string, error) { return dbPath, nil }
+	defer func() { getDBPath = oldGetDBPath }()
+
+	err = runDBInfo(app)
+	if err != nil {
+		t.Errorf("runDBInfo() error = %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "Database location:") {
+		t.Error("output missing database location")
+	}
+	if !strings.Contains(output, "Database size:") {
+		t.Error("output missing database size")
+	}
+	if !strings.Contains(output, "Statistics:") {
+		t.Error("output missing statistics")
+	}
+	if !strings.Contains(output, "Sessions:") {
+		t.Error("output missing session count")
+	}
+	if !strings.Contains(output, "Total cost:") {
+		t.Error("output missing total cost")
+	}
+	if !strings.Contains(output, "Schema version:") {
+		t.Error("output missing schema version")
+	}
+}
+
+func TestRunDBReset_NoDatabase(t *testing.T) {
+	resetFlags()
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "nonexistent.db")
+
+	oldGetDBPath := getDBPath
+	getDBPath = func() (string, error) { return dbPath, nil }
+	defer func() { getDBPath = oldGetDBPath }()
+
+	err := runDBReset(app)
+	if err != nil {
+		t.Errorf("runDBReset() error = %v", err)
 	}
 
 	output := out.String()
@@ -1340,6 +2254,70 @@ func TestRunDBReset_WithBackup(t *testing.T) {
 	}
 }
 
+func TestRunDBVacuum(t *testing.T) {
+	resetFlags()
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	oldGetDBPath := getDBPath
+	getDBPath = func() (string, error) { return dbPath, nil }
+	defer func() { getDBPath = oldGetDBPath }()
+
+	if err := runDBVacuum(app); err != nil {
+		t.Fatalf("runDBVacuum() without a database error = %v", err)
+	}
+	if !strings.Contains(out.String(), "nothing to vacuum") {
+		t.Errorf("output = %q, want nothing to vacuum", out.String())
+	}
+
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	out.Reset()
+	if err := runDBVacuum(app); err != nil {
+		t.Fatalf("runDBVacuum() error = %v", err)
+	}
+	for _, want := range []string{"Database size before:", "Database size after:", "Reclaimed:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunDBCheck(t *testing.T) {
+	resetFlags()
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	oldGetDBPath := getDBPath
+	getDBPath = func() (string, error) { return dbPath, nil }
+	defer func() { getDBPath = oldGetDBPath }()
+
+	if err := runDBCheck(app); err != nil {
+		t.Fatalf("runDBCheck() without a database error = %v", err)
+	}
+	if !strings.Contains(out.String(), "nothing to check") {
+		t.Errorf("output = %q, want nothing to check", out.String())
+	}
+
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	out.Reset()
+	if err := runDBCheck(app); err != nil {
+		t.Fatalf("runDBCheck() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Integrity check passed") {
+		t.Errorf("output = %q, want the check to pass", out.String())
+	}
+}
+
 func TestGetDBPath(t *testing.T) {
 	path, err := getDBPath()
 	if err != nil {
@@ -1560,6 +2538,101 @@ func TestRunListBackups_NoBackups(t *testing.T) {
 	}
 }
 
+func TestRunListAllBackups(t *testing.T) {
+	resetFlags()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	oldWd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(oldWd)
+
+	claudeDir := filepath.Join(home, ".claude", "skills", "imggen")
+	geminiDir := filepath.Join(home, ".gemini")
+	backups := map[string]string{
+		filepath.Join(claudeDir, "SKILL.md.backup-20240101-120000"):  "old skill",
+		filepath.Join(claudeDir, "SKILL.md.backup-20240202-120000"):  strings.Repeat("x", 2048),
+		filepath.Join(geminiDir, "GEMINI.md.backup-20240303-120000"): "gemini",
+	}
+	for path, content := range backups {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	if err := runListAllBackups(app); err != nil {
+		t.Fatalf("runListAllBackups() error = %v", err)
+	}
+
+	output := out.String()
+	for _, want := range []string{
+		"Claude Code (claude):",
+		"SKILL.md.backup-20240101-120000",
+		"2.0 KB",
+		"Gemini CLI (gemini):",
+		"GEMINI.md.backup-20240303-120000 (",
+		"6 B)",
+		"OpenAI Codex CLI (codex):\n  (none)",
+		"3 backup(s)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+
+	claude := strings.Index(output, "Claude Code")
+	gemini := strings.Index(output, "Gemini CLI")
+	if claudeBackup := strings.Index(output, "SKILL.md.backup"); claudeBackup < claude || claudeBackup > gemini {
+		t.Error("claude backups should be grouped under Claude Code")
+	}
+}
+
+func TestRunListAllBackups_QuietWarning(t *testing.T) {
+	resetFlags()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// A file where the Gemini config directory should be cannot be listed.
+	if err := os.WriteFile(filepath.Join(home, ".gemini"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, quiet := range []bool{false, true} {
+		out := &bytes.Buffer{}
+		app := newTestApp(out)
+		app.Quiet = quiet
+		if err := runListAllBackups(app); err != nil {
+			t.Fatalf("runListAllBackups() error = %v", err)
+		}
+		if got := strings.Contains(out.String(), "Warning: gemini:"); got == quiet {
+			t.Errorf("quiet=%v: warning shown = %v:\n%s", quiet, got, out.String())
+		}
+	}
+}
+
+func TestNewRegisterBackupsCmd_Args(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	cmd := newRegisterBackupsCmd(newTestApp(&bytes.Buffer{}))
+
+	if err := cmd.Args(cmd, nil); err == nil {
+		t.Error("expected error without integration or --all")
+	}
+
+	flagRegisterBackupsAll = true
+	if err := cmd.Args(cmd, nil); err != nil {
+		t.Errorf("--all without args error = %v", err)
+	}
+	if err := cmd.Args(cmd, []string{"claude"}); err == nil {
+		t.Error("expected error combining --all with an integration")
+	}
+}
+
 func TestRunRollback_NonexistentFile(t *testing.T) {
 	resetFlags()
 	out := &bytes.Buffer{}
@@ -2010,3 +3083,4364 @@ func TestRunVideo_ProviderCreationError(t *testing.T) {
 		t.Errorf("error = %v, want provider creation error", err)
 	}
 }
+
+func writeTestPNG(t *testing.T, path string) {
+	t.Helper()
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, 2, 2))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
+
+func TestRunAnimate(t *testing.T) {
+	tmpDir := t.TempDir()
+	frame1 := filepath.Join(tmpDir, "1.png")
+	frame2 := filepath.Join(tmpDir, "2.png")
+	writeTestPNG(t, frame1)
+	writeTestPNG(t, frame2)
+
+	flagAnimateOutput = filepath.Join(tmpDir, "out.gif")
+	flagAnimateFPS = 4
+	defer func() { flagAnimateOutput = "animation.gif" }()
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+
+	if err := runAnimate(&cobra.Command{}, []string{frame1, frame2}, app); err != nil {
+		t.Fatalf("runAnimate() error = %v", err)
+	}
+
+	if _, err := os.Stat(flagAnimateOutput); err != nil {
+		t.Errorf("animation not written: %v", err)
+	}
+	if !strings.Contains(out.String(), "2 frames @ 4 fps") {
+		t.Errorf("output = %q, want frame summary", out.String())
+	}
+}
+
+func TestRunAnimate_WebPNotSupported(t *testing.T) {
+	flagAnimateOutput = "out.webp"
+	defer func() { flagAnimateOutput = "animation.gif" }()
+
+	err := runAnimate(&cobra.Command{}, []string{"a.png", "b.png"}, newTestApp(&bytes.Buffer{}))
+	if err == nil || !strings.Contains(err.Error(), "webp") {
+		t.Errorf("runAnimate() error = %v, want webp not supported", err)
+	}
+}
+
+func TestRunMontage(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	dir := t.TempDir()
+	for _, name := range []string{"b.png", "a.png", "c.png"} {
+		writeTestPNG(t, filepath.Join(dir, name))
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	sheet := filepath.Join(t.TempDir(), "sheet.jpg")
+	root := newRootCmd(newTestApp(out))
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"montage", dir, "-o", sheet, "--cols", "2"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+
+	f, err := os.Open(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, format, err := stdimage.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := image.SheetSize(3, image.SheetOptions{Columns: 2}); format != "jpeg" || cfg.Width != w || cfg.Height != h {
+		t.Errorf("sheet is a %dx%d %s, want a %dx%d jpeg", cfg.Width, cfg.Height, format, w, h)
+	}
+
+	resetFlags()
+	root = newRootCmd(newTestApp(out))
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"montage", t.TempDir()})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "no images found") {
+		t.Errorf("Execute(empty dir) error = %v, want no images found", err)
+	}
+}
+
+func TestRunIcon(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	var source bytes.Buffer
+	if err := png.Encode(&source, stdimage.NewNRGBA(stdimage.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+	var gotReq *models.Request
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{generateFunc: func(_ context.Context, req *models.Request) (*models.Response, error) {
+			gotReq = req
+			return &models.Response{Images: []models.GeneratedImage{{Data: source.Bytes()}}}, nil
+		}}, nil
+	}
+
+	dir := filepath.Join(t.TempDir(), "icons")
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"icon", "a fox logo", "-o", dir, "--ico", "--icns", "--api-key", "test-key"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+	if !gotReq.Transparent || gotReq.Size != "1024x1024" || gotReq.Format != models.FormatPNG {
+		t.Errorf("request = %+v, want a transparent 1024x1024 PNG", gotReq)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"icon-1024.png", "icon-128.png", "icon-16.png", "icon-256.png", "icon-32.png", "icon-48.png", "icon-512.png", "icon.icns", "icon.ico"}
+	if !slices.Equal(names, want) {
+		t.Errorf("icon files = %v, want %v", names, want)
+	}
+	for _, size := range image.IconSizes {
+		f, err := os.Open(filepath.Join(dir, fmt.Sprintf("icon-%d.png", size)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := png.DecodeConfig(f)
+		f.Close()
+		if err != nil || cfg.Width != size || cfg.Height != size {
+			t.Errorf("icon-%d.png is %dx%d, %v", size, cfg.Width, cfg.Height, err)
+		}
+	}
+}
+
+func TestRunIcon_Conflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"no transparency", []string{"-m", "dall-e-3"}, "transparency not supported"},
+		{"bad size", []string{"--sizes", "16,0"}, "--sizes must be positive"},
+		{"ico too large", []string{"--sizes", "512,1024", "--ico"}, "--ico needs a size of 256 or less"},
+		{"icns without slot", []string{"--sizes", "48", "--icns"}, "--icns needs one of"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			called := false
+			app := newTestApp(&bytes.Buffer{})
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				called = true
+				return &mockProvider{}, nil
+			}
+			root := newRootCmd(app)
+			root.SetOut(&bytes.Buffer{})
+			root.SetErr(&bytes.Buffer{})
+			root.SetArgs(append([]string{"icon", "a fox", "--api-key", "test-key"}, tt.args...))
+			if err := root.Execute(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+			}
+			if called {
+				t.Error("provider created for a rejected icon request")
+			}
+		})
+	}
+}
+
+func TestRunGenerate_PreviewQuality_Confirmed(t *testing.T) {
+	resetFlags()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	oldWd, _ := os.Getwd()
+	os.Chdir(tmpDir)
+	defer os.Chdir(oldWd)
+
+	var qualities []string
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.In = strings.NewReader("y\n")
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			qualities = append(qualities, req.Quality)
+			return &models.Response{
+				Images: []models.GeneratedImage{{Data: []byte("img")}},
+				Cost:   &models.CostInfo{PerImage: 0.01, Total: 0.01},
+			}, nil
+		}}, nil
+	}
+
+	flagAPIKey = "test-key"
+	flagQuality = "high"
+	flagPreviewQuality = "low"
+	flagOutput = "final.png"
+
+	if err := runGenerate(&cobra.Command{}, []string{"a fox"}, app); err != nil {
+		t.Fatalf("runGenerate() error = %v", err)
+	}
+
+	if len(qualities) != 2 || qualities[0] != "low" || qualities[1] != "high" {
+		t.Errorf("generated qualities = %v, want [low high]", qualities)
+	}
+	for _, path := range []string{"final-preview.png", "final.png"} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to be saved: %v", path, err)
+		}
+	}
+
+	store, err := session.NewStoreWithPath(filepath.Join(tmpDir, ".imggen", "sessions.db"))
+	if err != nil {
+		t.Fatalf("NewStoreWithPath() error = %v", err)
+	}
+	defer store.Close()
+	summary, err := store.GetTotalCost(context.Background())
+	if err != nil {
+		t.Fatalf("GetTotalCost() error = %v", err)
+	}
+	if summary.EntryCount != 2 {
+		t.Errorf("logged %d cost entries, want 2 (preview and final)", summary.EntryCount)
+	}
+}
+
+func TestRunGenerate_PreviewQuality_Declined(t *testing.T) {
+	resetFlags()
+	tmpDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tmpDir)
+	defer os.Chdir(oldWd)
+
+	calls := 0
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.In = strings.NewReader("n\n")
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			calls++
+			return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+		}}, nil
+	}
+
+	flagAPIKey = "test-key"
+	flagPreviewQuality = "low"
+
+	if err := runGenerate(&cobra.Command{}, []string{"a fox"}, app); err != nil {
+		t.Fatalf("runGenerate() error = %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("Generate called %d times, want 1 (preview only)", calls)
+	}
+	if !strings.Contains(out.String(), "Skipped final generation") {
+		t.Errorf("output = %q, want skip message", out.String())
+	}
+}
+
+func TestRunGenerate_PreviewQuality_Invalid(t *testing.T) {
+	resetFlags()
+	app := newTestApp(&bytes.Buffer{})
+	flagAPIKey = "test-key"
+	flagPreviewQuality = "ultra"
+
+	err := runGenerate(&cobra.Command{}, []string{"a fox"}, app)
+	if err == nil || !strings.Contains(err.Error(), "invalid preview quality") {
+		t.Errorf("runGenerate() error = %v, want invalid preview quality", err)
+	}
+}
+
+func TestRunGenerate_ExplainOnly(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "")
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	providerCreated := false
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		providerCreated = true
+		return &mockProvider{}, nil
+	}
+
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"a lighthouse", "-m", "dall-e-3", "-q", "hd", "--explain-only"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+
+	if !flagDryRun {
+		t.Error("--explain-only did not set --dry-run")
+	}
+	if providerCreated {
+		t.Error("--explain-only should not create a provider")
+	}
+
+	output := out.String()
+	for _, want := range []string{
+		"Dry run: nothing will be sent to the API.",
+		"prompt:      a lighthouse",
+		"model:       dall-e-3",
+		"size:        1024x1024",
+		"quality:     hd",
+		"format:      png",
+		"transparent: false",
+		"count:       1",
+		"Estimated cost: $0.0800",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("explain output missing %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestRunGenerate_ExplainProceeds(t *testing.T) {
+	resetFlags()
+	tmpDir := t.TempDir()
+	oldWd, _ := os.Getwd()
+	os.Chdir(tmpDir)
+	defer os.Chdir(oldWd)
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	flagAPIKey = "test-key"
+	flagExplain = true
+
+	if err := runGenerate(&cobra.Command{}, []string{"a lighthouse"}, app); err != nil {
+		t.Fatalf("runGenerate() error = %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "Resolved request:") || !strings.Contains(output, "Done!") {
+		t.Errorf("output = %q, want explanation followed by generation", output)
+	}
+}
+
+func TestRunCost_Locale(t *testing.T) {
+	resetFlags()
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	store.LogCost(context.Background(), &session.CostEntry{
+		Provider:   "openai",
+		Model:      "gpt-image-1",
+		Cost:       1234.5678,
+		ImageCount: 1,
+		Timestamp:  time.Now(),
+	})
+	store.Close()
+
+	oldGetDBPath := getDBPath
+	getDBPath = func() (string, error) { return dbPath, nil }
+	defer func() { getDBPath = oldGetDBPath }()
+
+	flagLocale = "en-US"
+	if err := runCost(app, []string{"total"}); err != nil {
+		t.Fatalf("runCost() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Total cost: $1,234.5678") {
+		t.Errorf("output = %q, want grouped total", out.String())
+	}
+
+	flagLocale = "klingon"
+	if err := runCost(app, []string{"total"}); err == nil {
+		t.Error("runCost() error = nil, want unsupported locale error")
+	}
+}
+
+type memKeyBackend struct {
+	items map[string]string
+}
+
+func (b *memKeyBackend) Name() string                        { return "keychain" }
+func (b *memKeyBackend) Get(provider string) (string, error) { return b.items[provider], nil }
+func (b *memKeyBackend) Set(provider, key string) error      { b.items[provider] = key; return nil }
+func (b *memKeyBackend) Delete(provider string) error        { delete(b.items, provider); return nil }
+
+func TestRunKeysMigrate(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		wantKept bool
+	}{
+		{name: "remove plaintext", answer: "y\n", wantKept: false},
+		{name: "keep plaintext", answer: "n\n", wantKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			t.Setenv("IMGGEN_CONFIG_DIR", t.TempDir())
+			t.Setenv("OPENAI_API_KEY", "")
+
+			file, err := keys.NewStore()
+			if err != nil {
+				t.Fatalf("NewStore() error = %v", err)
+			}
+			file.Set("openai", "sk-test-migrate-key")
+			keychain := &memKeyBackend{items: make(map[string]string)}
+
+			oldOpen := openKeyBackend
+			openKeyBackend = func(name string) (keys.Backend, error) {
+				if name == "keychain" {
+					return keychain, nil
+				}
+				return keys.OpenBackend(name)
+			}
+			defer func() { openKeyBackend = oldOpen }()
+
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			app.In = strings.NewReader(tt.answer)
+			flagKeysMigrateTo = "keychain"
+
+			if err := runKeysMigrate(app); err != nil {
+				t.Fatalf("runKeysMigrate() error = %v", err)
+			}
+			if keychain.items["openai"] != "sk-test-migrate-key" {
+				t.Errorf("keychain key = %q, want migrated key", keychain.items["openai"])
+			}
+			if !strings.Contains(out.String(), "file -> keychain") {
+				t.Errorf("output = %q, want migration report", out.String())
+			}
+
+			kept, _ := file.Get("openai")
+			if (kept != "") != tt.wantKept {
+				t.Errorf("file key = %q, wantKept %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestRunKeysMigrate_SameBackend(t *testing.T) {
+	resetFlags()
+	flagKeysMigrateTo = "file"
+
+	if err := runKeysMigrate(newTestApp(&bytes.Buffer{})); err == nil {
+		t.Error("runKeysMigrate() error = nil, want error for identical backends")
+	}
+}
+
+func TestRunKeysMigrate_UnsupportedBackend(t *testing.T) {
+	resetFlags()
+	t.Setenv("IMGGEN_CONFIG_DIR", t.TempDir())
+	flagKeysMigrateTo = "keychain"
+
+	err := runKeysMigrate(newTestApp(&bytes.Buffer{}))
+	if !errors.Is(err, keys.ErrBackendUnavailable) {
+		t.Errorf("runKeysMigrate() error = %v, want ErrBackendUnavailable", err)
+	}
+}
+
+func TestDefaultApp_NewProviderRoutesByProvider(t *testing.T) {
+	app := DefaultApp()
+
+	for _, providerType := range []models.ProviderType{models.ProviderOpenAI, models.ProviderStability} {
+		prov, err := app.NewProvider(&provider.Config{Provider: providerType, APIKey: "test-key"}, app.Registry)
+		if err != nil {
+			t.Fatalf("NewProvider(%s) error = %v", providerType, err)
+		}
+		if prov.Name() != providerType {
+			t.Errorf("NewProvider(%s) built %s provider", providerType, prov.Name())
+		}
+	}
+}
+
+func TestRunGenerate_StabilityModel(t *testing.T) {
+	resetFlags()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("IMGGEN_CONFIG_DIR", t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("STABILITY_API_KEY", "sk-stability")
+
+	oldWd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(oldWd)
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	var gotCfg *provider.Config
+	var gotReq *models.Request
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		gotCfg = cfg
+		return &mockProvider{generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			gotReq = req
+			return &models.Response{
+				Images: []models.GeneratedImage{{Data: []byte("fake"), Index: 0}},
+				Cost:   &models.CostInfo{PerImage: 0.009, Total: 0.009, Currency: "USD"},
+			}, nil
+		}}, nil
+	}
+
+	flagModel = "stable-diffusion-xl"
+	flagSeed = 1234
+
+	if err := runGenerate(&cobra.Command{}, []string{"a lighthouse"}, app); err != nil {
+		t.Fatalf("runGenerate() error = %v", err)
+	}
+
+	if gotCfg.Provider != models.ProviderStability || gotCfg.APIKey != "sk-stability" {
+		t.Errorf("provider config = %+v, want stability with STABILITY_API_KEY", gotCfg)
+	}
+	if gotReq.Seed != 1234 {
+		t.Errorf("request seed = %d, want 1234", gotReq.Seed)
+	}
+}
+
+func TestRunGenerate_SeedNotSupported(t *testing.T) {
+	resetFlags()
+	app := newTestApp(&bytes.Buffer{})
+	flagAPIKey = "test-key"
+	flagSeed = 42
+
+	err := runGenerate(&cobra.Command{}, []string{"a lighthouse"}, app)
+	if !errors.Is(err, models.ErrSeedNotSupported) {
+		t.Errorf("runGenerate() error = %v, want ErrSeedNotSupported", err)
+	}
+}
+
+func TestRunKeysWhich(t *testing.T) {
+	tests := []struct {
+		name       string
+		flag       string
+		stored     string
+		env        string
+		wantSource string
+		wantMasked string
+	}{
+		{"flag", "sk-flag-key-000001", "sk-stored-key-0001", "sk-env-key-0000001", "flag", "sk-f**********0001"},
+		{"stored", "", "sk-stored-key-0001", "sk-env-key-0000001", "stored key for openai", "sk-s**********0001"},
+		{"env", "", "", "sk-env-key-0000001", "environment OPENAI_API_KEY", "sk-e**********0001"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			t.Setenv("IMGGEN_CONFIG_DIR", t.TempDir())
+			t.Setenv("OPENAI_API_KEY", tt.env)
+			if tt.stored != "" {
+				store, _ := keys.NewStore()
+				store.Set("openai", tt.stored)
+			}
+			flagAPIKey = tt.flag
+
+			out := &bytes.Buffer{}
+			if err := runKeysWhich(newTestApp(out)); err != nil {
+				t.Fatalf("runKeysWhich() error = %v", err)
+			}
+
+			output := out.String()
+			if !strings.Contains(output, "Source:   "+tt.wantSource) {
+				t.Errorf("output = %q, want source %q", output, tt.wantSource)
+			}
+			if !strings.Contains(output, tt.wantMasked) {
+				t.Errorf("output = %q, want masked key %q", output, tt.wantMasked)
+			}
+			for _, full := range []string{tt.flag, tt.stored, tt.env} {
+				if full != "" && strings.Contains(output, full) {
+					t.Errorf("output reveals full key %q", full)
+				}
+			}
+		})
+	}
+}
+
+func TestRunKeysWhich_NoKey(t *testing.T) {
+	resetFlags()
+	t.Setenv("IMGGEN_CONFIG_DIR", t.TempDir())
+	t.Setenv("STABILITY_API_KEY", "")
+	flagKeysWhichProvider = "stability"
+
+	err := runKeysWhich(newTestApp(&bytes.Buffer{}))
+	if err == nil || !strings.Contains(err.Error(), "STABILITY_API_KEY") {
+		t.Errorf("runKeysWhich() error = %v, want missing STABILITY_API_KEY", err)
+	}
+}
+
+func TestNewProviderConfig_MaxInflightPerHost(t *testing.T) {
+	resetFlags()
+	flagMaxInflightPerHost = 3
+
+	cfg := newProviderConfig(models.ProviderOpenAI, "test-key")
+	if cfg.MaxInflightPerHost != 3 {
+		t.Errorf("MaxInflightPerHost = %d, want 3", cfg.MaxInflightPerHost)
+	}
+}
+
+func TestNewProviderConfig_SavePaths(t *testing.T) {
+	resetFlags()
+	flagSaveRequest = "req.json"
+	flagSaveResponse = "resp.json"
+
+	cfg := newProviderConfig(models.ProviderOpenAI, "test-key")
+	if cfg.SaveRequestPath != "req.json" || cfg.SaveResponsePath != "resp.json" {
+		t.Errorf("save paths = %q, %q; want req.json, resp.json", cfg.SaveRequestPath, cfg.SaveResponsePath)
+	}
+}
+
+func TestNewProviderConfig_ProxyAndCACert(t *testing.T) {
+	resetFlags()
+	t.Setenv("HOME", "/home/me")
+	flagProxy = "proxy.corp:8080"
+	flagCACert = "~/certs/corp-ca.pem"
+
+	cfg := newProviderConfig(models.ProviderOpenAI, "test-key")
+	if cfg.HTTPProxy != "proxy.corp:8080" {
+		t.Errorf("HTTPProxy = %q, want proxy.corp:8080", cfg.HTTPProxy)
+	}
+	if want := filepath.Join("/home/me", "certs", "corp-ca.pem"); cfg.CACertFile != want {
+		t.Errorf("CACertFile = %q, want %q", cfg.CACertFile, want)
+	}
+}
+
+func TestNewProviderConfig_Timeout(t *testing.T) {
+	resetFlags()
+	flagTimeout = 5 * time.Minute
+
+	got := newProviderConfig(models.ProviderOpenAI, "test-key").Timeouts()
+	want := provider.Timeouts{Generate: 5 * time.Minute, Edit: 5 * time.Minute, Download: 5 * time.Minute, OCR: 5 * time.Minute}
+	if got != want {
+		t.Errorf("Timeouts() = %+v, want %+v", got, want)
+	}
+
+	flagTimeout = 0
+	if got := newProviderConfig(models.ProviderOpenAI, "test-key").Timeouts(); got.OCR != provider.DefaultOCRTimeout {
+		t.Errorf("OCR timeout = %s, want the default %s", got.OCR, provider.DefaultOCRTimeout)
+	}
+}
+
+// mockVariationProvider adds variation support to mockProvider.
+type mockVariationProvider struct {
+	mockProvider
+	gotReq *models.VariationRequest
+}
+
+func (m *mockVariationProvider) Variations(ctx context.Context, req *models.VariationRequest) (*models.Response, error) {
+	m.gotReq = req
+	resp := &models.Response{Cost: &models.CostInfo{PerImage: 0.02, Total: 0.02 * float64(req.Count), Currency: "USD"}}
+	for i := 0; i < req.Count; i++ {
+		resp.Images = append(resp.Images, models.GeneratedImage{Data: []byte("variant"), Index: i})
+	}
+	return resp, nil
+}
+
+func (m *mockVariationProvider) SupportsVariations(model string) bool {
+	return model == "dall-e-2"
+}
+
+func TestRunVary(t *testing.T) {
+	resetFlags()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	source := filepath.Join(tmpDir, "source.png")
+	writeTestPNG(t, source)
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	prov := &mockVariationProvider{}
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return prov, nil
+	}
+
+	flagAPIKey = "test-key"
+	flagVaryCount = 2
+	flagVaryOutput = filepath.Join(tmpDir, "variant.png")
+
+	if err := runVary(&cobra.Command{}, []string{source}, app); err != nil {
+		t.Fatalf("runVary() error = %v", err)
+	}
+
+	if prov.gotReq.Count != 2 || prov.gotReq.Size != "1024x1024" {
+		t.Errorf("request = %+v, want 2 variations at the default size", prov.gotReq)
+	}
+	for _, name := range []string{"variant-1.png", "variant-2.png"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("expected %s to be saved: %v", name, err)
+		}
+	}
+	if !strings.Contains(out.String(), "Cost: $0.0400") {
+		t.Errorf("output = %q, want cost line", out.String())
+	}
+}
+
+func TestRunVary_UnsupportedModel(t *testing.T) {
+	resetFlags()
+	source := filepath.Join(t.TempDir(), "source.png")
+	writeTestPNG(t, source)
+
+	flagAPIKey = "test-key"
+	flagVaryModel = "gpt-image-1"
+
+	err := runVary(&cobra.Command{}, []string{source}, newTestApp(&bytes.Buffer{}))
+	if !errors.Is(err, models.ErrVariationsNotSupported) {
+		t.Errorf("runVary() error = %v, want ErrVariationsNotSupported", err)
+	}
+}
+
+func TestRunVary_InvalidEncodeOptions(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	source := filepath.Join(t.TempDir(), "source.png")
+	writeTestPNG(t, source)
+
+	flagAPIKey = "test-key"
+	flagWebPQuality = 101
+
+	err := runVary(&cobra.Command{}, []string{source}, newTestApp(&bytes.Buffer{}))
+	if err == nil || !strings.Contains(err.Error(), "invalid encoding options") {
+		t.Errorf("runVary() error = %v, want invalid encoding options", err)
+	}
+}
+
+func TestRunVary_InvalidSize(t *testing.T) {
+	resetFlags()
+	source := filepath.Join(t.TempDir(), "source.png")
+	writeTestPNG(t, source)
+
+	flagAPIKey = "test-key"
+	flagVarySize = "1792x1024"
+
+	err := runVary(&cobra.Command{}, []string{source}, newTestApp(&bytes.Buffer{}))
+	if !errors.Is(err, models.ErrInvalidSize) {
+		t.Errorf("runVary() error = %v, want ErrInvalidSize", err)
+	}
+}
+
+// mockEditProvider adds edit support to mockProvider.
+type mockEditProvider struct {
+	mockProvider
+	gotReq   *models.EditRequest
+	editErr  error
+	editData []byte
+}
+
+func (m *mockEditProvider) Edit(_ context.Context, req *models.EditRequest) (*models.Response, error) {
+	m.gotReq = req
+	if m.editErr != nil {
+		return nil, m.editErr
+	}
+	resp := &models.Response{Cost: &models.CostInfo{PerImage: 0.04, Total: 0.04 * float64(req.Count), Currency: "USD"}}
+	data := m.editData
+	if data == nil {
+		data = []byte("edited")
+	}
+	for i := range req.Count {
+		resp.Images = append(resp.Images, models.GeneratedImage{Data: data, Index: i})
+	}
+	return resp, nil
+}
+
+func (m *mockEditProvider) SupportsEdit(_ string) bool {
+	return true
+}
+
+func TestRunEdit(t *testing.T) {
+	resetFlags()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	source := filepath.Join(tmpDir, "source.png")
+	mask := filepath.Join(tmpDir, "mask.png")
+	writeTestPNG(t, source)
+	writeTestPNG(t, mask)
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	prov := &mockEditProvider{}
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return prov, nil
+	}
+
+	flagAPIKey = "test-key"
+	flagEditMask = mask
+	flagEditOutput = filepath.Join(tmpDir, "out.png")
+
+	if err := runEdit(&cobra.Command{}, []string{source, "make the sky purple"}, app); err != nil {
+		t.Fatalf("runEdit() error = %v", err)
+	}
+
+	if prov.gotReq.Prompt != "make the sky purple" || prov.gotReq.Model != "gpt-image-1" {
+		t.Errorf("request = %+v, want prompt and default model", prov.gotReq)
+	}
+	if len(prov.gotReq.Image) == 0 || len(prov.gotReq.Mask) == 0 {
+		t.Error("expected image and mask data in the request")
+	}
+	if _, err := os.Stat(flagEditOutput); err != nil {
+		t.Errorf("expected edited image to be saved: %v", err)
+	}
+	if !strings.Contains(out.String(), "Cost: $0.0400") {
+		t.Errorf("output = %q, want cost line", out.String())
+	}
+
+	store, err := session.NewStoreWithPath(filepath.Join(tmpDir, ".imggen", "sessions.db"))
+	if err != nil {
+		t.Fatalf("NewStoreWithPath() error = %v", err)
+	}
+	defer store.Close()
+	summary, err := store.GetTotalCost(context.Background())
+	if err != nil {
+		t.Fatalf("GetTotalCost() error = %v", err)
+	}
+	if summary.EntryCount != 1 {
+		t.Errorf("logged %d cost entries, want 1", summary.EntryCount)
+	}
+}
+
+func TestRunEdit_ConfirmAbove(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	defer func(orig func() bool) { isTerminal = orig }(isTerminal)
+	isTerminal = func() bool { return true }
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	source := filepath.Join(tmpDir, "source.png")
+	writeTestPNG(t, source)
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.In = strings.NewReader("\n")
+	prov := &mockEditProvider{}
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return prov, nil
+	}
+
+	flagAPIKey = "test-key"
+	flagEditCount = 10
+	flagEditOutput = filepath.Join(tmpDir, "out.png")
+	flagConfirmAbove = 0.25
+
+	if err := runEdit(&cobra.Command{}, []string{source, "make the sky purple"}, app); err != nil {
+		t.Fatalf("runEdit() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "--confirm-above limit. Continue? [y/N]") || !strings.Contains(out.String(), "Aborted.") {
+		t.Errorf("output = %q, want the question answered no by default", out.String())
+	}
+	if prov.gotReq != nil {
+		t.Error("edit was sent after the question was declined")
+	}
+
+	// The estimate uses the model's default quality from the registry.
+	caps, _ := app.Registry.Get("gpt-image-1")
+	high := *caps
+	high.DefaultQuality = "high"
+	app.Registry.Register(&high)
+	out.Reset()
+	app.In = strings.NewReader("\n")
+	if err := runEdit(&cobra.Command{}, []string{source, "make the sky purple"}, app); err != nil {
+		t.Fatalf("runEdit() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Estimated cost $1.6700") {
+		t.Errorf("output = %q, want the estimate at the registry's high quality", out.String())
+	}
+}
+
+func TestRunEdit_AutoResize(t *testing.T) {
+	resetFlags()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, stdimage.NewRGBA(stdimage.Rect(0, 0, 2048, 2048))); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(tmpDir, "large.png")
+	if err := os.WriteFile(source, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	prov := &mockEditProvider{}
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return prov, nil
+	}
+
+	flagAPIKey = "test-key"
+	flagEditModel = "dall-e-2"
+	flagEditResize = true
+	flagEditOutput = filepath.Join(tmpDir, "out.png")
+
+	if err := runEdit(&cobra.Command{}, []string{source, "add snow"}, app); err != nil {
+		t.Fatalf("runEdit() error = %v", err)
+	}
+
+	cfg, err := png.DecodeConfig(bytes.NewReader(prov.gotReq.Image))
+	if err != nil {
+		t.Fatalf("uploaded image is not a PNG: %v", err)
+	}
+	if cfg.Width != 1024 || cfg.Height != 1024 {
+		t.Errorf("uploaded image is %dx%d, want 1024x1024", cfg.Width, cfg.Height)
+	}
+	if !strings.Contains(out.String(), "Resized image to fit model limits") {
+		t.Errorf("output = %q, want resize note", out.String())
+	}
+}
+
+func TestRunEdit_AutoResizeMatchesMask(t *testing.T) {
+	resetFlags()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+
+	writePNG := func(name string, w, h int) string {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, stdimage.NewRGBA(stdimage.Rect(0, 0, w, h))); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	source := writePNG("wide.png", 2048, 1024)
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	prov := &mockEditProvider{}
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return prov, nil
+	}
+
+	flagAPIKey = "test-key"
+	flagEditModel = "dall-e-2"
+	flagEditResize = true
+	flagEditMask = writePNG("mask.png", 1024, 1024)
+	flagEditOutput = filepath.Join(tmpDir, "out.png")
+
+	if err := runEdit(&cobra.Command{}, []string{source, "add snow"}, app); err != nil {
+		t.Fatalf("runEdit() error = %v", err)
+	}
+
+	for name, data := range map[string][]byte{"image": prov.gotReq.Image, "mask": prov.gotReq.Mask} {
+		cfg, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("uploaded %s is not a PNG: %v", name, err)
+		}
+		if cfg.Width != 1024 || cfg.Height != 512 {
+			t.Errorf("uploaded %s is %dx%d, want 1024x512", name, cfg.Width, cfg.Height)
+		}
+	}
+	if !strings.Contains(out.String(), "Resized mask to match the image") {
+		t.Errorf("output = %q, want mask resize note", out.String())
+	}
+}
+
+func TestRunEdit_MultipleImages(t *testing.T) {
+	resetFlags()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	a, b := filepath.Join(tmpDir, "a.png"), filepath.Join(tmpDir, "b.png")
+	writeTestPNG(t, a)
+	if err := os.WriteFile(b, []byte("second image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	prov := &mockEditProvider{}
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return prov, nil
+	}
+
+	flagAPIKey = "test-key"
+	flagEditOutput = filepath.Join(tmpDir, "out.png")
+
+	if err := runEdit(&cobra.Command{}, []string{a, b, "combine them"}, app); err != nil {
+		t.Fatalf("runEdit() error = %v", err)
+	}
+	if prov.gotReq.Prompt != "combine them" {
+		t.Errorf("prompt = %q, want %q", prov.gotReq.Prompt, "combine them")
+	}
+	if len(prov.gotReq.Images) != 2 || string(prov.gotReq.Images[1]) != "second image" {
+		t.Errorf("request has %d images, want a.png and b.png", len(prov.gotReq.Images))
+	}
+	if !bytes.Equal(prov.gotReq.Image, prov.gotReq.Images[0]) {
+		t.Error("Image is not the first of Images")
+	}
+	if !strings.Contains(out.String(), "Editing "+a+", "+b+" with gpt-image-1") {
+		t.Errorf("output = %q, want both inputs listed", out.String())
+	}
+
+	resetFlags()
+	flagAPIKey = "test-key"
+	flagEditModel = "dall-e-2"
+	err := runEdit(&cobra.Command{}, []string{a, b, "combine them"}, app)
+	if !errors.Is(err, models.ErrTooManyEditImages) || !strings.Contains(err.Error(), "dall-e-2 combines at most 1, got 2") {
+		t.Errorf("runEdit(dall-e-2) error = %v, want ErrTooManyEditImages", err)
+	}
+}
+
+func TestMaxSizeDimension(t *testing.T) {
+	if got := maxSizeDimension([]string{"1024x1024", "1536x1024", "1024x1536", "auto"}); got != 1536 {
+		t.Errorf("maxSizeDimension() = %d, want 1536", got)
+	}
+	if got := maxSizeDimension([]string{"auto"}); got != 0 {
+		t.Errorf("maxSizeDimension() = %d, want 0", got)
+	}
+}
+
+func TestRunEdit_EncodeOptions(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	source := filepath.Join(tmpDir, "source.png")
+	writeTestPNG(t, source)
+
+	gradient := stdimage.NewRGBA(stdimage.Rect(0, 0, 64, 64))
+	for y := range 64 {
+		for x := range 64 {
+			gradient.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8(x ^ y), A: 0xFF})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, gradient); err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp(&bytes.Buffer{})
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockEditProvider{editData: buf.Bytes()}, nil
+	}
+
+	sizes := map[int]int64{}
+	for _, quality := range []int{10, 100} {
+		flagAPIKey = "test-key"
+		flagJPEGQuality = quality
+		flagEditOutput = filepath.Join(tmpDir, fmt.Sprintf("q%d.jpg", quality))
+		if err := runEdit(&cobra.Command{}, []string{source, "warmer light"}, app); err != nil {
+			t.Fatalf("runEdit(--jpeg-quality %d) error = %v", quality, err)
+		}
+		data, err := os.ReadFile(flagEditOutput)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := jpeg.DecodeConfig(bytes.NewReader(data)); err != nil {
+			t.Fatalf("%s is not a JPEG: %v", flagEditOutput, err)
+		}
+		sizes[quality] = int64(len(data))
+	}
+	if sizes[10] >= sizes[100] {
+		t.Errorf("--jpeg-quality 10 wrote %d bytes, want fewer than the %d at 100", sizes[10], sizes[100])
+	}
+
+	flagJPEGQuality = 0
+	if err := runEdit(&cobra.Command{}, []string{source, "warmer light"}, app); err == nil || !strings.Contains(err.Error(), "invalid encoding options") {
+		t.Errorf("runEdit(--jpeg-quality 0) error = %v, want invalid encoding options", err)
+	}
+}
+
+func TestRunEdit_UnsupportedModel(t *testing.T) {
+	resetFlags()
+	source := filepath.Join(t.TempDir(), "source.png")
+	writeTestPNG(t, source)
+
+	flagAPIKey = "test-key"
+	flagEditModel = "dall-e-3"
+
+	err := runEdit(&cobra.Command{}, []string{source, "a prompt"}, newTestApp(&bytes.Buffer{}))
+	if !errors.Is(err, models.ErrEditNotSupported) {
+		t.Errorf("runEdit() error = %v, want ErrEditNotSupported", err)
+	}
+}
+
+func TestRunEdit_ProviderNotSupported(t *testing.T) {
+	resetFlags()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	source := filepath.Join(tmpDir, "source.png")
+	writeTestPNG(t, source)
+
+	app := newTestApp(&bytes.Buffer{})
+	prov := &mockEditProvider{editErr: fmt.Errorf("%w: gpt-image-1", provider.ErrEditNotSupported)}
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return prov, nil
+	}
+	flagAPIKey = "test-key"
+
+	err := runEdit(&cobra.Command{}, []string{source, "a prompt"}, app)
+	if !errors.Is(err, provider.ErrEditNotSupported) {
+		t.Errorf("runEdit() error = %v, want provider.ErrEditNotSupported", err)
+	}
+}
+
+func TestRunEdit_MissingMask(t *testing.T) {
+	resetFlags()
+	tmpDir := t.TempDir()
+	source := filepath.Join(tmpDir, "source.png")
+	writeTestPNG(t, source)
+
+	flagAPIKey = "test-key"
+	flagEditMask = filepath.Join(tmpDir, "missing.png")
+
+	err := runEdit(&cobra.Command{}, []string{source, "a prompt"}, newTestApp(&bytes.Buffer{}))
+	if err == nil || !strings.Contains(err.Error(), "failed to read mask") {
+		t.Errorf("runEdit() error = %v, want mask read error", err)
+	}
+}
+
+func TestRunEdit_SizeAlias(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	source := filepath.Join(tmpDir, "source.png")
+	writeTestPNG(t, source)
+
+	app := newTestApp(&bytes.Buffer{})
+	prov := &mockEditProvider{}
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return prov, nil
+	}
+	flagAPIKey = "test-key"
+	flagEditSize = "landscape"
+	flagEditOutput = filepath.Join(tmpDir, "out.png")
+
+	if err := runEdit(&cobra.Command{}, []string{source, "wider"}, app); err != nil {
+		t.Fatalf("runEdit() error = %v", err)
+	}
+	if prov.gotReq.Size != "1536x1024" {
+		t.Errorf("size = %q, want landscape resolved to 1536x1024 for gpt-image-1", prov.gotReq.Size)
+	}
+
+	flagEditModel = "dall-e-2"
+	err := runEdit(&cobra.Command{}, []string{source, "wider"}, app)
+	if !errors.Is(err, models.ErrInvalidSize) {
+		t.Errorf("runEdit() error = %v, want ErrInvalidSize for an alias dall-e-2 lacks", err)
+	}
+}
+
+func TestRunEdit_CopyEXIF(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, stdimage.NewGray(stdimage.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+	// A big-endian TIFF whose first IFD holds a single Make tag.
+	exif := []byte("MM\x00*\x00\x00\x00\x08\x00\x01" +
+		"\x01\x0f\x00\x02\x00\x00\x00\x06\x00\x00\x00\x1a" +
+		"\x00\x00\x00\x00Acme!\x00")
+	tagged, err := image.WriteEXIF(plain, exif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(tmpDir, "photo.png")
+	if err := os.WriteFile(source, tagged, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockEditProvider{editData: plain}, nil
+	}
+	flagAPIKey = "test-key"
+	flagEditInEXIF = true
+	flagEditOutput = filepath.Join(tmpDir, "out.png")
+
+	if err := runEdit(&cobra.Command{}, []string{source, "warmer light"}, app); err != nil {
+		t.Fatalf("runEdit() error = %v", err)
+	}
+	saved, err := os.ReadFile(flagEditOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := image.ReadEXIF(saved)
+	if err != nil || !bytes.Contains(got, []byte("Acme!")) {
+		t.Errorf("output EXIF = %q, %v, want the source's Make tag", got, err)
+	}
+	if !strings.Contains(out.String(), "Copied EXIF metadata to 1 image(s)") {
+		t.Errorf("output = %q, want a note about the copied EXIF", out.String())
+	}
+
+	// A source without EXIF leaves the output untouched.
+	bare := filepath.Join(tmpDir, "bare.png")
+	if err := os.WriteFile(bare, plain, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	flagEditInEXIF = false
+	flagEditEXIF = bare
+	flagEditOutput = filepath.Join(tmpDir, "out2.png")
+	if err := runEdit(&cobra.Command{}, []string{source, "warmer light"}, app); err != nil {
+		t.Fatalf("runEdit() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "No EXIF metadata in "+bare) {
+		t.Errorf("output = %q, want a note that the source has no EXIF", out.String())
+	}
+	if saved, _ := os.ReadFile(flagEditOutput); !bytes.Equal(saved, plain) {
+		t.Error("output should be saved unchanged when there is no EXIF to copy")
+	}
+}
+
+func TestEditCmd_CopyEXIFFlags(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	app := newTestApp(&bytes.Buffer{})
+	editCmd, _, err := newRootCmd(app).Find([]string{"edit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := editCmd.ParseFlags([]string{"--copy-exif-from", "input", "photo.png", "warmer light"}); err != nil {
+		t.Fatal(err)
+	}
+	if flagEditEXIF != "input" || flagEditInEXIF {
+		t.Errorf("--copy-exif-from input parsed as %q, %v; want the file named input", flagEditEXIF, flagEditInEXIF)
+	}
+
+	flagEditInEXIF = true
+	err = checkConflicts(app, []string{"photo.png", "warmer light"}, editConflicts)
+	if err == nil || !strings.Contains(err.Error(), "--copy-exif cannot be used with --copy-exif-from") {
+		t.Errorf("checkConflicts() error = %v, want the two EXIF flags rejected together", err)
+	}
+}
+
+func TestRunEdit_MaskFromAlpha(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+
+	// Opaque except for a transparent top row.
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, 4, 4))
+	for i := 3; i < len(img.Pix); i += 4 {
+		if i >= 4*4 {
+			img.Pix[i] = 0xFF
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(tmpDir, "cutout.png")
+	if err := os.WriteFile(source, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp(&bytes.Buffer{})
+	prov := &mockEditProvider{}
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return prov, nil
+	}
+	flagAPIKey = "test-key"
+	flagEditAlpha = true
+	flagEditOutput = filepath.Join(tmpDir, "out.png")
+
+	if err := runEdit(&cobra.Command{}, []string{source, "add a window"}, app); err != nil {
+		t.Fatalf("runEdit() error = %v", err)
+	}
+	mask, err := png.Decode(bytes.NewReader(prov.gotReq.Mask))
+	if err != nil {
+		t.Fatalf("uploaded mask is not a PNG: %v", err)
+	}
+	if _, _, _, a := mask.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("mask alpha at transparent pixel = %#x, want 0", a)
+	}
+	if _, _, _, a := mask.At(0, 1).RGBA(); a != 0xFFFF {
+		t.Errorf("mask alpha at opaque pixel = %#x, want 0xffff", a)
+	}
+
+	buf.Reset()
+	if err := png.Encode(&buf, stdimage.NewGray(stdimage.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	opaque := filepath.Join(tmpDir, "opaque.png")
+	if err := os.WriteFile(opaque, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = runEdit(&cobra.Command{}, []string{opaque, "add a window"}, app)
+	if !errors.Is(err, image.ErrNoAlpha) {
+		t.Errorf("runEdit() on an opaque image error = %v, want image.ErrNoAlpha", err)
+	}
+
+	flagEditMask = opaque
+	err = runEdit(&cobra.Command{}, []string{source, "add a window"}, app)
+	if err == nil || !strings.Contains(err.Error(), "--mask-from-alpha cannot be used with --mask") {
+		t.Errorf("runEdit() error = %v, want --mask conflict", err)
+	}
+}
+
+func TestRunGenerate_ModelAlias(t *testing.T) {
+	resetFlags()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("IMGGEN_CONFIG_DIR", t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("STABILITY_API_KEY", "sk-stability")
+
+	oldWd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(oldWd)
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	var gotCfg *provider.Config
+	var gotReq *models.Request
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		gotCfg = cfg
+		return &mockProvider{generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			gotReq = req
+			return &models.Response{Images: []models.GeneratedImage{{Data: []byte("fake"), Index: 0}}}, nil
+		}}, nil
+	}
+
+	flagModel = "sdxl"
+
+	if err := runGenerate(&cobra.Command{}, []string{"a lighthouse"}, app); err != nil {
+		t.Fatalf("runGenerate() error = %v", err)
+	}
+
+	if gotReq.Model != "stable-diffusion-xl" {
+		t.Errorf("request model = %q, want stable-diffusion-xl", gotReq.Model)
+	}
+	if gotCfg.Provider != models.ProviderStability {
+		t.Errorf("provider = %q, want stability", gotCfg.Provider)
+	}
+}
+
+func TestRunGenerate_ModelPrefix(t *testing.T) {
+	resetFlags()
+	app := newTestApp(&bytes.Buffer{})
+	flagAPIKey = "test-key"
+	flagModel = "gpt-imag"
+
+	err := runGenerate(&cobra.Command{}, []string{"test prompt"}, app)
+	if !errors.Is(err, models.ErrUnknownModel) {
+		t.Fatalf("runGenerate() error = %v, want ErrUnknownModel", err)
+	}
+	if !strings.Contains(err.Error(), "gpt-image-1") {
+		t.Errorf("error %q should suggest the full name", err)
+	}
+}
+
+func TestApplyConfigAliases(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := filepath.Join(home, ".imggen")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "aliases:\n  hd: dall-e-3\n  4o: dall-e-2\n  broken: no-such-model\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	applyConfigAliases(app, cfg)
+
+	tests := map[string]string{
+		"hd": "dall-e-3",
+		"4o": "dall-e-2", // config overrides the built-in alias
+	}
+	for alias, want := range tests {
+		got, err := app.Registry.Resolve(alias)
+		if err != nil || got != want {
+			t.Errorf("Resolve(%q) = %q, %v; want %q", alias, got, err, want)
+		}
+	}
+
+	if !strings.Contains(out.String(), "ignoring config alias") {
+		t.Errorf("expected warning for invalid alias, got %q", out.String())
+	}
+	if _, err := app.Registry.Resolve("broken"); err == nil {
+		t.Error("invalid config alias should not be registered")
+	}
+}
+
+func TestRunGenerate_Suggestions(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  string
+		format string
+		want   string
+	}{
+		{name: "model typo", model: "dale-3", format: "png", want: `unknown model "dale-3"; did you mean "dall-e-3"?`},
+		{name: "format typo", model: "gpt-image-1", format: "jpg", want: `invalid format "jpg"; did you mean "jpeg"?`},
+		{name: "far-off model", model: "midjourney", format: "png", want: "available models:"},
+		{name: "far-off format", model: "gpt-image-1", format: "tiff", want: `invalid format "tiff": must be one of`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			app := newTestApp(&bytes.Buffer{})
+			flagAPIKey = "test-key"
+			flagModel = tt.model
+			flagFormat = tt.format
+
+			err := runGenerate(&cobra.Command{}, []string{"test prompt"}, app)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("runGenerate() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// writeTestConfig writes content to config.yaml under a temporary HOME.
+func writeTestConfig(t *testing.T, content string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".imggen")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyConfigDefaults_Precedence(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	writeTestConfig(t, "model: dall-e-3\nquality: hd\nformat: jpeg\nparallel: 4\noutput: ./from-config\n")
+
+	app := newTestApp(&bytes.Buffer{})
+	root := newRootCmd(app)
+	if err := root.ParseFlags([]string{"-q", "standard", "-P", "a cat"}); err != nil {
+		t.Fatal(err)
+	}
+	applyConfig(root, app)
+
+	// Flags win over the config file.
+	if flagQuality != "standard" {
+		t.Errorf("flagQuality = %q, want flag value standard", flagQuality)
+	}
+	// The config file wins over built-in defaults.
+	if flagModel != "dall-e-3" {
+		t.Errorf("flagModel = %q, want config value dall-e-3", flagModel)
+	}
+	if flagFormat != "jpeg" {
+		t.Errorf("flagFormat = %q, want config value jpeg", flagFormat)
+	}
+	if flagParallel != 4 {
+		t.Errorf("flagParallel = %d, want config value 4", flagParallel)
+	}
+	if flagOutput != "./from-config" {
+		t.Errorf("flagOutput = %q, want config directory with --prompt", flagOutput)
+	}
+	// Unset keys keep the built-in default.
+	if flagSize != "" {
+		t.Errorf("flagSize = %q, want built-in default", flagSize)
+	}
+}
+
+func TestApplyConfigDefaults_SinglePromptKeepsOutput(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	writeTestConfig(t, "output: ./from-config\n")
+
+	app := newTestApp(&bytes.Buffer{})
+	root := newRootCmd(app)
+	if err := root.ParseFlags([]string{"a cat"}); err != nil {
+		t.Fatal(err)
+	}
+	applyConfig(root, app)
+
+	if flagOutput != "" {
+		t.Errorf("flagOutput = %q, config output dir should not become a single-image filename", flagOutput)
+	}
+}
+
+func TestApplyConfigDefaults_Batch(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	writeTestConfig(t, "model: dall-e-2\nsize: 512x512\noutput: ./out\nparallel: 3\n")
+
+	app := newTestApp(&bytes.Buffer{})
+	root := newRootCmd(app)
+	batchCmd, _, err := root.Find([]string{"batch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := batchCmd.ParseFlags([]string{"-p", "1", "prompts.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	applyConfig(batchCmd, app)
+
+	if flagBatchModel != "dall-e-2" || flagBatchSize != "512x512" || flagBatchOutput != "./out" {
+		t.Errorf("batch flags = %q %q %q, want config values", flagBatchModel, flagBatchSize, flagBatchOutput)
+	}
+	if flagBatchParallel != 1 {
+		t.Errorf("flagBatchParallel = %d, want flag value 1", flagBatchParallel)
+	}
+}
+
+func TestApplyConfigDefaults_OtherCommandsUnaffected(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	writeTestConfig(t, "model: dall-e-3\n")
+
+	app := newTestApp(&bytes.Buffer{})
+	root := newRootCmd(app)
+	varyCmd, _, err := root.Find([]string{"vary"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyConfig(varyCmd, app)
+
+	if flagVaryModel != "dall-e-2" {
+		t.Errorf("flagVaryModel = %q, config should only apply to generate and batch", flagVaryModel)
+	}
+}
+
+func TestRootCmd_ConfigDefaultsEndToEnd(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	writeTestConfig(t, "model: dall-e-3\nquality: hd\n")
+	t.Setenv("IMGGEN_CONFIG_DIR", t.TempDir())
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"--api-key", "test-key", "--explain-only", "a lighthouse"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "dall-e-3") || !strings.Contains(out.String(), "hd") {
+		t.Errorf("explain output should use config defaults:\n%s", out.String())
+	}
+}
+
+func TestApplyConfig_Profile(t *testing.T) {
+	const content = `model: dall-e-2
+quality: standard
+size: 512x512
+profiles:
+  art:
+    model: dall-e-3
+    quality: hd
+    base_url: https://proxy.example.com/v1
+`
+	tests := []struct {
+		name        string
+		args        []string
+		env         string
+		wantModel   string
+		wantQuality string
+	}{
+		{"no profile", []string{"a cat"}, "", "dall-e-2", "standard"},
+		{"flag", []string{"--config-profile", "art", "a cat"}, "", "dall-e-3", "hd"},
+		{"environment", []string{"a cat"}, "art", "dall-e-3", "hd"},
+		{"flag beats profile", []string{"--config-profile", "art", "-q", "low", "a cat"}, "", "dall-e-3", "low"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			writeTestConfig(t, content)
+
+			app := newTestApp(&bytes.Buffer{})
+			app.GetEnv = func(key string) string {
+				if key == "IMGGEN_PROFILE" {
+					return tt.env
+				}
+				return ""
+			}
+			root := newRootCmd(app)
+			if err := root.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(root, app); err != nil {
+				t.Fatalf("applyConfig() error = %v", err)
+			}
+
+			if flagModel != tt.wantModel || flagQuality != tt.wantQuality {
+				t.Errorf("model/quality = %q/%q, want %q/%q", flagModel, flagQuality, tt.wantModel, tt.wantQuality)
+			}
+			// Settings the profile leaves out come from the base config.
+			if flagSize != "512x512" {
+				t.Errorf("flagSize = %q, want base config value", flagSize)
+			}
+		})
+	}
+}
+
+func TestApplyConfig_ProfileFlagBeatsEnvironment(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	writeTestConfig(t, "profiles:\n  art:\n    model: dall-e-3\n  work:\n    model: dall-e-2\n")
+
+	app := newTestApp(&bytes.Buffer{})
+	app.GetEnv = func(key string) string {
+		if key == "IMGGEN_PROFILE" {
+			return "art"
+		}
+		return ""
+	}
+	root := newRootCmd(app)
+	if err := root.ParseFlags([]string{"--config-profile", "work", "a cat"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(root, app); err != nil {
+		t.Fatalf("applyConfig() error = %v", err)
+	}
+
+	if flagModel != "dall-e-2" {
+		t.Errorf("flagModel = %q, want --config-profile work over IMGGEN_PROFILE", flagModel)
+	}
+}
+
+func TestApplyConfig_UnknownProfile(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	writeTestConfig(t, "profiles:\n  art:\n    model: dall-e-3\n")
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"--config-profile", "wrok", "--explain-only", "a cat"})
+
+	err := root.Execute()
+	if !errors.Is(err, config.ErrUnknownProfile) {
+		t.Errorf("Execute() error = %v, want ErrUnknownProfile", err)
+	}
+}
+
+func TestApplyConfig_UnknownProfileConfigCommand(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	writeTestConfig(t, "profiles:\n  art:\n    model: dall-e-3\n")
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.GetEnv = func(key string) string {
+		if key == "IMGGEN_PROFILE" {
+			return "wrok"
+		}
+		return ""
+	}
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"config"})
+
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v, want config to run despite the unknown profile", err)
+	}
+	if !strings.Contains(out.String(), "Active profile: wrok (not defined)") {
+		t.Errorf("output = %q, want the undefined profile flagged", out.String())
+	}
+}
+
+func TestApplyConfig_ProfileBaseURL(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	writeTestConfig(t, "profiles:\n  work:\n    base_url: https://proxy.example.com/v1\n")
+
+	app := newTestApp(&bytes.Buffer{})
+	root := newRootCmd(app)
+	ocrCmd, _, err := root.Find([]string{"ocr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ocrCmd.ParseFlags([]string{"--config-profile", "work"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(ocrCmd, app); err != nil {
+		t.Fatalf("applyConfig() error = %v", err)
+	}
+
+	cfg := newProviderConfig(models.ProviderOpenAI, "key")
+	if cfg.BaseURL != "https://proxy.example.com/v1" {
+		t.Errorf("BaseURL = %q, want profile base_url", cfg.BaseURL)
+	}
+}
+
+func TestApplyConfigDefaults_EventLogAllCommands(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	writeTestConfig(t, "event_log: ~/.imggen/events.jsonl\nevent_log_prompts: plain\n")
+
+	app := newTestApp(&bytes.Buffer{})
+	root := newRootCmd(app)
+	ocrCmd, _, err := root.Find([]string{"ocr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ocrCmd.ParseFlags([]string{"--event-log-prompts", "omit"}); err != nil {
+		t.Fatal(err)
+	}
+	applyConfig(ocrCmd, app)
+
+	if flagEventLog != "~/.imggen/events.jsonl" {
+		t.Errorf("flagEventLog = %q, want config value", flagEventLog)
+	}
+	if flagEventLogPrompts != "omit" {
+		t.Errorf("flagEventLogPrompts = %q, want flag value omit", flagEventLogPrompts)
+	}
+}
+
+func TestRunGenerate_EventLog(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	calls := 0
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				calls++
+				if calls > 1 {
+					return nil, errors.New("rate limited")
+				}
+				return &models.Response{
+					Images: []models.GeneratedImage{{Data: []byte("img")}},
+					Cost:   &models.CostInfo{PerImage: 0.167, Total: 0.167},
+				}, nil
+			},
+		}, nil
+	}
+	flagAPIKey = "test-key"
+	flagQuality = "high"
+	flagOutput = filepath.Join(t.TempDir(), "out.png")
+	flagEventLog = "~/.imggen/events.jsonl"
+
+	if err := runGenerate(&cobra.Command{}, []string{"a secret prompt"}, app); err != nil {
+		t.Fatalf("runGenerate() error = %v", err)
+	}
+	if err := runGenerate(&cobra.Command{}, []string{"a secret prompt"}, app); err == nil {
+		t.Fatal("second runGenerate() should fail")
+	}
+
+	data, err := os.ReadFile(filepath.Join(home, ".imggen", "events.jsonl"))
+	if err != nil {
+		t.Fatalf("event log not written under expanded home: %v", err)
+	}
+	if strings.Contains(string(data), "a secret prompt") {
+		t.Error("event log should store a hash, not the prompt")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), data)
+	}
+	for i, line := range lines {
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("line %d is not valid JSON: %v: %s", i+1, err, line)
+		}
+		for _, key := range []string{"ts", "op", "model", "size", "quality", "prompt_hash", "cost", "success", "duration"} {
+			if _, ok := fields[key]; !ok {
+				t.Errorf("line %d missing %q: %s", i+1, key, line)
+			}
+		}
+	}
+
+	var first, second events.Event
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if first.Op != events.OpGenerate || first.Model != "gpt-image-1" || first.Quality != "high" || !first.Success || first.Cost != 0.167 {
+		t.Errorf("first event = %+v", first)
+	}
+	if first.PromptHash != events.HashPrompt("a secret prompt") {
+		t.Errorf("prompt_hash = %q, want SHA-256 of prompt", first.PromptHash)
+	}
+	if second.Success || !strings.Contains(second.Error, "rate limited") {
+		t.Errorf("second event = %+v, want failure", second)
+	}
+}
+
+func TestRunGenerate_EventLogInvalidPromptMode(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	app := newTestApp(&bytes.Buffer{})
+	flagAPIKey = "test-key"
+	flagEventLogPrompts = "encrypt"
+
+	err := runGenerate(&cobra.Command{}, []string{"a cat"}, app)
+	if err == nil || !strings.Contains(err.Error(), "invalid prompt mode") {
+		t.Errorf("runGenerate() error = %v, want invalid prompt mode", err)
+	}
+}
+
+func TestRunGenerate_JSONMultipleImages(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.Err = errOut
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				return &models.Response{
+					Images: []models.GeneratedImage{
+						{Data: []byte("one"), Index: 0},
+						{Data: []byte("two"), Index: 1},
+					},
+					RevisedPrompt: "a fluffy cat",
+					Cost:          &models.CostInfo{PerImage: 0.042, Total: 0.084},
+					InputTokens:   12,
+					OutputTokens:  8320,
+					Timing:        models.Timing{RequestDuration: 1200 * time.Millisecond, TotalDuration: 1500 * time.Millisecond},
+				}, nil
+			},
+		}, nil
+	}
+	flagAPIKey = "test-key"
+	flagJSON = true
+	flagCount = 2
+	flagQuality = "medium"
+	flagOutput = filepath.Join(t.TempDir(), "cat.png")
+
+	if err := runGenerate(&cobra.Command{}, []string{"a cat"}, app); err != nil {
+		t.Fatalf("runGenerate() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("stdout should hold exactly one JSON line, got:\n%s", out.String())
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &fields); err != nil {
+		t.Fatalf("stdout is not JSON: %v: %s", err, lines[0])
+	}
+	wantKeys := []string{"model", "prompt", "revised_prompt", "size", "quality", "paths", "cost", "cost_per_image", "input_tokens", "output_tokens", "timing"}
+	for _, key := range wantKeys {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("JSON output missing %q: %s", key, lines[0])
+		}
+	}
+	if len(fields) != len(wantKeys) {
+		t.Errorf("JSON output has %d fields, want %d: %s", len(fields), len(wantKeys), lines[0])
+	}
+
+	var got generateJSON
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Model != "gpt-image-1" || got.Prompt != "a cat" || got.RevisedPrompt != "a fluffy cat" || got.Quality != "medium" {
+		t.Errorf("JSON output = %+v", got)
+	}
+	if got.Cost != 0.084 || got.CostPerImage != 0.042 || got.InputTokens != 12 || got.OutputTokens != 8320 {
+		t.Errorf("JSON cost and usage = %+v", got)
+	}
+	if got.Timing == nil || got.Timing.RequestMs != 1200 || got.Timing.DownloadMs != 0 || got.Timing.TotalMs != 1500 {
+		t.Errorf("JSON timing = %+v, want request 1200ms and total 1500ms", got.Timing)
+	}
+	if len(got.Paths) != 2 {
+		t.Fatalf("paths = %v, want 2", got.Paths)
+	}
+	for _, path := range got.Paths {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("reported path %s was not written: %v", path, err)
+		}
+	}
+	if strings.Contains(errOut.String(), "Saved:") {
+		t.Errorf("progress lines should be suppressed, not moved to stderr:\n%s", errOut.String())
+	}
+}
+
+func TestRunGenerate_VerboseTiming(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				return &models.Response{
+					Images: []models.GeneratedImage{{Data: []byte("img")}},
+					Timing: models.Timing{RequestDuration: 2 * time.Second, TotalDuration: 2100 * time.Millisecond},
+				}, nil
+			},
+		}, nil
+	}
+	flagAPIKey = "test-key"
+	flagOutput = filepath.Join(t.TempDir(), "cat.png")
+
+	if err := runGenerate(&cobra.Command{}, []string{"a cat"}, app); err != nil {
+		t.Fatalf("runGenerate() error = %v", err)
+	}
+	if strings.Contains(out.String(), "Time:") {
+		t.Errorf("timing should only be shown with --verbose:\n%s", out.String())
+	}
+
+	out.Reset()
+	flagVerbose = true
+	if err := runGenerate(&cobra.Command{}, []string{"a cat"}, app); err != nil {
+		t.Fatalf("runGenerate() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Time: 2.10s (request 2.00s)") {
+		t.Errorf("--verbose output should show the timing:\n%s", out.String())
+	}
+}
+
+func TestRunGenerate_JSONRejectsPreview(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	app := newTestApp(&bytes.Buffer{})
+	flagAPIKey = "test-key"
+	flagJSON = true
+	flagPreviewQuality = "low"
+
+	err := runGenerate(&cobra.Command{}, []string{"a cat"}, app)
+	if err == nil || !strings.Contains(err.Error(), "--json") {
+		t.Errorf("runGenerate() error = %v, want --json conflict", err)
+	}
+}
+
+func TestWriteBatchJSON(t *testing.T) {
+	items := []batch.Item{
+		{Index: 1, Prompt: "a cat"},
+		{Index: 2, Prompt: "a dog", Model: "dall-e-3"},
+	}
+	results := []batch.Result{
+		{Index: 1, Prompt: "a cat", Path: "out/001-a-cat.png", Cost: 0.04},
+		{Index: 2, Prompt: "a dog", Error: errors.New("generation failed: boom")},
+	}
+
+	out := &bytes.Buffer{}
+	if err := writeBatchJSON(out, "gpt-image-1", items, results); err != nil {
+		t.Fatalf("writeBatchJSON() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want one per item:\n%s", len(lines), out.String())
+	}
+
+	var first, second batch.ResultEntry
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("line 1 is not JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("line 2 is not JSON: %v", err)
+	}
+	if !first.Success || first.Model != "gpt-image-1" || first.Path != "out/001-a-cat.png" || first.Cost != 0.04 {
+		t.Errorf("line 1 = %+v, want success with default model", first)
+	}
+	if second.Success || second.Model != "dall-e-3" || second.Error != "generation failed: boom" {
+		t.Errorf("line 2 = %+v, want failure with item model", second)
+	}
+}
+
+func TestRunConfigSetGet(t *testing.T) {
+	resetFlags()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+
+	if err := runConfigSet(app, "model", "dalle3"); err != nil {
+		t.Fatalf("runConfigSet() error = %v", err)
+	}
+	if err := runConfigSet(app, "parallel", "3"); err != nil {
+		t.Fatalf("runConfigSet() error = %v", err)
+	}
+
+	out.Reset()
+	if err := runConfigGet(app, "model"); err != nil {
+		t.Fatalf("runConfigGet() error = %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "dall-e-3" {
+		t.Errorf("config get model = %q, want alias saved as dall-e-3", got)
+	}
+
+	data, err := os.ReadFile(filepath.Join(home, ".imggen", "config.yaml"))
+	if err != nil {
+		t.Fatalf("config file not written: %v", err)
+	}
+	if !strings.Contains(string(data), "parallel: 3") {
+		t.Errorf("config file = %q, want parallel: 3", data)
+	}
+
+	if err := runConfigSet(app, "model", ""); err != nil {
+		t.Fatalf("runConfigSet() clear error = %v", err)
+	}
+	out.Reset()
+	runConfigList(app)
+	if !strings.Contains(out.String(), "(not set)") || !strings.Contains(out.String(), "parallel    3") {
+		t.Errorf("config list = %q", out.String())
+	}
+}
+
+func TestRunConfigSet_Invalid(t *testing.T) {
+	resetFlags()
+	t.Setenv("HOME", t.TempDir())
+	app := newTestApp(&bytes.Buffer{})
+
+	tests := []struct {
+		key, value, want string
+	}{
+		{"colour", "red", "unknown config key"},
+		{"format", "gif", "invalid format"},
+		{"parallel", "0", "invalid parallel"},
+		{"model", "midjourney", "unknown model"},
+	}
+	for _, tt := range tests {
+		err := runConfigSet(app, tt.key, tt.value)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("runConfigSet(%q, %q) error = %v, want %q", tt.key, tt.value, err, tt.want)
+		}
+	}
+}
+
+func TestRunConfigPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	out := &bytes.Buffer{}
+
+	if err := runConfigPath(newTestApp(out)); err != nil {
+		t.Fatalf("runConfigPath() error = %v", err)
+	}
+	want := filepath.Join(home, ".imggen", "config.yaml")
+	if got := strings.TrimSpace(out.String()); got != want {
+		t.Errorf("config path = %q, want %q", got, want)
+	}
+}
+
+func TestRootCmd_ShowProtocolFlag(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	out := &bytes.Buffer{}
+	root := newRootCmd(newTestApp(out))
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"--api-key", "test-key", "--show-protocol", "braille", "--explain-only", "a cat"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "invalid protocol") {
+		t.Errorf("Execute() error = %v, want invalid protocol", err)
+	}
+
+	resetFlags()
+	root = newRootCmd(newTestApp(out))
+	root.SetArgs([]string{"--api-key", "test-key", "--show-protocol", "sixel", "--explain-only", "a cat"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if flagShowProtocol != display.ProtocolSixel {
+		t.Errorf("flagShowProtocol = %q, want sixel", flagShowProtocol)
+	}
+}
+
+func TestRunGenerate_Cache(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	calls := 0
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				calls++
+				return &models.Response{
+					Images: []models.GeneratedImage{{Data: []byte("img")}},
+					Cost:   &models.CostInfo{PerImage: 0.011, Total: 0.011},
+				}, nil
+			},
+		}, nil
+	}
+	flagAPIKey = "test-key"
+	flagCache = true
+	flagOutput = filepath.Join(t.TempDir(), "out.png")
+
+	for range 2 {
+		if err := runGenerate(&cobra.Command{}, []string{"a lighthouse"}, app); err != nil {
+			t.Fatalf("runGenerate() error = %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("provider calls = %d, want 1", calls)
+	}
+	if !strings.Contains(out.String(), "Cost: $0.0000") || !strings.Contains(out.String(), "cache hit") {
+		t.Errorf("second run should report a free cache hit:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runCacheClear(app); err != nil {
+		t.Fatalf("runCacheClear() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Removed 1 cached response(s)") {
+		t.Errorf("runCacheClear() output = %q", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(home, ".imggen", "cache")); err != nil {
+		t.Errorf("cache directory should remain after clear: %v", err)
+	}
+}
+
+func TestRunStripMetadata_InPlace(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, 2, 2))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	clean := buf.Bytes()
+	// Insert a tEXt chunk after the 33-byte signature and IHDR.
+	text := []byte("\x00\x00\x00\x0dtEXtprompt\x00secret\x00\x00\x00\x00")
+	tagged := append(append(bytes.Clone(clean[:33]), text...), clean[33:]...)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "photo.png")
+	if err := os.WriteFile(path, tagged, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	flagStripInPlace = true
+	if err := runStripMetadata(newTestApp(out), path); err != nil {
+		t.Fatalf("runStripMetadata() error = %v", err)
+	}
+
+	got, _ := os.ReadFile(path)
+	if !bytes.Equal(got, clean) {
+		t.Error("in-place strip should leave only the original PNG chunks")
+	}
+	backups, _ := filepath.Glob(path + ".backup-*")
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want one", backups)
+	}
+	if orig, _ := os.ReadFile(backups[0]); !bytes.Equal(orig, tagged) {
+		t.Error("backup should hold the original file")
+	}
+	if !strings.Contains(out.String(), "Removed 1 metadata chunk(s)") {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestProcessBatch_JSONStreamsAndReportsUnprocessed(t *testing.T) {
+	prov := &mockProvider{
+		generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			if req.Prompt == "bad" {
+				return nil, errors.New("boom")
+			}
+			return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+		},
+	}
+	processor := batch.NewProcessor(prov, image.NewSaver(), models.DefaultRegistry(), io.Discard, io.Discard)
+	items := []batch.Item{
+		{Index: 1, Prompt: "good"},
+		{Index: 2, Prompt: "bad"},
+		{Index: 3, Prompt: "never run"},
+	}
+	opts := &batch.Options{OutputDir: t.TempDir(), DefaultModel: "gpt-image-1", Format: models.FormatPNG, Parallel: 1, StopOnError: true}
+
+	out := &bytes.Buffer{}
+	results, err := processBatch(context.Background(), processor, items, opts, out, "gpt-image-1")
+	if err == nil || !strings.Contains(err.Error(), "stopped at item 2") {
+		t.Errorf("processBatch() error = %v, want stop at item 2", err)
+	}
+	if len(results) != 3 || results[0].Path == "" || results[2].Path != "" {
+		t.Errorf("results = %+v", results)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d JSON lines, want 3:\n%s", len(lines), out.String())
+	}
+	var last batch.ResultEntry
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if last.Index != 3 || last.Success || last.Error != "not processed" {
+		t.Errorf("unreached item = %+v, want not processed", last)
+	}
+}
+
+func TestRunGenerate_NoRevise(t *testing.T) {
+	tests := []struct {
+		model    string
+		wantNote string
+	}{
+		{"dall-e-3", "Prompt revision suppressed"},
+		{"gpt-image-1", "--no-revise only affects dall-e-3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			var got *models.Request
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				return &mockProvider{
+					generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+						got = req
+						return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+					},
+				}, nil
+			}
+			flagAPIKey = "test-key"
+			flagModel = tt.model
+			flagNoRevise = true
+			flagOutput = filepath.Join(t.TempDir(), "out.png")
+
+			if err := runGenerate(&cobra.Command{}, []string{"a red fox"}, app); err != nil {
+				t.Fatalf("runGenerate() error = %v", err)
+			}
+			if got == nil || !got.NoRevise || got.Prompt != "a red fox" {
+				t.Errorf("request = %+v, want NoRevise with the prompt unchanged", got)
+			}
+			if !strings.Contains(out.String(), tt.wantNote) {
+				t.Errorf("output should contain %q:\n%s", tt.wantNote, out.String())
+			}
+		})
+	}
+}
+
+func TestRunGenerate_MaxPromptDrift(t *testing.T) {
+	tests := []struct {
+		name    string
+		revised string
+		wantErr bool
+	}{
+		{"near identical", "a red fox standing in the snow", false},
+		{"very different", "an astronaut riding a horse on mars", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				return &mockProvider{
+					generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+						return &models.Response{
+							Images:        []models.GeneratedImage{{Data: []byte("img")}},
+							RevisedPrompt: tt.revised,
+						}, nil
+					},
+				}, nil
+			}
+			flagAPIKey = "test-key"
+			flagModel = "dall-e-3"
+			flagMaxPromptDrift = 0.5
+			flagOutput = filepath.Join(t.TempDir(), "out.png")
+
+			err := runGenerate(&cobra.Command{}, []string{"a red fox in the snow"}, app)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runGenerate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, statErr := os.Stat(flagOutput); statErr != nil {
+				t.Errorf("image should be saved even when drift fails the run: %v", statErr)
+			}
+			if tt.wantErr && !strings.Contains(out.String(), "revised prompt drifted") {
+				t.Errorf("output should warn about drift:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestRunGenerate_MaxPromptDriftRange(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	flagAPIKey = "test-key"
+	flagMaxPromptDrift = 1.5
+	err := runGenerate(&cobra.Command{}, []string{"a red fox"}, newTestApp(&bytes.Buffer{}))
+	if err == nil || !strings.Contains(err.Error(), "between 0 and 1") {
+		t.Errorf("runGenerate() error = %v, want range error", err)
+	}
+}
+
+func TestStrict_CostLogFailure(t *testing.T) {
+	// A HOME that is a file makes opening the cost database fail.
+	home := filepath.Join(t.TempDir(), "home")
+	if err := os.WriteFile(home, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%t", strict), func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				return &mockProvider{
+					generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+						return &models.Response{
+							Images: []models.GeneratedImage{{Data: []byte("img")}},
+							Cost:   &models.CostInfo{PerImage: 0.04, Total: 0.04},
+						}, nil
+					},
+				}, nil
+			}
+
+			args := []string{"--api-key", "test-key", "-o", filepath.Join(t.TempDir(), "out.png"), "a cat"}
+			if strict {
+				args = append([]string{"--strict"}, args...)
+			}
+			root := newRootCmd(app)
+			root.SetOut(out)
+			root.SetErr(out)
+			root.SetArgs(args)
+			err := root.Execute()
+
+			if strict {
+				if err == nil || !strings.Contains(err.Error(), "failed to log cost") {
+					t.Errorf("Execute() error = %v, want cost log failure under --strict", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Execute() error = %v, want a warning only", err)
+			}
+			if !strings.Contains(out.String(), "Warning: failed to log cost") {
+				t.Errorf("output should warn about the cost log:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestStrict_BatchPartialFailure(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%t", strict), func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				return &mockProvider{
+					generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+						if req.Prompt == "bad" {
+							return nil, errors.New("content policy violation")
+						}
+						return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+					},
+				}, nil
+			}
+			flagAPIKey = "test-key"
+			flagPrompts = []string{"good", "bad", "also good"}
+			flagOutput = t.TempDir()
+			flagStrict = strict
+
+			err := runGenerate(&cobra.Command{}, nil, app)
+			if strict {
+				if err == nil || !strings.Contains(err.Error(), "1 of 3 batch items failed") {
+					t.Errorf("runGenerate() error = %v, want partial failure under --strict", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("runGenerate() error = %v, want nil without --strict", err)
+			}
+		})
+	}
+}
+
+func TestStrict_DisplayFailure(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%t", strict), func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			flagAPIKey = "test-key"
+			flagShow = true
+			flagShowProtocol = display.ProtocolSixel
+			flagOutput = filepath.Join(t.TempDir(), "out.png")
+			flagStrict = strict
+
+			// The mock image is not decodable, so sixel display fails.
+			err := runGenerate(&cobra.Command{}, []string{"a cat"}, app)
+			if strict {
+				if err == nil || !strings.Contains(err.Error(), "failed to display image") {
+					t.Errorf("runGenerate() error = %v, want display failure under --strict", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("runGenerate() error = %v, want a warning only", err)
+			}
+			if !strings.Contains(out.String(), "Warning: failed to display image") {
+				t.Errorf("output should warn about the display:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestRunGenerate_PromptFromStdin(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.In = strings.NewReader("  a cat wearing a hat\n")
+	var got string
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				got = req.Prompt
+				return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+			},
+		}, nil
+	}
+
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"--api-key", "test-key", "-o", filepath.Join(t.TempDir(), "out.png")})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+	if got != "a cat wearing a hat" {
+		t.Errorf("prompt = %q, want it read from stdin", got)
+	}
+}
+
+func TestRunGenerate_PromptFromStdinErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		stdin   string
+		preview string
+		wantErr string
+	}{
+		{"empty stdin", " \n", "", "no prompt given"},
+		{"preview needs stdin", "a cat", "low", "--preview-quality"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			app := newTestApp(&bytes.Buffer{})
+			app.In = strings.NewReader(tt.stdin)
+			flagAPIKey = "test-key"
+			flagPreviewQuality = tt.preview
+
+			err := runGenerate(&cobra.Command{}, nil, app)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("runGenerate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunBatch_PromptsFromStdin(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.In = strings.NewReader(`[{"prompt": "a cat"}, {"prompt": "a dog", "model": "dall-e-2"}]`)
+	var (
+		mu      sync.Mutex
+		prompts []string
+	)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				mu.Lock()
+				prompts = append(prompts, req.Model+": "+req.Prompt)
+				mu.Unlock()
+				return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+			},
+		}, nil
+	}
+
+	outDir := t.TempDir()
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"batch", "-", "-o", outDir, "--api-key", "test-key"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+
+	want := []string{"gpt-image-1: a cat", "dall-e-2: a dog"}
+	if !slices.Equal(prompts, want) {
+		t.Errorf("generated %v, want %v", prompts, want)
+	}
+	if strings.Contains(out.String(), "[Y/n]") {
+		t.Errorf("no confirmation should be asked when prompts come from stdin:\n%s", out.String())
+	}
+}
+
+func TestRunBatch_RoutesItemsToModelProvider(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.In = strings.NewReader(`[{"prompt": "a cat"}, {"prompt": "a dog", "model": "stable-diffusion-3"}, {"prompt": "a fox", "model": "stable-diffusion-3"}]`)
+	var (
+		mu      sync.Mutex
+		created []models.ProviderType
+		routed  = map[string]models.ProviderType{}
+	)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		mu.Lock()
+		created = append(created, cfg.Provider)
+		mu.Unlock()
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				mu.Lock()
+				routed[req.Prompt] = cfg.Provider
+				mu.Unlock()
+				return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+			},
+		}, nil
+	}
+
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"batch", "-", "-o", t.TempDir(), "--api-key", "test-key"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+
+	want := map[string]models.ProviderType{
+		"a cat": models.ProviderOpenAI,
+		"a dog": models.ProviderStability,
+		"a fox": models.ProviderStability,
+	}
+	for prompt, typ := range want {
+		if routed[prompt] != typ {
+			t.Errorf("%q went to %q, want %q", prompt, routed[prompt], typ)
+		}
+	}
+	if len(created) != 2 {
+		t.Errorf("created providers %v, want one per provider", created)
+	}
+}
+
+func TestRunBatch_UnknownModelEstimate(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.In = strings.NewReader(`[{"prompt": "a cat"}, {"prompt": "a dog", "model": "no-such-model"}]`)
+	var generated atomic.Int32
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				generated.Add(1)
+				return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+			},
+		}, nil
+	}
+
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"batch", "-", "-o", t.TempDir(), "--api-key", "test-key"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "no known price for 1 item(s) (2)") {
+		t.Errorf("output missing the unpriced item warning:\n%s", out.String())
+	}
+	if generated.Load() != 1 {
+		t.Errorf("generated %d items, want the priced one to still run", generated.Load())
+	}
+}
+
+func TestRunBatch_NameTemplate(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.In = strings.NewReader(`[{"prompt": "a cat"}, {"prompt": "a dog", "model": "dall-e-2"}]`)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+			},
+		}, nil
+	}
+
+	outDir := t.TempDir()
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"batch", "-", "-o", outDir, "-f", "png", "--api-key", "test-key", "--name-template", "{model}/{index}"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+	for _, name := range []string{"gpt-image-1/001.png", "dall-e-2/002.png"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Errorf("expected %s: %v\n%s", name, err, out.String())
+		}
+	}
+
+	resetFlags()
+	root = newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"batch", "-", "-o", outDir, "--api-key", "test-key", "--name-template", "{prompt}"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "must include {index}") {
+		t.Errorf("Execute() error = %v, want {index} to be required", err)
+	}
+}
+
+func TestRunBatch_ContactSheet(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, stdimage.NewRGBA(stdimage.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.In = strings.NewReader("a cat\na dog\na bird\n")
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				if req.Prompt == "a dog" {
+					return nil, errors.New("rejected")
+				}
+				return &models.Response{Images: []models.GeneratedImage{{Data: pngData.Bytes()}}}, nil
+			},
+		}, nil
+	}
+
+	outDir := t.TempDir()
+	sheet := filepath.Join(t.TempDir(), "sheet.png")
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"batch", "-", "-o", outDir, "-f", "png", "--api-key", "test-key", "--contact-sheet", sheet, "--cols", "1"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "Contact sheet: "+sheet+" (2 images)") {
+		t.Errorf("output = %q, want the contact sheet of the saved images", out.String())
+	}
+
+	data, err := os.ReadFile(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := image.SheetSize(2, image.SheetOptions{Columns: 1}); cfg.Width != w || cfg.Height != h {
+		t.Errorf("sheet is %dx%d, want %dx%d", cfg.Width, cfg.Height, w, h)
+	}
+}
+
+func TestRunBatch_BudgetStopLogsCost(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, stdimage.NewRGBA(stdimage.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.In = strings.NewReader("a cat\na dog\na bird\na fox\n")
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				return &models.Response{
+					Images: []models.GeneratedImage{{Data: pngData.Bytes()}},
+					Cost:   &models.CostInfo{PerImage: 0.04, Total: 0.04},
+				}, nil
+			},
+		}, nil
+	}
+
+	// dall-e-3 is estimated at $0.04 an image, so the third goes over.
+	sheet := filepath.Join(t.TempDir(), "sheet.png")
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"batch", "-", "-o", t.TempDir(), "-f", "png", "-m", "dall-e-3", "--api-key", "test-key",
+		"--budget", "0.10", "--contact-sheet", sheet})
+	if err := root.Execute(); !errors.Is(err, cost.ErrBudgetExceeded) {
+		t.Fatalf("Execute() error = %v, want ErrBudgetExceeded\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "Contact sheet: "+sheet+" (2 images)") {
+		t.Errorf("output = %q, want the contact sheet of the images made before the stop", out.String())
+	}
+
+	store, err := session.NewStoreWithPath(filepath.Join(home, ".imggen", "sessions.db"))
+	if err != nil {
+		t.Fatalf("NewStoreWithPath() error = %v", err)
+	}
+	defer store.Close()
+	summary, err := store.GetTotalCost(context.Background())
+	if err != nil {
+		t.Fatalf("GetTotalCost() error = %v", err)
+	}
+	if summary.ImageCount != 2 || fmt.Sprintf("%.4f", summary.TotalCost) != "0.0800" {
+		t.Errorf("logged %d images for $%.4f, want 2 for $0.0800", summary.ImageCount, summary.TotalCost)
+	}
+}
+
+func TestRunBatch_ContactSheetInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"format", []string{"--contact-sheet", "sheet.gif"}, "unsupported contact sheet format"},
+		{"cols", []string{"--contact-sheet", "sheet.png", "--cols", "0"}, "--cols must be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				t.Fatal("conflicting flags created a provider")
+				return nil, nil
+			}
+			root := newRootCmd(app)
+			root.SetOut(out)
+			root.SetErr(out)
+			root.SetArgs(append([]string{"batch", "prompts.txt", "--api-key", "test-key"}, tt.args...))
+			if err := root.Execute(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunBatch_DedupePrompts(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	input := filepath.Join(t.TempDir(), "prompts.json")
+	prompts := `[
+		{"prompt": "a red fox"},
+		{"prompt": "a red fox "},
+		{"prompt": "A red fox"},
+		{"prompt": "a red fox"},
+		{"prompt": "a red fox", "size": "1024x1536"},
+		{"prompt": "a red fox", "model": "gpt-image-1", "size": "1024x1024"}
+	]`
+	if err := os.WriteFile(input, []byte(prompts), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	var (
+		mu        sync.Mutex
+		generated []string
+	)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				mu.Lock()
+				generated = append(generated, req.Prompt+"|"+req.Size)
+				mu.Unlock()
+				return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+			},
+		}, nil
+	}
+
+	outDir := t.TempDir()
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"batch", input, "-o", outDir, "--dedupe-prompts", "--api-key", "test-key"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+
+	// The near duplicates differ in whitespace, case, or size and are kept;
+	// the repeated prompt and the one spelling out the defaults are not.
+	want := []string{"a red fox|1024x1024", "a red fox |1024x1024", "A red fox|1024x1024", "a red fox|1024x1536"}
+	if !slices.Equal(generated, want) {
+		t.Errorf("generated %q, want %q", generated, want)
+	}
+	if !strings.Contains(out.String(), "Removed 2 duplicate prompt(s); 4 left") {
+		t.Errorf("output should report the removed duplicates:\n%s", out.String())
+	}
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !slices.ContainsFunc(names, func(n string) bool { return strings.HasPrefix(n, "001-") }) {
+		t.Errorf("first occurrence should keep its filename, got %v", names)
+	}
+	if slices.ContainsFunc(names, func(n string) bool { return strings.HasPrefix(n, "004-") }) {
+		t.Errorf("removed duplicate should not be saved, got %v", names)
+	}
+}
+
+// mockStreamOCRProvider streams fixed pieces of text from StreamOCR.
+type mockStreamOCRProvider struct {
+	mockProvider
+	pieces []string
+}
+
+func (m *mockStreamOCRProvider) OCR(_ context.Context, _ *models.OCRRequest) (*models.OCRResponse, error) {
+	return nil, errors.New("OCR should not be called with --stream")
+}
+
+func (m *mockStreamOCRProvider) SuggestSchema(_ context.Context, _ *models.OCRRequest) (json.RawMessage, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockStreamOCRProvider) StreamOCR(_ context.Context, _ *models.OCRRequest, onDelta func(string)) (*models.OCRResponse, error) {
+	for _, p := range m.pieces {
+		onDelta(p)
+	}
+	return &models.OCRResponse{Text: strings.Join(m.pieces, "")}, nil
+}
+
+func TestOCRSchemaFromExample(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	dir := t.TempDir()
+	example := filepath.Join(dir, "receipt.json")
+	if err := os.WriteFile(example, []byte(`{"vendor": {"name": "Acme"}, "total": 9.5, "items": [{"sku": "A"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	root := newRootCmd(newTestApp(out))
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "schema", "from-example", example})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	var printed map[string]any
+	if err := json.Unmarshal(out.Bytes(), &printed); err != nil {
+		t.Fatalf("stdout is not a schema: %v\n%s", err, out.String())
+	}
+
+	schemaPath := filepath.Join(dir, "schema.json")
+	out.Reset()
+	root = newRootCmd(newTestApp(out))
+	root.SetArgs([]string{"ocr", "schema", "from-example", example, "-o", schemaPath})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute(-o) error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Schema saved to: "+schemaPath) {
+		t.Errorf("output = %q, want the saved path", out.String())
+	}
+	data, err := os.ReadFile(schemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, err := ocrcsv.Columns(data)
+	if err != nil {
+		t.Fatalf("saved schema has no columns: %v", err)
+	}
+	if want := []string{"vendor.name", "total", "items"}; !slices.Equal(columns, want) {
+		t.Errorf("schema columns = %v, want %v", columns, want)
+	}
+
+	if err := os.WriteFile(example, []byte(`["not", "an", "object"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root = newRootCmd(newTestApp(&bytes.Buffer{}))
+	root.SetArgs([]string{"ocr", "schema", "from-example", example})
+	if err := root.Execute(); !errors.Is(err, schemagen.ErrNotObject) {
+		t.Errorf("Execute(array) error = %v, want ErrNotObject", err)
+	}
+}
+
+func TestRunOCR_Stream(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	imgPath := filepath.Join(t.TempDir(), "scan.png")
+	if err := os.WriteFile(imgPath, []byte{0x89, 0x50, 0x4E, 0x47}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(t.TempDir(), "scan.txt")
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockStreamOCRProvider{pieces: []string{"Hello, ", "streamed ", "world"}}, nil
+	}
+
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "--api-key", "test-key", "--stream", "-o", outPath, imgPath})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+
+	if got := strings.Count(out.String(), "Hello, streamed world"); got != 1 {
+		t.Errorf("streamed text printed %d times, want once:\n%s", got, out.String())
+	}
+	saved, err := os.ReadFile(outPath)
+	if err != nil || string(saved) != "Hello, streamed world" {
+		t.Errorf("output file = %q, %v; want the full text", saved, err)
+	}
+
+	root = newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "--api-key", "test-key", "--stream", "--json", imgPath})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "--stream cannot be used with --json") {
+		t.Errorf("Execute() error = %v, want --json conflict", err)
+	}
+}
+
+// mockStructuredOCRProvider returns a fixed structured result from OCR.
+type mockStructuredOCRProvider struct {
+	mockProvider
+	structured string
+}
+
+func (m *mockStructuredOCRProvider) OCR(_ context.Context, _ *models.OCRRequest) (*models.OCRResponse, error) {
+	return &models.OCRResponse{Structured: json.RawMessage(m.structured)}, nil
+}
+
+func (m *mockStructuredOCRProvider) SuggestSchema(_ context.Context, _ *models.OCRRequest) (json.RawMessage, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestRunOCR_SplitFields(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	dir := t.TempDir()
+	imgPath := filepath.Join(dir, "invoice.png")
+	if err := os.WriteFile(imgPath, []byte{0x89, 0x50, 0x4E, 0x47}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	schemaPath := filepath.Join(dir, "schema.json")
+	if err := os.WriteFile(schemaPath, []byte(`{"type": "object"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+	outPath := filepath.Join(outDir, "data.json")
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockStructuredOCRProvider{structured: `{"vendor": "ACME Corp", "items": [{"name": "bolt", "qty": 2}]}`}, nil
+	}
+
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "--api-key", "test-key", "--schema", schemaPath, "--split-fields", "-o", outPath, imgPath})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+
+	vendor, err := os.ReadFile(filepath.Join(outDir, "data.vendor.txt"))
+	if err != nil || string(vendor) != "ACME Corp\n" {
+		t.Errorf("data.vendor.txt = %q, %v; want the plain string", vendor, err)
+	}
+	items, err := os.ReadFile(filepath.Join(outDir, "data.items.txt"))
+	if err != nil || !strings.Contains(string(items), `"name": "bolt"`) {
+		t.Errorf("data.items.txt = %q, %v; want the indented JSON array", items, err)
+	}
+	if _, err := os.Stat(outPath); err != nil {
+		t.Errorf("combined output not written: %v", err)
+	}
+	if !strings.Contains(out.String(), "Field vendor saved to: "+filepath.Join(outDir, "data.vendor.txt")) {
+		t.Errorf("output missing field path:\n%s", out.String())
+	}
+}
+
+// newOCRServer serves chat completions that answer every request with
+// content, counting the requests.
+func newOCRServer(t *testing.T, content string, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":      "chatcmpl-test",
+			"object":  "chat.completion",
+			"model":   "gpt-5-mini",
+			"choices": []map[string]any{{"index": 0, "message": map[string]string{"role": "assistant", "content": content}, "finish_reason": "stop"}},
+			"usage":   map[string]int{"prompt_tokens": 100, "completion_tokens": 20, "total_tokens": 120},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRunOCR_BatchDir(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	var calls atomic.Int32
+	server := newOCRServer(t, "TOTAL 12.50", &calls)
+
+	dir := t.TempDir()
+	writeTestPNG(t, filepath.Join(dir, "receipt-1.png"))
+	writeTestPNG(t, filepath.Join(dir, "receipt-2.png"))
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(t.TempDir(), "extracted")
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = DefaultApp().NewProvider
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "--api-key", "test-key", "--base-url", server.URL, "--batch", dir, "-o", outDir, "--parallel", "2"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("chat requests = %d, want one per image", got)
+	}
+	for _, name := range []string{"receipt-1.txt", "receipt-2.txt"} {
+		data, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil || string(data) != "TOTAL 12.50" {
+			t.Errorf("%s = %q, %v; want the extracted text", name, data, err)
+		}
+	}
+	for _, want := range []string{"Processed 2 of 2 images: 2 succeeded, 0 failed", "Tokens: 200 input, 40 output", "Total cost: $"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunOCR_BatchFilesSchema(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	var calls atomic.Int32
+	server := newOCRServer(t, `{"total": 12.5}`, &calls)
+
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.jpg")
+	writeTestPNG(t, first)
+	writeTestPNG(t, second)
+	schemaPath := filepath.Join(t.TempDir(), "receipt.json")
+	if err := os.WriteFile(schemaPath, []byte(`{"type": "object"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.png")
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = DefaultApp().NewProvider
+	root := newRootCmd(app)
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "--api-key", "test-key", "--base-url", server.URL, "--schema", schemaPath, "--json", "--strict", first, missing, second})
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 images failed") {
+		t.Errorf("Execute() error = %v, want the failed image reported under --strict", err)
+	}
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("chat requests = %d, want one per readable image", got)
+	}
+	for _, path := range []string{filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")} {
+		data, err := os.ReadFile(path)
+		if err != nil || !strings.Contains(string(data), `"total": 12.5`) {
+			t.Errorf("%s = %q, %v; want the structured result beside the image", path, data, err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var results []ocrJSON
+	for _, line := range lines {
+		var r ocrJSON
+		if json.Unmarshal([]byte(line), &r) == nil && r.Source != "" {
+			results = append(results, r)
+		}
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d JSON results, want one per image:\n%s", len(results), out.String())
+	}
+	for _, r := range results {
+		if r.Source == missing && r.Error == "" || r.Source != missing && (r.Error != "" || r.InputTokens != 100) {
+			t.Errorf("result = %+v", r)
+		}
+	}
+}
+
+func TestRunOCR_BatchCSV(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	var calls atomic.Int32
+	server := newOCRServer(t, `{"vendor": {"name": "ACME, Inc."}, "total": 12.5}`, &calls)
+
+	dir := t.TempDir()
+	writeTestPNG(t, filepath.Join(dir, "a.png"))
+	writeTestPNG(t, filepath.Join(dir, "b.png"))
+	schemaPath := filepath.Join(t.TempDir(), "receipt.json")
+	schema := `{"type": "object", "properties": {"vendor": {"type": "object", "properties": {"name": {"type": "string"}}}, "total": {"type": "number"}, "date": {"type": "string"}}}`
+	if err := os.WriteFile(schemaPath, []byte(schema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	csvPath := filepath.Join(t.TempDir(), "receipts.csv")
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = DefaultApp().NewProvider
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "--api-key", "test-key", "--base-url", server.URL, "--batch", dir, "--schema", schemaPath, "--output-format", "csv", "-o", csvPath, "--parallel", "2"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+
+	got, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "source,vendor.name,total,date\n" +
+		filepath.Join(dir, "a.png") + ",\"ACME, Inc.\",12.5,\n" +
+		filepath.Join(dir, "b.png") + ",\"ACME, Inc.\",12.5,\n"
+	if string(got) != want {
+		t.Errorf("csv =\n%s\nwant\n%s", got, want)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("found %d files beside the images, want no per-image outputs", len(entries))
+	}
+}
+
+func TestRunOCR_OutputFormatConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"unknown", []string{"--output-format", "xml", "a.png", "b.png"}, "must be json or csv"},
+		{"single image", []string{"--output-format", "csv", "--schema", "s.json", "-o", "out.csv", "a.png"}, "needs several images or --batch"},
+		{"no schema", []string{"--output-format", "csv", "-o", "out.csv", "a.png", "b.png"}, "requires --schema"},
+		{"no output", []string{"--output-format", "csv", "--schema", "s.json", "a.png", "b.png"}, "requires -o"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			out := &bytes.Buffer{}
+			root := newRootCmd(newTestApp(out))
+			root.SetOut(out)
+			root.SetErr(out)
+			root.SetArgs(append([]string{"ocr", "--api-key", "test-key"}, tt.args...))
+			if err := root.Execute(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunOCR_Reflow(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	var calls atomic.Int32
+	server := newOCRServer(t, "Dear customer, your\norder has\nshipped.\n\nTracking:\n1Z999", &calls)
+	imgPath := filepath.Join(t.TempDir(), "letter.png")
+	writeTestPNG(t, imgPath)
+	outPath := filepath.Join(t.TempDir(), "letter.txt")
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = DefaultApp().NewProvider
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "--api-key", "test-key", "--base-url", server.URL, "--reflow", "-o", outPath, imgPath})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+	want := "Dear customer, your order has shipped.\n\nTracking:\n1Z999"
+	if got, err := os.ReadFile(outPath); err != nil || string(got) != want {
+		t.Errorf("output file = %q, %v; want %q", got, err, want)
+	}
+
+	root = newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "--api-key", "test-key", "--reflow", "--schema", "schema.json", imgPath})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "--reflow applies to plain text") {
+		t.Errorf("Execute() error = %v, want --schema conflict", err)
+	}
+}
+
+func TestRunOCR_MaxOutputTokens(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	var maxTokens atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			MaxCompletionTokens int32 `json:"max_completion_tokens"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		maxTokens.Store(body.MaxCompletionTokens)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"index": 0, "message": map[string]string{"role": "assistant", "content": "TOTAL 12."}, "finish_reason": "length"}},
+			"usage":   map[string]int{"prompt_tokens": 100, "completion_tokens": 32, "total_tokens": 132},
+		})
+	}))
+	defer server.Close()
+
+	imgPath := filepath.Join(t.TempDir(), "receipt.png")
+	writeTestPNG(t, imgPath)
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = DefaultApp().NewProvider
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "--api-key", "test-key", "--base-url", server.URL, "--max-output-tokens", "32", imgPath})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+	if got := maxTokens.Load(); got != 32 {
+		t.Errorf("max_completion_tokens = %d, want 32", got)
+	}
+	if !strings.Contains(out.String(), "output was cut off at 32 tokens") {
+		t.Errorf("output missing truncation warning:\n%s", out.String())
+	}
+
+	root = newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "--api-key", "test-key", "--max-output-tokens", "-1", imgPath})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "--max-output-tokens must be positive") {
+		t.Errorf("Execute() error = %v, want negative cap rejected", err)
+	}
+}
+
+func TestRunOCR_BatchBudget(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	var calls atomic.Int32
+	server := newOCRServer(t, "TOTAL 12.50", &calls)
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.png", "b.png", "c.png", "d.png"} {
+		writeTestPNG(t, filepath.Join(dir, name))
+	}
+
+	// Each 2x2 image reserves about $0.0021 (455 input and 1000 output
+	// tokens) and costs $0.000065, so the third reservation goes over.
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = DefaultApp().NewProvider
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "--api-key", "test-key", "--base-url", server.URL, "--batch", dir, "--max-output-tokens", "1000", "--budget", "0.0022"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("API calls = %d, want 2", got)
+	}
+	for _, want := range []string{"c.png: failed: budget exceeded", "Processed 3 of 4 images: 2 succeeded, 1 failed", "Stopped: the next image could cost more than the $0.0022 --budget has left"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "d.txt")); !os.IsNotExist(err) {
+		t.Errorf("d.txt exists after the budget was reached: %v", err)
+	}
+
+	// A single image over the budget is refused before any request.
+	root = newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"ocr", "--api-key", "test-key", "--base-url", server.URL, "--budget", "0.001", filepath.Join(dir, "a.png")})
+	if err := root.Execute(); !errors.Is(err, cost.ErrBudgetExceeded) {
+		t.Errorf("Execute() error = %v, want ErrBudgetExceeded", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("API calls = %d after a refused image, want 2", got)
+	}
+}
+
+func TestRunOCR_BatchConflicts(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"batch and files", []string{"--batch", dir, "a.png"}, "use either --batch"},
+		{"suggest schema", []string{"--suggest-schema", "a.png", "b.png"}, "--suggest-schema works on a single image"},
+		{"stream", []string{"--stream", "--batch", dir}, "--stream works on a single image"},
+		{"parallel", []string{"--parallel", "0", "--batch", dir}, "--parallel must be at least 1"},
+		{"empty dir", []string{"--batch", dir}, "no images found"},
+		{"same output", []string{"scan.png", "scan.jpg"}, "would both write"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			t.Setenv("HOME", t.TempDir())
+
+			out := &bytes.Buffer{}
+			root := newRootCmd(newTestApp(out))
+			root.SetOut(out)
+			root.SetErr(out)
+			root.SetArgs(append([]string{"ocr", "--api-key", "test-key"}, tt.args...))
+			if err := root.Execute(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteSplitFields_RejectsUnsafeNames(t *testing.T) {
+	dir := t.TempDir()
+	for _, structured := range []string{
+		`{"../escape": "x"}`,
+		`{"a/b": "x"}`,
+		`{"": "x"}`,
+		`["not", "an", "object"]`,
+	} {
+		if _, err := writeSplitFields(dir, "out", json.RawMessage(structured)); err == nil {
+			t.Errorf("writeSplitFields(%s) error = nil, want rejection", structured)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("rejected results wrote %d files", len(entries))
+	}
+}
+
+func TestRunDoctor(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("IMGGEN_CONFIG_DIR", t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	flagBaseURL = server.URL
+
+	out := &bytes.Buffer{}
+	flagAPIKey = "sk-test-doctor-key"
+	if err := runDoctor(context.Background(), newTestApp(out)); err != nil {
+		t.Fatalf("runDoctor() error = %v\n%s", err, out.String())
+	}
+	for _, want := range []string{"✓ API key", "sk-t", "(flag)", "✓ Database", "✓ Connectivity"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "sk-test-doctor-key") {
+		t.Errorf("output shows the API key unmasked:\n%s", out.String())
+	}
+
+	out.Reset()
+	flagAPIKey = ""
+	err := runDoctor(context.Background(), newTestApp(out))
+	if err == nil || !strings.Contains(err.Error(), "1 check(s) failed") {
+		t.Errorf("runDoctor() without a key error = %v, want one failed check", err)
+	}
+	if !strings.Contains(out.String(), "✗ API key") || !strings.Contains(out.String(), "imggen keys set") {
+		t.Errorf("output missing the failed key check and hint:\n%s", out.String())
+	}
+}
+
+func TestRunDoctor_UsesProxy(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("IMGGEN_CONFIG_DIR", t.TempDir())
+
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer proxy.Close()
+	flagProxy = proxy.URL
+	flagBaseURL = "http://api.example.invalid/v1"
+	flagAPIKey = "sk-test-doctor-key"
+
+	out := &bytes.Buffer{}
+	if err := runDoctor(context.Background(), newTestApp(out)); err != nil {
+		t.Fatalf("runDoctor() error = %v\n%s", err, out.String())
+	}
+	if proxied != "http://api.example.invalid/v1/models" {
+		t.Errorf("proxy saw %q, want the connectivity check to go through --proxy", proxied)
+	}
+}
+
+func TestRunSelfUpdate_Check(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    string
+	}{
+		{"update available", "1.2.0", "Update available"},
+		{"up to date", "1.3.0", "imggen is up to date"},
+		{"newer than release", "v1.4.0", "imggen is up to date"},
+		{"development build", "dev", "development build"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tag_name": "v1.3.0", "assets": []}`)
+	}))
+	defer server.Close()
+
+	oldURL, oldVersion := updateAPIURL, version
+	defer func() { updateAPIURL, version = oldURL, oldVersion }()
+	updateAPIURL = server.URL
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			flagSelfUpdateCheck = true
+			version = tt.version
+
+			if err := runSelfUpdate(context.Background(), app); err != nil {
+				t.Fatalf("runSelfUpdate() error = %v", err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("output = %q, want it to contain %q", out.String(), tt.want)
+			}
+			if !strings.Contains(out.String(), "Latest release:  v1.3.0") {
+				t.Errorf("output = %q, want latest release reported", out.String())
+			}
+		})
+	}
+}
+
+func TestRunSelfUpdate_DevBuildRefusesInstall(t *testing.T) {
+	resetFlags()
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tag_name": "v1.3.0"}`)
+	}))
+	defer server.Close()
+
+	oldURL, oldVersion := updateAPIURL, version
+	defer func() { updateAPIURL, version = oldURL, oldVersion }()
+	updateAPIURL = server.URL
+	version = "dev"
+	flagYes = true
+	defer resetFlags()
+
+	err := runSelfUpdate(context.Background(), app)
+	if err == nil || !strings.Contains(err.Error(), "development build") {
+		t.Errorf("runSelfUpdate() error = %v, want development build error", err)
+	}
+}
+
+func TestRunSelfUpdate_Confirmation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tag_name": "v1.3.0", "assets": []}`)
+	}))
+	defer server.Close()
+
+	oldURL, oldVersion, oldIsTerminal := updateAPIURL, version, isTerminal
+	defer func() { updateAPIURL, version, isTerminal = oldURL, oldVersion, oldIsTerminal }()
+	updateAPIURL = server.URL
+	version = "1.2.0"
+
+	resetFlags()
+	defer resetFlags()
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.In = strings.NewReader("\n")
+	isTerminal = func() bool { return true }
+
+	if err := runSelfUpdate(context.Background(), app); err != nil {
+		t.Fatalf("runSelfUpdate() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "[y/N]") || !strings.Contains(out.String(), "Cancelled.") {
+		t.Errorf("pressing enter should cancel the update:\n%s", out.String())
+	}
+
+	isTerminal = func() bool { return false }
+	err := runSelfUpdate(context.Background(), app)
+	if err == nil || !strings.Contains(err.Error(), "--yes") {
+		t.Errorf("runSelfUpdate() without a terminal error = %v, want --yes to be required", err)
+	}
+}
+
+func TestRunPrice_SetListReset(t *testing.T) {
+	resetFlags()
+	t.Setenv("HOME", t.TempDir())
+	defer func() { priceOverrides = nil }()
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+
+	if err := runPriceSet(app, []string{"gpt-image-1", "1024x1024", "high", "0.19"}); err != nil {
+		t.Fatalf("runPriceSet() error = %v", err)
+	}
+	if got := calculator().Estimate("gpt-image-1", "1024x1024", "high", 1); got.PerImage != 0.19 {
+		t.Errorf("estimate after price set = %v, want 0.19", got.PerImage)
+	}
+
+	out.Reset()
+	if err := runPriceList(app); err != nil {
+		t.Fatalf("runPriceList() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "gpt-image-1") || !strings.Contains(out.String(), "$0.1900") {
+		t.Errorf("price list output = %q", out.String())
+	}
+
+	if err := runPriceReset(app, []string{"gpt-image-1"}); err != nil {
+		t.Fatalf("runPriceReset() error = %v", err)
+	}
+	if got := calculator().Estimate("gpt-image-1", "1024x1024", "high", 1); got.PerImage != 0.167 {
+		t.Errorf("estimate after price reset = %v, want built-in 0.167", got.PerImage)
+	}
+}
+
+func TestRunPriceSet_Invalid(t *testing.T) {
+	resetFlags()
+	t.Setenv("HOME", t.TempDir())
+	defer func() { priceOverrides = nil }()
+	app := newTestApp(&bytes.Buffer{})
+
+	tests := [][]string{
+		{"gpt-image-9", "1024x1024", "high", "0.19"},
+		{"gpt-image-1", "640x480", "high", "0.19"},
+		{"gpt-image-1", "1024x1024", "high", "cheap"},
+	}
+	for _, args := range tests {
+		if err := runPriceSet(app, args); err == nil {
+			t.Errorf("runPriceSet(%v) expected error", args)
+		}
+	}
+
+	path, _ := cost.PricingPath()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("invalid price set should not write %s", path)
+	}
+}
+
+func TestApplyPricing_InvalidFileUsesBuiltIns(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	defer func() { priceOverrides = nil }()
+	if err := os.MkdirAll(filepath.Join(home, ".imggen"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := `{"gpt-image-1": {"1024x1024": {"ultra": 0.5}}}`
+	if err := os.WriteFile(filepath.Join(home, ".imggen", "pricing.json"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	applyPricing(app)
+
+	if !strings.Contains(out.String(), "ignoring price overrides") {
+		t.Errorf("expected a warning, got %q", out.String())
+	}
+	if got := calculator().Estimate("gpt-image-1", "1024x1024", "high", 1); got.PerImage != 0.167 {
+		t.Errorf("estimate = %v, want built-in 0.167", got.PerImage)
+	}
+}
+
+func TestRunSessionExportImport(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	setupHistoryDB(t)
+	t.Setenv("HOME", t.TempDir())
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+
+	flagSessionExportOutput = filepath.Join(t.TempDir(), "s1.zip")
+	if err := runSessionExport(app, "s1"); err != nil {
+		t.Fatalf("runSessionExport() error = %v", err)
+	}
+	// The seeded iterations point at images that do not exist.
+	if !strings.Contains(out.String(), "Exported 2 iteration(s)") || !strings.Contains(out.String(), "2 image(s) were missing") {
+		t.Errorf("export output = %q", out.String())
+	}
+
+	out.Reset()
+	if err := runSessionImport(app, flagSessionExportOutput); err != nil {
+		t.Fatalf("runSessionImport() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "with 2 iteration(s)") {
+		t.Errorf("import output = %q", out.String())
+	}
+
+	dbPath, _ := getDBPath()
+	store, err := session.NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	sessions, err := store.ListSessions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 3 {
+		t.Errorf("%d sessions after import, want 3", len(sessions))
+	}
+}
+
+func TestFlagConflicts(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"transparent with jpeg", []string{"--transparent", "-f", "jpeg", "a logo"}, "--transparent cannot be used with --format jpeg"},
+		{"style with gpt-image-1", []string{"--style", "vivid", "a cat"}, "--style cannot be used with gpt-image-1"},
+		{"seed with dall-e-3", []string{"-m", "dall-e-3", "--seed", "7", "a cat"}, "--seed cannot be used with dall-e-3"},
+		{"transparent with dall-e-3", []string{"-m", "dall-e-3", "--transparent", "a logo"}, "--transparent cannot be used with dall-e-3"},
+		{"prompt flag and positional prompt", []string{"--prompt", "a cat", "a dog"}, "use either --prompt or a positional prompt"},
+		{"interactive with prompt", []string{"-i", "a cat"}, "-i/--interactive cannot be used with a prompt"},
+		{"interactive with json", []string{"-i", "--json"}, "-i/--interactive cannot be used with --json"},
+		{"preview with prompt flag", []string{"--preview-quality", "low", "--prompt", "a cat"}, "--preview-quality cannot be used with --prompt"},
+		{"preview with json", []string{"--preview-quality", "low", "--json", "a cat"}, "--preview-quality cannot be used with --json"},
+		{"preview with explain-only", []string{"--preview-quality", "low", "--explain-only", "a cat"}, "--preview-quality cannot be used with --dry-run"},
+		{"batch input with retry-failed", []string{"batch", "--retry-failed", "results.json", "prompts.txt"}, "cannot use an input file with --retry-failed"},
+		{"ocr url with file", []string{"ocr", "--url", "https://example.com/a.png", "a.png"}, "use either an image file or --url"},
+		{"ocr suggest-schema with schema", []string{"ocr", "--suggest-schema", "--schema", "s.json", "a.png"}, "--suggest-schema cannot be used with --schema"},
+		{"ocr stream with json", []string{"ocr", "--stream", "--json", "a.png"}, "--stream cannot be used with --json"},
+		{"ocr stream with suggest-schema", []string{"ocr", "--stream", "--suggest-schema", "a.png"}, "--stream cannot be used with --suggest-schema"},
+		{"ocr stream with confidence", []string{"ocr", "--stream", "--confidence-threshold", "0.5", "a.png"}, "--stream cannot be used with --confidence-threshold"},
+		{"ocr negative confidence", []string{"ocr", "--schema", "s.json", "--confidence-threshold", "-0.5", "a.png"}, "--confidence-threshold must be between 0 and 1"},
+		{"ocr confidence above one", []string{"ocr", "--schema", "s.json", "--confidence-threshold", "1.5", "a.png"}, "--confidence-threshold must be between 0 and 1"},
+		{"ocr split-fields without schema", []string{"ocr", "--split-fields", "a.png"}, "--split-fields requires --schema"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			flagBatchRetryFailed = ""
+			flagOCRURL, flagOCRSchema, flagOCRSuggestSchema, flagOCRStream, flagOCRConfidence = "", "", false, false, 0
+			flagOCRSplitFields = false
+			t.Setenv("HOME", t.TempDir())
+
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			root := newRootCmd(app)
+			root.SetOut(out)
+			root.SetErr(out)
+			root.SetArgs(tt.args)
+
+			err := root.Execute()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Execute(%v) error = %v, want %q", tt.args, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlagConflicts_ReportsAllAtOnce(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	app := newTestApp(&bytes.Buffer{})
+	flagStyle = "vivid"
+	flagTransparent = true
+	flagFormat = "jpeg"
+	flagPrompts = []string{"a cat"}
+
+	err := runGenerate(&cobra.Command{}, []string{"a dog"}, app)
+	if err == nil {
+		t.Fatal("runGenerate() expected conflict error")
+	}
+	for _, want := range []string{"3 conflicting flag combinations", "--style", "--format jpeg", "--prompt"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if !errors.Is(err, models.ErrStyleNotSupported) || !errors.Is(err, models.ErrInvalidTransparencyFormat) {
+		t.Errorf("error %v should wrap the model validation errors", err)
+	}
+}
+
+func TestRunGenerate_DryRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "single prompt",
+			args: []string{"a cat", "-m", "dall-e-3", "-s", "landscape", "-q", "hd", "-f", "jpeg"},
+			want: []string{"Dry run", "dall-e-3", "1792x1024", "hd", "jpeg", "$0.1200", "a cat"},
+		},
+		{
+			name: "multiple prompts",
+			args: []string{"--prompt", "a cat", "--prompt", "a dog", "-m", "gpt-image-1"},
+			want: []string{"a cat", "a dog", "gpt-image-1", "1024x1024", "2 request(s)"},
+		},
+		{
+			name:    "invalid size",
+			args:    []string{"a cat", "-m", "dall-e-2", "-s", "landscape"},
+			wantErr: "invalid request",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("OPENAI_API_KEY", "")
+
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				t.Fatal("--dry-run created a provider")
+				return nil, nil
+			}
+
+			root := newRootCmd(app)
+			root.SetOut(out)
+			root.SetErr(out)
+			root.SetArgs(append(tt.args, "--dry-run", "-o", t.TempDir()))
+			err := root.Execute()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v\n%s", err, out.String())
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRunGenerate_DryRunJSON(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "")
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		t.Fatal("--dry-run created a provider")
+		return nil, nil
+	}
+
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"a cat", "-m", "gpt-image-1", "-s", "portrait", "-n", "2", "--dry-run", "--json"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+
+	var got dryRunJSON
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	if len(got.Requests) != 1 {
+		t.Fatalf("requests = %+v, want one", got.Requests)
+	}
+	r := got.Requests[0]
+	if r.Model != "gpt-image-1" || r.Size != "1024x1536" || r.Count != 2 || r.Format != "png" {
+		t.Errorf("request = %+v, want gpt-image-1 1024x1536 x2 png", r)
+	}
+	if r.EstimatedCost <= 0 || got.EstimatedCost != r.EstimatedCost {
+		t.Errorf("estimated cost = %v (total %v), want a positive matching total", r.EstimatedCost, got.EstimatedCost)
+	}
+}
+
+func TestRunBatch_DryRun(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "")
+
+	input := filepath.Join(t.TempDir(), "prompts.json")
+	prompts := `[
+		{"prompt": "a red fox"},
+		{"prompt": "a blue bird", "model": "dall-e-3", "size": "portrait"},
+		{"prompt": "a green frog", "model": "dall-e-2", "size": "portrait"}
+	]`
+	if err := os.WriteFile(input, []byte(prompts), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.Err = errOut
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		t.Fatal("--dry-run created a provider")
+		return nil, nil
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"batch", input, "-o", outDir, "--dry-run"})
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "1 of 3") {
+		t.Fatalf("Execute() error = %v, want one invalid item", err)
+	}
+	if !strings.Contains(errOut.String(), "item 3:") {
+		t.Errorf("invalid item not reported:\n%s", errOut.String())
+	}
+	for _, want := range []string{"a red fox", "a blue bird", "1024x1792", "2 request(s)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Errorf("--dry-run created the output directory")
+	}
+}
+
+func TestRunGenerate_StripWeights(t *testing.T) {
+	tests := []struct {
+		name, model string
+		strip       bool
+		want        string
+		warn        bool
+	}{
+		{"stripped for openai", "gpt-image-1", true, "a red fox", true},
+		{"kept without the flag", "gpt-image-1", false, "a (red:1.2) fox", false},
+		{"passed through for stability", "stable-diffusion-xl", true, "a (red:1.2) fox", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			t.Setenv("HOME", t.TempDir())
+
+			out := &bytes.Buffer{}
+			errOut := &bytes.Buffer{}
+			app := newTestApp(out)
+			app.Err = errOut
+			var got string
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				return &mockProvider{
+					generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+						got = req.Prompt
+						return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+					},
+				}, nil
+			}
+			flagAPIKey = "test-key"
+			flagModel = tt.model
+			flagStripWeights = tt.strip
+			flagOutput = filepath.Join(t.TempDir(), "fox.png")
+
+			if err := runGenerate(&cobra.Command{}, []string{"a (red:1.2) fox"}, app); err != nil {
+				t.Fatalf("runGenerate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("prompt sent = %q, want %q", got, tt.want)
+			}
+			if warned := strings.Contains(errOut.String(), "removed prompt weights"); warned != tt.warn {
+				t.Errorf("warning shown = %v, want %v:\n%s", warned, tt.warn, errOut.String())
+			}
+		})
+	}
+}
+
+func TestRunGenerate_Stdout(t *testing.T) {
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, stdimage.NewRGBA(stdimage.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []byte
+	}{
+		{"raw", []string{"-o", "-"}, pngData.Bytes()},
+		{"base64", []string{"--stdout-base64"}, []byte(base64.StdEncoding.EncodeToString(pngData.Bytes()) + "\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			t.Setenv("HOME", t.TempDir())
+			t.Chdir(t.TempDir())
+
+			out := &bytes.Buffer{}
+			errOut := &bytes.Buffer{}
+			app := newTestApp(out)
+			app.Err = errOut
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				return &mockProvider{
+					generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+						return &models.Response{Images: []models.GeneratedImage{{Data: pngData.Bytes()}}}, nil
+					},
+				}, nil
+			}
+
+			root := newRootCmd(app)
+			root.SetOut(out)
+			root.SetErr(errOut)
+			root.SetArgs(append([]string{"a cat", "--api-key", "test-key", "-m", "gpt-image-1"}, tt.args...))
+			if err := root.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v\n%s", err, errOut.String())
+			}
+
+			if !bytes.Equal(out.Bytes(), tt.want) {
+				t.Errorf("stdout = %q, want only the image", out.Bytes())
+			}
+			if !strings.Contains(errOut.String(), "Saved: stdout") {
+				t.Errorf("stderr missing the Saved line:\n%s", errOut.String())
+			}
+			if entries, _ := os.ReadDir("."); len(entries) != 0 {
+				t.Errorf("stdout output also saved files: %v", entries)
+			}
+		})
+	}
+}
+
+func TestRunGenerate_StdoutConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"count", []string{"-o", "-", "-n", "2"}, "writes a single image, got --count 2"},
+		{"json", []string{"--stdout-base64", "--json"}, "cannot be used with --json"},
+		{"output file", []string{"--stdout-base64", "-o", "cat.png"}, "cannot be used with --output cat.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				t.Fatal("conflicting flags created a provider")
+				return nil, nil
+			}
+			root := newRootCmd(app)
+			root.SetOut(out)
+			root.SetErr(out)
+			root.SetArgs(append([]string{"a cat", "--api-key", "test-key"}, tt.args...))
+			err := root.Execute()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunGenerate_EncodeOptions(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+	}
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				return &models.Response{Images: []models.GeneratedImage{{Data: pngData.Bytes()}}}, nil
+			},
+		}, nil
+	}
+
+	sizes := map[string]int{}
+	for _, quality := range []string{"95", "10"} {
+		path := filepath.Join(t.TempDir(), "cat.jpeg")
+		root := newRootCmd(app)
+		root.SetOut(out)
+		root.SetErr(out)
+		root.SetArgs([]string{"a cat", "--api-key", "test-key", "-m", "dall-e-2", "-f", "jpeg", "-o", path, "--jpeg-quality", quality})
+		if err := root.Execute(); err != nil {
+			t.Fatalf("Execute() error = %v\n%s", err, out.String())
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[quality] = int(info.Size())
+	}
+	if sizes["10"] >= sizes["95"] {
+		t.Errorf("--jpeg-quality 10 saved %d bytes, want less than --jpeg-quality 95's %d", sizes["10"], sizes["95"])
+	}
+
+	for _, args := range [][]string{{"--jpeg-quality", "0"}, {"--webp-quality", "101"}} {
+		resetFlags()
+		root := newRootCmd(app)
+		root.SetOut(out)
+		root.SetErr(out)
+		root.SetArgs(append([]string{"a cat", "--api-key", "test-key"}, args...))
+		if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "quality must be between") {
+			t.Errorf("%v: Execute() error = %v, want a range error", args, err)
+		}
+	}
+}
+
+func TestRunGenerate_NameTemplate(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, stdimage.NewRGBA(stdimage.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				return &models.Response{Images: []models.GeneratedImage{{Data: pngData.Bytes()}, {Data: pngData.Bytes()}}}, nil
+			},
+		}, nil
+	}
+
+	dir := t.TempDir()
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"a red fox", "--api-key", "test-key", "-m", "dall-e-2", "-n", "2", "-f", "png",
+		"-o", dir, "--name-template", "{model}-{size}-{index}-{prompt}"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+	for _, name := range []string{"dall-e-2-1024x1024-001-a-red-fox.png", "dall-e-2-1024x1024-002-a-red-fox.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s: %v\n%s", name, err, out.String())
+		}
+	}
+}
+
+func TestRunGenerate_NameTemplateConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"output file", []string{"a cat", "-o", "cat.png", "--name-template", "{index}"}, "--output cat.png is a file"},
+		{"stdout", []string{"a cat", "-o", "-", "--name-template", "{index}"}, "cannot be used with -o -"},
+		{"unknown token", []string{"a cat", "--name-template", "{color}"}, "unknown name template token {color}"},
+		{"traversal", []string{"a cat", "--name-template", "../{index}"}, "path traversal"},
+		{"prompts without index", []string{"-P", "a cat", "-P", "a dog", "--name-template", "{prompt}"}, "must include {index}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				t.Fatal("conflicting flags created a provider")
+				return nil, nil
+			}
+			root := newRootCmd(app)
+			root.SetOut(out)
+			root.SetErr(out)
+			root.SetArgs(append([]string{"--api-key", "test-key"}, tt.args...))
+			err := root.Execute()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Execute() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunGenerate_CombinePrompts(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"with positional", []string{"a castle", "-P", "at dusk", "-P", "oil painting"}, "a castle, at dusk, oil painting"},
+		{"prompts only", []string{"-P", "a castle", "-P", " ", "-P", "at dusk"}, "a castle, at dusk"},
+		{"separator", []string{"-P", "a castle", "-P", "at dusk", "--combine-separator", ". "}, "a castle. at dusk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags()
+			defer resetFlags()
+			t.Setenv("HOME", t.TempDir())
+
+			var prompts []string
+			out := &bytes.Buffer{}
+			app := newTestApp(out)
+			app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+				return &mockProvider{
+					generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+						prompts = append(prompts, req.Prompt)
+						return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+					},
+				}, nil
+			}
+
+			dir := t.TempDir()
+			root := newRootCmd(app)
+			root.SetOut(out)
+			root.SetErr(out)
+			root.SetArgs(append([]string{"--api-key", "test-key", "--combine-prompts", "-o", filepath.Join(dir, "out.png")}, tt.args...))
+			if err := root.Execute(); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if len(prompts) != 1 || prompts[0] != tt.want {
+				t.Errorf("generated %q, want one call with %q", prompts, tt.want)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("saved %d files, want 1", len(entries))
+			}
+		})
+	}
+}
+
+func TestRunGenerate_CombinePromptsWithoutPrompt(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		t.Fatal("conflicting flags created a provider")
+		return nil, nil
+	}
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"--api-key", "test-key", "--combine-prompts", "a castle"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "pass at least one --prompt") {
+		t.Errorf("Execute() error = %v, want --prompt required", err)
+	}
+}
+
+func TestRunGenerate_EmbedMetadataInspect(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, stdimage.NewRGBA(stdimage.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				return &models.Response{
+					Images:        []models.GeneratedImage{{Data: pngData.Bytes()}},
+					RevisedPrompt: "A fluffy cat.",
+				}, nil
+			},
+		}, nil
+	}
+
+	path := filepath.Join(t.TempDir(), "cat.png")
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"a cat", "--api-key", "test-key", "-m", "dall-e-3", "-f", "png", "-o", path, "--embed-metadata"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+
+	out.Reset()
+	root = newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"inspect", path})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("inspect error = %v\n%s", err, out.String())
+	}
+	for _, want := range []string{"Prompt:", "a cat", "Revised prompt:", "A fluffy cat.", "dall-e-3", "1024x1024", "standard"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("inspect output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunGenerate_ProvenanceInspect(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	t.Setenv("HOME", t.TempDir())
+
+	var jpgData bytes.Buffer
+	if err := jpeg.Encode(&jpgData, stdimage.NewRGBA(stdimage.Rect(0, 0, 2, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	app := newTestApp(out)
+	app.NewProvider = func(cfg *provider.Config, registry *models.ModelRegistry) (provider.Provider, error) {
+		return &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				return &models.Response{Images: []models.GeneratedImage{{Data: jpgData.Bytes()}}}, nil
+			},
+		}, nil
+	}
+
+	path := filepath.Join(t.TempDir(), "cat.jpeg")
+	root := newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"a cat", "--api-key", "test-key", "-m", "dall-e-3", "-f", "jpeg", "-o", path, "--provenance"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v\n%s", err, out.String())
+	}
+
+	out.Reset()
+	root = newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"inspect", path})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("inspect error = %v\n%s", err, out.String())
+	}
+	for _, want := range []string{"Provenance:", "Generator:", "imggen", "dall-e-3", "sha256:", "trainedAlgorithmicMedia"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("inspect output missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "a cat") {
+		t.Errorf("provenance should hold a hash, not the prompt:\n%s", out.String())
+	}
+
+	out.Reset()
+	root = newRootCmd(app)
+	root.SetOut(out)
+	root.SetErr(out)
+	root.SetArgs([]string{"inspect", path, "--json"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("inspect --json error = %v\n%s", err, out.String())
+	}
+	var got struct {
+		Prompt     string            `json:"prompt"`
+		Provenance *image.Provenance `json:"provenance"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	if got.Prompt != "" || got.Provenance == nil || got.Provenance.Model != "dall-e-3" {
+		t.Errorf("inspect --json = %+v, want only the provenance", got)
+	}
+}
+
+func TestRunInspect_NoMetadata(t *testing.T) {
+	resetFlags()
+	defer resetFlags()
+	path := filepath.Join(t.TempDir(), "plain.png")
+	writeTestPNG(t, path)
+
+	err := runInspect(newTestApp(&bytes.Buffer{}), path)
+	if err == nil || !strings.Contains(err.Error(), "no imggen metadata") {
+		t.Errorf("runInspect() error = %v, want no metadata", err)
+	}
+}
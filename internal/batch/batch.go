@@ -2,16 +2,20 @@ package batch
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"path/filepath"
-	"regexp"
-	"strings"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/manash/imggen/internal/cost"
+	"github.com/manash/imggen/internal/events"
 	"github.com/manash/imggen/internal/image"
 	"github.com/manash/imggen/internal/provider"
+	"github.com/manash/imggen/internal/throttle"
 	"github.com/manash/imggen/pkg/models"
 )
 
@@ -22,6 +26,17 @@ type Result struct {
 	Cost     float64
 	Error    error
 	Duration time.Duration
+
+	// Model, Size, Quality, and Style are the settings the item was sent
+	// with, after the batch and model defaults. They are empty when the
+	// item failed before a request was resolved.
+	Model   string
+	Size    string
+	Quality string
+	Style   string
+
+	// Skipped is set for items a resumed run found already completed.
+	Skipped bool
 }
 
 type Options struct {
@@ -33,6 +48,48 @@ type Options struct {
 	Parallel       int
 	StopOnError    bool
 	DelayMs        int
+
+	// RequestsPerMinute caps how many requests start per minute across all
+	// workers, independent of Parallel. Zero means no limit.
+	RequestsPerMinute int
+
+	// Checkpoint records completed items in CheckpointFileName inside
+	// OutputDir as the batch runs. The file is removed once every item
+	// has succeeded.
+	Checkpoint bool
+
+	// Resume skips items recorded as completed in an existing checkpoint.
+	Resume bool
+
+	// Throttle, when set, spaces requests across imggen processes.
+	Throttle *throttle.Throttle
+
+	// NoRevise asks dall-e-3 to use each prompt as written.
+	NoRevise bool
+
+	// StripWeights removes weighted terms such as "(term:1.2)" from the
+	// prompts of models that do not support them.
+	StripWeights bool
+
+	// EmbedMetadata records each item's prompt and settings in its PNG or
+	// JPEG file.
+	EmbedMetadata bool
+
+	// Provenance marks each item's PNG or JPEG file as AI-generated with
+	// an image.Provenance block.
+	Provenance bool
+
+	// NameTemplate names each item's output file inside OutputDir.
+	// Empty means image.BatchNameTemplate.
+	NameTemplate image.NameTemplate
+
+	// Budget, when set, stops the run before a request whose estimated
+	// cost would take the run's spend past it.
+	Budget *cost.Budget
+
+	// PriceOverrides replace the built-in prices in cost estimates and
+	// budget checks.
+	PriceOverrides cost.Overrides
 }
 
 type Processor struct {
@@ -42,6 +99,9 @@ type Processor struct {
 	out      io.Writer
 	err      io.Writer
 	outMu    sync.Mutex
+	money    *cost.Formatter
+	events   *events.Logger
+	quiet    bool
 }
 
 func NewProcessor(prov provider.Provider, saver *image.Saver, registry *models.ModelRegistry, out, errOut io.Writer) *Processor {
@@ -54,6 +114,22 @@ func NewProcessor(prov provider.Provider, saver *image.Saver, registry *models.M
 	}
 }
 
+// SetCostFormatter sets how costs are rendered in the summary.
+func (p *Processor) SetCostFormatter(f *cost.Formatter) {
+	p.money = f
+}
+
+// SetEventLogger records every generation request in the given event log.
+func (p *Processor) SetEventLogger(l *events.Logger) {
+	p.events = l
+}
+
+// SetQuiet drops progress lines, warnings, and the summary, leaving only
+// saved paths and errors.
+func (p *Processor) SetQuiet(quiet bool) {
+	p.quiet = quiet
+}
+
 func (p *Processor) printf(format string, args ...interface{}) {
 	p.outMu.Lock()
 	fmt.Fprintf(p.out, format, args...)
@@ -66,60 +142,234 @@ func (p *Processor) errorf(format string, args ...interface{}) {
 	p.outMu.Unlock()
 }
 
+// infof prints a progress line unless the processor is quiet.
+func (p *Processor) infof(format string, args ...interface{}) {
+	if !p.quiet {
+		p.printf(format, args...)
+	}
+}
+
+// warnf prints a warning unless the processor is quiet.
+func (p *Processor) warnf(format string, args ...interface{}) {
+	if !p.quiet {
+		p.errorf(format, args...)
+	}
+}
+
+// runState holds what the items of one Process call share.
+type runState struct {
+	limiter    *rateLimiter
+	checkpoint *checkpoint
+}
+
+// Process runs every item and returns their results in item order. It is
+// ProcessStream drained by Collect.
 func (p *Processor) Process(ctx context.Context, items []Item, opts *Options) ([]Result, error) {
-	if opts.Parallel <= 1 {
-		return p.processSequential(ctx, items, opts)
+	stream, err := p.ProcessStream(ctx, items, opts)
+	if err != nil {
+		return nil, err
 	}
-	return p.processParallel(ctx, items, opts)
+	return Collect(ctx, items, opts, stream, nil)
 }
 
-func (p *Processor) processSequential(ctx context.Context, items []Item, opts *Options) ([]Result, error) {
-	results := make([]Result, len(items))
-	total := len(items)
+// ProcessStream starts running items and returns a channel that receives
+// each Result as soon as its item finishes, so parallel runs can report
+// progress live. Results arrive in completion order, which is item order
+// when Parallel is 1; Result.Index identifies the item. The channel is
+// closed after the last item, or early when ctx is canceled or StopOnError
+// stops the run. Callers must drain the channel.
+func (p *Processor) ProcessStream(ctx context.Context, items []Item, opts *Options) (<-chan Result, error) {
+	return p.run(ctx, slices.Values(items), len(items), opts)
+}
 
+// ProcessSeq runs items as they arrive, such as from StreamJSON, so a large
+// batch file starts generating before it has been read in full and is never
+// held in memory. Each Result is passed to each as its item finishes
+// instead of being collected. An error from items ends the run after the
+// items already started and is returned; otherwise the error is as for
+// Collect.
+func (p *Processor) ProcessSeq(ctx context.Context, items iter.Seq2[Item, error], opts *Options, each func(Result)) error {
+	var seqErr error
+	seq := func(yield func(Item) bool) {
+		for item, err := range items {
+			if err != nil {
+				seqErr = err
+				return
+			}
+			if !yield(item) {
+				return
+			}
+		}
+	}
+
+	stream, err := p.run(ctx, seq, 0, opts)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for r := range stream {
+		each(r)
+		if stops(r, opts) && firstErr == nil {
+			firstErr = fmt.Errorf("stopped at item %d: %w", r.Index, r.Error)
+		}
+	}
+
+	// The stream closes only after items is done with, so seqErr is set.
+	if seqErr != nil {
+		return seqErr
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// run starts running the items of seq, of which there are total, or an
+// unknown number when total is 0.
+func (p *Processor) run(ctx context.Context, seq iter.Seq[Item], total int, opts *Options) (<-chan Result, error) {
+	st := &runState{limiter: newRateLimiter(opts.RequestsPerMinute)}
+
+	if opts.Checkpoint || opts.Resume {
+		path := CheckpointPath(opts.OutputDir)
+		if opts.Resume {
+			cp, err := loadCheckpoint(path)
+			if err != nil {
+				return nil, err
+			}
+			st.checkpoint = cp
+		} else {
+			st.checkpoint = newCheckpoint(path)
+		}
+	}
+
+	results := make(chan Result)
+	go func() {
+		defer close(results)
+
+		started, succeeded := 0, 0
+		counted := func(yield func(Item) bool) {
+			for item := range seq {
+				started++
+				if !yield(item) {
+					return
+				}
+			}
+		}
+		emit := func(r Result) {
+			if r.Error == nil && r.Path != "" {
+				succeeded++
+			}
+			results <- r
+		}
+
+		if opts.Parallel <= 1 {
+			p.processSequential(ctx, counted, total, opts, st, emit)
+		} else {
+			p.processParallel(ctx, counted, total, opts, st, emit)
+		}
+
+		// Items the run never reached keep the checkpoint, since seq may
+		// have more than started.
+		if succeeded == started && ctx.Err() == nil {
+			if rmErr := st.checkpoint.remove(); rmErr != nil {
+				p.warnf("Warning: %v\n", rmErr)
+			}
+		}
+	}()
+
+	return results, nil
+}
+
+// Collect drains a ProcessStream channel and returns the results in item
+// order, calling each (when non-nil) as every result arrives. Items that
+// never ran because the run stopped early have zero Results. The error is
+// the first failure when StopOnError is set or the budget ran out, or ctx's
+// error when the run was canceled before every item finished.
+func Collect(ctx context.Context, items []Item, opts *Options, stream <-chan Result, each func(Result)) ([]Result, error) {
+	// Map indexes to positions, allowing for repeated indexes.
+	positions := make(map[int][]int, len(items))
 	for i, item := range items {
-		select {
-		case <-ctx.Done():
-			return results, ctx.Err()
-		default:
+		positions[item.Index] = append(positions[item.Index], i)
+	}
+
+	results := make([]Result, len(items))
+	var firstErr error
+	received := 0
+	for r := range stream {
+		if each != nil {
+			each(r)
 		}
+		if pos := positions[r.Index]; len(pos) > 0 {
+			results[pos[0]] = r
+			positions[r.Index] = pos[1:]
+		}
+		received++
+		if stops(r, opts) && firstErr == nil {
+			firstErr = fmt.Errorf("stopped at item %d: %w", r.Index, r.Error)
+		}
+	}
+
+	if firstErr != nil {
+		return results, firstErr
+	}
+	if received < len(items) && ctx.Err() != nil {
+		return results, ctx.Err()
+	}
+	return results, nil
+}
 
-		result := p.processItem(ctx, item, opts, i+1, total)
-		results[i] = result
+// stops reports whether result ends the run: any failure under StopOnError,
+// and always once the budget is exhausted.
+func stops(result Result, opts *Options) bool {
+	if result.Error == nil {
+		return false
+	}
+	return opts.StopOnError || errors.Is(result.Error, cost.ErrBudgetExceeded)
+}
 
-		if result.Error != nil && opts.StopOnError {
-			return results, fmt.Errorf("stopped at item %d: %w", i+1, result.Error)
+func (p *Processor) processSequential(ctx context.Context, items iter.Seq[Item], total int, opts *Options, st *runState, emit func(Result)) {
+	current := 0
+	delay := false
+	for item := range items {
+		if ctx.Err() != nil {
+			return
 		}
 
-		if opts.DelayMs > 0 && i < len(items)-1 {
+		if delay {
 			select {
 			case <-ctx.Done():
-				return results, ctx.Err()
+				return
 			case <-time.After(time.Duration(opts.DelayMs) * time.Millisecond):
 			}
 		}
-	}
 
-	return results, nil
-}
+		current++
+		result := p.processItem(ctx, item, opts, st, current, total)
+		emit(result)
 
-func (p *Processor) processParallel(ctx context.Context, items []Item, opts *Options) ([]Result, error) {
-	results := make([]Result, len(items))
-	total := len(items)
+		if stops(result, opts) {
+			return
+		}
+		delay = opts.DelayMs > 0 && !result.Skipped
+	}
+}
 
+func (p *Processor) processParallel(ctx context.Context, items iter.Seq[Item], total int, opts *Options, st *runState, emit func(Result)) {
 	type job struct {
 		index int
 		item  Item
 	}
 
-	jobs := make(chan job, len(items))
+	jobs := make(chan job)
+	// halt is closed once the run stops, so the feeder below stops too.
+	halt := make(chan struct{})
 	var wg sync.WaitGroup
 	var mu sync.Mutex
-	var firstErr error
+	var stopped bool
 
 	workers := opts.Parallel
-	if workers > len(items) {
-		workers = len(items)
+	if total > 0 && workers > total {
+		workers = total
 	}
 
 	for w := 0; w < workers; w++ {
@@ -127,97 +377,123 @@ func (p *Processor) processParallel(ctx context.Context, items []Item, opts *Opt
 		go func() {
 			defer wg.Done()
 			for j := range jobs {
-				select {
-				case <-ctx.Done():
+				if ctx.Err() != nil {
 					return
-				default:
 				}
 
-				result := p.processItem(ctx, j.item, opts, j.index+1, total)
-
 				mu.Lock()
-				results[j.index] = result
-				if result.Error != nil && opts.StopOnError && firstErr == nil {
-					firstErr = result.Error
-				}
+				halted := stopped
 				mu.Unlock()
-
-				if opts.StopOnError && firstErr != nil {
+				if halted {
 					return
 				}
+
+				result := p.processItem(ctx, j.item, opts, st, j.index+1, total)
+
+				// emit is not safe for concurrent use, and holding the
+				// lock keeps StopOnError from letting later items through.
+				mu.Lock()
+				emit(result)
+				if stops(result, opts) && !stopped {
+					stopped = true
+					close(halt)
+				}
+				mu.Unlock()
 			}
 		}()
 	}
 
-	for i, item := range items {
-		if opts.StopOnError && firstErr != nil {
-			break
+	i := 0
+feed:
+	for item := range items {
+		select {
+		case jobs <- job{index: i, item: item}:
+			i++
+		case <-halt:
+			break feed
+		case <-ctx.Done():
+			break feed
 		}
-		jobs <- job{index: i, item: item}
 	}
 	close(jobs)
 
 	wg.Wait()
+}
 
-	if firstErr != nil {
-		return results, fmt.Errorf("batch stopped due to error: %w", firstErr)
+// progress labels the current item of total, which is 0 when unknown.
+func progress(current, total int) string {
+	if total == 0 {
+		return fmt.Sprintf("[%d]", current)
 	}
-
-	return results, nil
+	return fmt.Sprintf("[%d/%d]", current, total)
 }
 
-func (p *Processor) processItem(ctx context.Context, item Item, opts *Options, current, total int) Result {
+func (p *Processor) processItem(ctx context.Context, item Item, opts *Options, st *runState, current, total int) Result {
 	start := time.Now()
 	result := Result{
 		Index:  item.Index,
 		Prompt: item.Prompt,
 	}
 
-	promptDisplay := truncate(item.Prompt, 50)
-	p.printf("[%d/%d] Generating: %q...\n", current, total, promptDisplay)
-
-	model := item.Model
-	if model == "" {
-		model = opts.DefaultModel
+	if opts.Resume {
+		if path, ok := st.checkpoint.completed(item); ok {
+			p.infof("%s Skipping %q: already completed\n", progress(current, total), truncate(item.Prompt, 50))
+			result.Path = path
+			result.Skipped = true
+			return result
+		}
 	}
 
-	req := models.NewRequest(item.Prompt)
-	req.Model = model
-	req.Format = opts.Format
+	promptDisplay := truncate(item.Prompt, 50)
+	p.infof("%s Generating: %q...\n", progress(current, total), promptDisplay)
 
-	if item.Size != "" {
-		req.Size = item.Size
-	} else if opts.DefaultSize != "" {
-		req.Size = opts.DefaultSize
+	req, err := Resolve(item, opts, p.registry)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		p.errorf("       Error: %v\n", result.Error)
+		return result
 	}
-
-	if item.Quality != "" {
-		req.Quality = item.Quality
-	} else if opts.DefaultQuality != "" {
-		req.Quality = opts.DefaultQuality
+	result.Model, result.Size, result.Quality, result.Style = req.Model, req.Size, req.Quality, req.Style
+	// Resolve only rewrites the prompt when stripping weights.
+	if req.Prompt != item.Prompt {
+		p.warnf("       Warning: removed prompt weights; %s does not support weighted terms\n", req.Model)
 	}
 
-	if item.Style != "" {
-		req.Style = item.Style
+	estimate := cost.NewCalculator(cost.WithOverrides(opts.PriceOverrides)).Estimate(req.Model, req.Size, req.Quality, req.Count).Total
+	if err := opts.Budget.Reserve(estimate); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		p.errorf("       Error: %v\n", result.Error)
+		return result
 	}
+	// Whatever happens next, the reservation becomes the actual cost.
+	var spent float64
+	defer func() { opts.Budget.Settle(estimate, spent) }()
 
-	caps, ok := p.registry.Get(model)
-	if !ok {
-		result.Error = fmt.Errorf("unknown model: %s", model)
+	if err := st.limiter.Wait(ctx); err != nil {
+		result.Error = fmt.Errorf("rate limit: %w", err)
 		result.Duration = time.Since(start)
 		p.errorf("       Error: %v\n", result.Error)
 		return result
 	}
-	caps.ApplyDefaults(req)
 
-	if err := caps.Validate(req); err != nil {
-		result.Error = fmt.Errorf("validation failed: %w", err)
+	if err := opts.Throttle.Wait(ctx); err != nil {
+		result.Error = fmt.Errorf("throttle: %w", err)
 		result.Duration = time.Since(start)
 		p.errorf("       Error: %v\n", result.Error)
 		return result
 	}
 
+	callStart := time.Now()
 	resp, err := p.provider.Generate(ctx, req)
+	p.logEvent(req, resp, callStart, err)
+	if err == nil {
+		spent = estimate
+		if resp.Cost != nil {
+			spent = resp.Cost.Total
+		}
+	}
 	if err != nil {
 		result.Error = fmt.Errorf("generation failed: %w", err)
 		result.Duration = time.Since(start)
@@ -225,10 +501,35 @@ func (p *Processor) processItem(ctx context.Context, item Item, opts *Options, c
 		return result
 	}
 
-	filename := generateFilename(item.Index, item.Prompt, opts.Format)
+	// Without a batch-wide format each item is saved in its model's format.
+	format := opts.Format
+	if format == "" {
+		format = req.Format
+	}
+	filename, err := generateFilename(opts.NameTemplate, image.NameFields{
+		Index:  item.Index,
+		Prompt: item.Prompt,
+		Model:  req.Model,
+		Size:   req.Size,
+		Seed:   req.Seed,
+		Time:   start,
+	}, format)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		p.errorf("       Error: %v\n", result.Error)
+		return result
+	}
 	outputPath := filepath.Join(opts.OutputDir, filename)
 
-	paths, err := p.saver.SaveAll(ctx, resp, outputPath, opts.Format)
+	saver := p.saver
+	if opts.EmbedMetadata {
+		saver = saver.WithParams(image.NewGenerationParams(req, resp))
+	}
+	if opts.Provenance {
+		saver = saver.WithProvenance(image.NewProvenance(req, resp))
+	}
+	paths, err := saver.SaveAll(ctx, resp, outputPath, format)
 	if err != nil {
 		result.Error = fmt.Errorf("save failed: %w", err)
 		result.Duration = time.Since(start)
@@ -239,6 +540,10 @@ func (p *Processor) processItem(ctx context.Context, item Item, opts *Options, c
 	result.Path = paths[0]
 	result.Duration = time.Since(start)
 
+	if err := st.checkpoint.markDone(item, result.Path); err != nil {
+		p.warnf("       Warning: %v\n", err)
+	}
+
 	if resp.Cost != nil {
 		result.Cost = resp.Cost.Total
 		p.printf("       Saved: %s ($%.4f)\n", result.Path, result.Cost)
@@ -249,40 +554,138 @@ func (p *Processor) processItem(ctx context.Context, item Item, opts *Options, c
 	return result
 }
 
-func generateFilename(index int, prompt string, format models.OutputFormat) string {
-	sanitized := sanitizePrompt(prompt)
-	return fmt.Sprintf("%03d-%s.%s", index, sanitized, format)
-}
+// Resolve returns the request item is generated with: the batch defaults in
+// opts applied, then the model's own defaults, and validated against the
+// model.
+func Resolve(item Item, opts *Options, registry *models.ModelRegistry) (*models.Request, error) {
+	req := newRequest(item, opts)
+	caps, ok := registry.Get(req.Model)
+	if !ok {
+		return nil, fmt.Errorf("unknown model: %s", req.Model)
+	}
+	caps.ApplyDefaults(req)
+	if opts.StripWeights {
+		req.Prompt, _ = caps.StripWeights(req.Prompt)
+	}
 
-var windowsReservedNames = map[string]bool{
-	"con": true, "prn": true, "aux": true, "nul": true,
-	"com1": true, "com2": true, "com3": true, "com4": true,
-	"com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
-	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true,
-	"lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+	if err := caps.Validate(req); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	return req, nil
 }
 
-func sanitizePrompt(prompt string) string {
-	reg := regexp.MustCompile(`[^a-zA-Z0-9\s-]`)
-	sanitized := reg.ReplaceAllString(prompt, "")
-	sanitized = strings.ToLower(sanitized)
-	sanitized = strings.Join(strings.Fields(sanitized), "-")
-	sanitized = strings.TrimLeft(sanitized, "-")
+// newRequest builds the request for item, filling unset fields from the
+// batch defaults in opts.
+func newRequest(item Item, opts *Options) *models.Request {
+	req := models.NewRequest(item.Prompt)
+	req.Model = item.Model
+	if req.Model == "" {
+		req.Model = opts.DefaultModel
+	}
+	req.Format = opts.Format
+	req.NoRevise = opts.NoRevise
 
-	if len(sanitized) > 50 {
-		sanitized = sanitized[:50]
+	if item.Size != "" {
+		req.Size = item.Size
+	} else if opts.DefaultSize != "" {
+		req.Size = opts.DefaultSize
 	}
-	sanitized = strings.TrimSuffix(sanitized, "-")
 
-	if sanitized == "" {
-		sanitized = "image"
+	if item.Quality != "" {
+		req.Quality = item.Quality
+	} else if opts.DefaultQuality != "" {
+		req.Quality = opts.DefaultQuality
 	}
 
-	if windowsReservedNames[sanitized] {
-		sanitized = sanitized + "-img"
+	if item.Style != "" {
+		req.Style = item.Style
 	}
+	return req
+}
 
-	return sanitized
+// Dedupe removes items that would generate the same prompt with the same
+// model, size and quality as an earlier item, after applying the batch and
+// model defaults, and returns the remaining items and how many were removed.
+// Prompts must match exactly. Kept items keep their index, so their
+// filenames are the same as without deduplication.
+func Dedupe(items []Item, opts *Options, registry *models.ModelRegistry) ([]Item, int) {
+	type key struct{ prompt, model, size, quality string }
+	seen := make(map[key]bool, len(items))
+	kept := make([]Item, 0, len(items))
+	for _, item := range items {
+		req := newRequest(item, opts)
+		if caps, ok := registry.Get(req.Model); ok {
+			caps.ApplyDefaults(req)
+		}
+		k := key{req.Prompt, req.Model, req.Size, req.Quality}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		kept = append(kept, item)
+	}
+	return kept, len(items) - len(kept)
+}
+
+// CostEstimate is what a batch is expected to cost before it runs.
+type CostEstimate struct {
+	Total float64
+	// Unpriced holds the Index of each item with no known price, because
+	// its model is unknown or missing from the price table. Those items
+	// are left out of Total.
+	Unpriced []int
+}
+
+// EstimateCost returns what generating every item would cost according to
+// the price table, using the same model, size and quality each item would
+// be generated with.
+func (p *Processor) EstimateCost(items []Item, opts *Options) CostEstimate {
+	calc := cost.NewCalculator(cost.WithOverrides(opts.PriceOverrides))
+	var est CostEstimate
+	for _, item := range items {
+		req := newRequest(item, opts)
+		caps, ok := p.registry.Get(req.Model)
+		if !ok {
+			est.Unpriced = append(est.Unpriced, item.Index)
+			continue
+		}
+		caps.ApplyDefaults(req)
+		info := calc.Estimate(req.Model, req.Size, req.Quality, req.Count)
+		if info.PerImage == 0 {
+			est.Unpriced = append(est.Unpriced, item.Index)
+			continue
+		}
+		est.Total += info.Total
+	}
+	return est
+}
+
+// logEvent appends a generate event for req. Failures to write the log are
+// reported as warnings and never fail the item.
+func (p *Processor) logEvent(req *models.Request, resp *models.Response, start time.Time, err error) {
+	var costInfo *models.CostInfo
+	if resp != nil {
+		costInfo = resp.Cost
+	}
+	e := events.Event{Op: events.OpGenerate, Model: req.Model, Size: req.Size, Quality: req.Quality}
+	p.events.Record(itemWarnings{p}, e, req.Prompt, costInfo, start, err)
+}
+
+// itemWarnings writes warnings indented under an item's progress line.
+type itemWarnings struct{ p *Processor }
+
+func (w itemWarnings) Write(b []byte) (int, error) {
+	w.p.warnf("       %s", b)
+	return len(b), nil
+}
+
+// generateFilename names an item's output file with tmpl, or with
+// image.BatchNameTemplate if tmpl is empty.
+func generateFilename(tmpl image.NameTemplate, fields image.NameFields, format models.OutputFormat) (string, error) {
+	if tmpl == "" {
+		tmpl = image.BatchNameTemplate
+	}
+	return tmpl.Expand(fields, format)
 }
 
 func truncate(s string, maxLen int) string {
@@ -293,27 +696,44 @@ func truncate(s string, maxLen int) string {
 }
 
 func (p *Processor) PrintSummary(results []Result) {
-	var successful, failed int
+	var successful, failed, skipped, notRun int
 	var totalCost float64
 	var errors []Result
 
 	for _, r := range results {
-		if r.Error != nil {
+		switch {
+		case r.Error != nil:
 			failed++
 			errors = append(errors, r)
-		} else {
+		case r.Path == "":
+			// Never reached because the run stopped early.
+			notRun++
+		default:
 			successful++
 			totalCost += r.Cost
 		}
+		if r.Skipped {
+			skipped++
+		}
+	}
+
+	if p.quiet {
+		return
 	}
 
 	fmt.Fprintln(p.out)
 	fmt.Fprintln(p.out, "Summary:")
 	fmt.Fprintf(p.out, "  Successful: %d/%d images\n", successful, len(results))
+	if skipped > 0 {
+		fmt.Fprintf(p.out, "  Skipped: %d (completed in an earlier run)\n", skipped)
+	}
 	if failed > 0 {
 		fmt.Fprintf(p.out, "  Failed: %d (see errors below)\n", failed)
 	}
-	fmt.Fprintf(p.out, "  Total cost: $%.4f\n", totalCost)
+	if notRun > 0 {
+		fmt.Fprintf(p.out, "  Not run: %d (the batch stopped early)\n", notRun)
+	}
+	fmt.Fprintf(p.out, "  Total cost: %s\n", p.money.USD(totalCost, 4))
 
 	if len(errors) > 0 {
 		fmt.Fprintln(p.out)
@@ -1,13 +1,25 @@
 package batch
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/manash/imggen/internal/cost"
+	"github.com/manash/imggen/internal/events"
 	"github.com/manash/imggen/internal/image"
 	"github.com/manash/imggen/internal/provider"
 	"github.com/manash/imggen/pkg/models"
@@ -103,6 +115,24 @@ func TestParseJSON(t *testing.T) {
 			want:    0,
 			wantErr: true,
 		},
+		{
+			name:    "truncated after item",
+			input:   `[{"prompt": "one"},`,
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "not an array",
+			input:   `{"prompt": "one"}`,
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "trailing data",
+			input:   `[{"prompt": "one"}] [{"prompt": "two"}]`,
+			want:    0,
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -119,46 +149,108 @@ func TestParseJSON(t *testing.T) {
 	}
 }
 
-func TestSanitizePrompt(t *testing.T) {
-	tests := []struct {
-		input string
-		want  string
-	}{
-		{"a sunset over mountains", "a-sunset-over-mountains"},
-		{"Hello World!", "hello-world"},
-		{"test@#$%^&*()prompt", "testprompt"},
-		{"  multiple   spaces  ", "multiple-spaces"},
-		{"", "image"},
-		{strings.Repeat("a", 100), strings.Repeat("a", 50)},
+func TestStreamJSON_PartialFile(t *testing.T) {
+	input := `[{"prompt": "one"}, {"prompt": "two", "size": "512x512"}, {"prompt": "thr`
+
+	var items []Item
+	var streamErr error
+	for item, err := range StreamJSON(strings.NewReader(input)) {
+		if err != nil {
+			streamErr = err
+			break
+		}
+		items = append(items, item)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			got := sanitizePrompt(tt.input)
-			if got != tt.want {
-				t.Errorf("sanitizePrompt(%q) = %q, want %q", tt.input, got, tt.want)
-			}
-		})
+	if len(items) != 2 {
+		t.Fatalf("got %d items before the error, want 2", len(items))
+	}
+	if items[1].Index != 2 || items[1].Size != "512x512" {
+		t.Errorf("item 2 = %+v", items[1])
 	}
+	if streamErr == nil || !strings.Contains(streamErr.Error(), "item 3") {
+		t.Errorf("error = %v, want error naming item 3", streamErr)
+	}
+}
+
+// countingReader records how many bytes have been read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestStreamJSON_LargeArray(t *testing.T) {
+	const n = 100000
+
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i := range n {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, `{"prompt": "synthetic prompt %d", "quality": "low"}`, i+1)
+	}
+	buf.WriteString("]")
+	total := buf.Len()
+
+	t.Run("yields every item in order", func(t *testing.T) {
+		count := 0
+		for item, err := range StreamJSON(bytes.NewReader(buf.Bytes())) {
+			if err != nil {
+				t.Fatalf("item %d: %v", count+1, err)
+			}
+			count++
+			if item.Index != count || item.Prompt != fmt.Sprintf("synthetic prompt %d", count) {
+				t.Fatalf("item %d = %+v", count, item)
+			}
+		}
+		if count != n {
+			t.Errorf("got %d items, want %d", count, n)
+		}
+	})
+
+	t.Run("reads incrementally", func(t *testing.T) {
+		cr := &countingReader{r: bytes.NewReader(buf.Bytes())}
+		for item, err := range StreamJSON(cr) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if item.Index == 10 {
+				break
+			}
+		}
+		if cr.n >= total/10 {
+			t.Errorf("read %d of %d bytes for 10 items, want the decoder to stop early", cr.n, total)
+		}
+	})
 }
 
 func TestGenerateFilename(t *testing.T) {
 	tests := []struct {
+		tmpl   image.NameTemplate
 		index  int
 		prompt string
 		format models.OutputFormat
 		want   string
 	}{
-		{1, "sunset mountains", models.FormatPNG, "001-sunset-mountains.png"},
-		{10, "cat playing", models.FormatJPEG, "010-cat-playing.jpeg"},
-		{100, "test", models.FormatWebP, "100-test.webp"},
+		{"", 1, "sunset mountains", models.FormatPNG, "001-sunset-mountains.png"},
+		{"", 10, "cat playing", models.FormatJPEG, "010-cat-playing.jpeg"},
+		{"", 100, "test", models.FormatWebP, "100-test.webp"},
+		{"{model}/{index}", 2, "test", models.FormatPNG, "dall-e-3/002.png"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.want, func(t *testing.T) {
-			got := generateFilename(tt.index, tt.prompt, tt.format)
-			if got != tt.want {
-				t.Errorf("generateFilename() = %q, want %q", got, tt.want)
+			fields := image.NameFields{Index: tt.index, Prompt: tt.prompt, Model: "dall-e-3"}
+			got, err := generateFilename(tt.tmpl, fields, tt.format)
+			if err != nil || got != tt.want {
+				t.Errorf("generateFilename() = %q, %v, want %q", got, err, tt.want)
 			}
 		})
 	}
@@ -200,6 +292,154 @@ func (m *mockProvider) ListModels() []string {
 	return []string{"gpt-image-1", "dall-e-3", "dall-e-2"}
 }
 
+func TestProcessorEstimateCost(t *testing.T) {
+	proc := NewProcessor(&mockProvider{}, image.NewSaver(), models.DefaultRegistry(), io.Discard, io.Discard)
+
+	items := []Item{
+		{Index: 1, Prompt: "uses the batch defaults"},
+		{Index: 2, Prompt: "wide hd", Model: "dall-e-3", Size: "1792x1024", Quality: "hd"},
+		{Index: 3, Prompt: "small", Model: "dall-e-2", Size: "256x256"},
+		{Index: 4, Prompt: "stability", Model: "stable-diffusion-3"},
+	}
+	opts := &Options{DefaultModel: "gpt-image-1", DefaultQuality: "high"}
+
+	got := proc.EstimateCost(items, opts)
+	// 0.167 (gpt-image-1 high) + 0.120 + 0.016 + 0.065
+	if want := 0.368; math.Abs(got.Total-want) > 1e-9 {
+		t.Errorf("EstimateCost() = %v, want %v", got.Total, want)
+	}
+	if len(got.Unpriced) != 0 {
+		t.Errorf("EstimateCost() Unpriced = %v, want none", got.Unpriced)
+	}
+
+	items = append(items, Item{Index: 7, Prompt: "x", Model: "nope"})
+	got = proc.EstimateCost(items, opts)
+	if math.Abs(got.Total-0.368) > 1e-9 || !slices.Equal(got.Unpriced, []int{7}) {
+		t.Errorf("EstimateCost() = %+v, want 0.368 with item 7 unpriced", got)
+	}
+
+	opts.PriceOverrides = cost.Overrides{"dall-e-2": {"*": {"*": 0.5}}}
+	got = proc.EstimateCost(items[:4], opts)
+	if want := 0.852; math.Abs(got.Total-want) > 1e-9 {
+		t.Errorf("EstimateCost() with overrides = %v, want %v", got.Total, want)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	opts := &Options{DefaultModel: "dall-e-3"}
+
+	items := []Item{
+		{Index: 1, Prompt: "a cat"},
+		{Index: 2, Prompt: "a cat", Model: "dall-e-3", Size: "1024x1024", Quality: "standard"},
+		{Index: 3, Prompt: "a cat", Quality: "hd"},
+		{Index: 4, Prompt: "a cat "},
+		{Index: 5, Prompt: "a cat", Model: "dall-e-2"},
+		{Index: 6, Prompt: "a cat", Quality: "hd"},
+	}
+	got, removed := Dedupe(items, opts, models.DefaultRegistry())
+	if removed != 2 {
+		t.Errorf("removed = %d, want 2", removed)
+	}
+	var indexes []int
+	for _, item := range got {
+		indexes = append(indexes, item.Index)
+	}
+	if want := []int{1, 3, 4, 5}; !slices.Equal(indexes, want) {
+		t.Errorf("kept items %v, want %v", indexes, want)
+	}
+}
+
+func TestProcessorProcess_BudgetStopsPartway(t *testing.T) {
+	for _, parallel := range []int{1, 3} {
+		t.Run(fmt.Sprintf("parallel=%d", parallel), func(t *testing.T) {
+			var calls atomic.Int32
+			prov := &mockProvider{
+				generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+					calls.Add(1)
+					return &models.Response{
+						Images: []models.GeneratedImage{{Data: []byte("img")}},
+						Cost:   &models.CostInfo{PerImage: 0.04, Total: 0.04},
+					}, nil
+				},
+			}
+			var out bytes.Buffer
+			proc := NewProcessor(prov, image.NewSaver(), models.DefaultRegistry(), &out, io.Discard)
+
+			items := make([]Item, 6)
+			for i := range items {
+				items[i] = Item{Index: i + 1, Prompt: fmt.Sprintf("prompt %d", i+1)}
+			}
+			outDir := t.TempDir()
+			opts := &Options{
+				OutputDir:    outDir,
+				DefaultModel: "dall-e-3", // estimated at $0.04 per image
+				Format:       models.FormatPNG,
+				Parallel:     parallel,
+				Budget:       cost.NewBudget(0.10),
+			}
+
+			results, err := proc.Process(context.Background(), items, opts)
+			if !errors.Is(err, cost.ErrBudgetExceeded) {
+				t.Fatalf("Process() error = %v, want ErrBudgetExceeded", err)
+			}
+			if got := calls.Load(); got != 2 {
+				t.Errorf("provider called %d times, want 2 within the budget", got)
+			}
+
+			saved := 0
+			for _, r := range results {
+				if r.Error == nil && r.Path != "" {
+					saved++
+					if _, statErr := os.Stat(r.Path); statErr != nil {
+						t.Errorf("image generated before the budget ran out should be kept: %v", statErr)
+					}
+				}
+			}
+			if saved != 2 {
+				t.Errorf("saved %d images, want 2", saved)
+			}
+
+			out.Reset()
+			proc.PrintSummary(results)
+			for _, want := range []string{"Successful: 2/6 images", "Not run: "} {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("summary missing %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRetryFailed_KeepsResolvedSettings(t *testing.T) {
+	var sent []*models.Request
+	prov := &mockProvider{
+		generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			sent = append(sent, req)
+			return nil, errors.New("server error")
+		},
+	}
+	proc := NewProcessor(prov, image.NewSaver(), models.DefaultRegistry(), io.Discard, io.Discard)
+
+	items := []Item{{Index: 1, Prompt: "a lighthouse"}}
+	first := &Options{OutputDir: t.TempDir(), DefaultModel: "dall-e-3", DefaultSize: "1792x1024", DefaultQuality: "hd"}
+	results, _ := proc.Process(context.Background(), items, first)
+
+	// The retry runs with other defaults, as when the flags change between
+	// runs, and must still repeat the request that failed.
+	retry := &Options{OutputDir: first.OutputDir, DefaultModel: "gpt-image-1", DefaultSize: "1024x1024", DefaultQuality: "low"}
+	retryItems := NewResultsFile(first.OutputDir, items, results).FailedItems()
+	proc.Process(context.Background(), retryItems, retry)
+
+	if len(sent) != 2 {
+		t.Fatalf("provider called %d times, want 2", len(sent))
+	}
+	got, want := sent[1], sent[0]
+	if got.Model != want.Model || got.Size != want.Size || got.Quality != want.Quality || got.Style != want.Style {
+		t.Errorf("retry sent %s %s %s %s, want the original %s %s %s %s",
+			got.Model, got.Size, got.Quality, got.Style, want.Model, want.Size, want.Quality, want.Style)
+	}
+}
+
 func TestProcessorProcess(t *testing.T) {
 	out := &bytes.Buffer{}
 	errOut := &bytes.Buffer{}
@@ -243,6 +483,84 @@ func TestProcessorProcess(t *testing.T) {
 	}
 }
 
+func TestProcessorProcessSeq(t *testing.T) {
+	for _, parallel := range []int{1, 3} {
+		t.Run(fmt.Sprintf("parallel=%d", parallel), func(t *testing.T) {
+			// The second item is only written once the first has been
+			// generated, so the run must start before the file is complete.
+			pr, pw := io.Pipe()
+			firstDone := make(chan struct{})
+			var once sync.Once
+			prov := &mockProvider{
+				generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+					once.Do(func() { close(firstDone) })
+					return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+				},
+			}
+			go func() {
+				io.WriteString(pw, `[{"prompt": "first"},`)
+				<-firstDone
+				io.WriteString(pw, `{"prompt": "second"}, {"prompt": "third"}, {"prompt": ""}]`)
+				pw.Close()
+			}()
+
+			proc := NewProcessor(prov, image.NewSaver(), models.DefaultRegistry(), io.Discard, io.Discard)
+			opts := &Options{OutputDir: t.TempDir(), DefaultModel: "gpt-image-1", Format: models.FormatPNG, Parallel: parallel}
+
+			var mu sync.Mutex
+			var prompts []string
+			err := proc.ProcessSeq(context.Background(), StreamJSON(pr), opts, func(r Result) {
+				mu.Lock()
+				defer mu.Unlock()
+				if r.Error != nil {
+					t.Errorf("item %d error = %v", r.Index, r.Error)
+				}
+				prompts = append(prompts, r.Prompt)
+			})
+			if err == nil || !strings.Contains(err.Error(), "item 4 has empty prompt") {
+				t.Errorf("ProcessSeq() error = %v, want the malformed item reported", err)
+			}
+			slices.Sort(prompts)
+			if want := []string{"first", "second", "third"}; !slices.Equal(prompts, want) {
+				t.Errorf("processed %v, want %v", prompts, want)
+			}
+		})
+	}
+}
+
+func TestProcessorProcess_Quiet(t *testing.T) {
+	prov := &mockProvider{
+		generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			if req.Prompt == "fail" {
+				return nil, fmt.Errorf("boom")
+			}
+			return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+		},
+	}
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	proc := NewProcessor(prov, image.NewSaver(), models.DefaultRegistry(), out, errOut)
+	proc.SetQuiet(true)
+
+	items := []Item{
+		{Index: 1, Prompt: "a (red:1.2) fox"},
+		{Index: 2, Prompt: "fail"},
+	}
+	opts := &Options{OutputDir: t.TempDir(), DefaultModel: "gpt-image-1", Format: models.FormatPNG, Parallel: 1, StripWeights: true}
+	results, err := proc.Process(context.Background(), items, opts)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	proc.PrintSummary(results)
+
+	if want := "       Saved: " + results[0].Path + "\n"; out.String() != want {
+		t.Errorf("out = %q, want only %q", out.String(), want)
+	}
+	if want := "       Error: generation failed: boom\n"; errOut.String() != want {
+		t.Errorf("errOut = %q, want only %q", errOut.String(), want)
+	}
+}
+
 func TestProcessorWithConfig(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -424,6 +742,38 @@ func TestParseFile(t *testing.T) {
 	}
 }
 
+func TestParse_DetectsFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantFirst  string
+		wantModel  string
+		wantLength int
+		wantErr    bool
+	}{
+		{"text", "# ideas\na cat\na dog\n", "a cat", "", 2, false},
+		{"json array", "\n  [{\"prompt\": \"a cat\", \"model\": \"dall-e-3\"}]", "a cat", "dall-e-3", 1, false},
+		{"json template", `{"template": "a {{.animal}}", "items": [{"animal": "cat"}, {"animal": "dog"}]}`, "a cat", "", 2, false},
+		{"empty", " \n\t", "", "", 0, true},
+		{"invalid json", "[{\"prompt\": ", "", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := Parse(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(items) != tt.wantLength || items[0].Prompt != tt.wantFirst || items[0].Model != tt.wantModel {
+				t.Errorf("Parse() = %+v, want %d items starting with %q (model %q)", items, tt.wantLength, tt.wantFirst, tt.wantModel)
+			}
+		})
+	}
+}
+
 func TestParseFile_NotFound(t *testing.T) {
 	_, err := ParseFile("/nonexistent/file.txt")
 	if err == nil {
@@ -527,6 +877,73 @@ func TestProcessorWithErrors(t *testing.T) {
 	})
 }
 
+func TestProcessorEventLog(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	proc := NewProcessor(
+		&mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				if req.Prompt == "bad" {
+					return nil, fmt.Errorf("API error")
+				}
+				return &models.Response{
+					Images: []models.GeneratedImage{{Data: []byte("img")}},
+					Cost:   &models.CostInfo{PerImage: 0.04, Total: 0.04},
+				}, nil
+			},
+		},
+		image.NewSaver(),
+		models.DefaultRegistry(),
+		&bytes.Buffer{},
+		&bytes.Buffer{},
+	)
+	proc.SetEventLogger(events.NewLogger(logPath, events.PromptHash))
+
+	items := []Item{
+		{Index: 1, Prompt: "a cat"},
+		{Index: 2, Prompt: "bad"},
+		{Index: 3, Prompt: "a dog", Quality: "high"},
+	}
+	opts := &Options{
+		OutputDir:    t.TempDir(),
+		DefaultModel: "gpt-image-1",
+		Format:       models.FormatPNG,
+		Parallel:     3,
+	}
+	if _, err := proc.Process(context.Background(), items, opts); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	byHash := make(map[string]events.Event)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e events.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid JSONL line %q: %v", scanner.Text(), err)
+		}
+		byHash[e.PromptHash] = e
+	}
+	if len(byHash) != 3 {
+		t.Fatalf("got %d distinct events, want 3", len(byHash))
+	}
+
+	ok := byHash[events.HashPrompt("a cat")]
+	if !ok.Success || ok.Op != events.OpGenerate || ok.Model != "gpt-image-1" || ok.Cost != 0.04 {
+		t.Errorf("success event = %+v", ok)
+	}
+	if failed := byHash[events.HashPrompt("bad")]; failed.Success || failed.Error == "" {
+		t.Errorf("failure event = %+v", failed)
+	}
+	if q := byHash[events.HashPrompt("a dog")].Quality; q != "high" {
+		t.Errorf("quality = %q, want item quality", q)
+	}
+}
+
 func TestProcessorWithDelay(t *testing.T) {
 	out := &bytes.Buffer{}
 	proc := NewProcessor(
@@ -647,6 +1064,37 @@ func TestProcessItemWithCustomOptions(t *testing.T) {
 	}
 }
 
+func TestProcessItem_StripWeights(t *testing.T) {
+	prompts := map[string]string{}
+	prov := &mockProvider{
+		generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			prompts[req.Model] = req.Prompt
+			return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+		},
+	}
+	out := &bytes.Buffer{}
+	proc := NewProcessor(prov, image.NewSaver(), models.DefaultRegistry(), out, out)
+
+	items := []Item{
+		{Index: 1, Prompt: "a (red:1.2) fox", Model: "gpt-image-1"},
+		{Index: 2, Prompt: "a (red:1.2) fox", Model: "stable-diffusion-xl"},
+	}
+	opts := &Options{OutputDir: t.TempDir(), Format: models.FormatPNG, Parallel: 1, StripWeights: true}
+	if _, err := proc.Process(context.Background(), items, opts); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if got := prompts["gpt-image-1"]; got != "a red fox" {
+		t.Errorf("gpt-image-1 prompt = %q, want weights stripped", got)
+	}
+	if got := prompts["stable-diffusion-xl"]; got != "a (red:1.2) fox" {
+		t.Errorf("stable-diffusion-xl prompt = %q, want it passed through", got)
+	}
+	if n := strings.Count(out.String(), "removed prompt weights"); n != 1 {
+		t.Errorf("got %d strip warnings, want 1:\n%s", n, out.String())
+	}
+}
+
 func TestProcessItemWithNoCost(t *testing.T) {
 	out := &bytes.Buffer{}
 	proc := NewProcessor(
@@ -687,3 +1135,132 @@ func TestProcessItemWithNoCost(t *testing.T) {
 }
 
 var _ provider.Provider = (*mockProvider)(nil)
+
+func TestProcessStream_SequentialOrder(t *testing.T) {
+	proc := NewProcessor(&mockProvider{}, image.NewSaver(), models.DefaultRegistry(), io.Discard, io.Discard)
+	items := []Item{
+		{Index: 1, Prompt: "one"},
+		{Index: 2, Prompt: "two"},
+		{Index: 3, Prompt: "three"},
+	}
+	opts := &Options{OutputDir: t.TempDir(), DefaultModel: "gpt-image-1", Format: models.FormatPNG, Parallel: 1}
+
+	stream, err := proc.ProcessStream(context.Background(), items, opts)
+	if err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+
+	var got []int
+	for r := range stream {
+		got = append(got, r.Index)
+	}
+	if !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("sequential results arrived as %v, want item order", got)
+	}
+}
+
+func TestProcessStream_ParallelCompletionOrder(t *testing.T) {
+	// Item 1 is held until item 2 has been received, so it can only arrive
+	// second if results are streamed as they complete.
+	release := make(chan struct{})
+	prov := &mockProvider{
+		generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			if req.Prompt == "slow" {
+				<-release
+			}
+			return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+		},
+	}
+	proc := NewProcessor(prov, image.NewSaver(), models.DefaultRegistry(), io.Discard, io.Discard)
+	items := []Item{
+		{Index: 1, Prompt: "slow"},
+		{Index: 2, Prompt: "fast"},
+	}
+	opts := &Options{OutputDir: t.TempDir(), DefaultModel: "gpt-image-1", Format: models.FormatPNG, Parallel: 2}
+
+	stream, err := proc.ProcessStream(context.Background(), items, opts)
+	if err != nil {
+		t.Fatalf("ProcessStream() error = %v", err)
+	}
+
+	first := <-stream
+	close(release)
+	second := <-stream
+	if first.Index != 2 || second.Index != 1 {
+		t.Errorf("results arrived as %d, %d; want 2, 1", first.Index, second.Index)
+	}
+	if first.Prompt != "fast" || first.Path == "" {
+		t.Errorf("streamed result should carry its item: %+v", first)
+	}
+	if _, ok := <-stream; ok {
+		t.Error("stream should be closed after the last item")
+	}
+}
+
+func TestProcessStream_ClosesOnCancel(t *testing.T) {
+	for _, parallel := range []int{1, 3} {
+		ctx, cancel := context.WithCancel(context.Background())
+		prov := &mockProvider{
+			generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+				if req.Prompt == "cancel" {
+					cancel()
+				}
+				return nil, ctx.Err()
+			},
+		}
+		proc := NewProcessor(prov, image.NewSaver(), models.DefaultRegistry(), io.Discard, io.Discard)
+
+		items := make([]Item, 20)
+		for i := range items {
+			items[i] = Item{Index: i + 1, Prompt: fmt.Sprintf("item %d", i+1)}
+		}
+		items[0].Prompt = "cancel"
+		opts := &Options{OutputDir: t.TempDir(), DefaultModel: "gpt-image-1", Format: models.FormatPNG, Parallel: parallel}
+
+		stream, err := proc.ProcessStream(ctx, items, opts)
+		if err != nil {
+			t.Fatalf("ProcessStream() error = %v", err)
+		}
+
+		done := make(chan []Result)
+		go func() {
+			var got []Result
+			for r := range stream {
+				got = append(got, r)
+			}
+			done <- got
+		}()
+
+		select {
+		case got := <-done:
+			if len(got) >= len(items) {
+				t.Errorf("parallel=%d: got %d results, want the run to stop early", parallel, len(got))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("parallel=%d: stream not closed after cancel", parallel)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	items := []Item{{Index: 5, Prompt: "a"}, {Index: 7, Prompt: "b"}, {Index: 9, Prompt: "c"}}
+	stream := make(chan Result, 2)
+	stream <- Result{Index: 9, Path: "c.png"}
+	stream <- Result{Index: 5, Error: errors.New("boom")}
+	close(stream)
+
+	var seen []int
+	results, err := Collect(context.Background(), items, &Options{StopOnError: true}, stream, func(r Result) {
+		seen = append(seen, r.Index)
+	})
+
+	if !slices.Equal(seen, []int{9, 5}) {
+		t.Errorf("each saw %v, want arrival order", seen)
+	}
+	if results[0].Index != 5 || results[1].Index != 0 || results[2].Path != "c.png" {
+		t.Errorf("results not placed in item order: %+v", results)
+	}
+	if err == nil || !strings.Contains(err.Error(), "stopped at item 5: boom") {
+		t.Errorf("Collect() error = %v, want stop-on-error failure", err)
+	}
+}
@@ -0,0 +1,129 @@
+package batch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// CheckpointFileName is the progress file kept in the output directory while
+// a batch runs, so an interrupted run can be resumed.
+const CheckpointFileName = ".imggen-batch-state.json"
+
+// CheckpointPath returns the checkpoint location for an output directory.
+func CheckpointPath(outputDir string) string {
+	return filepath.Join(outputDir, CheckpointFileName)
+}
+
+// checkpointEntry records one completed item. The prompt is kept so a resume
+// against a different input file does not skip unrelated items.
+type checkpointEntry struct {
+	Index  int    `json:"index"`
+	Prompt string `json:"prompt"`
+	Path   string `json:"path"`
+}
+
+type checkpointFile struct {
+	Completed []checkpointEntry `json:"completed"`
+}
+
+// checkpoint tracks completed items and rewrites the checkpoint file after
+// each one. It is safe for use by parallel workers.
+type checkpoint struct {
+	mu   sync.Mutex
+	path string
+	done map[int]checkpointEntry
+}
+
+func newCheckpoint(path string) *checkpoint {
+	return &checkpoint{path: path, done: make(map[int]checkpointEntry)}
+}
+
+// loadCheckpoint reads the checkpoint at path. A missing file yields an
+// empty checkpoint.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	c := newCheckpoint(path)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var f checkpointFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+	for _, e := range f.Completed {
+		c.done[e.Index] = e
+	}
+	return c, nil
+}
+
+// completed returns the saved path for item if it finished in an earlier run.
+func (c *checkpoint) completed(item Item) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.done[item.Index]
+	if !ok || e.Prompt != item.Prompt {
+		return "", false
+	}
+	return e.Path, true
+}
+
+// markDone records item as completed and saves the checkpoint.
+func (c *checkpoint) markDone(item Item, path string) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.done[item.Index] = checkpointEntry{Index: item.Index, Prompt: item.Prompt, Path: path}
+
+	f := checkpointFile{Completed: make([]checkpointEntry, 0, len(c.done))}
+	for _, e := range c.done {
+		f.Completed = append(f.Completed, e)
+	}
+	sort.Slice(f.Completed, func(i, j int) bool {
+		return f.Completed[i].Index < f.Completed[j].Index
+	})
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	// Write to a temporary file first so an interruption never leaves a
+	// truncated checkpoint behind.
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// remove deletes the checkpoint file.
+func (c *checkpoint) remove() error {
+	if c == nil {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/manash/imggen/internal/image"
+	"github.com/manash/imggen/pkg/models"
+)
+
+func seedCheckpoint(t *testing.T, dir string, entries ...checkpointEntry) {
+	t.Helper()
+	data, err := json.Marshal(checkpointFile{Completed: entries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(CheckpointPath(dir), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readCheckpoint(t *testing.T, dir string) checkpointFile {
+	t.Helper()
+	data, err := os.ReadFile(CheckpointPath(dir))
+	if err != nil {
+		t.Fatalf("reading checkpoint: %v", err)
+	}
+	var f checkpointFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatalf("parsing checkpoint: %v", err)
+	}
+	return f
+}
+
+func countingProvider(calls *atomic.Int32, fail string) *mockProvider {
+	return &mockProvider{generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+		calls.Add(1)
+		if fail != "" && req.Prompt == fail {
+			return nil, errors.New("boom")
+		}
+		return &models.Response{
+			Images: []models.GeneratedImage{{Data: []byte("img"), Index: 0}},
+			Cost:   &models.CostInfo{PerImage: 0.04, Total: 0.04},
+		}, nil
+	}}
+}
+
+func TestProcess_ResumeSkipsCompleted(t *testing.T) {
+	for _, parallel := range []int{1, 3} {
+		dir := t.TempDir()
+		seedCheckpoint(t, dir,
+			checkpointEntry{Index: 1, Prompt: "one", Path: filepath.Join(dir, "001-one.png")},
+			checkpointEntry{Index: 3, Prompt: "three", Path: filepath.Join(dir, "003-three.png")},
+		)
+
+		var calls atomic.Int32
+		out := &bytes.Buffer{}
+		proc := NewProcessor(countingProvider(&calls, ""), image.NewSaver(), models.DefaultRegistry(), out, out)
+
+		items := []Item{
+			{Index: 1, Prompt: "one"},
+			{Index: 2, Prompt: "two"},
+			{Index: 3, Prompt: "three"},
+			{Index: 4, Prompt: "four"},
+		}
+		opts := &Options{
+			OutputDir:    dir,
+			DefaultModel: "gpt-image-1",
+			Format:       models.FormatPNG,
+			Parallel:     parallel,
+			Checkpoint:   true,
+			Resume:       true,
+		}
+
+		results, err := proc.Process(context.Background(), items, opts)
+		if err != nil {
+			t.Fatalf("parallel=%d: Process() error = %v", parallel, err)
+		}
+
+		if got := calls.Load(); got != 2 {
+			t.Errorf("parallel=%d: provider called %d times, want 2", parallel, got)
+		}
+		if !results[0].Skipped || results[0].Path != filepath.Join(dir, "001-one.png") {
+			t.Errorf("parallel=%d: result 1 = %+v, want skipped with checkpoint path", parallel, results[0])
+		}
+		if results[1].Skipped || results[1].Path == "" {
+			t.Errorf("parallel=%d: result 2 = %+v, want generated", parallel, results[1])
+		}
+		if !results[2].Skipped {
+			t.Errorf("parallel=%d: result 3 should be skipped", parallel)
+		}
+
+		if _, err := os.Stat(CheckpointPath(dir)); !os.IsNotExist(err) {
+			t.Errorf("parallel=%d: checkpoint should be removed after clean completion, stat err = %v", parallel, err)
+		}
+	}
+}
+
+func TestProcess_CheckpointKeptOnFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	var calls atomic.Int32
+	out := &bytes.Buffer{}
+	proc := NewProcessor(countingProvider(&calls, "two"), image.NewSaver(), models.DefaultRegistry(), out, out)
+
+	items := []Item{
+		{Index: 1, Prompt: "one"},
+		{Index: 2, Prompt: "two"},
+		{Index: 3, Prompt: "three"},
+	}
+	opts := &Options{
+		OutputDir:    dir,
+		DefaultModel: "gpt-image-1",
+		Format:       models.FormatPNG,
+		Parallel:     1,
+		Checkpoint:   true,
+	}
+
+	if _, err := proc.Process(context.Background(), items, opts); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	f := readCheckpoint(t, dir)
+	if len(f.Completed) != 2 || f.Completed[0].Index != 1 || f.Completed[1].Index != 3 {
+		t.Fatalf("checkpoint = %+v, want items 1 and 3", f.Completed)
+	}
+
+	// Resuming only retries the failed item.
+	calls.Store(0)
+	opts.Resume = true
+	proc = NewProcessor(countingProvider(&calls, ""), image.NewSaver(), models.DefaultRegistry(), out, out)
+	if _, err := proc.Process(context.Background(), items, opts); err != nil {
+		t.Fatalf("resumed Process() error = %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("resumed run called provider %d times, want 1", got)
+	}
+	if _, err := os.Stat(CheckpointPath(dir)); !os.IsNotExist(err) {
+		t.Error("checkpoint should be removed once every item succeeded")
+	}
+}
+
+func TestProcess_ResumeIgnoresChangedPrompts(t *testing.T) {
+	dir := t.TempDir()
+	seedCheckpoint(t, dir, checkpointEntry{Index: 1, Prompt: "old prompt", Path: "old.png"})
+
+	var calls atomic.Int32
+	out := &bytes.Buffer{}
+	proc := NewProcessor(countingProvider(&calls, ""), image.NewSaver(), models.DefaultRegistry(), out, out)
+
+	opts := &Options{
+		OutputDir:    dir,
+		DefaultModel: "gpt-image-1",
+		Format:       models.FormatPNG,
+		Parallel:     1,
+		Resume:       true,
+	}
+
+	results, err := proc.Process(context.Background(), []Item{{Index: 1, Prompt: "new prompt"}}, opts)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if calls.Load() != 1 || results[0].Skipped {
+		t.Error("item whose prompt changed should be regenerated")
+	}
+}
+
+func TestProcess_WithoutResumeStartsFresh(t *testing.T) {
+	dir := t.TempDir()
+	seedCheckpoint(t, dir, checkpointEntry{Index: 1, Prompt: "one", Path: "old.png"})
+
+	var calls atomic.Int32
+	out := &bytes.Buffer{}
+	proc := NewProcessor(countingProvider(&calls, "two"), image.NewSaver(), models.DefaultRegistry(), out, out)
+
+	opts := &Options{
+		OutputDir:    dir,
+		DefaultModel: "gpt-image-1",
+		Format:       models.FormatPNG,
+		Parallel:     1,
+		Checkpoint:   true,
+	}
+	items := []Item{{Index: 1, Prompt: "one"}, {Index: 2, Prompt: "two"}}
+
+	if _, err := proc.Process(context.Background(), items, opts); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("provider called %d times, want 2", calls.Load())
+	}
+	f := readCheckpoint(t, dir)
+	if len(f.Completed) != 1 || f.Completed[0].Path == "old.png" {
+		t.Errorf("checkpoint = %+v, want only this run's completed item", f.Completed)
+	}
+}
+
+func TestProcess_ResumeInvalidCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(CheckpointPath(dir), []byte("{broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	proc := NewProcessor(&mockProvider{}, image.NewSaver(), models.DefaultRegistry(), out, out)
+	opts := &Options{OutputDir: dir, DefaultModel: "gpt-image-1", Format: models.FormatPNG, Resume: true}
+
+	_, err := proc.Process(context.Background(), []Item{{Index: 1, Prompt: "one"}}, opts)
+	if err == nil || !strings.Contains(err.Error(), "failed to parse checkpoint") {
+		t.Errorf("Process() error = %v, want checkpoint parse error", err)
+	}
+}
+
+func TestPrintSummary_Skipped(t *testing.T) {
+	out := &bytes.Buffer{}
+	proc := NewProcessor(&mockProvider{}, image.NewSaver(), models.DefaultRegistry(), out, out)
+
+	proc.PrintSummary([]Result{
+		{Index: 1, Prompt: "one", Path: "a.png", Skipped: true},
+		{Index: 2, Prompt: "two", Path: "b.png", Cost: 0.04},
+	})
+
+	if !strings.Contains(out.String(), "Skipped: 1") {
+		t.Errorf("summary = %q, want skipped count", out.String())
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"iter"
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode"
 )
 
 type Item struct {
@@ -45,6 +47,30 @@ func ParseFile(path string) ([]Item, error) {
 	}
 }
 
+// Parse reads a batch file whose format is not known from its name, such
+// as one piped on stdin. Content starting with '[' or '{' is parsed as JSON
+// and anything else as text.
+func Parse(r io.Reader) ([]Item, error) {
+	br := bufio.NewReader(r)
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no prompts found in file")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		if unicode.IsSpace(c) {
+			continue
+		}
+		br.UnreadRune()
+		if c == '[' || c == '{' {
+			return ParseJSON(br)
+		}
+		return ParseText(br)
+	}
+}
+
 func ParseText(r io.Reader) ([]Item, error) {
 	var items []Item
 	scanner := bufio.NewScanner(r)
@@ -73,35 +99,188 @@ func ParseText(r io.Reader) ([]Item, error) {
 	return items, nil
 }
 
+// ParseJSON reads a JSON batch file into memory: either an array of items
+// or a template object (see StreamJSON). Files too large to hold at once
+// can be run from StreamJSON with Processor.ProcessSeq instead.
 func ParseJSON(r io.Reader) ([]Item, error) {
-	data, err := io.ReadAll(r)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+	var items []Item
+	for item, err := range StreamJSON(r) {
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
 	}
 
-	var jsonItems []jsonItem
-	if err := json.Unmarshal(data, &jsonItems); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no prompts found in file")
 	}
 
-	if len(jsonItems) == 0 {
-		return nil, fmt.Errorf("no prompts found in file")
+	return items, nil
+}
+
+// StreamJSON decodes a batch file one element at a time, so items can be
+// processed while the rest of the file is still being read and memory use
+// does not grow with the file. The file is either a JSON array of items or
+// an object whose "template" is rendered with text/template for each entry
+// of "items":
+//
+//	{"template": "a {{.color}} {{.item}}", "items": [{"color": "red", "item": "mug"}]}
+//
+// Iteration stops after the first error, which is yielded with a zero Item;
+// items before a truncated or malformed element are still yielded. Errors
+// in template entries name the line the entry starts on.
+func StreamJSON(r io.Reader) iter.Seq2[Item, error] {
+	return func(yield func(Item, error) bool) {
+		lines := &lineReader{r: r}
+		dec := json.NewDecoder(lines)
+
+		tok, err := dec.Token()
+		if err != nil {
+			yield(Item{}, fmt.Errorf("failed to parse JSON: %w", err))
+			return
+		}
+		delim, _ := tok.(json.Delim)
+		switch delim {
+		case '[':
+			if !streamItems(dec, yield) {
+				return
+			}
+		case '{':
+			if !streamTemplate(dec, lines, yield) {
+				return
+			}
+		default:
+			yield(Item{}, fmt.Errorf("failed to parse JSON: expected an array of items or a template object"))
+			return
+		}
+
+		if dec.More() {
+			what := "array"
+			if delim == '{' {
+				what = "object"
+			}
+			yield(Item{}, fmt.Errorf("failed to parse JSON: unexpected data after %s", what))
+		}
 	}
+}
+
+// streamItems yields the elements of a plain item array whose opening
+// bracket has been read, consuming the closing bracket. It returns false
+// once iteration should stop.
+func streamItems(dec *json.Decoder, yield func(Item, error) bool) bool {
+	index := 0
+	for dec.More() {
+		var ji jsonItem
+		if err := dec.Decode(&ji); err != nil {
+			yield(Item{}, fmt.Errorf("failed to parse JSON: item %d: %w", index+1, err))
+			return false
+		}
+		index++
 
-	items := make([]Item, len(jsonItems))
-	for i, ji := range jsonItems {
 		if strings.TrimSpace(ji.Prompt) == "" {
-			return nil, fmt.Errorf("item %d has empty prompt", i+1)
+			yield(Item{}, fmt.Errorf("item %d has empty prompt", index))
+			return false
 		}
-		items[i] = Item{
-			Index:   i + 1,
+		item := Item{
+			Index:   index,
 			Prompt:  ji.Prompt,
 			Model:   ji.Model,
 			Size:    ji.Size,
 			Quality: ji.Quality,
 			Style:   ji.Style,
 		}
+		if !yield(item, nil) {
+			return false
+		}
 	}
 
-	return items, nil
+	if _, err := dec.Token(); err != nil {
+		yield(Item{}, fmt.Errorf("failed to parse JSON: %w", err))
+		return false
+	}
+	return true
+}
+
+// streamTemplate yields the rendered entries of a template object whose
+// opening brace has been read, consuming the closing brace. Entries that
+// appear before the template are held until it is known.
+func streamTemplate(dec *json.Decoder, lines *lineReader, yield func(Item, error) bool) bool {
+	fail := func(format string, args ...any) bool {
+		yield(Item{}, fmt.Errorf("failed to parse JSON: "+format, args...))
+		return false
+	}
+
+	type entry struct {
+		line int
+		raw  json.RawMessage
+	}
+	var (
+		tmpl    *promptTemplate
+		pending []entry
+		index   int
+	)
+	emit := func(e entry) bool {
+		index++
+		item, err := tmpl.render(index, e.raw)
+		if err != nil {
+			yield(Item{}, fmt.Errorf("line %d: %w", e.line, err))
+			return false
+		}
+		return yield(item, nil)
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fail("%v", err)
+		}
+		switch key, _ := tok.(string); key {
+		case "template":
+			var text string
+			if err := dec.Decode(&text); err != nil {
+				return fail("template must be a string")
+			}
+			if tmpl, err = parseTemplate(text); err != nil {
+				yield(Item{}, err)
+				return false
+			}
+			for _, e := range pending {
+				if !emit(e) {
+					return false
+				}
+			}
+			pending = nil
+
+		case "items":
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+				return fail("items must be an array")
+			}
+			for dec.More() {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return fail("item %d: %v", index+len(pending)+1, err)
+				}
+				e := entry{line: lines.lineAt(dec.InputOffset() - int64(len(raw))), raw: raw}
+				if tmpl == nil {
+					pending = append(pending, e)
+				} else if !emit(e) {
+					return false
+				}
+			}
+			if _, err := dec.Token(); err != nil {
+				return fail("%v", err)
+			}
+
+		default:
+			return fail("unexpected field %q in template object (expected template and items)", key)
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return fail("%v", err)
+	}
+	if tmpl == nil {
+		return fail("template object has no template")
+	}
+	return true
 }
@@ -0,0 +1,112 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/manash/imggen/internal/image"
+	"github.com/manash/imggen/pkg/models"
+)
+
+func TestNewRateLimiter_Disabled(t *testing.T) {
+	for _, rpm := range []int{0, -1} {
+		if l := newRateLimiter(rpm); l != nil {
+			t.Errorf("newRateLimiter(%d) = %v, want nil", rpm, l)
+		}
+	}
+
+	var l *rateLimiter
+	if err := l.Wait(context.Background()); err != nil {
+		t.Errorf("nil limiter Wait() error = %v", err)
+	}
+}
+
+func TestProcess_RequestsPerMinute(t *testing.T) {
+	// 600 requests per minute is one every 100ms, so the first request
+	// starts immediately and each of the remaining ones waits its turn.
+	const (
+		rpm      = 600
+		requests = 4
+	)
+	minElapsed := time.Duration(requests-1) * (time.Minute / rpm)
+
+	for _, parallel := range []int{1, 8} {
+		out := &bytes.Buffer{}
+		proc := NewProcessor(&mockProvider{}, image.NewSaver(), models.DefaultRegistry(), out, out)
+
+		items := make([]Item, requests)
+		for i := range items {
+			items[i] = Item{Index: i + 1, Prompt: "prompt"}
+		}
+		opts := &Options{
+			OutputDir:         t.TempDir(),
+			DefaultModel:      "gpt-image-1",
+			Format:            models.FormatPNG,
+			Parallel:          parallel,
+			RequestsPerMinute: rpm,
+		}
+
+		start := time.Now()
+		results, err := proc.Process(context.Background(), items, opts)
+		elapsed := time.Since(start)
+
+		if err != nil {
+			t.Fatalf("parallel=%d: Process() error = %v", parallel, err)
+		}
+		for i, r := range results {
+			if r.Error != nil {
+				t.Errorf("parallel=%d: result %d error = %v", parallel, i, r.Error)
+			}
+		}
+		if elapsed < minElapsed {
+			t.Errorf("parallel=%d: %d requests took %v, want at least %v", parallel, requests, elapsed, minElapsed)
+		}
+	}
+}
+
+func TestProcess_RequestsPerMinuteCancel(t *testing.T) {
+	// More workers than the per-minute budget must not deadlock; waiting
+	// workers give up as soon as the context is cancelled.
+	out := &bytes.Buffer{}
+	proc := NewProcessor(&mockProvider{}, image.NewSaver(), models.DefaultRegistry(), out, out)
+
+	items := make([]Item, 5)
+	for i := range items {
+		items[i] = Item{Index: i + 1, Prompt: "prompt"}
+	}
+	opts := &Options{
+		OutputDir:         t.TempDir(),
+		DefaultModel:      "gpt-image-1",
+		Format:            models.FormatPNG,
+		Parallel:          5,
+		RequestsPerMinute: 1,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	results, _ := proc.Process(ctx, items, opts)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Process() took %v after cancellation", elapsed)
+	}
+
+	var succeeded, cancelled int
+	for _, r := range results {
+		switch {
+		case r.Error == nil:
+			succeeded++
+		case errors.Is(r.Error, context.DeadlineExceeded):
+			cancelled++
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("succeeded = %d, want only the first request within the budget", succeeded)
+	}
+	if cancelled != len(items)-1 {
+		t.Errorf("cancelled = %d, want %d", cancelled, len(items)-1)
+	}
+}
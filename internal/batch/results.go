@@ -0,0 +1,157 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ResultsFileName is the sidecar written next to the images of a batch run.
+const ResultsFileName = "batch-results.json"
+
+// ResultsFile records the outcome of every item in a batch run so that
+// failed items can be retried later.
+type ResultsFile struct {
+	OutputDir string        `json:"output_dir"`
+	Items     []ResultEntry `json:"items"`
+}
+
+// ResultEntry is one item of a ResultsFile. The item fields are kept so a
+// retry can rebuild the original request; for items that were sent they
+// hold the resolved settings, so a retry under different batch defaults
+// repeats the same request.
+type ResultEntry struct {
+	Index   int     `json:"index"`
+	Prompt  string  `json:"prompt"`
+	Model   string  `json:"model,omitempty"`
+	Size    string  `json:"size,omitempty"`
+	Quality string  `json:"quality,omitempty"`
+	Style   string  `json:"style,omitempty"`
+	Success bool    `json:"success"`
+	Path    string  `json:"path,omitempty"`
+	Cost    float64 `json:"cost,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// NewResultsFile pairs items with the results Process returned for them.
+// Items that were never attempted, for example after --stop-on-error, are
+// recorded as failed so a retry picks them up.
+func NewResultsFile(outputDir string, items []Item, results []Result) *ResultsFile {
+	rf := &ResultsFile{
+		OutputDir: outputDir,
+		Items:     make([]ResultEntry, len(items)),
+	}
+
+	for i, item := range items {
+		entry := ResultEntry{
+			Index:   item.Index,
+			Prompt:  item.Prompt,
+			Model:   item.Model,
+			Size:    item.Size,
+			Quality: item.Quality,
+			Style:   item.Style,
+		}
+
+		var r Result
+		if i < len(results) {
+			r = results[i]
+		}
+		if r.Model != "" {
+			entry.Model, entry.Size, entry.Quality, entry.Style = r.Model, r.Size, r.Quality, r.Style
+		}
+
+		switch {
+		case r.Error != nil:
+			entry.Error = r.Error.Error()
+		case r.Path == "":
+			entry.Error = "not processed"
+		default:
+			entry.Success = true
+			entry.Path = r.Path
+			entry.Cost = r.Cost
+		}
+
+		rf.Items[i] = entry
+	}
+
+	return rf
+}
+
+// ReadResults loads a results file written by WriteResults.
+func ReadResults(path string) (*ResultsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read results file: %w", err)
+	}
+
+	var rf ResultsFile
+	if err := json.Unmarshal(data, &rf); err != nil {
+		return nil, fmt.Errorf("failed to parse results file: %w", err)
+	}
+	return &rf, nil
+}
+
+// WriteResults saves rf as indented JSON.
+func WriteResults(path string, rf *ResultsFile) error {
+	data, err := json.MarshalIndent(rf, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode results: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write results file: %w", err)
+	}
+	return nil
+}
+
+// FailedItems rebuilds the batch items for every failed entry, keeping
+// their original indexes so output filenames line up with the first run.
+func (rf *ResultsFile) FailedItems() []Item {
+	var items []Item
+	for _, e := range rf.Items {
+		if e.Success {
+			continue
+		}
+		items = append(items, Item{
+			Index:   e.Index,
+			Prompt:  e.Prompt,
+			Model:   e.Model,
+			Size:    e.Size,
+			Quality: e.Quality,
+			Style:   e.Style,
+		})
+	}
+	return items
+}
+
+// Merge returns a new ResultsFile where entries from retry replace entries
+// in rf with the same index. Entries are ordered by index.
+func (rf *ResultsFile) Merge(retry *ResultsFile) *ResultsFile {
+	byIndex := make(map[int]ResultEntry, len(rf.Items))
+	for _, e := range rf.Items {
+		byIndex[e.Index] = e
+	}
+	for _, e := range retry.Items {
+		byIndex[e.Index] = e
+	}
+
+	merged := &ResultsFile{
+		OutputDir: rf.OutputDir,
+		Items:     make([]ResultEntry, 0, len(byIndex)),
+	}
+	for _, e := range byIndex {
+		merged.Items = append(merged.Items, e)
+	}
+	sort.Slice(merged.Items, func(i, j int) bool {
+		return merged.Items[i].Index < merged.Items[j].Index
+	})
+	return merged
+}
+
+// RetryResultsPath returns a fresh results path in dir for a retry run, so
+// the results being retried are never overwritten.
+func RetryResultsPath(dir string, now time.Time) string {
+	return filepath.Join(dir, fmt.Sprintf("batch-results-retry-%s.json", now.Format("20060102-150405")))
+}
@@ -0,0 +1,174 @@
+package batch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewResultsFile(t *testing.T) {
+	items := []Item{
+		{Index: 1, Prompt: "a cat", Model: "dall-e-3", Size: "1024x1024"},
+		{Index: 2, Prompt: "a dog"},
+		{Index: 3, Prompt: "a bird"},
+	}
+	results := []Result{
+		{Index: 1, Prompt: "a cat", Path: "out/001-a-cat.png", Cost: 0.04},
+		{Index: 2, Prompt: "a dog", Error: errors.New("generation failed: boom")},
+		{}, // never attempted
+	}
+
+	rf := NewResultsFile("out", items, results)
+
+	if rf.OutputDir != "out" {
+		t.Errorf("OutputDir = %q, want %q", rf.OutputDir, "out")
+	}
+	if len(rf.Items) != 3 {
+		t.Fatalf("got %d entries, want 3", len(rf.Items))
+	}
+
+	first := rf.Items[0]
+	if !first.Success || first.Path != "out/001-a-cat.png" || first.Cost != 0.04 {
+		t.Errorf("entry 1 = %+v, want success with path and cost", first)
+	}
+	if first.Model != "dall-e-3" || first.Size != "1024x1024" {
+		t.Errorf("entry 1 lost item fields: %+v", first)
+	}
+
+	if rf.Items[1].Success || rf.Items[1].Error != "generation failed: boom" {
+		t.Errorf("entry 2 = %+v, want failure with error", rf.Items[1])
+	}
+	if rf.Items[2].Success || rf.Items[2].Error != "not processed" {
+		t.Errorf("entry 3 = %+v, want unprocessed failure", rf.Items[2])
+	}
+}
+
+func TestResultsFile_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ResultsFileName)
+	want := &ResultsFile{
+		OutputDir: "out",
+		Items: []ResultEntry{
+			{Index: 1, Prompt: "a cat", Success: true, Path: "out/001-a-cat.png"},
+			{Index: 2, Prompt: "a dog", Quality: "hd", Error: "boom"},
+		},
+	}
+
+	if err := WriteResults(path, want); err != nil {
+		t.Fatalf("WriteResults() error = %v", err)
+	}
+
+	got, err := ReadResults(path)
+	if err != nil {
+		t.Fatalf("ReadResults() error = %v", err)
+	}
+	if got.OutputDir != want.OutputDir || len(got.Items) != len(want.Items) {
+		t.Fatalf("ReadResults() = %+v, want %+v", got, want)
+	}
+	for i := range want.Items {
+		if got.Items[i] != want.Items[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got.Items[i], want.Items[i])
+		}
+	}
+}
+
+func TestReadResults_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := ReadResults(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected error for missing file")
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadResults(bad)
+	if err == nil || !strings.Contains(err.Error(), "failed to parse results file") {
+		t.Errorf("ReadResults() error = %v, want parse error", err)
+	}
+}
+
+func TestResultsFile_FailedItems(t *testing.T) {
+	rf := &ResultsFile{
+		Items: []ResultEntry{
+			{Index: 1, Prompt: "a cat", Success: true},
+			{Index: 2, Prompt: "a dog", Model: "dall-e-3", Quality: "hd", Style: "vivid", Error: "boom"},
+			{Index: 5, Prompt: "a bird", Size: "512x512", Error: "not processed"},
+		},
+	}
+
+	items := rf.FailedItems()
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+
+	want := []Item{
+		{Index: 2, Prompt: "a dog", Model: "dall-e-3", Quality: "hd", Style: "vivid"},
+		{Index: 5, Prompt: "a bird", Size: "512x512"},
+	}
+	for i := range want {
+		if items[i] != want[i] {
+			t.Errorf("item %d = %+v, want %+v", i, items[i], want[i])
+		}
+	}
+}
+
+func TestResultsFile_Merge(t *testing.T) {
+	prev := &ResultsFile{
+		OutputDir: "out",
+		Items: []ResultEntry{
+			{Index: 1, Prompt: "a cat", Success: true, Path: "out/001-a-cat.png"},
+			{Index: 2, Prompt: "a dog", Error: "boom"},
+			{Index: 3, Prompt: "a bird", Error: "boom"},
+		},
+	}
+	retry := &ResultsFile{
+		OutputDir: "out",
+		Items: []ResultEntry{
+			{Index: 3, Prompt: "a bird", Success: true, Path: "out/003-a-bird.png"},
+			{Index: 2, Prompt: "a dog", Error: "still failing"},
+		},
+	}
+
+	merged := prev.Merge(retry)
+
+	if len(merged.Items) != 3 {
+		t.Fatalf("got %d entries, want 3", len(merged.Items))
+	}
+	for i, e := range merged.Items {
+		if e.Index != i+1 {
+			t.Errorf("entry %d has index %d, want entries ordered by index", i, e.Index)
+		}
+	}
+	if !merged.Items[0].Success {
+		t.Error("entry 1 should keep its earlier success")
+	}
+	if merged.Items[1].Error != "still failing" {
+		t.Errorf("entry 2 error = %q, want retry error", merged.Items[1].Error)
+	}
+	if !merged.Items[2].Success || merged.Items[2].Path != "out/003-a-bird.png" {
+		t.Errorf("entry 3 = %+v, want retry success", merged.Items[2])
+	}
+
+	if len(merged.FailedItems()) != 1 {
+		t.Errorf("merged file should have 1 failed item, got %d", len(merged.FailedItems()))
+	}
+	if prev.Items[2].Success {
+		t.Error("Merge should not modify the receiver")
+	}
+}
+
+func TestRetryResultsPath(t *testing.T) {
+	now := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	got := RetryResultsPath("out", now)
+	want := filepath.Join("out", "batch-results-retry-20250304-050607.json")
+	if got != want {
+		t.Errorf("RetryResultsPath() = %q, want %q", got, want)
+	}
+	if got == filepath.Join("out", ResultsFileName) {
+		t.Error("retry path must differ from the original results file")
+	}
+}
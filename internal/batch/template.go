@@ -0,0 +1,142 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// promptTemplate renders the prompt of each entry in a template batch file:
+//
+//	{"template": "studio photo of a {{.item}}", "items": [{"item": "mug"}]}
+//
+// Entries are objects of variables. The model, size, quality, and style
+// keys also set those options for the item, as in a plain batch file.
+type promptTemplate struct {
+	tmpl   *template.Template
+	fields []string
+}
+
+func parseTemplate(text string) (*promptTemplate, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("template is empty")
+	}
+	tmpl, err := template.New("template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	var fields []string
+	collectFields(tmpl.Tree.Root, &fields)
+	return &promptTemplate{tmpl: tmpl, fields: fields}, nil
+}
+
+// collectFields records the top-level variables ({{.name}}) a template
+// uses. Bodies of range and with blocks are skipped because dot no longer
+// refers to the entry there; Execute still catches anything missing.
+func collectFields(node parse.Node, fields *[]string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, fields)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				collectFields(arg, fields)
+			}
+		}
+	case *parse.FieldNode:
+		if !slices.Contains(*fields, n.Ident[0]) {
+			*fields = append(*fields, n.Ident[0])
+		}
+	case *parse.IfNode:
+		collectFields(n.Pipe, fields)
+		collectFields(n.List, fields)
+		collectFields(n.ElseList, fields)
+	case *parse.RangeNode:
+		collectFields(n.Pipe, fields)
+	case *parse.WithNode:
+		collectFields(n.Pipe, fields)
+	}
+}
+
+// render builds the item for one entry. raw must be a JSON object.
+func (t *promptTemplate) render(index int, raw json.RawMessage) (Item, error) {
+	var vars map[string]any
+	if err := json.Unmarshal(raw, &vars); err != nil || vars == nil {
+		return Item{}, fmt.Errorf("item %d: expected an object of template variables", index)
+	}
+
+	for _, field := range t.fields {
+		if _, ok := vars[field]; !ok {
+			return Item{}, fmt.Errorf("item %d: missing variable %q used by the template", index, field)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, vars); err != nil {
+		return Item{}, fmt.Errorf("item %d: %w", index, err)
+	}
+	prompt := buf.String()
+	if strings.TrimSpace(prompt) == "" {
+		return Item{}, fmt.Errorf("item %d has empty prompt", index)
+	}
+
+	option := func(key string) string {
+		s, _ := vars[key].(string)
+		return s
+	}
+	return Item{
+		Index:   index,
+		Prompt:  prompt,
+		Model:   option("model"),
+		Size:    option("size"),
+		Quality: option("quality"),
+		Style:   option("style"),
+	}, nil
+}
+
+// lineReader counts the lines read through it so decode errors can name the
+// line an entry starts on. Only newlines past the last lookup are kept, so
+// memory stays bounded by the decoder's read-ahead.
+type lineReader struct {
+	r        io.Reader
+	read     int64
+	line     int
+	newlines []int64
+}
+
+func (l *lineReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			l.newlines = append(l.newlines, l.read+int64(i))
+		}
+	}
+	l.read += int64(n)
+	return n, err
+}
+
+// lineAt returns the 1-based line of offset. Offsets must not decrease
+// between calls.
+func (l *lineReader) lineAt(offset int64) int {
+	for len(l.newlines) > 0 && l.newlines[0] < offset {
+		l.newlines = l.newlines[1:]
+		l.line++
+	}
+	return l.line + 1
+}
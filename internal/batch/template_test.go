@@ -0,0 +1,130 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseJSON_Template(t *testing.T) {
+	input := `{
+  "template": "studio photo of a {{.color}} {{.item}}, white background",
+  "items": [
+    {"color": "red", "item": "sneaker"},
+    {"color": "blue", "item": "mug", "size": "1024x1536", "model": "dall-e-3"}
+  ]
+}`
+
+	items, err := ParseJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseJSON() error = %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+
+	if items[0].Prompt != "studio photo of a red sneaker, white background" || items[0].Index != 1 {
+		t.Errorf("item 1 = %+v", items[0])
+	}
+	want := Item{Index: 2, Prompt: "studio photo of a blue mug, white background", Model: "dall-e-3", Size: "1024x1536"}
+	if items[1] != want {
+		t.Errorf("item 2 = %+v, want %+v", items[1], want)
+	}
+}
+
+func TestParseJSON_TemplateAfterItems(t *testing.T) {
+	input := `{"items": [{"n": 1}, {"n": 2}], "template": "{{if eq .n 1.0}}one{{else}}two{{end}} cat"}`
+
+	items, err := ParseJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseJSON() error = %v", err)
+	}
+	if len(items) != 2 || items[0].Prompt != "one cat" || items[1].Prompt != "two cat" {
+		t.Errorf("items = %+v", items)
+	}
+}
+
+func TestParseJSON_TemplateErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "missing variable",
+			input: "{\"template\": \"a {{.color}} {{.item}}\",\n \"items\": [\n  {\"color\": \"red\", \"item\": \"hat\"},\n  {\"color\": \"green\"}\n]}",
+			want:  `line 4: item 2: missing variable "item"`,
+		},
+		{
+			name:  "missing variable inside if",
+			input: `{"template": "{{if .big}}large {{end}}{{.item}}", "items": [{"item": "hat"}]}`,
+			want:  `item 1: missing variable "big"`,
+		},
+		{
+			name:  "invalid template",
+			input: `{"template": "a {{.item", "items": [{"item": "hat"}]}`,
+			want:  "invalid template",
+		},
+		{
+			name:  "empty template",
+			input: `{"template": "  ", "items": [{"item": "hat"}]}`,
+			want:  "template is empty",
+		},
+		{
+			name:  "no template",
+			input: `{"items": [{"item": "hat"}]}`,
+			want:  "has no template",
+		},
+		{
+			name:  "entry not an object",
+			input: `{"template": "a {{.item}}", "items": ["hat"]}`,
+			want:  "item 1: expected an object",
+		},
+		{
+			name:  "unknown field",
+			input: `{"template": "a {{.item}}", "prompts": []}`,
+			want:  `unexpected field "prompts"`,
+		},
+		{
+			name:  "items not an array",
+			input: `{"template": "a {{.item}}", "items": {"item": "hat"}}`,
+			want:  "items must be an array",
+		},
+		{
+			name:  "renders empty",
+			input: `{"template": "{{.item}}", "items": [{"item": ""}]}`,
+			want:  "item 1 has empty prompt",
+		},
+		{
+			name:  "no items",
+			input: `{"template": "a {{.item}}", "items": []}`,
+			want:  "no prompts found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJSON(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseJSON() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFile_Template(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	content := `{"template": "product shot of {{.item}}", "items": [{"item": "a lamp"}, {"item": "a chair"}]}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := ParseFile(path)
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	if len(items) != 2 || items[1].Prompt != "product shot of a chair" {
+		t.Errorf("items = %+v", items)
+	}
+}
@@ -0,0 +1,282 @@
+// Package cache keeps generated images on disk keyed by the request that
+// produced them, so repeating an identical request costs nothing.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// DefaultMaxBytes is the cache size above which the least recently used
+// entries are evicted.
+const DefaultMaxBytes = 500 << 20
+
+// entryExt is the extension of cache entry files; anything else in the
+// cache directory is left alone.
+const entryExt = ".json"
+
+// Cache stores one JSON file per request key in a directory. A zero or
+// negative size limit disables eviction.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu sync.Mutex
+}
+
+// New returns a cache rooted at dir that evicts entries once the total
+// size exceeds maxBytes. The directory is created on the first Put.
+func New(dir string, maxBytes int64) *Cache {
+	return &Cache{dir: dir, maxBytes: maxBytes}
+}
+
+// DefaultDir returns the default cache directory, ~/.imggen/cache.
+func DefaultDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".imggen", "cache"), nil
+}
+
+// Dir returns the directory the cache is stored in.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// keyFields is the normalized form of a request that is hashed into a key.
+// NoRevise, count, and format are included because they change the images
+// returned.
+type keyFields struct {
+	Model       string `json:"model"`
+	Prompt      string `json:"prompt"`
+	Size        string `json:"size"`
+	Quality     string `json:"quality"`
+	Style       string `json:"style"`
+	Transparent bool   `json:"transparent"`
+	Seed        int64  `json:"seed"`
+	NoRevise    bool   `json:"no_revise"`
+	Count       int    `json:"count"`
+	Format      string `json:"format"`
+}
+
+// Key returns the cache key of req. Requests that differ only in letter
+// case of the settings or in whitespace within the prompt share a key.
+func Key(req *models.Request) string {
+	fields := keyFields{
+		Model:       strings.ToLower(strings.TrimSpace(req.Model)),
+		Prompt:      strings.Join(strings.Fields(req.Prompt), " "),
+		Size:        strings.ToLower(strings.TrimSpace(req.Size)),
+		Quality:     strings.ToLower(strings.TrimSpace(req.Quality)),
+		Style:       strings.ToLower(strings.TrimSpace(req.Style)),
+		Transparent: req.Transparent,
+		Seed:        req.Seed,
+		NoRevise:    req.NoRevise,
+		Count:       max(req.Count, 1),
+		Format:      strings.ToLower(string(req.Format)),
+	}
+	data, _ := json.Marshal(fields)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// entry is the on-disk form of a cached response.
+type entry struct {
+	Model         string    `json:"model"`
+	RevisedPrompt string    `json:"revised_prompt,omitempty"`
+	Images        [][]byte  `json:"images"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+entryExt)
+}
+
+// Get returns the cached response for key. Cached responses carry image
+// data only; their Cost is left nil for the caller to fill in. A hit marks
+// the entry as recently used.
+func (c *Cache) Get(key string) (*models.Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil || len(e.Images) == 0 {
+		return nil, false
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	resp := &models.Response{RevisedPrompt: e.RevisedPrompt}
+	for i, img := range e.Images {
+		resp.Images = append(resp.Images, models.GeneratedImage{Data: img, Index: i})
+	}
+	return resp, true
+}
+
+// Put stores resp under key and then evicts old entries if the cache has
+// grown past its limit. Every image must already have its data loaded.
+func (c *Cache) Put(key, model string, resp *models.Response) error {
+	e := entry{Model: model, RevisedPrompt: resp.RevisedPrompt, CreatedAt: time.Now().UTC()}
+	for i, img := range resp.Images {
+		if len(img.Data) == 0 {
+			return fmt.Errorf("image %d has no data to cache", i+1)
+		}
+		e.Images = append(e.Images, img.Data)
+	}
+	if len(e.Images) == 0 {
+		return errors.New("response has no images to cache")
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// Write to a temporary file first so a concurrent Get never sees a
+	// partial entry.
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	return c.evict()
+}
+
+type fileInfo struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// entries lists the cache entry files. A missing directory is an empty
+// cache.
+func (c *Cache) entries() ([]fileInfo, error) {
+	dirEntries, err := os.ReadDir(c.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []fileInfo
+	for _, de := range dirEntries {
+		if de.IsDir() || filepath.Ext(de.Name()) != entryExt {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, fileInfo{
+			path:    filepath.Join(c.dir, de.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+	return files, nil
+}
+
+// evict removes the least recently used entries until the cache fits in
+// maxBytes. The caller must hold c.mu.
+func (c *Cache) evict() error {
+	if c.maxBytes <= 0 {
+		return nil
+	}
+
+	files, err := c.entries()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	if total <= c.maxBytes {
+		return nil
+	}
+
+	slices.SortFunc(files, func(a, b fileInfo) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	for _, f := range files {
+		if total <= c.maxBytes {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to evict cache entry: %w", err)
+		}
+		total -= f.size
+	}
+	return nil
+}
+
+// Stats returns the number of entries and their total size in bytes.
+func (c *Cache) Stats() (count int, size int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files, err := c.entries()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, f := range files {
+		size += f.size
+	}
+	return len(files), size, nil
+}
+
+// Clear removes every entry and reports how many were removed and how many
+// bytes they used.
+func (c *Cache) Clear() (count int, size int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files, err := c.entries()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, f := range files {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return count, size, fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+		count++
+		size += f.size
+	}
+	return count, size, nil
+}
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/manash/imggen/internal/provider"
+	"github.com/manash/imggen/internal/provider/openai"
+	"github.com/manash/imggen/pkg/models"
+)
+
+func TestKey_Normalizes(t *testing.T) {
+	base := &models.Request{Prompt: "a red fox", Model: "gpt-image-1", Size: "1024x1024", Quality: "high", Count: 1, Format: models.FormatPNG}
+
+	same := *base
+	same.Prompt = "  a  red\tfox "
+	same.Model = "GPT-Image-1"
+	same.Quality = "HIGH"
+	if Key(base) != Key(&same) {
+		t.Error("whitespace and case differences should share a key")
+	}
+
+	zeroCount := *base
+	zeroCount.Count = 0
+	if Key(base) != Key(&zeroCount) {
+		t.Error("count 0 should be treated as 1")
+	}
+
+	for name, change := range map[string]func(r *models.Request){
+		"prompt":      func(r *models.Request) { r.Prompt = "a blue fox" },
+		"model":       func(r *models.Request) { r.Model = "dall-e-3" },
+		"size":        func(r *models.Request) { r.Size = "1536x1024" },
+		"quality":     func(r *models.Request) { r.Quality = "low" },
+		"style":       func(r *models.Request) { r.Style = "vivid" },
+		"transparent": func(r *models.Request) { r.Transparent = true },
+		"seed":        func(r *models.Request) { r.Seed = 42 },
+		"count":       func(r *models.Request) { r.Count = 2 },
+		"format":      func(r *models.Request) { r.Format = models.FormatJPEG },
+	} {
+		other := *base
+		change(&other)
+		if Key(base) == Key(&other) {
+			t.Errorf("changing %s should change the key", name)
+		}
+	}
+}
+
+func TestCache_PutGet(t *testing.T) {
+	c := New(t.TempDir(), 0)
+	resp := &models.Response{
+		Images:        []models.GeneratedImage{{Data: []byte("one")}, {Data: []byte("two")}},
+		RevisedPrompt: "a revised fox",
+	}
+
+	if _, ok := c.Get("missing"); ok {
+		t.Fatal("Get() on an empty cache should miss")
+	}
+	if err := c.Put("k", "gpt-image-1", resp); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	got, ok := c.Get("k")
+	if !ok {
+		t.Fatal("Get() should hit after Put()")
+	}
+	if len(got.Images) != 2 || string(got.Images[1].Data) != "two" || got.Images[1].Index != 1 {
+		t.Errorf("Get() images = %+v", got.Images)
+	}
+	if got.RevisedPrompt != "a revised fox" {
+		t.Errorf("Get() RevisedPrompt = %q", got.RevisedPrompt)
+	}
+}
+
+func TestCache_PutRequiresData(t *testing.T) {
+	c := New(t.TempDir(), 0)
+	resp := &models.Response{Images: []models.GeneratedImage{{URL: "https://example.com/a.png"}}}
+	if err := c.Put("k", "dall-e-3", resp); err == nil {
+		t.Error("Put() should refuse images without data")
+	}
+}
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	payload := bytes.Repeat([]byte("x"), 1000)
+	resp := &models.Response{Images: []models.GeneratedImage{{Data: payload}}}
+
+	// Each entry is a bit over 1KB, so the limit holds two of them.
+	c := New(dir, 3000)
+	old := time.Now().Add(-time.Hour)
+	for i, key := range []string{"a", "b"} {
+		if err := c.Put(key, "m", resp); err != nil {
+			t.Fatal(err)
+		}
+		stamp := old.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(filepath.Join(dir, key+".json"), stamp, stamp)
+	}
+
+	// Reading "a" makes "b" the least recently used.
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("Get(a) should hit")
+	}
+	if err := c.Put("c", "m", resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s should still be cached", key)
+		}
+	}
+}
+
+func TestCache_StatsAndClear(t *testing.T) {
+	dir := t.TempDir()
+	c := New(dir, 0)
+
+	if n, size, err := c.Stats(); err != nil || n != 0 || size != 0 {
+		t.Fatalf("Stats() on empty cache = %d, %d, %v", n, size, err)
+	}
+
+	resp := &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}
+	c.Put("a", "m", resp)
+	c.Put("b", "m", resp)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("keep me"), 0600)
+
+	n, size, err := c.Stats()
+	if err != nil || n != 2 || size == 0 {
+		t.Fatalf("Stats() = %d, %d, %v; want 2 entries", n, size, err)
+	}
+
+	removed, freed, err := c.Clear()
+	if err != nil || removed != 2 || freed != size {
+		t.Errorf("Clear() = %d, %d, %v; want 2, %d", removed, freed, err, size)
+	}
+	if n, _, _ := c.Stats(); n != 0 {
+		t.Errorf("Stats() after Clear() = %d entries", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Error("Clear() should only remove cache entries")
+	}
+}
+
+func TestProvider_SecondGenerateMakesNoRequest(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"created": time.Now().Unix(),
+			"data": []map[string]string{
+				{"b64_json": base64.StdEncoding.EncodeToString([]byte("fake image data"))},
+			},
+		})
+	}))
+	defer server.Close()
+
+	inner, err := openai.New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.NewModelRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prov := NewProvider(inner, New(t.TempDir(), DefaultMaxBytes), nil)
+
+	req := &models.Request{Prompt: "a lighthouse", Model: "gpt-image-1", Size: "1024x1024", Quality: "low", Count: 1, Format: models.FormatPNG}
+	first, err := prov.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("first Generate() error = %v", err)
+	}
+	if first.Cost == nil || first.Cost.Source == models.CostSourceCache {
+		t.Errorf("first Generate() should be priced normally, got %+v", first.Cost)
+	}
+
+	again := *req
+	again.Prompt = "a  lighthouse"
+	second, err := prov.Generate(context.Background(), &again)
+	if err != nil {
+		t.Fatalf("second Generate() error = %v", err)
+	}
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("API requests = %d, want 1", n)
+	}
+	if string(second.Images[0].Data) != "fake image data" {
+		t.Errorf("cached image = %q", second.Images[0].Data)
+	}
+	if second.Cost == nil || second.Cost.Total != 0 || second.Cost.Source != models.CostSourceCache {
+		t.Errorf("cached Cost = %+v, want $0 from cache", second.Cost)
+	}
+}
+
+func TestProvider_ErrorsAreNotCached(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"bad prompt"}}`))
+	}))
+	defer server.Close()
+
+	inner, err := openai.New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.NewModelRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warn strings.Builder
+	prov := NewProvider(inner, New(t.TempDir(), 0), &warn)
+
+	req := &models.Request{Prompt: "x", Model: "gpt-image-1", Count: 1}
+	for range 2 {
+		if _, err := prov.Generate(context.Background(), req); err == nil {
+			t.Fatal("Generate() should fail")
+		}
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("API requests = %d, want 2", n)
+	}
+	if warn.Len() != 0 {
+		t.Errorf("unexpected warning: %s", warn.String())
+	}
+}
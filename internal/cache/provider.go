@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/manash/imggen/internal/cost"
+	"github.com/manash/imggen/internal/image"
+	"github.com/manash/imggen/internal/provider"
+	"github.com/manash/imggen/pkg/models"
+)
+
+// Provider wraps another provider so that Generate serves repeated requests
+// from the cache. Edits and other operations pass straight through.
+type Provider struct {
+	provider.Provider
+	cache *Cache
+	saver *image.Saver
+	warn  io.Writer
+}
+
+// NewProvider returns p with generations cached in c. Failures to write the
+// cache never fail a generation; they are reported to warn instead.
+func NewProvider(p provider.Provider, c *Cache, warn io.Writer) *Provider {
+	if warn == nil {
+		warn = io.Discard
+	}
+	return &Provider{Provider: p, cache: c, saver: image.NewSaver(), warn: warn}
+}
+
+// Generate returns the cached response for req when there is one, with a
+// zero cost whose Source is models.CostSourceCache. Otherwise it calls the
+// wrapped provider and caches the result, downloading any images the
+// provider returned as URLs so the cache holds the bytes.
+func (p *Provider) Generate(ctx context.Context, req *models.Request) (*models.Response, error) {
+	key := Key(req)
+	if resp, ok := p.cache.Get(key); ok {
+		resp.Cost = &models.CostInfo{Currency: cost.CurrencyUSD, Source: models.CostSourceCache}
+		return resp, nil
+	}
+
+	resp, err := p.Provider.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range resp.Images {
+		img := &resp.Images[i]
+		if len(img.Data) > 0 {
+			continue
+		}
+		data, err := p.saver.Fetch(ctx, img)
+		if err != nil {
+			fmt.Fprintf(p.warn, "Warning: not caching response: %v\n", err)
+			return resp, nil
+		}
+		img.Data = data
+	}
+	if err := p.cache.Put(key, req.Model, resp); err != nil {
+		fmt.Fprintf(p.warn, "Warning: failed to cache response: %v\n", err)
+	}
+	return resp, nil
+}
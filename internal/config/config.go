@@ -0,0 +1,305 @@
+// Package config loads user settings from ~/.imggen/config.yaml.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/manash/imggen/internal/events"
+	"github.com/manash/imggen/pkg/models"
+	"go.yaml.in/yaml/v3"
+)
+
+// ErrUnknownKey is returned by Get and Set for keys the config file does
+// not support.
+var ErrUnknownKey = errors.New("unknown config key")
+
+// ErrUnknownProfile is returned by WithProfile for a profile the config
+// file does not define.
+var ErrUnknownProfile = errors.New("unknown config profile")
+
+// Config holds the settings read from the config file. Command-line flags
+// override these values, and these values override built-in defaults.
+type Config struct {
+	Model    string `yaml:"model,omitempty"`
+	Size     string `yaml:"size,omitempty"`
+	Quality  string `yaml:"quality,omitempty"`
+	Format   string `yaml:"format,omitempty"`
+	Output   string `yaml:"output,omitempty"`
+	Parallel int    `yaml:"parallel,omitempty"`
+
+	// BaseURL replaces the provider's API endpoint, e.g. for a proxy.
+	BaseURL string `yaml:"base_url,omitempty"`
+
+	// Proxy sends API requests through an HTTP proxy instead of the one in
+	// HTTPS_PROXY. CACert is a PEM file of extra certificates to trust.
+	Proxy  string `yaml:"proxy,omitempty"`
+	CACert string `yaml:"ca_cert,omitempty"`
+
+	// EventLog is a JSONL file that every generate, edit, and OCR call is
+	// appended to. EventLogPrompts is hash, plain, or omit.
+	EventLog        string `yaml:"event_log,omitempty"`
+	EventLogPrompts string `yaml:"event_log_prompts,omitempty"`
+
+	// ResumeLast makes interactive mode continue the most recently updated
+	// session instead of starting a new one.
+	ResumeLast bool `yaml:"resume_last,omitempty"`
+
+	// ConfirmAbove asks before a generate, edit, or batch run whose
+	// estimated cost in USD is above it. Zero never asks.
+	ConfirmAbove float64 `yaml:"confirm_above,omitempty"`
+
+	// Aliases maps model shorthands to canonical model names. They are
+	// added to the built-in aliases and replace any with the same name.
+	Aliases map[string]string `yaml:"aliases,omitempty"`
+
+	// Profiles are named sets of settings merged over the rest of the file
+	// when selected with --config-profile or IMGGEN_PROFILE.
+	Profiles map[string]*Config `yaml:"profiles,omitempty"`
+}
+
+// Keys returns the settings that Get and Set accept, in display order.
+func Keys() []string {
+	return []string{"model", "size", "quality", "format", "output", "parallel", "base_url", "proxy", "ca_cert", "event_log", "event_log_prompts", "resume_last", "confirm_above"}
+}
+
+// Path returns the location of the config file.
+func Path() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".imggen", "config.yaml"), nil
+}
+
+// Load reads the config file. A missing file yields an empty Config.
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	return LoadFile(path)
+}
+
+// LoadFile reads the config at path. A missing file yields an empty Config.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Save writes cfg to the config file, creating its directory if needed.
+func Save(cfg *Config) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	return SaveFile(path, cfg)
+}
+
+// SaveFile writes cfg to path as YAML.
+func SaveFile(path string, cfg *Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// Get returns the value of key as a string, or "" when it is not set.
+func (c *Config) Get(key string) (string, error) {
+	switch key {
+	case "model":
+		return c.Model, nil
+	case "size":
+		return c.Size, nil
+	case "quality":
+		return c.Quality, nil
+	case "format":
+		return c.Format, nil
+	case "output":
+		return c.Output, nil
+	case "parallel":
+		if c.Parallel == 0 {
+			return "", nil
+		}
+		return strconv.Itoa(c.Parallel), nil
+	case "base_url":
+		return c.BaseURL, nil
+	case "proxy":
+		return c.Proxy, nil
+	case "ca_cert":
+		return c.CACert, nil
+	case "event_log":
+		return c.EventLog, nil
+	case "event_log_prompts":
+		return c.EventLogPrompts, nil
+	case "resume_last":
+		if !c.ResumeLast {
+			return "", nil
+		}
+		return "true", nil
+	case "confirm_above":
+		if c.ConfirmAbove == 0 {
+			return "", nil
+		}
+		return strconv.FormatFloat(c.ConfirmAbove, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("%w %q: valid keys are %v", ErrUnknownKey, key, Keys())
+	}
+}
+
+// Set validates value and stores it under key. An empty value clears the
+// key so the built-in default applies again.
+func (c *Config) Set(key, value string) error {
+	switch key {
+	case "model":
+		c.Model = value
+	case "size":
+		c.Size = value
+	case "quality":
+		c.Quality = value
+	case "format":
+		if value != "" {
+			format := models.OutputFormat(value)
+			if !format.IsValid() && !format.IsAuto() {
+				return fmt.Errorf("invalid format %q: must be one of %v or auto", value, models.ValidFormats())
+			}
+		}
+		c.Format = value
+	case "output":
+		c.Output = value
+	case "parallel":
+		if value == "" {
+			c.Parallel = 0
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid parallel %q: must be a positive integer", value)
+		}
+		c.Parallel = n
+	case "base_url":
+		c.BaseURL = value
+	case "proxy":
+		c.Proxy = value
+	case "ca_cert":
+		c.CACert = value
+	case "event_log":
+		c.EventLog = value
+	case "event_log_prompts":
+		if value != "" {
+			if _, err := events.ParsePromptMode(value); err != nil {
+				return err
+			}
+		}
+		c.EventLogPrompts = value
+	case "resume_last":
+		if value == "" {
+			c.ResumeLast = false
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid resume_last %q: must be true or false", value)
+		}
+		c.ResumeLast = b
+	case "confirm_above":
+		if value == "" {
+			c.ConfirmAbove = 0
+			return nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 {
+			return fmt.Errorf("invalid confirm_above %q: must be a dollar amount of 0 or more", value)
+		}
+		c.ConfirmAbove = f
+	default:
+		return fmt.Errorf("%w %q: valid keys are %v", ErrUnknownKey, key, Keys())
+	}
+	return nil
+}
+
+// ProfileNames returns the names of the profiles in the file, sorted.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithProfile returns the settings in effect when profile name is selected:
+// every setting the profile sets replaces the base value, and its aliases
+// are added to the base aliases. An empty name returns c unchanged.
+func (c *Config) WithProfile(name string) (*Config, error) {
+	if name == "" {
+		return c, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q: available profiles are %v", ErrUnknownProfile, name, c.ProfileNames())
+	}
+
+	merged := *c
+	merged.Profiles = nil
+	if p == nil {
+		return &merged, nil
+	}
+	override(&merged.Model, p.Model)
+	override(&merged.Size, p.Size)
+	override(&merged.Quality, p.Quality)
+	override(&merged.Format, p.Format)
+	override(&merged.Output, p.Output)
+	override(&merged.BaseURL, p.BaseURL)
+	override(&merged.Proxy, p.Proxy)
+	override(&merged.CACert, p.CACert)
+	override(&merged.EventLog, p.EventLog)
+	override(&merged.EventLogPrompts, p.EventLogPrompts)
+	if p.Parallel > 0 {
+		merged.Parallel = p.Parallel
+	}
+	if p.ResumeLast {
+		merged.ResumeLast = true
+	}
+	if p.ConfirmAbove > 0 {
+		merged.ConfirmAbove = p.ConfirmAbove
+	}
+	if len(p.Aliases) > 0 {
+		merged.Aliases = make(map[string]string, len(c.Aliases)+len(p.Aliases))
+		for alias, model := range c.Aliases {
+			merged.Aliases[alias] = model
+		}
+		for alias, model := range p.Aliases {
+			merged.Aliases[alias] = model
+		}
+	}
+	return &merged, nil
+}
+
+func override(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad_MissingFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Aliases) != 0 {
+		t.Errorf("Aliases = %v, want empty", cfg.Aliases)
+	}
+}
+
+func TestLoad_Aliases(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := filepath.Join(home, ".imggen")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "aliases:\n  hd: dall-e-3\n  cheap: dall-e-2\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Aliases["hd"] != "dall-e-3" || cfg.Aliases["cheap"] != "dall-e-2" {
+		t.Errorf("Aliases = %v", cfg.Aliases)
+	}
+}
+
+func TestLoadFile_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("aliases: [not, a, map"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadFile(path); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestConfig_GetSet(t *testing.T) {
+	cfg := &Config{}
+
+	tests := []struct {
+		key, value string
+	}{
+		{"model", "dall-e-3"},
+		{"size", "1792x1024"},
+		{"quality", "hd"},
+		{"format", "webp"},
+		{"output", "./images"},
+		{"parallel", "3"},
+		{"base_url", "https://proxy.example.com/v1"},
+		{"proxy", "http://proxy.corp:8080"},
+		{"ca_cert", "~/.imggen/corp-ca.pem"},
+		{"event_log", "~/.imggen/events.jsonl"},
+		{"event_log_prompts", "plain"},
+		{"resume_last", "true"},
+		{"confirm_above", "2.5"},
+	}
+	for _, tt := range tests {
+		if err := cfg.Set(tt.key, tt.value); err != nil {
+			t.Fatalf("Set(%q, %q) error = %v", tt.key, tt.value, err)
+		}
+		got, err := cfg.Get(tt.key)
+		if err != nil || got != tt.value {
+			t.Errorf("Get(%q) = %q, %v; want %q", tt.key, got, err, tt.value)
+		}
+	}
+
+	if err := cfg.Set("parallel", ""); err != nil || cfg.Parallel != 0 {
+		t.Errorf("clearing parallel: err = %v, Parallel = %d", err, cfg.Parallel)
+	}
+}
+
+func TestConfig_SetInvalid(t *testing.T) {
+	cfg := &Config{}
+
+	if err := cfg.Set("colour", "red"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Set(colour) error = %v, want ErrUnknownKey", err)
+	}
+	if _, err := cfg.Get("colour"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Get(colour) error = %v, want ErrUnknownKey", err)
+	}
+	if err := cfg.Set("format", "gif"); err == nil {
+		t.Error("Set(format, gif) should fail")
+	}
+	for _, v := range []string{"0", "-2", "many"} {
+		if err := cfg.Set("parallel", v); err == nil {
+			t.Errorf("Set(parallel, %q) should fail", v)
+		}
+	}
+	if err := cfg.Set("event_log_prompts", "encrypt"); err == nil {
+		t.Error("Set(event_log_prompts, encrypt) should fail")
+	}
+	if err := cfg.Set("resume_last", "sometimes"); err == nil {
+		t.Error("Set(resume_last, sometimes) should fail")
+	}
+	for _, v := range []string{"-1", "lots"} {
+		if err := cfg.Set("confirm_above", v); err == nil {
+			t.Errorf("Set(confirm_above, %q) should fail", v)
+		}
+	}
+}
+
+func TestSave_RoundTrip(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	want := &Config{
+		Model:    "dall-e-3",
+		Quality:  "hd",
+		Parallel: 2,
+		Aliases:  map[string]string{"hd": "dall-e-3"},
+	}
+	if err := Save(want); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got.Model != want.Model || got.Quality != want.Quality || got.Parallel != want.Parallel || got.Aliases["hd"] != "dall-e-3" {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadFile_Profiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `model: gpt-image-1
+quality: medium
+output: ./images
+aliases:
+  hd: dall-e-3
+profiles:
+  art:
+    model: dall-e-3
+    quality: hd
+    aliases:
+      wide: dall-e-3
+  work:
+    output: ./work
+    base_url: https://proxy.example.com/v1
+    parallel: 2
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if got := cfg.ProfileNames(); len(got) != 2 || got[0] != "art" || got[1] != "work" {
+		t.Errorf("ProfileNames() = %v, want [art work]", got)
+	}
+
+	art, err := cfg.WithProfile("art")
+	if err != nil {
+		t.Fatalf("WithProfile(art) error = %v", err)
+	}
+	if art.Model != "dall-e-3" || art.Quality != "hd" {
+		t.Errorf("art model/quality = %q/%q, want profile values", art.Model, art.Quality)
+	}
+	if art.Output != "./images" {
+		t.Errorf("art output = %q, want base value", art.Output)
+	}
+	if art.Aliases["hd"] != "dall-e-3" || art.Aliases["wide"] != "dall-e-3" {
+		t.Errorf("art aliases = %v, want base and profile aliases", art.Aliases)
+	}
+	if len(cfg.Aliases) != 1 {
+		t.Errorf("base aliases = %v, WithProfile must not modify the base config", cfg.Aliases)
+	}
+
+	work, err := cfg.WithProfile("work")
+	if err != nil {
+		t.Fatalf("WithProfile(work) error = %v", err)
+	}
+	if work.Model != "gpt-image-1" || work.Output != "./work" || work.BaseURL != "https://proxy.example.com/v1" || work.Parallel != 2 {
+		t.Errorf("work = %+v", work)
+	}
+
+	if base, err := cfg.WithProfile(""); err != nil || base != cfg {
+		t.Errorf("WithProfile(\"\") = %p, %v; want the base config", base, err)
+	}
+}
+
+func TestConfig_WithProfile_Unknown(t *testing.T) {
+	cfg := &Config{Profiles: map[string]*Config{"art": {Model: "dall-e-3"}}}
+
+	_, err := cfg.WithProfile("wrok")
+	if !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("WithProfile() error = %v, want ErrUnknownProfile", err)
+	}
+}
@@ -0,0 +1,71 @@
+package cost
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrBudgetExceeded is returned when a request would take spending past
+// its budget.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Budget caps the total spend of a run. Requests reserve their estimated
+// cost before they are sent, so the cap holds across parallel workers. A
+// nil Budget allows everything.
+type Budget struct {
+	mu    sync.Mutex
+	limit float64
+	spent float64
+}
+
+// NewBudget returns a Budget that allows spending up to limit USD.
+func NewBudget(limit float64) *Budget {
+	return &Budget{limit: limit}
+}
+
+// Check reports an error wrapping ErrBudgetExceeded when spending amount
+// on top of spent would go over limit.
+func Check(limit, spent, amount float64) error {
+	if spent+amount > limit+1e-9 {
+		return fmt.Errorf("%w: next request ($%.4f) would bring spend to $%.4f, over the $%.2f budget",
+			ErrBudgetExceeded, amount, spent+amount, limit)
+	}
+	return nil
+}
+
+// Reserve sets amount aside for a request about to be sent, or returns an
+// error wrapping ErrBudgetExceeded if that would go over the budget.
+func (b *Budget) Reserve(amount float64) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := Check(b.limit, b.spent, amount); err != nil {
+		return err
+	}
+	b.spent += amount
+	return nil
+}
+
+// Settle replaces a reservation with what the request actually cost; pass
+// zero for a request that failed.
+func (b *Budget) Settle(reserved, actual float64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.spent += actual - reserved
+	b.mu.Unlock()
+}
+
+// Spent returns the amount reserved or spent so far.
+func (b *Budget) Spent() float64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.spent
+}
@@ -0,0 +1,51 @@
+package cost
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestBudget_ReserveAndSettle(t *testing.T) {
+	b := NewBudget(0.10)
+
+	if err := b.Reserve(0.04); err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	if err := b.Reserve(0.04); err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	err := b.Reserve(0.04)
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("Reserve() error = %v, want ErrBudgetExceeded", err)
+	}
+
+	// A failed request frees its reservation.
+	b.Settle(0.04, 0)
+	if err := b.Reserve(0.04); err != nil {
+		t.Errorf("Reserve() after settling a failure error = %v", err)
+	}
+	if got := b.Spent(); math.Abs(got-0.08) > 1e-9 {
+		t.Errorf("Spent() = %v, want 0.08", got)
+	}
+}
+
+func TestBudget_ExactLimit(t *testing.T) {
+	b := NewBudget(0.12)
+	for range 3 {
+		if err := b.Reserve(0.04); err != nil {
+			t.Fatalf("Reserve() up to the limit error = %v", err)
+		}
+	}
+}
+
+func TestBudget_Nil(t *testing.T) {
+	var b *Budget
+	if err := b.Reserve(1000); err != nil {
+		t.Errorf("nil Budget Reserve() error = %v", err)
+	}
+	b.Settle(1, 2)
+	if b.Spent() != 0 {
+		t.Error("nil Budget should report nothing spent")
+	}
+}
@@ -6,13 +6,37 @@ const (
 	CurrencyUSD = "USD"
 )
 
-type Calculator struct{}
+type Calculator struct {
+	overrides Overrides
+}
+
+// Option configures a Calculator.
+type Option func(*Calculator)
+
+// WithOverrides makes the Calculator check o, typically loaded from the
+// pricing file, before its built-in tables. A nil o keeps the built-in
+// prices.
+func WithOverrides(o Overrides) Option {
+	return func(c *Calculator) {
+		c.overrides = o
+	}
+}
 
-func NewCalculator() *Calculator {
-	return &Calculator{}
+func NewCalculator(opts ...Option) *Calculator {
+	c := &Calculator{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
+// Calculate prices count images from the Calculator's overrides, falling
+// back to the built-in per-image tables.
 func (c *Calculator) Calculate(provider models.ProviderType, model, size, quality string, count int) *models.CostInfo {
+	if info, ok := c.Override(model, size, quality, count); ok {
+		return info
+	}
+
 	var perImage float64
 
 	switch provider {
@@ -28,9 +52,51 @@ func (c *Calculator) Calculate(provider models.ProviderType, model, size, qualit
 		PerImage: perImage,
 		Total:    perImage * float64(count),
 		Currency: CurrencyUSD,
+		Source:   models.CostSourceTable,
 	}
 }
 
+// Override prices count images from the overrides given with
+// WithOverrides. It returns false when no override covers the request.
+func (c *Calculator) Override(model, size, quality string, count int) (*models.CostInfo, bool) {
+	perImage, ok := c.overrides.price(model, size, quality)
+	if !ok {
+		return nil, false
+	}
+	return &models.CostInfo{
+		PerImage: perImage,
+		Total:    perImage * float64(count),
+		Currency: CurrencyUSD,
+		Source:   models.CostSourceOverride,
+	}, true
+}
+
+// CalculateImageTokens prices an image generation or edit from the token
+// usage reported by the API. It returns false when the model has no token
+// pricing, in which case callers should fall back to Calculate.
+func (c *Calculator) CalculateImageTokens(model string, textInput, imageInput, output, count int) (*models.CostInfo, bool) {
+	rates, ok := GetImageTokenRates(model)
+	if !ok {
+		return nil, false
+	}
+
+	total := (float64(textInput)*rates.TextInput +
+		float64(imageInput)*rates.ImageInput +
+		float64(output)*rates.Output) / 1_000_000
+
+	perImage := total
+	if count > 0 {
+		perImage = total / float64(count)
+	}
+
+	return &models.CostInfo{
+		PerImage: perImage,
+		Total:    total,
+		Currency: CurrencyUSD,
+		Source:   models.CostSourceUsage,
+	}, true
+}
+
 func (c *Calculator) calculateOpenAI(model, size, quality string) float64 {
 	price, ok := GetOpenAIPrice(model, size, quality)
 	if ok {
@@ -59,8 +125,8 @@ func (c *Calculator) calculateOpenAI(model, size, quality string) float64 {
 }
 
 func (c *Calculator) calculateStability(model, size, quality string) float64 {
-	// TODO: Add Stability AI pricing when integrated
-	return 0
+	price, _ := GetStabilityPrice(model)
+	return price
 }
 
 // CalculateVideo calculates the cost for video generation
@@ -119,3 +185,15 @@ func (c *Calculator) CalculateOCR(model string, inputTokens, outputTokens int) *
 		Currency: CurrencyUSD,
 	}
 }
+
+// Estimate prices count images of model at size and quality from the price
+// table, before anything is generated. Models missing from the table
+// estimate as zero. It lives here rather than in pkg/models because the
+// price tables do, and this package already imports models.
+func (c *Calculator) Estimate(model, size, quality string, count int) *models.CostInfo {
+	provider := models.ProviderOpenAI
+	if _, ok := GetStabilityPrice(model); ok {
+		provider = models.ProviderStability
+	}
+	return c.Calculate(provider, model, size, quality, count)
+}
@@ -1,6 +1,7 @@
 package cost
 
 import (
+	"math"
 	"testing"
 
 	"github.com/manash/imggen/pkg/models"
@@ -169,10 +170,22 @@ func TestCalculator_Calculate_UnknownProvider(t *testing.T) {
 func TestCalculator_Calculate_StabilityProvider(t *testing.T) {
 	calc := NewCalculator()
 
-	// Stability AI pricing not yet implemented
-	result := calc.Calculate(models.ProviderStability, "stable-diffusion-xl", "1024x1024", "", 1)
-	if result.Total != 0 {
-		t.Errorf("expected 0 for stability (not implemented), got %.4f", result.Total)
+	tests := []struct {
+		model string
+		count int
+		want  float64
+	}{
+		{"stable-diffusion-xl", 1, 0.009},
+		{"stable-diffusion-xl", 4, 0.036},
+		{"stable-diffusion-3", 2, 0.130},
+		{"unknown-stability-model", 1, 0},
+	}
+
+	for _, tt := range tests {
+		result := calc.Calculate(models.ProviderStability, tt.model, "1024x1024", "", tt.count)
+		if math.Abs(result.Total-tt.want) > 1e-9 {
+			t.Errorf("Calculate(stability, %s, %d) = %.4f, want %.4f", tt.model, tt.count, result.Total, tt.want)
+		}
 	}
 }
 
@@ -546,3 +559,51 @@ func TestGetVideoPricePerSecond_NotFound(t *testing.T) {
 		t.Errorf("GetVideoPricePerSecond() = %v, want 0", price)
 	}
 }
+
+func TestCalculator_CalculateImageTokens(t *testing.T) {
+	calc := NewCalculator()
+
+	info, ok := calc.CalculateImageTokens("gpt-image-1", 1_000_000, 0, 1_000_000, 2)
+	if !ok {
+		t.Fatal("CalculateImageTokens() ok = false, want true for gpt-image-1")
+	}
+	if info.Total != 45.0 {
+		t.Errorf("Total = %f, want 45.0", info.Total)
+	}
+	if info.PerImage != 22.5 {
+		t.Errorf("PerImage = %f, want 22.5", info.PerImage)
+	}
+	if info.Source != models.CostSourceUsage {
+		t.Errorf("Source = %q, want %q", info.Source, models.CostSourceUsage)
+	}
+
+	if _, ok := calc.CalculateImageTokens("dall-e-3", 100, 0, 100, 1); ok {
+		t.Error("CalculateImageTokens() ok = true for model without token pricing")
+	}
+}
+
+func TestCalculator_Estimate(t *testing.T) {
+	tests := []struct {
+		model, size, quality string
+		count                int
+		want                 float64
+	}{
+		{"gpt-image-1", "1024x1024", "high", 2, 0.334},
+		{"dall-e-3", "1792x1024", "hd", 1, 0.120},
+		{"dall-e-2", "512x512", "", 3, 0.054},
+		{"stable-diffusion-3", "1024x1024", "", 2, 0.130},
+		{"unknown-model", "1024x1024", "", 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			got := NewCalculator().Estimate(tt.model, tt.size, tt.quality, tt.count)
+			if math.Abs(got.Total-tt.want) > 1e-9 {
+				t.Errorf("Estimate() total = %v, want %v", got.Total, tt.want)
+			}
+			if got.Source != models.CostSourceTable {
+				t.Errorf("Source = %q, want %q", got.Source, models.CostSourceTable)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package cost
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// numberFormat holds the digit-group and decimal separators for a locale.
+type numberFormat struct {
+	group   string
+	decimal string
+}
+
+// localeFormats is keyed by lowercase language (or language-region) code.
+var localeFormats = map[string]numberFormat{
+	"en":    {group: ",", decimal: "."},
+	"ja":    {group: ",", decimal: "."},
+	"zh":    {group: ",", decimal: "."},
+	"ko":    {group: ",", decimal: "."},
+	"hi":    {group: ",", decimal: "."},
+	"de":    {group: ".", decimal: ","},
+	"es":    {group: ".", decimal: ","},
+	"it":    {group: ".", decimal: ","},
+	"nl":    {group: ".", decimal: ","},
+	"pt":    {group: ".", decimal: ","},
+	"da":    {group: ".", decimal: ","},
+	"fr":    {group: " ", decimal: ","},
+	"sv":    {group: " ", decimal: ","},
+	"pl":    {group: " ", decimal: ","},
+	"ru":    {group: " ", decimal: ","},
+	"de-ch": {group: "'", decimal: "."},
+}
+
+// Formatter renders USD amounts for display. The zero value and a nil
+// *Formatter print plain "$1234.5678" with no grouping.
+type Formatter struct {
+	format numberFormat
+}
+
+// NewFormatter returns a Formatter for a locale such as "en-US" or "de_DE".
+// An empty locale keeps the plain, ungrouped output.
+func NewFormatter(locale string) (*Formatter, error) {
+	if locale == "" {
+		return &Formatter{}, nil
+	}
+
+	tag := strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if i := strings.IndexByte(tag, '.'); i >= 0 {
+		tag = tag[:i] // drop encodings like en_US.UTF-8
+	}
+
+	if nf, ok := localeFormats[tag]; ok {
+		return &Formatter{format: nf}, nil
+	}
+	lang, _, _ := strings.Cut(tag, "-")
+	if nf, ok := localeFormats[lang]; ok {
+		return &Formatter{format: nf}, nil
+	}
+	return nil, fmt.Errorf("unsupported locale %q", locale)
+}
+
+// USD formats amount with the given number of decimals, e.g. "$1,234.5678".
+func (f *Formatter) USD(amount float64, decimals int) string {
+	if f == nil || f.format.decimal == "" {
+		return fmt.Sprintf("$%.*f", decimals, amount)
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := strconv.FormatFloat(amount, 'f', decimals, 64)
+	whole, frac, _ := strings.Cut(digits, ".")
+
+	var b strings.Builder
+	b.WriteString(sign)
+	b.WriteByte('$')
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(f.format.group)
+		}
+		b.WriteRune(r)
+	}
+	if frac != "" {
+		b.WriteString(f.format.decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package cost
+
+import "testing"
+
+func TestFormatter_USD(t *testing.T) {
+	tests := []struct {
+		name     string
+		locale   string
+		amount   float64
+		decimals int
+		want     string
+	}{
+		{"plain large total", "", 1234.5678, 4, "$1234.5678"},
+		{"en large total", "en-US", 1234.5678, 4, "$1,234.5678"},
+		{"en millions", "en_US.UTF-8", 1234567.891, 2, "$1,234,567.89"},
+		{"en small per-image", "en-US", 0.042, 4, "$0.0420"},
+		{"de large total", "de-DE", 1234.5678, 4, "$1.234,5678"},
+		{"de small per-image", "de", 0.011, 4, "$0,0110"},
+		{"fr grouping", "fr-FR", 98765.4321, 4, "$98 765,4321"},
+		{"swiss", "de-CH", 1234.5, 2, "$1'234.50"},
+		{"three digits not grouped", "en", 999.99, 2, "$999.99"},
+		{"negative", "en", -1234.5, 2, "-$1,234.50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFormatter(tt.locale)
+			if err != nil {
+				t.Fatalf("NewFormatter(%q) error = %v", tt.locale, err)
+			}
+			if got := f.USD(tt.amount, tt.decimals); got != tt.want {
+				t.Errorf("USD(%v) = %q, want %q", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFormatter_UnsupportedLocale(t *testing.T) {
+	if _, err := NewFormatter("xx-YY"); err == nil {
+		t.Error("NewFormatter() error = nil, want error for unknown locale")
+	}
+}
+
+func TestFormatter_NilIsPlain(t *testing.T) {
+	var f *Formatter
+	if got := f.USD(1234.5, 4); got != "$1234.5000" {
+		t.Errorf("nil Formatter USD() = %q, want $1234.5000", got)
+	}
+}
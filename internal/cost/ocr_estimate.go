@@ -0,0 +1,44 @@
+package cost
+
+import (
+	"math"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// Token accounting for images sent at "high" detail: the image is scaled
+// to fit 2048x2048, then down so its shorter side is at most 768, and
+// billed per 512px tile plus a base charge.
+const (
+	ocrBaseTokens = 85
+	ocrTileTokens = 170
+
+	// ocrPromptTokens covers the extraction instructions around the
+	// caller's own prompt and schema.
+	ocrPromptTokens = 200
+)
+
+// OCRImageTokens returns the input tokens an image of width×height costs.
+// Unknown dimensions (zero) are priced as the largest image.
+func OCRImageTokens(width, height int) int {
+	if width <= 0 || height <= 0 {
+		width, height = 768, 2048
+	}
+	w, h := float64(width), float64(height)
+	if longest := max(w, h); longest > 2048 {
+		w, h = w*2048/longest, h*2048/longest
+	}
+	if shortest := min(w, h); shortest > 768 {
+		w, h = w*768/shortest, h*768/shortest
+	}
+	tiles := int(math.Ceil(w/512) * math.Ceil(h/512))
+	return ocrBaseTokens + ocrTileTokens*tiles
+}
+
+// EstimateOCRCost prices the most an OCR request can cost before it is
+// sent: the image, about a token per four bytes of prompt and schema text,
+// and all maxOutputTokens of the reply.
+func EstimateOCRCost(model string, width, height, textBytes, maxOutputTokens int) *models.CostInfo {
+	input := OCRImageTokens(width, height) + ocrPromptTokens + (textBytes+3)/4
+	return NewCalculator().CalculateOCR(model, input, maxOutputTokens)
+}
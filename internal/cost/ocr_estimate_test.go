@@ -0,0 +1,34 @@
+package cost
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOCRImageTokens(t *testing.T) {
+	tests := []struct {
+		w, h int
+		want int
+	}{
+		{2, 2, 255},
+		{512, 512, 255},
+		{1024, 1024, 765},
+		{2048, 4096, 1105},
+		{800, 600, 765},
+		{0, 0, 1445},
+	}
+	for _, tt := range tests {
+		if got := OCRImageTokens(tt.w, tt.h); got != tt.want {
+			t.Errorf("OCRImageTokens(%d, %d) = %d, want %d", tt.w, tt.h, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateOCRCost(t *testing.T) {
+	// 765 image + 200 prompt + 100 text tokens in, 1000 out, at gpt-5-mini rates.
+	got := EstimateOCRCost("gpt-5-mini", 1024, 1024, 400, 1000).Total
+	want := 1065*0.25/1e6 + 1000*2.00/1e6
+	if math.Abs(got-want) > 1e-12 {
+		t.Errorf("EstimateOCRCost() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,174 @@
+package cost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// AnyValue as a size or quality in Overrides matches every size or quality
+// of the model, e.g. for dall-e-2, which has no quality setting.
+const AnyValue = "*"
+
+// ErrInvalidOverride is returned for pricing file entries that do not name
+// a known model, size, and quality with a non-negative price.
+var ErrInvalidOverride = errors.New("invalid price override")
+
+// Overrides are user-supplied prices in USD per image that replace the
+// built-in tables, keyed by model, then size, then quality. Entries that
+// are not listed keep their built-in price.
+type Overrides map[string]map[string]map[string]float64
+
+// price returns the override for model at size and quality. An exact entry
+// wins over one using AnyValue for the quality, which wins over one using
+// AnyValue for the size.
+func (o Overrides) price(model, size, quality string) (float64, bool) {
+	sizes, ok := o[model]
+	if !ok {
+		return 0, false
+	}
+	for _, k := range [][2]string{{size, quality}, {size, AnyValue}, {AnyValue, quality}, {AnyValue, AnyValue}} {
+		if price, ok := sizes[k[0]][k[1]]; ok {
+			return price, true
+		}
+	}
+	return 0, false
+}
+
+// PricingPath returns the location of the pricing overrides file.
+func PricingPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".imggen", "pricing.json"), nil
+}
+
+// LoadOverrides reads and validates the pricing file at path. A missing
+// file yields empty Overrides.
+func LoadOverrides(path string, registry *models.ModelRegistry) (Overrides, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Overrides{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing file: %w", err)
+	}
+
+	var o Overrides
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if o == nil {
+		o = Overrides{}
+	}
+	if err := o.Validate(registry); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return o, nil
+}
+
+// SaveOverrides writes o to path as indented JSON, creating its directory
+// if needed.
+func SaveOverrides(path string, o Overrides) error {
+	data, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode pricing: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create pricing directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write pricing file: %w", err)
+	}
+	return nil
+}
+
+// Validate checks that every entry names an image model in registry, one of
+// its sizes, and one of its qualities, and that prices are not negative.
+// Models without qualities take AnyValue or an empty quality.
+func (o Overrides) Validate(registry *models.ModelRegistry) error {
+	for _, model := range sortedKeys(o) {
+		caps, ok := registry.Get(model)
+		if !ok {
+			return fmt.Errorf("%w: unknown model %q", ErrInvalidOverride, model)
+		}
+		for _, size := range sortedKeys(o[model]) {
+			if size != AnyValue && !slices.Contains(caps.SupportedSizes, size) {
+				return fmt.Errorf("%w: %s does not support size %q (valid: %v)", ErrInvalidOverride, model, size, caps.SupportedSizes)
+			}
+			for _, quality := range sortedKeys(o[model][size]) {
+				if !validOverrideQuality(caps, quality) {
+					return fmt.Errorf("%w: %s does not support quality %q (valid: %v)", ErrInvalidOverride, model, quality, caps.SupportedQualities)
+				}
+				if price := o[model][size][quality]; price < 0 {
+					return fmt.Errorf("%w: %s %s %s price %v is negative", ErrInvalidOverride, model, size, quality, price)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validOverrideQuality(caps *models.ModelCapabilities, quality string) bool {
+	if quality == AnyValue {
+		return true
+	}
+	if len(caps.SupportedQualities) == 0 {
+		return quality == ""
+	}
+	return slices.Contains(caps.SupportedQualities, quality)
+}
+
+// Set records price for model at size and quality.
+func (o Overrides) Set(model, size, quality string, price float64) {
+	if o[model] == nil {
+		o[model] = make(map[string]map[string]float64)
+	}
+	if o[model][size] == nil {
+		o[model][size] = make(map[string]float64)
+	}
+	o[model][size][quality] = price
+}
+
+// Reset removes every override for model, reporting whether it had any.
+func (o Overrides) Reset(model string) bool {
+	_, ok := o[model]
+	delete(o, model)
+	return ok
+}
+
+// Override is one entry of Overrides.
+type Override struct {
+	PricingKey
+	Price float64
+}
+
+// Entries returns every override sorted by model, size, and quality.
+func (o Overrides) Entries() []Override {
+	var entries []Override
+	for _, model := range sortedKeys(o) {
+		for _, size := range sortedKeys(o[model]) {
+			for _, quality := range sortedKeys(o[model][size]) {
+				key := PricingKey{Model: model, Size: size, Quality: quality}
+				entries = append(entries, Override{PricingKey: key, Price: o[model][size][quality]})
+			}
+		}
+	}
+	return entries
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,123 @@
+package cost
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+func TestLoadOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	content := `{
+  "gpt-image-1": {"1024x1024": {"high": 0.19}},
+  "dall-e-2": {"*": {"*": 0.025}}
+}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := LoadOverrides(path, models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("LoadOverrides() error = %v", err)
+	}
+	entries := o.Entries()
+	if len(entries) != 2 || entries[0].Model != "dall-e-2" || entries[1].Price != 0.19 {
+		t.Errorf("Entries() = %+v", entries)
+	}
+}
+
+func TestLoadOverrides_MissingFile(t *testing.T) {
+	o, err := LoadOverrides(filepath.Join(t.TempDir(), "pricing.json"), models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("LoadOverrides() error = %v", err)
+	}
+	if len(o) != 0 {
+		t.Errorf("LoadOverrides() = %v, want empty", o)
+	}
+}
+
+func TestOverrides_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		o    Overrides
+	}{
+		{"unknown model", Overrides{"gpt-image-9": {"1024x1024": {"high": 0.1}}}},
+		{"unknown size", Overrides{"gpt-image-1": {"640x480": {"high": 0.1}}}},
+		{"unknown quality", Overrides{"dall-e-3": {"1024x1024": {"ultra": 0.1}}}},
+		{"quality for model without qualities", Overrides{"dall-e-2": {"512x512": {"hd": 0.1}}}},
+		{"negative price", Overrides{"dall-e-3": {"1024x1024": {"hd": -1}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.o.Validate(models.DefaultRegistry()); !errors.Is(err, ErrInvalidOverride) {
+				t.Errorf("Validate() error = %v, want ErrInvalidOverride", err)
+			}
+		})
+	}
+
+	valid := Overrides{"dall-e-2": {"512x512": {"": 0.02}}, "dall-e-3": {"*": {"hd": 0.1}}}
+	if err := valid.Validate(models.DefaultRegistry()); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestCalculator_Calculate_Overrides(t *testing.T) {
+	calc := NewCalculator(WithOverrides(Overrides{
+		"dall-e-3": {
+			"1024x1024": {"hd": 0.09},
+			"*":         {"hd": 0.15, "*": 0.05},
+		},
+	}))
+	tests := []struct {
+		size, quality string
+		want          float64
+		wantSource    string
+	}{
+		{"1024x1024", "hd", 0.09, models.CostSourceOverride},
+		{"1792x1024", "hd", 0.15, models.CostSourceOverride},
+		{"1024x1024", "standard", 0.05, models.CostSourceOverride},
+	}
+	for _, tt := range tests {
+		got := calc.Calculate(models.ProviderOpenAI, "dall-e-3", tt.size, tt.quality, 2)
+		if !floatEquals(got.PerImage, tt.want) || !floatEquals(got.Total, 2*tt.want) || got.Source != tt.wantSource {
+			t.Errorf("Calculate(dall-e-3, %s, %s) = %+v, want %v per image from %s", tt.size, tt.quality, got, tt.want, tt.wantSource)
+		}
+	}
+
+	// Models without overrides keep the built-in table.
+	got := calc.Calculate(models.ProviderOpenAI, "gpt-image-1", "1024x1024", "high", 1)
+	if !floatEquals(got.PerImage, 0.167) || got.Source != models.CostSourceTable {
+		t.Errorf("Calculate(gpt-image-1) = %+v, want built-in 0.167", got)
+	}
+
+	got = NewCalculator().Calculate(models.ProviderOpenAI, "dall-e-3", "1024x1024", "hd", 1)
+	if !floatEquals(got.PerImage, 0.080) {
+		t.Errorf("Calculate() without overrides = %+v, want built-in 0.080", got)
+	}
+}
+
+func TestSaveOverrides_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "pricing.json")
+	o := Overrides{}
+	o.Set("gpt-image-1", "1536x1024", "low", 0.02)
+	o.Set("stable-diffusion-xl", "*", "*", 0.01)
+
+	if err := SaveOverrides(path, o); err != nil {
+		t.Fatalf("SaveOverrides() error = %v", err)
+	}
+	loaded, err := LoadOverrides(path, models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("LoadOverrides() error = %v", err)
+	}
+	if loaded["gpt-image-1"]["1536x1024"]["low"] != 0.02 || loaded["stable-diffusion-xl"]["*"]["*"] != 0.01 {
+		t.Errorf("round trip = %v", loaded)
+	}
+
+	if !loaded.Reset("gpt-image-1") || loaded.Reset("gpt-image-1") {
+		t.Error("Reset() should report true once, then false")
+	}
+}
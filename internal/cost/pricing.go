@@ -51,6 +51,36 @@ func GetOpenAIPrice(model, size, quality string) (float64, bool) {
 	return price, ok
 }
 
+// ImageTokenRates holds token prices (USD per 1M tokens) for image models
+// that report usage.
+type ImageTokenRates struct {
+	TextInput  float64
+	ImageInput float64
+	Output     float64
+}
+
+var imageTokenPricing = map[string]ImageTokenRates{
+	"gpt-image-1": {TextInput: 5.00, ImageInput: 10.00, Output: 40.00},
+}
+
+func GetImageTokenRates(model string) (ImageTokenRates, bool) {
+	rates, ok := imageTokenPricing[model]
+	return rates, ok
+}
+
+// Stability AI pricing (USD per image). Stability bills in credits at
+// $0.01 each; prices do not vary by size.
+// Source: https://platform.stability.ai/pricing
+var stabilityPricing = map[string]float64{
+	"stable-diffusion-xl": 0.009, // 0.9 credits
+	"stable-diffusion-3":  0.065, // 6.5 credits (sd3-large)
+}
+
+func GetStabilityPrice(model string) (float64, bool) {
+	price, ok := stabilityPricing[model]
+	return price, ok
+}
+
 // Video pricing (USD per second)
 var videoPricing = map[string]float64{
 	"sora-2":     0.10, // $0.10 per second
@@ -0,0 +1,86 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"image/png"
+)
+
+// Budget bounds what the sixel and iTerm2 protocols write for one image, so
+// displaying a very large image cannot flood the terminal. Kitty is not
+// budgeted: it sends images in chunks and scales them to fit itself.
+type Budget struct {
+	// MaxDimension caps the longer side of the image in pixels; larger
+	// images are scaled down before encoding.
+	MaxDimension int
+
+	// MaxBytes caps the escape sequence written for the image. Output over
+	// it is discarded and the image encoded again at half the size.
+	MaxBytes int
+}
+
+// DefaultBudget leaves every size the supported models generate untouched.
+var DefaultBudget = Budget{MaxDimension: 2048, MaxBytes: 8 << 20}
+
+// minDimension is the smallest longer side encodeBounded shrinks an image
+// to before giving up.
+const minDimension = 16
+
+// encodeBounded encodes data into a buffer with the configured protocol,
+// halving the image until the output fits the budget, and only then writes
+// it out. Images that cannot be decoded are written as they are if they fit.
+func (d *Displayer) encodeBounded(data []byte) error {
+	cfg, _, err := stdimage.DecodeConfig(bytes.NewReader(data))
+	side := max(cfg.Width, cfg.Height)
+	if err == nil && side > d.budget.MaxDimension {
+		side = d.budget.MaxDimension
+		if data, err = shrink(data, side); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	for {
+		buf.Reset()
+		if err := d.encoderFor(&buf).Encode(data); err != nil {
+			return err
+		}
+		if buf.Len() <= d.budget.MaxBytes {
+			break
+		}
+		if side/2 < minDimension {
+			return fmt.Errorf("image does not fit the %d byte display budget", d.budget.MaxBytes)
+		}
+		side /= 2
+		if data, err = shrink(data, side); err != nil {
+			return err
+		}
+	}
+
+	_, err = d.out.Write(buf.Bytes())
+	return err
+}
+
+// shrink scales the image in data so its longer side is at most maxSide,
+// keeping its aspect ratio, and returns it as a PNG.
+func shrink(data []byte, maxSide int) ([]byte, error) {
+	img, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width >= height && width > maxSide {
+		width, height = maxSide, max(1, height*maxSide/width)
+	} else if height > maxSide {
+		width, height = max(1, width*maxSide/height), maxSide
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, resize(img, width, height)); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
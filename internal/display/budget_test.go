@@ -0,0 +1,101 @@
+package display
+
+import (
+	"bytes"
+	"context"
+	stdimage "image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// noisePNG encodes a w x h PNG of pseudo-random opaque pixels, which
+// compresses poorly and dithers into many sixel colors.
+func noisePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	seed := uint32(1)
+	for i := 0; i < len(img.Pix); i += 4 {
+		seed = seed*1664525 + 1013904223
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = byte(seed>>24), byte(seed>>16), byte(seed>>8), 255
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDisplayer_Display_Budget(t *testing.T) {
+	// Over DefaultBudget.MaxBytes once base64 encoded.
+	huge := noisePNG(t, 2000, 1500)
+
+	tests := []struct {
+		name     string
+		protocol Protocol
+		budget   Budget
+		prefix   string
+	}{
+		{"iterm2 default", ProtocolITerm2, Budget{}, "\x1b]1337;File="},
+		{"iterm2 bytes", ProtocolITerm2, Budget{MaxBytes: 64 << 10}, "\x1b]1337;File="},
+		{"sixel bytes", ProtocolSixel, Budget{MaxBytes: 64 << 10}, "\x1bP"},
+		{"sixel dimension", ProtocolSixel, Budget{MaxDimension: 100}, "\x1bP0;1;0q\"1;1;100;75"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			d := New(&buf)
+			d.SetProtocol(tt.protocol)
+			d.SetBudget(tt.budget)
+
+			if err := d.Display(context.Background(), &models.GeneratedImage{Data: huge}); err != nil {
+				t.Fatalf("Display() error = %v", err)
+			}
+			// Display ends the image with a newline.
+			if limit := d.budget.MaxBytes + 1; buf.Len() > limit {
+				t.Errorf("wrote %d bytes, want at most %d", buf.Len(), limit)
+			}
+			if !strings.HasPrefix(buf.String(), tt.prefix) {
+				t.Errorf("output starts with %q, want %q", buf.String()[:min(buf.Len(), 24)], tt.prefix)
+			}
+		})
+	}
+}
+
+func TestDisplayer_Display_BudgetKitty(t *testing.T) {
+	data := fixturePNG(t, 64, 64)
+	var buf bytes.Buffer
+	d := New(&buf)
+	d.SetProtocol(ProtocolKitty)
+	d.SetBudget(Budget{MaxDimension: 8, MaxBytes: 16})
+
+	if err := d.Display(context.Background(), &models.GeneratedImage{Data: data}); err != nil {
+		t.Fatalf("Display() error = %v", err)
+	}
+	var want bytes.Buffer
+	if err := NewKittyEncoder(&want).Encode(data); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), want.String()) {
+		t.Error("Kitty output should be sent in full, in chunks")
+	}
+}
+
+func TestDisplayer_Display_BudgetTooSmall(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf)
+	d.SetProtocol(ProtocolITerm2)
+	d.SetBudget(Budget{MaxBytes: 10})
+
+	err := d.Display(context.Background(), &models.GeneratedImage{Data: fixturePNG(t, 64, 64)})
+	if err == nil || !strings.Contains(err.Error(), "display budget") {
+		t.Errorf("Display() error = %v, want a budget error", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes for an image over budget", buf.Len())
+	}
+}
@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"strings"
 	"time"
 
 	"github.com/manash/imggen/internal/security"
@@ -15,9 +13,16 @@ import (
 
 const defaultTimeout = 60 * time.Second
 
+// Encoder writes image data to a terminal using one inline image protocol.
+type Encoder interface {
+	Encode(data []byte) error
+}
+
 type Displayer struct {
 	out        io.Writer
 	httpClient *http.Client
+	protocol   Protocol
+	budget     Budget
 }
 
 func New(out io.Writer) *Displayer {
@@ -26,6 +31,53 @@ func New(out io.Writer) *Displayer {
 		httpClient: &http.Client{
 			Timeout: defaultTimeout,
 		},
+		protocol: ProtocolAuto,
+		budget:   DefaultBudget,
+	}
+}
+
+// SetProtocol forces an image protocol instead of detecting one.
+func (d *Displayer) SetProtocol(p Protocol) {
+	d.protocol = p
+}
+
+// SetBudget changes how much the sixel and iTerm2 protocols may write for
+// one image. Zero fields keep their DefaultBudget values.
+func (d *Displayer) SetBudget(b Budget) {
+	if b.MaxDimension <= 0 {
+		b.MaxDimension = DefaultBudget.MaxDimension
+	}
+	if b.MaxBytes <= 0 {
+		b.MaxBytes = DefaultBudget.MaxBytes
+	}
+	d.budget = b
+}
+
+// resolveProtocol settles ProtocolAuto. Detection runs once per Displayer;
+// when it finds nothing, Kitty is used as before.
+func (d *Displayer) resolveProtocol() Protocol {
+	if d.protocol == ProtocolAuto {
+		d.protocol = DetectProtocol()
+	}
+	return d.protocol
+}
+
+// HasGraphics reports whether images are shown with a protocol that was
+// chosen or detected, rather than with the Kitty fallback used when
+// detection finds none.
+func (d *Displayer) HasGraphics() bool {
+	return d.resolveProtocol() != ProtocolNone
+}
+
+// encoderFor returns the encoder for the configured protocol, writing to w.
+func (d *Displayer) encoderFor(w io.Writer) Encoder {
+	switch d.resolveProtocol() {
+	case ProtocolSixel:
+		return NewSixelEncoder(w)
+	case ProtocolITerm2:
+		return NewITerm2Encoder(w)
+	default:
+		return NewKittyEncoder(w)
 	}
 }
 
@@ -35,8 +87,14 @@ func (d *Displayer) Display(ctx context.Context, img *models.GeneratedImage) err
 		return err
 	}
 
-	enc := NewKittyEncoder(d.out)
-	if err := enc.Encode(data); err != nil {
+	switch d.resolveProtocol() {
+	case ProtocolSixel, ProtocolITerm2:
+		err = d.encodeBounded(data)
+	default:
+		// Kitty sends the image in chunks the terminal scales itself.
+		err = d.encoderFor(d.out).Encode(data)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to encode image: %w", err)
 	}
 
@@ -46,6 +104,9 @@ func (d *Displayer) Display(ctx context.Context, img *models.GeneratedImage) err
 
 func (d *Displayer) DisplayAll(ctx context.Context, resp *models.Response) error {
 	for i, img := range resp.Images {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("display canceled after %d of %d images: %w", i, len(resp.Images), err)
+		}
 		if err := d.Display(ctx, &img); err != nil {
 			return fmt.Errorf("failed to display image %d: %w", i, err)
 		}
@@ -88,24 +149,9 @@ func (d *Displayer) downloadImage(ctx context.Context, url string) ([]byte, erro
 	return io.ReadAll(resp.Body)
 }
 
-func IsTerminalSupported() bool {
-	termProgram := strings.ToLower(os.Getenv("TERM_PROGRAM"))
-	supportedPrograms := []string{"kitty", "ghostty", "iterm.app", "wezterm"}
-
-	for _, prog := range supportedPrograms {
-		if termProgram == prog {
-			return true
-		}
-	}
-
-	if os.Getenv("KITTY_WINDOW_ID") != "" {
-		return true
-	}
-
-	if os.Getenv("ITERM_SESSION_ID") != "" {
-		return true
-	}
-
-	term := strings.ToLower(os.Getenv("TERM"))
-	return strings.Contains(term, "kitty") || strings.Contains(term, "ghostty")
+// IsTerminalSupported reports which image protocol the current terminal
+// supports, and false when it supports none of them.
+func IsTerminalSupported() (Protocol, bool) {
+	p := DetectProtocol()
+	return p, p != ProtocolNone
 }
@@ -3,6 +3,7 @@ package display
 import (
 	"bytes"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -16,6 +17,12 @@ import (
 func TestMain(m *testing.M) {
 	// Disable URL validation for tests using httptest
 	security.SetSkipValidation(true)
+	// Detect no terminal so tests using New see the Kitty default
+	// whichever terminal runs them.
+	for _, k := range []string{"TERM_PROGRAM", "KITTY_WINDOW_ID", "ITERM_SESSION_ID", "WEZTERM_EXECUTABLE", "TERM"} {
+		os.Unsetenv(k)
+	}
+	queryTerminal = func() Protocol { return ProtocolNone }
 	code := m.Run()
 	security.SetSkipValidation(false)
 	os.Exit(code)
@@ -163,79 +170,174 @@ func TestDisplayer_Display_PrefersData(t *testing.T) {
 	}
 }
 
+func TestDisplayer_HasGraphics(t *testing.T) {
+	if New(&bytes.Buffer{}).HasGraphics() {
+		t.Error("HasGraphics() = true with nothing detected")
+	}
+	d := New(&bytes.Buffer{})
+	d.SetProtocol(ProtocolSixel)
+	if !d.HasGraphics() {
+		t.Error("HasGraphics() = false with a chosen protocol")
+	}
+	t.Setenv("TERM_PROGRAM", "iTerm.app")
+	if !New(&bytes.Buffer{}).HasGraphics() {
+		t.Error("HasGraphics() = false in a detected terminal")
+	}
+}
+
 func TestIsTerminalSupported(t *testing.T) {
+	oldQuery := queryTerminal
+	queryTerminal = func() Protocol { return ProtocolNone }
+	defer func() { queryTerminal = oldQuery }()
+
 	tests := []struct {
 		name     string
 		envVars  map[string]string
-		expected bool
+		expected Protocol
 	}{
 		{
 			name:     "no env vars",
 			envVars:  map[string]string{},
-			expected: false,
+			expected: ProtocolNone,
 		},
 		{
 			name:     "kitty terminal program",
 			envVars:  map[string]string{"TERM_PROGRAM": "kitty"},
-			expected: true,
+			expected: ProtocolKitty,
 		},
 		{
 			name:     "ghostty terminal program",
 			envVars:  map[string]string{"TERM_PROGRAM": "ghostty"},
-			expected: true,
+			expected: ProtocolKitty,
 		},
 		{
 			name:     "iterm terminal program",
 			envVars:  map[string]string{"TERM_PROGRAM": "iTerm.app"},
-			expected: true,
+			expected: ProtocolITerm2,
 		},
 		{
 			name:     "wezterm terminal program",
 			envVars:  map[string]string{"TERM_PROGRAM": "WezTerm"},
-			expected: true,
+			expected: ProtocolITerm2,
 		},
 		{
 			name:     "kitty window id",
 			envVars:  map[string]string{"KITTY_WINDOW_ID": "123"},
-			expected: true,
+			expected: ProtocolKitty,
 		},
 		{
 			name:     "iterm session id",
 			envVars:  map[string]string{"ITERM_SESSION_ID": "abc"},
-			expected: true,
+			expected: ProtocolITerm2,
 		},
 		{
 			name:     "term contains kitty",
 			envVars:  map[string]string{"TERM": "xterm-kitty"},
-			expected: true,
+			expected: ProtocolKitty,
 		},
 		{
 			name:     "term contains ghostty",
 			envVars:  map[string]string{"TERM": "ghostty"},
-			expected: true,
+			expected: ProtocolKitty,
+		},
+		{
+			name:     "foot terminal",
+			envVars:  map[string]string{"TERM": "foot"},
+			expected: ProtocolSixel,
+		},
+		{
+			name:     "mintty",
+			envVars:  map[string]string{"TERM_PROGRAM": "mintty", "TERM": "xterm"},
+			expected: ProtocolSixel,
 		},
 		{
 			name:     "unsupported terminal",
 			envVars:  map[string]string{"TERM_PROGRAM": "gnome-terminal"},
-			expected: false,
+			expected: ProtocolNone,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			os.Unsetenv("TERM_PROGRAM")
-			os.Unsetenv("KITTY_WINDOW_ID")
-			os.Unsetenv("ITERM_SESSION_ID")
-			os.Unsetenv("TERM")
-
+			for _, k := range []string{"TERM_PROGRAM", "KITTY_WINDOW_ID", "ITERM_SESSION_ID", "WEZTERM_EXECUTABLE", "TERM"} {
+				t.Setenv(k, "")
+			}
 			for k, v := range tt.envVars {
-				os.Setenv(k, v)
+				t.Setenv(k, v)
 			}
 
-			result := IsTerminalSupported()
-			if result != tt.expected {
-				t.Errorf("expected %v, got %v", tt.expected, result)
+			protocol, ok := IsTerminalSupported()
+			if protocol != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, protocol)
+			}
+			if ok != (tt.expected != ProtocolNone) {
+				t.Errorf("supported = %v for protocol %q", ok, protocol)
 			}
 		})
 	}
 }
+
+func TestIsTerminalSupported_QueryFallback(t *testing.T) {
+	oldQuery := queryTerminal
+	queryTerminal = func() Protocol { return ProtocolSixel }
+	defer func() { queryTerminal = oldQuery }()
+
+	for _, k := range []string{"TERM_PROGRAM", "KITTY_WINDOW_ID", "ITERM_SESSION_ID", "WEZTERM_EXECUTABLE"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("TERM", "xterm-256color")
+
+	if protocol, ok := IsTerminalSupported(); protocol != ProtocolSixel || !ok {
+		t.Errorf("IsTerminalSupported() = %q, %v; want sixel from terminal query", protocol, ok)
+	}
+}
+
+func TestDisplayer_SetProtocol(t *testing.T) {
+	tests := []struct {
+		protocol Protocol
+		prefix   string
+	}{
+		{ProtocolKitty, "\x1b_G"},
+		{ProtocolITerm2, "\x1b]1337;File="},
+		{ProtocolSixel, "\x1bP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.protocol), func(t *testing.T) {
+			var buf bytes.Buffer
+			d := New(&buf)
+			d.SetProtocol(tt.protocol)
+
+			img := &models.GeneratedImage{Data: fixturePNG(t, 4, 4)}
+			if err := d.Display(context.Background(), img); err != nil {
+				t.Fatalf("Display() error = %v", err)
+			}
+			if !strings.HasPrefix(buf.String(), tt.prefix) {
+				t.Errorf("output starts with %q, want %q", buf.String()[:min(buf.Len(), 12)], tt.prefix)
+			}
+		})
+	}
+}
+
+func TestDisplayer_DisplayAll_Canceled(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf)
+
+	resp := &models.Response{
+		Images: []models.GeneratedImage{
+			{Data: []byte("image 1")},
+			{Data: []byte("image 2")},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := d.DisplayAll(ctx, resp)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("DisplayAll() error = %v, want context.Canceled", err)
+	}
+	if buf.Len() != 0 {
+		t.Error("DisplayAll() wrote output after cancellation")
+	}
+}
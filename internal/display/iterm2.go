@@ -0,0 +1,27 @@
+package display
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// ITerm2Encoder writes images with the iTerm2 inline image protocol
+// (OSC 1337 File), which WezTerm, VS Code, and others also understand.
+type ITerm2Encoder struct {
+	out io.Writer
+}
+
+func NewITerm2Encoder(out io.Writer) *ITerm2Encoder {
+	return &ITerm2Encoder{out: out}
+}
+
+func (e *ITerm2Encoder) Encode(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	_, err := fmt.Fprintf(e.out, "\x1b]1337;File=inline=1;size=%d;preserveAspectRatio=1:%s\a", len(data), encoded)
+	return err
+}
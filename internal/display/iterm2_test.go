@@ -0,0 +1,40 @@
+package display
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestITerm2Encoder_Encode(t *testing.T) {
+	var buf bytes.Buffer
+	data := fixturePNG(t, 4, 4)
+
+	if err := NewITerm2Encoder(&buf).Encode(data); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	out := buf.String()
+
+	wantPrefix := fmt.Sprintf("\x1b]1337;File=inline=1;size=%d;preserveAspectRatio=1:", len(data))
+	if !strings.HasPrefix(out, wantPrefix) {
+		t.Errorf("output prefix = %q, want %q", out[:min(len(out), len(wantPrefix))], wantPrefix)
+	}
+	if !strings.HasSuffix(out, "\a") {
+		t.Error("output should end with BEL")
+	}
+
+	payload := strings.TrimSuffix(strings.TrimPrefix(out, wantPrefix), "\a")
+	decoded, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("payload does not round-trip to the input PNG (err = %v)", err)
+	}
+}
+
+func TestITerm2Encoder_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewITerm2Encoder(&buf).Encode(nil); err != nil || buf.Len() != 0 {
+		t.Errorf("Encode(nil) = %v, output %q; want no output", err, buf.String())
+	}
+}
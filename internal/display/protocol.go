@@ -0,0 +1,149 @@
+package display
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Protocol is a terminal inline image protocol.
+type Protocol string
+
+const (
+	ProtocolNone   Protocol = ""
+	ProtocolAuto   Protocol = "auto"
+	ProtocolKitty  Protocol = "kitty"
+	ProtocolSixel  Protocol = "sixel"
+	ProtocolITerm2 Protocol = "iterm2"
+)
+
+// ParseProtocol validates a --show-protocol value. An empty name selects
+// ProtocolAuto.
+func ParseProtocol(s string) (Protocol, error) {
+	switch p := Protocol(strings.ToLower(s)); p {
+	case "", ProtocolAuto:
+		return ProtocolAuto, nil
+	case ProtocolKitty, ProtocolSixel, ProtocolITerm2:
+		return p, nil
+	default:
+		return ProtocolNone, fmt.Errorf("invalid protocol %q: must be kitty, sixel, iterm2, or auto", s)
+	}
+}
+
+// queryTimeout bounds how long DetectProtocol waits for a terminal that
+// does not answer device attribute queries.
+const queryTimeout = 200 * time.Millisecond
+
+// queryTerminal asks the controlling terminal which protocol it supports.
+// Tests replace it to avoid touching the real terminal.
+var queryTerminal = querySixelSupport
+
+// DetectProtocol picks the image protocol of the current terminal from
+// $TERM_PROGRAM, $TERM, and terminal-specific variables, falling back to
+// asking the terminal whether it supports sixel. It returns ProtocolNone
+// when no protocol is known to work.
+func DetectProtocol() Protocol {
+	if p := protocolFromEnv(os.Getenv); p != ProtocolNone {
+		return p
+	}
+	return queryTerminal()
+}
+
+// protocolFromEnv maps well-known terminals to the protocol they render
+// best. Terminals that support several protocols are listed under the one
+// with the most complete implementation.
+func protocolFromEnv(getenv func(string) string) Protocol {
+	switch strings.ToLower(getenv("TERM_PROGRAM")) {
+	case "kitty", "ghostty":
+		return ProtocolKitty
+	case "iterm.app", "wezterm", "vscode", "tabby", "hyper":
+		return ProtocolITerm2
+	case "mintty", "mlterm", "contour":
+		return ProtocolSixel
+	}
+
+	if getenv("KITTY_WINDOW_ID") != "" {
+		return ProtocolKitty
+	}
+	if getenv("ITERM_SESSION_ID") != "" || getenv("WEZTERM_EXECUTABLE") != "" {
+		return ProtocolITerm2
+	}
+
+	termName := strings.ToLower(getenv("TERM"))
+	switch {
+	case strings.Contains(termName, "kitty"), strings.Contains(termName, "ghostty"):
+		return ProtocolKitty
+	case strings.Contains(termName, "sixel"), strings.HasPrefix(termName, "foot"),
+		strings.HasPrefix(termName, "mlterm"), strings.HasPrefix(termName, "yaft"):
+		return ProtocolSixel
+	}
+	return ProtocolNone
+}
+
+// querySixelSupport sends a Primary Device Attributes request (ESC [ c) to
+// the controlling terminal and reports ProtocolSixel when the reply lists
+// attribute 4. Any failure, including no reply within queryTimeout, yields
+// ProtocolNone.
+func querySixelSupport() Protocol {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return ProtocolNone
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return ProtocolNone
+	}
+	defer tty.Close()
+
+	state, err := term.MakeRaw(int(tty.Fd()))
+	if err != nil {
+		return ProtocolNone
+	}
+	defer term.Restore(int(tty.Fd()), state)
+
+	if _, err := tty.WriteString("\x1b[c"); err != nil {
+		return ProtocolNone
+	}
+	if err := tty.SetReadDeadline(time.Now().Add(queryTimeout)); err != nil {
+		return ProtocolNone
+	}
+
+	var reply []byte
+	buf := make([]byte, 64)
+	for len(reply) < 256 {
+		n, err := tty.Read(buf)
+		reply = append(reply, buf[:n]...)
+		if err != nil || strings.HasSuffix(string(reply), "c") {
+			break
+		}
+	}
+
+	if hasSixelAttribute(string(reply)) {
+		return ProtocolSixel
+	}
+	return ProtocolNone
+}
+
+// hasSixelAttribute parses a Primary Device Attributes reply such as
+// "\x1b[?62;4;22c" and reports whether it advertises sixel graphics (4).
+func hasSixelAttribute(reply string) bool {
+	start := strings.Index(reply, "\x1b[?")
+	if start < 0 {
+		return false
+	}
+	reply = reply[start+3:]
+	end := strings.IndexByte(reply, 'c')
+	if end < 0 {
+		return false
+	}
+
+	for _, attr := range strings.Split(reply[:end], ";") {
+		if attr == "4" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package display
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"image/color/palette"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// maxSixelWidth caps the width of sixel output. Sixel data is far larger
+// than the PNG it comes from, so wider images are scaled down first.
+const maxSixelWidth = 800
+
+// SixelEncoder writes images as DEC sixel graphics. Images are quantized to
+// the Plan 9 palette with Floyd-Steinberg dithering, and transparent pixels
+// are left unpainted so the terminal background shows through.
+type SixelEncoder struct {
+	out io.Writer
+}
+
+func NewSixelEncoder(out io.Writer) *SixelEncoder {
+	return &SixelEncoder{out: out}
+}
+
+func (e *SixelEncoder) Encode(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	img, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	img = scaleToWidth(img, maxSixelWidth)
+
+	bounds := img.Bounds()
+	paletted := stdimage.NewPaletted(stdimage.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette.Plan9)
+	draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), img, bounds.Min)
+
+	opaque := func(x, y int) bool {
+		_, _, _, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+		return a >= 0x8000
+	}
+
+	w := bufio.NewWriter(e.out)
+	writeSixel(w, paletted, opaque)
+	return w.Flush()
+}
+
+// writeSixel encodes img band by band: each band covers six rows, and each
+// palette color used in the band is drawn as one run-length encoded pass.
+func writeSixel(w *bufio.Writer, img *stdimage.Paletted, opaque func(x, y int) bool) {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// P2=1 keeps pixels no color sets transparent.
+	fmt.Fprintf(w, "\x1bP0;1;0q\"1;1;%d;%d", width, height)
+
+	used := make([]bool, len(img.Palette))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if opaque(x, y) {
+				used[img.ColorIndexAt(x, y)] = true
+			}
+		}
+	}
+	for i, c := range img.Palette {
+		if !used[i] {
+			continue
+		}
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(w, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, b*100/0xffff)
+	}
+
+	rows := make([][]byte, len(img.Palette))
+	for top := 0; top < height; top += 6 {
+		var colors []int
+		for dy := 0; dy < 6 && top+dy < height; dy++ {
+			y := top + dy
+			for x := 0; x < width; x++ {
+				if !opaque(x, y) {
+					continue
+				}
+				idx := int(img.ColorIndexAt(x, y))
+				if rows[idx] == nil {
+					rows[idx] = make([]byte, width)
+					colors = append(colors, idx)
+				}
+				rows[idx][x] |= 1 << dy
+			}
+		}
+
+		for i, idx := range colors {
+			if i > 0 {
+				w.WriteByte('$')
+			}
+			fmt.Fprintf(w, "#%d", idx)
+			writeSixelRow(w, rows[idx])
+			rows[idx] = nil
+		}
+		w.WriteByte('-')
+	}
+
+	w.WriteString("\x1b\\")
+}
+
+// writeSixelRow writes one color pass of a band, collapsing repeats with
+// the "!count" prefix and dropping trailing empty columns.
+func writeSixelRow(w *bufio.Writer, row []byte) {
+	end := len(row)
+	for end > 0 && row[end-1] == 0 {
+		end--
+	}
+
+	for x := 0; x < end; {
+		run := 1
+		for x+run < end && row[x+run] == row[x] {
+			run++
+		}
+		ch := row[x] + '?'
+		if run > 3 {
+			fmt.Fprintf(w, "!%d%c", run, ch)
+		} else {
+			for range run {
+				w.WriteByte(ch)
+			}
+		}
+		x += run
+	}
+}
+
+// scaleToWidth shrinks img to maxWidth with nearest-neighbor sampling,
+// keeping its aspect ratio. Narrower images are returned unchanged.
+func scaleToWidth(img stdimage.Image, maxWidth int) stdimage.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= maxWidth {
+		return img
+	}
+	return resize(img, maxWidth, max(1, bounds.Dy()*maxWidth/bounds.Dx()))
+}
+
+// resize scales img to width x height with nearest-neighbor sampling.
+func resize(img stdimage.Image, width, height int) stdimage.Image {
+	bounds := img.Bounds()
+	scaled := stdimage.NewNRGBA(stdimage.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		sy := bounds.Min.Y + y*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			sx := bounds.Min.X + x*bounds.Dx()/width
+			scaled.Set(x, y, img.At(sx, sy))
+		}
+	}
+	return scaled
+}
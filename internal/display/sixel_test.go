@@ -0,0 +1,156 @@
+package display
+
+import (
+	"bytes"
+	stdimage "image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// fixturePNG encodes a w x h PNG whose left half is red and right half is
+// blue, with a fully transparent top-left pixel.
+func fixturePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	img.Set(0, 0, color.NRGBA{})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSixelEncoder_Encode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewSixelEncoder(&buf).Encode(fixturePNG(t, 8, 8)); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	out := buf.String()
+
+	if !strings.HasPrefix(out, "\x1bP0;1;0q\"1;1;8;8") {
+		t.Errorf("output should start with DCS and raster attributes, got %q", out[:min(len(out), 20)])
+	}
+	if !strings.HasSuffix(out, "\x1b\\") {
+		t.Error("output should end with the string terminator")
+	}
+
+	// Only pure red and pure blue are used, so exactly two colors are
+	// defined: 100% red and 100% blue in RGB percentages.
+	defs := regexp.MustCompile(`#\d+;2;(\d+);(\d+);(\d+)`).FindAllStringSubmatch(out, -1)
+	if len(defs) != 2 {
+		t.Fatalf("got %d color definitions, want 2: %q", len(defs), defs)
+	}
+	gotColors := map[string]bool{}
+	for _, d := range defs {
+		gotColors[d[1]+","+d[2]+","+d[3]] = true
+	}
+	if !gotColors["100,0,0"] || !gotColors["0,0,100"] {
+		t.Errorf("color definitions = %v, want red and blue", gotColors)
+	}
+
+	// 8 rows make two bands, each ending with "-".
+	body := out[strings.LastIndex(out, ";")+1:]
+	if n := strings.Count(body, "-"); n != 2 {
+		t.Errorf("got %d bands, want 2", n)
+	}
+}
+
+func TestSixelEncoder_Transparency(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewSixelEncoder(&buf).Encode(fixturePNG(t, 2, 1)); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	out := buf.String()
+
+	// The single-row image has a transparent left pixel and a blue right
+	// pixel, so the only pass is blue, skipping column 0 ("?" = no bits)
+	// and setting the top bit of column 1 ("@").
+	re := regexp.MustCompile(`#(\d+)\?@-`)
+	if !re.MatchString(out) {
+		t.Errorf("expected one pass with the transparent pixel left empty, got %q", out)
+	}
+	if strings.Contains(out, "$") {
+		t.Errorf("transparent pixels should not get a color pass: %q", out)
+	}
+}
+
+func TestSixelEncoder_RunLength(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewSixelEncoder(&buf).Encode(fixturePNG(t, 40, 6)); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	// 20 solid blue columns collapse into a single repeat.
+	if !strings.Contains(buf.String(), "!20~") {
+		t.Errorf("expected run-length encoded blue half, got %q", buf.String())
+	}
+}
+
+func TestSixelEncoder_ScalesWideImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewSixelEncoder(&buf).Encode(fixturePNG(t, maxSixelWidth*2, 10)); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	want := "\"1;1;800;5"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("expected raster attributes %q for a downscaled image", want)
+	}
+}
+
+func TestSixelEncoder_Errors(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewSixelEncoder(&buf)
+
+	if err := enc.Encode(nil); err != nil || buf.Len() != 0 {
+		t.Errorf("empty input: err = %v, output %q", err, buf.String())
+	}
+	if err := enc.Encode([]byte("not an image")); err == nil {
+		t.Error("expected decode error")
+	}
+}
+
+func TestHasSixelAttribute(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  bool
+	}{
+		{"\x1b[?62;4;22c", true},
+		{"\x1b[?64;1;2;4;6;9;15;18;21;22c", true},
+		{"\x1b[?62;22c", false},
+		{"\x1b[?1;2c", false},
+		{"\x1b[?62;44c", false},
+		{"", false},
+		{"garbage\x1b[?4", false},
+	}
+	for _, tt := range tests {
+		if got := hasSixelAttribute(tt.reply); got != tt.want {
+			t.Errorf("hasSixelAttribute(%q) = %v, want %v", tt.reply, got, tt.want)
+		}
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	for in, want := range map[string]Protocol{"": ProtocolAuto, "auto": ProtocolAuto, "kitty": ProtocolKitty, "Sixel": ProtocolSixel, "iterm2": ProtocolITerm2} {
+		got, err := ParseProtocol(in)
+		if err != nil || got != want {
+			t.Errorf("ParseProtocol(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseProtocol("braille"); err == nil {
+		t.Error("ParseProtocol(braille) should fail")
+	}
+}
@@ -0,0 +1,193 @@
+// Package doctor runs the setup checks behind `imggen doctor`. Each check
+// takes its dependencies as arguments so failures can be injected in tests.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/manash/imggen/internal/display"
+	"github.com/manash/imggen/internal/keys"
+)
+
+// Result is the outcome of one check. Hint says how to fix a failed check.
+// A failed Critical check means imggen cannot generate images.
+type Result struct {
+	Name     string
+	OK       bool
+	Critical bool
+	Detail   string
+	Hint     string
+}
+
+// KeyResolver returns an API key and where it was found, in the order
+// generation uses.
+type KeyResolver func() (key, source string, err error)
+
+// APIKey checks that resolve finds a key, reporting its source and a masked
+// value. envVar names the environment variable resolve falls back to.
+func APIKey(resolve KeyResolver, envVar string) Result {
+	r := Result{Name: "API key", Critical: true}
+	key, source, err := resolve()
+	if err != nil {
+		r.Detail = "no key from --api-key, the key store, or " + envVar
+		r.Hint = fmt.Sprintf("run 'imggen keys set', pass --api-key, or export %s", envVar)
+		return r
+	}
+	r.OK = true
+	r.Detail = fmt.Sprintf("%s (%s)", keys.MaskKey(key), source)
+	return r
+}
+
+// DataDir checks that dir, where imggen keeps its database and settings,
+// is a writable directory that other users cannot write to. A directory
+// that does not exist yet passes; it is created on first use.
+func DataDir(dir string) Result {
+	r := Result{Name: "Data directory", Critical: true}
+	info, err := os.Stat(dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		r.OK = true
+		r.Detail = dir + " does not exist yet and will be created on first use"
+		return r
+	case err != nil:
+		r.Detail = err.Error()
+		r.Hint = "check that your home directory is readable"
+		return r
+	case !info.IsDir():
+		r.Detail = dir + " is not a directory"
+		r.Hint = fmt.Sprintf("move %s aside so imggen can create its directory", dir)
+		return r
+	}
+
+	if err := probeWrite(dir); err != nil {
+		r.Detail = dir + " is not writable: " + err.Error()
+		r.Hint = fmt.Sprintf("chmod u+rwx %s, or check that you own it", dir)
+		return r
+	}
+	if perm := info.Mode().Perm(); perm&0o022 != 0 {
+		r.Critical = false
+		r.Detail = fmt.Sprintf("%s is writable by other users (%04o)", dir, perm)
+		r.Hint = fmt.Sprintf("chmod go-w %s", dir)
+		return r
+	}
+	r.OK = true
+	r.Detail = dir
+	return r
+}
+
+// Database checks that the session database at path can be opened for
+// writing, or created if it does not exist.
+func Database(path string) Result {
+	r := Result{Name: "Database", Critical: true}
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		dir := existingParent(filepath.Dir(path))
+		if err := probeWrite(dir); err != nil {
+			r.Detail = fmt.Sprintf("%s cannot be created: %v", path, err)
+			r.Hint = fmt.Sprintf("make %s writable", dir)
+			return r
+		}
+		r.OK = true
+		r.Detail = path + " will be created on first use"
+		return r
+	case err != nil:
+		r.Detail = err.Error()
+		r.Hint = fmt.Sprintf("check the permissions of %s", filepath.Dir(path))
+		return r
+	case info.IsDir():
+		r.Detail = path + " is a directory"
+		r.Hint = fmt.Sprintf("move %s aside; imggen will create a new database", path)
+		return r
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		r.Detail = fmt.Sprintf("%s is not writable: %v", path, err)
+		r.Hint = fmt.Sprintf("chmod u+rw %s, or run 'imggen db reset --backup'", path)
+		return r
+	}
+	f.Close()
+	r.OK = true
+	r.Detail = path
+	return r
+}
+
+// Terminal checks whether the terminal can show images inline for --show
+// and interactive mode. Images are still saved without it, so this check is
+// not critical.
+func Terminal(detect func() (display.Protocol, bool)) Result {
+	r := Result{Name: "Terminal graphics"}
+	p, ok := detect()
+	if !ok {
+		r.Detail = "no Kitty, iTerm2, or sixel support detected"
+		r.Hint = "use a terminal with inline images (Kitty, WezTerm, iTerm2, or a sixel terminal) for --show, or force one with --show-protocol"
+		return r
+	}
+	r.OK = true
+	r.Detail = string(p) + " protocol"
+	return r
+}
+
+// Connectivity checks that baseURL answers HTTP requests. No API key is
+// sent, so an authentication error still counts as reachable.
+func Connectivity(ctx context.Context, client *http.Client, baseURL string) Result {
+	r := Result{Name: "Connectivity", Critical: true}
+	url := strings.TrimSuffix(baseURL, "/") + "/models"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		r.Detail = err.Error()
+		r.Hint = "check --base-url or base_url in the config file"
+		return r
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		r.Detail = fmt.Sprintf("%s is unreachable: %v", baseURL, err)
+		r.Hint = "check your network connection and proxy settings, or --base-url"
+		return r
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		r.Detail = fmt.Sprintf("%s answered with status %d", baseURL, resp.StatusCode)
+		r.Hint = "the API may be having an outage; try again later"
+		return r
+	}
+	r.OK = true
+	r.Detail = fmt.Sprintf("%s reachable (status %d)", baseURL, resp.StatusCode)
+	return r
+}
+
+// probeWrite creates and removes a temporary file in dir.
+func probeWrite(dir string) error {
+	f, err := os.CreateTemp(dir, ".imggen-doctor-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// existingParent returns dir or its nearest ancestor that exists.
+func existingParent(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
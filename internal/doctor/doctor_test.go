@@ -0,0 +1,135 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/manash/imggen/internal/display"
+)
+
+func TestAPIKey(t *testing.T) {
+	r := APIKey(func() (string, string, error) {
+		return "sk-abcdefghijklmnop", "stored key for openai", nil
+	}, "OPENAI_API_KEY")
+	if !r.OK || !strings.Contains(r.Detail, "stored key for openai") {
+		t.Errorf("APIKey() = %+v, want OK with the key's source", r)
+	}
+	if strings.Contains(r.Detail, "abcdefghijkl") {
+		t.Errorf("APIKey() detail %q shows the key unmasked", r.Detail)
+	}
+
+	r = APIKey(func() (string, string, error) {
+		return "", "", errors.New("API key required")
+	}, "OPENAI_API_KEY")
+	if r.OK || !r.Critical || !strings.Contains(r.Hint, "imggen keys set") {
+		t.Errorf("APIKey() with no key = %+v, want a critical failure with a hint", r)
+	}
+}
+
+func TestDataDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if r := DataDir(dir); !r.OK {
+		t.Errorf("DataDir(private dir) = %+v, want OK", r)
+	}
+
+	if r := DataDir(filepath.Join(dir, "missing")); !r.OK {
+		t.Errorf("DataDir(missing) = %+v, want OK (created on first use)", r)
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if r := DataDir(file); r.OK || !r.Critical {
+		t.Errorf("DataDir(file) = %+v, want a critical failure", r)
+	}
+
+	shared := filepath.Join(dir, "shared")
+	if err := os.Mkdir(shared, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(shared, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if r := DataDir(shared); r.OK || r.Critical || !strings.Contains(r.Hint, "chmod go-w") {
+		t.Errorf("DataDir(world-writable) = %+v, want a non-critical failure", r)
+	}
+}
+
+func TestDatabase(t *testing.T) {
+	dir := t.TempDir()
+
+	if r := Database(filepath.Join(dir, "new.db")); !r.OK {
+		t.Errorf("Database(new) = %+v, want OK", r)
+	}
+
+	existing := filepath.Join(dir, "sessions.db")
+	if err := os.WriteFile(existing, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if r := Database(existing); !r.OK {
+		t.Errorf("Database(existing) = %+v, want OK", r)
+	}
+
+	if r := Database(dir); r.OK || !r.Critical {
+		t.Errorf("Database(directory) = %+v, want a critical failure", r)
+	}
+
+	// A parent path that is a file can never hold the database.
+	if r := Database(filepath.Join(existing, "sub", "sessions.db")); r.OK || !r.Critical {
+		t.Errorf("Database(under a file) = %+v, want a critical failure", r)
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	r := Terminal(func() (display.Protocol, bool) { return display.ProtocolKitty, true })
+	if !r.OK || !strings.Contains(r.Detail, "kitty") {
+		t.Errorf("Terminal(kitty) = %+v, want OK naming the protocol", r)
+	}
+
+	r = Terminal(func() (display.Protocol, bool) { return display.ProtocolNone, false })
+	if r.OK || r.Critical || r.Hint == "" {
+		t.Errorf("Terminal(none) = %+v, want a non-critical failure with a hint", r)
+	}
+}
+
+func TestConnectivity(t *testing.T) {
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		if r.URL.Path == "/down/models" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	if r := Connectivity(ctx, server.Client(), server.URL+"/v1/"); !r.OK {
+		t.Errorf("Connectivity() = %+v, want OK for a 401", r)
+	}
+	if gotAuth != "" {
+		t.Errorf("Connectivity() sent Authorization %q, want none", gotAuth)
+	}
+
+	if r := Connectivity(ctx, server.Client(), server.URL+"/down"); r.OK || !r.Critical {
+		t.Errorf("Connectivity() = %+v, want a failure for a 503", r)
+	}
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	url := unreachable.URL
+	unreachable.Close()
+	if r := Connectivity(ctx, http.DefaultClient, url); r.OK || !strings.Contains(r.Hint, "network") {
+		t.Errorf("Connectivity(closed server) = %+v, want a network failure", r)
+	}
+}
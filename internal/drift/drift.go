@@ -0,0 +1,55 @@
+// Package drift measures how far a rewritten prompt has moved from the
+// original, for catching models that silently rewrite prompts.
+package drift
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopwords are ignored when comparing prompts; rewrites add and drop them
+// freely without changing what is depicted.
+var stopwords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "of": true,
+	"in": true, "on": true, "at": true, "to": true, "with": true, "for": true,
+	"is": true, "are": true, "its": true, "it": true, "by": true, "as": true,
+}
+
+// Tokens splits s into the set of lowercase words it contains, skipping
+// punctuation and stopwords.
+func Tokens(s string) map[string]bool {
+	tokens := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if !stopwords[w] {
+			tokens[w] = true
+		}
+	}
+	return tokens
+}
+
+// Similarity returns the token overlap of two prompts as the Dice
+// coefficient of their word sets: 1 when they use the same words, 0 when
+// they share none. Two prompts without any words are identical.
+func Similarity(a, b string) float64 {
+	ta, tb := Tokens(a), Tokens(b)
+	if len(ta)+len(tb) == 0 {
+		return 1
+	}
+
+	shared := 0
+	for w := range ta {
+		if tb[w] {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(ta)+len(tb))
+}
+
+// Score returns how far revised has drifted from original, from 0 (same
+// words) to 1 (nothing in common).
+func Score(original, revised string) float64 {
+	return 1 - Similarity(original, revised)
+}
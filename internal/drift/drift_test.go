@@ -0,0 +1,40 @@
+package drift
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name             string
+		original         string
+		revised          string
+		wantMin, wantMax float64
+	}{
+		{"identical", "a red fox in the snow", "a red fox in the snow", 0, 0},
+		{"case and punctuation", "A red fox, in the snow.", "a RED fox in the snow", 0, 0},
+		{"stopwords only differ", "red fox in snow", "a red fox in the snow", 0, 0},
+		{"near identical", "a red fox in the snow", "a red fox standing in the snow", 0.05, 0.25},
+		{"expanded rewrite", "a red fox in the snow", "A photorealistic image of a red fox sitting in fresh snow at dawn", 0.3, 0.7},
+		{"very different", "a red fox in the snow", "an astronaut riding a horse on mars", 1, 1},
+		{"both empty", "", "", 0, 0},
+		{"revised empty", "a red fox", "", 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Score(tt.original, tt.revised)
+			if got < tt.wantMin-1e-9 || got > tt.wantMax+1e-9 {
+				t.Errorf("Score() = %.3f, want between %.2f and %.2f", got, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestSimilarity_Symmetric(t *testing.T) {
+	a, b := "a cat playing piano", "a dog playing a grand piano"
+	if math.Abs(Similarity(a, b)-Similarity(b, a)) > 1e-9 {
+		t.Error("Similarity should not depend on argument order")
+	}
+}
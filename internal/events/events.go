@@ -0,0 +1,155 @@
+// Package events appends one JSON line per API operation to a log file for
+// later analysis.
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// Operations recorded in the event log.
+const (
+	OpGenerate = "generate"
+	OpEdit     = "edit"
+	OpOCR      = "ocr"
+)
+
+// PromptMode controls how prompts are written to the log.
+type PromptMode string
+
+const (
+	// PromptHash stores a SHA-256 of the prompt, so identical prompts can
+	// be grouped without keeping their text. This is the default.
+	PromptHash PromptMode = "hash"
+	// PromptPlain stores the prompt text.
+	PromptPlain PromptMode = "plain"
+	// PromptOmit stores nothing about the prompt.
+	PromptOmit PromptMode = "omit"
+)
+
+// ParsePromptMode validates a prompt mode name. An empty name selects
+// PromptHash.
+func ParsePromptMode(s string) (PromptMode, error) {
+	switch PromptMode(s) {
+	case "", PromptHash:
+		return PromptHash, nil
+	case PromptPlain, PromptOmit:
+		return PromptMode(s), nil
+	default:
+		return "", fmt.Errorf("invalid prompt mode %q: must be hash, plain, or omit", s)
+	}
+}
+
+// Event is one line of the event log. Duration is in seconds.
+type Event struct {
+	TS         time.Time `json:"ts"`
+	Op         string    `json:"op"`
+	Model      string    `json:"model"`
+	Size       string    `json:"size,omitempty"`
+	Quality    string    `json:"quality,omitempty"`
+	PromptHash string    `json:"prompt_hash,omitempty"`
+	Prompt     string    `json:"prompt,omitempty"`
+	Cost       float64   `json:"cost"`
+	Success    bool      `json:"success"`
+	Duration   float64   `json:"duration"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Logger appends events to a JSONL file. A nil Logger discards events, so
+// callers can log unconditionally. It is safe for concurrent use.
+type Logger struct {
+	mu         sync.Mutex
+	path       string
+	promptMode PromptMode
+}
+
+// NewLogger returns a Logger that appends to path, or nil when path is
+// empty.
+func NewLogger(path string, mode PromptMode) *Logger {
+	if path == "" {
+		return nil
+	}
+	if mode == "" {
+		mode = PromptHash
+	}
+	return &Logger{path: path, promptMode: mode}
+}
+
+// HashPrompt returns the hex SHA-256 of prompt.
+func HashPrompt(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// Log records an operation. prompt is hashed, kept, or dropped according
+// to the logger's prompt mode; err marks the operation as failed.
+func (l *Logger) Log(e Event, prompt string, err error) error {
+	if l == nil {
+		return nil
+	}
+
+	if e.TS.IsZero() {
+		e.TS = time.Now()
+	}
+	e.TS = e.TS.UTC()
+	e.Success = err == nil
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	switch l.promptMode {
+	case PromptPlain:
+		e.Prompt = prompt
+	case PromptHash:
+		e.PromptHash = HashPrompt(prompt)
+	}
+
+	line, jsonErr := json.Marshal(e)
+	if jsonErr != nil {
+		return fmt.Errorf("failed to encode event: %w", jsonErr)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create event log directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write event log: %w", err)
+	}
+	return nil
+}
+
+// Record logs e for an API call that started at start, filling in its time,
+// duration, and the cost from costInfo, which may be nil. The event log is
+// for analysis only, so a write failure is printed to warn as a warning
+// rather than returned.
+func (l *Logger) Record(warn io.Writer, e Event, prompt string, costInfo *models.CostInfo, start time.Time, err error) {
+	if l == nil {
+		return
+	}
+	e.TS = start
+	e.Duration = time.Since(start).Seconds()
+	if costInfo != nil {
+		e.Cost = costInfo.Total
+	}
+	if logErr := l.Log(e, prompt, err); logErr != nil {
+		fmt.Fprintf(warn, "Warning: %v\n", logErr)
+	}
+}
@@ -0,0 +1,191 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// readLines parses every line of the log at path as an Event, failing the
+// test on any line that is not a complete JSON object.
+func readLines(t *testing.T, path string) []Event {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open event log: %v", err)
+	}
+	defer f.Close()
+
+	var got []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("line %d is not a valid event: %v: %s", len(got)+1, err, scanner.Text())
+		}
+		got = append(got, e)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestLogger_Log(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "events.jsonl")
+	l := NewLogger(path, PromptHash)
+
+	ts := time.Date(2025, 6, 1, 12, 0, 0, 0, time.FixedZone("X", 3600))
+	if err := l.Log(Event{TS: ts, Op: OpGenerate, Model: "dall-e-3", Size: "1024x1024", Quality: "hd", Cost: 0.08, Duration: 1.5}, "a cat", nil); err != nil {
+		t.Fatalf("Log() error = %v", err)
+	}
+	if err := l.Log(Event{Op: OpOCR, Model: "gpt-5-mini"}, "read it", errors.New("boom")); err != nil {
+		t.Fatalf("Log() error = %v", err)
+	}
+
+	got := readLines(t, path)
+	if len(got) != 2 {
+		t.Fatalf("got %d lines, want 2", len(got))
+	}
+
+	first := got[0]
+	if !first.TS.Equal(ts) || first.TS.Location() != time.UTC {
+		t.Errorf("TS = %v, want %v in UTC", first.TS, ts)
+	}
+	if first.Op != OpGenerate || first.Model != "dall-e-3" || first.Size != "1024x1024" || first.Quality != "hd" {
+		t.Errorf("first event = %+v", first)
+	}
+	if !first.Success || first.Error != "" || first.Cost != 0.08 || first.Duration != 1.5 {
+		t.Errorf("first event = %+v, want success with cost and duration", first)
+	}
+	if first.PromptHash != HashPrompt("a cat") || first.Prompt != "" {
+		t.Errorf("first event prompt fields = %q/%q, want hash only", first.PromptHash, first.Prompt)
+	}
+
+	second := got[1]
+	if second.Success || second.Error != "boom" {
+		t.Errorf("second event = %+v, want failure", second)
+	}
+	if second.TS.IsZero() {
+		t.Error("zero TS should be filled in")
+	}
+}
+
+func TestLogger_PromptModes(t *testing.T) {
+	tests := []struct {
+		mode       PromptMode
+		wantPrompt string
+		wantHash   string
+	}{
+		{PromptHash, "", HashPrompt("secret plans")},
+		{PromptPlain, "secret plans", ""},
+		{PromptOmit, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "events.jsonl")
+			if err := NewLogger(path, tt.mode).Log(Event{Op: OpEdit}, "secret plans", nil); err != nil {
+				t.Fatal(err)
+			}
+			got := readLines(t, path)[0]
+			if got.Prompt != tt.wantPrompt || got.PromptHash != tt.wantHash {
+				t.Errorf("prompt = %q, hash = %q; want %q, %q", got.Prompt, got.PromptHash, tt.wantPrompt, tt.wantHash)
+			}
+		})
+	}
+}
+
+func TestLogger_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l := NewLogger(path, PromptHash)
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Log(Event{Op: OpGenerate}, fmt.Sprintf("prompt %d", i), nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := readLines(t, path); len(got) != n {
+		t.Errorf("got %d lines, want %d", len(got), n)
+	}
+}
+
+func TestLogger_Nil(t *testing.T) {
+	l := NewLogger("", PromptHash)
+	if l != nil {
+		t.Fatal("NewLogger(\"\") should return nil")
+	}
+	if err := l.Log(Event{Op: OpGenerate}, "a cat", nil); err != nil {
+		t.Errorf("nil Logger Log() error = %v", err)
+	}
+}
+
+func TestLogger_Record(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l := NewLogger(path, PromptOmit)
+
+	start := time.Now().Add(-2 * time.Second)
+	var warn bytes.Buffer
+	l.Record(&warn, Event{Op: OpEdit, Model: "gpt-image-1"}, "a cat", &models.CostInfo{Total: 0.04}, start, nil)
+	l.Record(&warn, Event{Op: OpEdit, Model: "gpt-image-1"}, "a cat", nil, start, errors.New("boom"))
+	if warn.Len() != 0 {
+		t.Errorf("unexpected warning: %s", warn.String())
+	}
+
+	got := readLines(t, path)
+	if len(got) != 2 {
+		t.Fatalf("got %d lines, want 2", len(got))
+	}
+	if !got[0].TS.Equal(start) || got[0].Duration < 2 || got[0].Cost != 0.04 || !got[0].Success {
+		t.Errorf("first event = %+v, want start time, duration >= 2s, cost 0.04, success", got[0])
+	}
+	if got[1].Cost != 0 || got[1].Success || got[1].Error != "boom" {
+		t.Errorf("second event = %+v, want failed with no cost", got[1])
+	}
+
+	// A log that cannot be written is a warning, not an error.
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	NewLogger(filepath.Join(blocker, "events.jsonl"), PromptHash).Record(&warn, Event{Op: OpGenerate}, "a cat", nil, start, nil)
+	if !strings.HasPrefix(warn.String(), "Warning: ") {
+		t.Errorf("warning = %q, want a Warning: line", warn.String())
+	}
+
+	var nilLogger *Logger
+	nilLogger.Record(&warn, Event{Op: OpGenerate}, "a cat", nil, start, nil)
+}
+
+func TestParsePromptMode(t *testing.T) {
+	for in, want := range map[string]PromptMode{"": PromptHash, "hash": PromptHash, "plain": PromptPlain, "omit": PromptOmit} {
+		got, err := ParsePromptMode(in)
+		if err != nil || got != want {
+			t.Errorf("ParsePromptMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParsePromptMode("encrypt"); err == nil {
+		t.Error("ParsePromptMode(encrypt) should fail")
+	}
+}
@@ -0,0 +1,57 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+)
+
+var (
+	ErrNoFrames   = errors.New("at least one frame is required")
+	ErrInvalidFPS = errors.New("fps must be between 1 and 100")
+)
+
+// AssembleGIF decodes the given frames and encodes them as a looping GIF
+// played back at fps frames per second. Frames are placed on a canvas the
+// size of the first frame and quantized to the Plan 9 palette.
+func AssembleGIF(frames [][]byte, fps int) ([]byte, error) {
+	if len(frames) == 0 {
+		return nil, ErrNoFrames
+	}
+	if fps < 1 || fps > 100 {
+		return nil, ErrInvalidFPS
+	}
+
+	// GIF delays are expressed in hundredths of a second.
+	delay := 100 / fps
+
+	anim := &gif.GIF{LoopCount: 0}
+	var bounds stdimage.Rectangle
+
+	for i, data := range frames {
+		img, _, err := stdimage.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode frame %d: %w", i+1, err)
+		}
+
+		if i == 0 {
+			bounds = stdimage.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy())
+		}
+
+		paletted := stdimage.NewPaletted(bounds, palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, bounds, img, img.Bounds().Min)
+
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, delay)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return nil, fmt.Errorf("failed to encode gif: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"image/gif"
+	"testing"
+)
+
+func TestAssembleGIF(t *testing.T) {
+	frames := [][]byte{encodeTestPNG(t, 255), encodeTestPNG(t, 255)}
+
+	data, err := AssembleGIF(frames, 4)
+	if err != nil {
+		t.Fatalf("AssembleGIF() error = %v", err)
+	}
+
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("gif.DecodeAll() error = %v", err)
+	}
+
+	if len(anim.Image) != 2 {
+		t.Errorf("frame count = %d, want 2", len(anim.Image))
+	}
+	for i, d := range anim.Delay {
+		if d != 25 {
+			t.Errorf("frame %d delay = %d, want 25 (4 fps)", i, d)
+		}
+	}
+	if anim.LoopCount != 0 {
+		t.Errorf("LoopCount = %d, want 0 (loop forever)", anim.LoopCount)
+	}
+}
+
+func TestAssembleGIF_Errors(t *testing.T) {
+	frame := encodeTestPNG(t, 255)
+
+	tests := []struct {
+		name    string
+		frames  [][]byte
+		fps     int
+		wantErr error
+	}{
+		{"no frames", nil, 4, ErrNoFrames},
+		{"zero fps", [][]byte{frame}, 0, ErrInvalidFPS},
+		{"fps too high", [][]byte{frame}, 101, ErrInvalidFPS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := AssembleGIF(tt.frames, tt.fps)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("AssembleGIF() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAssembleGIF_InvalidFrame(t *testing.T) {
+	_, err := AssembleGIF([][]byte{[]byte("not an image")}, 4)
+	if err == nil {
+		t.Fatal("AssembleGIF() error = nil, want decode error")
+	}
+}
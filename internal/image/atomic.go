@@ -0,0 +1,55 @@
+package image
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes everything read from r to path through a temporary
+// file in the same directory, renaming it into place only once the write
+// has succeeded. A failed or canceled write removes the temporary file, so
+// path is either left untouched or holds the complete contents.
+func writeFileAtomic(ctx context.Context, path string, r io.Reader) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = io.Copy(tmp, &ctxReader{ctx: ctx, r: r}); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp opens the file 0600; saved images are meant to be shared.
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ctxReader stops reading once ctx is canceled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	select {
+	case <-c.ctx.Done():
+		return 0, c.ctx.Err()
+	default:
+		return c.r.Read(p)
+	}
+}
@@ -0,0 +1,118 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// failingReader returns data and then err, simulating a write that breaks
+// part way through.
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if len(f.data) == 0 {
+		return 0, f.err
+	}
+	n := copy(p, f.data)
+	f.data = f.data[n:]
+	return n, nil
+}
+
+func assertOnlyFiles(t *testing.T, dir string, want ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if len(got) != len(want) {
+		t.Fatalf("directory holds %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("directory holds %v, want %v", got, want)
+		}
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.png")
+
+	if err := writeFileAtomic(context.Background(), path, bytes.NewReader([]byte("complete"))); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "complete" {
+		t.Fatalf("file = %q, %v; want the full contents", data, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0644 {
+		t.Errorf("permissions = %o, want 644", perm)
+	}
+	assertOnlyFiles(t, dir, "out.png")
+}
+
+func TestWriteFileAtomic_FailureMidStreamLeavesNoPartialFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.png")
+	injected := errors.New("disk on fire")
+
+	r := &failingReader{data: bytes.Repeat([]byte("x"), 64<<10), err: injected}
+	err := writeFileAtomic(context.Background(), path, r)
+	if !errors.Is(err, injected) {
+		t.Fatalf("writeFileAtomic() error = %v, want the injected error", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("target should not exist after a failed write, stat error = %v", err)
+	}
+	assertOnlyFiles(t, dir)
+}
+
+func TestWriteFileAtomic_FailureKeepsExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.png")
+	if err := os.WriteFile(path, []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &failingReader{data: []byte("partial"), err: io.ErrUnexpectedEOF}
+	if err := writeFileAtomic(context.Background(), path, r); err == nil {
+		t.Fatal("writeFileAtomic() expected error")
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "previous" {
+		t.Errorf("existing file = %q, want it untouched", data)
+	}
+	assertOnlyFiles(t, dir, "out.png")
+}
+
+func TestWriteFileAtomic_Canceled(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.png")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := writeFileAtomic(ctx, path, bytes.NewReader([]byte("data")))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("writeFileAtomic() error = %v, want context.Canceled", err)
+	}
+	assertOnlyFiles(t, dir)
+}
@@ -0,0 +1,490 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// exifHeader prefixes EXIF data in JPEG APP1 segments, and sometimes in
+// WebP EXIF chunks.
+var exifHeader = []byte("Exif\x00\x00")
+
+// ErrMalformedEXIF is returned for EXIF data that is not a TIFF structure.
+var ErrMalformedEXIF = errors.New("malformed exif data")
+
+// tagOrientation is the TIFF tag that tells viewers how to rotate an image.
+const tagOrientation = 0x0112
+
+// ReadEXIF returns the raw EXIF (TIFF) data embedded in a PNG, JPEG, or WebP
+// image, or nil if it has none.
+func ReadEXIF(data []byte) ([]byte, error) {
+	var exif []byte
+	var err error
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		exif, err = readPNGEXIF(data)
+	case DetectFormat(data) == models.FormatJPEG:
+		exif, err = readJPEGEXIF(data)
+	case DetectFormat(data) == models.FormatWebP:
+		exif, err = readWebPEXIF(data)
+	default:
+		return nil, errors.New("unsupported image format: expected png, jpeg, or webp")
+	}
+	if err != nil || exif == nil {
+		return nil, err
+	}
+	if !isTIFF(exif) {
+		return nil, ErrMalformedEXIF
+	}
+	return exif, nil
+}
+
+// WriteEXIF embeds exif, as returned by ReadEXIF, in a PNG, JPEG, or WebP
+// image, replacing any EXIF it already has. Only the first IFD and its Exif
+// and GPS IFDs are copied: the IFD1 thumbnail, maker notes, and other
+// embedded image data would carry a preview of the image exif came from.
+// The orientation tag is reset to normal because the pixels it describes
+// are already upright.
+func WriteEXIF(data, exif []byte) ([]byte, error) {
+	if !isTIFF(exif) {
+		return nil, ErrMalformedEXIF
+	}
+	exif, err := copyableEXIF(exif)
+	if err != nil {
+		return nil, err
+	}
+	exif = resetOrientation(exif)
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		return writePNGEXIF(data, exif)
+	case DetectFormat(data) == models.FormatJPEG:
+		return writeJPEGEXIF(data, exif)
+	case DetectFormat(data) == models.FormatWebP:
+		return writeWebPEXIF(data, exif)
+	default:
+		return nil, errors.New("unsupported image format: expected png, jpeg, or webp")
+	}
+}
+
+// Tags dropped when EXIF is copied: pointers to image data, which can hold
+// a preview of the source image, and the interoperability IFD.
+var droppedEXIFTags = map[uint16]bool{
+	0x0111: true, // StripOffsets
+	0x0117: true, // StripByteCounts
+	0x0144: true, // TileOffsets
+	0x0145: true, // TileByteCounts
+	0x014A: true, // SubIFDs
+	0x0201: true, // JPEGInterchangeFormat
+	0x0202: true, // JPEGInterchangeFormatLength
+	0x927C: true, // MakerNote
+	0xA005: true, // InteroperabilityIFD
+}
+
+// tagGPSIFD points to the GPS IFD, as tagExifIFD does to the Exif IFD.
+const tagGPSIFD = 0x8825
+
+// tiffTypeSizes maps each TIFF field type to the size of one value.
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// tiffEntry is an IFD entry with its value, or with the entries of the IFD
+// it points to when ifd is set.
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+	ifd   bool
+	sub   []tiffEntry
+}
+
+// copyableEXIF rebuilds exif from its first IFD and the Exif and GPS IFDs
+// that IFD points to, leaving out IFD1 and droppedEXIFTags.
+func copyableEXIF(exif []byte) ([]byte, error) {
+	if len(exif) < 8 {
+		return nil, ErrMalformedEXIF
+	}
+	order := tiffByteOrder(exif)
+	entries, err := readIFD(exif, order, int(order.Uint32(exif[4:])), true)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 8)
+	copy(out, exif[:4])
+	order.PutUint32(out[4:], 8)
+	return appendIFD(out, order, entries), nil
+}
+
+// readIFD returns the entries of the IFD at off, with their values. In the
+// first IFD, the Exif and GPS pointers are followed.
+func readIFD(exif []byte, order binary.ByteOrder, off int, first bool) ([]tiffEntry, error) {
+	if off < 8 || off+2 > len(exif) {
+		return nil, ErrMalformedEXIF
+	}
+	count := int(order.Uint16(exif[off:]))
+	if off+2+count*12 > len(exif) {
+		return nil, ErrMalformedEXIF
+	}
+
+	var entries []tiffEntry
+	for i := range count {
+		field := exif[off+2+i*12:]
+		tag, typ, n := order.Uint16(field), order.Uint16(field[2:]), order.Uint32(field[4:])
+		size, ok := tiffTypeSizes[typ]
+		if !ok || droppedEXIFTags[tag] {
+			continue
+		}
+		if tag == tagExifIFD || tag == tagGPSIFD {
+			if !first {
+				continue
+			}
+			sub, err := readIFD(exif, order, int(order.Uint32(field[8:])), false)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, tiffEntry{tag: tag, typ: 4, count: 1, ifd: true, sub: sub})
+			continue
+		}
+
+		length := int(n) * size
+		value := field[8:12]
+		if length > 4 {
+			start := int(order.Uint32(field[8:]))
+			if start+length > len(exif) {
+				return nil, ErrMalformedEXIF
+			}
+			value = exif[start : start+length]
+		}
+		entries = append(entries, tiffEntry{tag: tag, typ: typ, count: n, value: value[:length]})
+	}
+	return entries, nil
+}
+
+// appendIFD appends an IFD holding entries and no next IFD, followed by the
+// values that do not fit in an entry and the IFDs entries point to.
+func appendIFD(b []byte, order binary.ByteOrder, entries []tiffEntry) []byte {
+	start := len(b)
+	b = append(b, make([]byte, 2+len(entries)*12+4)...)
+	order.PutUint16(b[start:], uint16(len(entries)))
+	for i, e := range entries {
+		field := start + 2 + i*12
+		order.PutUint16(b[field:], e.tag)
+		order.PutUint16(b[field+2:], e.typ)
+		order.PutUint32(b[field+4:], e.count)
+		switch {
+		case e.ifd:
+			order.PutUint32(b[field+8:], uint32(len(b)))
+			b = appendIFD(b, order, e.sub)
+		case len(e.value) <= 4:
+			copy(b[field+8:field+12], e.value)
+		default:
+			order.PutUint32(b[field+8:], uint32(len(b)))
+			b = append(b, e.value...)
+			// Offsets must be word aligned.
+			if len(b)%2 == 1 {
+				b = append(b, 0)
+			}
+		}
+	}
+	return b
+}
+
+func isTIFF(exif []byte) bool {
+	return bytes.HasPrefix(exif, []byte("II*\x00")) || bytes.HasPrefix(exif, []byte("MM\x00*"))
+}
+
+// resetOrientation returns a copy of exif whose orientation tag, if any, is
+// set to 1 (normal).
+func resetOrientation(exif []byte) []byte {
+	exif = bytes.Clone(exif)
+	if off := orientationOffset(exif); off >= 0 {
+		order := tiffByteOrder(exif)
+		order.PutUint16(exif[off:], 1)
+	}
+	return exif
+}
+
+func tiffByteOrder(exif []byte) binary.ByteOrder {
+	if exif[0] == 'I' {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// orientationOffset returns the offset of the orientation value in the first
+// IFD of exif, or -1 if there is none.
+func orientationOffset(exif []byte) int {
+	if len(exif) < 8 {
+		return -1
+	}
+	order := tiffByteOrder(exif)
+	ifd := int(order.Uint32(exif[4:]))
+	if ifd < 8 || ifd+2 > len(exif) {
+		return -1
+	}
+	count := int(order.Uint16(exif[ifd:]))
+	for i := range count {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(exif) {
+			return -1
+		}
+		// Orientation is a single SHORT stored inline in the value field.
+		if order.Uint16(exif[entry:]) == tagOrientation && order.Uint16(exif[entry+2:]) == 3 {
+			return entry + 8
+		}
+	}
+	return -1
+}
+
+func readPNGEXIF(data []byte) ([]byte, error) {
+	var exif []byte
+	seenIDAT := false
+	err := walkPNGChunks(data, func(name string, _, payload []byte) {
+		switch name {
+		case "eXIf":
+			// eXIf must come before the image data.
+			if exif == nil && !seenIDAT {
+				exif = bytes.Clone(payload)
+			}
+		case "IDAT":
+			seenIDAT = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exif, nil
+}
+
+// writePNGEXIF drops any eXIf chunk and adds exif right after IHDR.
+func writePNGEXIF(data, exif []byte) ([]byte, error) {
+	return rewritePNG(data, func(name string, _ []byte) bool {
+		return name == "eXIf"
+	}, func(out *bytes.Buffer) {
+		writePNGChunk(out, "eXIf", exif)
+	})
+}
+
+// jpegSegment is a marker segment before the start of scan, with its
+// payload excluding the marker and length.
+type jpegSegment struct {
+	marker  byte
+	start   int
+	end     int
+	payload []byte
+}
+
+// jpegHeaderSegments returns the segments between SOI and the start of
+// scan, and the offset where the scan begins.
+func jpegHeaderSegments(data []byte) ([]jpegSegment, int, error) {
+	var segments []jpegSegment
+	pos := 2
+	for pos < len(data) {
+		if data[pos] != 0xFF {
+			return nil, 0, fmt.Errorf("invalid jpeg marker at offset %d", pos)
+		}
+		for pos+1 < len(data) && data[pos+1] == 0xFF {
+			pos++
+		}
+		if pos+4 > len(data) {
+			return nil, 0, errors.New("truncated jpeg segment")
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 { // SOS, EOI
+			return segments, pos, nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 { // the length counts its own two bytes
+			return nil, 0, fmt.Errorf("malformed jpeg segment 0x%X", marker)
+		}
+		end := pos + 2 + length
+		if end > len(data) {
+			return nil, 0, fmt.Errorf("truncated jpeg segment 0x%X", marker)
+		}
+		segments = append(segments, jpegSegment{marker, pos, end, data[pos+4 : end]})
+		pos = end
+	}
+	return nil, 0, errors.New("jpeg has no image data")
+}
+
+func isJPEGEXIF(s jpegSegment) bool {
+	return s.marker == 0xE1 && bytes.HasPrefix(s.payload, exifHeader)
+}
+
+func readJPEGEXIF(data []byte) ([]byte, error) {
+	segments, _, err := jpegHeaderSegments(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range segments {
+		if isJPEGEXIF(s) {
+			return bytes.Clone(s.payload[len(exifHeader):]), nil
+		}
+	}
+	return nil, nil
+}
+
+// writeJPEGEXIF drops any EXIF APP1 segment and adds exif after SOI and the
+// JFIF header, where readers expect it.
+func writeJPEGEXIF(data, exif []byte) ([]byte, error) {
+	if 2+len(exifHeader)+len(exif) > 0xFFFF {
+		return nil, fmt.Errorf("exif data is too large for a jpeg segment (%d bytes)", len(exif))
+	}
+	return writeJPEGAPP1(data, exifHeader, exif)
+}
+
+// writeJPEGAPP1 drops any APP1 segment whose payload starts with header and
+// adds one holding header and body after SOI and the JFIF header.
+func writeJPEGAPP1(data, header, body []byte) ([]byte, error) {
+	length := 2 + len(header) + len(body)
+	if length > 0xFFFF {
+		return nil, fmt.Errorf("data is too large for a jpeg segment (%d bytes)", len(body))
+	}
+	segments, scan, err := jpegHeaderSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(length))
+	app1 = append(app1, header...)
+	app1 = append(app1, body...)
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+len(app1)))
+	out.Write(data[:2]) // SOI
+	written := false
+	for _, s := range segments {
+		if !written && s.marker != 0xE0 {
+			out.Write(app1)
+			written = true
+		}
+		if s.marker != 0xE1 || !bytes.HasPrefix(s.payload, header) {
+			out.Write(data[s.start:s.end])
+		}
+	}
+	if !written {
+		out.Write(app1)
+	}
+	out.Write(data[scan:])
+	return out.Bytes(), nil
+}
+
+// webpChunk is a chunk of a RIFF WebP file, with end including padding.
+type webpChunk struct {
+	name    string
+	start   int
+	end     int
+	payload []byte
+}
+
+func webpChunks(data []byte) ([]webpChunk, error) {
+	var chunks []webpChunk
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, errors.New("truncated webp chunk header")
+		}
+		name := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if end > len(data) {
+			return nil, fmt.Errorf("truncated webp chunk %q", name)
+		}
+		chunks = append(chunks, webpChunk{name, pos, end, data[pos+8 : pos+8+size]})
+		pos = end
+	}
+	return chunks, nil
+}
+
+func readWebPEXIF(data []byte) ([]byte, error) {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range chunks {
+		if c.name == "EXIF" {
+			return bytes.Clone(bytes.TrimPrefix(c.payload, exifHeader)), nil
+		}
+	}
+	return nil, nil
+}
+
+// writeWebPEXIF drops any EXIF chunk and appends exif at the end, flagging
+// it in the VP8X header. Simple WebP files get a VP8X header first.
+func writeWebPEXIF(data, exif []byte) ([]byte, error) {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+len(exif)+26))
+	out.Write(data[:12]) // RIFF header, size patched below
+	if len(chunks) == 0 || chunks[0].name != "VP8X" {
+		vp8x, err := newVP8X(chunks)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(vp8x)
+	}
+	for _, c := range chunks {
+		switch c.name {
+		case "EXIF":
+		case "VP8X":
+			chunk := bytes.Clone(data[c.start:c.end])
+			if len(chunk) > 8 {
+				chunk[8] |= webpFlagEXIF
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[c.start:c.end])
+		}
+	}
+	out.WriteString("EXIF")
+	binary.Write(out, binary.LittleEndian, uint32(len(exif)))
+	out.Write(exif)
+	if len(exif)%2 == 1 {
+		out.WriteByte(0)
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result, nil
+}
+
+// newVP8X builds an extended header for a simple (VP8 or VP8L) WebP file
+// whose image chunk is first in chunks, reading the canvas size from it.
+func newVP8X(chunks []webpChunk) ([]byte, error) {
+	if len(chunks) == 0 {
+		return nil, errors.New("webp has no image data")
+	}
+	var width, height int
+	var flags byte = webpFlagEXIF
+	p := chunks[0].payload
+	switch {
+	case chunks[0].name == "VP8 " && len(p) >= 10:
+		width = int(binary.LittleEndian.Uint16(p[6:]) & 0x3FFF)
+		height = int(binary.LittleEndian.Uint16(p[8:]) & 0x3FFF)
+	case chunks[0].name == "VP8L" && len(p) >= 5 && p[0] == 0x2F:
+		bits := binary.LittleEndian.Uint32(p[1:])
+		width = int(bits&0x3FFF) + 1
+		height = int(bits>>14&0x3FFF) + 1
+		if bits>>28&1 == 1 {
+			flags |= 0x10 // alpha
+		}
+	default:
+		return nil, fmt.Errorf("unsupported webp image chunk %q", chunks[0].name)
+	}
+
+	vp8x := []byte("VP8X")
+	vp8x = binary.LittleEndian.AppendUint32(vp8x, 10)
+	vp8x = append(vp8x, flags, 0, 0, 0)
+	vp8x = appendUint24(vp8x, width-1)
+	vp8x = appendUint24(vp8x, height-1)
+	return vp8x, nil
+}
+
+func appendUint24(b []byte, v int) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16))
+}
@@ -0,0 +1,205 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	stdimage "image"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+// testEXIF builds a little-endian TIFF structure with Make, Orientation, and
+// DateTime tags in its first IFD.
+func testEXIF(orientation uint16) []byte {
+	maker := "Acme Camera\x00"
+	dateTime := "2024:05:01 12:30:00\x00"
+	const entries = 3
+	dataStart := 8 + 2 + entries*12 + 4
+
+	b := []byte("II*\x00")
+	b = binary.LittleEndian.AppendUint32(b, 8)
+	b = binary.LittleEndian.AppendUint16(b, entries)
+	entry := func(tag, typ uint16, count, value uint32) {
+		b = binary.LittleEndian.AppendUint16(b, tag)
+		b = binary.LittleEndian.AppendUint16(b, typ)
+		b = binary.LittleEndian.AppendUint32(b, count)
+		b = binary.LittleEndian.AppendUint32(b, value)
+	}
+	entry(0x010F, 2, uint32(len(maker)), uint32(dataStart))
+	entry(tagOrientation, 3, 1, uint32(orientation))
+	entry(0x0132, 2, uint32(len(dateTime)), uint32(dataStart+len(maker)))
+	b = binary.LittleEndian.AppendUint32(b, 0) // no next IFD
+	b = append(b, maker...)
+	return append(b, dateTime...)
+}
+
+func testWebP(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	return append(data, body...)
+}
+
+func TestWriteEXIF_RoundTrip(t *testing.T) {
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, stdimage.NewRGBA(stdimage.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// A 3x2 lossless WebP header: signature, then 14-bit width-1 and height-1.
+	vp8l := []byte("VP8L\x05\x00\x00\x00\x2f")
+	vp8l = binary.LittleEndian.AppendUint32(vp8l, 2|1<<14)
+	vp8l = append(vp8l, 0)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"png", encodeTestPNG(t, 128)},
+		{"png replacing exif", withPNGChunks(encodeTestPNG(t, 128), pngChunk("eXIf", []byte("MM\x00*old")))},
+		{"jpeg", jpg.Bytes()},
+		{"webp", testWebP(vp8l)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := WriteEXIF(tt.data, testEXIF(6))
+			if err != nil {
+				t.Fatalf("WriteEXIF() error = %v", err)
+			}
+			exif, err := ReadEXIF(out)
+			if err != nil {
+				t.Fatalf("ReadEXIF() error = %v", err)
+			}
+			for _, want := range []string{"Acme Camera", "2024:05:01 12:30:00"} {
+				if !bytes.Contains(exif, []byte(want)) {
+					t.Errorf("EXIF lost %q", want)
+				}
+			}
+			if bytes.Contains(out, []byte("old")) {
+				t.Error("existing EXIF was not replaced")
+			}
+			off := orientationOffset(exif)
+			if off < 0 || binary.LittleEndian.Uint16(exif[off:]) != 1 {
+				t.Error("orientation should be reset to 1")
+			}
+			if tt.name != "webp" && pixelHash(t, out) != pixelHash(t, tt.data) {
+				t.Error("pixel data changed")
+			}
+		})
+	}
+}
+
+func TestWriteEXIF_WebPHeader(t *testing.T) {
+	vp8l := []byte("VP8L\x05\x00\x00\x00\x2f")
+	vp8l = binary.LittleEndian.AppendUint32(vp8l, 2|1<<14|1<<28)
+	vp8l = append(vp8l, 0)
+
+	out, err := WriteEXIF(testWebP(vp8l), testEXIF(1))
+	if err != nil {
+		t.Fatalf("WriteEXIF() error = %v", err)
+	}
+	if string(out[12:16]) != "VP8X" {
+		t.Fatalf("first chunk = %q, want VP8X", out[12:16])
+	}
+	if flags := out[20]; flags != webpFlagEXIF|0x10 {
+		t.Errorf("VP8X flags = %#x, want EXIF and alpha", flags)
+	}
+	if w, h := int(out[24])+1, int(out[27])+1; w != 3 || h != 2 {
+		t.Errorf("VP8X canvas = %dx%d, want 3x2", w, h)
+	}
+	if got := int(binary.LittleEndian.Uint32(out[4:])); got != len(out)-8 {
+		t.Errorf("RIFF size = %d, want %d", got, len(out)-8)
+	}
+}
+
+// testEXIFWithThumbnail builds a little-endian TIFF structure whose first
+// IFD has a Make tag and an Exif IFD with DateTimeOriginal, followed by an
+// IFD1 pointing to a thumbnail.
+func testEXIFWithThumbnail(thumbnail string) []byte {
+	maker := "Acme Camera\x00"
+	original := "2024:05:01 12:30:00\x00"
+
+	b := []byte("II*\x00")
+	b = binary.LittleEndian.AppendUint32(b, 8)
+	entry := func(tag, typ uint16, count, value uint32) {
+		b = binary.LittleEndian.AppendUint16(b, tag)
+		b = binary.LittleEndian.AppendUint16(b, typ)
+		b = binary.LittleEndian.AppendUint32(b, count)
+		b = binary.LittleEndian.AppendUint32(b, value)
+	}
+
+	const ifd0 = 8
+	makeAt := ifd0 + 2 + 2*12 + 4
+	exifIFD := makeAt + len(maker)
+	originalAt := exifIFD + 2 + 12 + 4
+	ifd1 := originalAt + len(original)
+	thumbAt := ifd1 + 2 + 2*12 + 4
+
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	entry(0x010F, 2, uint32(len(maker)), uint32(makeAt))
+	entry(tagExifIFD, 4, 1, uint32(exifIFD))
+	b = binary.LittleEndian.AppendUint32(b, uint32(ifd1))
+	b = append(b, maker...)
+
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	entry(0x9003, 2, uint32(len(original)), uint32(originalAt))
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = append(b, original...)
+
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	entry(0x0201, 4, 1, uint32(thumbAt))
+	entry(0x0202, 4, 1, uint32(len(thumbnail)))
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	return append(b, thumbnail...)
+}
+
+func TestWriteEXIF_DropsThumbnail(t *testing.T) {
+	out, err := WriteEXIF(encodeTestPNG(t, 128), testEXIFWithThumbnail("ORIGINAL-THUMBNAIL"))
+	if err != nil {
+		t.Fatalf("WriteEXIF() error = %v", err)
+	}
+	exif, err := ReadEXIF(out)
+	if err != nil {
+		t.Fatalf("ReadEXIF() error = %v", err)
+	}
+	if bytes.Contains(exif, []byte("ORIGINAL-THUMBNAIL")) {
+		t.Error("the IFD1 thumbnail was copied")
+	}
+	for _, want := range []string{"Acme Camera", "2024:05:01 12:30:00"} {
+		if !bytes.Contains(exif, []byte(want)) {
+			t.Errorf("EXIF lost %q", want)
+		}
+	}
+
+	// The first IFD, two entries long, must not link to another IFD.
+	ifd0 := int(binary.LittleEndian.Uint32(exif[4:]))
+	count := int(binary.LittleEndian.Uint16(exif[ifd0:]))
+	if next := binary.LittleEndian.Uint32(exif[ifd0+2+count*12:]); count != 2 || next != 0 {
+		t.Errorf("first IFD has %d entries and next IFD %d, want 2 and 0", count, next)
+	}
+}
+
+func TestReadEXIF(t *testing.T) {
+	plain := encodeTestPNG(t, 128)
+	if exif, err := ReadEXIF(plain); err != nil || exif != nil {
+		t.Errorf("ReadEXIF(no exif) = %q, %v, want nil", exif, err)
+	}
+	bad := withPNGChunks(plain, pngChunk("eXIf", []byte("not tiff")))
+	if _, err := ReadEXIF(bad); !errors.Is(err, ErrMalformedEXIF) {
+		t.Errorf("ReadEXIF(malformed) error = %v, want ErrMalformedEXIF", err)
+	}
+	if _, err := WriteEXIF(plain, []byte("not tiff")); !errors.Is(err, ErrMalformedEXIF) {
+		t.Errorf("WriteEXIF(malformed) error = %v, want ErrMalformedEXIF", err)
+	}
+	if _, err := ReadEXIF([]byte("GIF89a")); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+	// A segment length below 2 cannot cover the length field itself.
+	short := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x00, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9}
+	if _, err := ReadEXIF(short); err == nil || !strings.Contains(err.Error(), "malformed jpeg segment") {
+		t.Errorf("ReadEXIF(short segment) error = %v, want malformed jpeg segment", err)
+	}
+}
@@ -0,0 +1,65 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// maxParallelDownloads bounds how many images FetchURLs downloads at once.
+const maxParallelDownloads = 4
+
+// FetchURLs fills in Data for the images that only have a URL, downloading
+// up to maxParallelDownloads of them at a time with fetch, and returns how
+// many it downloaded. Images keep their positions in the slice. The first
+// failed download cancels the rest and is returned naming the image and
+// its URL.
+func FetchURLs(ctx context.Context, images []models.GeneratedImage, fetch func(context.Context, string) ([]byte, error)) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		sem      = make(chan struct{}, maxParallelDownloads)
+		count    int
+	)
+	for i := range images {
+		img := &images[i]
+		if len(img.Data) > 0 || img.URL == "" {
+			continue
+		}
+		count++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			data, err := fetch(ctx, img.URL)
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("image %d (%s): %w", i+1, img.URL, err)
+					cancel()
+				})
+				return
+			}
+			img.Data = data
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
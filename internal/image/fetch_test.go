@@ -0,0 +1,88 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+func TestFetchURLs_Parallel(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	// Earlier images answer more slowly, so downloads finish out of order.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		time.Sleep(delay + time.Duration(4-n)*10*time.Millisecond)
+		fmt.Fprintf(w, "image %d", n)
+	}))
+	defer server.Close()
+
+	images := []models.GeneratedImage{
+		{URL: server.URL + "/0", Index: 0},
+		{URL: server.URL + "/1", Index: 1},
+		{Data: []byte("inline"), URL: server.URL + "/unused", Index: 2},
+		{URL: server.URL + "/3", Index: 3},
+		{URL: server.URL + "/4", Index: 4},
+	}
+
+	start := time.Now()
+	n, err := FetchURLs(context.Background(), images, NewSaver().downloadFromURL)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("FetchURLs() error = %v", err)
+	}
+	if n != 4 {
+		t.Errorf("downloaded %d images, want 4", n)
+	}
+	if sequential := 4 * delay; elapsed >= sequential {
+		t.Errorf("FetchURLs() took %v, want less than the sequential %v", elapsed, sequential)
+	}
+	for i, img := range images {
+		want := fmt.Sprintf("image %d", i)
+		if i == 2 {
+			want = "inline"
+		}
+		if string(img.Data) != want || img.Index != i {
+			t.Errorf("images[%d] = %q (index %d), want %q in place", i, img.Data, img.Index, want)
+		}
+	}
+}
+
+func TestFetchURLs_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	images := []models.GeneratedImage{
+		{URL: server.URL + "/good"},
+		{URL: server.URL + "/bad"},
+	}
+	_, err := FetchURLs(context.Background(), images, NewSaver().downloadFromURL)
+	if err == nil || !strings.Contains(err.Error(), "image 2 ("+server.URL+"/bad)") {
+		t.Errorf("FetchURLs() error = %v, want it to name image 2 and its URL", err)
+	}
+}
+
+func TestFetchURLs_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	images := []models.GeneratedImage{{URL: "https://example.com/a.png"}}
+	fetch := func(ctx context.Context, _ string) ([]byte, error) {
+		return nil, ctx.Err()
+	}
+	if _, err := FetchURLs(ctx, images, fetch); !errors.Is(err, context.Canceled) {
+		t.Errorf("FetchURLs() error = %v, want context.Canceled", err)
+	}
+}
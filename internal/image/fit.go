@@ -0,0 +1,115 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"math"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// FitToLimit downscales an image, keeping its aspect ratio, until its longer
+// side is at most maxDim pixels and its PNG encoding is at most maxBytes. The
+// result is PNG encoded. Images already within both limits are returned
+// unchanged; a limit of zero or less is ignored.
+func FitToLimit(data []byte, maxDim int, maxBytes int) ([]byte, error) {
+	cfg, _, err := stdimage.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	longest := max(cfg.Width, cfg.Height)
+	if (maxDim <= 0 || longest <= maxDim) && (maxBytes <= 0 || len(data) <= maxBytes) {
+		return data, nil
+	}
+
+	img, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	scale := 1.0
+	if maxDim > 0 && longest > maxDim {
+		scale = float64(maxDim) / float64(longest)
+	}
+
+	for {
+		w := max(1, int(float64(cfg.Width)*scale))
+		h := max(1, int(float64(cfg.Height)*scale))
+
+		encoded, err := encode(downscale(img, w, h), models.FormatPNG, EncodeOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode png: %w", err)
+		}
+		if maxBytes <= 0 || len(encoded) <= maxBytes {
+			return encoded, nil
+		}
+		if w == 1 && h == 1 {
+			return nil, fmt.Errorf("image cannot be shrunk below %s", formatBytes(int64(maxBytes)))
+		}
+
+		// PNG size grows roughly with the pixel count, so shrink each side by
+		// the square root of the overshoot, with a margin so this converges.
+		scale *= 0.95 * math.Sqrt(float64(maxBytes)/float64(len(encoded)))
+	}
+}
+
+// MatchSize resizes an image to exactly the dimensions of like, ignoring its
+// aspect ratio, and returns it PNG encoded. An image already that size is
+// returned unchanged.
+func MatchSize(data, like []byte) ([]byte, error) {
+	want, _, err := stdimage.DecodeConfig(bytes.NewReader(like))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reference image: %w", err)
+	}
+	cfg, _, err := stdimage.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if cfg.Width == want.Width && cfg.Height == want.Height {
+		return data, nil
+	}
+
+	img, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	encoded, err := encode(downscale(img, want.Width, want.Height), models.FormatPNG, EncodeOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode png: %w", err)
+	}
+	return encoded, nil
+}
+
+// downscale resizes img to w x h by averaging the source pixels that each
+// destination pixel covers.
+func downscale(img stdimage.Image, w, h int) *stdimage.RGBA {
+	b := img.Bounds()
+	dst := stdimage.NewRGBA(stdimage.Rect(0, 0, w, h))
+	for y := range h {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/h)
+		for x := range w {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/w)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,119 @@
+package image
+
+import (
+	"bytes"
+	stdimage "image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"testing"
+)
+
+// noisyPNG encodes a w x h PNG of random pixels, which compresses poorly.
+func noisyPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.IntN(256))
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xFF
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func pngDimensions(t *testing.T, data []byte) (int, int) {
+	t.Helper()
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("result is not a PNG: %v", err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+func TestFitToLimit_ShrinksLargeImage(t *testing.T) {
+	data := noisyPNG(t, 1500, 1000)
+	const maxBytes = 1 << 20
+	if len(data) <= maxBytes {
+		t.Fatalf("fixture is %d bytes, want more than %d", len(data), maxBytes)
+	}
+
+	got, err := FitToLimit(data, 1024, maxBytes)
+	if err != nil {
+		t.Fatalf("FitToLimit() error = %v", err)
+	}
+	if len(got) > maxBytes {
+		t.Errorf("result is %d bytes, want at most %d", len(got), maxBytes)
+	}
+	w, h := pngDimensions(t, got)
+	if w > 1024 || h > 1024 {
+		t.Errorf("result is %dx%d, want at most 1024 on each side", w, h)
+	}
+	if ratio := float64(w) / float64(h); ratio < 1.45 || ratio > 1.55 {
+		t.Errorf("result is %dx%d, want the 3:2 aspect ratio kept", w, h)
+	}
+}
+
+func TestFitToLimit_DimensionsOnly(t *testing.T) {
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, 2000, 1000))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FitToLimit(buf.Bytes(), 500, 0)
+	if err != nil {
+		t.Fatalf("FitToLimit() error = %v", err)
+	}
+	if w, h := pngDimensions(t, got); w != 500 || h != 250 {
+		t.Errorf("result is %dx%d, want 500x250", w, h)
+	}
+
+	decoded, _ := png.Decode(bytes.NewReader(got))
+	if c := color.RGBAModel.Convert(decoded.At(10, 10)).(color.RGBA); c.R != 0x80 || c.A != 0x80 {
+		t.Errorf("pixel = %v, want the averaged source color", c)
+	}
+}
+
+func TestFitToLimit_SmallImageUnchanged(t *testing.T) {
+	data := noisyPNG(t, 64, 64)
+
+	got, err := FitToLimit(data, 1024, 4<<20)
+	if err != nil {
+		t.Fatalf("FitToLimit() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("FitToLimit() changed an image already within the limits")
+	}
+}
+
+func TestFitToLimit_InvalidImage(t *testing.T) {
+	if _, err := FitToLimit([]byte("not an image"), 1024, 4<<20); err == nil {
+		t.Error("FitToLimit() expected error for undecodable data")
+	}
+}
+
+func TestMatchSize(t *testing.T) {
+	like := noisyPNG(t, 300, 200)
+
+	got, err := MatchSize(noisyPNG(t, 600, 600), like)
+	if err != nil {
+		t.Fatalf("MatchSize() error = %v", err)
+	}
+	if w, h := pngDimensions(t, got); w != 300 || h != 200 {
+		t.Errorf("MatchSize() = %dx%d, want 300x200", w, h)
+	}
+
+	same := noisyPNG(t, 300, 200)
+	if got, err := MatchSize(same, like); err != nil || !bytes.Equal(got, same) {
+		t.Errorf("MatchSize() changed an image already the right size (err = %v)", err)
+	}
+}
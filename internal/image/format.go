@@ -0,0 +1,133 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+
+	_ "image/gif" // register the GIF decoder for ResolveFormat
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// jpegQuality is the default quality for images re-encoded as JPEG.
+const jpegQuality = 90
+
+// ResolveFormat picks a concrete output format for image data saved with
+// --format auto: png when the image uses transparency, jpeg otherwise. The
+// returned data is encoded in the resolved format with opts. Data that
+// cannot be decoded is returned unchanged along with the format it was
+// sniffed as.
+func ResolveFormat(data []byte, opts EncodeOptions) (models.OutputFormat, []byte, error) {
+	src := DetectFormat(data)
+
+	img, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return src, data, nil
+	}
+
+	target := models.FormatJPEG
+	if hasAlpha(img) {
+		target = models.FormatPNG
+	}
+
+	if target == src {
+		return target, data, nil
+	}
+
+	encoded, err := encode(img, target, opts)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode %s: %w", target, err)
+	}
+	return target, encoded, nil
+}
+
+// ConvertFormat re-encodes data as format with opts when it is encoded as
+// something else, so that a saved file matches its extension. Data already
+// in format is returned unchanged unless opts change how that format is
+// encoded, as are data that cannot be decoded and unknown formats.
+func ConvertFormat(data []byte, format models.OutputFormat, opts EncodeOptions) ([]byte, error) {
+	opts = opts.orDefault()
+	var custom bool
+	switch format {
+	case models.FormatPNG:
+	case models.FormatJPEG:
+		custom = opts.JPEGQuality != DefaultEncodeOptions.JPEGQuality
+	case models.FormatWebP:
+		custom = opts.WebPQuality != DefaultEncodeOptions.WebPQuality || opts.WebPLossless
+	default:
+		return data, nil
+	}
+	if !custom && DetectFormat(data) == format && (format != models.FormatPNG || bytes.HasPrefix(data, pngSignature)) {
+		return data, nil
+	}
+
+	img, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return data, nil
+	}
+
+	encoded, err := encode(img, format, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+	return encoded, nil
+}
+
+// DetectFormat sniffs the image format from its magic bytes, defaulting to png.
+func DetectFormat(data []byte) models.OutputFormat {
+	switch {
+	case len(data) >= 3 && data[0] == 0xFF && data[1] == 0xD8 && data[2] == 0xFF:
+		return models.FormatJPEG
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return models.FormatWebP
+	default:
+		return models.FormatPNG
+	}
+}
+
+func encode(img stdimage.Image, format models.OutputFormat, opts EncodeOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	opts = opts.orDefault()
+	switch format {
+	case models.FormatPNG:
+		err = png.Encode(&buf, img)
+	case models.FormatJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: opts.JPEGQuality})
+	case models.FormatWebP:
+		return encodeWebP(img, opts)
+	default:
+		return nil, fmt.Errorf("encoding to %s is not supported", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hasAlpha reports whether any pixel in the image is not fully opaque.
+func hasAlpha(img stdimage.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func replaceExt(path string, format models.OutputFormat) string {
+	ext := filepath.Ext(path)
+	return path[:len(path)-len(ext)] + "." + format.String()
+}
@@ -0,0 +1,207 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	stdimage "image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+func encodeTestPNG(t *testing.T, alpha uint8) []byte {
+	t.Helper()
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: alpha})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestResolveFormat_TransparentIsPNG(t *testing.T) {
+	data := encodeTestPNG(t, 128)
+
+	format, out, err := ResolveFormat(data, DefaultEncodeOptions)
+	if err != nil {
+		t.Fatalf("ResolveFormat() error = %v", err)
+	}
+	if format != models.FormatPNG {
+		t.Errorf("ResolveFormat() format = %s, want png", format)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("ResolveFormat() re-encoded a png that should be kept as is")
+	}
+}
+
+func TestResolveFormat_OpaqueIsJPEG(t *testing.T) {
+	data := encodeTestPNG(t, 255)
+
+	format, out, err := ResolveFormat(data, DefaultEncodeOptions)
+	if err != nil {
+		t.Fatalf("ResolveFormat() error = %v", err)
+	}
+	if format != models.FormatJPEG {
+		t.Errorf("ResolveFormat() format = %s, want jpeg", format)
+	}
+	if DetectFormat(out) != models.FormatJPEG {
+		t.Error("ResolveFormat() did not re-encode opaque image as jpeg")
+	}
+}
+
+func TestResolveFormat_UndecodableKeepsData(t *testing.T) {
+	data := []byte("not an image")
+
+	format, out, err := ResolveFormat(data, DefaultEncodeOptions)
+	if err != nil {
+		t.Fatalf("ResolveFormat() error = %v", err)
+	}
+	if format != models.FormatPNG {
+		t.Errorf("ResolveFormat() format = %s, want png", format)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("ResolveFormat() modified undecodable data")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want models.OutputFormat
+	}{
+		{"png", []byte{0x89, 'P', 'N', 'G'}, models.FormatPNG},
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE0}, models.FormatJPEG},
+		{"webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), models.FormatWebP},
+		{"unknown", []byte("xx"), models.FormatPNG},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat(tt.data); got != tt.want {
+				t.Errorf("DetectFormat() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaver_SaveAll_AutoFormat(t *testing.T) {
+	s := NewSaver()
+	tmpDir := t.TempDir()
+	basePath := filepath.Join(tmpDir, "image.auto")
+
+	resp := &models.Response{
+		Images: []models.GeneratedImage{
+			{Data: encodeTestPNG(t, 0), Index: 0},
+			{Data: encodeTestPNG(t, 255), Index: 1},
+		},
+	}
+
+	paths, err := s.SaveAll(context.Background(), resp, basePath, models.FormatAuto)
+	if err != nil {
+		t.Fatalf("SaveAll() error = %v", err)
+	}
+
+	want := []string{
+		filepath.Join(tmpDir, "image-1.png"),
+		filepath.Join(tmpDir, "image-2.jpeg"),
+	}
+	for i, path := range paths {
+		if path != want[i] {
+			t.Errorf("SaveAll() path[%d] = %s, want %s", i, path, want[i])
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		if got := DetectFormat(data); string(got) != filepath.Ext(path)[1:] {
+			t.Errorf("file %s contains %s data", path, got)
+		}
+	}
+}
+
+func TestSaver_SaveAll_ExplicitFormatNotResolved(t *testing.T) {
+	s := NewSaver()
+	basePath := filepath.Join(t.TempDir(), "image.png")
+	data := encodeTestPNG(t, 255)
+
+	resp := &models.Response{
+		Images: []models.GeneratedImage{{Data: data}},
+	}
+
+	paths, err := s.SaveAll(context.Background(), resp, basePath, models.FormatPNG)
+	if err != nil {
+		t.Fatalf("SaveAll() error = %v", err)
+	}
+
+	saved, _ := os.ReadFile(paths[0])
+	if !bytes.Equal(saved, data) {
+		t.Error("SaveAll() re-encoded image despite explicit format")
+	}
+}
+
+func TestConvertFormat(t *testing.T) {
+	pngData := encodeTestPNG(t, 255)
+
+	jpegData, err := ConvertFormat(pngData, models.FormatJPEG, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("ConvertFormat() error = %v", err)
+	}
+	if DetectFormat(jpegData) != models.FormatJPEG {
+		t.Error("ConvertFormat() did not re-encode png as jpeg")
+	}
+
+	back, err := ConvertFormat(jpegData, models.FormatPNG, EncodeOptions{})
+	if err != nil {
+		t.Fatalf("ConvertFormat() error = %v", err)
+	}
+	if !bytes.HasPrefix(back, pngSignature) {
+		t.Error("ConvertFormat() did not re-encode jpeg as png")
+	}
+
+	for _, tt := range []struct {
+		name   string
+		data   []byte
+		format models.OutputFormat
+	}{
+		{"already png", pngData, models.FormatPNG},
+		{"already jpeg", jpegData, models.FormatJPEG},
+		{"undecodable", []byte("not an image"), models.FormatJPEG},
+	} {
+		got, err := ConvertFormat(tt.data, tt.format, EncodeOptions{})
+		if err != nil {
+			t.Fatalf("%s: ConvertFormat() error = %v", tt.name, err)
+		}
+		if !bytes.Equal(got, tt.data) {
+			t.Errorf("%s: ConvertFormat() changed the data", tt.name)
+		}
+	}
+}
+
+func TestSaver_SaveAll_ConvertsToExplicitFormat(t *testing.T) {
+	s := NewSaver()
+	basePath := filepath.Join(t.TempDir(), "image.jpeg")
+
+	resp := &models.Response{
+		Images: []models.GeneratedImage{{Data: encodeTestPNG(t, 255)}},
+	}
+
+	paths, err := s.SaveAll(context.Background(), resp, basePath, models.FormatJPEG)
+	if err != nil {
+		t.Fatalf("SaveAll() error = %v", err)
+	}
+
+	saved, _ := os.ReadFile(paths[0])
+	if DetectFormat(saved) != models.FormatJPEG {
+		t.Error("SaveAll() saved png data under a jpeg name")
+	}
+}
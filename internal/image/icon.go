@@ -0,0 +1,146 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/draw"
+	"image/png"
+	"maps"
+	"slices"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// IconSizes are the square sizes, in pixels, of a standard app icon set.
+var IconSizes = []int{16, 32, 48, 128, 256, 512, 1024}
+
+// maxICOSize is the largest image an .ico file can hold.
+const maxICOSize = 256
+
+// icnsTypes are the ICNS element types that hold a PNG of each size.
+// Sizes without one, such as 48, are left out of .icns files.
+var icnsTypes = map[int]string{
+	16:   "icp4",
+	32:   "icp5",
+	64:   "icp6",
+	128:  "ic07",
+	256:  "ic08",
+	512:  "ic09",
+	1024: "ic10",
+}
+
+// ErrNoIcons is returned when an icon file would hold no images.
+var ErrNoIcons = errors.New("no icon sizes to write")
+
+// Icon is one size of an icon set, PNG encoded.
+type Icon struct {
+	Size int
+	PNG  []byte
+}
+
+// IconSet resamples the image in data to each of sizes, in ascending order.
+// A source that is not square is scaled to fit and centered on a
+// transparent background, so every icon is size×size.
+func IconSet(data []byte, sizes []int) ([]Icon, error) {
+	src, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	sizes = slices.Sorted(slices.Values(sizes))
+	sizes = slices.Compact(sizes)
+	icons := make([]Icon, 0, len(sizes))
+	for _, size := range sizes {
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid icon size %d", size)
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, resampleSquare(src, size)); err != nil {
+			return nil, fmt.Errorf("failed to encode %dx%d icon: %w", size, size, err)
+		}
+		icons = append(icons, Icon{Size: size, PNG: buf.Bytes()})
+	}
+	return icons, nil
+}
+
+// resampleSquare scales src to fit a size×size transparent square.
+func resampleSquare(src stdimage.Image, size int) *stdimage.NRGBA {
+	dst := stdimage.NewNRGBA(stdimage.Rect(0, 0, size, size))
+	b := src.Bounds()
+	w, h := size, size
+	if b.Dx() > b.Dy() {
+		h = max(1, b.Dy()*size/b.Dx())
+	} else {
+		w = max(1, b.Dx()*size/b.Dy())
+	}
+	origin := stdimage.Pt((size-w)/2, (size-h)/2)
+	xdraw.CatmullRom.Scale(dst, stdimage.Rectangle{Min: origin, Max: origin.Add(stdimage.Pt(w, h))}, src, b, draw.Src, nil)
+	return dst
+}
+
+// ICOSizes returns the sizes an .ico file keeps: those of at most 256
+// pixels.
+func ICOSizes(sizes []int) []int {
+	return slices.DeleteFunc(slices.Clone(sizes), func(size int) bool { return size > maxICOSize })
+}
+
+// ICNSSizes returns the sizes an .icns file keeps: those it has a PNG
+// element type for.
+func ICNSSizes(sizes []int) []int {
+	return slices.DeleteFunc(slices.Clone(sizes), func(size int) bool {
+		_, ok := icnsTypes[size]
+		return !ok
+	})
+}
+
+// EncodeICO packs the icons of at most 256 pixels into a Windows .ico file
+// of PNG images.
+func EncodeICO(icons []Icon) ([]byte, error) {
+	fit := slices.DeleteFunc(slices.Clone(icons), func(icon Icon) bool { return icon.Size > maxICOSize })
+	if len(fit) == 0 {
+		return nil, fmt.Errorf("%w: .ico holds sizes up to %d", ErrNoIcons, maxICOSize)
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, [3]uint16{0, 1, uint16(len(fit))})
+	offset := 6 + 16*len(fit)
+	for _, icon := range fit {
+		// A width and height of 0 stand for 256.
+		dim := byte(icon.Size % 256)
+		buf.Write([]byte{dim, dim, 0, 0})
+		binary.Write(&buf, binary.LittleEndian, [2]uint16{1, 32})
+		binary.Write(&buf, binary.LittleEndian, [2]uint32{uint32(len(icon.PNG)), uint32(offset)})
+		offset += len(icon.PNG)
+	}
+	for _, icon := range fit {
+		buf.Write(icon.PNG)
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeICNS packs the icons into a macOS .icns file, skipping sizes that
+// the format has no PNG element for.
+func EncodeICNS(icons []Icon) ([]byte, error) {
+	var body bytes.Buffer
+	for _, icon := range icons {
+		typ, ok := icnsTypes[icon.Size]
+		if !ok {
+			continue
+		}
+		body.WriteString(typ)
+		binary.Write(&body, binary.BigEndian, uint32(8+len(icon.PNG)))
+		body.Write(icon.PNG)
+	}
+	if body.Len() == 0 {
+		return nil, fmt.Errorf("%w: .icns holds sizes %v", ErrNoIcons, slices.Sorted(maps.Keys(icnsTypes)))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("icns")
+	binary.Write(&buf, binary.BigEndian, uint32(8+body.Len()))
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,124 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	stdimage "image"
+	"image/color"
+	"image/png"
+	"slices"
+	"testing"
+)
+
+// wideRedPNG encodes an opaque red 200x100 image.
+func wideRedPNG(t *testing.T) []byte {
+	t.Helper()
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, 200, 100))
+	for y := range 100 {
+		for x := range 200 {
+			img.Set(x, y, color.NRGBA{255, 0, 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestIconSet(t *testing.T) {
+	icons, err := IconSet(wideRedPNG(t), []int{1024, 16, 48, 16, 32, 256, 128, 512})
+	if err != nil {
+		t.Fatalf("IconSet() error = %v", err)
+	}
+
+	var sizes []int
+	for _, icon := range icons {
+		sizes = append(sizes, icon.Size)
+		img, err := png.Decode(bytes.NewReader(icon.PNG))
+		if err != nil {
+			t.Fatalf("%d icon is not a PNG: %v", icon.Size, err)
+		}
+		if b := img.Bounds(); b.Dx() != icon.Size || b.Dy() != icon.Size {
+			t.Errorf("%d icon is %dx%d", icon.Size, b.Dx(), b.Dy())
+		}
+	}
+	if !slices.Equal(sizes, IconSizes) {
+		t.Errorf("sizes = %v, want %v", sizes, IconSizes)
+	}
+
+	// The wide source is letterboxed on transparency.
+	img, _ := png.Decode(bytes.NewReader(icons[len(icons)-1].PNG))
+	if _, _, _, a := img.At(512, 10).RGBA(); a != 0 {
+		t.Errorf("letterbox alpha = %d, want transparent", a)
+	}
+	if r, _, _, a := img.At(512, 512).RGBA(); r>>8 != 255 || a>>8 != 255 {
+		t.Errorf("center pixel = %d/%d, want opaque red", r>>8, a>>8)
+	}
+
+	if _, err := IconSet(wideRedPNG(t), []int{0}); err == nil {
+		t.Error("IconSet(size 0) error = nil")
+	}
+	if _, err := IconSet([]byte("not an image"), IconSizes); err == nil {
+		t.Error("IconSet(garbage) error = nil")
+	}
+}
+
+func TestEncodeICO(t *testing.T) {
+	icons := []Icon{{16, []byte("sixteen")}, {256, []byte("two-five-six")}, {512, []byte("too big")}}
+	data, err := EncodeICO(icons)
+	if err != nil {
+		t.Fatalf("EncodeICO() error = %v", err)
+	}
+
+	var header [3]uint16
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &header)
+	if header != [3]uint16{0, 1, 2} {
+		t.Fatalf("header = %v, want two icon entries", header)
+	}
+	for i, want := range []struct {
+		dim  byte
+		data string
+	}{{16, "sixteen"}, {0, "two-five-six"}} {
+		entry := data[6+16*i : 6+16*(i+1)]
+		size := binary.LittleEndian.Uint32(entry[8:])
+		offset := binary.LittleEndian.Uint32(entry[12:])
+		if entry[0] != want.dim || entry[1] != want.dim {
+			t.Errorf("entry %d dimensions = %d, want %d", i, entry[0], want.dim)
+		}
+		if got := string(data[offset : offset+size]); got != want.data {
+			t.Errorf("entry %d data = %q, want %q", i, got, want.data)
+		}
+	}
+
+	if _, err := EncodeICO([]Icon{{512, []byte("x")}}); !errors.Is(err, ErrNoIcons) {
+		t.Errorf("EncodeICO(512 only) error = %v, want ErrNoIcons", err)
+	}
+}
+
+func TestEncodeICNS(t *testing.T) {
+	icons := []Icon{{16, []byte("a")}, {48, []byte("skipped")}, {1024, []byte("bb")}}
+	data, err := EncodeICNS(icons)
+	if err != nil {
+		t.Fatalf("EncodeICNS() error = %v", err)
+	}
+
+	want := "icns\x00\x00\x00\x1b" + "icp4\x00\x00\x00\x09a" + "ic10\x00\x00\x00\x0abb"
+	if string(data) != want {
+		t.Errorf("EncodeICNS() = %q, want %q", data, want)
+	}
+
+	if _, err := EncodeICNS([]Icon{{48, []byte("x")}}); !errors.Is(err, ErrNoIcons) {
+		t.Errorf("EncodeICNS(48 only) error = %v, want ErrNoIcons", err)
+	}
+}
+
+func TestIconFileSizes(t *testing.T) {
+	if got := ICOSizes(IconSizes); !slices.Equal(got, []int{16, 32, 48, 128, 256}) {
+		t.Errorf("ICOSizes() = %v", got)
+	}
+	if got := ICNSSizes(IconSizes); !slices.Equal(got, []int{16, 32, 128, 256, 512, 1024}) {
+		t.Errorf("ICNSSizes() = %v", got)
+	}
+}
@@ -1,50 +1,94 @@
 package image
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/manash/imggen/internal/provider"
 	"github.com/manash/imggen/internal/security"
 	"github.com/manash/imggen/pkg/models"
 )
 
+// StdoutPath is the output path that stands for standard output, written
+// with WriteImage rather than saved.
+const StdoutPath = "-"
+
 type Saver struct {
-	httpClient *http.Client
+	downloader   *provider.Downloader
+	params       *GenerationParams
+	provenance   *Provenance
+	encoding     EncodeOptions
+	nameTemplate NameTemplate
+	nameFields   NameFields
 }
 
 func NewSaver() *Saver {
 	return &Saver{
-		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
+		downloader: &provider.Downloader{
+			Timeout: provider.DefaultDownloadTimeout,
 		},
 	}
 }
 
-func (s *Saver) Save(ctx context.Context, img *models.GeneratedImage, path string) error {
-	var data []byte
-	var err error
+// WithDownloader returns a Saver that fetches images the provider only
+// returned as URLs with d, e.g. one that retries with the user's settings.
+func (s *Saver) WithDownloader(d *provider.Downloader) *Saver {
+	withDownloader := *s
+	withDownloader.downloader = d
+	return &withDownloader
+}
 
-	if len(img.Data) > 0 {
-		data = img.Data
-	} else if img.URL != "" {
-		data, err = s.downloadFromURL(ctx, img.URL)
-		if err != nil {
-			return fmt.Errorf("failed to download image: %w", err)
-		}
-	} else {
-		return fmt.Errorf("no image data available")
+// WithParams returns a Saver that embeds params in every PNG and JPEG it
+// saves or writes. The Saver it is called on is unchanged, so workers can
+// share one Saver and embed their own parameters.
+func (s *Saver) WithParams(params *GenerationParams) *Saver {
+	withParams := *s
+	withParams.params = params
+	return &withParams
+}
+
+// WithProvenance returns a Saver that marks every PNG and JPEG it saves or
+// writes with p. Like WithParams, it leaves the Saver it is called on as is.
+func (s *Saver) WithProvenance(p *Provenance) *Saver {
+	withProvenance := *s
+	withProvenance.provenance = p
+	return &withProvenance
+}
+
+// WithEncodeOptions returns a Saver that re-encodes images with opts.
+func (s *Saver) WithEncodeOptions(opts EncodeOptions) *Saver {
+	withOpts := *s
+	withOpts.encoding = opts
+	return &withOpts
+}
+
+// WithNameTemplate returns a Saver that names the images SaveAll saves
+// into a directory with tmpl, expanding its tokens from fields and each
+// image's 1-based position.
+func (s *Saver) WithNameTemplate(tmpl NameTemplate, fields NameFields) *Saver {
+	withName := *s
+	withName.nameTemplate = tmpl
+	withName.nameFields = fields
+	return &withName
+}
+
+func (s *Saver) Save(ctx context.Context, img *models.GeneratedImage, path string) error {
+	data, err := s.imageData(ctx, img)
+	if err != nil {
+		return err
 	}
 
 	if err := s.ensureDir(path); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := writeFileAtomic(ctx, path, bytes.NewReader(data)); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -52,11 +96,36 @@ func (s *Saver) Save(ctx context.Context, img *models.GeneratedImage, path strin
 	return nil
 }
 
+// SaveAll saves every image in resp. Images returned as URLs are first
+// downloaded in parallel, adding the time that took to resp.Timing; if any
+// download fails, nothing is saved. When basePath is empty or a directory,
+// the images are named with the Saver's name template, or with
+// DefaultNameTemplate.
 func (s *Saver) SaveAll(ctx context.Context, resp *models.Response, basePath string, format models.OutputFormat) ([]string, error) {
 	paths := make([]string, 0, len(resp.Images))
 
+	start := time.Now()
+	downloaded, err := FetchURLs(ctx, resp.Images, s.downloadFromURL)
+	if err != nil {
+		return paths, fmt.Errorf("failed to download %w", err)
+	}
+	if downloaded > 0 {
+		resp.Timing.AddDownload(time.Since(start))
+	}
+
 	for i := range resp.Images {
-		path := s.generatePath(basePath, i, len(resp.Images), format)
+		if err := ctx.Err(); err != nil {
+			return paths, fmt.Errorf("save canceled after %d of %d images: %w", len(paths), len(resp.Images), err)
+		}
+
+		imgFormat, err := s.encodeAs(ctx, &resp.Images[i], format)
+		if err != nil {
+			return paths, fmt.Errorf("failed to save image %d: %w", i+1, err)
+		}
+		path, err := s.outputPath(basePath, i, len(resp.Images), imgFormat, format.IsAuto())
+		if err != nil {
+			return paths, fmt.Errorf("failed to save image %d: %w", i+1, err)
+		}
 		if err := s.Save(ctx, &resp.Images[i], path); err != nil {
 			return paths, fmt.Errorf("failed to save image %d: %w", i+1, err)
 		}
@@ -66,27 +135,124 @@ func (s *Saver) SaveAll(ctx context.Context, resp *models.Response, basePath str
 	return paths, nil
 }
 
-func (s *Saver) downloadFromURL(ctx context.Context, url string) ([]byte, error) {
-	if err := security.ValidateImageURL(url, false); err != nil {
-		return nil, fmt.Errorf("URL validation failed: %w", err)
+// WriteImage writes the single image in resp to w, encoded in format, for
+// output that is not a file such as stdout. A URL image is downloaded
+// first, adding the time that took to resp.Timing.
+func (s *Saver) WriteImage(ctx context.Context, resp *models.Response, w io.Writer, format models.OutputFormat) error {
+	if len(resp.Images) != 1 {
+		return fmt.Errorf("can only write a single image, got %d", len(resp.Images))
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	start := time.Now()
+	downloaded, err := FetchURLs(ctx, resp.Images, s.downloadFromURL)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to download %w", err)
+	}
+	if downloaded > 0 {
+		resp.Timing.AddDownload(time.Since(start))
 	}
 
-	resp, err := s.httpClient.Do(req)
+	img := &resp.Images[0]
+	if _, err := s.encodeAs(ctx, img, format); err != nil {
+		return fmt.Errorf("failed to write image: %w", err)
+	}
+	if _, err := w.Write(img.Data); err != nil {
+		return fmt.Errorf("failed to write image: %w", err)
+	}
+	return nil
+}
+
+// encodeAs re-encodes img in format, settling auto, embeds the Saver's
+// generation parameters and provenance if it has any, and returns the
+// format img ends up in.
+func (s *Saver) encodeAs(ctx context.Context, img *models.GeneratedImage, format models.OutputFormat) (models.OutputFormat, error) {
+	var err error
+	if format.IsAuto() {
+		format, err = s.resolveAuto(ctx, img)
+	} else {
+		err = s.convert(ctx, img, format)
+	}
 	if err != nil {
-		return nil, err
+		return format, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("download failed with status: %d", resp.StatusCode)
+	if s.params != nil {
+		embedded, err := EmbedParams(img.Data, s.params)
+		if err != nil {
+			return "", fmt.Errorf("failed to embed metadata: %w", err)
+		}
+		img.Data = embedded
+	}
+	if s.provenance != nil {
+		embedded, err := EmbedProvenance(img.Data, s.provenance)
+		if err != nil {
+			return "", fmt.Errorf("failed to embed provenance: %w", err)
+		}
+		img.Data = embedded
+	}
+	return format, nil
+}
+
+// Fetch returns the bytes of img, downloading them when the provider only
+// returned a URL.
+func (s *Saver) Fetch(ctx context.Context, img *models.GeneratedImage) ([]byte, error) {
+	return s.imageData(ctx, img)
+}
+
+func (s *Saver) imageData(ctx context.Context, img *models.GeneratedImage) ([]byte, error) {
+	if len(img.Data) > 0 {
+		return img.Data, nil
+	}
+	if img.URL != "" {
+		data, err := s.downloadFromURL(ctx, img.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download image: %w", err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("no image data available")
+}
+
+// resolveAuto settles --format auto for a single image, re-encoding its data
+// in place so the subsequent Save writes the resolved format.
+func (s *Saver) resolveAuto(ctx context.Context, img *models.GeneratedImage) (models.OutputFormat, error) {
+	data, err := s.imageData(ctx, img)
+	if err != nil {
+		return "", err
+	}
+
+	format, encoded, err := ResolveFormat(data, s.encoding)
+	if err != nil {
+		return "", err
+	}
+
+	img.Data = encoded
+	return format, nil
+}
+
+// convert re-encodes img in format when the provider returned it encoded
+// differently, e.g. a PNG from a model whose default format is jpeg.
+func (s *Saver) convert(ctx context.Context, img *models.GeneratedImage, format models.OutputFormat) error {
+	data, err := s.imageData(ctx, img)
+	if err != nil {
+		return err
+	}
+
+	converted, err := ConvertFormat(data, format, s.encoding)
+	if err != nil {
+		return err
+	}
+
+	img.Data = converted
+	return nil
+}
+
+func (s *Saver) downloadFromURL(ctx context.Context, url string) ([]byte, error) {
+	if err := security.ValidateImageURL(url, false); err != nil {
+		return nil, fmt.Errorf("URL validation failed: %w", err)
 	}
 
-	return io.ReadAll(resp.Body)
+	return s.downloader.Download(ctx, url)
 }
 
 func (s *Saver) ensureDir(path string) error {
@@ -97,6 +263,50 @@ func (s *Saver) ensureDir(path string) error {
 	return os.MkdirAll(dir, 0755)
 }
 
+// outputPath returns where SaveAll saves the image at index. A file
+// basePath is used as is, taking the image's extension when the format was
+// auto; a directory, or no path at all, gets a name from the name template.
+func (s *Saver) outputPath(basePath string, index, total int, format models.OutputFormat, auto bool) (string, error) {
+	if !IsOutputDir(basePath) {
+		if auto {
+			basePath = replaceExt(basePath, format)
+		}
+		return s.generatePath(basePath, index, total, format), nil
+	}
+	if basePath == "" && s.nameTemplate == "" {
+		return GenerateFilename(index, format), nil
+	}
+
+	tmpl := s.nameTemplate
+	if tmpl == "" {
+		tmpl = DefaultNameTemplate
+	}
+	fields := s.nameFields
+	fields.Index = index + 1
+	name, err := tmpl.Expand(fields, format)
+	if err != nil {
+		return "", err
+	}
+	// Without {index}, later images are told apart the way GenerateFilename
+	// does it.
+	if index > 0 && !tmpl.Has("index") {
+		ext := filepath.Ext(name)
+		name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), index+1, ext)
+	}
+	return filepath.Join(basePath, name), nil
+}
+
+// IsOutputDir reports whether an output path names a directory to save
+// into rather than a file: it is empty, ends in a path separator, or is an
+// existing directory.
+func IsOutputDir(path string) bool {
+	if path == "" || strings.HasSuffix(path, "/") || strings.HasSuffix(path, string(filepath.Separator)) {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
 func (s *Saver) generatePath(basePath string, index, total int, format models.OutputFormat) string {
 	if basePath != "" {
 		if total == 1 {
@@ -145,7 +355,7 @@ func (s *Saver) SaveVideo(ctx context.Context, video *models.GeneratedVideo, pat
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := writeFileAtomic(ctx, path, bytes.NewReader(data)); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -1,15 +1,20 @@
 package image
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/manash/imggen/internal/provider"
 	"github.com/manash/imggen/internal/security"
 	"github.com/manash/imggen/pkg/models"
 )
@@ -27,8 +32,8 @@ func TestNewSaver(t *testing.T) {
 	if s == nil {
 		t.Fatal("NewSaver() returned nil")
 	}
-	if s.httpClient == nil {
-		t.Fatal("NewSaver() httpClient is nil")
+	if s.downloader == nil {
+		t.Fatal("NewSaver() downloader is nil")
 	}
 }
 
@@ -129,6 +134,64 @@ func TestSaver_Save_DownloadError(t *testing.T) {
 	}
 }
 
+func TestSaver_Save_RetriesAndResumesDownload(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 1000)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		switch len(ranges) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		case 2:
+			// Send part of the body, then drop the connection.
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", "10000")
+			w.WriteHeader(http.StatusOK)
+			w.Write(body[:4000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "image.png", time.Time{}, bytes.NewReader(body))
+	}))
+	defer server.Close()
+
+	s := NewSaver().WithDownloader(&provider.Downloader{MaxRetries: 3, RetryBaseDelay: time.Millisecond})
+	path := filepath.Join(t.TempDir(), "downloaded.png")
+
+	if err := s.Save(context.Background(), &models.GeneratedImage{URL: server.URL}, path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read saved file: %v", err)
+	}
+	if !bytes.Equal(data, body) {
+		t.Errorf("saved %d bytes, want the %d-byte body intact", len(data), len(body))
+	}
+	if want := []string{"", "", "bytes=4000-"}; !slices.Equal(ranges, want) {
+		t.Errorf("Range headers = %q, want %q", ranges, want)
+	}
+}
+
+func TestSaver_Save_DownloadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	s := NewSaver().WithDownloader(&provider.Downloader{Timeout: 50 * time.Millisecond})
+	err := s.Save(context.Background(), &models.GeneratedImage{URL: server.URL}, filepath.Join(t.TempDir(), "slow.png"))
+
+	var timeoutErr *provider.TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Op != "download" {
+		t.Errorf("Save() error = %v, want a download timeout", err)
+	}
+}
+
 func TestSaver_Save_CreatesDirectory(t *testing.T) {
 	s := NewSaver()
 	tmpDir := t.TempDir()
@@ -202,6 +265,74 @@ func TestSaver_SaveAll(t *testing.T) {
 	}
 }
 
+func TestSaver_SaveAll_DownloadTiming(t *testing.T) {
+	const delay = 15 * time.Millisecond
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(delay)
+		w.Write([]byte("image data"))
+	}))
+	defer server.Close()
+
+	resp := &models.Response{
+		Images: []models.GeneratedImage{
+			{URL: server.URL + "/1.png", Index: 0},
+			{Data: []byte("inline"), Index: 1},
+			{URL: server.URL + "/3.png", Index: 2},
+		},
+		Timing: models.Timing{RequestDuration: time.Second, TotalDuration: time.Second},
+	}
+
+	if _, err := NewSaver().SaveAll(context.Background(), resp, filepath.Join(t.TempDir(), "img.png"), models.FormatPNG); err != nil {
+		t.Fatalf("SaveAll() error = %v", err)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("server hit %d times, want each URL downloaded once", n)
+	}
+	got := resp.Timing
+	if got.DownloadDuration < delay {
+		t.Errorf("DownloadDuration = %v, want at least %v", got.DownloadDuration, delay)
+	}
+	if got.TotalDuration != time.Second+got.DownloadDuration {
+		t.Errorf("TotalDuration = %v, want the request time plus downloads", got.TotalDuration)
+	}
+	if got.RequestDuration != time.Second {
+		t.Errorf("RequestDuration = %v, want it unchanged", got.RequestDuration)
+	}
+}
+
+func TestSaver_WriteImage(t *testing.T) {
+	png := encodeTestPNG(t, 255)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(png)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	resp := &models.Response{Images: []models.GeneratedImage{{URL: server.URL + "/a.png"}}}
+	if err := NewSaver().WriteImage(context.Background(), resp, &buf, models.FormatPNG); err != nil {
+		t.Fatalf("WriteImage() error = %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), png) {
+		t.Errorf("WriteImage() wrote %d bytes, want the %d-byte PNG", buf.Len(), len(png))
+	}
+
+	buf.Reset()
+	resp = &models.Response{Images: []models.GeneratedImage{{Data: png}}}
+	if err := NewSaver().WriteImage(context.Background(), resp, &buf, models.FormatJPEG); err != nil {
+		t.Fatalf("WriteImage(jpeg) error = %v", err)
+	}
+	if DetectFormat(buf.Bytes()) != models.FormatJPEG {
+		t.Error("WriteImage(jpeg) did not convert the image")
+	}
+
+	resp = &models.Response{Images: []models.GeneratedImage{{Data: png}, {Data: png}}}
+	if err := NewSaver().WriteImage(context.Background(), resp, &buf, models.FormatPNG); err == nil {
+		t.Error("WriteImage() with two images should fail")
+	}
+}
+
 func TestSaver_SaveAll_SingleImage(t *testing.T) {
 	s := NewSaver()
 	tmpDir := t.TempDir()
@@ -702,3 +833,51 @@ func TestSaver_SaveVideo_WriteFailure(t *testing.T) {
 		t.Errorf("SaveVideo() error = %v, want write/directory error", err)
 	}
 }
+
+// cancelAfterCtx reports cancellation once Err has been checked n times, so
+// tests can cancel deterministically between saves.
+type cancelAfterCtx struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfterCtx) Err() error {
+	if c.n <= 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func TestSaver_SaveAll_CanceledPartway(t *testing.T) {
+	s := NewSaver()
+	tmpDir := t.TempDir()
+	basePath := filepath.Join(tmpDir, "image.png")
+
+	resp := &models.Response{
+		Images: []models.GeneratedImage{
+			{Data: []byte("img1")},
+			{Data: []byte("img2")},
+			{Data: []byte("img3")},
+		},
+	}
+
+	ctx := &cancelAfterCtx{Context: context.Background(), n: 1}
+	paths, err := s.SaveAll(ctx, resp, basePath, models.FormatPNG)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("SaveAll() error = %v, want context.Canceled", err)
+	}
+	if !strings.Contains(err.Error(), "after 1 of 3 images") {
+		t.Errorf("SaveAll() error = %q, want progress in message", err)
+	}
+
+	if len(paths) != 1 {
+		t.Fatalf("SaveAll() returned %d paths, want 1", len(paths))
+	}
+	if _, err := os.Stat(paths[0]); err != nil {
+		t.Errorf("already-written file was removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "image-2.png")); !os.IsNotExist(err) {
+		t.Error("SaveAll() kept writing after cancellation")
+	}
+}
@@ -0,0 +1,84 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"os"
+)
+
+// ErrInputTooLarge matches every *LimitError, for callers that only need to
+// know an input image was rejected before upload.
+var ErrInputTooLarge = errors.New("input image exceeds upload limits")
+
+// InputLimits are the constraints an API places on an uploaded image.
+// Zero values mean no limit.
+type InputLimits struct {
+	MaxBytes int64
+	Square   bool
+}
+
+// LimitError reports which upload limit an input image broke.
+type LimitError struct {
+	Input string // which input, e.g. "image" or "mask"
+	Got   string // what the input measured
+	Limit string // the limit it broke
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s is %s, limit is %s", e.Input, e.Got, e.Limit)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrInputTooLarge
+}
+
+// ValidateInput checks data, named input in errors, against limits before it
+// is uploaded. Dimensions are read from the image header without decoding the
+// pixels, so the check is cheap even for large files. Data whose header cannot
+// be read is left for the API to judge.
+func ValidateInput(input string, data []byte, limits InputLimits) error {
+	if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes {
+		got := fmt.Sprintf("%s (%d bytes)", formatBytes(int64(len(data))), len(data))
+		return &LimitError{Input: input, Got: got, Limit: formatBytes(limits.MaxBytes)}
+	}
+
+	if limits.Square {
+		cfg, _, err := stdimage.DecodeConfig(bytes.NewReader(data))
+		if err == nil && cfg.Width != cfg.Height {
+			return &LimitError{Input: input, Got: fmt.Sprintf("%dx%d", cfg.Width, cfg.Height), Limit: "a square image"}
+		}
+	}
+
+	return nil
+}
+
+// FileDimensions reads the width and height of the image at path from its
+// header, without decoding the pixels.
+func FileDimensions(path string) (width, height int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	cfg, _, err := stdimage.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read image: %w", err)
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// formatBytes renders n in megabytes when it is at least one, e.g. 4 MB or
+// 30.2 MB.
+func formatBytes(n int64) string {
+	const mb = 1 << 20
+	switch {
+	case n >= mb && n%mb == 0:
+		return fmt.Sprintf("%d MB", n/mb)
+	case n >= mb:
+		return fmt.Sprintf("%.1f MB", float64(n)/mb)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
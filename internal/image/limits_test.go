@@ -0,0 +1,84 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	stdimage "image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// paddedPNG encodes a w x h PNG and pads it with trailing bytes to size,
+// which image headers ignore.
+func paddedPNG(t *testing.T, w, h, size int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, stdimage.NewRGBA(stdimage.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > size {
+		t.Fatalf("encoded PNG is %d bytes, larger than %d", buf.Len(), size)
+	}
+	return append(buf.Bytes(), make([]byte, size-buf.Len())...)
+}
+
+func TestValidateInput(t *testing.T) {
+	const limit = 4 << 20
+	dalle2 := InputLimits{MaxBytes: limit, Square: true}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		limits  InputLimits
+		wantErr string
+	}{
+		{"at size limit", paddedPNG(t, 8, 8, limit), dalle2, ""},
+		{"one byte over", paddedPNG(t, 8, 8, limit+1), dalle2, "image is 4.0 MB (4194305 bytes), limit is 4 MB"},
+		{"well over", paddedPNG(t, 8, 8, 30<<20), dalle2, "image is 30 MB (31457280 bytes), limit is 4 MB"},
+		{"not square", paddedPNG(t, 16, 9, 1024), dalle2, "image is 16x9, limit is a square image"},
+		{"not square allowed", paddedPNG(t, 16, 9, 1024), InputLimits{MaxBytes: limit}, ""},
+		{"undecodable header", []byte("not an image"), dalle2, ""},
+		{"no limits", paddedPNG(t, 16, 9, limit+1), InputLimits{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateInput("image", tt.data, tt.limits)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateInput() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateInput() error = %v, want %q", err, tt.wantErr)
+			}
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || !errors.Is(err, ErrInputTooLarge) {
+				t.Errorf("ValidateInput() error = %#v, want a *LimitError matching ErrInputTooLarge", err)
+			}
+		})
+	}
+}
+
+func TestFileDimensions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wide.png")
+	if err := os.WriteFile(path, paddedPNG(t, 300, 120, 1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if w, h, err := FileDimensions(path); err != nil || w != 300 || h != 120 {
+		t.Errorf("FileDimensions() = %d, %d, %v, want 300, 120", w, h, err)
+	}
+
+	notImage := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notImage, []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := FileDimensions(notImage); err == nil {
+		t.Error("FileDimensions(text file) error = nil")
+	}
+}
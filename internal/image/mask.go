@@ -0,0 +1,73 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/color"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// ErrNoAlpha is returned by MaskFromAlpha for images without an alpha
+// channel, or whose alpha channel has no fully transparent pixels.
+var ErrNoAlpha = errors.New("image has no transparent pixels to use as a mask")
+
+// MaskFromAlpha builds an edit mask from an image's alpha channel. Fully
+// transparent pixels stay transparent in the mask, marking the area to
+// edit; every other pixel becomes opaque black. The mask is PNG encoded and
+// the same size as the image.
+func MaskFromAlpha(data []byte) ([]byte, error) {
+	img, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if !hasAlphaChannel(img) {
+		return nil, fmt.Errorf("%w: it has no alpha channel", ErrNoAlpha)
+	}
+
+	b := img.Bounds()
+	mask := stdimage.NewNRGBA(stdimage.Rect(0, 0, b.Dx(), b.Dy()))
+	editable := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a == 0 {
+				editable++
+				continue
+			}
+			mask.SetNRGBA(x-b.Min.X, y-b.Min.Y, color.NRGBA{A: 0xFF})
+		}
+	}
+	if editable == 0 {
+		return nil, fmt.Errorf("%w: every pixel is at least partly opaque", ErrNoAlpha)
+	}
+
+	encoded, err := encode(mask, models.FormatPNG, EncodeOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode mask: %w", err)
+	}
+	return encoded, nil
+}
+
+// hasAlphaChannel reports whether img's color model can represent
+// transparency. Paletted images qualify only if their palette has a
+// transparent entry.
+func hasAlphaChannel(img stdimage.Image) bool {
+	switch m := img.ColorModel(); m {
+	case color.RGBAModel, color.RGBA64Model, color.NRGBAModel, color.NRGBA64Model,
+		color.AlphaModel, color.Alpha16Model:
+		return true
+	default:
+		palette, ok := m.(color.Palette)
+		if !ok {
+			return false
+		}
+		for _, c := range palette {
+			if _, _, _, a := c.RGBA(); a < 0xFFFF {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,82 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	stdimage "image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img stdimage.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMaskFromAlpha(t *testing.T) {
+	// A 4x2 image whose left half is fully transparent and whose right half
+	// is opaque, except for one half-transparent pixel.
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, 4, 2))
+	for y := range 2 {
+		for x := range 4 {
+			a := uint8(0xFF)
+			if x < 2 {
+				a = 0
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: 200, G: 50, B: 10, A: a})
+		}
+	}
+	img.SetNRGBA(3, 1, color.NRGBA{R: 200, A: 0x80})
+
+	data, err := MaskFromAlpha(encodePNG(t, img))
+	if err != nil {
+		t.Fatalf("MaskFromAlpha() error = %v", err)
+	}
+	mask, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("mask is not a PNG: %v", err)
+	}
+	if got := mask.Bounds(); got.Dx() != 4 || got.Dy() != 2 {
+		t.Fatalf("mask size = %dx%d, want 4x2", got.Dx(), got.Dy())
+	}
+	for y := range 2 {
+		for x := range 4 {
+			_, _, _, a := mask.At(x, y).RGBA()
+			wantEditable := x < 2
+			if (a == 0) != wantEditable {
+				t.Errorf("mask pixel (%d,%d) alpha = %#x, want editable = %v", x, y, a, wantEditable)
+			}
+		}
+	}
+}
+
+func TestMaskFromAlpha_NoAlpha(t *testing.T) {
+	tests := []struct {
+		name string
+		img  stdimage.Image
+	}{
+		{"no alpha channel", stdimage.NewGray(stdimage.Rect(0, 0, 2, 2))},
+		{"opaque palette", stdimage.NewPaletted(stdimage.Rect(0, 0, 2, 2), color.Palette{color.Black, color.White})},
+		{"fully opaque", opaqueNRGBA(2, 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := MaskFromAlpha(encodePNG(t, tt.img)); !errors.Is(err, ErrNoAlpha) {
+				t.Errorf("MaskFromAlpha() error = %v, want ErrNoAlpha", err)
+			}
+		})
+	}
+}
+
+func opaqueNRGBA(w, h int) *stdimage.NRGBA {
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xFF
+	}
+	return img
+}
@@ -0,0 +1,327 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf16"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// GenerationParams are the settings an image was generated with, as
+// EmbedParams records them and ReadParams recovers them.
+type GenerationParams struct {
+	Prompt        string    `json:"prompt"`
+	RevisedPrompt string    `json:"revised_prompt,omitempty"`
+	Model         string    `json:"model"`
+	Size          string    `json:"size,omitempty"`
+	Quality       string    `json:"quality,omitempty"`
+	Seed          int64     `json:"seed,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// NewGenerationParams returns the parameters of a generation from its
+// request and response, timestamped with the creation time the API
+// reported or, failing that, now.
+func NewGenerationParams(req *models.Request, resp *models.Response) *GenerationParams {
+	createdAt := resp.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	model := req.Model
+	if resp.ModelUsed != "" {
+		model = resp.ModelUsed
+	}
+	return &GenerationParams{
+		Prompt:        req.Prompt,
+		RevisedPrompt: resp.RevisedPrompt,
+		Model:         model,
+		Size:          req.Size,
+		Quality:       req.Quality,
+		Seed:          req.Seed,
+		CreatedAt:     createdAt.UTC().Truncate(time.Second),
+	}
+}
+
+// PNG text keywords the parameters are stored under. "Software" and
+// "Creation Time" are keywords the PNG specification predefines.
+const (
+	pngKeySoftware      = "Software"
+	pngKeyPrompt        = "Prompt"
+	pngKeyRevisedPrompt = "Revised Prompt"
+	pngKeyModel         = "Model"
+	pngKeySize          = "Size"
+	pngKeyQuality       = "Quality"
+	pngKeySeed          = "Seed"
+	pngKeyCreationTime  = "Creation Time"
+)
+
+// pngParamKeys lists every keyword EmbedParams writes, so re-embedding
+// replaces rather than duplicates them.
+var pngParamKeys = map[string]bool{
+	pngKeySoftware: true, pngKeyPrompt: true, pngKeyRevisedPrompt: true, pngKeyModel: true,
+	pngKeySize: true, pngKeyQuality: true, pngKeySeed: true, pngKeyCreationTime: true,
+}
+
+// TIFF tags and the UserComment character code used for JPEG parameters.
+const (
+	tagExifIFD     = 0x8769
+	tagUserComment = 0x9286
+)
+
+var userCommentASCII = []byte("ASCII\x00\x00\x00")
+
+// EmbedParams records params in a PNG as text chunks, or in a JPEG as a
+// JSON EXIF UserComment, replacing any EXIF the JPEG already has. Other
+// formats, such as WebP, are returned unchanged.
+func EmbedParams(data []byte, params *GenerationParams) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		return writePNGParams(data, params)
+	case DetectFormat(data) == models.FormatJPEG:
+		comment, err := asciiJSON(params)
+		if err != nil {
+			return nil, err
+		}
+		return writeJPEGEXIF(data, userCommentEXIF(append(bytes.Clone(userCommentASCII), comment...)))
+	default:
+		return data, nil
+	}
+}
+
+// ReadParams returns the parameters EmbedParams recorded in a PNG or JPEG,
+// or nil if there are none.
+func ReadParams(data []byte) (*GenerationParams, error) {
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		return readPNGParams(data)
+	case DetectFormat(data) == models.FormatJPEG:
+		exif, err := readJPEGEXIF(data)
+		if err != nil || exif == nil {
+			return nil, err
+		}
+		comment := userComment(exif)
+		if !bytes.HasPrefix(comment, userCommentASCII) {
+			return nil, nil
+		}
+		var params GenerationParams
+		if err := json.Unmarshal(comment[len(userCommentASCII):], &params); err != nil {
+			// A UserComment some other tool wrote.
+			return nil, nil
+		}
+		return &params, nil
+	case DetectFormat(data) == models.FormatWebP:
+		return nil, nil
+	default:
+		return nil, errors.New("unsupported image format: expected png, jpeg, or webp")
+	}
+}
+
+// writePNGParams drops any text chunk under one of pngParamKeys and adds
+// the parameters right after IHDR. Values that are not plain ASCII go in
+// iTXt chunks, which hold UTF-8; tEXt is limited to Latin-1.
+func writePNGParams(data []byte, params *GenerationParams) ([]byte, error) {
+	fields := [][2]string{
+		{pngKeySoftware, "imggen"},
+		{pngKeyPrompt, params.Prompt},
+		{pngKeyRevisedPrompt, params.RevisedPrompt},
+		{pngKeyModel, params.Model},
+		{pngKeySize, params.Size},
+		{pngKeyQuality, params.Quality},
+		{pngKeyCreationTime, params.CreatedAt.Format(time.RFC3339)},
+	}
+	if params.Seed != 0 {
+		fields = append(fields, [2]string{pngKeySeed, strconv.FormatInt(params.Seed, 10)})
+	}
+
+	return rewritePNG(data, func(name string, payload []byte) bool {
+		key, _, ok := pngText(name, payload)
+		return ok && pngParamKeys[key]
+	}, func(out *bytes.Buffer) {
+		for _, f := range fields {
+			if f[1] == "" {
+				continue
+			}
+			if isASCII(f[1]) {
+				writePNGChunk(out, "tEXt", []byte(f[0]+"\x00"+f[1]))
+			} else {
+				// Uncompressed, with no language tag or translated keyword.
+				writePNGChunk(out, "iTXt", []byte(f[0]+"\x00\x00\x00\x00\x00"+f[1]))
+			}
+		}
+	})
+}
+
+func readPNGParams(data []byte) (*GenerationParams, error) {
+	text := make(map[string]string)
+	err := walkPNGChunks(data, func(name string, _, payload []byte) {
+		if key, value, ok := pngText(name, payload); ok && pngParamKeys[key] {
+			text[key] = value
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if text[pngKeySoftware] != "imggen" {
+		return nil, nil
+	}
+
+	params := &GenerationParams{
+		Prompt:        text[pngKeyPrompt],
+		RevisedPrompt: text[pngKeyRevisedPrompt],
+		Model:         text[pngKeyModel],
+		Size:          text[pngKeySize],
+		Quality:       text[pngKeyQuality],
+	}
+	if s := text[pngKeySeed]; s != "" {
+		if params.Seed, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid seed %q: %w", s, err)
+		}
+	}
+	if s := text[pngKeyCreationTime]; s != "" {
+		if params.CreatedAt, err = time.Parse(time.RFC3339, s); err != nil {
+			return nil, fmt.Errorf("invalid creation time %q: %w", s, err)
+		}
+	}
+	return params, nil
+}
+
+// pngText returns the keyword and text of a tEXt chunk, or of an
+// uncompressed iTXt chunk.
+func pngText(name string, payload []byte) (key, value string, ok bool) {
+	if name != "tEXt" && name != "iTXt" {
+		return "", "", false
+	}
+	k, rest, found := bytes.Cut(payload, []byte{0})
+	if !found {
+		return "", "", false
+	}
+	switch name {
+	case "tEXt":
+		return string(k), string(rest), true
+	case "iTXt":
+		// Compression flag and method, then language tag and translated
+		// keyword, each null-terminated.
+		if len(rest) < 2 || rest[0] != 0 {
+			return "", "", false
+		}
+		_, rest, _ = bytes.Cut(rest[2:], []byte{0})
+		_, text, found := bytes.Cut(rest, []byte{0})
+		return string(k), string(text), found
+	}
+	return "", "", false
+}
+
+func isASCII(s string) bool {
+	for i := range len(s) {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// asciiJSON encodes v as JSON with every non-ASCII character escaped, as
+// the ASCII UserComment character code requires.
+func asciiJSON(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	for _, r := range string(data) {
+		if r < 0x80 {
+			out.WriteRune(r)
+			continue
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&out, `\u%04x`, u)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// userCommentEXIF builds a little-endian TIFF structure whose only tag is
+// an EXIF IFD holding comment as the UserComment.
+func userCommentEXIF(comment []byte) []byte {
+	const (
+		ifd0    = 8
+		exifIFD = ifd0 + 2 + 12 + 4
+		value   = exifIFD + 2 + 12 + 4
+	)
+	le := binary.LittleEndian
+	b := []byte("II*\x00")
+	b = le.AppendUint32(b, ifd0)
+
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, tagExifIFD)
+	b = le.AppendUint16(b, 4) // LONG
+	b = le.AppendUint32(b, 1)
+	b = le.AppendUint32(b, exifIFD)
+	b = le.AppendUint32(b, 0) // no next IFD
+
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, tagUserComment)
+	b = le.AppendUint16(b, 7) // UNDEFINED
+	b = le.AppendUint32(b, uint32(len(comment)))
+	b = le.AppendUint32(b, value)
+	b = le.AppendUint32(b, 0)
+
+	return append(b, comment...)
+}
+
+// userComment returns the UserComment in the EXIF IFD of exif, including
+// its character code, or nil if there is none.
+func userComment(exif []byte) []byte {
+	if len(exif) < 8 || !isTIFF(exif) {
+		return nil
+	}
+	order := tiffByteOrder(exif)
+	exifIFD := -1
+	ifdEntries(exif, order, int(order.Uint32(exif[4:])), func(tag uint16, entry int) {
+		if tag == tagExifIFD {
+			exifIFD = int(order.Uint32(exif[entry+8:]))
+		}
+	})
+	if exifIFD < 0 {
+		return nil
+	}
+
+	var comment []byte
+	ifdEntries(exif, order, exifIFD, func(tag uint16, entry int) {
+		if tag != tagUserComment {
+			return
+		}
+		count := int(order.Uint32(exif[entry+4:]))
+		if count <= 4 {
+			comment = exif[entry+8 : entry+8+count]
+			return
+		}
+		off := int(order.Uint32(exif[entry+8:]))
+		if off >= 0 && off+count <= len(exif) {
+			comment = exif[off : off+count]
+		}
+	})
+	return comment
+}
+
+// ifdEntries calls fn with the tag and offset of every complete entry of the
+// IFD at offset ifd.
+func ifdEntries(exif []byte, order binary.ByteOrder, ifd int, fn func(tag uint16, entry int)) {
+	if ifd < 8 || ifd+2 > len(exif) {
+		return
+	}
+	count := int(order.Uint16(exif[ifd:]))
+	for i := range count {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(exif) {
+			return
+		}
+		fn(order.Uint16(exif[entry:]), entry)
+	}
+}
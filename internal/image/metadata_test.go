@@ -0,0 +1,137 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	stdimage "image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+func testParams() *GenerationParams {
+	return &GenerationParams{
+		Prompt:        "a café at dusk, 夜",
+		RevisedPrompt: "A cozy café at dusk.",
+		Model:         "stable-diffusion-xl",
+		Size:          "1024x1024",
+		Quality:       "high",
+		Seed:          42,
+		CreatedAt:     time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestEmbedParams_RoundTrip(t *testing.T) {
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, stdimage.NewRGBA(stdimage.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"png", encodeTestPNG(t, 128)},
+		{"jpeg", jpg.Bytes()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := testParams()
+			out, err := EmbedParams(tt.data, want)
+			if err != nil {
+				t.Fatalf("EmbedParams() error = %v", err)
+			}
+			// Embedding again replaces the first set instead of adding to it.
+			want.Prompt = "a second prompt"
+			if out, err = EmbedParams(out, want); err != nil {
+				t.Fatalf("EmbedParams() again error = %v", err)
+			}
+
+			got, err := ReadParams(out)
+			if err != nil {
+				t.Fatalf("ReadParams() error = %v", err)
+			}
+			if got == nil || *got != *want {
+				t.Errorf("ReadParams() = %+v, want %+v", got, want)
+			}
+			if pixelHash(t, out) != pixelHash(t, tt.data) {
+				t.Error("pixel data changed")
+			}
+		})
+	}
+}
+
+func TestEmbedParams_PNGChunks(t *testing.T) {
+	out, err := EmbedParams(encodeTestPNG(t, 128), testParams())
+	if err != nil {
+		t.Fatalf("EmbedParams() error = %v", err)
+	}
+	// ASCII values are plain tEXt; the non-ASCII prompt needs UTF-8 iTXt.
+	if !bytes.Contains(out, []byte("tEXtModel\x00stable-diffusion-xl")) {
+		t.Error("model not stored as tEXt")
+	}
+	if !bytes.Contains(out, []byte("iTXtPrompt\x00\x00\x00\x00\x00a café")) {
+		t.Error("non-ASCII prompt not stored as iTXt")
+	}
+
+	stripped, _, err := StripMetadata(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadParams(stripped); err != nil || got != nil {
+		t.Errorf("ReadParams(stripped) = %+v, %v, want nil", got, err)
+	}
+}
+
+func TestEmbedParams_WebPUnchanged(t *testing.T) {
+	webp := testWebP([]byte("VP8L\x01\x00\x00\x00\x2f\x00"))
+	out, err := EmbedParams(webp, testParams())
+	if err != nil {
+		t.Fatalf("EmbedParams() error = %v", err)
+	}
+	if !bytes.Equal(out, webp) {
+		t.Error("EmbedParams() changed a webp image")
+	}
+	if got, err := ReadParams(out); err != nil || got != nil {
+		t.Errorf("ReadParams(webp) = %+v, %v, want nil", got, err)
+	}
+}
+
+func TestReadParams_None(t *testing.T) {
+	if got, err := ReadParams(encodeTestPNG(t, 128)); err != nil || got != nil {
+		t.Errorf("ReadParams(plain png) = %+v, %v, want nil", got, err)
+	}
+	other := withPNGChunks(encodeTestPNG(t, 128), pngChunk("tEXt", []byte("Software\x00other tool")))
+	if got, err := ReadParams(other); err != nil || got != nil {
+		t.Errorf("ReadParams(other software) = %+v, %v, want nil", got, err)
+	}
+	// EXIF holding only a TIFF header, with no IFD offset.
+	headerOnly := []byte("\xFF\xD8\xFF\xE1\x00\x0CExif\x00\x00II*\x00\xFF\xDA\x00\x02\xFF\xD9")
+	if got, err := ReadParams(headerOnly); err != nil || got != nil {
+		t.Errorf("ReadParams(short exif) = %+v, %v, want nil", got, err)
+	}
+}
+
+func TestSaver_WithParams(t *testing.T) {
+	saver := NewSaver()
+	path := filepath.Join(t.TempDir(), "cat.png")
+	resp := &models.Response{Images: []models.GeneratedImage{{Data: encodeTestPNG(t, 255)}}}
+	if _, err := saver.WithParams(testParams()).SaveAll(context.Background(), resp, path, models.FormatPNG); err != nil {
+		t.Fatalf("SaveAll() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadParams(data); err != nil || got == nil || got.Seed != 42 {
+		t.Errorf("ReadParams(saved) = %+v, %v, want the embedded params", got, err)
+	}
+	if saver.params != nil {
+		t.Error("WithParams() changed the original Saver")
+	}
+}
@@ -0,0 +1,133 @@
+package image
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/manash/imggen/internal/security"
+	"github.com/manash/imggen/pkg/models"
+)
+
+// NameTemplate names output files from tokens such as {index} and
+// {prompt}. The file extension is added for the image's format.
+type NameTemplate string
+
+// DefaultNameTemplate names the images saved into a directory the way
+// GenerateFilename does.
+const DefaultNameTemplate NameTemplate = "image-{date}"
+
+// BatchNameTemplate names each batch item's file after its position and
+// prompt, such as "001-sunset-over-mountains.png".
+const BatchNameTemplate NameTemplate = "{index}-{prompt}"
+
+// NameFields are the values a NameTemplate's tokens expand to.
+type NameFields struct {
+	// Index is the 1-based position of the image, or of the batch item.
+	Index  int
+	Prompt string
+	Model  string
+	Size   string
+	Seed   int64
+	Time   time.Time
+}
+
+// nameToken matches a {token} in a NameTemplate.
+var nameToken = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// nameTokens are the tokens a NameTemplate may use.
+var nameTokens = []string{"index", "prompt", "model", "size", "date", "seed"}
+
+// ParseNameTemplate checks that tmpl only uses known tokens and that its
+// literal text is a safe relative path.
+func ParseNameTemplate(tmpl string) (NameTemplate, error) {
+	if strings.TrimSpace(tmpl) == "" {
+		return "", fmt.Errorf("name template is empty")
+	}
+	for _, m := range nameToken.FindAllStringSubmatch(tmpl, -1) {
+		if !slices.Contains(nameTokens, m[1]) {
+			return "", fmt.Errorf("unknown name template token {%s}: valid tokens are {%s}", m[1], strings.Join(nameTokens, "}, {"))
+		}
+	}
+	t := NameTemplate(tmpl)
+	if _, err := t.Expand(NameFields{Index: 1, Prompt: "prompt", Model: "model", Size: "size"}, models.FormatPNG); err != nil {
+		return "", err
+	}
+	return t, nil
+}
+
+// Has reports whether the template uses token, given without braces.
+func (t NameTemplate) Has(token string) bool {
+	return strings.Contains(string(t), "{"+token+"}")
+}
+
+// Expand returns the relative path the template names for fields and
+// format. The prompt is reduced to a short lowercase slug and other values
+// are stripped of path separators; the result is rejected if it could
+// escape the output directory.
+func (t NameTemplate) Expand(fields NameFields, format models.OutputFormat) (string, error) {
+	date := fields.Time
+	if date.IsZero() {
+		date = time.Now()
+	}
+	name := nameToken.ReplaceAllStringFunc(string(t), func(token string) string {
+		switch token[1 : len(token)-1] {
+		case "index":
+			return fmt.Sprintf("%03d", fields.Index)
+		case "prompt":
+			return PromptSlug(fields.Prompt)
+		case "model":
+			return security.SanitizeFilename(fields.Model)
+		case "size":
+			return security.SanitizeFilename(fields.Size)
+		case "date":
+			return date.Format("20060102-150405")
+		case "seed":
+			return strconv.FormatInt(fields.Seed, 10)
+		}
+		return token
+	})
+	name += "." + string(format)
+
+	if err := security.ValidateSavePath(name); err != nil {
+		return "", fmt.Errorf("invalid name template %q: %w", string(t), err)
+	}
+	return name, nil
+}
+
+var windowsReservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true,
+	"com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true,
+	"lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+var promptSlugUnsafe = regexp.MustCompile(`[^a-zA-Z0-9\s-]`)
+
+// PromptSlug turns prompt into a filename-safe slug of at most 50
+// lowercase letters, digits, and hyphens, such as "a-sunset-over-mountains".
+func PromptSlug(prompt string) string {
+	sanitized := promptSlugUnsafe.ReplaceAllString(prompt, "")
+	sanitized = strings.ToLower(sanitized)
+	sanitized = strings.Join(strings.Fields(sanitized), "-")
+	sanitized = strings.TrimLeft(sanitized, "-")
+
+	if len(sanitized) > 50 {
+		sanitized = sanitized[:50]
+	}
+	sanitized = strings.TrimSuffix(sanitized, "-")
+
+	if sanitized == "" {
+		sanitized = "image"
+	}
+
+	if windowsReservedNames[sanitized] {
+		sanitized = sanitized + "-img"
+	}
+
+	return sanitized
+}
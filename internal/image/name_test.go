@@ -0,0 +1,168 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/manash/imggen/internal/security"
+	"github.com/manash/imggen/pkg/models"
+)
+
+func TestNameTemplate_Expand(t *testing.T) {
+	fields := NameFields{
+		Index:  7,
+		Prompt: "A sunset over mountains!",
+		Model:  "gpt-image-1",
+		Size:   "1024x1536",
+		Seed:   42,
+		Time:   time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		tmpl   NameTemplate
+		format models.OutputFormat
+		want   string
+	}{
+		{BatchNameTemplate, models.FormatPNG, "007-a-sunset-over-mountains.png"},
+		{DefaultNameTemplate, models.FormatJPEG, "image-20240501-123000.jpeg"},
+		{"{model}_{size}_{seed}", models.FormatWebP, "gpt-image-1_1024x1536_42.webp"},
+		{"{date}/{index}", models.FormatPNG, "20240501-123000/007.png"},
+		{"shot-{index}-{index}", models.FormatPNG, "shot-007-007.png"},
+		{"plain", models.FormatPNG, "plain.png"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.tmpl), func(t *testing.T) {
+			got, err := tt.tmpl.Expand(fields, tt.format)
+			if err != nil || got != tt.want {
+				t.Errorf("Expand() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameTemplate_ExpandSanitizes(t *testing.T) {
+	fields := NameFields{Index: 1, Prompt: "../../etc/passwd", Model: "../evil", Size: "a/b"}
+
+	got, err := NameTemplate("{prompt}-{model}-{size}").Expand(fields, models.FormatPNG)
+	if err != nil {
+		t.Fatalf("Expand() error = %v", err)
+	}
+	if strings.Contains(got, "/") || strings.Contains(got, "..") {
+		t.Errorf("Expand() = %q, want no separators or traversal", got)
+	}
+
+	if _, err := NameTemplate("{model}").Expand(NameFields{Model: "a..b"}, models.FormatPNG); !errors.Is(err, security.ErrPathTraversal) {
+		t.Errorf("Expand(traversal) error = %v, want ErrPathTraversal", err)
+	}
+}
+
+func TestParseNameTemplate(t *testing.T) {
+	if tmpl, err := ParseNameTemplate("{index}-{model}"); err != nil || tmpl != "{index}-{model}" {
+		t.Errorf("ParseNameTemplate() = %q, %v", tmpl, err)
+	}
+
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"", "empty"},
+		{"{index}-{color}", "unknown name template token {color}"},
+		{"../{index}", "path traversal"},
+		{"/tmp/{index}", "absolute"},
+		{"-{index}", "hyphen"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			_, err := ParseNameTemplate(tt.tmpl)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseNameTemplate(%q) error = %v, want it to mention %q", tt.tmpl, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptSlug(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"a sunset over mountains", "a-sunset-over-mountains"},
+		{"Hello World!", "hello-world"},
+		{"test@#$%^&*()prompt", "testprompt"},
+		{"  multiple   spaces  ", "multiple-spaces"},
+		{"", "image"},
+		{"con", "con-img"},
+		{strings.Repeat("a", 100), strings.Repeat("a", 50)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := PromptSlug(tt.input)
+			if got != tt.want {
+				t.Errorf("PromptSlug(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaver_SaveAll_NameTemplate(t *testing.T) {
+	dir := t.TempDir()
+	fields := NameFields{Prompt: "red fox", Model: "dall-e-2", Time: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name  string
+		saver *Saver
+		want  []string
+	}{
+		{"index", NewSaver().WithNameTemplate("{index}-{prompt}", fields), []string{"001-red-fox.png", "002-red-fox.png"}},
+		{"no index", NewSaver().WithNameTemplate("{model}-{prompt}", fields), []string{"dall-e-2-red-fox.png", "dall-e-2-red-fox-2.png"}},
+		{"default", NewSaver().WithNameTemplate("", fields), []string{"image-20240501-123000.png", "image-20240501-123000-2.png"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(dir, tt.name) + string(filepath.Separator)
+			resp := &models.Response{Images: []models.GeneratedImage{
+				{Data: encodeTestPNG(t, 255)},
+				{Data: encodeTestPNG(t, 255)},
+			}}
+			paths, err := tt.saver.SaveAll(context.Background(), resp, out, models.FormatPNG)
+			if err != nil {
+				t.Fatalf("SaveAll() error = %v", err)
+			}
+			var got []string
+			for _, p := range paths {
+				got = append(got, filepath.Base(p))
+				if filepath.Dir(p) != filepath.Join(dir, tt.name) {
+					t.Errorf("saved %s outside the output directory", p)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("SaveAll() names = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"", true},
+		{dir, true},
+		{"out/", true},
+		{filepath.Join(dir, "image.png"), false},
+		{"out", false},
+	}
+	for _, tt := range tests {
+		if got := IsOutputDir(tt.path); got != tt.want {
+			t.Errorf("IsOutputDir(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// walkPNGChunks calls fn with every chunk of a PNG up to and including
+// IEND, passing the whole chunk and its payload.
+func walkPNGChunks(data []byte, fn func(name string, chunk, payload []byte)) error {
+	for pos := len(pngSignature); pos < len(data); {
+		if pos+8 > len(data) {
+			return errors.New("truncated png chunk header")
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		name := string(data[pos+4 : pos+8])
+		end := pos + 12 + length // header, data, CRC
+		if end > len(data) {
+			return fmt.Errorf("truncated png chunk %q", name)
+		}
+		fn(name, data[pos:end], data[pos+8:end-4])
+		pos = end
+		if name == "IEND" {
+			break
+		}
+	}
+	return nil
+}
+
+// rewritePNG copies a PNG chunk by chunk, leaving out the chunks drop
+// reports true for. If insert is not nil it is called right after IHDR is
+// copied, to add new chunks there.
+func rewritePNG(data []byte, drop func(name string, payload []byte) bool, insert func(out *bytes.Buffer)) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+512))
+	out.Write(pngSignature)
+	err := walkPNGChunks(data, func(name string, chunk, payload []byte) {
+		if drop(name, payload) {
+			return
+		}
+		out.Write(chunk)
+		if name == "IHDR" && insert != nil {
+			insert(out)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func writePNGChunk(out *bytes.Buffer, name string, payload []byte) {
+	binary.Write(out, binary.BigEndian, uint32(len(payload)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(name))
+	crc.Write(payload)
+	out.WriteString(name)
+	out.Write(payload)
+	binary.Write(out, binary.BigEndian, crc.Sum32())
+}
@@ -0,0 +1,175 @@
+package image
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// Provenance marks an image as AI-generated. It is stored as an XMP packet
+// (in a PNG iTXt chunk keyed "XML:com.adobe.xmp", or a JPEG APP1 segment)
+// using the IPTC DigitalSourceType "trainedAlgorithmicMedia" and the XMP
+// CreatorTool and CreateDate properties, plus the model and a hash of the
+// prompt in the imggen namespace, ProvenanceNamespace. It is not a signed
+// C2PA manifest: anyone can write or remove it.
+type Provenance struct {
+	Generator         string    `json:"generator"`
+	Model             string    `json:"model"`
+	CreatedAt         time.Time `json:"created_at"`
+	PromptHash        string    `json:"prompt_hash"`
+	DigitalSourceType string    `json:"digital_source_type"`
+}
+
+// ProvenanceNamespace is the XMP namespace of the imggen provenance
+// properties Model and PromptHash.
+const ProvenanceNamespace = "https://github.com/manashmandal/imggen/ns/provenance/1.0/"
+
+const (
+	// trainedAlgorithmicMedia is the IPTC digital source type for media
+	// created by a model trained on sampled content.
+	trainedAlgorithmicMedia = "http://cv.iptc.org/newscodes/digitalsourcetype/trainedAlgorithmicMedia"
+
+	nsIPTCExt = "http://iptc.org/std/Iptc4xmpExt/2008-02-29/"
+	nsXMP     = "http://ns.adobe.com/xap/1.0/"
+
+	// pngKeyXMP is the iTXt keyword XMP is stored under in PNG files.
+	pngKeyXMP = "XML:com.adobe.xmp"
+)
+
+// jpegXMPHeader prefixes XMP packets in JPEG APP1 segments.
+var jpegXMPHeader = []byte(nsXMP + "\x00")
+
+// NewProvenance returns the provenance of a generation: the model that
+// produced it, when the API says it did (or now), and the SHA-256 of the
+// prompt rather than the prompt itself.
+func NewProvenance(req *models.Request, resp *models.Response) *Provenance {
+	params := NewGenerationParams(req, resp)
+	sum := sha256.Sum256([]byte(req.Prompt))
+	return &Provenance{
+		Generator:         "imggen",
+		Model:             params.Model,
+		CreatedAt:         params.CreatedAt,
+		PromptHash:        "sha256:" + hex.EncodeToString(sum[:]),
+		DigitalSourceType: trainedAlgorithmicMedia,
+	}
+}
+
+// EmbedProvenance records p as XMP in a PNG or JPEG, replacing any XMP the
+// image already has. Other formats, such as WebP, are returned unchanged.
+func EmbedProvenance(data []byte, p *Provenance) ([]byte, error) {
+	packet := provenanceXMP(p)
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		return writePNGXMP(data, packet)
+	case DetectFormat(data) == models.FormatJPEG:
+		return writeJPEGAPP1(data, jpegXMPHeader, packet)
+	default:
+		return data, nil
+	}
+}
+
+// ReadProvenance returns the provenance EmbedProvenance recorded in a PNG
+// or JPEG, or nil if there is none.
+func ReadProvenance(data []byte) (*Provenance, error) {
+	var packet []byte
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		err := walkPNGChunks(data, func(name string, _, payload []byte) {
+			if key, value, ok := pngText(name, payload); ok && key == pngKeyXMP {
+				packet = []byte(value)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	case DetectFormat(data) == models.FormatJPEG:
+		segments, _, err := jpegHeaderSegments(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range segments {
+			if s.marker == 0xE1 && bytes.HasPrefix(s.payload, jpegXMPHeader) {
+				packet = s.payload[len(jpegXMPHeader):]
+			}
+		}
+	}
+	if packet == nil {
+		return nil, nil
+	}
+
+	var meta struct {
+		Descriptions []struct {
+			SourceType  string `xml:"http://iptc.org/std/Iptc4xmpExt/2008-02-29/ DigitalSourceType,attr"`
+			CreatorTool string `xml:"http://ns.adobe.com/xap/1.0/ CreatorTool,attr"`
+			CreateDate  string `xml:"http://ns.adobe.com/xap/1.0/ CreateDate,attr"`
+			Model       string `xml:"https://github.com/manashmandal/imggen/ns/provenance/1.0/ Model,attr"`
+			PromptHash  string `xml:"https://github.com/manashmandal/imggen/ns/provenance/1.0/ PromptHash,attr"`
+		} `xml:"RDF>Description"`
+	}
+	if err := xml.Unmarshal(packet, &meta); err != nil {
+		return nil, fmt.Errorf("malformed xmp: %w", err)
+	}
+	for _, d := range meta.Descriptions {
+		if d.PromptHash == "" {
+			// XMP some other tool wrote.
+			continue
+		}
+		p := &Provenance{
+			Generator:         d.CreatorTool,
+			Model:             d.Model,
+			PromptHash:        d.PromptHash,
+			DigitalSourceType: d.SourceType,
+		}
+		if d.CreateDate != "" {
+			var err error
+			if p.CreatedAt, err = time.Parse(time.RFC3339, d.CreateDate); err != nil {
+				return nil, fmt.Errorf("invalid create date %q: %w", d.CreateDate, err)
+			}
+		}
+		return p, nil
+	}
+	return nil, nil
+}
+
+// provenanceXMP renders p as an XMP packet with a single rdf:Description.
+func provenanceXMP(p *Provenance) []byte {
+	attr := func(s string) string {
+		var b bytes.Buffer
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\"\n")
+	fmt.Fprintf(&b, "    xmlns:Iptc4xmpExt=%q\n", nsIPTCExt)
+	fmt.Fprintf(&b, "    xmlns:xmp=%q\n", nsXMP)
+	fmt.Fprintf(&b, "    xmlns:imggen=%q\n", ProvenanceNamespace)
+	fmt.Fprintf(&b, "    Iptc4xmpExt:DigitalSourceType=\"%s\"\n", attr(p.DigitalSourceType))
+	fmt.Fprintf(&b, "    xmp:CreatorTool=\"%s\"\n", attr(p.Generator))
+	fmt.Fprintf(&b, "    xmp:CreateDate=\"%s\"\n", p.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "    imggen:Model=\"%s\"\n", attr(p.Model))
+	fmt.Fprintf(&b, "    imggen:PromptHash=\"%s\"/>\n", attr(p.PromptHash))
+	b.WriteString(" </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"r\"?>")
+	return b.Bytes()
+}
+
+// writePNGXMP drops any XMP chunk and adds packet in an uncompressed iTXt
+// chunk right after IHDR.
+func writePNGXMP(data, packet []byte) ([]byte, error) {
+	return rewritePNG(data, func(name string, payload []byte) bool {
+		key, _, ok := pngText(name, payload)
+		return ok && key == pngKeyXMP
+	}, func(out *bytes.Buffer) {
+		writePNGChunk(out, "iTXt", append([]byte(pngKeyXMP+"\x00\x00\x00\x00\x00"), packet...))
+	})
+}
@@ -0,0 +1,127 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	stdimage "image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+func TestNewProvenance(t *testing.T) {
+	created := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	req := &models.Request{Prompt: "a red fox", Model: "gpt-image-1"}
+	p := NewProvenance(req, &models.Response{CreatedAt: created})
+
+	want := Provenance{
+		Generator:         "imggen",
+		Model:             "gpt-image-1",
+		CreatedAt:         created,
+		PromptHash:        "sha256:647c3a6520b87d387c85a08faff768cf92f436d1477dabb951d7c6417813beb4",
+		DigitalSourceType: trainedAlgorithmicMedia,
+	}
+	if *p != want {
+		t.Errorf("NewProvenance() = %+v, want %+v", p, want)
+	}
+	if other := NewProvenance(&models.Request{Prompt: "a blue fox"}, &models.Response{}); other.PromptHash == p.PromptHash {
+		t.Error("different prompts have the same hash")
+	}
+}
+
+func TestEmbedProvenance_RoundTrip(t *testing.T) {
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, stdimage.NewRGBA(stdimage.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	want := &Provenance{
+		Generator:         "imggen",
+		Model:             `model "<quoted>" & co`,
+		CreatedAt:         time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC),
+		PromptHash:        "sha256:0123abcd",
+		DigitalSourceType: trainedAlgorithmicMedia,
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"png", encodeTestPNG(t, 128)},
+		{"jpeg", jpg.Bytes()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Generation parameters and provenance live side by side.
+			out, err := EmbedParams(tt.data, testParams())
+			if err != nil {
+				t.Fatalf("EmbedParams() error = %v", err)
+			}
+			if out, err = EmbedProvenance(out, &Provenance{PromptHash: "sha256:old"}); err != nil {
+				t.Fatalf("EmbedProvenance() error = %v", err)
+			}
+			if out, err = EmbedProvenance(out, want); err != nil {
+				t.Fatalf("EmbedProvenance() again error = %v", err)
+			}
+			if n := bytes.Count(out, []byte("imggen:PromptHash=")); n != 1 {
+				t.Errorf("found %d provenance blocks, want the first replaced", n)
+			}
+
+			got, err := ReadProvenance(out)
+			if err != nil {
+				t.Fatalf("ReadProvenance() error = %v", err)
+			}
+			if got == nil || *got != *want {
+				t.Errorf("ReadProvenance() = %+v, want %+v", got, want)
+			}
+			if params, err := ReadParams(out); err != nil || params == nil || params.Seed != 42 {
+				t.Errorf("ReadParams() = %+v, %v, want the parameters kept", params, err)
+			}
+			if pixelHash(t, out) != pixelHash(t, tt.data) {
+				t.Error("pixel data changed")
+			}
+		})
+	}
+}
+
+func TestReadProvenance_None(t *testing.T) {
+	if got, err := ReadProvenance(encodeTestPNG(t, 128)); err != nil || got != nil {
+		t.Errorf("ReadProvenance(plain png) = %+v, %v, want nil", got, err)
+	}
+	xmp := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:CreatorTool="Other"/></rdf:RDF></x:xmpmeta>`
+	other := withPNGChunks(encodeTestPNG(t, 128), pngChunk("iTXt", []byte(pngKeyXMP+"\x00\x00\x00\x00\x00"+xmp)))
+	if got, err := ReadProvenance(other); err != nil || got != nil {
+		t.Errorf("ReadProvenance(other xmp) = %+v, %v, want nil", got, err)
+	}
+
+	webp := testWebP([]byte("VP8L\x01\x00\x00\x00\x2f\x00"))
+	out, err := EmbedProvenance(webp, &Provenance{PromptHash: "sha256:0"})
+	if err != nil || !bytes.Equal(out, webp) {
+		t.Errorf("EmbedProvenance(webp) changed the image, error = %v", err)
+	}
+}
+
+func TestSaver_WithProvenance(t *testing.T) {
+	saver := NewSaver()
+	path := filepath.Join(t.TempDir(), "cat.png")
+	resp := &models.Response{Images: []models.GeneratedImage{{Data: encodeTestPNG(t, 255)}}}
+	p := NewProvenance(&models.Request{Prompt: "a cat", Model: "dall-e-3"}, resp)
+	if _, err := saver.WithProvenance(p).SaveAll(context.Background(), resp, path, models.FormatPNG); err != nil {
+		t.Fatalf("SaveAll() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadProvenance(data); err != nil || got == nil || got.Model != "dall-e-3" {
+		t.Errorf("ReadProvenance(saved) = %+v, %v, want the embedded provenance", got, err)
+	}
+	if saver.provenance != nil {
+		t.Error("WithProvenance() changed the original Saver")
+	}
+}
@@ -0,0 +1,161 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// Contact sheet layout, in pixels.
+const (
+	defaultSheetColumns  = 4
+	defaultSheetCellSize = 256
+	sheetPadding         = 8
+	sheetCaptionHeight   = 18
+)
+
+// ErrNoTiles is returned for a contact sheet without images.
+var ErrNoTiles = errors.New("a contact sheet needs at least one image")
+
+// SheetTile is one image of a contact sheet and the caption under it.
+type SheetTile struct {
+	Path    string
+	Caption string
+}
+
+// SheetOptions lay out a contact sheet. Zero values take the defaults of
+// four columns of 256 pixel cells.
+type SheetOptions struct {
+	Columns  int
+	CellSize int
+}
+
+func (o SheetOptions) withDefaults() SheetOptions {
+	if o.Columns <= 0 {
+		o.Columns = defaultSheetColumns
+	}
+	if o.CellSize <= 0 {
+		o.CellSize = defaultSheetCellSize
+	}
+	return o
+}
+
+// SheetSize returns the dimensions of a contact sheet of n images: a grid
+// of square cells, each with a caption line below it, that is never wider
+// than the images need.
+func SheetSize(n int, opts SheetOptions) (width, height int) {
+	if n <= 0 {
+		return 0, 0
+	}
+	opts = opts.withDefaults()
+	cols := min(opts.Columns, n)
+	rows := (n + cols - 1) / cols
+	width = cols*opts.CellSize + (cols+1)*sheetPadding
+	height = rows*(opts.CellSize+sheetCaptionHeight) + (rows+1)*sheetPadding
+	return width, height
+}
+
+// SheetFormat returns the format a contact sheet is written in from the
+// extension of its path.
+func SheetFormat(path string) (models.OutputFormat, error) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if ext == "jpg" {
+		ext = "jpeg"
+	}
+	format := models.OutputFormat(ext)
+	if !format.IsValid() {
+		return "", fmt.Errorf("unsupported contact sheet format %q: use a .png, .jpg, or .webp path", filepath.Ext(path))
+	}
+	return format, nil
+}
+
+// ContactSheet tiles the images at the tiles' paths into a grid, scaling
+// each to fit a uniform cell, and encodes it as format. Images are read
+// and decoded one at a time, so only the sheet itself is kept in memory.
+func ContactSheet(tiles []SheetTile, opts SheetOptions, format models.OutputFormat) ([]byte, error) {
+	if len(tiles) == 0 {
+		return nil, ErrNoTiles
+	}
+	opts = opts.withDefaults()
+
+	width, height := SheetSize(len(tiles), opts)
+	sheet := stdimage.NewRGBA(stdimage.Rect(0, 0, width, height))
+	draw.Draw(sheet, sheet.Bounds(), stdimage.White, stdimage.Point{}, draw.Src)
+
+	cols := min(opts.Columns, len(tiles))
+	for i, tile := range tiles {
+		x := sheetPadding + (i%cols)*(opts.CellSize+sheetPadding)
+		y := sheetPadding + (i/cols)*(opts.CellSize+sheetCaptionHeight+sheetPadding)
+		cell := stdimage.Rect(x, y, x+opts.CellSize, y+opts.CellSize)
+
+		if err := drawTile(sheet, cell, tile.Path); err != nil {
+			return nil, err
+		}
+		drawCaption(sheet, stdimage.Pt(x, cell.Max.Y), opts.CellSize, tile.Caption)
+	}
+
+	return encode(sheet, format, EncodeOptions{})
+}
+
+// drawTile decodes the image at path and draws it centered in cell, scaled
+// to fit while keeping its aspect ratio.
+func drawTile(dst draw.Image, cell stdimage.Rectangle, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer f.Close()
+
+	img, _, err := stdimage.Decode(f)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	b := img.Bounds()
+	w, h := cell.Dx(), cell.Dy()
+	if b.Dx()*h > b.Dy()*w {
+		h = max(1, b.Dy()*w/b.Dx())
+	} else {
+		w = max(1, b.Dx()*h/b.Dy())
+	}
+	origin := cell.Min.Add(stdimage.Pt((cell.Dx()-w)/2, (cell.Dy()-h)/2))
+	xdraw.ApproxBiLinear.Scale(dst, stdimage.Rectangle{Min: origin, Max: origin.Add(stdimage.Pt(w, h))}, img, b, draw.Over, nil)
+	return nil
+}
+
+// drawCaption writes caption on one line below a cell whose top-left
+// corner is at, shortening it with "..." when it is wider than the cell.
+// The built-in font only has ASCII glyphs; other characters become '?'.
+func drawCaption(dst draw.Image, at stdimage.Point, width int, caption string) {
+	face := basicfont.Face7x13
+	caption = strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return '?'
+		}
+		return r
+	}, strings.Join(strings.Fields(caption), " "))
+
+	if limit := width / face.Advance; len(caption) > limit {
+		caption = caption[:max(0, limit-3)] + "..."
+	}
+
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  stdimage.NewUniform(color.Black),
+		Face: face,
+		Dot:  fixed.P(at.X, at.Y+face.Ascent+2),
+	}
+	d.DrawString(caption)
+}
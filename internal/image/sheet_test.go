@@ -0,0 +1,160 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	stdimage "image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+func TestSheetSize(t *testing.T) {
+	tests := []struct {
+		n, cols, cell int
+		wantW, wantH  int
+	}{
+		{1, 4, 100, 116, 134},
+		{4, 4, 100, 440, 134},
+		{5, 4, 100, 440, 260},
+		{6, 2, 100, 224, 386},
+		{3, 0, 256, 800, 290},
+		{0, 4, 100, 0, 0},
+	}
+	for _, tt := range tests {
+		w, h := SheetSize(tt.n, SheetOptions{Columns: tt.cols, CellSize: tt.cell})
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("SheetSize(%d, cols %d, cell %d) = %dx%d, want %dx%d", tt.n, tt.cols, tt.cell, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestSheetFormat(t *testing.T) {
+	tests := []struct {
+		path string
+		want models.OutputFormat
+	}{
+		{"sheet.png", models.FormatPNG},
+		{"out/SHEET.JPG", models.FormatJPEG},
+		{"sheet.jpeg", models.FormatJPEG},
+		{"sheet.webp", models.FormatWebP},
+	}
+	for _, tt := range tests {
+		if got, err := SheetFormat(tt.path); err != nil || got != tt.want {
+			t.Errorf("SheetFormat(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+	if _, err := SheetFormat("sheet.gif"); err == nil || !strings.Contains(err.Error(), "unsupported contact sheet format") {
+		t.Errorf("SheetFormat(gif) error = %v", err)
+	}
+}
+
+// writeSolid saves a w×h image of color c at path, as JPEG if the path
+// says so and PNG otherwise.
+func writeSolid(t *testing.T, path string, w, h int, c color.Color) {
+	t.Helper()
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if filepath.Ext(path) == ".jpg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContactSheet_MixedSizes(t *testing.T) {
+	dir := t.TempDir()
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	tiles := []SheetTile{
+		{Path: filepath.Join(dir, "wide.png"), Caption: "a wide red image"},
+		{Path: filepath.Join(dir, "tall.jpg"), Caption: "a tall blue image with a caption far too long for its cell"},
+		{Path: filepath.Join(dir, "square.png"), Caption: "café"},
+	}
+	writeSolid(t, tiles[0].Path, 200, 50, red)
+	writeSolid(t, tiles[1].Path, 30, 120, blue)
+	writeSolid(t, tiles[2].Path, 10, 10, red)
+
+	opts := SheetOptions{Columns: 2, CellSize: 64}
+	data, err := ContactSheet(tiles, opts, models.FormatPNG)
+	if err != nil {
+		t.Fatalf("ContactSheet() error = %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantW, wantH := SheetSize(len(tiles), opts)
+	if b := img.Bounds(); b.Dx() != wantW || b.Dy() != wantH {
+		t.Fatalf("sheet is %dx%d, want %dx%d", b.Dx(), b.Dy(), wantW, wantH)
+	}
+
+	// Every image is scaled into its cell, centered, on a white background.
+	at := func(x, y int) color.RGBA {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 255}
+	}
+	cell := func(i int) stdimage.Point {
+		return stdimage.Pt(sheetPadding+(i%2)*(64+sheetPadding), sheetPadding+(i/2)*(64+sheetCaptionHeight+sheetPadding))
+	}
+	white := color.RGBA{255, 255, 255, 255}
+	checks := []struct {
+		name string
+		p    stdimage.Point
+		want color.RGBA
+	}{
+		{"wide center", cell(0).Add(stdimage.Pt(32, 32)), red},
+		{"wide letterbox", cell(0).Add(stdimage.Pt(32, 2)), white},
+		{"tall pillarbox", cell(1).Add(stdimage.Pt(2, 32)), white},
+		{"small upscaled", cell(2).Add(stdimage.Pt(2, 2)), red},
+	}
+	for _, c := range checks {
+		if got := at(c.p.X, c.p.Y); got != c.want {
+			t.Errorf("%s pixel = %v, want %v", c.name, got, c.want)
+		}
+	}
+	if got := at(cell(1).X+32, cell(1).Y+32); got.B < 200 || got.R > 50 {
+		t.Errorf("tall center pixel = %v, want blue", got)
+	}
+
+	var dark int
+	for x := cell(0).X; x < cell(0).X+64; x++ {
+		for y := cell(0).Y + 64; y < cell(0).Y+64+sheetCaptionHeight; y++ {
+			if at(x, y).R < 128 {
+				dark++
+			}
+		}
+	}
+	if dark == 0 {
+		t.Error("no caption drawn under the first image")
+	}
+}
+
+func TestContactSheet_Errors(t *testing.T) {
+	if _, err := ContactSheet(nil, SheetOptions{}, models.FormatPNG); !errors.Is(err, ErrNoTiles) {
+		t.Errorf("ContactSheet(nil) error = %v, want ErrNoTiles", err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.png")
+	if _, err := ContactSheet([]SheetTile{{Path: missing}}, SheetOptions{}, models.FormatPNG); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ContactSheet(missing) error = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,173 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// pngKeepChunks lists the ancillary PNG chunks that affect how pixels are
+// rendered. Every other ancillary chunk, including tEXt, zTXt, iTXt, eXIf,
+// and tIME, is metadata and is dropped.
+var pngKeepChunks = map[string]bool{
+	"tRNS": true, "gAMA": true, "cHRM": true, "sRGB": true, "iCCP": true,
+	"sBIT": true, "bKGD": true, "pHYs": true,
+	// APNG animation chunks.
+	"acTL": true, "fcTL": true, "fdAT": true,
+}
+
+// StripMetadata removes text, EXIF, XMP, and comment data from a PNG, JPEG,
+// or WebP image and reports how many chunks or segments were removed. The
+// image data itself is copied byte for byte, so pixels are unchanged.
+func StripMetadata(data []byte) ([]byte, int, error) {
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNG(data)
+	case DetectFormat(data) == models.FormatJPEG:
+		return stripJPEG(data)
+	case DetectFormat(data) == models.FormatWebP:
+		return stripWebP(data)
+	default:
+		return nil, 0, errors.New("unsupported image format: expected png, jpeg, or webp")
+	}
+}
+
+func stripPNG(data []byte) ([]byte, int, error) {
+	removed := 0
+	out, err := rewritePNG(data, func(name string, _ []byte) bool {
+		// Critical chunks start with an upper-case letter.
+		if name[0] >= 'A' && name[0] <= 'Z' || pngKeepChunks[name] {
+			return false
+		}
+		removed++
+		return true
+	}, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return out, removed, nil
+}
+
+// stripJPEG drops the APP1 (EXIF, XMP), APP13 (IPTC), other application,
+// and comment segments. JFIF (APP0), ICC profiles (APP2), and Adobe color
+// information (APP14) are kept because decoders rely on them.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2]) // SOI
+
+	removed := 0
+	pos := 2
+	for pos < len(data) {
+		if data[pos] != 0xFF {
+			return nil, 0, fmt.Errorf("invalid jpeg marker at offset %d", pos)
+		}
+		// Markers may be preceded by any number of 0xFF fill bytes.
+		for pos+1 < len(data) && data[pos+1] == 0xFF {
+			pos++
+		}
+		if pos+1 >= len(data) {
+			return nil, 0, errors.New("truncated jpeg marker")
+		}
+		marker := data[pos+1]
+
+		// Standalone markers carry no length.
+		if marker == 0x01 || marker >= 0xD0 && marker <= 0xD7 {
+			out.Write(data[pos : pos+2])
+			pos += 2
+			continue
+		}
+		if marker == 0xD9 { // EOI
+			out.Write(data[pos : pos+2])
+			break
+		}
+
+		if pos+4 > len(data) {
+			return nil, 0, errors.New("truncated jpeg segment")
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 { // the length counts its own two bytes
+			return nil, 0, fmt.Errorf("malformed jpeg segment 0x%X", marker)
+		}
+		end := pos + 2 + length
+		if end > len(data) {
+			return nil, 0, fmt.Errorf("truncated jpeg segment 0x%X", marker)
+		}
+
+		// Start of scan: the entropy-coded data runs to the end, so copy
+		// the remainder verbatim.
+		if marker == 0xDA {
+			out.Write(data[pos:])
+			break
+		}
+
+		if keepJPEGSegment(marker, data[pos+4:end]) {
+			out.Write(data[pos:end])
+		} else {
+			removed++
+		}
+		pos = end
+	}
+	return out.Bytes(), removed, nil
+}
+
+func keepJPEGSegment(marker byte, payload []byte) bool {
+	switch {
+	case marker == 0xFE: // COM
+		return false
+	case marker == 0xE0: // JFIF
+		return true
+	case marker == 0xE2:
+		return bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+	case marker == 0xEE:
+		return bytes.HasPrefix(payload, []byte("Adobe"))
+	case marker >= 0xE1 && marker <= 0xEF:
+		return false
+	default:
+		return true
+	}
+}
+
+// VP8X feature flags for the chunks stripWebP removes.
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+func stripWebP(data []byte) ([]byte, int, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12]) // RIFF header, size patched below
+
+	removed := 0
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, 0, errors.New("truncated webp chunk header")
+		}
+		name := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2 // chunks are padded to even sizes
+		if end > len(data) {
+			return nil, 0, fmt.Errorf("truncated webp chunk %q", name)
+		}
+
+		switch name {
+		case "EXIF", "XMP ":
+			removed++
+		case "VP8X":
+			chunk := bytes.Clone(data[pos:end])
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result, removed, nil
+}
@@ -0,0 +1,172 @@
+package image
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/crc32"
+	stdimage "image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// pixelHash hashes the decoded RGBA pixels of an image.
+func pixelHash(t *testing.T, data []byte) [32]byte {
+	t.Helper()
+	img, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	h := sha256.New()
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			binary.Write(h, binary.BigEndian, [4]uint32{r, g, bl, a})
+		}
+	}
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func pngChunk(name string, payload []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(len(payload)))
+	buf.WriteString(name)
+	buf.Write(payload)
+	crc := crc32.ChecksumIEEE(append([]byte(name), payload...))
+	binary.Write(&buf, binary.BigEndian, crc)
+	return buf.Bytes()
+}
+
+// withPNGChunks inserts chunks right after IHDR.
+func withPNGChunks(data []byte, chunks ...[]byte) []byte {
+	ihdrEnd := len(pngSignature) + 12 + 13
+	out := bytes.Clone(data[:ihdrEnd])
+	for _, c := range chunks {
+		out = append(out, c...)
+	}
+	return append(out, data[ihdrEnd:]...)
+}
+
+func TestStripMetadata_PNG(t *testing.T) {
+	clean := encodeTestPNG(t, 128)
+	tagged := withPNGChunks(clean,
+		pngChunk("tEXt", []byte("prompt\x00a secret prompt")),
+		pngChunk("iTXt", []byte("Software\x00\x00\x00\x00\x00imggen")),
+		pngChunk("eXIf", []byte("MM\x00\x2a")),
+		pngChunk("gAMA", []byte{0, 0, 0xB1, 0x8F}),
+	)
+
+	out, removed, err := StripMetadata(tagged)
+	if err != nil {
+		t.Fatalf("StripMetadata() error = %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("removed = %d, want 3", removed)
+	}
+	if bytes.Contains(out, []byte("secret")) || bytes.Contains(out, []byte("imggen")) {
+		t.Error("metadata text survived stripping")
+	}
+	if !bytes.Contains(out, []byte("gAMA")) {
+		t.Error("gAMA affects rendering and should be kept")
+	}
+	if pixelHash(t, out) != pixelHash(t, tagged) {
+		t.Error("pixel data changed")
+	}
+}
+
+func TestStripMetadata_JPEG(t *testing.T) {
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	clean := buf.Bytes()
+
+	segment := func(marker byte, payload string) []byte {
+		s := []byte{0xFF, marker, 0, 0}
+		binary.BigEndian.PutUint16(s[2:], uint16(len(payload)+2))
+		return append(s, payload...)
+	}
+	tagged := append([]byte{}, clean[:2]...)
+	tagged = append(tagged, segment(0xE1, "Exif\x00\x00GPS 51.5N")...)
+	tagged = append(tagged, segment(0xFE, "made with imggen")...)
+	tagged = append(tagged, clean[2:]...)
+
+	out, removed, err := StripMetadata(tagged)
+	if err != nil {
+		t.Fatalf("StripMetadata() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("removed = %d, want 2", removed)
+	}
+	if bytes.Contains(out, []byte("GPS")) || bytes.Contains(out, []byte("imggen")) {
+		t.Error("metadata survived stripping")
+	}
+	if !bytes.Equal(out, clean) {
+		t.Error("stripping should leave the original encoder output")
+	}
+	if pixelHash(t, out) != pixelHash(t, tagged) {
+		t.Error("pixel data changed")
+	}
+}
+
+func TestStripMetadata_WebP(t *testing.T) {
+	chunk := func(name, payload string) []byte {
+		c := []byte(name)
+		c = binary.LittleEndian.AppendUint32(c, uint32(len(payload)))
+		c = append(c, payload...)
+		if len(payload)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+	body := []byte("WEBP")
+	body = append(body, chunk("VP8X", string([]byte{webpFlagEXIF | webpFlagXMP | 0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0}))...)
+	body = append(body, chunk("VP8L", "pixels")...)
+	body = append(body, chunk("EXIF", "secret")...)
+	body = append(body, chunk("XMP ", "<x:xmpmeta/>")...)
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	data = append(data, body...)
+
+	out, removed, err := StripMetadata(data)
+	if err != nil {
+		t.Fatalf("StripMetadata() error = %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("removed = %d, want 2", removed)
+	}
+	if bytes.Contains(out, []byte("secret")) || bytes.Contains(out, []byte("xmpmeta")) {
+		t.Error("metadata survived stripping")
+	}
+	if got := int(binary.LittleEndian.Uint32(out[4:])); got != len(out)-8 {
+		t.Errorf("RIFF size = %d, want %d", got, len(out)-8)
+	}
+	if flags := out[20]; flags != 0x10 {
+		t.Errorf("VP8X flags = %#x, want EXIF and XMP bits cleared", flags)
+	}
+	if !bytes.Contains(out, []byte("VP8L")) {
+		t.Error("image chunk should be kept")
+	}
+}
+
+func TestStripMetadata_Errors(t *testing.T) {
+	if _, _, err := StripMetadata([]byte("GIF89a")); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+	truncated := encodeTestPNG(t, 255)
+	if _, _, err := StripMetadata(truncated[:20]); err == nil {
+		t.Error("expected error for truncated png")
+	}
+	short := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9}
+	if _, _, err := StripMetadata(short); err == nil {
+		t.Error("expected error for a jpeg segment shorter than its length field")
+	}
+}
@@ -0,0 +1,92 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"image/draw"
+
+	"github.com/HugoSmits86/nativewebp"
+	_ "golang.org/x/image/webp" // register the WebP decoder for conversions
+)
+
+// EncodeOptions control how images are encoded when imggen re-encodes them
+// on save, which it does whenever the API returns a different format than
+// the one asked for (OpenAI returns PNG) or a quality is set explicitly.
+type EncodeOptions struct {
+	// JPEGQuality is the JPEG quality, from 1 to 100.
+	JPEGQuality int
+
+	// WebPQuality trades fidelity for size, from 0 to 100. WebP images are
+	// always written losslessly (VP8L); below 100, colors are first
+	// quantized, near-lossless style, so they compress better. Alpha is
+	// never quantized.
+	WebPQuality int
+
+	// WebPLossless keeps every pixel exact, including the color under fully
+	// transparent pixels, which is otherwise cleared. WebPQuality is ignored.
+	WebPLossless bool
+}
+
+// DefaultEncodeOptions are used by a Saver that was given no options.
+var DefaultEncodeOptions = EncodeOptions{JPEGQuality: jpegQuality, WebPQuality: 90}
+
+// Validate checks that the qualities are in range.
+func (o EncodeOptions) Validate() error {
+	if o.JPEGQuality < 1 || o.JPEGQuality > 100 {
+		return fmt.Errorf("jpeg quality must be between 1 and 100, got %d", o.JPEGQuality)
+	}
+	if o.WebPQuality < 0 || o.WebPQuality > 100 {
+		return fmt.Errorf("webp quality must be between 0 and 100, got %d", o.WebPQuality)
+	}
+	return nil
+}
+
+// orDefault returns DefaultEncodeOptions for the zero value, which no valid
+// options can be since JPEG quality starts at 1.
+func (o EncodeOptions) orDefault() EncodeOptions {
+	if o == (EncodeOptions{}) {
+		return DefaultEncodeOptions
+	}
+	return o
+}
+
+// quantizeBits returns how many low bits of each color channel a WebP
+// quality drops: none at 100, up to five at 0.
+func quantizeBits(quality int) uint {
+	return uint(100-quality+19) / 20
+}
+
+// encodeWebP writes img as a lossless WebP after applying opts.
+func encodeWebP(img stdimage.Image, opts EncodeOptions) ([]byte, error) {
+	b := img.Bounds()
+	nrgba := stdimage.NewNRGBA(stdimage.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+
+	if !opts.WebPLossless {
+		bits := quantizeBits(opts.WebPQuality)
+		pix := nrgba.Pix
+		for i := 0; i < len(pix); i += 4 {
+			if pix[i+3] == 0 {
+				pix[i], pix[i+1], pix[i+2] = 0, 0, 0
+				continue
+			}
+			for c := i; c < i+3 && bits > 0; c++ {
+				pix[c] = quantize(pix[c], bits)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, nrgba, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// quantize rounds v to the nearest multiple of 1<<bits that fits in a byte.
+func quantize(v byte, bits uint) byte {
+	step := 1 << bits
+	q := (int(v) + step/2) / step * step
+	return byte(min(q, 256-step))
+}
@@ -0,0 +1,162 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	stdimage "image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// gradientPNG encodes a 64x64 PNG of noisy color gradients whose alpha
+// falls from opaque at the top to fully transparent at the bottom.
+func gradientPNG(t *testing.T) []byte {
+	t.Helper()
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, 64, 64))
+	seed := uint32(7)
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			seed = seed*1664525 + 1013904223
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: byte(x*4) + byte(seed>>29),
+				G: byte(y * 4),
+				B: byte((x + y) * 2),
+				A: byte(255 - min(y*5, 255)),
+			})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decodeNRGBA(t *testing.T, data []byte) *stdimage.NRGBA {
+	t.Helper()
+	img, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	nrgba, ok := img.(*stdimage.NRGBA)
+	if !ok {
+		nrgba = stdimage.NewNRGBA(img.Bounds())
+		for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+			for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+				nrgba.Set(x, y, img.At(x, y))
+			}
+		}
+	}
+	return nrgba
+}
+
+func TestEncodeOptions_Validate(t *testing.T) {
+	tests := []struct {
+		opts    EncodeOptions
+		wantErr string
+	}{
+		{DefaultEncodeOptions, ""},
+		{EncodeOptions{JPEGQuality: 1, WebPQuality: 0}, ""},
+		{EncodeOptions{JPEGQuality: 100, WebPQuality: 100, WebPLossless: true}, ""},
+		{EncodeOptions{JPEGQuality: 0, WebPQuality: 90}, "jpeg quality must be between 1 and 100, got 0"},
+		{EncodeOptions{JPEGQuality: 101, WebPQuality: 90}, "jpeg quality must be between 1 and 100, got 101"},
+		{EncodeOptions{JPEGQuality: 90, WebPQuality: -1}, "webp quality must be between 0 and 100, got -1"},
+		{EncodeOptions{JPEGQuality: 90, WebPQuality: 101}, "webp quality must be between 0 and 100, got 101"},
+	}
+	for _, tt := range tests {
+		err := tt.opts.Validate()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("Validate(%+v) error = %v", tt.opts, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("Validate(%+v) error = %v, want %q", tt.opts, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConvertFormat_WebPLossless(t *testing.T) {
+	data := gradientPNG(t)
+	out, err := ConvertFormat(data, models.FormatWebP, EncodeOptions{JPEGQuality: 90, WebPQuality: 100, WebPLossless: true})
+	if err != nil {
+		t.Fatalf("ConvertFormat() error = %v", err)
+	}
+	if DetectFormat(out) != models.FormatWebP {
+		t.Fatal("ConvertFormat() did not encode webp")
+	}
+
+	want, got := decodeNRGBA(t, data), decodeNRGBA(t, out)
+	if !bytes.Equal(got.Pix, want.Pix) {
+		t.Error("lossless webp changed pixels or transparency")
+	}
+}
+
+func TestConvertFormat_WebPQuality(t *testing.T) {
+	data := gradientPNG(t)
+	src := decodeNRGBA(t, data)
+
+	var sizes []int
+	for _, q := range []int{100, 75, 25} {
+		out, err := ConvertFormat(data, models.FormatWebP, EncodeOptions{JPEGQuality: 90, WebPQuality: q})
+		if err != nil {
+			t.Fatalf("ConvertFormat(quality %d) error = %v", q, err)
+		}
+		sizes = append(sizes, len(out))
+
+		got := decodeNRGBA(t, out)
+		for i := 3; i < len(got.Pix); i += 4 {
+			if got.Pix[i] != src.Pix[i] {
+				t.Fatalf("quality %d changed alpha at pixel %d: %d, want %d", q, i/4, got.Pix[i], src.Pix[i])
+			}
+		}
+	}
+	if !(sizes[0] > sizes[1] && sizes[1] > sizes[2]) {
+		t.Errorf("webp sizes for quality 100, 75, 25 = %v, want them to shrink", sizes)
+	}
+}
+
+func TestConvertFormat_JPEGQuality(t *testing.T) {
+	data := gradientPNG(t)
+	high, err := ConvertFormat(data, models.FormatJPEG, EncodeOptions{JPEGQuality: 95, WebPQuality: 90})
+	if err != nil {
+		t.Fatal(err)
+	}
+	low, err := ConvertFormat(data, models.FormatJPEG, EncodeOptions{JPEGQuality: 20, WebPQuality: 90})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(low) >= len(high) {
+		t.Errorf("jpeg quality 20 is %d bytes, want less than quality 95's %d", len(low), len(high))
+	}
+
+	// An explicit quality re-encodes even a JPEG.
+	again, err := ConvertFormat(high, models.FormatJPEG, EncodeOptions{JPEGQuality: 20, WebPQuality: 90})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again, high) {
+		t.Error("ConvertFormat() kept a jpeg despite a new quality")
+	}
+}
+
+func TestSaver_WithEncodeOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cat.webp")
+	resp := &models.Response{Images: []models.GeneratedImage{{Data: gradientPNG(t)}}}
+	saver := NewSaver().WithEncodeOptions(EncodeOptions{JPEGQuality: 90, WebPQuality: 100, WebPLossless: true})
+	if _, err := saver.SaveAll(context.Background(), resp, path, models.FormatWebP); err != nil {
+		t.Fatalf("SaveAll() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if DetectFormat(data) != models.FormatWebP {
+		t.Error("saved file is not webp")
+	}
+}
@@ -0,0 +1,89 @@
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrBackendUnavailable is returned when a key backend is known but not
+// supported by this build or platform.
+var ErrBackendUnavailable = errors.New("key backend not supported")
+
+// Backend is a place API keys can be stored. The plaintext keys.json Store
+// is one; OS keychains and encrypted files can implement the same interface.
+type Backend interface {
+	// Name identifies the backend in user-facing messages, e.g. "file".
+	Name() string
+	// Get returns the stored key, or "" if none is stored.
+	Get(provider string) (string, error)
+	Set(provider, key string) error
+	Delete(provider string) error
+}
+
+// Name returns "file" for the plaintext keys.json store.
+func (s *Store) Name() string {
+	return "file"
+}
+
+// OpenBackend returns the backend with the given name.
+func OpenBackend(name string) (Backend, error) {
+	switch name {
+	case "file":
+		return NewStore()
+	case "keychain", "encrypted":
+		return nil, fmt.Errorf("%w: %s (this build only supports file)", ErrBackendUnavailable, name)
+	default:
+		return nil, fmt.Errorf("unknown key backend %q (valid: file)", name)
+	}
+}
+
+// Migration describes a key copied by Migrate.
+type Migration struct {
+	Provider string
+	// Source is where the key was read from: a backend name or "env:VAR".
+	Source string
+	// FromEnv reports that the key came from the environment rather than
+	// the source backend, so there is no plaintext entry to remove.
+	FromEnv bool
+	Target  string
+	Key     string
+}
+
+// Migrate copies the key for provider from the source backend (falling back
+// to envVar when the backend has none) into the target backend, then reads
+// it back from the target to verify it. The source entry is left in place;
+// callers remove it once the user confirms.
+func Migrate(provider string, from Backend, envVar string, to Backend) (*Migration, error) {
+	m := &Migration{Provider: provider, Target: to.Name()}
+
+	key, err := from.Get(provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key from %s: %w", from.Name(), err)
+	}
+	m.Source = from.Name()
+
+	if key == "" && envVar != "" {
+		key = os.Getenv(envVar)
+		m.Source = "env:" + envVar
+		m.FromEnv = true
+	}
+	if key == "" {
+		return nil, fmt.Errorf("no key found for %s in %s or %s", provider, from.Name(), envVar)
+	}
+	m.Key = key
+
+	if err := to.Set(provider, key); err != nil {
+		return nil, fmt.Errorf("failed to store key in %s: %w", to.Name(), err)
+	}
+
+	stored, err := to.Get(provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key back from %s: %w", to.Name(), err)
+	}
+	if stored != key {
+		return nil, fmt.Errorf("verification failed: key read back from %s does not match", to.Name())
+	}
+
+	return m, nil
+}
@@ -0,0 +1,132 @@
+package keys
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeKeychain is an in-memory stand-in for an OS keychain backend.
+type fakeKeychain struct {
+	items   map[string]string
+	corrupt bool // store a different value than requested
+}
+
+func newFakeKeychain() *fakeKeychain {
+	return &fakeKeychain{items: make(map[string]string)}
+}
+
+func (k *fakeKeychain) Name() string { return "keychain" }
+
+func (k *fakeKeychain) Get(provider string) (string, error) {
+	return k.items[provider], nil
+}
+
+func (k *fakeKeychain) Set(provider, key string) error {
+	if k.corrupt {
+		key += "-garbled"
+	}
+	k.items[provider] = key
+	return nil
+}
+
+func (k *fakeKeychain) Delete(provider string) error {
+	delete(k.items, provider)
+	return nil
+}
+
+func TestMigrate_FileToKeychain(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	file := &Store{configDir: t.TempDir()}
+	file.Set("openai", "sk-file-key")
+	keychain := newFakeKeychain()
+
+	m, err := Migrate("openai", file, "OPENAI_API_KEY", keychain)
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if m.Source != "file" || m.FromEnv || m.Target != "keychain" {
+		t.Errorf("Migrate() = %+v, want file -> keychain", m)
+	}
+	if got := keychain.items["openai"]; got != "sk-file-key" {
+		t.Errorf("keychain key = %q, want sk-file-key", got)
+	}
+
+	// Migrate leaves the source in place; removal is the caller's decision.
+	if got, _ := file.Get("openai"); got != "sk-file-key" {
+		t.Errorf("file key after migrate = %q, want it kept", got)
+	}
+}
+
+func TestMigrate_EnvToKeychain(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-env-key")
+	file := &Store{configDir: t.TempDir()}
+	keychain := newFakeKeychain()
+
+	m, err := Migrate("openai", file, "OPENAI_API_KEY", keychain)
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if !m.FromEnv || m.Source != "env:OPENAI_API_KEY" {
+		t.Errorf("Migrate() = %+v, want key from env", m)
+	}
+	if got := keychain.items["openai"]; got != "sk-env-key" {
+		t.Errorf("keychain key = %q, want sk-env-key", got)
+	}
+}
+
+func TestMigrate_KeychainToFile(t *testing.T) {
+	keychain := newFakeKeychain()
+	keychain.items["openai"] = "sk-chain-key"
+	file := &Store{configDir: t.TempDir()}
+
+	if _, err := Migrate("openai", keychain, "", file); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if got, _ := file.Get("openai"); got != "sk-chain-key" {
+		t.Errorf("file key = %q, want sk-chain-key", got)
+	}
+}
+
+func TestMigrate_NoKey(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	file := &Store{configDir: t.TempDir()}
+
+	_, err := Migrate("openai", file, "OPENAI_API_KEY", newFakeKeychain())
+	if err == nil || !strings.Contains(err.Error(), "no key found") {
+		t.Errorf("Migrate() error = %v, want no key found", err)
+	}
+}
+
+func TestMigrate_VerificationFailure(t *testing.T) {
+	file := &Store{configDir: t.TempDir()}
+	file.Set("openai", "sk-file-key")
+	keychain := newFakeKeychain()
+	keychain.corrupt = true
+
+	_, err := Migrate("openai", file, "", keychain)
+	if err == nil || !strings.Contains(err.Error(), "verification failed") {
+		t.Errorf("Migrate() error = %v, want verification failure", err)
+	}
+}
+
+func TestOpenBackend(t *testing.T) {
+	t.Setenv("IMGGEN_CONFIG_DIR", t.TempDir())
+
+	b, err := OpenBackend("file")
+	if err != nil {
+		t.Fatalf("OpenBackend(file) error = %v", err)
+	}
+	if b.Name() != "file" {
+		t.Errorf("Name() = %q, want file", b.Name())
+	}
+
+	for _, name := range []string{"keychain", "encrypted"} {
+		if _, err := OpenBackend(name); !errors.Is(err, ErrBackendUnavailable) || !strings.Contains(err.Error(), "only supports file") {
+			t.Errorf("OpenBackend(%s) error = %v, want ErrBackendUnavailable", name, err)
+		}
+	}
+	if _, err := OpenBackend("vault"); err == nil {
+		t.Error("OpenBackend(vault) error = nil, want unknown backend error")
+	}
+}
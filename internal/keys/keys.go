@@ -188,10 +188,13 @@ func MaskKey(key string) string {
 // 1. Explicit key passed as argument (if non-empty)
 // 2. Stored key in keys.json
 // 3. Environment variable
+//
+// The second return value describes where the key came from, e.g. "flag",
+// "stored key for openai" or "environment OPENAI_API_KEY".
 func GetAPIKey(explicitKey, provider, envVar string) (string, string, error) {
 	// 1. Explicit key has highest priority
 	if explicitKey != "" {
-		return explicitKey, "command-line flag", nil
+		return explicitKey, "flag", nil
 	}
 
 	// 2. Check stored key
@@ -199,13 +202,13 @@ func GetAPIKey(explicitKey, provider, envVar string) (string, string, error) {
 	if err == nil {
 		storedKey, err := store.Get(provider)
 		if err == nil && storedKey != "" {
-			return storedKey, fmt.Sprintf("stored key (~/.config/imggen/keys.json)"), nil
+			return storedKey, "stored key for " + provider, nil
 		}
 	}
 
 	// 3. Fall back to environment variable
 	if envKey := os.Getenv(envVar); envKey != "" {
-		return envKey, fmt.Sprintf("environment variable (%s)", envVar), nil
+		return envKey, "environment " + envVar, nil
 	}
 
 	return "", "", fmt.Errorf("API key required: run 'imggen keys set' or set %s environment variable", envVar)
@@ -175,6 +175,49 @@ func TestGetAPIKey_Priority(t *testing.T) {
 	}
 }
 
+func TestGetAPIKey_Source(t *testing.T) {
+	tests := []struct {
+		name       string
+		explicit   string
+		stored     string
+		env        string
+		wantKey    string
+		wantSource string
+	}{
+		{"flag wins", "flag-key", "stored-key", "env-key", "flag-key", "flag"},
+		{"stored before env", "", "stored-key", "env-key", "stored-key", "stored key for openai"},
+		{"env fallback", "", "", "env-key", "env-key", "environment OPENAI_API_KEY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("IMGGEN_CONFIG_DIR", dir)
+			t.Setenv("OPENAI_API_KEY", tt.env)
+			if tt.stored != "" {
+				(&Store{configDir: dir}).Set("openai", tt.stored)
+			}
+
+			key, source, err := GetAPIKey(tt.explicit, "openai", "OPENAI_API_KEY")
+			if err != nil {
+				t.Fatalf("GetAPIKey() error = %v", err)
+			}
+			if key != tt.wantKey || source != tt.wantSource {
+				t.Errorf("GetAPIKey() = %q, %q; want %q, %q", key, source, tt.wantKey, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestGetAPIKey_Missing(t *testing.T) {
+	t.Setenv("IMGGEN_CONFIG_DIR", t.TempDir())
+	t.Setenv("OPENAI_API_KEY", "")
+
+	if _, _, err := GetAPIKey("", "openai", "OPENAI_API_KEY"); err == nil {
+		t.Error("GetAPIKey() error = nil, want error when no key is available")
+	}
+}
+
 func TestStore_MultipleProviders(t *testing.T) {
 	tmpDir := t.TempDir()
 	store := &Store{configDir: tmpDir}
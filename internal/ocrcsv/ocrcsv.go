@@ -0,0 +1,169 @@
+// Package ocrcsv flattens structured OCR results into CSV rows whose
+// columns come from the JSON schema the results were extracted with.
+package ocrcsv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotObjectSchema is returned for schemas without object properties to
+// derive columns from.
+var ErrNotObjectSchema = errors.New("csv output needs an object schema with properties")
+
+// SourceColumn is the first column of every row: the image the row was
+// extracted from.
+const SourceColumn = "source"
+
+// Columns returns the columns of schema's properties in the order the
+// schema lists them. Properties that are objects with properties of their
+// own are flattened into dotted columns such as "vendor.name"; arrays and
+// other values take a single column.
+func Columns(schema []byte) ([]string, error) {
+	var root struct {
+		Properties orderedProperties `json:"properties"`
+	}
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if len(root.Properties) == 0 {
+		return nil, ErrNotObjectSchema
+	}
+	return root.Properties.columns(""), nil
+}
+
+// property is one named entry of a schema's properties.
+type property struct {
+	name       string
+	properties orderedProperties
+}
+
+// orderedProperties decodes a schema "properties" object, keeping the
+// order its keys appear in.
+type orderedProperties []property
+
+func (p *orderedProperties) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("properties must be an object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var sub struct {
+			Properties orderedProperties `json:"properties"`
+		}
+		if err := dec.Decode(&sub); err != nil {
+			return fmt.Errorf("property %q: %w", tok, err)
+		}
+		*p = append(*p, property{name: tok.(string), properties: sub.Properties})
+	}
+	_, err := dec.Token()
+	return err
+}
+
+func (p orderedProperties) columns(prefix string) []string {
+	var cols []string
+	for _, prop := range p {
+		name := prefix + prop.name
+		if len(prop.properties) > 0 {
+			cols = append(cols, prop.properties.columns(name+".")...)
+		} else {
+			cols = append(cols, name)
+		}
+	}
+	return cols
+}
+
+// Row returns the cells of structured for columns. Strings are written as
+// they are, numbers and booleans in their JSON form, and arrays or objects
+// as compact JSON. Fields that are missing or null are empty cells.
+func Row(columns []string, structured []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(structured))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("structured result is not a JSON object: %w", err)
+	}
+
+	row := make([]string, len(columns))
+	for i, col := range columns {
+		cell, err := cellText(lookup(obj, col))
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", col, err)
+		}
+		row[i] = cell
+	}
+	return row, nil
+}
+
+// lookup follows a dotted column through nested objects, returning nil
+// when any part is missing.
+func lookup(obj map[string]any, column string) any {
+	var v any = obj
+	for _, key := range strings.Split(column, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+func cellText(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	default:
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+}
+
+// Writer writes a header of SourceColumn and the schema's columns, then one
+// row per structured result.
+type Writer struct {
+	csv     *csv.Writer
+	columns []string
+}
+
+// NewWriter writes the header for columns to w.
+func NewWriter(w io.Writer, columns []string) (*Writer, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{SourceColumn}, columns...)); err != nil {
+		return nil, err
+	}
+	return &Writer{csv: cw, columns: columns}, nil
+}
+
+// Write adds the row of the result extracted from source.
+func (w *Writer) Write(source string, structured []byte) error {
+	row, err := Row(w.columns, structured)
+	if err != nil {
+		return err
+	}
+	return w.csv.Write(append([]string{source}, row...))
+}
+
+// Flush writes any buffered rows and reports the first write error.
+func (w *Writer) Flush() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
@@ -0,0 +1,108 @@
+package ocrcsv
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+)
+
+const receiptSchema = `{
+	"type": "object",
+	"properties": {
+		"vendor": {
+			"type": "object",
+			"properties": {"name": {"type": "string"}, "city": {"type": "string"}}
+		},
+		"total": {"type": "number"},
+		"paid": {"type": "boolean"},
+		"items": {"type": "array", "items": {"type": "string"}},
+		"date": {"type": "string"}
+	}
+}`
+
+func TestColumns(t *testing.T) {
+	got, err := Columns([]byte(receiptSchema))
+	if err != nil {
+		t.Fatalf("Columns() error = %v", err)
+	}
+	want := []string{"vendor.name", "vendor.city", "total", "paid", "items", "date"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Columns() = %v, want %v", got, want)
+	}
+
+	for _, schema := range []string{`{"type": "object"}`, `{"type": "string"}`, `{"properties": {}}`} {
+		if _, err := Columns([]byte(schema)); !errors.Is(err, ErrNotObjectSchema) {
+			t.Errorf("Columns(%s) error = %v, want ErrNotObjectSchema", schema, err)
+		}
+	}
+	if _, err := Columns([]byte(`{"properties": [1]}`)); err == nil {
+		t.Error("Columns(array properties) error = nil")
+	}
+}
+
+func TestRow(t *testing.T) {
+	columns := []string{"vendor.name", "vendor.city", "total", "paid", "items", "date"}
+	tests := []struct {
+		name       string
+		structured string
+		want       []string
+	}{
+		{
+			name:       "complete",
+			structured: `{"vendor": {"name": "ACME, Inc.", "city": "Springfield"}, "total": 12.50, "paid": true, "items": ["bolt", "nut"], "date": "2025-03-14"}`,
+			want:       []string{"ACME, Inc.", "Springfield", "12.50", "true", `["bolt","nut"]`, "2025-03-14"},
+		},
+		{
+			name:       "missing and null",
+			structured: `{"vendor": {"name": "Corner Shop"}, "total": null, "paid": false}`,
+			want:       []string{"Corner Shop", "", "", "false", "", ""},
+		},
+		{
+			name:       "wrong shape",
+			structured: `{"vendor": "Corner Shop", "total": 10000000000000000001}`,
+			want:       []string{"", "", "10000000000000000001", "", "", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Row(columns, []byte(tt.structured))
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("Row() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := Row(columns, []byte(`["not", "an", "object"]`)); err == nil {
+		t.Error("Row(array) error = nil")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	columns, err := Columns([]byte(receiptSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write("receipts/a.png", []byte(`{"vendor": {"name": "ACME, Inc."}, "total": 12.5}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write("receipts/b.png", []byte(`{"date": "2025-03-14", "items": []}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "source,vendor.name,vendor.city,total,paid,items,date\n" +
+		"receipts/a.png,\"ACME, Inc.\",,12.5,,,\n" +
+		"receipts/b.png,,,,,[],2025-03-14\n"
+	if buf.String() != want {
+		t.Errorf("csv =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,77 @@
+// Package progress shows an animated spinner with the elapsed time while a
+// long call, such as a single image generation, runs.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// interval is how often the spinner is redrawn.
+var interval = 100 * time.Millisecond
+
+var frames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// clearLine returns the cursor to the start of the line and erases it.
+const clearLine = "\r\x1b[K"
+
+// IsTerminal reports whether w is a terminal the spinner can redraw in
+// place. Buffers, files, and pipes are not.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// Spinner redraws one line of w until Stop is called.
+type Spinner struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// Start draws a spinner and the time elapsed since the call on w, redrawn
+// in place from a goroutine until Stop. When enabled is false, such as
+// when w is not a terminal or other output would share the line, nothing
+// is written and Stop returns at once.
+func Start(w io.Writer, enabled bool) *Spinner {
+	s := &Spinner{}
+	if !enabled {
+		return s
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	start := time.Now()
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			elapsed := time.Since(start).Truncate(time.Second)
+			fmt.Fprintf(w, "\r%c %s elapsed", frames[i%len(frames)], elapsed)
+			select {
+			case <-s.stop:
+				fmt.Fprint(w, clearLine)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+// Stop erases the spinner's line and waits for its goroutine to exit, so
+// output written afterwards starts on a clean line. It may be called more
+// than once.
+func (s *Spinner) Stop() {
+	if s.stop == nil {
+		return
+	}
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+}
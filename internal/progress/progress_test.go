@@ -0,0 +1,67 @@
+package progress
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if IsTerminal(&bytes.Buffer{}) {
+		t.Error("IsTerminal(buffer) = true")
+	}
+	if IsTerminal(f) {
+		t.Error("IsTerminal(regular file) = true")
+	}
+}
+
+func TestStart_Disabled(t *testing.T) {
+	var out bytes.Buffer
+	s := Start(&out, IsTerminal(&out))
+	time.Sleep(3 * interval)
+	s.Stop()
+	s.Stop()
+
+	if out.Len() != 0 {
+		t.Errorf("disabled spinner wrote %q", out.String())
+	}
+}
+
+func TestStart_Enabled(t *testing.T) {
+	old := interval
+	interval = time.Millisecond
+	defer func() { interval = old }()
+
+	var out bytes.Buffer
+	s := Start(&out, true)
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+	s.Stop()
+
+	got := out.String()
+	if !strings.HasPrefix(got, "\r⠋ 0s elapsed") {
+		t.Errorf("spinner output starts %q, want the first frame", got[:min(len(got), 20)])
+	}
+	if !strings.Contains(got, "\r⠙") {
+		t.Error("spinner was not redrawn")
+	}
+	if !strings.HasSuffix(got, clearLine) {
+		t.Errorf("spinner output ends %q, want the line cleared", got[max(0, len(got)-10):])
+	}
+
+	// Nothing is written after Stop returns.
+	n := out.Len()
+	time.Sleep(5 * time.Millisecond)
+	if out.Len() != n {
+		t.Error("spinner wrote after Stop")
+	}
+}
@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Downloader fetches images from the URLs some models answer with instead
+// of base64. Transport errors, bodies cut short, and 429 or 5xx responses
+// are retried like API calls. When the server advertises byte ranges, a
+// retry asks only for the bytes not yet received instead of starting over.
+type Downloader struct {
+	// Client sends the requests; nil means http.DefaultClient.
+	Client *http.Client
+	// MaxRetries is how many times a failed download is retried. Zero
+	// disables retries.
+	MaxRetries int
+	// RetryBaseDelay is the first backoff delay, doubled on each retry.
+	RetryBaseDelay time.Duration
+	// Timeout bounds each download, retries included. Zero means no
+	// limit beyond ctx.
+	Timeout time.Duration
+	// Log, when set, receives a line for each retry.
+	Log io.Writer
+}
+
+// Download returns the body at url. Cancelling ctx stops both a request in
+// flight and the wait before the next attempt.
+func (d *Downloader) Download(ctx context.Context, url string) (_ []byte, err error) {
+	if d.Timeout > 0 {
+		var done func(*error)
+		ctx, done = WithTimeout(ctx, "download", d.Timeout)
+		defer done(&err)
+	}
+
+	var buf bytes.Buffer
+	var resumable bool
+
+	for attempt := 0; ; attempt++ {
+		err := d.attempt(ctx, url, &buf, &resumable)
+		if err == nil {
+			return buf.Bytes(), nil
+		}
+
+		var dlErr *downloadError
+		if !errors.As(err, &dlErr) || attempt >= d.MaxRetries {
+			return nil, err
+		}
+
+		delay := RetryDelay(attempt, d.RetryBaseDelay, dlErr.retryAfter)
+		if d.Log != nil {
+			fmt.Fprintf(d.Log, "Download failed (%v), retrying in %s (retry %d of %d)\n", dlErr.err, delay.Round(time.Millisecond), attempt+1, d.MaxRetries)
+		}
+		if err := Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// downloadError is a download failure worth retrying.
+type downloadError struct {
+	err        error
+	retryAfter string
+}
+
+func (e *downloadError) Error() string { return e.err.Error() }
+func (e *downloadError) Unwrap() error { return e.err }
+
+// attempt makes one request for url, appending what it receives to buf.
+// With resumable set and part of the body in buf, only the rest is
+// requested; a server that answers with the whole body anyway replaces buf.
+func (d *Downloader) attempt(ctx context.Context, url string, buf *bytes.Buffer, resumable *bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create download request: %w", err)
+	}
+	offset := buf.Len()
+	if *resumable && offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return retryableDownload(ctx, fmt.Errorf("failed to download image: %w", err))
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		buf.Reset()
+		*resumable = resp.Header.Get("Accept-Ranges") == "bytes"
+	case resp.StatusCode == http.StatusPartialContent && req.Header.Get("Range") != "":
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			buf.Reset()
+			*resumable = false
+			return &downloadError{err: fmt.Errorf("download resumed at the wrong offset: %q", resp.Header.Get("Content-Range"))}
+		}
+	case IsRetryableStatus(resp.StatusCode):
+		return &downloadError{err: fmt.Errorf("download failed with status: %d", resp.StatusCode), retryAfter: resp.Header.Get("Retry-After")}
+	default:
+		return fmt.Errorf("download failed with status: %d", resp.StatusCode)
+	}
+
+	if _, err := io.Copy(buf, resp.Body); err != nil {
+		return retryableDownload(ctx, fmt.Errorf("download interrupted after %d bytes: %w", buf.Len(), err))
+	}
+	return nil
+}
+
+// retryableDownload marks err for retry unless ctx has ended, in which case
+// retrying cannot help.
+func retryableDownload(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	return &downloadError{err: err}
+}
+
+// contentRangeStart returns the first byte position of a Content-Range
+// header such as "bytes 100-199/200".
+func contentRangeStart(value string) (int, bool) {
+	rest, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.Atoi(first)
+	return start, err == nil
+}
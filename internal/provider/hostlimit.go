@@ -0,0 +1,87 @@
+package provider
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// HostLimiter is an http.RoundTripper that caps the number of requests in
+// flight to each host. A request holds its slot until the response body is
+// closed, so slow downloads count against the limit too.
+type HostLimiter struct {
+	base  http.RoundTripper
+	limit int
+
+	mu   sync.Mutex
+	sems map[string]chan struct{}
+}
+
+// NewHostLimiter wraps base (http.DefaultTransport when nil) so that at most
+// limit requests per host are in flight at once.
+func NewHostLimiter(base http.RoundTripper, limit int) *HostLimiter {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &HostLimiter{
+		base:  base,
+		limit: limit,
+		sems:  make(map[string]chan struct{}),
+	}
+}
+
+// Transport returns the transport for providers to use: base wrapped in a
+// HostLimiter when limit is positive, or base unchanged otherwise.
+func Transport(base http.RoundTripper, limit int) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if limit <= 0 {
+		return base
+	}
+	return NewHostLimiter(base, limit)
+}
+
+func (l *HostLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	sem := l.semaphore(req.URL.Host)
+
+	select {
+	case sem <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	resp, err := l.base.RoundTrip(req)
+	if err != nil {
+		<-sem
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { <-sem }}
+	return resp, nil
+}
+
+func (l *HostLimiter) semaphore(host string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sem, ok := l.sems[host]
+	if !ok {
+		sem = make(chan struct{}, l.limit)
+		l.sems[host] = sem
+	}
+	return sem
+}
+
+// releasingBody frees the host slot the first time the body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,87 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimiter_CapsInFlightRequests(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	const limit = 2
+	client := &http.Client{Transport: NewHostLimiter(nil, limit)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Errorf("Get() error = %v", err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > limit {
+		t.Errorf("peak in-flight requests = %d, want at most %d", got, limit)
+	}
+	if got := peak.Load(); got < 1 {
+		t.Errorf("peak in-flight requests = %d, want requests to reach the server", got)
+	}
+}
+
+func TestHostLimiter_WaitRespectsContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := &http.Client{Transport: NewHostLimiter(nil, 1)}
+
+	// Occupy the only slot.
+	go client.Get(server.URL)
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+
+	if _, err := client.Do(req); err == nil {
+		t.Error("Do() error = nil, want context deadline while waiting for a slot")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	if _, ok := Transport(nil, 0).(*HostLimiter); ok {
+		t.Error("Transport(nil, 0) should not wrap the base transport")
+	}
+	if _, ok := Transport(nil, 3).(*HostLimiter); !ok {
+		t.Error("Transport(nil, 3) should return a HostLimiter")
+	}
+}
@@ -0,0 +1,174 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+const confidenceInstructions = `
+
+Put the extracted data in "data". In "confidence", list every top-level field of "data" with a score from 0 to 1 indicating how certain you are that its value is correct.`
+
+// confidenceEnvelope is the structured output requested when per-field
+// confidence scores are wanted alongside the user's schema.
+type confidenceEnvelope struct {
+	Data       map[string]json.RawMessage `json:"data"`
+	Confidence []fieldConfidence          `json:"confidence"`
+}
+
+type fieldConfidence struct {
+	Field string  `json:"field"`
+	Score float64 `json:"score"`
+}
+
+func (e *confidenceEnvelope) scores() map[string]float64 {
+	scores := make(map[string]float64, len(e.Confidence))
+	for _, c := range e.Confidence {
+		scores[c.Field] = c.Score
+	}
+	return scores
+}
+
+// wrapSchemaWithConfidence nests the user's schema under "data" and adds a
+// strict-mode compatible "confidence" array next to it.
+func wrapSchemaWithConfidence(schema json.RawMessage) (json.RawMessage, error) {
+	wrapped := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"data": schema,
+			"confidence": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"field": map[string]any{"type": "string"},
+						"score": map[string]any{"type": "number"},
+					},
+					"required":             []string{"field", "score"},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required":             []string{"data", "confidence"},
+		"additionalProperties": false,
+	}
+	return json.Marshal(wrapped)
+}
+
+// lowConfidenceFields returns the sorted data fields scoring below threshold.
+// Fields the model did not score are treated as uncertain.
+func lowConfidenceFields(data map[string]json.RawMessage, scores map[string]float64, threshold float64) []string {
+	var low []string
+	for field := range data {
+		if score, ok := scores[field]; !ok || score < threshold {
+			low = append(low, field)
+		}
+	}
+	sort.Strings(low)
+	return low
+}
+
+// ocrWithConfidence runs a structured extraction that also asks for per-field
+// confidence, then re-prompts once for fields below req.ConfidenceThreshold and
+// keeps whichever answer scored higher.
+func (p *Provider) ocrWithConfidence(ctx context.Context, req *models.OCRRequest, prompt string, imageContent chatContent) (*models.OCRResponse, error) {
+	schema, err := wrapSchemaWithConfidence(req.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build confidence schema: %w", err)
+	}
+
+	var usage chatUsage
+
+	first, err := p.requestWithConfidence(ctx, req, schema, prompt+confidenceInstructions, imageContent, &usage)
+	if err != nil {
+		return nil, err
+	}
+	scores := first.scores()
+
+	if low := lowConfidenceFields(first.Data, scores, req.ConfidenceThreshold); len(low) > 0 {
+		previous, err := json.Marshal(first.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode previous result: %w", err)
+		}
+
+		retryPrompt := fmt.Sprintf("%s\n\nA previous extraction was uncertain about these fields: %s. Re-examine the image carefully for them and correct any mistakes.\n\nPrevious result: %s%s",
+			prompt, strings.Join(low, ", "), previous, confidenceInstructions)
+
+		second, err := p.requestWithConfidence(ctx, req, schema, retryPrompt, imageContent, &usage)
+		if err != nil {
+			return nil, err
+		}
+
+		retryScores := second.scores()
+		for _, field := range low {
+			value, ok := second.Data[field]
+			if !ok || retryScores[field] <= scores[field] {
+				continue
+			}
+			first.Data[field] = value
+			scores[field] = retryScores[field]
+		}
+	}
+
+	structured, err := json.Marshal(first.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode result: %w", err)
+	}
+
+	return &models.OCRResponse{
+		Structured:   structured,
+		Confidence:   scores,
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		Cost:         p.costCalc.CalculateOCR(req.Model, usage.PromptTokens, usage.CompletionTokens),
+	}, nil
+}
+
+func (p *Provider) requestWithConfidence(ctx context.Context, req *models.OCRRequest, schema json.RawMessage, prompt string, imageContent chatContent, usage *chatUsage) (*confidenceEnvelope, error) {
+	chatReq := &chatRequest{
+		Model: req.Model,
+		Messages: []chatMessage{
+			{
+				Role: "user",
+				Content: []chatContent{
+					{Type: "text", Text: prompt},
+					imageContent,
+				},
+			},
+		},
+		MaxCompletionTokens: req.MaxTokens,
+		ResponseFormat:      schemaResponseFormat(req.SchemaName, schema),
+	}
+
+	chatResp, err := p.sendOCRChat(ctx, chatReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if chatResp.Usage != nil {
+		usage.PromptTokens += chatResp.Usage.PromptTokens
+		usage.CompletionTokens += chatResp.Usage.CompletionTokens
+		usage.TotalTokens += chatResp.Usage.TotalTokens
+	}
+
+	// A cut-off envelope is not valid JSON, so say why instead of failing
+	// to parse it.
+	if chatResp.Choices[0].FinishReason == finishLength {
+		return nil, fmt.Errorf("OCR failed: reply was cut off at %d output tokens", req.MaxTokens)
+	}
+
+	var envelope confidenceEnvelope
+	if err := json.Unmarshal([]byte(chatResp.Choices[0].Message.Content), &envelope); err != nil {
+		return nil, fmt.Errorf("OCR failed: invalid confidence response: %w", err)
+	}
+	if envelope.Data == nil {
+		envelope.Data = make(map[string]json.RawMessage)
+	}
+
+	return &envelope, nil
+}
@@ -0,0 +1,135 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// exchangeDump is the file format written by --save-request and
+// --save-response. Body holds JSON payloads as-is and anything else as a
+// string; large base64 fields are truncated the same way verbose logging
+// truncates them.
+type exchangeDump struct {
+	Method  string              `json:"method,omitempty"`
+	URL     string              `json:"url,omitempty"`
+	Status  int                 `json:"status,omitempty"`
+	Headers map[string][]string `json:"headers"`
+	Body    any                 `json:"body,omitempty"`
+}
+
+// redactHeader hides credentials in header values shown to users.
+func redactHeader(key, value string) string {
+	if strings.EqualFold(key, "authorization") {
+		return "[REDACTED]"
+	}
+	return value
+}
+
+func redactHeaders(headers http.Header) map[string][]string {
+	redacted := make(map[string][]string, len(headers))
+	for key, values := range headers {
+		for _, value := range values {
+			redacted[key] = append(redacted[key], redactHeader(key, value))
+		}
+	}
+	return redacted
+}
+
+func dumpBody(body []byte) any {
+	if len(body) == 0 {
+		return nil
+	}
+	truncated := truncateBase64InJSON(body)
+	if json.Valid(truncated) {
+		return json.RawMessage(truncated)
+	}
+	return string(body)
+}
+
+// saveRequest writes the request to the --save-request file, replacing any
+// earlier request from this run.
+func (p *Provider) saveRequest(method, url string, headers http.Header, body []byte) {
+	if p.saveRequestPath == "" {
+		return
+	}
+	p.writeDump(p.saveRequestPath, &exchangeDump{
+		Method:  method,
+		URL:     url,
+		Headers: redactHeaders(headers),
+		Body:    dumpBody(body),
+	})
+}
+
+// saveMultipartRequest records an edit request, summarizing the image parts
+// by size instead of embedding binary data.
+func (p *Provider) saveMultipartRequest(method, url string, headers http.Header, req *models.EditRequest) {
+	if p.saveRequestPath == "" {
+		return
+	}
+
+	form := map[string]any{
+		"model":  req.Model,
+		"prompt": req.Prompt,
+	}
+	switch images := req.InputImages(); len(images) {
+	case 0:
+		form["image"] = "[0 bytes]"
+	case 1:
+		form["image"] = fmt.Sprintf("[%d bytes]", len(images[0]))
+	default:
+		sizes := make([]string, len(images))
+		for i, img := range images {
+			sizes[i] = fmt.Sprintf("[%d bytes]", len(img))
+		}
+		form["image[]"] = sizes
+	}
+	if len(req.Mask) > 0 {
+		form["mask"] = fmt.Sprintf("[%d bytes]", len(req.Mask))
+	}
+	if req.Size != "" {
+		form["size"] = req.Size
+	}
+	if req.Count > 0 {
+		form["n"] = req.Count
+	}
+	if req.Format != "" {
+		form["output_format"] = req.Format
+	}
+
+	p.writeDump(p.saveRequestPath, &exchangeDump{
+		Method:  method,
+		URL:     url,
+		Headers: redactHeaders(headers),
+		Body:    form,
+	})
+}
+
+// saveResponse writes the response to the --save-response file, replacing
+// any earlier response from this run.
+func (p *Provider) saveResponse(statusCode int, headers http.Header, body []byte) {
+	if p.saveResponsePath == "" {
+		return
+	}
+	p.writeDump(p.saveResponsePath, &exchangeDump{
+		Status:  statusCode,
+		Headers: redactHeaders(headers),
+		Body:    dumpBody(body),
+	})
+}
+
+func (p *Provider) writeDump(path string, dump *exchangeDump) {
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err == nil {
+		p.dumpMu.Lock()
+		err = os.WriteFile(path, append(data, '\n'), 0600)
+		p.dumpMu.Unlock()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write %s: %v\n", path, err)
+	}
+}
@@ -0,0 +1,100 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/manash/imggen/internal/provider"
+	"github.com/manash/imggen/pkg/models"
+)
+
+func TestProvider_SaveRequestAndResponse(t *testing.T) {
+	bigB64 := strings.Repeat("A", 500)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"created":1,"data":[{"b64_json":"` + bigB64 + `"}]}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	reqPath := filepath.Join(dir, "req.json")
+	respPath := filepath.Join(dir, "resp.json")
+
+	p, _ := New(&provider.Config{
+		APIKey:           "sk-secret-key",
+		BaseURL:          server.URL,
+		SaveRequestPath:  reqPath,
+		SaveResponsePath: respPath,
+	}, models.DefaultRegistry())
+
+	req := &models.Request{Prompt: "a lighthouse", Model: "gpt-image-1", Size: "1024x1024", Count: 1, Format: models.FormatPNG}
+	if _, err := p.Generate(context.Background(), req); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	reqData, err := os.ReadFile(reqPath)
+	if err != nil {
+		t.Fatalf("request file not written: %v", err)
+	}
+	if strings.Contains(string(reqData), "sk-secret-key") {
+		t.Error("request file contains the API key")
+	}
+
+	var reqDump exchangeDump
+	if err := json.Unmarshal(reqData, &reqDump); err != nil {
+		t.Fatalf("request file is not JSON: %v", err)
+	}
+	if reqDump.Method != http.MethodPost || !strings.HasSuffix(reqDump.URL, "/images/generations") {
+		t.Errorf("request dump = %s %s", reqDump.Method, reqDump.URL)
+	}
+	if got := reqDump.Headers["Authorization"]; len(got) != 1 || got[0] != "[REDACTED]" {
+		t.Errorf("Authorization header = %v, want [REDACTED]", got)
+	}
+	if body, _ := reqDump.Body.(map[string]any); body["prompt"] != "a lighthouse" {
+		t.Errorf("request body = %v, want the JSON payload", reqDump.Body)
+	}
+
+	respData, err := os.ReadFile(respPath)
+	if err != nil {
+		t.Fatalf("response file not written: %v", err)
+	}
+	var respDump exchangeDump
+	if err := json.Unmarshal(respData, &respDump); err != nil {
+		t.Fatalf("response file is not JSON: %v", err)
+	}
+	if respDump.Status != http.StatusOK {
+		t.Errorf("response status = %d, want 200", respDump.Status)
+	}
+	if strings.Contains(string(respData), bigB64) || !strings.Contains(string(respData), "[truncated]") {
+		t.Error("response file should truncate base64 image data")
+	}
+}
+
+func TestProvider_SaveMultipartRequest(t *testing.T) {
+	reqPath := filepath.Join(t.TempDir(), "req.json")
+	p := &Provider{saveRequestPath: reqPath}
+
+	headers := http.Header{"Authorization": []string{"Bearer sk-secret-key"}}
+	p.logMultipartRequest(http.MethodPost, "https://example.com/images/edits", headers, &models.EditRequest{
+		Image:  make([]byte, 42),
+		Prompt: "add a hat",
+		Model:  "gpt-image-1",
+	})
+
+	data, err := os.ReadFile(reqPath)
+	if err != nil {
+		t.Fatalf("request file not written: %v", err)
+	}
+	if strings.Contains(string(data), "sk-secret-key") {
+		t.Error("request file contains the API key")
+	}
+	if !strings.Contains(string(data), "[42 bytes]") {
+		t.Errorf("request file = %s, want image summarized by size", data)
+	}
+}
@@ -9,11 +9,25 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"strings"
+	"time"
 
+	"github.com/manash/imggen/internal/image"
 	"github.com/manash/imggen/internal/provider"
 	"github.com/manash/imggen/pkg/models"
 )
 
+// editInputLimits are OpenAI's upload limits for edit images and masks.
+var editInputLimits = map[string]image.InputLimits{
+	"dall-e-2":    {MaxBytes: 4 << 20, Square: true},
+	"gpt-image-1": {MaxBytes: 50 << 20},
+}
+
+// EditInputLimits returns OpenAI's upload limits for model's edit inputs.
+func EditInputLimits(model string) image.InputLimits {
+	return editInputLimits[model]
+}
+
 func (p *Provider) SupportsEdit(model string) bool {
 	cap, ok := p.registry.Get(model)
 	if !ok {
@@ -22,7 +36,11 @@ func (p *Provider) SupportsEdit(model string) bool {
 	return cap.SupportsEdit && cap.Provider == models.ProviderOpenAI
 }
 
-func (p *Provider) Edit(ctx context.Context, req *models.EditRequest) (*models.Response, error) {
+func (p *Provider) Edit(ctx context.Context, req *models.EditRequest) (_ *models.Response, err error) {
+	ctx, done := provider.WithTimeout(ctx, "edit", p.timeouts.Edit)
+	defer done(&err)
+
+	start := time.Now()
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
@@ -31,15 +49,41 @@ func (p *Provider) Edit(ctx context.Context, req *models.EditRequest) (*models.R
 		return nil, fmt.Errorf("%w: %s", provider.ErrEditNotSupported, req.Model)
 	}
 
+	images := req.InputImages()
+	cap, _ := p.registry.Get(req.Model)
+	if limit := cap.EditImageLimit(); len(images) > limit {
+		return nil, fmt.Errorf("%w: %s takes at most %d, got %d", models.ErrTooManyEditImages, req.Model, limit, len(images))
+	}
+
+	limits := editInputLimits[req.Model]
+	for i, img := range images {
+		if err := image.ValidateInput(editImageName(i, len(images)), img, limits); err != nil {
+			return nil, fmt.Errorf("%s edit: %w", req.Model, err)
+		}
+	}
+	if len(req.Mask) > 0 {
+		if err := image.ValidateInput("mask", req.Mask, limits); err != nil {
+			return nil, fmt.Errorf("%s edit: %w", req.Model, err)
+		}
+	}
+
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
-	imagePart, err := createFormFileWithContentType(writer, "image", "image.png", "image/png")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create image part: %w", err)
+	// A single image keeps the plain "image" field that every edit model
+	// accepts; several are sent as repeated "image[]" parts.
+	field := "image"
+	if len(images) > 1 {
+		field = "image[]"
 	}
-	if _, err := imagePart.Write(req.Image); err != nil {
-		return nil, fmt.Errorf("failed to write image: %w", err)
+	for i, img := range images {
+		imagePart, err := createFormFileWithContentType(writer, field, strings.ReplaceAll(editImageName(i, len(images)), " ", "-")+".png", "image/png")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create image part: %w", err)
+		}
+		if _, err := imagePart.Write(img); err != nil {
+			return nil, fmt.Errorf("failed to write image: %w", err)
+		}
 	}
 
 	if len(req.Mask) > 0 {
@@ -97,16 +141,12 @@ func (p *Provider) Edit(ctx context.Context, req *models.EditRequest) (*models.R
 
 	p.logMultipartRequest(http.MethodPost, url, httpReq.Header, req)
 
-	resp, err := p.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := io.ReadAll(resp.Body)
+	requestStart := time.Now()
+	resp, bodyBytes, err := p.doWithRetry(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
+	requestDuration := time.Since(requestStart)
 
 	p.logResponse(resp.StatusCode, resp.Header, bodyBytes)
 
@@ -128,15 +168,26 @@ func (p *Provider) Edit(ctx context.Context, req *models.EditRequest) (*models.R
 		return nil, err
 	}
 
-	// Edit operations use medium quality for gpt-image-1, no quality for dall-e-2
-	quality := ""
-	if req.Model == "gpt-image-1" {
-		quality = "medium"
+	// Edits take no quality setting, so they are priced at the model's
+	// default.
+	var quality string
+	if cap != nil {
+		quality = cap.DefaultQuality
 	}
-	response.Cost = p.costCalc.Calculate(models.ProviderOpenAI, req.Model, req.Size, quality, len(response.Images))
+	response.Cost = p.calculateCost(apiResp.Usage, req.Model, req.Size, quality, len(response.Images))
+	response.Timing = models.Timing{RequestDuration: requestDuration, TotalDuration: time.Since(start)}
 	return response, nil
 }
 
+// editImageName names input i of n in errors and logs: "image" for a
+// single input, "image 2" for the second of several.
+func editImageName(i, n int) string {
+	if n == 1 {
+		return "image"
+	}
+	return fmt.Sprintf("image %d", i+1)
+}
+
 func createFormFileWithContentType(w *multipart.Writer, fieldname, filename, contentType string) (io.Writer, error) {
 	h := make(textproto.MIMEHeader)
 	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, fieldname, filename))
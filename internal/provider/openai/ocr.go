@@ -11,6 +11,8 @@ import (
 	"os"
 	"strings"
 
+	"github.com/manash/imggen/internal/image"
+	"github.com/manash/imggen/internal/provider"
 	"github.com/manash/imggen/pkg/models"
 )
 
@@ -35,6 +37,12 @@ type chatRequest struct {
 	Messages            []chatMessage     `json:"messages"`
 	MaxCompletionTokens int               `json:"max_completion_tokens,omitempty"`
 	ResponseFormat      *responseFormat   `json:"response_format,omitempty"`
+	Stream              bool              `json:"stream,omitempty"`
+	StreamOptions       *streamOptions    `json:"stream_options,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type responseFormat struct {
@@ -64,6 +72,9 @@ type chatChoice struct {
 	FinishReason string         `json:"finish_reason"`
 }
 
+// finishLength is the finish_reason of a reply cut off by max_completion_tokens.
+const finishLength = "length"
+
 type chatMessageOut struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
@@ -87,7 +98,10 @@ func (p *Provider) ListOCRModels() []string {
 	return p.registry.ListOCRByProvider(models.ProviderOpenAI)
 }
 
-func (p *Provider) OCR(ctx context.Context, req *models.OCRRequest) (*models.OCRResponse, error) {
+func (p *Provider) OCR(ctx context.Context, req *models.OCRRequest) (_ *models.OCRResponse, err error) {
+	ctx, done := provider.WithTimeout(ctx, "OCR", p.timeouts.OCR)
+	defer done(&err)
+
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
@@ -97,46 +111,87 @@ func (p *Provider) OCR(ctx context.Context, req *models.OCRRequest) (*models.OCR
 		return nil, fmt.Errorf("failed to prepare image: %w", err)
 	}
 
-	prompt := req.Prompt
-	if prompt == "" {
-		if len(req.Schema) > 0 {
-			prompt = "Extract all text and data from this image and return it in the specified JSON structure."
-		} else {
-			prompt = "Extract all text from this image. Preserve the original formatting and structure as much as possible."
-		}
+	prompt := ocrPrompt(req)
+
+	if len(req.Schema) > 0 && req.ConfidenceThreshold > 0 {
+		return p.ocrWithConfidence(ctx, req, prompt, imageContent)
 	}
 
-	messages := []chatMessage{
-		{
-			Role: "user",
-			Content: []chatContent{
-				{Type: "text", Text: prompt},
-				imageContent,
-			},
-		},
+	chatReq := newOCRChatRequest(req, prompt, imageContent)
+
+	chatResp, err := p.sendOCRChat(ctx, chatReq)
+	if err != nil {
+		return nil, err
 	}
 
-	chatReq := &chatRequest{
-		Model:               req.Model,
-		Messages:            messages,
-		MaxCompletionTokens: req.MaxTokens,
+	content := chatResp.Choices[0].Message.Content
+
+	ocrResp := &models.OCRResponse{Truncated: chatResp.Choices[0].FinishReason == finishLength}
+
+	if len(req.Schema) > 0 {
+		ocrResp.Structured = json.RawMessage(content)
+	} else {
+		ocrResp.Text = content
 	}
 
+	if chatResp.Usage != nil {
+		ocrResp.InputTokens = chatResp.Usage.PromptTokens
+		ocrResp.OutputTokens = chatResp.Usage.CompletionTokens
+		ocrResp.Cost = p.costCalc.CalculateOCR(req.Model, chatResp.Usage.PromptTokens, chatResp.Usage.CompletionTokens)
+	}
+
+	return ocrResp, nil
+}
+
+// ocrPrompt returns req's prompt, or the default extraction instruction.
+func ocrPrompt(req *models.OCRRequest) string {
+	if req.Prompt != "" {
+		return req.Prompt
+	}
 	if len(req.Schema) > 0 {
-		schemaName := req.SchemaName
-		if schemaName == "" {
-			schemaName = "extracted_data"
-		}
-		chatReq.ResponseFormat = &responseFormat{
-			Type: "json_schema",
-			JSONSchema: &jsonSchema{
-				Name:   schemaName,
-				Strict: true,
-				Schema: req.Schema,
+		return "Extract all text and data from this image and return it in the specified JSON structure."
+	}
+	return "Extract all text from this image. Preserve the original formatting and structure as much as possible."
+}
+
+// newOCRChatRequest builds the single-message chat request for an extraction.
+func newOCRChatRequest(req *models.OCRRequest, prompt string, imageContent chatContent) *chatRequest {
+	chatReq := &chatRequest{
+		Model: req.Model,
+		Messages: []chatMessage{
+			{
+				Role: "user",
+				Content: []chatContent{
+					{Type: "text", Text: prompt},
+					imageContent,
+				},
 			},
-		}
+		},
+		MaxCompletionTokens: req.MaxTokens,
 	}
+	if len(req.Schema) > 0 {
+		chatReq.ResponseFormat = schemaResponseFormat(req.SchemaName, req.Schema)
+	}
+	return chatReq
+}
+
+func schemaResponseFormat(name string, schema json.RawMessage) *responseFormat {
+	if name == "" {
+		name = "extracted_data"
+	}
+	return &responseFormat{
+		Type: "json_schema",
+		JSONSchema: &jsonSchema{
+			Name:   name,
+			Strict: true,
+			Schema: schema,
+		},
+	}
+}
 
+// sendOCRChat posts a chat completion request and returns the parsed response,
+// failing if the API reported an error or returned no choices.
+func (p *Provider) sendOCRChat(ctx context.Context, chatReq *chatRequest) (*chatResponse, error) {
 	jsonData, err := json.Marshal(chatReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -153,15 +208,9 @@ func (p *Provider) OCR(ctx context.Context, req *models.OCRRequest) (*models.OCR
 
 	p.logOCRRequest(http.MethodPost, url, httpReq.Header, chatReq)
 
-	resp, err := p.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	resp, body, err := p.doWithRetry(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
 
 	p.logResponse(resp.StatusCode, resp.Header, body)
@@ -183,26 +232,13 @@ func (p *Provider) OCR(ctx context.Context, req *models.OCRRequest) (*models.OCR
 		return nil, fmt.Errorf("OCR failed: no response choices")
 	}
 
-	content := chatResp.Choices[0].Message.Content
-
-	ocrResp := &models.OCRResponse{}
-
-	if len(req.Schema) > 0 {
-		ocrResp.Structured = json.RawMessage(content)
-	} else {
-		ocrResp.Text = content
-	}
-
-	if chatResp.Usage != nil {
-		ocrResp.InputTokens = chatResp.Usage.PromptTokens
-		ocrResp.OutputTokens = chatResp.Usage.CompletionTokens
-		ocrResp.Cost = p.costCalc.CalculateOCR(req.Model, chatResp.Usage.PromptTokens, chatResp.Usage.CompletionTokens)
-	}
-
-	return ocrResp, nil
+	return &chatResp, nil
 }
 
-func (p *Provider) SuggestSchema(ctx context.Context, req *models.OCRRequest) (json.RawMessage, error) {
+func (p *Provider) SuggestSchema(ctx context.Context, req *models.OCRRequest) (_ json.RawMessage, err error) {
+	ctx, done := provider.WithTimeout(ctx, "schema suggestion", p.timeouts.OCR)
+	defer done(&err)
+
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
@@ -309,6 +345,9 @@ Example format:
 	return json.RawMessage(content), nil
 }
 
+// ocrInputLimits is OpenAI's size limit for images sent to vision models.
+var ocrInputLimits = image.InputLimits{MaxBytes: 20 << 20}
+
 func (p *Provider) prepareImageContent(ctx context.Context, req *models.OCRRequest) (chatContent, error) {
 	var imageData []byte
 	var mimeType string
@@ -333,6 +372,10 @@ func (p *Provider) prepareImageContent(ctx context.Context, req *models.OCRReque
 		}, nil
 	}
 
+	if err := image.ValidateInput("image", imageData, ocrInputLimits); err != nil {
+		return chatContent{}, err
+	}
+
 	base64Data := base64.StdEncoding.EncodeToString(imageData)
 	dataURL := fmt.Sprintf("data:%s;base64,%s", mimeType, base64Data)
 
@@ -371,6 +414,11 @@ func detectMimeType(data []byte) string {
 }
 
 func (p *Provider) logOCRRequest(method, url string, headers http.Header, req *chatRequest) {
+	if p.saveRequestPath != "" {
+		if body, err := json.Marshal(req); err == nil {
+			p.saveRequest(method, url, headers, body)
+		}
+	}
 	if !p.verbose {
 		return
 	}
@@ -380,10 +428,7 @@ func (p *Provider) logOCRRequest(method, url string, headers http.Header, req *c
 	fmt.Fprintln(os.Stderr, "Headers:")
 	for key, values := range headers {
 		for _, value := range values {
-			if strings.ToLower(key) == "authorization" {
-				value = "[REDACTED]"
-			}
-			fmt.Fprintf(os.Stderr, "  %s: %s\n", key, value)
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", key, redactHeader(key, value))
 		}
 	}
 	fmt.Fprintln(os.Stderr, "Body:")
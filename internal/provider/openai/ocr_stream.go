@@ -0,0 +1,135 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/manash/imggen/internal/provider"
+	"github.com/manash/imggen/internal/sse"
+	"github.com/manash/imggen/pkg/models"
+)
+
+// chatChunk is one streamed chat completion event. With include_usage set,
+// the last chunk has no choices and carries the usage for the whole reply.
+type chatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *chatUsage `json:"usage,omitempty"`
+	Error *apiError  `json:"error,omitempty"`
+}
+
+// StreamOCR extracts text like OCR but streams it, calling onDelta with
+// each piece of text as it arrives. The returned response holds the full
+// text, or the structured JSON when req has a schema, along with the cost
+// when the API reports usage. Confidence scoring needs the complete answer
+// and is not supported.
+func (p *Provider) StreamOCR(ctx context.Context, req *models.OCRRequest, onDelta func(string)) (_ *models.OCRResponse, err error) {
+	ctx, done := provider.WithTimeout(ctx, "OCR", p.timeouts.OCR)
+	defer done(&err)
+
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if req.ConfidenceThreshold > 0 {
+		return nil, fmt.Errorf("confidence scoring cannot be streamed")
+	}
+
+	imageContent, err := p.prepareImageContent(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare image: %w", err)
+	}
+
+	chatReq := newOCRChatRequest(req, ocrPrompt(req), imageContent)
+	chatReq.Stream = true
+	chatReq.StreamOptions = &streamOptions{IncludeUsage: true}
+
+	jsonData, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := p.baseURL + "/chat/completions"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	p.logOCRRequest(http.MethodPost, url, httpReq.Header, chatReq)
+
+	// Retrying would replay text already passed to onDelta, so a stream is
+	// sent once.
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		p.logResponse(resp.StatusCode, resp.Header, body)
+		var errResp chatResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != nil {
+			return nil, fmt.Errorf("OCR failed: %s", errResp.Error.Message)
+		}
+		return nil, fmt.Errorf("OCR failed: status %d", resp.StatusCode)
+	}
+	p.logResponse(resp.StatusCode, resp.Header, nil)
+
+	var (
+		text      strings.Builder
+		usage     *chatUsage
+		truncated bool
+	)
+	for event, err := range sse.NewReader(resp.Body).Events(ctx) {
+		if err != nil {
+			return nil, fmt.Errorf("OCR stream interrupted: %w", err)
+		}
+
+		var chunk chatChunk
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to parse stream event: %w", err)
+		}
+		if chunk.Error != nil {
+			return nil, fmt.Errorf("OCR failed: %s", chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason == finishLength {
+				truncated = true
+			}
+			if delta := choice.Delta.Content; delta != "" {
+				text.WriteString(delta)
+				if onDelta != nil {
+					onDelta(delta)
+				}
+			}
+		}
+	}
+
+	ocrResp := &models.OCRResponse{Truncated: truncated}
+	if len(req.Schema) > 0 {
+		ocrResp.Structured = json.RawMessage(text.String())
+	} else {
+		ocrResp.Text = text.String()
+	}
+	if usage != nil {
+		ocrResp.InputTokens = usage.PromptTokens
+		ocrResp.OutputTokens = usage.CompletionTokens
+		ocrResp.Cost = p.costCalc.CalculateOCR(req.Model, usage.PromptTokens, usage.CompletionTokens)
+	}
+	return ocrResp, nil
+}
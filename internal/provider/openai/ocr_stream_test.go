@@ -0,0 +1,101 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/manash/imggen/internal/provider"
+	"github.com/manash/imggen/pkg/models"
+)
+
+func newStreamServer(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if !req.Stream || req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+			t.Errorf("request should ask for a stream with usage, got stream=%t options=%+v", req.Stream, req.StreamOptions)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestProvider_StreamOCR(t *testing.T) {
+	var stream strings.Builder
+	stream.WriteString(": connected\n\n")
+	for _, piece := range []string{"Invoice ", "#42\n", "Total: $10"} {
+		fmt.Fprintf(&stream, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", piece)
+	}
+	stream.WriteString("data: {\"choices\":[],\"usage\":{\"prompt_tokens\":100,\"completion_tokens\":50}}\n\n")
+	stream.WriteString("data: [DONE]\n\n")
+
+	server := newStreamServer(t, http.StatusOK, stream.String())
+	defer server.Close()
+
+	prov, err := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := models.NewOCRRequest()
+	req.ImageData = []byte{0x89, 0x50, 0x4E, 0x47}
+
+	var deltas []string
+	resp, err := prov.StreamOCR(context.Background(), req, func(s string) { deltas = append(deltas, s) })
+	if err != nil {
+		t.Fatalf("StreamOCR() error = %v", err)
+	}
+
+	if len(deltas) != 3 {
+		t.Errorf("onDelta called %d times, want 3: %q", len(deltas), deltas)
+	}
+	if resp.Text != "Invoice #42\nTotal: $10" {
+		t.Errorf("Text = %q, want the joined deltas", resp.Text)
+	}
+	if resp.InputTokens != 100 || resp.OutputTokens != 50 || resp.Cost == nil {
+		t.Errorf("usage = %d/%d cost %v, want 100/50 with a cost", resp.InputTokens, resp.OutputTokens, resp.Cost)
+	}
+}
+
+func TestProvider_StreamOCR_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"api error", http.StatusBadRequest, `{"error":{"message":"bad image"}}`, "bad image"},
+		{"status only", http.StatusBadGateway, "upstream down", "status 502"},
+		{"error event", http.StatusOK, "data: {\"error\":{\"message\":\"overloaded\"}}\n\n", "overloaded"},
+		{"malformed event", http.StatusOK, "data: {not json\n\n", "failed to parse stream event"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newStreamServer(t, tt.status, tt.body)
+			defer server.Close()
+
+			prov, err := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := models.NewOCRRequest()
+			req.ImageData = []byte{0x89, 0x50, 0x4E, 0x47}
+
+			_, err = prov.StreamOCR(context.Background(), req, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("StreamOCR() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,11 +3,14 @@ package openai
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/manash/imggen/internal/image"
 	"github.com/manash/imggen/internal/provider"
 	"github.com/manash/imggen/pkg/models"
 )
@@ -148,6 +151,45 @@ func TestProvider_OCR_Success(t *testing.T) {
 	}
 }
 
+func TestProvider_OCR_Truncated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if req.MaxCompletionTokens != 64 {
+			t.Errorf("max_completion_tokens = %d, want 64", req.MaxCompletionTokens)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(chatResponse{
+			Choices: []chatChoice{{Message: chatMessageOut{Role: "assistant", Content: "Partial te"}, FinishReason: "length"}},
+			Usage:   &chatUsage{PromptTokens: 100, CompletionTokens: 64, TotalTokens: 164},
+		})
+	}))
+	defer server.Close()
+
+	prov, err := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	req := models.NewOCRRequest()
+	req.ImageData = []byte{0x89, 0x50, 0x4E, 0x47}
+	req.MaxTokens = 64
+
+	resp, err := prov.OCR(context.Background(), req)
+	if err != nil {
+		t.Fatalf("OCR() error = %v", err)
+	}
+	if !resp.Truncated {
+		t.Error("OCR().Truncated = false, want true for finish_reason length")
+	}
+	if resp.Text != "Partial te" {
+		t.Errorf("OCR().Text = %q, want the partial text", resp.Text)
+	}
+}
+
 func TestProvider_OCR_WithSchema(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var req chatRequest
@@ -237,6 +279,29 @@ func TestProvider_OCR_ValidationError(t *testing.T) {
 	}
 }
 
+func TestProvider_OCR_ImageTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not be sent for an oversized image")
+	}))
+	defer server.Close()
+
+	prov, err := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	atLimit := &models.OCRRequest{ImageData: make([]byte, 20<<20), Model: "gpt-4o-mini"}
+	if _, err := prov.prepareImageContent(context.Background(), atLimit); err != nil {
+		t.Errorf("prepareImageContent() at the limit error = %v, want nil", err)
+	}
+
+	over := &models.OCRRequest{ImageData: make([]byte, 20<<20+1), Model: "gpt-4o-mini"}
+	_, err = prov.OCR(context.Background(), over)
+	if !errors.Is(err, image.ErrInputTooLarge) || !strings.Contains(err.Error(), "limit is 20 MB") {
+		t.Errorf("OCR() error = %v, want ErrInputTooLarge with the 20 MB limit", err)
+	}
+}
+
 func TestProvider_OCR_APIError(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		resp := chatResponse{
@@ -750,3 +815,97 @@ func TestDetectMimeType(t *testing.T) {
 		})
 	}
 }
+
+func TestProvider_OCR_ConfidenceThreshold_RepromptsLowFields(t *testing.T) {
+	responses := []string{
+		`{"data": {"name": "J0hn", "total": "12.50"}, "confidence": [{"field": "name", "score": 0.4}, {"field": "total", "score": 0.95}]}`,
+		`{"data": {"name": "John", "total": "99.99"}, "confidence": [{"field": "name", "score": 0.92}, {"field": "total", "score": 0.5}]}`,
+	}
+	var prompts []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.ResponseFormat == nil || req.ResponseFormat.JSONSchema == nil {
+			t.Fatal("Expected json_schema response_format")
+		}
+		if !strings.Contains(string(req.ResponseFormat.JSONSchema.Schema), `"confidence"`) {
+			t.Error("Expected schema to request confidence scores")
+		}
+		prompts = append(prompts, req.Messages[0].Content[0].Text)
+
+		resp := chatResponse{
+			Choices: []chatChoice{{Message: chatMessageOut{Content: responses[len(prompts)-1]}}},
+			Usage:   &chatUsage{PromptTokens: 100, CompletionTokens: 20},
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	prov, err := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	req := models.NewOCRRequest()
+	req.ImageData = []byte{0x89, 0x50, 0x4E, 0x47}
+	req.Schema = json.RawMessage(`{"type": "object", "properties": {"name": {"type": "string"}, "total": {"type": "string"}}, "required": ["name", "total"], "additionalProperties": false}`)
+	req.ConfidenceThreshold = 0.8
+
+	resp, err := prov.OCR(context.Background(), req)
+	if err != nil {
+		t.Fatalf("OCR() error = %v", err)
+	}
+
+	if len(prompts) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(prompts))
+	}
+	if !strings.Contains(prompts[1], "uncertain about these fields: name.") {
+		t.Errorf("re-prompt should list only low-confidence fields, got %q", prompts[1])
+	}
+
+	var result map[string]string
+	if err := json.Unmarshal(resp.Structured, &result); err != nil {
+		t.Fatalf("Failed to unmarshal structured response: %v", err)
+	}
+	if result["name"] != "John" {
+		t.Errorf("name = %q, want re-examined value John", result["name"])
+	}
+	if result["total"] != "12.50" {
+		t.Errorf("total = %q, want original high-confidence value 12.50", result["total"])
+	}
+	if resp.Confidence["name"] != 0.92 || resp.Confidence["total"] != 0.95 {
+		t.Errorf("Confidence = %v, want name=0.92 total=0.95", resp.Confidence)
+	}
+	if resp.InputTokens != 200 || resp.OutputTokens != 40 {
+		t.Errorf("tokens = %d/%d, want usage summed over both requests", resp.InputTokens, resp.OutputTokens)
+	}
+}
+
+func TestProvider_OCR_ConfidenceThreshold_NoRepromptWhenConfident(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		resp := chatResponse{
+			Choices: []chatChoice{{Message: chatMessageOut{Content: `{"data": {"name": "John"}, "confidence": [{"field": "name", "score": 0.99}]}`}}},
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	prov, _ := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+
+	req := models.NewOCRRequest()
+	req.ImageData = []byte{0x89, 0x50, 0x4E, 0x47}
+	req.Schema = json.RawMessage(`{"type": "object", "properties": {"name": {"type": "string"}}}`)
+	req.ConfidenceThreshold = 0.8
+
+	if _, err := prov.OCR(context.Background(), req); err != nil {
+		t.Fatalf("OCR() error = %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected a single request, got %d", requests)
+	}
+}
@@ -6,10 +6,10 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/manash/imggen/internal/cost"
@@ -17,10 +17,8 @@ import (
 	"github.com/manash/imggen/pkg/models"
 )
 
-const (
-	defaultBaseURL = "https://api.openai.com/v1"
-	defaultTimeout = 120 * time.Second
-)
+// DefaultBaseURL is the OpenAI API endpoint used unless Config.BaseURL is set.
+const DefaultBaseURL = "https://api.openai.com/v1"
 
 type apiRequest struct {
 	Model          string `json:"model"`
@@ -36,10 +34,23 @@ type apiRequest struct {
 
 type apiResponse struct {
 	Created int64       `json:"created"`
+	Model   string      `json:"model,omitempty"`
 	Data    []imageData `json:"data"`
+	Usage   *imageUsage `json:"usage,omitempty"`
 	Error   *apiError   `json:"error,omitempty"`
 }
 
+// imageUsage is the token usage gpt-image-1 reports for generations and edits.
+type imageUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	OutputTokens       int `json:"output_tokens"`
+	TotalTokens        int `json:"total_tokens"`
+	InputTokensDetails struct {
+		TextTokens  int `json:"text_tokens"`
+		ImageTokens int `json:"image_tokens"`
+	} `json:"input_tokens_details"`
+}
+
 type imageData struct {
 	URL           string `json:"url,omitempty"`
 	B64JSON       string `json:"b64_json,omitempty"`
@@ -53,12 +64,19 @@ type apiError struct {
 }
 
 type Provider struct {
-	apiKey     string
-	baseURL    string
-	httpClient *http.Client
-	registry   *models.ModelRegistry
-	verbose    bool
-	costCalc   *cost.Calculator
+	apiKey         string
+	baseURL        string
+	httpClient     *http.Client
+	registry       *models.ModelRegistry
+	verbose        bool
+	costCalc       *cost.Calculator
+	maxRetries     int
+	retryBaseDelay time.Duration
+	timeouts       provider.Timeouts
+
+	saveRequestPath  string
+	saveResponsePath string
+	dumpMu           sync.Mutex
 }
 
 func New(cfg *provider.Config, registry *models.ModelRegistry) (*Provider, error) {
@@ -68,23 +86,27 @@ func New(cfg *provider.Config, registry *models.ModelRegistry) (*Provider, error
 
 	baseURL := cfg.BaseURL
 	if baseURL == "" {
-		baseURL = defaultBaseURL
+		baseURL = DefaultBaseURL
 	}
 
-	timeout := defaultTimeout
-	if cfg.TimeoutSec > 0 {
-		timeout = time.Duration(cfg.TimeoutSec) * time.Second
+	httpClient, err := provider.HTTPClient(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Provider{
-		apiKey:  cfg.APIKey,
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: timeout,
-		},
-		registry: registry,
-		verbose:  cfg.Verbose,
-		costCalc: cost.NewCalculator(),
+		apiKey:         cfg.APIKey,
+		baseURL:        baseURL,
+		httpClient:     httpClient,
+		registry:       registry,
+		verbose:        cfg.Verbose,
+		costCalc:       cost.NewCalculator(cost.WithOverrides(cfg.PriceOverrides)),
+		maxRetries:     cfg.MaxRetries,
+		retryBaseDelay: cfg.RetryBaseDelay,
+		timeouts:       cfg.Timeouts(),
+
+		saveRequestPath:  cfg.SaveRequestPath,
+		saveResponsePath: cfg.SaveResponsePath,
 	}, nil
 }
 
@@ -104,7 +126,11 @@ func (p *Provider) ListModels() []string {
 	return p.registry.ListByProvider(models.ProviderOpenAI)
 }
 
-func (p *Provider) Generate(ctx context.Context, req *models.Request) (*models.Response, error) {
+func (p *Provider) Generate(ctx context.Context, req *models.Request) (_ *models.Response, err error) {
+	ctx, done := provider.WithTimeout(ctx, "generate", p.timeouts.Generate)
+	defer done(&err)
+
+	start := time.Now()
 	apiReq := p.buildAPIRequest(req)
 
 	jsonData, err := json.Marshal(apiReq)
@@ -123,16 +149,12 @@ func (p *Provider) Generate(ctx context.Context, req *models.Request) (*models.R
 
 	p.logRequest(http.MethodPost, url, httpReq.Header, jsonData)
 
-	resp, err := p.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	requestStart := time.Now()
+	resp, body, err := p.doWithRetry(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
+	requestDuration := time.Since(requestStart)
 
 	p.logResponse(resp.StatusCode, resp.Header, body)
 
@@ -154,10 +176,35 @@ func (p *Provider) Generate(ctx context.Context, req *models.Request) (*models.R
 		return nil, err
 	}
 
-	response.Cost = p.costCalc.Calculate(models.ProviderOpenAI, req.Model, req.Size, req.Quality, len(response.Images))
+	response.Cost = p.calculateCost(apiResp.Usage, req.Model, req.Size, req.Quality, len(response.Images))
+	response.Timing = models.Timing{RequestDuration: requestDuration, TotalDuration: time.Since(start)}
 	return response, nil
 }
 
+// calculateCost prices a response from a pricing file override, then from
+// its reported token usage when present, falling back to the static
+// per-image table.
+func (p *Provider) calculateCost(usage *imageUsage, model, size, quality string, count int) *models.CostInfo {
+	if info, ok := p.costCalc.Override(model, size, quality, count); ok {
+		return info
+	}
+	if usage != nil {
+		textTokens := usage.InputTokensDetails.TextTokens
+		imageTokens := usage.InputTokensDetails.ImageTokens
+		if textTokens == 0 && imageTokens == 0 {
+			textTokens = usage.InputTokens
+		}
+		if info, ok := p.costCalc.CalculateImageTokens(model, textTokens, imageTokens, usage.OutputTokens, count); ok {
+			return info
+		}
+	}
+	return p.costCalc.Calculate(models.ProviderOpenAI, model, size, quality, count)
+}
+
+// NoRevisePrefix is the preamble OpenAI documents for keeping dall-e-3 from
+// rewriting a prompt. The API has no parameter for this.
+const NoRevisePrefix = "I NEED to test how the tool works with extremely simple prompts. DO NOT add any detail, just use it AS-IS: "
+
 func (p *Provider) buildAPIRequest(req *models.Request) *apiRequest {
 	apiReq := &apiRequest{
 		Model:  req.Model,
@@ -183,6 +230,9 @@ func (p *Provider) buildAPIRequest(req *models.Request) *apiRequest {
 		if req.Style != "" {
 			apiReq.Style = req.Style
 		}
+		if req.NoRevise {
+			apiReq.Prompt = NoRevisePrefix + req.Prompt
+		}
 	case "dall-e-2":
 		apiReq.ResponseFormat = "url"
 	}
@@ -192,7 +242,15 @@ func (p *Provider) buildAPIRequest(req *models.Request) *apiRequest {
 
 func (p *Provider) buildResponse(apiResp apiResponse) (*models.Response, error) {
 	response := &models.Response{
-		Images: make([]models.GeneratedImage, 0, len(apiResp.Data)),
+		Images:    make([]models.GeneratedImage, 0, len(apiResp.Data)),
+		ModelUsed: apiResp.Model,
+	}
+	if apiResp.Created != 0 {
+		response.CreatedAt = time.Unix(apiResp.Created, 0).UTC()
+	}
+	if apiResp.Usage != nil {
+		response.InputTokens = apiResp.Usage.InputTokens
+		response.OutputTokens = apiResp.Usage.OutputTokens
 	}
 
 	for i, data := range apiResp.Data {
@@ -220,26 +278,8 @@ func (p *Provider) buildResponse(apiResp apiResponse) (*models.Response, error)
 	return response, nil
 }
 
-func (p *Provider) DownloadImage(ctx context.Context, url string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create download request: %w", err)
-	}
-
-	resp, err := p.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to download image: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("download failed with status: %d", resp.StatusCode)
-	}
-
-	return io.ReadAll(resp.Body)
-}
-
 func (p *Provider) logMultipartRequest(method, url string, headers http.Header, req *models.EditRequest) {
+	p.saveMultipartRequest(method, url, headers, req)
 	if !p.verbose {
 		return
 	}
@@ -249,16 +289,16 @@ func (p *Provider) logMultipartRequest(method, url string, headers http.Header,
 	fmt.Fprintln(os.Stderr, "Headers:")
 	for key, values := range headers {
 		for _, value := range values {
-			if strings.ToLower(key) == "authorization" {
-				value = "[REDACTED]"
-			}
-			fmt.Fprintf(os.Stderr, "  %s: %s\n", key, value)
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", key, redactHeader(key, value))
 		}
 	}
 	fmt.Fprintln(os.Stderr, "Body (multipart form):")
 	fmt.Fprintf(os.Stderr, "  model: %s\n", req.Model)
 	fmt.Fprintf(os.Stderr, "  prompt: %s\n", req.Prompt)
-	fmt.Fprintf(os.Stderr, "  image: [%d bytes]\n", len(req.Image))
+	images := req.InputImages()
+	for i, img := range images {
+		fmt.Fprintf(os.Stderr, "  %s: [%d bytes]\n", editImageName(i, len(images)), len(img))
+	}
 	if len(req.Mask) > 0 {
 		fmt.Fprintf(os.Stderr, "  mask: [%d bytes]\n", len(req.Mask))
 	}
@@ -275,6 +315,7 @@ func (p *Provider) logMultipartRequest(method, url string, headers http.Header,
 }
 
 func (p *Provider) logRequest(method, url string, headers http.Header, body []byte) {
+	p.saveRequest(method, url, headers, body)
 	if !p.verbose {
 		return
 	}
@@ -284,10 +325,7 @@ func (p *Provider) logRequest(method, url string, headers http.Header, body []by
 	fmt.Fprintln(os.Stderr, "Headers:")
 	for key, values := range headers {
 		for _, value := range values {
-			if strings.ToLower(key) == "authorization" {
-				value = "[REDACTED]"
-			}
-			fmt.Fprintf(os.Stderr, "  %s: %s\n", key, value)
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", key, redactHeader(key, value))
 		}
 	}
 	if len(body) > 0 {
@@ -303,6 +341,7 @@ func (p *Provider) logRequest(method, url string, headers http.Header, body []by
 }
 
 func (p *Provider) logResponse(statusCode int, headers http.Header, body []byte) {
+	p.saveResponse(statusCode, headers, body)
 	if !p.verbose {
 		return
 	}
@@ -348,7 +387,7 @@ func truncateBase64Fields(data map[string]interface{}) {
 	for key, value := range data {
 		switch v := value.(type) {
 		case string:
-			if key == "b64_json" && len(v) > 100 {
+			if (key == "b64_json" || strings.HasPrefix(v, "data:")) && len(v) > 100 {
 				data[key] = v[:100] + "... [truncated]"
 			}
 		case map[string]interface{}:
@@ -5,14 +5,25 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	stdimage "image"
+	"image/png"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/manash/imggen/internal/cost"
+	"github.com/manash/imggen/internal/image"
 	"github.com/manash/imggen/internal/provider"
 	"github.com/manash/imggen/pkg/models"
 )
@@ -69,6 +80,54 @@ func TestNew(t *testing.T) {
 	}
 }
 
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestNew_HTTPClient(t *testing.T) {
+	var captured *http.Request
+	var capturedBody apiRequest
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		captured = req
+		json.NewDecoder(req.Body).Decode(&capturedBody)
+		body, _ := json.Marshal(apiResponse{Data: []imageData{{B64JSON: base64.StdEncoding.EncodeToString([]byte("fake image data"))}}})
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    req,
+		}, nil
+	})}
+
+	// The injected client is used as is, so a CA file that does not exist
+	// is never read.
+	p, err := New(&provider.Config{APIKey: "test-key", HTTPClient: client, CACertFile: "missing.pem"}, models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	resp, err := p.Generate(context.Background(), &models.Request{Model: "gpt-image-1", Prompt: "a fox", Count: 1, Size: "1024x1024"})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if captured == nil {
+		t.Fatal("custom RoundTripper saw no request")
+	}
+	if captured.Method != http.MethodPost || captured.URL.String() != DefaultBaseURL+"/images/generations" {
+		t.Errorf("request = %s %s, want POST to the generations endpoint", captured.Method, captured.URL)
+	}
+	if captured.Header.Get("Authorization") != "Bearer test-key" {
+		t.Errorf("Authorization = %q", captured.Header.Get("Authorization"))
+	}
+	if capturedBody.Prompt != "a fox" || capturedBody.Model != "gpt-image-1" {
+		t.Errorf("request body = %+v, want the prompt and model", capturedBody)
+	}
+	if len(resp.Images) != 1 || string(resp.Images[0].Data) != "fake image data" {
+		t.Errorf("Generate() images = %d, want the faked image", len(resp.Images))
+	}
+}
+
 func TestProvider_Name(t *testing.T) {
 	p, _ := New(&provider.Config{APIKey: "test"}, models.DefaultRegistry())
 	if p.Name() != models.ProviderOpenAI {
@@ -192,6 +251,48 @@ func TestProvider_Generate_Success(t *testing.T) {
 	}
 }
 
+func TestProvider_Generate_CACertFile(t *testing.T) {
+	// A TLS-intercepting proxy presents a certificate from a private CA.
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(apiResponse{
+			Created: time.Now().Unix(),
+			Data:    []imageData{{B64JSON: base64.StdEncoding.EncodeToString([]byte("fake image data"))}},
+		})
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "corp-ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+	req := &models.Request{Model: "gpt-image-1", Prompt: "test prompt", Count: 1, Size: "1024x1024", Format: models.FormatPNG}
+
+	untrusted, err := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := untrusted.Generate(context.Background(), req); err == nil {
+		t.Fatal("Generate() without the CA file error = nil, want a certificate error")
+	}
+
+	p, err := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL, CACertFile: caFile}, models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	resp, err := p.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Generate() with the CA file error = %v", err)
+	}
+	if len(resp.Images) != 1 || string(resp.Images[0].Data) != "fake image data" {
+		t.Errorf("Generate() images = %d, want the fake image", len(resp.Images))
+	}
+
+	if _, err := New(&provider.Config{APIKey: "test-key", CACertFile: filepath.Join(t.TempDir(), "missing.pem")}, models.DefaultRegistry()); err == nil {
+		t.Error("New() with a missing CA file error = nil")
+	}
+}
+
 func TestProvider_Generate_WithURL(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		resp := apiResponse{
@@ -326,6 +427,84 @@ func TestProvider_Generate_ContextCanceled(t *testing.T) {
 	}
 }
 
+func TestProvider_OperationTimeouts(t *testing.T) {
+	// The server never answers in time.
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	p, err := New(&provider.Config{
+		APIKey:          "test-key",
+		BaseURL:         server.URL,
+		GenerateTimeout: 20 * time.Millisecond,
+		DownloadTimeout: 20 * time.Millisecond,
+		OCRTimeout:      20 * time.Millisecond,
+	}, models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		op   string
+		call func() error
+	}{
+		{"generate", func() error {
+			_, err := p.Generate(ctx, &models.Request{Model: "gpt-image-1", Prompt: "test", Count: 1})
+			return err
+		}},
+		{"download", func() error {
+			_, err := p.DownloadImage(ctx, server.URL+"/image.png")
+			return err
+		}},
+		{"OCR", func() error {
+			_, err := p.OCR(ctx, &models.OCRRequest{ImageData: []byte("\x89PNG\r\n\x1a\n"), Model: "gpt-4o-mini"})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			err := tt.call()
+			var timeoutErr *provider.TimeoutError
+			if !errors.As(err, &timeoutErr) || timeoutErr.Op != tt.op {
+				t.Fatalf("error = %v, want a %s *provider.TimeoutError", err, tt.op)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("error = %v, want it to match context.DeadlineExceeded", err)
+			}
+		})
+	}
+}
+
+func TestProvider_Generate_FailureIsNotTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error": {"message": "server error"}}`))
+	}))
+	defer server.Close()
+
+	p, err := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL, GenerateTimeout: time.Minute}, models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	_, err = p.Generate(context.Background(), &models.Request{Model: "gpt-image-1", Prompt: "test", Count: 1})
+	var timeoutErr *provider.TimeoutError
+	if err == nil || errors.As(err, &timeoutErr) || !errors.Is(err, provider.ErrGenerationFailed) {
+		t.Errorf("Generate() error = %v, want ErrGenerationFailed and not a timeout", err)
+	}
+
+	// A caller canceling is not a timeout either.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = p.Generate(ctx, &models.Request{Model: "gpt-image-1", Prompt: "test", Count: 1})
+	if errors.As(err, &timeoutErr) || !errors.Is(err, context.Canceled) {
+		t.Errorf("Generate() with a canceled context error = %v, want context.Canceled", err)
+	}
+}
+
 func TestProvider_buildAPIRequest_GPTImage1(t *testing.T) {
 	p, _ := New(&provider.Config{APIKey: "test"}, models.DefaultRegistry())
 
@@ -428,6 +607,98 @@ func TestProvider_buildResponse(t *testing.T) {
 	}
 }
 
+func TestProvider_buildResponse_Usage(t *testing.T) {
+	p, _ := New(&provider.Config{APIKey: "test"}, models.DefaultRegistry())
+
+	apiResp := apiResponse{
+		Data:  []imageData{{URL: "https://example.com/img.png"}},
+		Usage: &imageUsage{InputTokens: 50, OutputTokens: 4160, TotalTokens: 4210},
+	}
+
+	resp, err := p.buildResponse(apiResp)
+	if err != nil {
+		t.Fatalf("buildResponse() error = %v", err)
+	}
+	if resp.InputTokens != 50 || resp.OutputTokens != 4160 {
+		t.Errorf("tokens = %d/%d, want 50/4160", resp.InputTokens, resp.OutputTokens)
+	}
+}
+
+func TestProvider_Generate_ResponseMetadata(t *testing.T) {
+	created := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"created": %d, "model": "gpt-image-1-2025-04-15", "data": [{"url": "https://example.com/img.png"}]}`, created.Unix())
+	}))
+	defer server.Close()
+
+	p, err := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	req := &models.Request{Model: "gpt-image-1", Prompt: "a fox", Count: 1, Size: "1024x1024", Format: models.FormatPNG}
+
+	resp, err := p.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !resp.CreatedAt.Equal(created) {
+		t.Errorf("CreatedAt = %v, want %v", resp.CreatedAt, created)
+	}
+	if resp.ModelUsed != "gpt-image-1-2025-04-15" {
+		t.Errorf("ModelUsed = %q, want the model the API echoed", resp.ModelUsed)
+	}
+}
+
+func TestProvider_Timing(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data": [{"b64_json": %q}]}`, base64.StdEncoding.EncodeToString([]byte("img")))
+	}))
+	defer server.Close()
+
+	p, err := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	gen, err := p.Generate(ctx, &models.Request{Model: "gpt-image-1", Prompt: "a fox", Count: 1, Size: "1024x1024"})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	edit, err := p.Edit(ctx, &models.EditRequest{Model: "gpt-image-1", Prompt: "make it blue", Image: []byte("fake image data")})
+	if err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+
+	for name, timing := range map[string]models.Timing{"Generate": gen.Timing, "Edit": edit.Timing} {
+		if timing.RequestDuration < delay {
+			t.Errorf("%s RequestDuration = %v, want at least %v", name, timing.RequestDuration, delay)
+		}
+		if timing.TotalDuration < timing.RequestDuration {
+			t.Errorf("%s TotalDuration = %v, want at least RequestDuration %v", name, timing.TotalDuration, timing.RequestDuration)
+		}
+		if timing.DownloadDuration != 0 {
+			t.Errorf("%s DownloadDuration = %v, want 0 for inline images", name, timing.DownloadDuration)
+		}
+	}
+}
+
+func TestProvider_buildResponse_NoMetadata(t *testing.T) {
+	p, _ := New(&provider.Config{APIKey: "test"}, models.DefaultRegistry())
+
+	resp, err := p.buildResponse(apiResponse{Data: []imageData{{URL: "https://example.com/img.png"}}})
+	if err != nil {
+		t.Fatalf("buildResponse() error = %v", err)
+	}
+	if !resp.CreatedAt.IsZero() || resp.ModelUsed != "" {
+		t.Errorf("CreatedAt = %v, ModelUsed = %q; want zero values when the API reports neither", resp.CreatedAt, resp.ModelUsed)
+	}
+}
+
 func TestProvider_buildResponse_InvalidBase64(t *testing.T) {
 	p, _ := New(&provider.Config{APIKey: "test"}, models.DefaultRegistry())
 
@@ -475,6 +746,136 @@ func TestProvider_DownloadImage_Error(t *testing.T) {
 	}
 }
 
+func TestProvider_DownloadImage_RetriesFlakyServer(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("image bytes"))
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test", MaxRetries: 3, RetryBaseDelay: time.Millisecond}, models.DefaultRegistry())
+
+	data, err := p.DownloadImage(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("DownloadImage() error = %v", err)
+	}
+	if string(data) != "image bytes" || calls.Load() != 3 {
+		t.Errorf("DownloadImage() = %q after %d calls, want image bytes after 3", data, calls.Load())
+	}
+}
+
+// cutShort sends the first n bytes of body with a Content-Length for all of
+// it, then drops the connection.
+func cutShort(t *testing.T, w http.ResponseWriter, body []byte, n int) {
+	t.Helper()
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body[:n])
+	w.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func TestProvider_DownloadImage_ResumesWithRange(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 1000)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("Accept-Ranges", "bytes")
+		if len(ranges) == 1 {
+			cutShort(t, w, body, 4000)
+		}
+		http.ServeContent(w, r, "image.png", time.Time{}, bytes.NewReader(body))
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test", MaxRetries: 2, RetryBaseDelay: time.Millisecond}, models.DefaultRegistry())
+
+	data, err := p.DownloadImage(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("DownloadImage() error = %v", err)
+	}
+	if !bytes.Equal(data, body) {
+		t.Errorf("DownloadImage() returned %d bytes, want the %d-byte body intact", len(data), len(body))
+	}
+	if want := []string{"", "bytes=4000-"}; !slices.Equal(ranges, want) {
+		t.Errorf("Range headers = %q, want %q", ranges, want)
+	}
+}
+
+func TestProvider_DownloadImage_RestartsWithoutRangeSupport(t *testing.T) {
+	body := bytes.Repeat([]byte("abcdefghij"), 1000)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if len(ranges) == 1 {
+			cutShort(t, w, body, 4000)
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test", MaxRetries: 2, RetryBaseDelay: time.Millisecond}, models.DefaultRegistry())
+
+	data, err := p.DownloadImage(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("DownloadImage() error = %v", err)
+	}
+	if !bytes.Equal(data, body) {
+		t.Errorf("DownloadImage() returned %d bytes, want the %d-byte body intact", len(data), len(body))
+	}
+	if want := []string{"", ""}; !slices.Equal(ranges, want) {
+		t.Errorf("Range headers = %q, want a full restart %q", ranges, want)
+	}
+}
+
+func TestProvider_DownloadImage_CanceledBetweenAttempts(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test", MaxRetries: 5, RetryBaseDelay: time.Minute}, models.DefaultRegistry())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := p.DownloadImage(ctx, server.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DownloadImage() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("DownloadImage() took %s, want it to stop waiting when canceled", elapsed)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("server called %d times, want 1", calls.Load())
+	}
+}
+
+func TestProvider_DownloadImage_NoRetryOnClientError(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test", MaxRetries: 3, RetryBaseDelay: time.Millisecond}, models.DefaultRegistry())
+
+	if _, err := p.DownloadImage(context.Background(), server.URL); err == nil {
+		t.Fatal("DownloadImage() error = nil, want error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("server called %d times, want 1 for a 403", calls.Load())
+	}
+}
+
 func TestProvider_Generate_MultipleImages(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		resp := apiResponse{
@@ -588,6 +989,31 @@ func TestProvider_buildAPIRequest_DallE3NoStyle(t *testing.T) {
 	}
 }
 
+func TestProvider_buildAPIRequest_NoRevise(t *testing.T) {
+	p, _ := New(&provider.Config{APIKey: "test"}, models.DefaultRegistry())
+
+	tests := []struct {
+		model    string
+		noRevise bool
+		want     string
+	}{
+		{"dall-e-3", true, NoRevisePrefix + "a red fox"},
+		{"dall-e-3", false, "a red fox"},
+		{"dall-e-2", true, "a red fox"},
+		{"gpt-image-1", true, "a red fox"},
+	}
+
+	for _, tt := range tests {
+		req := &models.Request{Model: tt.model, Prompt: "a red fox", Count: 1, NoRevise: tt.noRevise}
+		if got := p.buildAPIRequest(req).Prompt; got != tt.want {
+			t.Errorf("%s NoRevise=%v: Prompt = %q, want %q", tt.model, tt.noRevise, got, tt.want)
+		}
+		if req.Prompt != "a red fox" {
+			t.Errorf("%s: request prompt was modified", tt.model)
+		}
+	}
+}
+
 func TestProvider_buildAPIRequest_NoQuality(t *testing.T) {
 	p, _ := New(&provider.Config{APIKey: "test"}, models.DefaultRegistry())
 
@@ -1325,6 +1751,125 @@ func TestProvider_Edit_DallE2(t *testing.T) {
 	}
 }
 
+func TestProvider_Edit_InputLimits(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	var wide bytes.Buffer
+	if err := png.Encode(&wide, stdimage.NewRGBA(stdimage.Rect(0, 0, 16, 9))); err != nil {
+		t.Fatal(err)
+	}
+	oversized := make([]byte, 4<<20+1)
+
+	tests := []struct {
+		name    string
+		model   string
+		image   []byte
+		mask    []byte
+		wantErr string
+	}{
+		{"dall-e-2 image over 4 MB", "dall-e-2", oversized, nil, "dall-e-2 edit: image is 4.0 MB (4194305 bytes), limit is 4 MB"},
+		{"dall-e-2 mask over 4 MB", "dall-e-2", []byte("image"), oversized, "mask is 4.0 MB"},
+		{"dall-e-2 non-square", "dall-e-2", wide.Bytes(), nil, "image is 16x9, limit is a square image"},
+		{"gpt-image-1 over 50 MB", "gpt-image-1", make([]byte, 50<<20+1), nil, "limit is 50 MB"},
+	}
+
+	cfg := &provider.Config{APIKey: "test-key", BaseURL: server.URL}
+	p, _ := New(cfg, models.DefaultRegistry())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &models.EditRequest{Model: tt.model, Prompt: "edit", Image: tt.image, Mask: tt.mask}
+			_, err := p.Edit(context.Background(), req)
+			if !errors.Is(err, image.ErrInputTooLarge) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Edit() error = %v, want ErrInputTooLarge containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if n := requests.Load(); n != 0 {
+		t.Errorf("server received %d requests, want none for rejected inputs", n)
+	}
+}
+
+func TestProvider_Edit_MultipleImages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm() error = %v", err)
+		}
+		if _, ok := r.MultipartForm.File["image"]; ok {
+			t.Error("multi-image edit sent a plain image field")
+		}
+		parts := r.MultipartForm.File["image[]"]
+		if len(parts) != 3 {
+			t.Fatalf("got %d image[] parts, want 3", len(parts))
+		}
+		for i, want := range []string{"first", "second", "third"} {
+			f, err := parts[i].Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(f)
+			f.Close()
+			if string(data) != want {
+				t.Errorf("image[] part %d = %q, want %q", i, data, want)
+			}
+			if ct := parts[i].Header.Get("Content-Type"); ct != "image/png" {
+				t.Errorf("image[] part %d Content-Type = %q, want image/png", i, ct)
+			}
+		}
+		if got := r.FormValue("prompt"); got != "combine them" {
+			t.Errorf("prompt = %q, want %q", got, "combine them")
+		}
+
+		json.NewEncoder(w).Encode(apiResponse{
+			Data: []imageData{{B64JSON: base64.StdEncoding.EncodeToString([]byte("combined"))}},
+		})
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+
+	req := models.NewMultiImageEditRequest([][]byte{[]byte("first"), []byte("second"), []byte("third")}, "combine them")
+	req.Model = "gpt-image-1"
+	resp, err := p.Edit(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	if string(resp.Images[0].Data) != "combined" {
+		t.Errorf("Edit() image = %q, want combined", resp.Images[0].Data)
+	}
+}
+
+func TestProvider_Edit_MultipleImagesRejected(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+
+	req := models.NewMultiImageEditRequest([][]byte{[]byte("a"), []byte("b")}, "combine")
+	req.Model = "dall-e-2"
+	if _, err := p.Edit(context.Background(), req); !errors.Is(err, models.ErrTooManyEditImages) {
+		t.Errorf("Edit(dall-e-2, 2 images) error = %v, want ErrTooManyEditImages", err)
+	}
+
+	req = models.NewMultiImageEditRequest([][]byte{[]byte("a"), make([]byte, 50<<20+1)}, "combine")
+	req.Model = "gpt-image-1"
+	if _, err := p.Edit(context.Background(), req); !errors.Is(err, image.ErrInputTooLarge) || !strings.Contains(err.Error(), "image 2 is") {
+		t.Errorf("Edit(oversized second image) error = %v, want ErrInputTooLarge naming image 2", err)
+	}
+
+	if n := requests.Load(); n != 0 {
+		t.Errorf("server received %d requests, want none for rejected inputs", n)
+	}
+}
+
 func TestProvider_Edit_ValidationError(t *testing.T) {
 	p, _ := New(&provider.Config{APIKey: "test"}, models.DefaultRegistry())
 
@@ -1507,6 +2052,38 @@ func TestProvider_Edit_WithVerbose(t *testing.T) {
 
 // Cost Integration Tests
 
+func TestProvider_Edit_VerboseMultipleImages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(apiResponse{
+			Data: []imageData{{B64JSON: base64.StdEncoding.EncodeToString([]byte("img"))}},
+		})
+	}))
+	defer server.Close()
+
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	p, _ := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL, Verbose: true}, models.DefaultRegistry())
+	req := models.NewMultiImageEditRequest([][]byte{[]byte("first"), []byte("second")}, "combine")
+	req.Model = "gpt-image-1"
+	_, err := p.Edit(context.Background(), req)
+
+	w.Close()
+	os.Stderr = oldStderr
+
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+	if err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	for _, want := range []string{"image 1: [5 bytes]", "image 2: [6 bytes]"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("verbose log missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
 func TestProvider_Generate_ReturnsCost(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		resp := apiResponse{
@@ -1549,6 +2126,56 @@ func TestProvider_Generate_ReturnsCost(t *testing.T) {
 	}
 }
 
+func TestProvider_Generate_PriceOverride(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage *imageUsage
+	}{
+		{"table price", nil},
+		{"token usage reported", &imageUsage{InputTokens: 50, OutputTokens: 4160, TotalTokens: 4210}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(apiResponse{
+					Data:  []imageData{{B64JSON: base64.StdEncoding.EncodeToString([]byte("img"))}},
+					Usage: tt.usage,
+				})
+			}))
+			defer server.Close()
+
+			p, _ := New(&provider.Config{
+				APIKey:         "test-key",
+				BaseURL:        server.URL,
+				PriceOverrides: cost.Overrides{"gpt-image-1": {"1024x1024": {"high": 0.19}}},
+			}, models.DefaultRegistry())
+			req := &models.Request{Model: "gpt-image-1", Prompt: "test", Count: 1, Size: "1024x1024", Quality: "high"}
+
+			resp, err := p.Generate(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			if !floatEquals(resp.Cost.PerImage, 0.19) {
+				t.Errorf("Generate() cost.PerImage = %f, want override 0.19", resp.Cost.PerImage)
+			}
+			if resp.Cost.Source != models.CostSourceOverride {
+				t.Errorf("Generate() cost.Source = %q, want %q", resp.Cost.Source, models.CostSourceOverride)
+			}
+
+			// Sizes and qualities without an override keep the built-in price.
+			req.Quality = "medium"
+			resp, err = p.Generate(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			if resp.Cost.Source == models.CostSourceOverride {
+				t.Errorf("Generate() medium quality used an override: %+v", resp.Cost)
+			}
+		})
+	}
+}
+
 func TestProvider_Generate_Cost_GPTImage1_Medium(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		resp := apiResponse{
@@ -1945,3 +2572,180 @@ func floatEquals(a, b float64) bool {
 	const epsilon = 0.0001
 	return (a-b) < epsilon && (b-a) < epsilon
 }
+
+func TestProvider_Generate_CostFromUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"created": 1,
+			"data": [{"b64_json": "` + base64.StdEncoding.EncodeToString([]byte("img")) + `"}],
+			"usage": {
+				"input_tokens": 50,
+				"output_tokens": 4160,
+				"total_tokens": 4210,
+				"input_tokens_details": {"text_tokens": 40, "image_tokens": 10}
+			}
+		}`))
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+
+	req := &models.Request{Model: "gpt-image-1", Prompt: "test prompt", Count: 1, Size: "1024x1024", Quality: "high"}
+	resp, err := p.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	// 40 text @ $5/1M + 10 image @ $10/1M + 4160 output @ $40/1M
+	want := (40*5.0 + 10*10.0 + 4160*40.0) / 1_000_000
+	if diff := resp.Cost.Total - want; diff > 1e-12 || diff < -1e-12 {
+		t.Errorf("Generate() cost.Total = %f, want %f", resp.Cost.Total, want)
+	}
+	if resp.Cost.Source != models.CostSourceUsage {
+		t.Errorf("Generate() cost.Source = %q, want %q", resp.Cost.Source, models.CostSourceUsage)
+	}
+}
+
+func TestProvider_Generate_CostWithoutUsageUsesTable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(apiResponse{
+			Data: []imageData{{B64JSON: base64.StdEncoding.EncodeToString([]byte("img"))}},
+		})
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+
+	req := &models.Request{Model: "gpt-image-1", Prompt: "test prompt", Count: 1, Size: "1024x1024", Quality: "high"}
+	resp, err := p.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if resp.Cost.Total != 0.167 {
+		t.Errorf("Generate() cost.Total = %f, want table price 0.167", resp.Cost.Total)
+	}
+	if resp.Cost.Source != models.CostSourceTable {
+		t.Errorf("Generate() cost.Source = %q, want %q", resp.Cost.Source, models.CostSourceTable)
+	}
+}
+
+func TestProvider_Generate_RetriesTransientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req apiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Prompt != "test prompt" {
+			t.Errorf("retried request body not replayed: %v %+v", err, req)
+		}
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(apiResponse{})
+			return
+		}
+		json.NewEncoder(w).Encode(apiResponse{
+			Data: []imageData{{B64JSON: base64.StdEncoding.EncodeToString([]byte("img"))}},
+		})
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{
+		APIKey:         "test-key",
+		BaseURL:        server.URL,
+		MaxRetries:     3,
+		RetryBaseDelay: time.Millisecond,
+	}, models.DefaultRegistry())
+
+	req := &models.Request{Model: "gpt-image-1", Prompt: "test prompt", Count: 1}
+	resp, err := p.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("server called %d times, want 3", calls.Load())
+	}
+	if len(resp.Images) != 1 {
+		t.Errorf("Generate() returned %d images, want 1", len(resp.Images))
+	}
+}
+
+func TestProvider_Generate_NoRetriesByDefault(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+
+	_, err := p.Generate(context.Background(), &models.Request{Model: "gpt-image-1", Prompt: "test", Count: 1})
+	if !errors.Is(err, provider.ErrGenerationFailed) {
+		t.Errorf("Generate() error = %v, want ErrGenerationFailed", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("server called %d times, want 1", calls.Load())
+	}
+}
+
+func TestProvider_Edit_RetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil || r.FormValue("prompt") != "edit" {
+			t.Errorf("retried multipart body not replayed: %v", err)
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{}`))
+			return
+		}
+		json.NewEncoder(w).Encode(apiResponse{
+			Data: []imageData{{B64JSON: base64.StdEncoding.EncodeToString([]byte("img"))}},
+		})
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{
+		APIKey:         "test-key",
+		BaseURL:        server.URL,
+		MaxRetries:     1,
+		RetryBaseDelay: time.Millisecond,
+	}, models.DefaultRegistry())
+
+	req := models.NewEditRequest([]byte("image"), "edit")
+	req.Model = "gpt-image-1"
+	if _, err := p.Edit(context.Background(), req); err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("server called %d times, want 2", calls.Load())
+	}
+}
+
+func TestProvider_Generate_RetryHonorsRetryAfterAndContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{
+		APIKey:         "test-key",
+		BaseURL:        server.URL,
+		MaxRetries:     5,
+		RetryBaseDelay: time.Millisecond,
+	}, models.DefaultRegistry())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := p.Generate(ctx, &models.Request{Model: "gpt-image-1", Prompt: "test", Count: 1})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Generate() error = %v, want context.DeadlineExceeded while waiting on Retry-After", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Generate() took %v, cancellation not honored during backoff", elapsed)
+	}
+}
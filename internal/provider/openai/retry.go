@@ -0,0 +1,71 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/manash/imggen/internal/provider"
+)
+
+// doWithRetry sends httpReq and reads the response body, retrying rate-limit
+// (429) and server (5xx) responses up to p.maxRetries times. Delays grow
+// exponentially with jitter unless the server asks for a specific wait via
+// Retry-After. The request body must be replayable through GetBody, which
+// http.NewRequestWithContext arranges for in-memory bodies.
+func (p *Provider) doWithRetry(httpReq *http.Request) (*http.Response, []byte, error) {
+	ctx := httpReq.Context()
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && httpReq.GetBody != nil {
+			body, err := httpReq.GetBody()
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to reset request body: %w", err)
+			}
+			httpReq.Body = body
+		}
+
+		resp, err := p.httpClient.Do(httpReq)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to send request: %w", err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		if !provider.IsRetryableStatus(resp.StatusCode) || attempt >= p.maxRetries {
+			return resp, body, nil
+		}
+
+		delay := provider.RetryDelay(attempt, p.retryBaseDelay, resp.Header.Get("Retry-After"))
+		if p.verbose {
+			fmt.Fprintf(os.Stderr, "Status %d, retrying in %s (retry %d of %d)\n", resp.StatusCode, delay.Round(time.Millisecond), attempt+1, p.maxRetries)
+		}
+
+		if err := provider.Sleep(ctx, delay); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// DownloadImage fetches a generated image from url, as returned by models
+// that answer with URLs rather than base64, retrying and resuming as
+// provider.Downloader does.
+func (p *Provider) DownloadImage(ctx context.Context, url string) ([]byte, error) {
+	d := &provider.Downloader{
+		Client:         p.httpClient,
+		MaxRetries:     p.maxRetries,
+		RetryBaseDelay: p.retryBaseDelay,
+		Timeout:        p.timeouts.Download,
+	}
+	if p.verbose {
+		d.Log = os.Stderr
+	}
+	return d.Download(ctx, url)
+}
@@ -0,0 +1,115 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/manash/imggen/internal/provider"
+	"github.com/manash/imggen/pkg/models"
+)
+
+func (p *Provider) SupportsVariations(model string) bool {
+	cap, ok := p.registry.Get(model)
+	if !ok {
+		return false
+	}
+	return cap.SupportsVariations && cap.Provider == models.ProviderOpenAI
+}
+
+// Variations calls /images/variations to produce variants of req.Image.
+// Only dall-e-2 supports the endpoint; other models return
+// models.ErrVariationsNotSupported.
+func (p *Provider) Variations(ctx context.Context, req *models.VariationRequest) (_ *models.Response, err error) {
+	ctx, done := provider.WithTimeout(ctx, "variations", p.timeouts.Edit)
+	defer done(&err)
+
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	if !p.SupportsVariations(req.Model) {
+		return nil, fmt.Errorf("%w: %s", models.ErrVariationsNotSupported, req.Model)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	imagePart, err := createFormFileWithContentType(writer, "image", "image.png", "image/png")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image part: %w", err)
+	}
+	if _, err := imagePart.Write(req.Image); err != nil {
+		return nil, fmt.Errorf("failed to write image: %w", err)
+	}
+
+	if err := writer.WriteField("model", req.Model); err != nil {
+		return nil, fmt.Errorf("failed to write model: %w", err)
+	}
+
+	if req.Size != "" {
+		if err := writer.WriteField("size", req.Size); err != nil {
+			return nil, fmt.Errorf("failed to write size: %w", err)
+		}
+	}
+
+	if err := writer.WriteField("n", fmt.Sprintf("%d", req.Count)); err != nil {
+		return nil, fmt.Errorf("failed to write count: %w", err)
+	}
+
+	if err := writer.WriteField("response_format", "url"); err != nil {
+		return nil, fmt.Errorf("failed to write response_format: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	url := p.baseURL + "/images/variations"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", writer.FormDataContentType())
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	p.logMultipartRequest(http.MethodPost, url, httpReq.Header, &models.EditRequest{
+		Image: req.Image,
+		Model: req.Model,
+		Size:  req.Size,
+		Count: req.Count,
+	})
+
+	resp, bodyBytes, err := p.doWithRetry(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logResponse(resp.StatusCode, resp.Header, bodyBytes)
+
+	var apiResp apiResponse
+	if err := json.Unmarshal(bodyBytes, &apiResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if apiResp.Error != nil {
+		return nil, fmt.Errorf("%w: %s", provider.ErrVariationFailed, apiResp.Error.Message)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", provider.ErrVariationFailed, resp.StatusCode)
+	}
+
+	response, err := p.buildResponse(apiResp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Variations are billed like dall-e-2 generations of the same size.
+	response.Cost = p.costCalc.Calculate(models.ProviderOpenAI, req.Model, req.Size, "", len(response.Images))
+	return response, nil
+}
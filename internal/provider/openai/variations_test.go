@@ -0,0 +1,98 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/manash/imggen/internal/provider"
+	"github.com/manash/imggen/pkg/models"
+)
+
+func TestProvider_SupportsVariations(t *testing.T) {
+	p, _ := New(&provider.Config{APIKey: "test-key"}, models.DefaultRegistry())
+
+	tests := []struct {
+		model string
+		want  bool
+	}{
+		{"dall-e-2", true},
+		{"dall-e-3", false},
+		{"gpt-image-1", false},
+		{"stable-diffusion-xl", false},
+		{"unknown", false},
+	}
+
+	for _, tt := range tests {
+		if got := p.SupportsVariations(tt.model); got != tt.want {
+			t.Errorf("SupportsVariations(%s) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestProvider_Variations_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/variations" {
+			t.Errorf("path = %s, want /images/variations", r.URL.Path)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm() error = %v", err)
+		}
+		if r.FormValue("n") != "3" || r.FormValue("size") != "512x512" || r.FormValue("prompt") != "" {
+			t.Errorf("form = %v, want n=3 size=512x512 and no prompt", r.MultipartForm.Value)
+		}
+		if _, _, err := r.FormFile("image"); err != nil {
+			t.Errorf("missing image part: %v", err)
+		}
+		w.Write([]byte(`{"created":1,"data":[{"url":"https://example.com/1.png"},{"url":"https://example.com/2.png"},{"url":"https://example.com/3.png"}]}`))
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+
+	req := models.NewVariationRequest([]byte("png-data"))
+	req.Size = "512x512"
+	req.Count = 3
+
+	resp, err := p.Variations(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Variations() error = %v", err)
+	}
+	if len(resp.Images) != 3 {
+		t.Errorf("len(Images) = %d, want 3", len(resp.Images))
+	}
+	// Priced like dall-e-2 generation at 512x512.
+	if math.Abs(resp.Cost.Total-3*0.018) > 1e-9 {
+		t.Errorf("Cost.Total = %.4f, want %.4f", resp.Cost.Total, 3*0.018)
+	}
+}
+
+func TestProvider_Variations_UnsupportedModel(t *testing.T) {
+	p, _ := New(&provider.Config{APIKey: "test-key"}, models.DefaultRegistry())
+
+	req := models.NewVariationRequest([]byte("png-data"))
+	req.Model = "gpt-image-1"
+
+	_, err := p.Variations(context.Background(), req)
+	if !errors.Is(err, models.ErrVariationsNotSupported) {
+		t.Errorf("Variations() error = %v, want ErrVariationsNotSupported", err)
+	}
+}
+
+func TestProvider_Variations_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"image must be square","type":"invalid_request_error"}}`))
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL}, models.DefaultRegistry())
+
+	_, err := p.Variations(context.Background(), models.NewVariationRequest([]byte("png-data")))
+	if !errors.Is(err, provider.ErrVariationFailed) {
+		t.Errorf("Variations() error = %v, want ErrVariationFailed", err)
+	}
+}
@@ -18,6 +18,10 @@ import (
 var (
 	defaultPollInterval = 2 * time.Second
 	maxPollAttempts     = 300 // 10 minutes max at 2s intervals
+
+	// videoRequestTimeout bounds each request that creates a video job or
+	// polls its status; the job itself may run for up to maxPollAttempts.
+	videoRequestTimeout = 2 * time.Minute
 )
 
 type videoJobResponse struct {
@@ -62,7 +66,10 @@ func (p *Provider) GenerateVideo(ctx context.Context, req *models.VideoRequest)
 	return response, nil
 }
 
-func (p *Provider) createVideoJob(ctx context.Context, req *models.VideoRequest) (*videoJobResponse, error) {
+func (p *Provider) createVideoJob(ctx context.Context, req *models.VideoRequest) (_ *videoJobResponse, err error) {
+	ctx, done := provider.WithTimeout(ctx, "video job", videoRequestTimeout)
+	defer done(&err)
+
 	var body bytes.Buffer
 	writer := multipart.NewWriter(&body)
 
@@ -161,7 +168,10 @@ func (p *Provider) pollVideoStatus(ctx context.Context, videoID string) (*videoJ
 	return nil, fmt.Errorf("%w: exceeded maximum poll attempts", provider.ErrVideoNotReady)
 }
 
-func (p *Provider) getVideoStatus(ctx context.Context, videoID string) (*videoJobResponse, error) {
+func (p *Provider) getVideoStatus(ctx context.Context, videoID string) (_ *videoJobResponse, err error) {
+	ctx, done := provider.WithTimeout(ctx, "video status", videoRequestTimeout)
+	defer done(&err)
+
 	url := p.baseURL + "/videos/" + videoID
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
@@ -189,7 +199,10 @@ func (p *Provider) getVideoStatus(ctx context.Context, videoID string) (*videoJo
 	return &jobResp, nil
 }
 
-func (p *Provider) downloadVideo(ctx context.Context, videoID string) ([]byte, error) {
+func (p *Provider) downloadVideo(ctx context.Context, videoID string) (_ []byte, err error) {
+	ctx, done := provider.WithTimeout(ctx, "video download", p.timeouts.Download)
+	defer done(&err)
+
 	url := p.baseURL + "/videos/" + videoID + "/content"
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
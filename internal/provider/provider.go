@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
+	"github.com/manash/imggen/internal/cost"
 	"github.com/manash/imggen/pkg/models"
 )
 
@@ -15,6 +18,7 @@ var (
 	ErrGenerationFailed      = errors.New("image generation failed")
 	ErrEditFailed            = errors.New("image edit failed")
 	ErrEditNotSupported      = errors.New("image editing not supported by model")
+	ErrVariationFailed       = errors.New("image variation failed")
 	ErrVideoGenerationFailed = errors.New("video generation failed")
 	ErrVideoNotReady         = errors.New("video not ready")
 	ErrVideoDownloadFailed   = errors.New("video download failed")
@@ -29,6 +33,13 @@ type Provider interface {
 	ListModels() []string
 }
 
+// VariationProvider is implemented by providers that can produce variants
+// of an existing image without a prompt.
+type VariationProvider interface {
+	Variations(ctx context.Context, req *models.VariationRequest) (*models.Response, error)
+	SupportsVariations(model string) bool
+}
+
 // VideoProvider interface for video generation capabilities
 type VideoProvider interface {
 	GenerateVideo(ctx context.Context, req *models.VideoRequest) (*models.VideoResponse, error)
@@ -37,10 +48,56 @@ type VideoProvider interface {
 }
 
 type Config struct {
-	APIKey     string
-	BaseURL    string
+	// Provider selects which backend to construct. Empty means OpenAI.
+	Provider models.ProviderType
+
+	APIKey  string
+	BaseURL string
+	Verbose bool
+
+	// TimeoutSec caps every HTTP request made by the client. Zero leaves
+	// requests bounded only by the per-operation timeouts below.
 	TimeoutSec int
-	Verbose    bool
+
+	// GenerateTimeout, EditTimeout, DownloadTimeout, and OCRTimeout bound
+	// each call of that kind, retries included. Zero uses the matching
+	// Default timeout.
+	GenerateTimeout time.Duration
+	EditTimeout     time.Duration
+	DownloadTimeout time.Duration
+	OCRTimeout      time.Duration
+
+	// MaxRetries is how many times a request failing with 429 or 5xx is
+	// retried. Zero disables retries.
+	MaxRetries int
+	// RetryBaseDelay is the first backoff delay, doubled on each retry.
+	// Defaults to one second when retries are enabled.
+	RetryBaseDelay time.Duration
+
+	// HTTPClient, when set, sends every request in place of the client the
+	// provider would build, e.g. one whose Transport records or fakes
+	// responses. TimeoutSec, HTTPProxy, CACertFile, and MaxInflightPerHost
+	// then have no effect.
+	HTTPClient *http.Client
+
+	// HTTPProxy sends every request through this proxy instead of the
+	// ones named by HTTPS_PROXY and NO_PROXY. CACertFile is a PEM file of
+	// certificates to trust alongside the system roots.
+	HTTPProxy  string
+	CACertFile string
+
+	// MaxInflightPerHost caps concurrent requests to a single host across
+	// everything sharing the provider. Zero means unlimited.
+	MaxInflightPerHost int
+
+	// SaveRequestPath and SaveResponsePath, when set, receive the most
+	// recent API request and response as JSON with credentials redacted.
+	SaveRequestPath  string
+	SaveResponsePath string
+
+	// PriceOverrides replace the built-in prices when the provider works
+	// out what a response cost.
+	PriceOverrides cost.Overrides
 }
 
 type Factory struct {
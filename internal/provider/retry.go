@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultRetryBaseDelay is the first backoff delay when a Config
+	// leaves RetryBaseDelay zero.
+	DefaultRetryBaseDelay = time.Second
+	maxRetryDelay         = 60 * time.Second
+)
+
+// IsRetryableStatus reports whether a response with status is worth
+// retrying: a rate limit (429) or a server error (5xx).
+func IsRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// RetryDelay returns the wait before the given retry attempt (0-based). A
+// Retry-After value from the server wins; otherwise the delay grows
+// exponentially from base with jitter.
+func RetryDelay(attempt int, base time.Duration, retryAfter string) time.Duration {
+	if d, ok := parseRetryAfter(retryAfter); ok {
+		return min(d, maxRetryDelay)
+	}
+
+	if base <= 0 {
+		base = DefaultRetryBaseDelay
+	}
+
+	backoff := min(base<<attempt, maxRetryDelay)
+	// Jitter over the upper half of the window so concurrent clients spread out.
+	half := backoff / 2
+	return half + time.Duration(rand.Int64N(int64(half)+1))
+}
+
+// parseRetryAfter understands both forms of Retry-After: delay-seconds and an
+// HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// Sleep waits for d, returning early with ctx's error if ctx ends first.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,20 @@
+package provider
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	if d, ok := parseRetryAfter("3"); !ok || d != 3*time.Second {
+		t.Errorf("parseRetryAfter(\"3\") = %v, %v", d, ok)
+	}
+	future := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if d, ok := parseRetryAfter(future); !ok || d <= 0 || d > 10*time.Second {
+		t.Errorf("parseRetryAfter(date) = %v, %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Error("parseRetryAfter(\"soon\") ok = true, want false")
+	}
+}
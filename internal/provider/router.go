@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"sync"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+// Router is a Provider that sends each request to the provider serving its
+// model, so one batch can mix models from different backends. Providers are
+// created on first use and kept, one per provider name.
+type Router struct {
+	registry *models.ModelRegistry
+	fallback models.ProviderType
+	newFunc  func(models.ProviderType) (Provider, error)
+
+	mu        sync.Mutex
+	providers map[models.ProviderType]Provider
+}
+
+// NewRouter returns a Router that creates providers with newFunc. Models the
+// registry does not know are sent to fallback, which is also the Router's
+// Name.
+func NewRouter(registry *models.ModelRegistry, fallback models.ProviderType, newFunc func(models.ProviderType) (Provider, error)) *Router {
+	return &Router{
+		registry:  registry,
+		fallback:  fallback,
+		newFunc:   newFunc,
+		providers: make(map[models.ProviderType]Provider),
+	}
+}
+
+// For returns the provider serving model, creating it if this is the first
+// request for its provider. A failed creation is not cached, so a later
+// call tries again.
+func (r *Router) For(model string) (Provider, error) {
+	typ := r.providerType(model)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.providers[typ]; ok {
+		return p, nil
+	}
+	p, err := r.newFunc(typ)
+	if err != nil {
+		return nil, err
+	}
+	r.providers[typ] = p
+	return p, nil
+}
+
+func (r *Router) providerType(model string) models.ProviderType {
+	if caps, ok := r.registry.Get(model); ok {
+		return caps.Provider
+	}
+	return r.fallback
+}
+
+func (r *Router) Name() models.ProviderType {
+	return r.fallback
+}
+
+func (r *Router) Generate(ctx context.Context, req *models.Request) (*models.Response, error) {
+	p, err := r.For(req.Model)
+	if err != nil {
+		return nil, err
+	}
+	return p.Generate(ctx, req)
+}
+
+func (r *Router) Edit(ctx context.Context, req *models.EditRequest) (*models.Response, error) {
+	p, err := r.For(req.Model)
+	if err != nil {
+		return nil, err
+	}
+	return p.Edit(ctx, req)
+}
+
+func (r *Router) SupportsModel(model string) bool {
+	_, ok := r.registry.Get(model)
+	return ok
+}
+
+func (r *Router) SupportsEdit(model string) bool {
+	p, err := r.For(model)
+	if err != nil {
+		return false
+	}
+	return p.SupportsEdit(model)
+}
+
+func (r *Router) ListModels() []string {
+	return r.registry.List()
+}
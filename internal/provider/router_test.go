@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/manash/imggen/pkg/models"
+)
+
+func TestRouter_SendsEachModelToItsProvider(t *testing.T) {
+	created := map[models.ProviderType]int{}
+	var got []models.ProviderType
+	router := NewRouter(models.DefaultRegistry(), models.ProviderOpenAI, func(typ models.ProviderType) (Provider, error) {
+		created[typ]++
+		return &mockProvider{
+			name: typ,
+			generateFunc: func(_ context.Context, _ *models.Request) (*models.Response, error) {
+				got = append(got, typ)
+				return &models.Response{}, nil
+			},
+		}, nil
+	})
+
+	for _, model := range []string{"dall-e-3", "stable-diffusion-3", "gpt-image-1", "stable-diffusion-xl", "not-a-model"} {
+		if _, err := router.Generate(context.Background(), &models.Request{Model: model}); err != nil {
+			t.Fatalf("Generate(%s) error = %v", model, err)
+		}
+	}
+
+	want := []models.ProviderType{
+		models.ProviderOpenAI, models.ProviderStability, models.ProviderOpenAI,
+		models.ProviderStability, models.ProviderOpenAI,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("routed %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("request %d went to %s, want %s", i, got[i], want[i])
+		}
+	}
+	if created[models.ProviderOpenAI] != 1 || created[models.ProviderStability] != 1 {
+		t.Errorf("providers created %v, want one of each", created)
+	}
+}
+
+func TestRouter_RetriesFailedCreation(t *testing.T) {
+	errNoKey := errors.New("no key")
+	calls := 0
+	router := NewRouter(models.DefaultRegistry(), models.ProviderOpenAI, func(typ models.ProviderType) (Provider, error) {
+		calls++
+		if calls == 1 {
+			return nil, errNoKey
+		}
+		return &mockProvider{name: typ}, nil
+	})
+
+	if _, err := router.For("stable-diffusion-3"); !errors.Is(err, errNoKey) {
+		t.Fatalf("For() error = %v, want %v", err, errNoKey)
+	}
+	p, err := router.For("stable-diffusion-3")
+	if err != nil {
+		t.Fatalf("For() error = %v", err)
+	}
+	if p.Name() != models.ProviderStability {
+		t.Errorf("Name() = %s, want %s", p.Name(), models.ProviderStability)
+	}
+}
@@ -1,19 +1,80 @@
 package stability
 
 import (
+	"bytes"
 	"context"
-	"errors"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/manash/imggen/internal/cost"
 	"github.com/manash/imggen/internal/provider"
 	"github.com/manash/imggen/pkg/models"
 )
 
-var ErrNotImplemented = errors.New("stability AI provider not yet implemented")
+const (
+	defaultBaseURL = "https://api.stability.ai/v1"
+	defaultTimeout = 120 * time.Second
+
+	// sdxlEngine is the v1 engine behind the stable-diffusion-xl model.
+	sdxlEngine = "stable-diffusion-xl-1024-v1-0"
+	// sd3Model is the v2beta model behind the stable-diffusion-3 model.
+	sd3Model = "sd3-large"
+)
+
+// sd3AspectRatios maps registry sizes to the aspect ratios the v2beta
+// Stable Image API accepts in place of explicit dimensions.
+var sd3AspectRatios = map[string]string{
+	"1024x1024": "1:1",
+	"1536x1024": "3:2",
+	"1024x1536": "2:3",
+}
+
+type textPrompt struct {
+	Text   string  `json:"text"`
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// v1Request is the body of a v1 text-to-image call.
+type v1Request struct {
+	TextPrompts []textPrompt `json:"text_prompts"`
+	Width       int          `json:"width,omitempty"`
+	Height      int          `json:"height,omitempty"`
+	Samples     int          `json:"samples,omitempty"`
+	Seed        int64        `json:"seed,omitempty"`
+}
+
+type v1Response struct {
+	Artifacts []struct {
+		Base64       string `json:"base64"`
+		Seed         int64  `json:"seed"`
+		FinishReason string `json:"finishReason"`
+	} `json:"artifacts"`
+	Message string `json:"message,omitempty"`
+}
+
+// v2Response is the JSON form of a v2beta Stable Image response.
+type v2Response struct {
+	Image        string   `json:"image"`
+	Seed         int64    `json:"seed"`
+	FinishReason string   `json:"finish_reason"`
+	Errors       []string `json:"errors,omitempty"`
+	Name         string   `json:"name,omitempty"`
+}
 
 type Provider struct {
-	apiKey   string
-	baseURL  string
-	registry *models.ModelRegistry
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+	registry   *models.ModelRegistry
+	costCalc   *cost.Calculator
+	timeouts   provider.Timeouts
 }
 
 func New(cfg *provider.Config, registry *models.ModelRegistry) (*Provider, error) {
@@ -23,13 +84,21 @@ func New(cfg *provider.Config, registry *models.ModelRegistry) (*Provider, error
 
 	baseURL := cfg.BaseURL
 	if baseURL == "" {
-		baseURL = "https://api.stability.ai/v1"
+		baseURL = defaultBaseURL
+	}
+
+	httpClient, err := provider.HTTPClient(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Provider{
-		apiKey:   cfg.APIKey,
-		baseURL:  baseURL,
-		registry: registry,
+		apiKey:     cfg.APIKey,
+		baseURL:    baseURL,
+		httpClient: httpClient,
+		registry:   registry,
+		costCalc:   cost.NewCalculator(cost.WithOverrides(cfg.PriceOverrides)),
+		timeouts:   cfg.Timeouts(),
 	}, nil
 }
 
@@ -49,14 +118,208 @@ func (p *Provider) ListModels() []string {
 	return p.registry.ListByProvider(models.ProviderStability)
 }
 
-func (p *Provider) Generate(_ context.Context, _ *models.Request) (*models.Response, error) {
-	return nil, ErrNotImplemented
+func (p *Provider) Generate(ctx context.Context, req *models.Request) (_ *models.Response, err error) {
+	ctx, done := provider.WithTimeout(ctx, "generate", p.timeouts.Generate)
+	defer done(&err)
+
+	var response *models.Response
+	switch req.Model {
+	case "stable-diffusion-xl":
+		response, err = p.generateV1(ctx, req)
+	case "stable-diffusion-3":
+		response, err = p.generateSD3(ctx, req)
+	default:
+		return nil, fmt.Errorf("%w: %s", provider.ErrModelNotSupported, req.Model)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	response.Cost = p.costCalc.Calculate(models.ProviderStability, req.Model, req.Size, req.Quality, len(response.Images))
+	return response, nil
 }
 
-func (p *Provider) Edit(_ context.Context, _ *models.EditRequest) (*models.Response, error) {
-	return nil, ErrNotImplemented
+func (p *Provider) Edit(_ context.Context, req *models.EditRequest) (*models.Response, error) {
+	return nil, fmt.Errorf("%w: %s", provider.ErrEditNotSupported, req.Model)
 }
 
 func (p *Provider) SupportsEdit(_ string) bool {
 	return false
 }
+
+// generateV1 calls the v1 text-to-image endpoint, which returns all samples
+// in a single response.
+func (p *Provider) generateV1(ctx context.Context, req *models.Request) (*models.Response, error) {
+	width, height, err := parseSize(req.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	apiReq := &v1Request{
+		TextPrompts: []textPrompt{{Text: req.Prompt, Weight: 1}},
+		Width:       width,
+		Height:      height,
+		Samples:     req.Count,
+		Seed:        req.Seed,
+	}
+
+	jsonData, err := json.Marshal(apiReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := p.baseURL + "/generation/" + sdxlEngine + "/text-to-image"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	status, body, err := p.do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	var apiResp v1Response
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if status != http.StatusOK {
+		if apiResp.Message != "" {
+			return nil, fmt.Errorf("%w: %s", provider.ErrGenerationFailed, apiResp.Message)
+		}
+		return nil, fmt.Errorf("%w: status %d", provider.ErrGenerationFailed, status)
+	}
+
+	response := &models.Response{
+		Images: make([]models.GeneratedImage, 0, len(apiResp.Artifacts)),
+	}
+	for i, artifact := range apiResp.Artifacts {
+		if artifact.FinishReason == "CONTENT_FILTERED" {
+			return nil, fmt.Errorf("%w: image %d was filtered by content moderation", provider.ErrGenerationFailed, i+1)
+		}
+		data, err := base64.StdEncoding.DecodeString(artifact.Base64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image %d: %w", i, err)
+		}
+		response.Images = append(response.Images, models.GeneratedImage{
+			Data:  data,
+			Index: i,
+		})
+	}
+
+	return response, nil
+}
+
+// generateSD3 calls the v2beta Stable Image endpoint, which produces one
+// image per call.
+func (p *Provider) generateSD3(ctx context.Context, req *models.Request) (*models.Response, error) {
+	ratio, ok := sd3AspectRatios[req.Size]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", models.ErrInvalidSize, req.Size)
+	}
+
+	format := req.Format
+	if format != models.FormatJPEG {
+		format = models.FormatPNG
+	}
+
+	response := &models.Response{
+		Images: make([]models.GeneratedImage, 0, req.Count),
+	}
+
+	for i := 0; i < req.Count; i++ {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("prompt", req.Prompt)
+		writer.WriteField("model", sd3Model)
+		writer.WriteField("aspect_ratio", ratio)
+		writer.WriteField("output_format", string(format))
+		if req.Seed != 0 {
+			// Offset the seed so multiple images differ but stay reproducible.
+			writer.WriteField("seed", strconv.FormatInt(req.Seed+int64(i), 10))
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("failed to build request: %w", err)
+		}
+
+		url := p.apiRoot() + "/v2beta/stable-image/generate/sd3"
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		httpReq.Header.Set("Content-Type", writer.FormDataContentType())
+
+		status, respBody, err := p.do(httpReq)
+		if err != nil {
+			return nil, err
+		}
+
+		var apiResp v2Response
+		if err := json.Unmarshal(respBody, &apiResp); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		if status != http.StatusOK {
+			if len(apiResp.Errors) > 0 {
+				return nil, fmt.Errorf("%w: %s", provider.ErrGenerationFailed, strings.Join(apiResp.Errors, "; "))
+			}
+			return nil, fmt.Errorf("%w: status %d", provider.ErrGenerationFailed, status)
+		}
+		if apiResp.FinishReason == "CONTENT_FILTERED" {
+			return nil, fmt.Errorf("%w: image %d was filtered by content moderation", provider.ErrGenerationFailed, i+1)
+		}
+
+		data, err := base64.StdEncoding.DecodeString(apiResp.Image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image %d: %w", i, err)
+		}
+		response.Images = append(response.Images, models.GeneratedImage{
+			Data:  data,
+			Index: i,
+		})
+	}
+
+	return response, nil
+}
+
+// apiRoot returns the host portion of the base URL. The v1 and v2beta APIs
+// share a host but not a version prefix.
+func (p *Provider) apiRoot() string {
+	return strings.TrimSuffix(strings.TrimSuffix(p.baseURL, "/"), "/v1")
+}
+
+// do sends an authenticated request and returns the status and body.
+func (p *Provider) do(httpReq *http.Request) (int, []byte, error) {
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	httpReq.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp.StatusCode, body, nil
+}
+
+func parseSize(size string) (int, int, error) {
+	w, h, ok := strings.Cut(size, "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %q", models.ErrInvalidSize, size)
+	}
+	width, err := strconv.Atoi(w)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %q", models.ErrInvalidSize, size)
+	}
+	height, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %q", models.ErrInvalidSize, size)
+	}
+	return width, height, nil
+}
@@ -2,7 +2,12 @@ package stability
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/manash/imggen/internal/provider"
@@ -106,24 +111,6 @@ func TestProvider_ListModels(t *testing.T) {
 	}
 }
 
-func TestProvider_Generate_NotImplemented(t *testing.T) {
-	p, _ := New(&provider.Config{APIKey: "test"}, models.DefaultRegistry())
-
-	req := &models.Request{
-		Model:  "stable-diffusion-xl",
-		Prompt: "test prompt",
-		Count:  1,
-	}
-
-	_, err := p.Generate(context.Background(), req)
-	if err == nil {
-		t.Fatal("Generate() error = nil, want ErrNotImplemented")
-	}
-	if !errors.Is(err, ErrNotImplemented) {
-		t.Errorf("Generate() error = %v, want %v", err, ErrNotImplemented)
-	}
-}
-
 func TestNew_DefaultBaseURL(t *testing.T) {
 	cfg := &provider.Config{APIKey: "test-key"}
 	p, err := New(cfg, models.DefaultRegistry())
@@ -151,11 +138,120 @@ func TestNew_CustomBaseURL(t *testing.T) {
 	}
 }
 
-func TestErrNotImplemented(t *testing.T) {
-	if ErrNotImplemented == nil {
-		t.Error("ErrNotImplemented is nil")
+func TestProvider_Generate_SDXL(t *testing.T) {
+	var got v1Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/generation/stable-diffusion-xl-1024-v1-0/text-to-image" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+
+		img := base64.StdEncoding.EncodeToString([]byte("png-bytes"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"artifacts":[{"base64":"` + img + `","seed":7,"finishReason":"SUCCESS"},{"base64":"` + img + `","seed":8,"finishReason":"SUCCESS"}]}`))
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL + "/v1"}, models.DefaultRegistry())
+
+	resp, err := p.Generate(context.Background(), &models.Request{
+		Model:  "stable-diffusion-xl",
+		Prompt: "a lighthouse",
+		Size:   "1152x896",
+		Count:  2,
+		Seed:   7,
+	})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if got.Width != 1152 || got.Height != 896 || got.Samples != 2 || got.Seed != 7 {
+		t.Errorf("request = %+v, want 1152x896, 2 samples, seed 7", got)
+	}
+	if len(got.TextPrompts) != 1 || got.TextPrompts[0].Text != "a lighthouse" {
+		t.Errorf("text_prompts = %+v", got.TextPrompts)
+	}
+	if len(resp.Images) != 2 || string(resp.Images[1].Data) != "png-bytes" {
+		t.Errorf("images = %+v, want 2 decoded images", resp.Images)
 	}
-	if ErrNotImplemented.Error() != "stability AI provider not yet implemented" {
-		t.Errorf("ErrNotImplemented message = %v", ErrNotImplemented.Error())
+	if resp.Cost == nil || resp.Cost.Total <= 0 {
+		t.Errorf("Cost = %+v, want positive stability cost", resp.Cost)
+	}
+}
+
+func TestProvider_Generate_SD3(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/v2beta/stable-image/generate/sd3" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm() error = %v", err)
+		}
+		if r.FormValue("aspect_ratio") != "3:2" {
+			t.Errorf("aspect_ratio = %q, want 3:2", r.FormValue("aspect_ratio"))
+		}
+		if r.FormValue("output_format") != "jpeg" {
+			t.Errorf("output_format = %q, want jpeg", r.FormValue("output_format"))
+		}
+
+		img := base64.StdEncoding.EncodeToString([]byte("jpeg-bytes"))
+		w.Write([]byte(`{"image":"` + img + `","seed":1,"finish_reason":"SUCCESS"}`))
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "test-key", BaseURL: server.URL + "/v1"}, models.DefaultRegistry())
+
+	resp, err := p.Generate(context.Background(), &models.Request{
+		Model:  "stable-diffusion-3",
+		Prompt: "a lighthouse",
+		Size:   "1536x1024",
+		Count:  2,
+		Format: models.FormatJPEG,
+	})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("API calls = %d, want one per image", calls)
+	}
+	if len(resp.Images) != 2 || resp.Images[1].Index != 1 {
+		t.Errorf("images = %+v, want 2 indexed images", resp.Images)
+	}
+}
+
+func TestProvider_Generate_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"id":"abc","name":"unauthorized","message":"Incorrect API key"}`))
+	}))
+	defer server.Close()
+
+	p, _ := New(&provider.Config{APIKey: "bad-key", BaseURL: server.URL + "/v1"}, models.DefaultRegistry())
+
+	_, err := p.Generate(context.Background(), &models.Request{
+		Model:  "stable-diffusion-xl",
+		Prompt: "test",
+		Size:   "1024x1024",
+		Count:  1,
+	})
+	if !errors.Is(err, provider.ErrGenerationFailed) {
+		t.Fatalf("Generate() error = %v, want ErrGenerationFailed", err)
+	}
+	if !strings.Contains(err.Error(), "Incorrect API key") {
+		t.Errorf("error = %v, want API message", err)
+	}
+}
+
+func TestProvider_Generate_UnsupportedModel(t *testing.T) {
+	p, _ := New(&provider.Config{APIKey: "test"}, models.DefaultRegistry())
+
+	_, err := p.Generate(context.Background(), &models.Request{Model: "dall-e-3", Prompt: "test", Count: 1})
+	if !errors.Is(err, provider.ErrModelNotSupported) {
+		t.Errorf("Generate() error = %v, want ErrModelNotSupported", err)
 	}
 }
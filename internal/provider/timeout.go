@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Default timeouts for each kind of call, used when a Config leaves the
+// corresponding field zero. They cover retries as well as the request.
+const (
+	DefaultGenerateTimeout = 3 * time.Minute
+	DefaultEditTimeout     = 3 * time.Minute
+	DefaultDownloadTimeout = 2 * time.Minute
+	DefaultOCRTimeout      = 90 * time.Second
+)
+
+// Timeouts are the per-operation limits a provider applies.
+type Timeouts struct {
+	Generate time.Duration
+	Edit     time.Duration
+	Download time.Duration
+	OCR      time.Duration
+}
+
+// Timeouts returns the limits set in c, with the defaults for those left
+// zero.
+func (c *Config) Timeouts() Timeouts {
+	orDefault := func(d, def time.Duration) time.Duration {
+		if d > 0 {
+			return d
+		}
+		return def
+	}
+	return Timeouts{
+		Generate: orDefault(c.GenerateTimeout, DefaultGenerateTimeout),
+		Edit:     orDefault(c.EditTimeout, DefaultEditTimeout),
+		Download: orDefault(c.DownloadTimeout, DefaultDownloadTimeout),
+		OCR:      orDefault(c.OCRTimeout, DefaultOCRTimeout),
+	}
+}
+
+// TimeoutError reports that an operation ran past its timeout, as opposed
+// to failing or being canceled. It matches context.DeadlineExceeded.
+type TimeoutError struct {
+	Op      string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Op, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// WithTimeout bounds ctx by timeout for the operation op. Defer the returned
+// func with the operation's error result: it releases the context and, if
+// the timeout is what ended it, replaces the error with a *TimeoutError.
+func WithTimeout(ctx context.Context, op string, timeout time.Duration) (context.Context, func(err *error)) {
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, &TimeoutError{Op: op, Timeout: timeout})
+	return ctx, func(err *error) {
+		var timeoutErr *TimeoutError
+		if *err != nil && errors.As(context.Cause(ctx), &timeoutErr) {
+			*err = timeoutErr
+		}
+		cancel()
+	}
+}
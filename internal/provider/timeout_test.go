@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConfig_Timeouts(t *testing.T) {
+	got := (&Config{}).Timeouts()
+	want := Timeouts{DefaultGenerateTimeout, DefaultEditTimeout, DefaultDownloadTimeout, DefaultOCRTimeout}
+	if got != want {
+		t.Errorf("Timeouts() = %+v, want the defaults %+v", got, want)
+	}
+
+	got = (&Config{GenerateTimeout: 10 * time.Minute, OCRTimeout: 5 * time.Second}).Timeouts()
+	if got.Generate != 10*time.Minute || got.OCR != 5*time.Second || got.Edit != DefaultEditTimeout {
+		t.Errorf("Timeouts() = %+v, want generate and OCR overridden", got)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	t.Run("deadline", func(t *testing.T) {
+		ctx, done := WithTimeout(context.Background(), "generate", 10*time.Millisecond)
+		<-ctx.Done()
+		err := ctx.Err()
+		done(&err)
+
+		var timeoutErr *TimeoutError
+		if !errors.As(err, &timeoutErr) || timeoutErr.Op != "generate" {
+			t.Fatalf("error = %v, want a generate *TimeoutError", err)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("error = %v, want it to match context.DeadlineExceeded", err)
+		}
+		if err.Error() != "generate timed out after 10ms" {
+			t.Errorf("Error() = %q", err.Error())
+		}
+	})
+
+	t.Run("canceled by caller", func(t *testing.T) {
+		parent, cancel := context.WithCancel(context.Background())
+		ctx, done := WithTimeout(parent, "generate", time.Minute)
+		cancel()
+		err := ctx.Err()
+		done(&err)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("other failure", func(t *testing.T) {
+		_, done := WithTimeout(context.Background(), "generate", time.Minute)
+		err := ErrGenerationFailed
+		done(&err)
+		if err != ErrGenerationFailed {
+			t.Errorf("error = %v, want ErrGenerationFailed unchanged", err)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTPClient returns cfg.HTTPClient, or when it is nil a client built from
+// cfg's request timeout, proxy, CA, and per-host limit settings.
+func HTTPClient(cfg *Config) (*http.Client, error) {
+	if cfg.HTTPClient != nil {
+		return cfg.HTTPClient, nil
+	}
+	transport, err := HTTPTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Timeout:   time.Duration(cfg.TimeoutSec) * time.Second,
+		Transport: Transport(transport, cfg.MaxInflightPerHost),
+	}, nil
+}
+
+// HTTPTransport returns the transport for providers to build on. Requests go
+// through the proxies named by HTTPS_PROXY, HTTP_PROXY, and NO_PROXY unless
+// cfg.HTTPProxy names one for every request, and servers are trusted if
+// their certificate chains to the system roots or to cfg.CACertFile, such as
+// a corporate proxy that intercepts TLS.
+func HTTPTransport(cfg *Config) (http.RoundTripper, error) {
+	if cfg.HTTPProxy == "" && cfg.CACertFile == "" {
+		return http.DefaultTransport, nil
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.HTTPProxy != "" {
+		proxyURL, err := parseProxyURL(cfg.HTTPProxy)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+	if cfg.CACertFile != "" {
+		pool, err := certPool(cfg.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return t, nil
+}
+
+// parseProxyURL parses a proxy address, taking one without a scheme, such
+// as proxy.corp:8080, to be an HTTP proxy.
+func parseProxyURL(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", proxy)
+	}
+	return u, nil
+}
+
+// certPool returns the system roots plus the PEM certificates in path.
+func certPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
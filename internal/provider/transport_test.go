@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeServerCA writes the certificate of a TLS test server to a PEM file.
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHTTPTransport_Default(t *testing.T) {
+	rt, err := HTTPTransport(&Config{})
+	if err != nil || rt != http.DefaultTransport {
+		t.Errorf("HTTPTransport() = %v, %v; want http.DefaultTransport", rt, err)
+	}
+}
+
+func TestHTTPTransport_CACertFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	if _, err := (&http.Client{}).Get(server.URL); err == nil {
+		t.Fatal("GET with the system roots succeeded, want an unknown authority error")
+	}
+
+	rt, err := HTTPTransport(&Config{CACertFile: writeServerCA(t, server)})
+	if err != nil {
+		t.Fatalf("HTTPTransport() error = %v", err)
+	}
+	resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET trusting the CA file error = %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "ok" {
+		t.Errorf("body = %q, want ok", body)
+	}
+}
+
+func TestHTTPTransport_Proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxy.Close()
+
+	rt, err := HTTPTransport(&Config{HTTPProxy: proxy.Listener.Addr().String()})
+	if err != nil {
+		t.Fatalf("HTTPTransport() error = %v", err)
+	}
+	resp, err := (&http.Client{Transport: rt}).Get("http://api.example.invalid/v1/models")
+	if err != nil {
+		t.Fatalf("GET through the proxy error = %v", err)
+	}
+	resp.Body.Close()
+	if proxied != "http://api.example.invalid/v1/models" {
+		t.Errorf("proxy saw %q, want the absolute API URL", proxied)
+	}
+}
+
+func TestHTTPTransport_Invalid(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0600)
+
+	for name, cfg := range map[string]*Config{
+		"missing CA file": {CACertFile: filepath.Join(t.TempDir(), "missing.pem")},
+		"CA file not PEM": {CACertFile: notPEM},
+		"bad proxy":       {HTTPProxy: "http://"},
+	} {
+		if _, err := HTTPTransport(cfg); err == nil {
+			t.Errorf("%s: HTTPTransport() error = nil", name)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+// Package query parses and evaluates small filter expressions such as
+// `model=dall-e-3 and cost>0.1`. Expressions can only compare named fields
+// with literals; there is no way to call functions or run code.
+//
+// Grammar:
+//
+//	expr       = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | "(" expr ")" | comparison
+//	comparison = field op value
+//	op         = "=" | "==" | "!=" | "<" | "<=" | ">" | ">=" | "~"
+//
+// Values are bare words or single- or double-quoted strings. "~" matches a
+// substring and only applies to text fields.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/manash/imggen/internal/suggest"
+)
+
+// ErrSyntax is wrapped by every error Parse returns.
+var ErrSyntax = errors.New("invalid query")
+
+// Kind is the type of a field, which decides how literals are parsed and
+// compared.
+type Kind int
+
+const (
+	// Text fields compare case-insensitively.
+	Text Kind = iota
+	// Number fields compare numerically.
+	Number
+	// Date fields compare by calendar day in the record's time zone, so
+	// date=2025-01-02 matches any time that day.
+	Date
+)
+
+// DateLayout is the format of date literals.
+const DateLayout = "2006-01-02"
+
+// Schema names the fields an expression may use.
+type Schema map[string]Kind
+
+// Record holds the field values to test. Values must be string for Text,
+// float64 for Number, and time.Time for Date fields; missing fields never
+// match.
+type Record map[string]any
+
+// Query is a parsed expression.
+type Query struct {
+	root node
+}
+
+// Parse compiles input against schema. Unknown fields, literals of the
+// wrong type, and operators a field does not support are reported here so
+// that Match cannot fail.
+func Parse(input string, schema Schema) (*Query, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty expression", ErrSyntax)
+	}
+
+	p := &parser{tokens: tokens, schema: schema}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, p.peek().text)
+	}
+	return &Query{root: root}, nil
+}
+
+// Match reports whether r satisfies the query.
+func (q *Query) Match(r Record) bool {
+	return q.root.match(r)
+}
+
+type node interface {
+	match(r Record) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) match(r Record) bool { return n.left.match(r) && n.right.match(r) }
+
+type orNode struct{ left, right node }
+
+func (n orNode) match(r Record) bool { return n.left.match(r) || n.right.match(r) }
+
+type notNode struct{ inner node }
+
+func (n notNode) match(r Record) bool { return !n.inner.match(r) }
+
+type comparison struct {
+	field string
+	kind  Kind
+	op    string
+	text  string
+	num   float64
+	date  time.Time
+}
+
+func (c comparison) match(r Record) bool {
+	v, ok := r[c.field]
+	if !ok {
+		return false
+	}
+
+	var cmp int
+	switch c.kind {
+	case Number:
+		n, ok := v.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case n < c.num:
+			cmp = -1
+		case n > c.num:
+			cmp = 1
+		}
+	case Date:
+		t, ok := v.(time.Time)
+		if !ok {
+			return false
+		}
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		cmp = day.Compare(c.date)
+	default:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		s = strings.ToLower(s)
+		if c.op == "~" {
+			return strings.Contains(s, c.text)
+		}
+		cmp = strings.Compare(s, c.text)
+	}
+
+	switch c.op {
+	case "=", "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default: // ">="
+		return cmp >= 0
+	}
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// operators is ordered so two-character operators are tried first.
+var operators = []string{"==", "!=", "<=", ">=", "=", "<", ">", "~"}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")"})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(input[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated string starting at %q", ErrSyntax, input[i:])
+			}
+			tokens = append(tokens, token{tokString, input[i+1 : i+1+end]})
+			i += end + 2
+		default:
+			if op := operatorAt(input[i:]); op != "" {
+				tokens = append(tokens, token{tokOp, op})
+				i += len(op)
+				continue
+			}
+			start := i
+			for i < len(input) && !strings.ContainsRune(" \t\n()\"'", rune(input[i])) && operatorAt(input[i:]) == "" {
+				i++
+			}
+			tokens = append(tokens, token{tokWord, input[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+func operatorAt(s string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	schema Schema
+}
+
+func (p *parser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+// keyword reports whether the next token is the bare word kw, consuming it
+// if so.
+func (p *parser) keyword(kw string) bool {
+	if p.done() {
+		return false
+	}
+	t := p.peek()
+	if t.kind == tokWord && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.done() {
+		return nil, fmt.Errorf("%w: expression ends too early", ErrSyntax)
+	}
+	if p.keyword("not") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.done() || p.peek().kind != tokRParen {
+			return nil, fmt.Errorf("%w: missing )", ErrSyntax)
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	field := p.peek()
+	if field.kind != tokWord {
+		return nil, fmt.Errorf("%w: expected a field name, got %q", ErrSyntax, field.text)
+	}
+	p.pos++
+
+	name := strings.ToLower(field.text)
+	kind, ok := p.schema[name]
+	if !ok {
+		fields := slices.Sorted(maps.Keys(p.schema))
+		return nil, fmt.Errorf("%w: unknown field %q%s (fields: %s)", ErrSyntax, field.text, suggest.DidYouMean(field.text, fields), strings.Join(fields, ", "))
+	}
+
+	if p.done() || p.peek().kind != tokOp {
+		return nil, fmt.Errorf("%w: expected an operator after %q", ErrSyntax, field.text)
+	}
+	op := p.peek().text
+	p.pos++
+
+	if p.done() || (p.peek().kind != tokWord && p.peek().kind != tokString) {
+		return nil, fmt.Errorf("%w: expected a value after %s%s", ErrSyntax, field.text, op)
+	}
+	value := p.peek().text
+	p.pos++
+
+	c := comparison{field: name, kind: kind, op: op}
+	switch kind {
+	case Number:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s needs a number, got %q", ErrSyntax, name, value)
+		}
+		c.num = n
+	case Date:
+		d, err := time.Parse(DateLayout, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s needs a date like 2025-01-31, got %q", ErrSyntax, name, value)
+		}
+		c.date = d
+	default:
+		c.text = strings.ToLower(value)
+	}
+	if op == "~" && kind != Text {
+		return nil, fmt.Errorf("%w: ~ only applies to text fields, not %s", ErrSyntax, name)
+	}
+	return c, nil
+}
@@ -0,0 +1,110 @@
+package query
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSchema = Schema{
+	"model":     Text,
+	"operation": Text,
+	"prompt":    Text,
+	"cost":      Number,
+	"date":      Date,
+}
+
+func TestQuery_Match(t *testing.T) {
+	record := Record{
+		"model":     "dall-e-3",
+		"operation": "generate",
+		"prompt":    "A red fox in the snow",
+		"cost":      0.12,
+		"date":      time.Date(2025, 3, 14, 18, 30, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"model=dall-e-3", true},
+		{"model == DALL-E-3", true},
+		{"model!=dall-e-3", false},
+		{"cost>0.1", true},
+		{"cost >= 0.12", true},
+		{"cost<0.12", false},
+		{"cost<=0.12", true},
+		{"model=dall-e-3 and cost>0.1", true},
+		{"model=dall-e-3 and cost>0.5", false},
+		{"model=gpt-image-1 or cost>0.1", true},
+		{"model=gpt-image-1 or cost>0.5", false},
+		{"not model=gpt-image-1", true},
+		{"operation=edit or operation=generate and cost>1", false},
+		{"(operation=edit or operation=generate) and cost>0.1", true},
+		{"prompt~fox", true},
+		{`prompt~"red fox"`, true},
+		{"prompt~'blue fox'", false},
+		{"date=2025-03-14", true},
+		{"date>2025-03-13 AND date<2025-03-15", true},
+		{"date>=2025-03-15", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			q, err := Parse(tt.expr, testSchema)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := q.Match(record); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuery_MatchMissingField(t *testing.T) {
+	q, err := Parse("cost>0 or model=dall-e-3", testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Match(Record{"model": "dall-e-2"}) {
+		t.Error("missing fields should not match")
+	}
+	if !q.Match(Record{"model": "dall-e-3"}) {
+		t.Error("other branch should still match")
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "empty expression"},
+		{"modle=dall-e-3", `did you mean "model"?`},
+		{"colour=red", "unknown field"},
+		{"cost>cheap", "needs a number"},
+		{"date>yesterday", "needs a date"},
+		{"cost~0.1", "only applies to text"},
+		{"model", "expected an operator"},
+		{"model=", "expected a value"},
+		{"model=dall-e-3 and", "ends too early"},
+		{"(model=dall-e-3", "missing )"},
+		{"model=dall-e-3 cost>1", "unexpected"},
+		{`prompt~"fox`, "unterminated string"},
+		{"=dall-e-3", "expected a field name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr, testSchema)
+			if !errors.Is(err, ErrSyntax) {
+				t.Fatalf("Parse() error = %v, want ErrSyntax", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
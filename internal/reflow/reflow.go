@@ -0,0 +1,85 @@
+// Package reflow undoes the hard line wrapping OCR leaves in extracted text.
+package reflow
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// listItem matches lines that start a list entry, such as "- milk",
+// "• eggs", "3. flour", or "b) sugar", which always begin a new line.
+var listItem = regexp.MustCompile(`^([-*•·–]|\d{1,3}[.)]|[a-zA-Z][.)])\s`)
+
+// Reflow joins hard-wrapped lines into paragraphs. A line is joined to the
+// next unless it ends in sentence punctuation (. ! ? : ;, optionally
+// followed by closing quotes or brackets) or the next line starts a list
+// item; a word hyphenated across the break is rejoined without the hyphen.
+// Blank lines separate paragraphs and are kept, collapsed to one. Runs of
+// spaces and tabs become a single space and line endings become "\n".
+func Reflow(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var paragraphs []string
+	var lines []string
+	flush := func() {
+		if len(lines) > 0 {
+			paragraphs = append(paragraphs, joinLines(lines))
+			lines = nil
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' }), " ")
+		if line == "" {
+			flush()
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// joinLines joins the lines of one paragraph.
+func joinLines(lines []string) string {
+	var b strings.Builder
+	b.WriteString(lines[0])
+	for i := 1; i < len(lines); i++ {
+		prev, next := lines[i-1], lines[i]
+		switch {
+		case endsSentence(prev) || listItem.MatchString(next):
+			b.WriteByte('\n')
+		case hyphenated(prev, next):
+			// Drop the hyphen already written.
+			s := b.String()
+			b.Reset()
+			b.WriteString(s[:len(s)-1])
+		default:
+			b.WriteByte(' ')
+		}
+		b.WriteString(next)
+	}
+	return b.String()
+}
+
+// endsSentence reports whether line ends in sentence punctuation, looking
+// past closing quotes and brackets.
+func endsSentence(line string) bool {
+	line = strings.TrimRight(line, `"')]}’”»`)
+	r, _ := utf8.DecodeLastRuneInString(line)
+	return strings.ContainsRune(".!?:;…", r)
+}
+
+// hyphenated reports whether prev ends with a word broken by a hyphen that
+// next continues, as in "inter-" followed by "national".
+func hyphenated(prev, next string) bool {
+	if !strings.HasSuffix(prev, "-") || len(prev) < 2 {
+		return false
+	}
+	before, _ := utf8.DecodeLastRuneInString(prev[:len(prev)-1])
+	first, _ := utf8.DecodeRuneInString(next)
+	return unicode.IsLetter(before) && unicode.IsLower(first)
+}
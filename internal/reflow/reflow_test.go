@@ -0,0 +1,59 @@
+package reflow
+
+import "testing"
+
+func TestReflow(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "wrapped paragraph",
+			in:   "The quick brown fox\njumps over the lazy\ndog.",
+			want: "The quick brown fox jumps over the lazy dog.",
+		},
+		{
+			name: "paragraph breaks kept",
+			in:   "First paragraph that\nwraps here.\n\n\n\nSecond one\nalso wraps.",
+			want: "First paragraph that wraps here.\n\nSecond one also wraps.",
+		},
+		{
+			name: "sentence ends keep breaks",
+			in:   "Thank you for shopping!\nTotal due:\n$12.50\nPaid by card.\nSee you soon?",
+			want: "Thank you for shopping!\nTotal due:\n$12.50 Paid by card.\nSee you soon?",
+		},
+		{
+			name: "closing quotes and brackets",
+			in:   "He said \"stop.\"\nThen left (quietly.)\nThe end",
+			want: "He said \"stop.\"\nThen left (quietly.)\nThe end",
+		},
+		{
+			name: "list items start lines",
+			in:   "Ingredients for the\ncake\n- two eggs\n- flour\n1. mix\n2) bake",
+			want: "Ingredients for the cake\n- two eggs\n- flour\n1. mix\n2) bake",
+		},
+		{
+			name: "hyphenated words rejoined",
+			in:   "an inter-\nnational deal with a well-\nKnown firm",
+			want: "an international deal with a well- Known firm",
+		},
+		{
+			name: "whitespace normalized",
+			in:   "  lots   of\t\tspace  \r\nand CRLF  \r\n   \r\nnext",
+			want: "lots of space and CRLF\n\nnext",
+		},
+		{
+			name: "empty",
+			in:   " \n\n\t\n",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Reflow(tt.in); got != tt.want {
+				t.Errorf("Reflow(%q) =\n%q\nwant\n%q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/manash/imggen/internal/events"
+	"github.com/manash/imggen/internal/image"
+	"github.com/manash/imggen/internal/progress"
 	"github.com/manash/imggen/internal/security"
 	"github.com/manash/imggen/internal/session"
+	"github.com/manash/imggen/internal/suggest"
 	"github.com/manash/imggen/pkg/models"
 )
 
@@ -24,14 +29,19 @@ type Command interface {
 func (r *REPL) registerCommands() {
 	commands := []Command{
 		&GenerateCommand{},
+		&RegenerateCommand{},
 		&EditCommand{},
 		&UndoCommand{},
+		&BranchCommand{},
 		&SaveCommand{},
 		&ShowCommand{},
+		&CompareCommand{},
 		&HistoryCommand{},
+		&SearchCommand{},
 		&SessionCommand{},
 		&ModelCommand{},
 		&CostCommand{},
+		&BudgetCommand{},
 		&HelpCommand{},
 		&QuitCommand{},
 	}
@@ -57,21 +67,32 @@ func (c *GenerateCommand) Execute(ctx context.Context, r *REPL, args []string) e
 		return fmt.Errorf("usage: %s", c.Usage())
 	}
 
-	prompt := strings.Join(args, " ")
-	model := r.sessionMgr.GetModel()
-
-	req := models.NewRequest(prompt)
-	req.Model = model
+	req := models.NewRequest(strings.Join(args, " "))
+	req.Model = r.sessionMgr.GetModel()
+	return r.generate(ctx, req)
+}
 
+// generate runs req and saves the result as a new iteration of the current
+// session.
+func (r *REPL) generate(ctx context.Context, req *models.Request) error {
+	prompt := req.Prompt
 	caps, ok := r.registry.Get(req.Model)
 	if !ok {
 		return fmt.Errorf("unknown model: %s", req.Model)
 	}
 	caps.ApplyDefaults(req)
 
-	fmt.Fprintf(r.out, "Generating with %s...\n", req.Model)
+	if err := r.checkBudget(ctx, req.Model, req.Size, req.Quality); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(r.info(), "Generating with %s...\n", req.Model)
 
+	start := time.Now()
+	spinner := progress.Start(r.out, r.spinner)
 	resp, err := r.provider.Generate(ctx, req)
+	spinner.Stop()
+	r.logEvent(events.Event{Op: events.OpGenerate, Model: req.Model, Size: req.Size, Quality: req.Quality}, prompt, resp, start, err)
 	if err != nil {
 		return fmt.Errorf("generation failed: %w", err)
 	}
@@ -94,11 +115,12 @@ func (c *GenerateCommand) Execute(ctx context.Context, r *REPL, args []string) e
 		Model:         req.Model,
 		ImagePath:     paths[0],
 		Metadata: session.IterationMetadata{
-			Size:     req.Size,
-			Quality:  req.Quality,
-			Format:   req.Format.String(),
-			Cost:     costValue,
-			Provider: string(r.provider.Name()),
+			Size:      req.Size,
+			Quality:   req.Quality,
+			Format:    req.Format.String(),
+			Cost:      costValue,
+			Provider:  string(r.provider.Name()),
+			ModelUsed: modelUsed(req.Model, resp),
 		},
 	}
 	if err := r.sessionMgr.AddIteration(ctx, iter); err != nil {
@@ -117,27 +139,80 @@ func (c *GenerateCommand) Execute(ctx context.Context, r *REPL, args []string) e
 			Timestamp:   iter.Timestamp,
 		}
 		if err := r.sessionMgr.LogCost(ctx, costEntry); err != nil {
-			fmt.Fprintf(r.err, "Warning: failed to log cost: %v\n", err)
+			fmt.Fprintf(r.warn(), "Warning: failed to log cost: %v\n", err)
 		}
 	}
 
 	if err := r.displayer.Display(ctx, &resp.Images[0]); err != nil {
-		fmt.Fprintf(r.err, "Warning: failed to display: %v\n", err)
+		fmt.Fprintf(r.warn(), "Warning: failed to display: %v\n", err)
 	}
 
 	fmt.Fprintf(r.out, "Saved: %s\n", paths[0])
 	if resp.Cost != nil {
-		fmt.Fprintf(r.out, "Cost: $%.4f (%d image(s) @ $%.4f/image, %s %s %s)\n",
+		fmt.Fprintf(r.info(), "Cost: $%.4f (%d image(s) @ $%.4f/image, %s %s %s)\n",
 			resp.Cost.Total, len(resp.Images), resp.Cost.PerImage,
 			req.Model, req.Size, req.Quality)
 	}
+	if resp.Timing.TotalDuration > 0 {
+		fmt.Fprintf(r.info(), "Time: %s\n", resp.Timing)
+	}
 	if resp.RevisedPrompt != "" {
-		fmt.Fprintf(r.out, "Revised prompt: %s\n", resp.RevisedPrompt)
+		fmt.Fprintf(r.info(), "Revised prompt: %s\n", resp.RevisedPrompt)
 	}
 
 	return nil
 }
 
+// RegenerateCommand generates the current iteration's prompt again
+type RegenerateCommand struct{}
+
+func (c *RegenerateCommand) Name() string        { return "regenerate" }
+func (c *RegenerateCommand) Aliases() []string   { return []string{"r"} }
+func (c *RegenerateCommand) Description() string { return "Generate the current prompt again" }
+func (c *RegenerateCommand) Usage() string       { return "regenerate [--size S] [--quality Q]" }
+
+func (c *RegenerateCommand) Execute(ctx context.Context, r *REPL, args []string) error {
+	iter := r.sessionMgr.CurrentIteration()
+	if iter == nil {
+		return fmt.Errorf("no current image - use 'generate' first")
+	}
+	if iter.Operation != "generate" {
+		return fmt.Errorf("the current image is an %s; regenerate only repeats generations", iter.Operation)
+	}
+
+	req := models.NewRequest(iter.Prompt)
+	req.Model = iter.Model
+	req.Size = iter.Metadata.Size
+	req.Quality = iter.Metadata.Quality
+	req.Transparent = iter.Metadata.Transparent
+	if iter.Metadata.Format != "" {
+		req.Format = models.OutputFormat(iter.Metadata.Format)
+	}
+
+	// Options are given as "--size 512x512" or "--size=512x512".
+	for len(args) > 0 {
+		name, value, hasValue := strings.Cut(args[0], "=")
+		args = args[1:]
+		if !hasValue {
+			if len(args) == 0 {
+				return fmt.Errorf("usage: %s", c.Usage())
+			}
+			value, args = args[0], args[1:]
+		}
+		switch name {
+		case "--size":
+			req.Size = value
+		case "--quality":
+			req.Quality = value
+		default:
+			return fmt.Errorf("unknown option %q; usage: %s", name, c.Usage())
+		}
+	}
+
+	fmt.Fprintf(r.out, "Regenerating: %s\n", req.Prompt)
+	return r.generate(ctx, req)
+}
+
 // EditCommand edits the current image
 type EditCommand struct{}
 
@@ -178,9 +253,15 @@ func (c *EditCommand) Execute(ctx context.Context, r *REPL, args []string) error
 		}
 	}
 
-	fmt.Fprintf(r.out, "Editing with %s...\n", req.Model)
+	if err := r.checkBudget(ctx, req.Model, req.Size, ""); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(r.info(), "Editing with %s...\n", req.Model)
 
+	start := time.Now()
 	resp, err := r.provider.Edit(ctx, req)
+	r.logEvent(events.Event{Op: events.OpEdit, Model: req.Model, Size: req.Size}, prompt, resp, start, err)
 	if err != nil {
 		return fmt.Errorf("edit failed: %w", err)
 	}
@@ -203,10 +284,11 @@ func (c *EditCommand) Execute(ctx context.Context, r *REPL, args []string) error
 		Model:         req.Model,
 		ImagePath:     paths[0],
 		Metadata: session.IterationMetadata{
-			Size:     req.Size,
-			Format:   req.Format.String(),
-			Cost:     costValue,
-			Provider: string(r.provider.Name()),
+			Size:      req.Size,
+			Format:    req.Format.String(),
+			Cost:      costValue,
+			Provider:  string(r.provider.Name()),
+			ModelUsed: modelUsed(req.Model, resp),
 		},
 	}
 	if err := r.sessionMgr.AddIteration(ctx, iter); err != nil {
@@ -225,12 +307,12 @@ func (c *EditCommand) Execute(ctx context.Context, r *REPL, args []string) error
 			Timestamp:   iter.Timestamp,
 		}
 		if err := r.sessionMgr.LogCost(ctx, costEntry); err != nil {
-			fmt.Fprintf(r.err, "Warning: failed to log cost: %v\n", err)
+			fmt.Fprintf(r.warn(), "Warning: failed to log cost: %v\n", err)
 		}
 	}
 
 	if err := r.displayer.Display(ctx, &resp.Images[0]); err != nil {
-		fmt.Fprintf(r.err, "Warning: failed to display: %v\n", err)
+		fmt.Fprintf(r.warn(), "Warning: failed to display: %v\n", err)
 	}
 
 	fmt.Fprintf(r.out, "Saved: %s\n", paths[0])
@@ -241,17 +323,20 @@ func (c *EditCommand) Execute(ctx context.Context, r *REPL, args []string) error
 			quality = ""
 		}
 		if quality != "" {
-			fmt.Fprintf(r.out, "Cost: $%.4f (%d image(s) @ $%.4f/image, %s %s %s)\n",
+			fmt.Fprintf(r.info(), "Cost: $%.4f (%d image(s) @ $%.4f/image, %s %s %s)\n",
 				resp.Cost.Total, len(resp.Images), resp.Cost.PerImage,
 				req.Model, req.Size, quality)
 		} else {
-			fmt.Fprintf(r.out, "Cost: $%.4f (%d image(s) @ $%.4f/image, %s %s)\n",
+			fmt.Fprintf(r.info(), "Cost: $%.4f (%d image(s) @ $%.4f/image, %s %s)\n",
 				resp.Cost.Total, len(resp.Images), resp.Cost.PerImage,
 				req.Model, req.Size)
 		}
 	}
+	if resp.Timing.TotalDuration > 0 {
+		fmt.Fprintf(r.info(), "Time: %s\n", resp.Timing)
+	}
 	if resp.RevisedPrompt != "" {
-		fmt.Fprintf(r.out, "Revised prompt: %s\n", resp.RevisedPrompt)
+		fmt.Fprintf(r.info(), "Revised prompt: %s\n", resp.RevisedPrompt)
 	}
 
 	return nil
@@ -277,13 +362,68 @@ func (c *UndoCommand) Execute(ctx context.Context, r *REPL, _ []string) error {
 	if err == nil {
 		img := &models.GeneratedImage{Data: imageData}
 		if err := r.displayer.Display(ctx, img); err != nil {
-			fmt.Fprintf(r.err, "Warning: failed to display: %v\n", err)
+			fmt.Fprintf(r.warn(), "Warning: failed to display: %v\n", err)
 		}
 	}
 
 	return nil
 }
 
+// BranchCommand starts an alternate line of edits from an iteration
+type BranchCommand struct{}
+
+func (c *BranchCommand) Name() string        { return "branch" }
+func (c *BranchCommand) Aliases() []string   { return []string{"fork"} }
+func (c *BranchCommand) Description() string { return "Start an alternate line of edits" }
+func (c *BranchCommand) Usage() string       { return "branch [history-number]" }
+
+func (c *BranchCommand) Execute(ctx context.Context, r *REPL, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: %s", c.Usage())
+	}
+
+	id := ""
+	if len(args) == 1 {
+		iter, _, err := r.historyIteration(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		id = iter.ID
+	}
+
+	iter, err := r.sessionMgr.Branch(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(r.out, "Branching from: %s\n", iter.Prompt)
+	fmt.Fprintln(r.out, "The next generate or edit starts a new line; history --tree shows every line.")
+
+	imageData, err := os.ReadFile(iter.ImagePath)
+	if err == nil {
+		img := &models.GeneratedImage{Data: imageData}
+		if err := r.displayer.Display(ctx, img); err != nil {
+			fmt.Fprintf(r.warn(), "Warning: failed to display: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// historyIteration returns the iteration of the current session numbered
+// arg by the history command, and the session's history.
+func (r *REPL) historyIteration(ctx context.Context, arg string) (*session.Iteration, []*session.Iteration, error) {
+	history, err := r.sessionMgr.History(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(history) {
+		return nil, nil, fmt.Errorf("no iteration %q in this session; see history for the numbers", arg)
+	}
+	return history[n-1], history, nil
+}
+
 // SaveCommand saves the current image to a specified path
 type SaveCommand struct{}
 
@@ -345,15 +485,75 @@ func (c *ShowCommand) Execute(ctx context.Context, r *REPL, _ []string) error {
 	return r.displayer.Display(ctx, img)
 }
 
+// compareCellSize is the width and height, in pixels, of each image in the
+// side-by-side view of the compare command.
+const compareCellSize = 512
+
+// CompareCommand shows an earlier iteration beside the current one
+type CompareCommand struct{}
+
+func (c *CompareCommand) Name() string        { return "compare" }
+func (c *CompareCommand) Aliases() []string   { return []string{"cmp"} }
+func (c *CompareCommand) Description() string { return "Show iteration n beside the current image" }
+func (c *CompareCommand) Usage() string       { return "compare <history-number>" }
+
+func (c *CompareCommand) Execute(ctx context.Context, r *REPL, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", c.Usage())
+	}
+	if !r.sessionMgr.HasIteration() {
+		return fmt.Errorf("no current image to compare")
+	}
+
+	other, history, err := r.historyIteration(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	current := r.sessionMgr.CurrentIteration()
+	currentNumber := 0
+	for i, iter := range history {
+		if iter.ID == current.ID {
+			currentNumber = i + 1
+		}
+	}
+
+	left := fmt.Sprintf("[%s] %s", args[0], other.Prompt)
+	right := fmt.Sprintf("[%d] %s (current)", currentNumber, current.Prompt)
+
+	// Without inline images, the paths let the user open both.
+	if !r.displayer.HasGraphics() {
+		fmt.Fprintf(r.out, "%s\n  %s\n%s\n  %s\n", left, other.ImagePath, right, current.ImagePath)
+		return nil
+	}
+
+	sheet, err := image.ContactSheet([]image.SheetTile{
+		{Path: other.ImagePath, Caption: left},
+		{Path: current.ImagePath, Caption: right},
+	}, image.SheetOptions{Columns: 2, CellSize: compareCellSize}, models.FormatPNG)
+	if err != nil {
+		return fmt.Errorf("failed to build comparison: %w", err)
+	}
+	fmt.Fprintf(r.out, "Left: %s\nRight: %s\n", left, right)
+	return r.displayer.Display(ctx, &models.GeneratedImage{Data: sheet})
+}
+
 // HistoryCommand shows iteration history
 type HistoryCommand struct{}
 
 func (c *HistoryCommand) Name() string        { return "history" }
 func (c *HistoryCommand) Aliases() []string   { return []string{"h", "hist"} }
 func (c *HistoryCommand) Description() string { return "Show iteration history" }
-func (c *HistoryCommand) Usage() string       { return "history" }
+func (c *HistoryCommand) Usage() string       { return "history [--tree]" }
+
+func (c *HistoryCommand) Execute(ctx context.Context, r *REPL, args []string) error {
+	tree := false
+	for _, arg := range args {
+		if arg != "--tree" {
+			return fmt.Errorf("unknown option %q (usage: %s)", arg, c.Usage())
+		}
+		tree = true
+	}
 
-func (c *HistoryCommand) Execute(ctx context.Context, r *REPL, _ []string) error {
 	history, err := r.sessionMgr.History(ctx)
 	if err != nil {
 		return err
@@ -369,18 +569,87 @@ func (c *HistoryCommand) Execute(ctx context.Context, r *REPL, _ []string) error
 		currentID = r.sessionMgr.CurrentIteration().ID
 	}
 
+	numbers := make(map[string]int, len(history))
 	for i, iter := range history {
+		numbers[iter.ID] = i + 1
+	}
+	label := func(iter *session.Iteration) string {
+		// Iterations without a recorded cost (free or pre-pricing) omit it.
+		cost := ""
+		if iter.Metadata.Cost > 0 {
+			cost = fmt.Sprintf(" ($%.4f)", iter.Metadata.Cost)
+		}
+		branch := ""
+		if iter.BranchPoint {
+			branch = " [branch]"
+		}
+		return fmt.Sprintf("[%d] %s %s: %q%s%s",
+			numbers[iter.ID],
+			session.FormatTimestamp(iter.Timestamp.Local()),
+			iter.Operation,
+			truncate(iter.Prompt, 50),
+			cost,
+			branch)
+	}
+
+	if tree {
+		roots := session.BuildTree(history)
+		lines := session.TreeLines(roots, func(iter *session.Iteration) string {
+			marker := "  "
+			if iter.ID == currentID {
+				marker = "> "
+			}
+			return marker + label(iter)
+		})
+		for _, line := range lines {
+			fmt.Fprintln(r.out, line)
+		}
+		return nil
+	}
+
+	for _, iter := range history {
 		marker := "  "
 		if iter.ID == currentID {
 			marker = "> "
 		}
-		fmt.Fprintf(r.out, "%s[%d] %s %s: %q\n",
-			marker,
-			i+1,
-			session.FormatTimestamp(iter.Timestamp),
+		fmt.Fprintf(r.out, "%s%s\n", marker, label(iter))
+	}
+
+	return nil
+}
+
+// SearchCommand finds iterations in any session by prompt text
+type SearchCommand struct{}
+
+func (c *SearchCommand) Name() string        { return "search" }
+func (c *SearchCommand) Aliases() []string   { return []string{"find"} }
+func (c *SearchCommand) Description() string { return "Search prompts across all sessions" }
+func (c *SearchCommand) Usage() string       { return "search <text>" }
+
+func (c *SearchCommand) Execute(ctx context.Context, r *REPL, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", c.Usage())
+	}
+	text := strings.Join(args, " ")
+
+	results, err := r.sessionMgr.SearchIterations(ctx, text)
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		fmt.Fprintf(r.out, "No prompts match %q\n", text)
+		return nil
+	}
+
+	for _, iter := range results {
+		fmt.Fprintf(r.out, "  %-6s  %s %s: %q\n",
+			iter.SessionID[:min(len(iter.SessionID), 6)],
+			session.FormatTimestamp(iter.Timestamp.Local()),
 			iter.Operation,
-			truncate(iter.Prompt, 50))
+			session.Snippet(iter, text, 50))
 	}
+	fmt.Fprintln(r.out, "\nUse 'session load <id>' to open a session.")
 
 	return nil
 }
@@ -390,8 +659,8 @@ type SessionCommand struct{}
 
 func (c *SessionCommand) Name() string        { return "session" }
 func (c *SessionCommand) Aliases() []string   { return []string{"sess"} }
-func (c *SessionCommand) Description() string { return "Manage sessions (list, load, new, rename)" }
-func (c *SessionCommand) Usage() string       { return "session <list|load|new|rename> [args]" }
+func (c *SessionCommand) Description() string { return "List, load, create, rename, and tag sessions" }
+func (c *SessionCommand) Usage() string       { return "session <list|load|new|rename|tag|untag> [args]" }
 
 func (c *SessionCommand) Execute(ctx context.Context, r *REPL, args []string) error {
 	if len(args) == 0 {
@@ -420,8 +689,19 @@ func (c *SessionCommand) Execute(ctx context.Context, r *REPL, args []string) er
 			return fmt.Errorf("usage: session rename <name>")
 		}
 		return c.rename(ctx, r, strings.Join(subArgs, " "))
+	case "tag":
+		if len(subArgs) != 1 {
+			return fmt.Errorf("usage: session tag <name>")
+		}
+		return c.tag(ctx, r, subArgs[0])
+	case "untag":
+		if len(subArgs) != 1 {
+			return fmt.Errorf("usage: session untag <name>")
+		}
+		return c.untag(ctx, r, subArgs[0])
 	default:
-		return fmt.Errorf("unknown session command: %s", subCmd)
+		hint := suggest.DidYouMean(subCmd, []string{"list", "ls", "load", "new", "rename", "tag", "untag"})
+		return fmt.Errorf("unknown session command: %s%s\nUsage: %s", subCmd, hint, c.Usage())
 	}
 }
 
@@ -441,8 +721,8 @@ func (c *SessionCommand) list(ctx context.Context, r *REPL) error {
 		currentID = r.sessionMgr.Current().ID
 	}
 
-	fmt.Fprintf(r.out, "%-8s  %-20s  %-20s  %s\n", "ID", "Name", "Updated", "Model")
-	fmt.Fprintln(r.out, strings.Repeat("-", 70))
+	fmt.Fprintf(r.out, "%-8s  %-20s  %-20s  %-12s  %s\n", "ID", "Name", "Updated", "Model", "Tags")
+	fmt.Fprintln(r.out, strings.Repeat("-", 84))
 
 	for _, sess := range sessions {
 		marker := "  "
@@ -453,12 +733,13 @@ func (c *SessionCommand) list(ctx context.Context, r *REPL) error {
 		if name == "" {
 			name = "(unnamed)"
 		}
-		fmt.Fprintf(r.out, "%s%-6s  %-20s  %-20s  %s\n",
+		fmt.Fprintf(r.out, "%s%-6s  %-20s  %-20s  %-12s  %s\n",
 			marker,
 			sess.ID[:6],
 			truncate(name, 20),
-			session.FormatTimestamp(sess.UpdatedAt),
-			sess.Model)
+			session.FormatTimestamp(sess.UpdatedAt.Local()),
+			sess.Model,
+			strings.Join(sess.Tags, ", "))
 	}
 
 	return nil
@@ -486,19 +767,24 @@ func (c *SessionCommand) load(ctx context.Context, r *REPL, id string) error {
 		return err
 	}
 
+	printSession(r, "Loaded")
+	return nil
+}
+
+// printSession reports the session just loaded and its current iteration,
+// starting with verb.
+func printSession(r *REPL, verb string) {
 	sess := r.sessionMgr.Current()
 	name := sess.Name
 	if name == "" {
 		name = "(unnamed)"
 	}
-	fmt.Fprintf(r.out, "Loaded session: %s (%s)\n", name, sess.ID[:6])
+	fmt.Fprintf(r.out, "%s session: %s (%s)\n", verb, name, sess.ID[:6])
 
 	if r.sessionMgr.HasIteration() {
 		iter := r.sessionMgr.CurrentIteration()
 		fmt.Fprintf(r.out, "Current: %s - %q\n", iter.Operation, truncate(iter.Prompt, 50))
 	}
-
-	return nil
 }
 
 func (c *SessionCommand) new(ctx context.Context, r *REPL, name string) error {
@@ -523,6 +809,31 @@ func (c *SessionCommand) rename(ctx context.Context, r *REPL, name string) error
 	return nil
 }
 
+func (c *SessionCommand) tag(ctx context.Context, r *REPL, tag string) error {
+	if err := r.sessionMgr.TagSession(ctx, tag); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "Session tags: %s\n", strings.Join(r.sessionMgr.Current().Tags, ", "))
+	return nil
+}
+
+func (c *SessionCommand) untag(ctx context.Context, r *REPL, tag string) error {
+	removed, err := r.sessionMgr.UntagSession(ctx, tag)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		fmt.Fprintf(r.out, "Session is not tagged %q\n", tag)
+		return nil
+	}
+	tags := strings.Join(r.sessionMgr.Current().Tags, ", ")
+	if tags == "" {
+		tags = "(none)"
+	}
+	fmt.Fprintf(r.out, "Session tags: %s\n", tags)
+	return nil
+}
+
 // ModelCommand changes the current model
 type ModelCommand struct{}
 
@@ -552,9 +863,9 @@ func (c *ModelCommand) Execute(_ context.Context, r *REPL, args []string) error
 		return nil
 	}
 
-	modelName := args[0]
-	if _, ok := r.registry.Get(modelName); !ok {
-		return fmt.Errorf("unknown model: %s", modelName)
+	modelName, err := r.registry.Resolve(args[0])
+	if err != nil {
+		return err
 	}
 
 	r.sessionMgr.SetModel(modelName)
@@ -590,7 +901,8 @@ func (c *CostCommand) Execute(ctx context.Context, r *REPL, args []string) error
 	case "session":
 		return c.showSession(ctx, r)
 	default:
-		return fmt.Errorf("unknown cost command: %s\nUsage: %s", subCmd, c.Usage())
+		hint := suggest.DidYouMean(subCmd, []string{"today", "week", "month", "total", "provider", "session"})
+		return fmt.Errorf("unknown cost command: %s%s\nUsage: %s", subCmd, hint, c.Usage())
 	}
 }
 
@@ -714,6 +1026,44 @@ func (c *CostCommand) showSession(ctx context.Context, r *REPL) error {
 	return nil
 }
 
+// BudgetCommand gets or sets the session's spending cap
+type BudgetCommand struct{}
+
+func (c *BudgetCommand) Name() string        { return "budget" }
+func (c *BudgetCommand) Aliases() []string   { return nil }
+func (c *BudgetCommand) Description() string { return "Get or set a spending cap for the session" }
+func (c *BudgetCommand) Usage() string       { return "budget [amount|off]" }
+
+func (c *BudgetCommand) Execute(ctx context.Context, r *REPL, args []string) error {
+	if len(args) == 0 {
+		if r.budget == 0 {
+			fmt.Fprintln(r.out, "No budget set.")
+			return nil
+		}
+		summary, err := r.sessionMgr.GetSessionCost(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(r.out, "Budget: $%.2f (session spent $%.4f, $%.4f left)\n",
+			r.budget, summary.TotalCost, max(r.budget-summary.TotalCost, 0))
+		return nil
+	}
+
+	if args[0] == "off" {
+		r.budget = 0
+		fmt.Fprintln(r.out, "Budget removed.")
+		return nil
+	}
+
+	amount, err := strconv.ParseFloat(strings.TrimPrefix(args[0], "$"), 64)
+	if err != nil || amount <= 0 {
+		return fmt.Errorf("invalid budget %q: want a positive amount in USD or 'off'", args[0])
+	}
+	r.budget = amount
+	fmt.Fprintf(r.out, "Budget set to $%.2f for this session.\n", amount)
+	return nil
+}
+
 // HelpCommand shows available commands
 type HelpCommand struct{}
 
@@ -725,14 +1075,18 @@ func (c *HelpCommand) Usage() string       { return "help" }
 func (c *HelpCommand) Execute(_ context.Context, r *REPL, _ []string) error {
 	commands := []Command{
 		&GenerateCommand{},
+		&RegenerateCommand{},
 		&EditCommand{},
 		&UndoCommand{},
+		&BranchCommand{},
 		&SaveCommand{},
 		&ShowCommand{},
+		&CompareCommand{},
 		&HistoryCommand{},
 		&SessionCommand{},
 		&ModelCommand{},
 		&CostCommand{},
+		&BudgetCommand{},
 		&HelpCommand{},
 		&QuitCommand{},
 	}
@@ -766,6 +1120,15 @@ func (c *QuitCommand) Execute(_ context.Context, r *REPL, _ []string) error {
 	return nil
 }
 
+// modelUsed returns the model the API reported for resp when it differs
+// from the requested one, and "" otherwise.
+func modelUsed(requested string, resp *models.Response) string {
+	if resp.ModelUsed == requested {
+		return ""
+	}
+	return resp.ModelUsed
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
@@ -0,0 +1,177 @@
+package repl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/peterh/liner"
+	"golang.org/x/term"
+)
+
+// sessionSubcommands are the subcommands of the session command, offered
+// as completions after it.
+var sessionSubcommands = []string{"list", "load", "new", "rename", "tag", "untag"}
+
+// HistoryPath returns the file the line editor keeps entered lines in
+// between runs.
+func HistoryPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".imggen", "repl_history"), nil
+}
+
+// lineReader reads one command line at a time after showing prompt. It
+// returns io.EOF when the input ends.
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+	Close() error
+}
+
+// newLineReader returns a line editor when the REPL reads from a terminal
+// on standard input, and a plain line reader otherwise, such as for piped
+// input or a reader set by tests.
+func (r *REPL) newLineReader(ctx context.Context) lineReader {
+	if f, ok := r.in.(*os.File); ok && f == os.Stdin && term.IsTerminal(int(f.Fd())) && liner.TerminalSupported() {
+		path, err := HistoryPath()
+		if err != nil {
+			fmt.Fprintf(r.err, "Warning: command history disabled: %v\n", err)
+		}
+		return newLineEditor(func(line string) []string { return r.complete(ctx, line) }, path)
+	}
+	return &scanReader{out: r.out, scanner: bufio.NewScanner(r.in)}
+}
+
+// scanReader reads lines from an io.Reader without editing.
+type scanReader struct {
+	out     io.Writer
+	scanner *bufio.Scanner
+}
+
+func (s *scanReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(s.out, prompt)
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return s.scanner.Text(), nil
+}
+
+func (s *scanReader) Close() error { return nil }
+
+// lineEditor reads lines from the terminal with editing keys, recall of
+// earlier lines with the arrow keys, and tab completion. Lines are saved
+// to historyPath on Close; an empty path keeps them for this run only.
+type lineEditor struct {
+	state       *liner.State
+	historyPath string
+}
+
+func newLineEditor(complete liner.Completer, historyPath string) *lineEditor {
+	state := liner.NewLiner()
+	state.SetCtrlCAborts(true)
+	state.SetTabCompletionStyle(liner.TabPrints)
+	state.SetCompleter(complete)
+	if historyPath != "" {
+		// A missing or unreadable history file starts an empty history.
+		if f, err := os.Open(historyPath); err == nil {
+			state.ReadHistory(f)
+			f.Close()
+		}
+	}
+	return &lineEditor{state: state, historyPath: historyPath}
+}
+
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	for {
+		line, err := e.state.Prompt(prompt)
+		// Ctrl-C discards the line being typed, like a shell.
+		if errors.Is(err, liner.ErrPromptAborted) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(line) != "" {
+			e.state.AppendHistory(line)
+		}
+		return line, nil
+	}
+}
+
+// Close restores the terminal and writes the history file, which liner
+// caps at the last liner.HistoryLimit lines.
+func (e *lineEditor) Close() error {
+	defer e.state.Close()
+	if e.historyPath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(e.historyPath), 0755); err != nil {
+		return fmt.Errorf("failed to save command history: %w", err)
+	}
+	f, err := os.OpenFile(e.historyPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to save command history: %w", err)
+	}
+	defer f.Close()
+	if _, err := e.state.WriteHistory(f); err != nil {
+		return fmt.Errorf("failed to save command history: %w", err)
+	}
+	return nil
+}
+
+// complete returns the completions of line: command names and aliases for
+// the first word, session subcommands after "session", and session IDs
+// after "session load". Each completion is the whole line.
+func (r *REPL) complete(ctx context.Context, line string) []string {
+	cut := strings.LastIndex(line, " ") + 1
+	head, word := line[:cut], line[cut:]
+	prior := strings.Fields(head)
+
+	var candidates []string
+	suffix := " "
+	switch {
+	case len(prior) == 0:
+		candidates = slices.Sorted(maps.Keys(r.commands))
+		word = strings.ToLower(word)
+	case !r.isSessionCommand(prior[0]):
+		return nil
+	case len(prior) == 1:
+		candidates = sessionSubcommands
+	case len(prior) == 2 && strings.EqualFold(prior[1], "load"):
+		sessions, err := r.sessionMgr.ListSessions(ctx)
+		if err != nil {
+			return nil
+		}
+		for _, sess := range sessions {
+			candidates = append(candidates, sess.ID)
+		}
+		suffix = ""
+	default:
+		return nil
+	}
+
+	var completions []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			completions = append(completions, head+c+suffix)
+		}
+	}
+	return completions
+}
+
+func (r *REPL) isSessionCommand(name string) bool {
+	_, ok := r.commands[strings.ToLower(name)].(*SessionCommand)
+	return ok
+}
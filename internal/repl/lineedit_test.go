@@ -0,0 +1,109 @@
+package repl
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestComplete_CommandNames(t *testing.T) {
+	r, _, _, cleanup := testREPL(t, "")
+	defer cleanup()
+	ctx := context.Background()
+
+	all := r.complete(ctx, "")
+	for name := range r.commands {
+		if !slices.Contains(all, name+" ") {
+			t.Errorf("complete(\"\") is missing registered command %q", name)
+		}
+	}
+	if !slices.IsSorted(all) {
+		t.Errorf("complete(\"\") = %v, want sorted", all)
+	}
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"ge", []string{"gen ", "generate "}},
+		{"HIS", []string{"hist ", "history "}},
+		{"sa", []string{"save "}},
+		{"zzz", nil},
+		{"session ", []string{"session list ", "session load ", "session new ", "session rename ", "session tag ", "session untag "}},
+		{"sess l", []string{"sess list ", "sess load "}},
+		{"generate a fo", nil},
+		{"session rename x", nil},
+	}
+	for _, tt := range tests {
+		if got := r.complete(ctx, tt.line); !slices.Equal(got, tt.want) {
+			t.Errorf("complete(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestComplete_SessionIDs(t *testing.T) {
+	r, _, mgr, cleanup := testREPL(t, "")
+	defer cleanup()
+	ctx := context.Background()
+
+	first, err := mgr.StartNew(ctx, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := mgr.StartNew(ctx, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.complete(ctx, "session load ")
+	slices.Sort(got)
+	want := []string{"session load " + first.ID, "session load " + second.ID}
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("complete(session load) = %q, want %q", got, want)
+	}
+
+	got = r.complete(ctx, "session load "+first.ID[:8])
+	if !slices.Contains(got, "session load "+first.ID) {
+		t.Errorf("complete(session load prefix) = %q, want %s", got, first.ID)
+	}
+}
+
+func TestScanReader(t *testing.T) {
+	// Input that is not a terminal is read without the line editor.
+	var out strings.Builder
+	r := &REPL{in: strings.NewReader("help\nquit\n"), out: &out}
+	lines, ok := r.newLineReader(context.Background()).(*scanReader)
+	if !ok {
+		t.Fatal("newLineReader() for a strings.Reader is not a scanReader")
+	}
+
+	for _, want := range []string{"help", "quit"} {
+		got, err := lines.ReadLine("> ")
+		if err != nil || got != want {
+			t.Errorf("ReadLine() = %q, %v; want %q", got, err, want)
+		}
+	}
+	if _, err := lines.ReadLine("> "); err != io.EOF {
+		t.Errorf("ReadLine() at end error = %v, want io.EOF", err)
+	}
+	if out.String() != "> > > " {
+		t.Errorf("prompts written = %q", out.String())
+	}
+}
+
+func TestHistoryPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	got, err := HistoryPath()
+	if err != nil {
+		t.Fatalf("HistoryPath() error = %v", err)
+	}
+	if want := filepath.Join(home, ".imggen", "repl_history"); got != want {
+		t.Errorf("HistoryPath() = %q, want %q", got, want)
+	}
+}
@@ -1,16 +1,21 @@
 package repl
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/manash/imggen/internal/cost"
 	"github.com/manash/imggen/internal/display"
+	"github.com/manash/imggen/internal/events"
 	"github.com/manash/imggen/internal/image"
 	"github.com/manash/imggen/internal/provider"
 	"github.com/manash/imggen/internal/session"
+	"github.com/manash/imggen/internal/suggest"
 	"github.com/manash/imggen/pkg/models"
 )
 
@@ -23,8 +28,17 @@ type REPL struct {
 	sessionMgr *session.Manager
 	displayer  *display.Displayer
 	saver      *image.Saver
+	events     *events.Logger
 	commands   map[string]Command
 	running    bool
+	resumeLast bool
+	spinner    bool
+	quiet      bool
+
+	// budget caps the session's spend in USD; zero means no cap.
+	budget float64
+
+	costCalc *cost.Calculator
 }
 
 type Config struct {
@@ -36,6 +50,24 @@ type Config struct {
 	SessionMgr *session.Manager
 	Displayer  *display.Displayer
 	Saver      *image.Saver
+
+	// Events, when set, records every generate and edit call.
+	Events *events.Logger
+
+	// ResumeLast loads the most recently updated session on start instead
+	// of beginning a new one.
+	ResumeLast bool
+
+	// Spinner shows the time elapsed on Out while a generation runs. Set
+	// it only when Out is a terminal that nothing else writes to meanwhile.
+	Spinner bool
+
+	// Quiet leaves out progress, cost, and warning lines, keeping saved
+	// paths and errors.
+	Quiet bool
+
+	// PriceOverrides replace the built-in prices in budget estimates.
+	PriceOverrides cost.Overrides
 }
 
 func New(cfg *Config) *REPL {
@@ -48,24 +80,75 @@ func New(cfg *Config) *REPL {
 		sessionMgr: cfg.SessionMgr,
 		displayer:  cfg.Displayer,
 		saver:      cfg.Saver,
+		events:     cfg.Events,
+		resumeLast: cfg.ResumeLast,
+		spinner:    cfg.Spinner,
+		quiet:      cfg.Quiet,
 		commands:   make(map[string]Command),
+		costCalc:   cost.NewCalculator(cost.WithOverrides(cfg.PriceOverrides)),
 	}
 	r.registerCommands()
 	return r
 }
 
+// info returns where progress and cost lines go: out, or nowhere when
+// quiet.
+func (r *REPL) info() io.Writer {
+	if r.quiet {
+		return io.Discard
+	}
+	return r.out
+}
+
+// warn returns where warnings go: err, or nowhere when quiet.
+func (r *REPL) warn() io.Writer {
+	if r.quiet {
+		return io.Discard
+	}
+	return r.err
+}
+
+// checkBudget returns an error wrapping cost.ErrBudgetExceeded when a
+// request estimated from model, size and quality would take the session's
+// spend past the budget.
+func (r *REPL) checkBudget(ctx context.Context, model, size, quality string) error {
+	if r.budget == 0 {
+		return nil
+	}
+	summary, err := r.sessionMgr.GetSessionCost(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read session cost: %w", err)
+	}
+	estimate := r.costCalc.Estimate(model, size, quality, 1).Total
+	return cost.Check(r.budget, summary.TotalCost, estimate)
+}
+
 func (r *REPL) Run(ctx context.Context) error {
 	r.running = true
 	r.printWelcome()
+	if r.resumeLast {
+		if err := r.resumeLastSession(ctx); err != nil {
+			fmt.Fprintf(r.err, "Error: failed to resume last session: %v\n", err)
+		}
+	}
+
+	lines := r.newLineReader(ctx)
+	defer func() {
+		if err := lines.Close(); err != nil {
+			fmt.Fprintf(r.warn(), "Warning: %v\n", err)
+		}
+	}()
 
-	scanner := bufio.NewScanner(r.in)
 	for r.running {
-		r.printPrompt()
-		if !scanner.Scan() {
+		line, err := lines.ReadLine(r.prompt())
+		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			return err
+		}
 
-		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimSpace(line)
 		if line == "" {
 			continue
 		}
@@ -75,7 +158,7 @@ func (r *REPL) Run(ctx context.Context) error {
 		}
 	}
 
-	return scanner.Err()
+	return nil
 }
 
 func (r *REPL) execute(ctx context.Context, line string) error {
@@ -89,12 +172,22 @@ func (r *REPL) execute(ctx context.Context, line string) error {
 
 	cmd, ok := r.commands[cmdName]
 	if !ok {
-		return fmt.Errorf("unknown command: %s (type 'help' for available commands)", cmdName)
+		names := slices.Collect(maps.Keys(r.commands))
+		return fmt.Errorf("unknown command: %s%s (type 'help' for available commands)", cmdName, suggest.DidYouMean(cmdName, names))
 	}
 
 	return cmd.Execute(ctx, r, args)
 }
 
+// logEvent records an API call that started at start in the event log.
+func (r *REPL) logEvent(e events.Event, prompt string, resp *models.Response, start time.Time, err error) {
+	var costInfo *models.CostInfo
+	if resp != nil {
+		costInfo = resp.Cost
+	}
+	r.events.Record(r.warn(), e, prompt, costInfo, start, err)
+}
+
 func (r *REPL) Stop() {
 	r.running = false
 }
@@ -105,14 +198,28 @@ func (r *REPL) printWelcome() {
 	fmt.Fprintln(r.out)
 }
 
-func (r *REPL) printPrompt() {
+// resumeLastSession loads the most recently updated session and reports
+// what was restored.
+func (r *REPL) resumeLastSession(ctx context.Context) error {
+	found, err := r.sessionMgr.LoadLatest(ctx)
+	if err != nil {
+		return err
+	}
+	if !found {
+		fmt.Fprintln(r.out, "No previous session to resume; starting fresh")
+		return nil
+	}
+	printSession(r, "Resumed")
+	return nil
+}
+
+func (r *REPL) prompt() string {
 	model := r.sessionMgr.GetModel()
 	if r.sessionMgr.HasIteration() {
 		iter := r.sessionMgr.CurrentIteration()
-		fmt.Fprintf(r.out, "imggen [%s] (%s)> ", model, iter.Operation)
-	} else {
-		fmt.Fprintf(r.out, "imggen [%s]> ", model)
+		return fmt.Sprintf("imggen [%s] (%s)> ", model, iter.Operation)
 	}
+	return fmt.Sprintf("imggen [%s]> ", model)
 }
 
 func parseCommand(line string) []string {
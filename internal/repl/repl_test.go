@@ -3,12 +3,18 @@ package repl
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/png"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/manash/imggen/internal/cost"
 	"github.com/manash/imggen/internal/display"
 	"github.com/manash/imggen/internal/image"
 	"github.com/manash/imggen/internal/provider"
@@ -58,6 +64,8 @@ func testREPL(t *testing.T, input string) (*REPL, *bytes.Buffer, *session.Manage
 	t.Helper()
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "test.db")
+	// Generated images are saved to the working directory.
+	t.Chdir(tmpDir)
 
 	origHome := os.Getenv("HOME")
 	os.Setenv("HOME", tmpDir)
@@ -110,11 +118,15 @@ func TestREPL_CommandsRegistered(t *testing.T) {
 
 	expectedCommands := []string{
 		"generate", "gen", "g",
+		"regenerate", "r",
 		"edit", "e",
 		"undo", "u", "back",
+		"branch", "fork",
 		"save", "s",
 		"show", "display", "view",
+		"compare", "cmp",
 		"history", "h", "hist",
+		"search", "find",
 		"session", "sess",
 		"model", "m",
 		"help", "?",
@@ -170,6 +182,32 @@ func TestREPL_Run_UnknownCommand(t *testing.T) {
 	}
 }
 
+func TestREPL_Execute_Suggestions(t *testing.T) {
+	r, _, _, cleanup := testREPL(t, "")
+	defer cleanup()
+
+	ctx := context.Background()
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"hlep", `did you mean "help"?`},
+		{"cost mnth", `did you mean "month"?`},
+		{"session lsit", `did you mean "list"?`},
+	}
+	for _, tt := range tests {
+		err := r.execute(ctx, tt.line)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("execute(%q) error = %v, want %q", tt.line, err, tt.want)
+		}
+	}
+
+	err := r.execute(ctx, "xyzzyplugh")
+	if err == nil || strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("execute() error = %v, want no suggestion for far-off input", err)
+	}
+}
+
 func TestREPL_Run_EmptyLine(t *testing.T) {
 	r, _, _, cleanup := testREPL(t, "\n\n\nquit\n")
 	defer cleanup()
@@ -339,6 +377,37 @@ func TestModelCommand_UnknownModel(t *testing.T) {
 	}
 }
 
+func TestModelCommand_Alias(t *testing.T) {
+	r, out, mgr, cleanup := testREPL(t, "model dalle3\nquit\n")
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := r.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if mgr.GetModel() != "dall-e-3" {
+		t.Errorf("model = %s, want alias resolved to dall-e-3", mgr.GetModel())
+	}
+	if !strings.Contains(out.String(), "Model set to: dall-e-3") {
+		t.Error("model command did not confirm the canonical name")
+	}
+}
+
+func TestModelCommand_Prefix(t *testing.T) {
+	r, _, mgr, cleanup := testREPL(t, "model sd\nquit\n")
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := r.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if mgr.GetModel() != "gpt-image-1" {
+		t.Errorf("model = %s, a prefix should not change it", mgr.GetModel())
+	}
+}
+
 func TestHistoryCommand_Empty(t *testing.T) {
 	r, out, _, cleanup := testREPL(t, "history\nquit\n")
 	defer cleanup()
@@ -353,6 +422,231 @@ func TestHistoryCommand_Empty(t *testing.T) {
 	}
 }
 
+func TestHistoryCommand_Cost(t *testing.T) {
+	r, out, mgr, cleanup := testREPLWithCosts(t, "")
+	defer cleanup()
+
+	ctx := context.Background()
+	if _, err := mgr.StartNew(ctx, "test-session"); err != nil {
+		t.Fatalf("StartNew() error = %v", err)
+	}
+	createIterationWithCost(t, ctx, mgr, 0.042, 1)
+	createIterationWithCost(t, ctx, mgr, 0, 1)
+
+	cmd := &HistoryCommand{}
+	if err := cmd.Execute(ctx, r, nil); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("history printed %d lines, want 2:\n%s", len(lines), out.String())
+	}
+	if !strings.HasSuffix(lines[0], `"test prompt" ($0.0420)`) {
+		t.Errorf("line 1 = %q, want the iteration's cost", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], `"test prompt"`) {
+		t.Errorf("line 2 = %q, want no cost for a zero-cost iteration", lines[1])
+	}
+}
+
+func TestBranchCommand(t *testing.T) {
+	r, out, mgr, cleanup := testREPL(t, "")
+	defer cleanup()
+
+	ctx := context.Background()
+	seedIteration(t, ctx, mgr, "generate", "fox", "1024x1024", "low")
+	red := seedIteration(t, ctx, mgr, "edit", "red", "1024x1024", "low")
+	seedIteration(t, ctx, mgr, "edit", "hat", "1024x1024", "low")
+
+	if err := r.execute(ctx, "branch 2"); err != nil {
+		t.Fatalf("branch error = %v", err)
+	}
+	if mgr.CurrentIteration().ID != red.ID || !strings.Contains(out.String(), "Branching from: red") {
+		t.Fatalf("branch 2 left current at %q:\n%s", mgr.CurrentIteration().Prompt, out.String())
+	}
+	scarf := seedIteration(t, ctx, mgr, "edit", "scarf", "1024x1024", "low")
+	if scarf.ParentID != red.ID {
+		t.Errorf("edit after branch has parent %q, want %q", scarf.ParentID, red.ID)
+	}
+
+	out.Reset()
+	if err := r.execute(ctx, "history --tree"); err != nil {
+		t.Fatalf("history --tree error = %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	want := []struct{ prefix, suffix string }{
+		{"  [1] ", `generate: "fox"`},
+		{"  [2] ", `edit: "red" [branch]`},
+		{"├─   [3] ", `edit: "hat"`},
+		{"└─ > [4] ", `edit: "scarf"`},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("history --tree printed %d lines, want %d:\n%s", len(lines), len(want), out.String())
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i], w.prefix) || !strings.HasSuffix(lines[i], w.suffix) {
+			t.Errorf("line %d = %q, want %q...%q", i+1, lines[i], w.prefix, w.suffix)
+		}
+	}
+
+	for _, input := range []string{"branch 9", "branch x", "branch 1 2", "history --all"} {
+		if err := r.execute(ctx, input); err == nil {
+			t.Errorf("%q error = nil", input)
+		}
+	}
+}
+
+func TestCompareCommand(t *testing.T) {
+	r, out, mgr, cleanup := testREPL(t, "")
+	defer cleanup()
+	ctx := context.Background()
+
+	if err := r.execute(ctx, "compare 1"); err == nil || !strings.Contains(err.Error(), "no current image") {
+		t.Errorf("compare without iterations error = %v", err)
+	}
+
+	dir := t.TempDir()
+	for i, prompt := range []string{"fox", "red fox"} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.png", i))
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, stdimage.NewNRGBA(stdimage.Rect(0, 0, 40, 20))); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		iter := &session.Iteration{Operation: "generate", Prompt: prompt, Model: "gpt-image-1", ImagePath: path}
+		if err := mgr.AddIteration(ctx, iter); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, input := range []string{"compare", "compare 0", "compare 3", "compare x", "compare 1 2"} {
+		if err := r.execute(ctx, input); err == nil {
+			t.Errorf("%q error = nil", input)
+		}
+	}
+
+	// Without inline images, both paths are printed.
+	r.displayer.SetProtocol(display.ProtocolNone)
+	out.Reset()
+	if err := r.execute(ctx, "compare 1"); err != nil {
+		t.Fatalf("compare 1 error = %v", err)
+	}
+	for _, want := range []string{`[1] fox`, filepath.Join(dir, "0.png"), `[2] red fox (current)`, filepath.Join(dir, "1.png")} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("compare output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	r.displayer.SetProtocol(display.ProtocolKitty)
+	out.Reset()
+	if err := r.execute(ctx, "cmp 1"); err != nil {
+		t.Fatalf("cmp 1 error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Left: [1] fox") || !strings.Contains(out.String(), "\x1b_G") {
+		t.Errorf("compare with graphics did not display the comparison:\n%q", out.String())
+	}
+}
+
+func TestSearchCommand(t *testing.T) {
+	r, out, mgr, cleanup := testREPL(t, "generate a bakery logo\nsearch LOGO\nsearch zebra\nquit\n")
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := r.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	id := mgr.Current().ID[:6]
+	if !strings.Contains(out.String(), id) || !strings.Contains(out.String(), `generate: "a bakery logo"`) {
+		t.Errorf("search did not list the matching iteration:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `No prompts match "zebra"`) {
+		t.Errorf("search did not report no matches:\n%s", out.String())
+	}
+}
+
+func TestRun_ResumeLast(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	store, err := session.NewStoreWithPath(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewStoreWithPath() error = %v", err)
+	}
+	defer store.Close()
+
+	// A previous run: an older session, then a newer one left on its
+	// first iteration after an undo.
+	ctx := context.Background()
+	prev := session.NewManager(store, "gpt-image-1")
+	if _, err := prev.StartNew(ctx, "older"); err != nil {
+		t.Fatal(err)
+	}
+	if err := prev.AddIteration(ctx, &session.Iteration{Operation: "generate", Prompt: "a dog"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prev.StartNew(ctx, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if err := prev.AddIteration(ctx, &session.Iteration{Operation: "generate", Prompt: "a red fox"}); err != nil {
+		t.Fatal(err)
+	}
+	want := prev.CurrentIteration().ID
+	if err := prev.AddIteration(ctx, &session.Iteration{Operation: "edit", Prompt: "add snow"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prev.Undo(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := session.NewManager(store, "gpt-image-1")
+	out := &bytes.Buffer{}
+	r := New(&Config{
+		In:         strings.NewReader("quit\n"),
+		Out:        out,
+		Err:        out,
+		Provider:   &mockProvider{},
+		Registry:   models.DefaultRegistry(),
+		SessionMgr: mgr,
+		Displayer:  display.New(out),
+		Saver:      image.NewSaver(),
+		ResumeLast: true,
+	})
+	if err := r.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if mgr.Current() == nil || mgr.Current().Name != "latest" {
+		t.Fatalf("resumed session = %+v, want the latest", mgr.Current())
+	}
+	if !mgr.HasIteration() || mgr.CurrentIteration().ID != want {
+		t.Errorf("current iteration = %+v, want the one left current", mgr.CurrentIteration())
+	}
+	for _, line := range []string{"Resumed session: latest", `Current: generate - "a red fox"`} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("output missing %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestRun_ResumeLast_NoSessions(t *testing.T) {
+	r, out, mgr, cleanup := testREPL(t, "quit\n")
+	defer cleanup()
+	r.resumeLast = true
+
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if mgr.HasSession() {
+		t.Error("no session should be loaded")
+	}
+	if !strings.Contains(out.String(), "No previous session to resume") {
+		t.Errorf("output = %q, want a note that nothing was resumed", out.String())
+	}
+}
+
 func TestSessionCommand_List_Empty(t *testing.T) {
 	r, out, _, cleanup := testREPL(t, "session list\nquit\n")
 	defer cleanup()
@@ -385,6 +679,37 @@ func TestSessionCommand_New(t *testing.T) {
 	}
 }
 
+func TestSessionCommand_TagUntag(t *testing.T) {
+	r, out, mgr, cleanup := testREPL(t, "session new Logos\nsession tag Client-A\nsession tag experiments\nsession untag experiments\nsession list\nquit\n")
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := r.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if got := mgr.Current().Tags; len(got) != 1 || got[0] != "client-a" {
+		t.Errorf("session tags = %v, want [client-a]", got)
+	}
+	if !strings.Contains(out.String(), "Session tags: client-a, experiments") {
+		t.Errorf("tag did not report the session's tags:\n%s", out.String())
+	}
+	sessions, err := mgr.ListSessions(ctx)
+	if err != nil || len(sessions) != 1 || len(sessions[0].Tags) != 1 {
+		t.Errorf("stored sessions = %v, %v; want one with one tag", sessions, err)
+	}
+}
+
+func TestSessionCommand_Tag_NoSession(t *testing.T) {
+	r, _, _, cleanup := testREPL(t, "")
+	defer cleanup()
+
+	err := r.commands["session"].Execute(context.Background(), r, []string{"tag", "client-a"})
+	if !errors.Is(err, session.ErrNoSession) {
+		t.Errorf("session tag error = %v, want ErrNoSession", err)
+	}
+}
+
 func TestGenerateCommand_NoPrompt(t *testing.T) {
 	r, _, _, cleanup := testREPL(t, "generate\nquit\n")
 	defer cleanup()
@@ -395,6 +720,152 @@ func TestGenerateCommand_NoPrompt(t *testing.T) {
 	}
 }
 
+func TestGenerateCommand_Quiet(t *testing.T) {
+	r, out, mgr, cleanup := testREPL(t, "")
+	defer cleanup()
+
+	r.quiet = true
+	r.displayer = display.New(io.Discard)
+	r.provider = &mockProvider{
+		generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			return &models.Response{
+				Images:        []models.GeneratedImage{{Data: []byte("img")}},
+				Cost:          &models.CostInfo{Total: 0.04, PerImage: 0.04},
+				RevisedPrompt: "a red fox in the snow",
+			}, nil
+		},
+	}
+
+	if err := r.execute(context.Background(), "generate a red fox"); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	if want := "Saved: " + mgr.CurrentIteration().ImagePath + "\n"; out.String() != want {
+		t.Errorf("quiet output = %q, want only %q", out.String(), want)
+	}
+}
+
+func TestRegenerateCommand_NoIteration(t *testing.T) {
+	r, _, _, cleanup := testREPL(t, "")
+	defer cleanup()
+
+	err := r.execute(context.Background(), "regenerate")
+	if err == nil || !strings.Contains(err.Error(), "no current image") {
+		t.Errorf("regenerate error = %v, want no current image", err)
+	}
+}
+
+// seedIteration adds an operation iteration for prompt at size and quality.
+func seedIteration(t *testing.T, ctx context.Context, mgr *session.Manager, operation, prompt, size, quality string) *session.Iteration {
+	t.Helper()
+	iter := &session.Iteration{
+		Operation: operation,
+		Prompt:    prompt,
+		Model:     "gpt-image-1",
+		ImagePath: "/tmp/seed.png",
+		Metadata:  session.IterationMetadata{Size: size, Quality: quality, Format: "png", Provider: "openai"},
+	}
+	if err := mgr.AddIteration(ctx, iter); err != nil {
+		t.Fatalf("AddIteration() error = %v", err)
+	}
+	return iter
+}
+
+func TestRegenerateCommand_Overrides(t *testing.T) {
+	r, _, mgr, cleanup := testREPL(t, "")
+	defer cleanup()
+
+	ctx := context.Background()
+	seed := seedIteration(t, ctx, mgr, "generate", "a lighthouse at dusk", "1024x1024", "low")
+
+	var got *models.Request
+	r.provider = &mockProvider{
+		generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			got = req
+			return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+		},
+	}
+
+	if err := r.execute(ctx, "r --size landscape --quality=high"); err != nil {
+		t.Fatalf("regenerate error = %v", err)
+	}
+	if got == nil || got.Prompt != "a lighthouse at dusk" || got.Model != "gpt-image-1" {
+		t.Fatalf("request = %+v, want the seeded prompt and model", got)
+	}
+	if got.Size != "1536x1024" || got.Quality != "high" {
+		t.Errorf("request size, quality = %s, %s; want 1536x1024, high", got.Size, got.Quality)
+	}
+
+	iter := mgr.CurrentIteration()
+	if iter.ID == seed.ID || iter.ParentID != seed.ID {
+		t.Errorf("new iteration %s has parent %s, want a child of %s", iter.ID, iter.ParentID, seed.ID)
+	}
+	if iter.Operation != "generate" || iter.Prompt != seed.Prompt {
+		t.Errorf("new iteration = %s %q, want generate %q", iter.Operation, iter.Prompt, seed.Prompt)
+	}
+	if iter.Metadata.Size != "1536x1024" || iter.Metadata.Quality != "high" {
+		t.Errorf("new iteration metadata = %+v, want the overrides", iter.Metadata)
+	}
+
+	// Without overrides the settings carry over.
+	if err := r.execute(ctx, "regenerate"); err != nil {
+		t.Fatalf("regenerate error = %v", err)
+	}
+	if got.Size != "1536x1024" || got.Quality != "high" {
+		t.Errorf("repeat request size, quality = %s, %s; want them kept", got.Size, got.Quality)
+	}
+}
+
+func TestRegenerateCommand_AfterUndo(t *testing.T) {
+	r, _, mgr, cleanup := testREPL(t, "")
+	defer cleanup()
+
+	ctx := context.Background()
+	first := seedIteration(t, ctx, mgr, "generate", "a red fox", "1024x1024", "medium")
+	seedIteration(t, ctx, mgr, "generate", "a blue fox", "1024x1024", "medium")
+
+	var prompt string
+	r.provider = &mockProvider{
+		generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			prompt = req.Prompt
+			return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+		},
+	}
+
+	if err := r.execute(ctx, "undo"); err != nil {
+		t.Fatalf("undo error = %v", err)
+	}
+	if err := r.execute(ctx, "regenerate --quality low"); err != nil {
+		t.Fatalf("regenerate error = %v", err)
+	}
+	if prompt != "a red fox" {
+		t.Errorf("regenerated prompt = %q, want the prompt undo returned to", prompt)
+	}
+	if iter := mgr.CurrentIteration(); iter.ParentID != first.ID || iter.Metadata.Quality != "low" {
+		t.Errorf("new iteration parent %s quality %s, want parent %s quality low", iter.ParentID, iter.Metadata.Quality, first.ID)
+	}
+}
+
+func TestRegenerateCommand_Errors(t *testing.T) {
+	r, _, mgr, cleanup := testREPL(t, "")
+	defer cleanup()
+
+	ctx := context.Background()
+	seedIteration(t, ctx, mgr, "generate", "a red fox", "1024x1024", "medium")
+	for _, tt := range []struct{ line, want string }{
+		{"regenerate --style vivid", `unknown option "--style"`},
+		{"regenerate --size", "usage: regenerate"},
+	} {
+		if err := r.execute(ctx, tt.line); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s error = %v, want %q", tt.line, err, tt.want)
+		}
+	}
+
+	seedIteration(t, ctx, mgr, "edit", "make it blue", "1024x1024", "")
+	if err := r.execute(ctx, "regenerate"); err == nil || !strings.Contains(err.Error(), "only repeats generations") {
+		t.Errorf("regenerate after edit error = %v", err)
+	}
+}
+
 func TestEditCommand_NoIteration(t *testing.T) {
 	r, _, _, cleanup := testREPL(t, "edit add something\nquit\n")
 	defer cleanup()
@@ -438,6 +909,7 @@ func TestSaveCommand_NoIteration(t *testing.T) {
 func TestCommand_Interface(t *testing.T) {
 	commands := []Command{
 		&GenerateCommand{},
+		&RegenerateCommand{},
 		&EditCommand{},
 		&UndoCommand{},
 		&SaveCommand{},
@@ -921,3 +1393,103 @@ func TestCostCommand_DefaultWithoutArgs(t *testing.T) {
 		t.Error("cost without args did not default to total")
 	}
 }
+
+func TestBudgetCommand_StopsGenerateOverBudget(t *testing.T) {
+	r, out, mgr, cleanup := testREPLWithCosts(t, "")
+	defer cleanup()
+
+	ctx := context.Background()
+	if _, err := mgr.StartNew(ctx, "budgeted"); err != nil {
+		t.Fatalf("StartNew() error = %v", err)
+	}
+	createIterationWithCost(t, ctx, mgr, 0.042, 1)
+
+	called := false
+	r.provider = &mockProvider{
+		generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			called = true
+			return &models.Response{Images: []models.GeneratedImage{{Data: []byte("img")}}}, nil
+		},
+	}
+
+	if err := r.execute(ctx, "budget 0.05"); err != nil {
+		t.Fatalf("budget error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Budget set to $0.05") {
+		t.Errorf("output = %q, want budget confirmation", out.String())
+	}
+
+	// gpt-image-1 at its defaults is estimated at $0.042, and the session
+	// has already spent $0.042.
+	err := r.execute(ctx, "generate a red fox")
+	if !errors.Is(err, cost.ErrBudgetExceeded) {
+		t.Fatalf("generate error = %v, want ErrBudgetExceeded", err)
+	}
+	if called {
+		t.Error("provider should not be called once the budget would be exceeded")
+	}
+
+	if err := r.execute(ctx, "budget off"); err != nil {
+		t.Fatalf("budget off error = %v", err)
+	}
+	if err := r.execute(ctx, "generate a red fox"); err != nil {
+		t.Fatalf("generate without budget error = %v", err)
+	}
+	if !called {
+		t.Error("provider should be called after removing the budget")
+	}
+}
+
+func TestGenerateCommand_RecordsModelUsed(t *testing.T) {
+	r, _, mgr, cleanup := testREPL(t, "")
+	defer cleanup()
+
+	r.provider = &mockProvider{
+		generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			return &models.Response{
+				Images:    []models.GeneratedImage{{Data: []byte("img")}},
+				ModelUsed: "gpt-image-1-2025-04-15",
+			}, nil
+		},
+	}
+
+	ctx := context.Background()
+	if err := r.execute(ctx, "generate a red fox"); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	if got := mgr.CurrentIteration().Metadata.ModelUsed; got != "gpt-image-1-2025-04-15" {
+		t.Errorf("iteration ModelUsed = %q, want the model the API reported", got)
+	}
+}
+
+func TestGenerateCommand_ShowsTiming(t *testing.T) {
+	r, out, _, cleanup := testREPL(t, "")
+	defer cleanup()
+
+	r.provider = &mockProvider{
+		generateFunc: func(ctx context.Context, req *models.Request) (*models.Response, error) {
+			return &models.Response{
+				Images: []models.GeneratedImage{{Data: []byte("img")}},
+				Timing: models.Timing{RequestDuration: 3 * time.Second, TotalDuration: 3200 * time.Millisecond},
+			}, nil
+		},
+	}
+
+	if err := r.execute(context.Background(), "generate a red fox"); err != nil {
+		t.Fatalf("generate error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Time: 3.20s (request 3.00s)") {
+		t.Errorf("output should show the timing:\n%s", out.String())
+	}
+}
+
+func TestBudgetCommand_Invalid(t *testing.T) {
+	r, _, _, cleanup := testREPL(t, "")
+	defer cleanup()
+
+	for _, arg := range []string{"abc", "-1", "0"} {
+		if err := r.execute(context.Background(), "budget "+arg); err == nil {
+			t.Errorf("budget %s should fail", arg)
+		}
+	}
+}
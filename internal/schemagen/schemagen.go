@@ -0,0 +1,235 @@
+// Package schemagen infers a JSON Schema for structured OCR output from an
+// example of the output itself.
+package schemagen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ErrNotObject is returned for examples whose top level is not an object;
+// structured output schemas must describe an object.
+var ErrNotObject = errors.New("example must be a JSON object")
+
+// FromExample returns an indented JSON Schema describing the JSON document
+// in example. The schema keeps the example's key order and is written for
+// strict structured output: every object lists all of its keys as required
+// and sets additionalProperties to false.
+//
+// The elements of an array are merged into one items schema. A key missing
+// from some of the objects in an array, or null in some of them, becomes
+// nullable instead of optional. Integers and other numbers merge to number,
+// and values of other differing types merge to a list of types. A null with
+// no other example is taken for a nullable string, as are the items of an
+// array that is always empty.
+func FromExample(example []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(example))
+	dec.UseNumber()
+	root, err := parse(dec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid example: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid example: unexpected data after the top-level value")
+	}
+	if !slices.Equal(root.types, []string{"object"}) {
+		return nil, ErrNotObject
+	}
+	return json.MarshalIndent(root.schema(), "", "  ")
+}
+
+// node is what the example shows about one value: the types it takes and,
+// for objects and arrays, what they hold.
+type node struct {
+	types   []string
+	props   []*prop
+	objects int // objects merged into props
+	items   *node
+}
+
+// prop is a key of an object, with the number of objects it appeared in.
+type prop struct {
+	name  string
+	value *node
+	count int
+}
+
+func parse(dec *json.Decoder) (*node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '{' {
+			return parseObject(dec)
+		}
+		return parseArray(dec)
+	case string:
+		return &node{types: []string{"string"}}, nil
+	case json.Number:
+		if strings.ContainsAny(tok.String(), ".eE") {
+			return &node{types: []string{"number"}}, nil
+		}
+		return &node{types: []string{"integer"}}, nil
+	case bool:
+		return &node{types: []string{"boolean"}}, nil
+	default:
+		return &node{types: []string{"null"}}, nil
+	}
+}
+
+func parseObject(dec *json.Decoder) (*node, error) {
+	n := &node{types: []string{"object"}, objects: 1}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		value, err := parse(dec)
+		if err != nil {
+			return nil, err
+		}
+		if p := n.prop(key.(string)); p != nil {
+			p.value = merge(p.value, value)
+			continue
+		}
+		n.props = append(n.props, &prop{name: key.(string), value: value, count: 1})
+	}
+	_, err := dec.Token()
+	return n, err
+}
+
+func parseArray(dec *json.Decoder) (*node, error) {
+	n := &node{types: []string{"array"}}
+	for dec.More() {
+		item, err := parse(dec)
+		if err != nil {
+			return nil, err
+		}
+		n.items = merge(n.items, item)
+	}
+	_, err := dec.Token()
+	return n, err
+}
+
+func (n *node) prop(name string) *prop {
+	for _, p := range n.props {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// merge combines what a and b show about values in the same place, such
+// as two elements of an array.
+func merge(a, b *node) *node {
+	if a == nil {
+		return b
+	}
+	for _, t := range b.types {
+		a.addType(t)
+	}
+	for _, bp := range b.props {
+		if ap := a.prop(bp.name); ap != nil {
+			ap.value = merge(ap.value, bp.value)
+			ap.count += bp.count
+		} else {
+			a.props = append(a.props, bp)
+		}
+	}
+	a.objects += b.objects
+	if b.items != nil {
+		a.items = merge(a.items, b.items)
+	}
+	return a
+}
+
+func (n *node) addType(t string) {
+	switch {
+	case slices.Contains(n.types, t):
+	case t == "integer" && slices.Contains(n.types, "number"):
+	case t == "number" && slices.Contains(n.types, "integer"):
+		n.types[slices.Index(n.types, "integer")] = "number"
+	default:
+		n.types = append(n.types, t)
+	}
+}
+
+// schema returns the JSON Schema of n, nullable when it was missing from
+// some of the objects it belongs to.
+func (n *node) schema() object {
+	var s object
+	types := slices.Clone(n.types)
+	if slices.Equal(types, []string{"null"}) {
+		types = []string{"string", "null"}
+	}
+	// Keep null last, after the types it makes nullable.
+	if i := slices.Index(types, "null"); i >= 0 {
+		types = append(slices.Delete(types, i, i+1), "null")
+	}
+	if len(types) == 1 {
+		s = append(s, field{"type", types[0]})
+	} else {
+		s = append(s, field{"type", types})
+	}
+
+	if slices.Contains(types, "object") {
+		props := object{}
+		required := []string{}
+		for _, p := range n.props {
+			child := p.value
+			if p.count < n.objects {
+				child = &node{types: append(slices.Clone(child.types), "null"), props: child.props, objects: child.objects, items: child.items}
+			}
+			props = append(props, field{p.name, child.schema()})
+			required = append(required, p.name)
+		}
+		s = append(s, field{"properties", props}, field{"required", required}, field{"additionalProperties", false})
+	}
+	if slices.Contains(types, "array") {
+		items := n.items
+		if items == nil {
+			items = &node{types: []string{"null"}}
+		}
+		s = append(s, field{"items", items.schema()})
+	}
+	return s
+}
+
+// object is a JSON object that marshals its fields in order.
+type object []field
+
+type field struct {
+	key   string
+	value any
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.key, err)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,105 @@
+package schemagen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// compact strips the whitespace from a JSON document for comparison.
+func compact(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(s)); err != nil {
+		t.Fatalf("invalid JSON %s: %v", s, err)
+	}
+	return buf.String()
+}
+
+func TestFromExample(t *testing.T) {
+	tests := []struct {
+		name    string
+		example string
+		want    string
+	}{
+		{
+			name:    "scalars",
+			example: `{"name": "Acme", "total": 12.5, "count": 3, "paid": true, "note": null}`,
+			want: `{"type": "object", "properties": {
+				"name": {"type": "string"},
+				"total": {"type": "number"},
+				"count": {"type": "integer"},
+				"paid": {"type": "boolean"},
+				"note": {"type": ["string", "null"]}
+			}, "required": ["name", "total", "count", "paid", "note"], "additionalProperties": false}`,
+		},
+		{
+			name:    "nested objects",
+			example: `{"vendor": {"name": "Acme", "address": {"city": "Oslo", "zip": "0150"}}, "id": "A-1"}`,
+			want: `{"type": "object", "properties": {
+				"vendor": {"type": "object", "properties": {
+					"name": {"type": "string"},
+					"address": {"type": "object", "properties": {
+						"city": {"type": "string"},
+						"zip": {"type": "string"}
+					}, "required": ["city", "zip"], "additionalProperties": false}
+				}, "required": ["name", "address"], "additionalProperties": false},
+				"id": {"type": "string"}
+			}, "required": ["vendor", "id"], "additionalProperties": false}`,
+		},
+		{
+			name: "array of objects",
+			example: `{"items": [
+				{"sku": "A", "qty": 1, "price": 2},
+				{"sku": "B", "qty": 2, "price": 2.5, "discount": "10%"}
+			]}`,
+			want: `{"type": "object", "properties": {
+				"items": {"type": "array", "items": {"type": "object", "properties": {
+					"sku": {"type": "string"},
+					"qty": {"type": "integer"},
+					"price": {"type": "number"},
+					"discount": {"type": ["string", "null"]}
+				}, "required": ["sku", "qty", "price", "discount"], "additionalProperties": false}}
+			}, "required": ["items"], "additionalProperties": false}`,
+		},
+		{
+			name:    "mixed and empty arrays",
+			example: `{"codes": [1, "two", null], "tags": [], "grid": [[1, 2], [3]]}`,
+			want: `{"type": "object", "properties": {
+				"codes": {"type": "array", "items": {"type": ["integer", "string", "null"]}},
+				"tags": {"type": "array", "items": {"type": ["string", "null"]}},
+				"grid": {"type": "array", "items": {"type": "array", "items": {"type": "integer"}}}
+			}, "required": ["codes", "tags", "grid"], "additionalProperties": false}`,
+		},
+		{
+			name:    "empty object",
+			example: `{}`,
+			want:    `{"type": "object", "properties": {}, "required": [], "additionalProperties": false}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromExample([]byte(tt.example))
+			if err != nil {
+				t.Fatalf("FromExample() error = %v", err)
+			}
+			if compact(t, string(got)) != compact(t, tt.want) {
+				t.Errorf("FromExample() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromExample_Errors(t *testing.T) {
+	for _, example := range []string{`["a"]`, `"text"`, `42`} {
+		if _, err := FromExample([]byte(example)); !errors.Is(err, ErrNotObject) {
+			t.Errorf("FromExample(%s) error = %v, want ErrNotObject", example, err)
+		}
+	}
+	for _, example := range []string{``, `{"a": }`, `{"a": 1} {"b": 2}`} {
+		if _, err := FromExample([]byte(example)); err == nil {
+			t.Errorf("FromExample(%q) error = nil", example)
+		}
+	}
+}
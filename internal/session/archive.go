@@ -0,0 +1,268 @@
+package session
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// manifestName is the archive entry describing the exported session.
+const manifestName = "manifest.json"
+
+// manifestVersion is bumped when the manifest layout changes incompatibly.
+const manifestVersion = 1
+
+// ErrInvalidArchive is returned by Import for files that are not session
+// archives written by Export.
+var ErrInvalidArchive = errors.New("invalid session archive")
+
+// Manifest describes an exported session and where each iteration's image
+// is stored in the archive.
+type Manifest struct {
+	Version    int                 `json:"version"`
+	ExportedAt time.Time           `json:"exported_at"`
+	Session    ManifestSession     `json:"session"`
+	Iterations []ManifestIteration `json:"iterations"`
+}
+
+// ManifestSession is the exported form of a Session.
+type ManifestSession struct {
+	ID                 string    `json:"id"`
+	Name               string    `json:"name,omitempty"`
+	Model              string    `json:"model"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	CurrentIterationID string    `json:"current_iteration_id,omitempty"`
+	Tags               []string  `json:"tags,omitempty"`
+}
+
+// ManifestIteration is the exported form of an Iteration. Image is the
+// archive entry holding its image, empty when the file was missing at
+// export time, in which case ImageMissing is set.
+type ManifestIteration struct {
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parent_id,omitempty"`
+	Operation     string            `json:"operation"`
+	Prompt        string            `json:"prompt"`
+	RevisedPrompt string            `json:"revised_prompt,omitempty"`
+	Model         string            `json:"model"`
+	Timestamp     time.Time         `json:"timestamp"`
+	Metadata      IterationMetadata `json:"metadata"`
+	BranchPoint   bool              `json:"branch_point,omitempty"`
+	Image         string            `json:"image,omitempty"`
+	ImageMissing  bool              `json:"image_missing,omitempty"`
+}
+
+// Export writes session id, its iterations, and their image files to w as a
+// zip archive with a manifest.json. Images that no longer exist on disk are
+// recorded as missing rather than failing the export.
+func Export(ctx context.Context, store *Store, id string, w io.Writer) (*Manifest, error) {
+	sess, err := store.GetSession(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSessionNotFound, err)
+	}
+	iterations, err := store.ListIterations(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list iterations: %w", err)
+	}
+
+	manifest := &Manifest{
+		Version:    manifestVersion,
+		ExportedAt: time.Now().UTC(),
+		Session: ManifestSession{
+			ID:                 sess.ID,
+			Name:               sess.Name,
+			Model:              sess.Model,
+			CreatedAt:          sess.CreatedAt.UTC(),
+			UpdatedAt:          sess.UpdatedAt.UTC(),
+			CurrentIterationID: sess.CurrentIterationID,
+			Tags:               sess.Tags,
+		},
+	}
+
+	zw := zip.NewWriter(w)
+	for _, iter := range iterations {
+		entry := ManifestIteration{
+			ID:            iter.ID,
+			ParentID:      iter.ParentID,
+			Operation:     iter.Operation,
+			Prompt:        iter.Prompt,
+			RevisedPrompt: iter.RevisedPrompt,
+			Model:         iter.Model,
+			Timestamp:     iter.Timestamp.UTC(),
+			Metadata:      iter.Metadata,
+			BranchPoint:   iter.BranchPoint,
+		}
+
+		data, err := os.ReadFile(iter.ImagePath)
+		switch {
+		case errors.Is(err, os.ErrNotExist) || iter.ImagePath == "":
+			entry.ImageMissing = true
+		case err != nil:
+			return nil, fmt.Errorf("failed to read %s: %w", iter.ImagePath, err)
+		default:
+			entry.Image = path.Join("images", iter.ID+filepath.Ext(iter.ImagePath))
+			if err := writeZipEntry(zw, entry.Image, data); err != nil {
+				return nil, err
+			}
+		}
+		manifest.Iterations = append(manifest.Iterations, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := writeZipEntry(zw, manifestName, data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return manifest, nil
+}
+
+func writeZipEntry(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Import recreates the session in the archive r, of the given size, under
+// new session and iteration IDs, writing its images to the new session's
+// image directory. Iterations whose image was missing at export are
+// imported without one.
+func Import(ctx context.Context, store *Store, r io.ReaderAt, size int64) (*Session, *Manifest, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	mf, ok := files[manifestName]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: no %s", ErrInvalidArchive, manifestName)
+	}
+	data, err := readZipEntry(mf)
+	if err != nil {
+		return nil, nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported manifest version %d", ErrInvalidArchive, manifest.Version)
+	}
+
+	ids := make(map[string]string, len(manifest.Iterations))
+	for _, iter := range manifest.Iterations {
+		ids[iter.ID] = uuid.New().String()
+	}
+
+	sess := &Session{
+		ID:        uuid.New().String(),
+		Name:      manifest.Session.Name,
+		CreatedAt: manifest.Session.CreatedAt,
+		UpdatedAt: time.Now(),
+		Model:     manifest.Session.Model,
+	}
+	dir, err := EnsureImageDir(sess.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create image directory: %w", err)
+	}
+	if err := store.CreateSession(ctx, sess); err != nil {
+		return nil, nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	for _, tag := range manifest.Session.Tags {
+		if err = store.AddTag(ctx, sess.ID, tag); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = importIterations(ctx, store, sess, dir, &manifest, files, ids)
+	}
+	if err != nil {
+		store.DeleteSession(ctx, sess.ID)
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	sess.Tags = manifest.Session.Tags
+	return sess, &manifest, nil
+}
+
+// importIterations adds the manifest's iterations to sess under their new
+// ids, writing their images to dir, and points sess at its current one.
+func importIterations(ctx context.Context, store *Store, sess *Session, dir string, manifest *Manifest, files map[string]*zip.File, ids map[string]string) error {
+	for _, entry := range manifest.Iterations {
+		iter := &Iteration{
+			ID:            ids[entry.ID],
+			SessionID:     sess.ID,
+			ParentID:      ids[entry.ParentID],
+			Operation:     entry.Operation,
+			Prompt:        entry.Prompt,
+			RevisedPrompt: entry.RevisedPrompt,
+			Model:         entry.Model,
+			Timestamp:     entry.Timestamp,
+			Metadata:      entry.Metadata,
+			BranchPoint:   entry.BranchPoint,
+		}
+
+		if entry.Image != "" {
+			f, ok := files[entry.Image]
+			if !ok {
+				return fmt.Errorf("%w: %s is listed but not in the archive", ErrInvalidArchive, entry.Image)
+			}
+			data, err := readZipEntry(f)
+			if err != nil {
+				return err
+			}
+			iter.ImagePath = filepath.Join(dir, iter.ID+path.Ext(entry.Image))
+			if err := os.WriteFile(iter.ImagePath, data, 0644); err != nil {
+				return fmt.Errorf("failed to write image: %w", err)
+			}
+		}
+
+		if err := store.CreateIteration(ctx, iter); err != nil {
+			return fmt.Errorf("failed to create iteration: %w", err)
+		}
+	}
+
+	sess.CurrentIterationID = ids[manifest.Session.CurrentIterationID]
+	if err := store.UpdateSession(ctx, sess); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	return data, nil
+}
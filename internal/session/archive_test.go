@@ -0,0 +1,197 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// seedArchiveSession creates a session with a generate and an edit
+// iteration, whose images live in a temporary directory.
+func seedArchiveSession(t *testing.T, store *Store) (*Session, []*Iteration) {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+	created := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	sess := &Session{ID: "orig-session", Name: "logo ideas", CreatedAt: created, UpdatedAt: created, Model: "gpt-image-1"}
+	if err := store.CreateSession(ctx, sess); err != nil {
+		t.Fatal(err)
+	}
+
+	iters := []*Iteration{
+		{
+			ID: "iter-1", SessionID: sess.ID, Operation: "generate", Prompt: "a fox logo",
+			RevisedPrompt: "a minimalist fox logo", Model: "gpt-image-1",
+			ImagePath: filepath.Join(dir, "iter-1.png"), Timestamp: created.Add(time.Minute),
+			Metadata:    IterationMetadata{Size: "1024x1024", Quality: "high", Cost: 0.167, Provider: "openai"},
+			BranchPoint: true,
+		},
+		{
+			ID: "iter-2", SessionID: sess.ID, ParentID: "iter-1", Operation: "edit", Prompt: "make it orange",
+			Model: "gpt-image-1", ImagePath: filepath.Join(dir, "iter-2.png"), Timestamp: created.Add(2 * time.Minute),
+			Metadata: IterationMetadata{Size: "1024x1024", Quality: "high", Cost: 0.167, Provider: "openai"},
+		},
+	}
+	for i, iter := range iters {
+		if err := os.WriteFile(iter.ImagePath, []byte{byte(i), 'p', 'n', 'g'}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CreateIteration(ctx, iter); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sess.CurrentIterationID = "iter-2"
+	if err := store.UpdateSession(ctx, sess); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddTag(ctx, sess.ID, "client-a"); err != nil {
+		t.Fatal(err)
+	}
+	sess.Tags = []string{"client-a"}
+	return sess, iters
+}
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store, cleanup := testStore(t)
+	defer cleanup()
+	ctx := context.Background()
+	orig, origIters := seedArchiveSession(t, store)
+
+	var buf bytes.Buffer
+	manifest, err := Export(ctx, store, orig.ID, &buf)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if len(manifest.Iterations) != 2 || manifest.Iterations[0].ImageMissing {
+		t.Fatalf("manifest iterations = %+v", manifest.Iterations)
+	}
+
+	sess, _, err := Import(ctx, store, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if sess.ID == orig.ID {
+		t.Error("imported session should get a new ID")
+	}
+
+	got, err := store.GetSession(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if got.Name != orig.Name || got.Model != orig.Model || !got.CreatedAt.Equal(orig.CreatedAt) {
+		t.Errorf("imported session = %+v, want name, model, and created time of %+v", got, orig)
+	}
+	if !slices.Equal(got.Tags, orig.Tags) {
+		t.Errorf("imported tags = %v, want %v", got.Tags, orig.Tags)
+	}
+
+	iters, err := store.ListIterations(ctx, sess.ID)
+	if err != nil {
+		t.Fatalf("ListIterations() error = %v", err)
+	}
+	if len(iters) != 2 {
+		t.Fatalf("imported %d iterations, want 2", len(iters))
+	}
+	if got.CurrentIterationID != iters[1].ID {
+		t.Errorf("CurrentIterationID = %q, want the second iteration %q", got.CurrentIterationID, iters[1].ID)
+	}
+	if iters[0].ParentID != "" || iters[1].ParentID != iters[0].ID {
+		t.Errorf("parent IDs = %q, %q; want the new ID of the first iteration", iters[0].ParentID, iters[1].ParentID)
+	}
+	if !iters[0].BranchPoint || iters[1].BranchPoint {
+		t.Errorf("branch points = %v, %v; want only the first iteration's kept", iters[0].BranchPoint, iters[1].BranchPoint)
+	}
+
+	imageDir, _ := ImageDir(sess.ID)
+	for i, iter := range iters {
+		want := origIters[i]
+		if iter.ID == want.ID {
+			t.Errorf("iteration %d kept its original ID", i)
+		}
+		if iter.Prompt != want.Prompt || iter.RevisedPrompt != want.RevisedPrompt || iter.Operation != want.Operation ||
+			iter.Metadata != want.Metadata || !iter.Timestamp.Equal(want.Timestamp) {
+			t.Errorf("iteration %d = %+v, want %+v", i, iter, want)
+		}
+		if filepath.Dir(iter.ImagePath) != imageDir {
+			t.Errorf("iteration %d image = %s, want it under %s", i, iter.ImagePath, imageDir)
+		}
+		data, err := os.ReadFile(iter.ImagePath)
+		if err != nil {
+			t.Fatalf("imported image: %v", err)
+		}
+		wantData, _ := os.ReadFile(want.ImagePath)
+		if !bytes.Equal(data, wantData) {
+			t.Errorf("iteration %d image = %q, want %q", i, data, wantData)
+		}
+	}
+}
+
+func TestExport_MissingImage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store, cleanup := testStore(t)
+	defer cleanup()
+	ctx := context.Background()
+	orig, origIters := seedArchiveSession(t, store)
+	if err := os.Remove(origIters[0].ImagePath); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	manifest, err := Export(ctx, store, orig.ID, &buf)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if !manifest.Iterations[0].ImageMissing || manifest.Iterations[0].Image != "" {
+		t.Errorf("first iteration = %+v, want it recorded as missing", manifest.Iterations[0])
+	}
+	if manifest.Iterations[1].ImageMissing {
+		t.Errorf("second iteration = %+v, want its image exported", manifest.Iterations[1])
+	}
+
+	sess, _, err := Import(ctx, store, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	iters, err := store.ListIterations(ctx, sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(iters) != 2 || iters[0].ImagePath != "" || iters[1].ImagePath == "" {
+		t.Errorf("imported iterations = %+v, want only the second with an image", iters)
+	}
+}
+
+func TestExport_UnknownSession(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+
+	_, err := Export(context.Background(), store, "nope", &bytes.Buffer{})
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Export() error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestImport_InvalidArchive(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store, cleanup := testStore(t)
+	defer cleanup()
+
+	data := []byte("not a zip")
+	_, _, err := Import(context.Background(), store, bytes.NewReader(data), int64(len(data)))
+	if !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("Import() error = %v, want ErrInvalidArchive", err)
+	}
+
+	sessions, _ := store.ListSessions(context.Background())
+	if len(sessions) != 0 {
+		t.Errorf("failed import left %d session(s)", len(sessions))
+	}
+}
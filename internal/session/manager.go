@@ -16,6 +16,9 @@ var (
 	ErrNothingToUndo   = errors.New("nothing to undo")
 	ErrAtFirstImage    = errors.New("already at first image")
 	ErrSessionNotFound = errors.New("session not found")
+	ErrInvalidTag      = errors.New("invalid tag")
+
+	ErrIterationNotFound = errors.New("iteration not found")
 )
 
 type Manager struct {
@@ -94,6 +97,19 @@ func (m *Manager) Load(ctx context.Context, id string) error {
 	return nil
 }
 
+// LoadLatest loads the most recently updated session, with its current
+// iteration, and reports whether there was one to load.
+func (m *Manager) LoadLatest(ctx context.Context) (bool, error) {
+	sessions, err := m.store.ListSessions(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(sessions) == 0 {
+		return false, nil
+	}
+	return true, m.Load(ctx, sessions[0].ID)
+}
+
 func (m *Manager) EnsureSession(ctx context.Context) error {
 	if m.current == nil {
 		_, err := m.StartNew(ctx, "")
@@ -143,14 +159,60 @@ func (m *Manager) Undo(ctx context.Context) (*Iteration, error) {
 		return nil, fmt.Errorf("failed to get parent iteration: %w", err)
 	}
 
-	m.current.CurrentIterationID = parent.ID
+	if err := m.moveTo(ctx, parent); err != nil {
+		return nil, err
+	}
+	return parent, nil
+}
+
+// Branch marks iteration id of the current session, or the current
+// iteration when id is empty, as a branch point and makes it current, so
+// the next generation or edit starts an alternate line from it. Lines
+// already made from it are kept.
+func (m *Manager) Branch(ctx context.Context, id string) (*Iteration, error) {
+	if m.current == nil {
+		return nil, ErrNoSession
+	}
+	iter := m.currentIter
+	if id != "" {
+		var err error
+		iter, err = m.store.GetIteration(ctx, id)
+		if err != nil || iter.SessionID != m.current.ID {
+			return nil, fmt.Errorf("%w: %s", ErrIterationNotFound, id)
+		}
+	}
+	if iter == nil {
+		return nil, ErrNoIteration
+	}
+
+	if err := m.store.SetBranchPoint(ctx, iter.ID, true); err != nil {
+		return nil, err
+	}
+	iter.BranchPoint = true
+	if err := m.moveTo(ctx, iter); err != nil {
+		return nil, err
+	}
+	return iter, nil
+}
+
+// moveTo makes iter the current iteration of the session.
+func (m *Manager) moveTo(ctx context.Context, iter *Iteration) error {
+	m.current.CurrentIterationID = iter.ID
 	m.current.UpdatedAt = time.Now()
 	if err := m.store.UpdateSession(ctx, m.current); err != nil {
-		return nil, fmt.Errorf("failed to update session: %w", err)
+		return fmt.Errorf("failed to update session: %w", err)
 	}
+	m.currentIter = iter
+	return nil
+}
 
-	m.currentIter = parent
-	return parent, nil
+// Children returns the iterations made from the current iteration, oldest
+// first.
+func (m *Manager) Children(ctx context.Context) ([]*Iteration, error) {
+	if m.currentIter == nil {
+		return nil, ErrNoIteration
+	}
+	return m.store.ListChildren(ctx, m.currentIter.ID)
 }
 
 func (m *Manager) History(ctx context.Context) ([]*Iteration, error) {
@@ -160,6 +222,12 @@ func (m *Manager) History(ctx context.Context) ([]*Iteration, error) {
 	return m.store.ListIterations(ctx, m.current.ID)
 }
 
+// SearchIterations returns iterations from every session whose prompt
+// contains text, most recent first.
+func (m *Manager) SearchIterations(ctx context.Context, text string) ([]*Iteration, error) {
+	return m.store.SearchIterations(ctx, text)
+}
+
 func (m *Manager) ListSessions(ctx context.Context) ([]*Session, error) {
 	return m.store.ListSessions(ctx)
 }
@@ -181,6 +249,34 @@ func (m *Manager) RenameSession(ctx context.Context, name string) error {
 	return m.store.UpdateSession(ctx, m.current)
 }
 
+// TagSession adds tag to the current session.
+func (m *Manager) TagSession(ctx context.Context, tag string) error {
+	if m.current == nil {
+		return ErrNoSession
+	}
+	if err := m.store.AddTag(ctx, m.current.ID, tag); err != nil {
+		return err
+	}
+	return m.reloadTags(ctx)
+}
+
+// UntagSession removes tag from the current session, reporting whether the
+// session had it.
+func (m *Manager) UntagSession(ctx context.Context, tag string) (bool, error) {
+	if m.current == nil {
+		return false, ErrNoSession
+	}
+	removed, err := m.store.RemoveTag(ctx, m.current.ID, tag)
+	if err != nil {
+		return false, err
+	}
+	return removed, m.reloadTags(ctx)
+}
+
+func (m *Manager) reloadTags(ctx context.Context) error {
+	return m.store.loadTags(ctx, []*Session{m.current})
+}
+
 func (m *Manager) SetModel(model string) {
 	m.defaultModel = model
 	if m.current != nil {
@@ -2,8 +2,10 @@ package session
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -201,6 +203,81 @@ func TestManager_Undo_NoIteration(t *testing.T) {
 	}
 }
 
+func TestManager_Branch(t *testing.T) {
+	mgr, _, cleanup := testManager(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	if _, err := mgr.Branch(ctx, ""); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Branch() without session error = %v, want ErrNoSession", err)
+	}
+
+	add := func(op, prompt string) *Iteration {
+		t.Helper()
+		iter := &Iteration{Operation: op, Prompt: prompt, Model: "gpt-image-1", ImagePath: "/test/" + prompt + ".png"}
+		if err := mgr.AddIteration(ctx, iter); err != nil {
+			t.Fatalf("AddIteration() error = %v", err)
+		}
+		return iter
+	}
+	fox := add("generate", "fox")
+	red := add("edit", "red")
+	add("edit", "hat")
+
+	// Branch from an earlier iteration and start an alternate line there.
+	point, err := mgr.Branch(ctx, red.ID)
+	if err != nil {
+		t.Fatalf("Branch() error = %v", err)
+	}
+	if point.ID != red.ID || !point.BranchPoint || mgr.CurrentIteration().ID != red.ID {
+		t.Errorf("Branch() = %s (branch point %v), current %s; want %s", point.ID, point.BranchPoint, mgr.CurrentIteration().ID, red.ID)
+	}
+	scarf := add("edit", "scarf")
+	if scarf.ParentID != red.ID {
+		t.Errorf("edit after Branch() has parent %s, want %s", scarf.ParentID, red.ID)
+	}
+
+	if _, err := mgr.Undo(ctx); err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	children, err := mgr.Children(ctx)
+	if err != nil {
+		t.Fatalf("Children() error = %v", err)
+	}
+	var prompts []string
+	for _, child := range children {
+		prompts = append(prompts, child.Prompt)
+	}
+	if !slices.Equal(prompts, []string{"hat", "scarf"}) {
+		t.Errorf("Children() after Undo() = %v, want both lines kept", prompts)
+	}
+
+	// Reloading keeps the branch point.
+	if err := mgr.Load(ctx, mgr.Current().ID); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !mgr.CurrentIteration().BranchPoint {
+		t.Error("branch point not kept after Load()")
+	}
+
+	// Branch with no id marks the current iteration.
+	mgr.Undo(ctx)
+	if point, err := mgr.Branch(ctx, ""); err != nil || point.ID != fox.ID || !point.BranchPoint {
+		t.Errorf("Branch(\"\") = %v, %v; want the current iteration marked", point, err)
+	}
+
+	if _, err := mgr.Branch(ctx, "missing"); !errors.Is(err, ErrIterationNotFound) {
+		t.Errorf("Branch(missing) error = %v, want ErrIterationNotFound", err)
+	}
+	mgr.StartNew(ctx, "other")
+	if _, err := mgr.Branch(ctx, red.ID); !errors.Is(err, ErrIterationNotFound) {
+		t.Errorf("Branch() into another session error = %v, want ErrIterationNotFound", err)
+	}
+	if _, err := mgr.Branch(ctx, ""); !errors.Is(err, ErrNoIteration) {
+		t.Errorf("Branch() in empty session error = %v, want ErrNoIteration", err)
+	}
+}
+
 func TestManager_History(t *testing.T) {
 	mgr, _, cleanup := testManager(t)
 	defer cleanup()
@@ -0,0 +1,167 @@
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// A migration moves a database from the schema of one release to the next.
+// Each runs at most once per database, in its own transaction, and the
+// schema_version table records which have been applied.
+//
+// Databases created before schema_version existed start at version 0 with
+// any number of these changes already made, so every migration checks the
+// current shape before altering it. The schema constant creates fresh
+// databases at the latest shape, where the migrations have nothing to do.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations are applied in order. Append new ones with the next version;
+// never reorder or edit one that has shipped.
+var migrations = []migration{
+	{1, "make cost log iteration and session ids nullable", nullableCostLogIDs},
+	{2, "record cache hits in the cost log", addColumn("cost_log", "cache_hit", "INTEGER NOT NULL DEFAULT 0")},
+	{3, "mark branch point iterations", addColumn("iterations", "branch_point", "INTEGER NOT NULL DEFAULT 0")},
+}
+
+const schemaVersionTable = `
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at DATETIME NOT NULL
+)`
+
+// migrate applies the migrations db has not had yet.
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(schemaVersionTable); err != nil {
+		return fmt.Errorf("failed to create schema_version: %w", err)
+	}
+	for _, m := range migrations {
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs m unless db is already at or past its version. The
+// version is checked again inside the transaction so that two processes
+// opening the same database apply m once.
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current sql.NullInt64
+	if err := tx.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&current); err != nil {
+		return err
+	}
+	if int(current.Int64) >= m.version {
+		return nil
+	}
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.version, m.name, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// querier is the part of *sql.DB and *sql.Tx the migrations use.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// nullableCostLogIDs rebuilds a cost log whose iteration_id is NOT NULL, so
+// CLI mode can log costs without a session.
+func nullableCostLogIDs(tx *sql.Tx) error {
+	notNull, err := columnNotNull(tx, "cost_log", "iteration_id")
+	if err != nil || !notNull {
+		return err
+	}
+	for _, stmt := range []string{
+		`DROP TABLE IF EXISTS cost_log_new`,
+		`CREATE TABLE cost_log_new (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			iteration_id TEXT,
+			session_id TEXT,
+			provider TEXT NOT NULL,
+			model TEXT NOT NULL,
+			cost REAL NOT NULL,
+			image_count INTEGER NOT NULL DEFAULT 1,
+			timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (iteration_id) REFERENCES iterations(id) ON DELETE CASCADE,
+			FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+		)`,
+		`INSERT INTO cost_log_new (id, iteration_id, session_id, provider, model, cost, image_count, timestamp)
+			SELECT id, iteration_id, session_id, provider, model, cost, image_count, timestamp FROM cost_log`,
+		`DROP TABLE cost_log`,
+		`ALTER TABLE cost_log_new RENAME TO cost_log`,
+		`CREATE INDEX IF NOT EXISTS idx_cost_log_timestamp ON cost_log(timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_cost_log_provider ON cost_log(provider)`,
+		`CREATE INDEX IF NOT EXISTS idx_cost_log_session_id ON cost_log(session_id)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumn returns a migration that adds column to table unless it is
+// already there.
+func addColumn(table, column, definition string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		if hasColumn(tx, table, column) {
+			return nil
+		}
+		_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+		return err
+	}
+}
+
+// hasColumn reports whether table has a column with the given name.
+func hasColumn(q querier, table, column string) bool {
+	_, ok, _ := columnInfo(q, table, column)
+	return ok
+}
+
+// columnNotNull reports whether table has a NOT NULL column with the given
+// name.
+func columnNotNull(q querier, table, column string) (bool, error) {
+	notNull, _, err := columnInfo(q, table, column)
+	return notNull, err
+}
+
+// columnInfo looks column up in table, reporting whether it is NOT NULL and
+// whether it exists at all.
+func columnInfo(q querier, table, column string) (notNull, ok bool, err error) {
+	rows, err := q.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return false, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid int
+		var name, typ string
+		var nn, pk int
+		var dflt interface{}
+		if err := rows.Scan(&cid, &name, &typ, &nn, &dflt, &pk); err != nil {
+			return false, false, err
+		}
+		if name == column {
+			return nn == 1, true, nil
+		}
+	}
+	return false, false, rows.Err()
+}
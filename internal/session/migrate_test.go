@@ -0,0 +1,155 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// openFixture writes the schema and rows in testdata/name to a new database
+// and returns its path.
+func openFixture(t *testing.T, name string) string {
+	t.Helper()
+	script, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(t.TempDir(), "sessions.db")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(string(script)); err != nil {
+		t.Fatalf("loading %s: %v", name, err)
+	}
+	return dbPath
+}
+
+func appliedVersions(t *testing.T, store *Store) []int {
+	t.Helper()
+	rows, err := store.db.Query(`SELECT version FROM schema_version ORDER BY version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var versions []int
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+func TestMigrate_OldDatabase(t *testing.T) {
+	dbPath := openFixture(t, "v0_schema.sql")
+
+	store, err := NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatalf("NewStoreWithPath() error = %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	if v, err := store.SchemaVersion(ctx); err != nil || v != migrations[len(migrations)-1].version {
+		t.Fatalf("SchemaVersion() = %d, %v; want %d", v, err, migrations[len(migrations)-1].version)
+	}
+	for _, c := range []struct{ table, column string }{
+		{"cost_log", "cache_hit"}, {"iterations", "branch_point"},
+	} {
+		if !hasColumn(store.db, c.table, c.column) {
+			t.Errorf("%s.%s missing after migration", c.table, c.column)
+		}
+	}
+	if notNull, err := columnNotNull(store.db, "cost_log", "iteration_id"); err != nil || notNull {
+		t.Errorf("cost_log.iteration_id NOT NULL = %v, %v; want nullable", notNull, err)
+	}
+
+	// The old rows survive.
+	sess, err := store.GetSession(ctx, "old")
+	if err != nil || sess.Name != "fox" || sess.CurrentIterationID != "second" {
+		t.Fatalf("GetSession() = %+v, %v; want the old session", sess, err)
+	}
+	iterations, err := store.ListIterations(ctx, "old")
+	if err != nil || len(iterations) != 2 || iterations[1].ParentID != "first" {
+		t.Fatalf("ListIterations() = %d, %v; want both old iterations", len(iterations), err)
+	}
+	summary, err := store.GetTotalCost(ctx)
+	if err != nil || summary.EntryCount != 2 || !floatEquals(summary.TotalCost, 0.08) {
+		t.Errorf("GetTotalCost() = %+v, %v; want the two old entries", summary, err)
+	}
+
+	// And the new features work against them.
+	if err := store.LogCost(ctx, &CostEntry{Provider: "openai", Model: "dall-e-3", Cost: 0.04, ImageCount: 1, CacheHit: true}); err != nil {
+		t.Errorf("LogCost() without a session error = %v", err)
+	}
+	if err := store.SetBranchPoint(ctx, "first", true); err != nil {
+		t.Errorf("SetBranchPoint() error = %v", err)
+	}
+	if err := store.AddTag(ctx, "old", "animals"); err != nil {
+		t.Errorf("AddTag() error = %v", err)
+	}
+}
+
+func TestMigrate_Idempotent(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		dbPath func(t *testing.T) string
+	}{
+		{"fresh", func(t *testing.T) string { return filepath.Join(t.TempDir(), "new.db") }},
+		{"old", func(t *testing.T) string { return openFixture(t, "v0_schema.sql") }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dbPath := tt.dbPath(t)
+			for range 3 {
+				store, err := NewStoreWithPath(dbPath)
+				if err != nil {
+					t.Fatalf("NewStoreWithPath() error = %v", err)
+				}
+				got := appliedVersions(t, store)
+				store.Close()
+				if len(got) != len(migrations) || got[len(got)-1] != migrations[len(migrations)-1].version {
+					t.Fatalf("applied versions = %v, want each of %d once", got, len(migrations))
+				}
+			}
+		})
+	}
+}
+
+func TestMigrate_FailureRollsBack(t *testing.T) {
+	saved := migrations
+	defer func() { migrations = saved }()
+	latest := saved[len(saved)-1].version
+	next := latest + 1
+	migrations = append(slices.Clone(saved), migration{next, "half done", func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`ALTER TABLE sessions ADD COLUMN half_done TEXT`); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	}})
+
+	dbPath := filepath.Join(t.TempDir(), "sessions.db")
+	if _, err := NewStoreWithPath(dbPath); err == nil {
+		t.Fatal("NewStoreWithPath() error = nil, want the failed migration")
+	}
+
+	migrations = saved
+	store, err := NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatalf("NewStoreWithPath() error = %v", err)
+	}
+	defer store.Close()
+	if hasColumn(store.db, "sessions", "half_done") {
+		t.Error("failed migration's change was kept")
+	}
+	if v, _ := store.SchemaVersion(context.Background()); v != latest {
+		t.Errorf("SchemaVersion() = %d, want %d", v, latest)
+	}
+}
@@ -12,6 +12,7 @@ type Session struct {
 	UpdatedAt          time.Time
 	CurrentIterationID string
 	Model              string
+	Tags               []string
 }
 
 type Iteration struct {
@@ -25,6 +26,9 @@ type Iteration struct {
 	ImagePath     string
 	Timestamp     time.Time
 	Metadata      IterationMetadata
+	// BranchPoint marks an iteration the user chose to start alternate
+	// lines of edits from.
+	BranchPoint bool
 }
 
 type IterationMetadata struct {
@@ -34,6 +38,9 @@ type IterationMetadata struct {
 	Transparent bool    `json:"transparent,omitempty"`
 	Cost        float64 `json:"cost,omitempty"`
 	Provider    string  `json:"provider,omitempty"`
+	// ModelUsed is the model the API reported using, when it differs from
+	// the iteration's requested Model.
+	ModelUsed string `json:"model_used,omitempty"`
 }
 
 func (m *IterationMetadata) ToJSON() string {
@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -32,6 +35,7 @@ CREATE TABLE IF NOT EXISTS iterations (
     image_path TEXT NOT NULL,
     timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     metadata_json TEXT,
+    branch_point INTEGER NOT NULL DEFAULT 0,
     FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
 );
 
@@ -44,16 +48,27 @@ CREATE TABLE IF NOT EXISTS cost_log (
     cost REAL NOT NULL,
     image_count INTEGER NOT NULL DEFAULT 1,
     timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    cache_hit INTEGER NOT NULL DEFAULT 0,
     FOREIGN KEY (iteration_id) REFERENCES iterations(id) ON DELETE CASCADE,
     FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
 );
 
+-- Tags live in their own table so databases from before tagging only gain
+-- a table when opened.
+CREATE TABLE IF NOT EXISTS session_tags (
+    session_id TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (session_id, tag),
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
 CREATE INDEX IF NOT EXISTS idx_iterations_session_id ON iterations(session_id);
 CREATE INDEX IF NOT EXISTS idx_iterations_parent_id ON iterations(parent_id);
 CREATE INDEX IF NOT EXISTS idx_sessions_updated_at ON sessions(updated_at);
 CREATE INDEX IF NOT EXISTS idx_cost_log_timestamp ON cost_log(timestamp);
 CREATE INDEX IF NOT EXISTS idx_cost_log_provider ON cost_log(provider);
 CREATE INDEX IF NOT EXISTS idx_cost_log_session_id ON cost_log(session_id);
+CREATE INDEX IF NOT EXISTS idx_session_tags_tag ON session_tags(tag);
 `
 
 type Store struct {
@@ -83,54 +98,19 @@ func NewStoreWithPath(dbPath string) (*Store, error) {
 		return nil, fmt.Errorf("failed to create schema: %w", err)
 	}
 
-	// Migration: make iteration_id and session_id nullable in cost_log
-	// This allows CLI mode to log costs without sessions
-	needsMigration := func() bool {
-		rows, err := db.Query("PRAGMA table_info(cost_log)")
-		if err != nil {
-			return false
-		}
-		defer rows.Close()
-		for rows.Next() {
-			var cid int
-			var name, typ string
-			var notNull, pk int
-			var dflt interface{}
-			if rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk) == nil {
-				if name == "iteration_id" && notNull == 1 {
-					return true
-				}
-			}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	// Earlier releases wrote timestamps in local time and may still share
+	// the database, so these are rewritten as UTC on every open rather than
+	// by a one-off migration.
+	for _, c := range timestampColumns {
+		if err := normalizeTimestamps(db, c.table, c.column); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to migrate %s.%s to UTC: %w", c.table, c.column, err)
 		}
-		return false
-	}()
-
-	if needsMigration {
-		// Clean up any interrupted migration
-		db.Exec("DROP TABLE IF EXISTS cost_log_new")
-		// Create new table with nullable columns
-		db.Exec(`
-			CREATE TABLE cost_log_new (
-				id INTEGER PRIMARY KEY AUTOINCREMENT,
-				iteration_id TEXT,
-				session_id TEXT,
-				provider TEXT NOT NULL,
-				model TEXT NOT NULL,
-				cost REAL NOT NULL,
-				image_count INTEGER NOT NULL DEFAULT 1,
-				timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-				FOREIGN KEY (iteration_id) REFERENCES iterations(id) ON DELETE CASCADE,
-				FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
-			)`)
-		// Copy existing data
-		db.Exec(`INSERT INTO cost_log_new SELECT * FROM cost_log`)
-		// Drop old table and rename new one
-		db.Exec(`DROP TABLE cost_log`)
-		db.Exec(`ALTER TABLE cost_log_new RENAME TO cost_log`)
-		// Recreate indexes
-		db.Exec(`CREATE INDEX IF NOT EXISTS idx_cost_log_timestamp ON cost_log(timestamp)`)
-		db.Exec(`CREATE INDEX IF NOT EXISTS idx_cost_log_provider ON cost_log(provider)`)
-		db.Exec(`CREATE INDEX IF NOT EXISTS idx_cost_log_session_id ON cost_log(session_id)`)
 	}
 
 	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
@@ -141,6 +121,72 @@ func NewStoreWithPath(dbPath string) (*Store, error) {
 	return &Store{db: db}, nil
 }
 
+// OpenReadOnly opens the database at dbPath without creating, migrating,
+// or otherwise writing to it, for commands that only inspect it. Methods
+// that write fail on the returned Store.
+func OpenReadOnly(dbPath string) (*Store, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	dsn := (&url.URL{Scheme: "file", Path: dbPath, RawQuery: "mode=ro"}).String()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// timestampColumns are the DATETIME columns of the schema. The driver stores
+// times as text and SQLite compares them as strings, which only orders them
+// chronologically when they share an offset, so every timestamp is written
+// in UTC and converted to a display zone when read.
+var timestampColumns = []struct{ table, column string }{
+	{"sessions", "created_at"},
+	{"sessions", "updated_at"},
+	{"iterations", "timestamp"},
+	{"cost_log", "timestamp"},
+}
+
+// utcSuffix ends every time the driver writes for a UTC time.Time.
+const utcSuffix = " +0000 UTC"
+
+// normalizeTimestamps rewrites the values of column in table that were not
+// stored in UTC, such as those written by earlier versions in local time.
+func normalizeTimestamps(db *sql.DB, table, column string) error {
+	rows, err := db.Query(fmt.Sprintf(`SELECT rowid, %s FROM %s WHERE %s NOT LIKE '%%%s'`, column, table, column, utcSuffix))
+	if err != nil {
+		return err
+	}
+	type fix struct {
+		rowid int64
+		ts    time.Time
+	}
+	var fixes []fix
+	for rows.Next() {
+		var f fix
+		if err := rows.Scan(&f.rowid, &f.ts); err != nil {
+			rows.Close()
+			return err
+		}
+		fixes = append(fixes, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, f := range fixes {
+		if _, err := db.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE rowid = ?`, table, column), f.ts.UTC(), f.rowid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func defaultDBPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -153,11 +199,54 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
+// SchemaVersion returns the latest migration applied to the database.
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	var version sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// Vacuum rebuilds the database file, returning the space left by deleted
+// rows to the filesystem.
+func (s *Store) Vacuum(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
+
+// IntegrityCheck runs SQLite's integrity check and returns the problems it
+// reports, or nil if the database is sound.
+func (s *Store) IntegrityCheck(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "PRAGMA integrity_check")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return nil, fmt.Errorf("failed to scan integrity check: %w", err)
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	return problems, nil
+}
+
 func (s *Store) CreateSession(ctx context.Context, sess *Session) error {
 	_, err := s.db.ExecContext(ctx,
 		`INSERT INTO sessions (id, name, created_at, updated_at, current_iteration_id, model)
 		 VALUES (?, ?, ?, ?, ?, ?)`,
-		sess.ID, sess.Name, sess.CreatedAt, sess.UpdatedAt, sess.CurrentIterationID, sess.Model)
+		sess.ID, sess.Name, sess.CreatedAt.UTC(), sess.UpdatedAt.UTC(), sess.CurrentIterationID, sess.Model)
 	return err
 }
 
@@ -175,6 +264,9 @@ func (s *Store) GetSession(ctx context.Context, id string) (*Session, error) {
 	}
 	sess.Name = name.String
 	sess.CurrentIterationID = currentIterID.String
+	if err := s.loadTags(ctx, []*Session{sess}); err != nil {
+		return nil, err
+	}
 	return sess, nil
 }
 
@@ -182,7 +274,7 @@ func (s *Store) UpdateSession(ctx context.Context, sess *Session) error {
 	_, err := s.db.ExecContext(ctx,
 		`UPDATE sessions SET name = ?, updated_at = ?, current_iteration_id = ?, model = ?
 		 WHERE id = ?`,
-		sess.Name, sess.UpdatedAt, sess.CurrentIterationID, sess.Model, sess.ID)
+		sess.Name, sess.UpdatedAt.UTC(), sess.CurrentIterationID, sess.Model, sess.ID)
 	return err
 }
 
@@ -198,6 +290,26 @@ func (s *Store) ListSessions(ctx context.Context) ([]*Session, error) {
 	if err != nil {
 		return nil, err
 	}
+	return s.scanSessions(ctx, rows)
+}
+
+// ListByTag returns the sessions tagged tag, most recently updated first.
+func (s *Store) ListByTag(ctx context.Context, tag string) ([]*Session, error) {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT s.id, s.name, s.created_at, s.updated_at, s.current_iteration_id, s.model
+		 FROM sessions s JOIN session_tags t ON t.session_id = s.id
+		 WHERE t.tag = ? ORDER BY s.updated_at DESC`, tag)
+	if err != nil {
+		return nil, err
+	}
+	return s.scanSessions(ctx, rows)
+}
+
+func (s *Store) scanSessions(ctx context.Context, rows *sql.Rows) ([]*Session, error) {
 	defer rows.Close()
 
 	var sessions []*Session
@@ -212,27 +324,107 @@ func (s *Store) ListSessions(ctx context.Context) ([]*Session, error) {
 		sess.CurrentIterationID = currentIterID.String
 		sessions = append(sessions, sess)
 	}
-	return sessions, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := s.loadTags(ctx, sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// NormalizeTag lower-cases tag and trims surrounding space. Tags may not be
+// empty or contain spaces or commas.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || strings.ContainsAny(tag, " \t\n,") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+	}
+	return tag, nil
+}
+
+// AddTag tags session id with tag. Adding a tag the session already has is
+// not an error.
+func (s *Store) AddTag(ctx context.Context, id, tag string) error {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
+	var exists int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sessions WHERE id = ?`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO session_tags (session_id, tag) VALUES (?, ?)`, id, tag)
+	return err
+}
+
+// RemoveTag removes tag from session id, reporting whether it was there.
+func (s *Store) RemoveTag(ctx context.Context, id, tag string) (bool, error) {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return false, err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM session_tags WHERE session_id = ? AND tag = ?`, id, tag)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// loadTags fills in the Tags of sessions, sorted.
+func (s *Store) loadTags(ctx context.Context, sessions []*Session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	byID := make(map[string]*Session, len(sessions))
+	for _, sess := range sessions {
+		sess.Tags = nil
+		byID[sess.ID] = sess
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT session_id, tag FROM session_tags ORDER BY tag`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		if sess, ok := byID[id]; ok {
+			sess.Tags = append(sess.Tags, tag)
+		}
+	}
+	return rows.Err()
 }
 
 func (s *Store) CreateIteration(ctx context.Context, iter *Iteration) error {
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO iterations (id, session_id, parent_id, operation, prompt, revised_prompt, model, image_path, timestamp, metadata_json)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		`INSERT INTO iterations (id, session_id, parent_id, operation, prompt, revised_prompt, model, image_path, timestamp, metadata_json, branch_point)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		iter.ID, iter.SessionID, nullString(iter.ParentID), iter.Operation, iter.Prompt,
-		nullString(iter.RevisedPrompt), iter.Model, iter.ImagePath, iter.Timestamp, iter.Metadata.ToJSON())
+		nullString(iter.RevisedPrompt), iter.Model, iter.ImagePath, iter.Timestamp.UTC(), iter.Metadata.ToJSON(), iter.BranchPoint)
 	return err
 }
 
 func (s *Store) GetIteration(ctx context.Context, id string) (*Iteration, error) {
 	row := s.db.QueryRowContext(ctx,
-		`SELECT id, session_id, parent_id, operation, prompt, revised_prompt, model, image_path, timestamp, metadata_json
+		`SELECT id, session_id, parent_id, operation, prompt, revised_prompt, model, image_path, timestamp, metadata_json, branch_point
 		 FROM iterations WHERE id = ?`, id)
 
 	iter := &Iteration{}
 	var parentID, revisedPrompt, metadataJSON sql.NullString
 	err := row.Scan(&iter.ID, &iter.SessionID, &parentID, &iter.Operation, &iter.Prompt,
-		&revisedPrompt, &iter.Model, &iter.ImagePath, &iter.Timestamp, &metadataJSON)
+		&revisedPrompt, &iter.Model, &iter.ImagePath, &iter.Timestamp, &metadataJSON, &iter.BranchPoint)
 	if err != nil {
 		return nil, err
 	}
@@ -244,11 +436,118 @@ func (s *Store) GetIteration(ctx context.Context, id string) (*Iteration, error)
 
 func (s *Store) ListIterations(ctx context.Context, sessionID string) ([]*Iteration, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, session_id, parent_id, operation, prompt, revised_prompt, model, image_path, timestamp, metadata_json
+		`SELECT id, session_id, parent_id, operation, prompt, revised_prompt, model, image_path, timestamp, metadata_json, branch_point
 		 FROM iterations WHERE session_id = ? ORDER BY timestamp ASC`, sessionID)
 	if err != nil {
 		return nil, err
 	}
+	return scanIterations(rows)
+}
+
+// ListChildren returns the iterations made from iteration id, oldest
+// first. More than one child means the session branched there.
+func (s *Store) ListChildren(ctx context.Context, id string) ([]*Iteration, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, session_id, parent_id, operation, prompt, revised_prompt, model, image_path, timestamp, metadata_json, branch_point
+		 FROM iterations WHERE parent_id = ? ORDER BY timestamp ASC`, id)
+	if err != nil {
+		return nil, err
+	}
+	return scanIterations(rows)
+}
+
+// SetBranchPoint marks or unmarks iteration id as a branch point.
+func (s *Store) SetBranchPoint(ctx context.Context, id string, branch bool) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE iterations SET branch_point = ? WHERE id = ?`, branch, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrIterationNotFound, id)
+	}
+	return nil
+}
+
+// ListAllIterations returns the iterations of every session, oldest first.
+func (s *Store) ListAllIterations(ctx context.Context) ([]*Iteration, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, session_id, parent_id, operation, prompt, revised_prompt, model, image_path, timestamp, metadata_json, branch_point
+		 FROM iterations ORDER BY timestamp ASC`)
+	if err != nil {
+		return nil, err
+	}
+	return scanIterations(rows)
+}
+
+// SearchIterations returns the iterations of every session whose prompt or
+// revised prompt contains text, ignoring case, most recent first.
+func (s *Store) SearchIterations(ctx context.Context, text string) ([]*Iteration, error) {
+	pattern := "%" + likeEscaper.Replace(text) + "%"
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, session_id, parent_id, operation, prompt, revised_prompt, model, image_path, timestamp, metadata_json, branch_point
+		 FROM iterations
+		 WHERE prompt LIKE ? ESCAPE '\' OR revised_prompt LIKE ? ESCAPE '\'
+		 ORDER BY timestamp DESC`, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return scanIterations(rows)
+}
+
+// likeEscaper makes LIKE treat its wildcards literally in a search term.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Snippet returns about width characters of iter's prompt around the first
+// match of text, falling back to the revised prompt when only it matches.
+// Cut ends are marked with "...".
+func Snippet(iter *Iteration, text string, width int) string {
+	for _, prompt := range []string{iter.Prompt, iter.RevisedPrompt} {
+		if snippet, ok := snippetAround(prompt, text, width); ok {
+			return snippet
+		}
+	}
+	return iter.Prompt
+}
+
+func snippetAround(s, text string, width int) (string, bool) {
+	runes := []rune(s)
+	// ToLower maps rune for rune, so offsets into lower match runes.
+	lower := []rune(strings.ToLower(s))
+	needle := []rune(strings.ToLower(text))
+
+	at := -1
+	for i := 0; i+len(needle) <= len(lower); i++ {
+		if slices.Equal(lower[i:i+len(needle)], needle) {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		return "", false
+	}
+	if len(runes) <= width {
+		return s, true
+	}
+
+	start := max(0, at-(width-len(needle))/2)
+	end := min(len(runes), start+width)
+	start = max(0, end-width)
+
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(runes) {
+		snippet += "..."
+	}
+	return snippet, true
+}
+
+func scanIterations(rows *sql.Rows) ([]*Iteration, error) {
 	defer rows.Close()
 
 	var iterations []*Iteration
@@ -256,7 +555,7 @@ func (s *Store) ListIterations(ctx context.Context, sessionID string) ([]*Iterat
 		iter := &Iteration{}
 		var parentID, revisedPrompt, metadataJSON sql.NullString
 		if err := rows.Scan(&iter.ID, &iter.SessionID, &parentID, &iter.Operation, &iter.Prompt,
-			&revisedPrompt, &iter.Model, &iter.ImagePath, &iter.Timestamp, &metadataJSON); err != nil {
+			&revisedPrompt, &iter.Model, &iter.ImagePath, &iter.Timestamp, &metadataJSON, &iter.BranchPoint); err != nil {
 			return nil, err
 		}
 		iter.ParentID = parentID.String
@@ -320,6 +619,8 @@ type CostEntry struct {
 	Cost        float64
 	ImageCount  int
 	Timestamp   time.Time
+	// CacheHit marks a zero-cost entry served from the local cache.
+	CacheHit bool
 }
 
 type CostSummary struct {
@@ -334,20 +635,31 @@ type ProviderCostSummary struct {
 	ImageCount int
 }
 
+// CostGroup is the spend of one model, provider, or day in a cost
+// breakdown.
+type CostGroup struct {
+	Key        string
+	TotalCost  float64
+	ImageCount int
+	EntryCount int
+}
+
 func (s *Store) LogCost(ctx context.Context, entry *CostEntry) error {
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO cost_log (iteration_id, session_id, provider, model, cost, image_count, timestamp)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		`INSERT INTO cost_log (iteration_id, session_id, provider, model, cost, image_count, timestamp, cache_hit)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
 		nullString(entry.IterationID), nullString(entry.SessionID), entry.Provider, entry.Model,
-		entry.Cost, entry.ImageCount, entry.Timestamp)
+		entry.Cost, entry.ImageCount, entry.Timestamp.UTC(), entry.CacheHit)
 	return err
 }
 
+// GetCostByDateRange sums the cost entries logged in [start, end). The bounds
+// may be in any time zone; they are compared as the instants they denote.
 func (s *Store) GetCostByDateRange(ctx context.Context, start, end time.Time) (*CostSummary, error) {
 	row := s.db.QueryRowContext(ctx,
 		`SELECT COALESCE(SUM(cost), 0), COALESCE(SUM(image_count), 0), COUNT(*)
 		 FROM cost_log WHERE timestamp >= ? AND timestamp < ?`,
-		start, end)
+		start.UTC(), end.UTC())
 
 	var summary CostSummary
 	if err := row.Scan(&summary.TotalCost, &summary.ImageCount, &summary.EntryCount); err != nil {
@@ -356,6 +668,108 @@ func (s *Store) GetCostByDateRange(ctx context.Context, start, end time.Time) (*
 	return &summary, nil
 }
 
+// costRange returns the WHERE clause and arguments that limit cost_log to
+// [start, end), leaving out either bound that is zero.
+func costRange(start, end time.Time) (string, []any) {
+	var conds []string
+	var args []any
+	if !start.IsZero() {
+		conds = append(conds, "timestamp >= ?")
+		args = append(args, start.UTC())
+	}
+	if !end.IsZero() {
+		conds = append(conds, "timestamp < ?")
+		args = append(args, end.UTC())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// ListCostEntries returns every cost entry logged in [start, end), oldest
+// first. A zero start or end leaves that side of the range open.
+func (s *Store) ListCostEntries(ctx context.Context, start, end time.Time) ([]CostEntry, error) {
+	where, args := costRange(start, end)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT iteration_id, session_id, provider, model, cost, image_count, timestamp, cache_hit
+		 FROM cost_log`+where+` ORDER BY timestamp ASC, id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []CostEntry
+	for rows.Next() {
+		var e CostEntry
+		var iterationID, sessionID sql.NullString
+		if err := rows.Scan(&iterationID, &sessionID, &e.Provider, &e.Model, &e.Cost, &e.ImageCount, &e.Timestamp, &e.CacheHit); err != nil {
+			return nil, err
+		}
+		e.IterationID = iterationID.String
+		e.SessionID = sessionID.String
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetCostByModel groups the cost entries logged in [start, end) by model,
+// most expensive first. A zero start or end leaves that side open.
+func (s *Store) GetCostByModel(ctx context.Context, start, end time.Time) ([]CostGroup, error) {
+	return s.costGroups(ctx, "model", start, end)
+}
+
+// GetCostByProviderRange is GetCostByProvider for the entries logged in
+// [start, end), most expensive first.
+func (s *Store) GetCostByProviderRange(ctx context.Context, start, end time.Time) ([]CostGroup, error) {
+	return s.costGroups(ctx, "provider", start, end)
+}
+
+// costGroups sums the entries in [start, end) for each value of column.
+func (s *Store) costGroups(ctx context.Context, column string, start, end time.Time) ([]CostGroup, error) {
+	where, args := costRange(start, end)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+column+`, COALESCE(SUM(cost), 0), COALESCE(SUM(image_count), 0), COUNT(*)
+		 FROM cost_log`+where+` GROUP BY `+column+` ORDER BY SUM(cost) DESC, `+column, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []CostGroup
+	for rows.Next() {
+		var g CostGroup
+		if err := rows.Scan(&g.Key, &g.TotalCost, &g.ImageCount, &g.EntryCount); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// GetCostByDay groups the cost entries logged in [start, end) by calendar
+// day in loc, oldest first, keyed as 2006-01-02. Days without entries are
+// left out. Timestamps are stored in UTC, so the days are bucketed here
+// rather than in SQL.
+func (s *Store) GetCostByDay(ctx context.Context, start, end time.Time, loc *time.Location) ([]CostGroup, error) {
+	entries, err := s.ListCostEntries(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	var groups []CostGroup
+	for _, e := range entries {
+		day := e.Timestamp.In(loc).Format(time.DateOnly)
+		if len(groups) == 0 || groups[len(groups)-1].Key != day {
+			groups = append(groups, CostGroup{Key: day})
+		}
+		g := &groups[len(groups)-1]
+		g.TotalCost += e.Cost
+		g.ImageCount += e.ImageCount
+		g.EntryCount++
+	}
+	return groups, nil
+}
+
 func (s *Store) GetCostByProvider(ctx context.Context) ([]ProviderCostSummary, error) {
 	rows, err := s.db.QueryContext(ctx,
 		`SELECT provider, COALESCE(SUM(cost), 0), COALESCE(SUM(image_count), 0)
@@ -1,9 +1,15 @@
 package session
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -252,6 +258,214 @@ func TestStore_ListIterations(t *testing.T) {
 	}
 }
 
+func TestStore_ListChildrenAndBranchPoint(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	sess := &Session{ID: "s1", CreatedAt: time.Now(), UpdatedAt: time.Now(), Model: "gpt-image-1"}
+	if err := store.CreateSession(ctx, sess); err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	now := time.Now()
+	for i, iter := range []*Iteration{
+		{ID: "root", Operation: "generate"},
+		{ID: "b", ParentID: "root", Operation: "edit"},
+		{ID: "a", ParentID: "root", Operation: "edit"},
+		{ID: "grandchild", ParentID: "a", Operation: "edit"},
+	} {
+		iter.SessionID, iter.Prompt, iter.Model, iter.ImagePath = sess.ID, iter.ID, "gpt-image-1", "/"+iter.ID+".png"
+		iter.Timestamp = now.Add(time.Duration(i) * time.Second)
+		if err := store.CreateIteration(ctx, iter); err != nil {
+			t.Fatalf("CreateIteration() error = %v", err)
+		}
+	}
+
+	children, err := store.ListChildren(ctx, "root")
+	if err != nil {
+		t.Fatalf("ListChildren() error = %v", err)
+	}
+	var ids []string
+	for _, child := range children {
+		ids = append(ids, child.ID)
+	}
+	if !slices.Equal(ids, []string{"b", "a"}) {
+		t.Errorf("ListChildren(root) = %v, want [b a] (oldest first)", ids)
+	}
+	if leaves, err := store.ListChildren(ctx, "grandchild"); err != nil || len(leaves) != 0 {
+		t.Errorf("ListChildren(leaf) = %d, %v; want none", len(leaves), err)
+	}
+
+	if err := store.SetBranchPoint(ctx, "root", true); err != nil {
+		t.Fatalf("SetBranchPoint() error = %v", err)
+	}
+	got, err := store.GetIteration(ctx, "root")
+	if err != nil || !got.BranchPoint {
+		t.Errorf("GetIteration() BranchPoint = %v, %v; want true", got.BranchPoint, err)
+	}
+	if err := store.SetBranchPoint(ctx, "missing", true); !errors.Is(err, ErrIterationNotFound) {
+		t.Errorf("SetBranchPoint(missing) error = %v, want ErrIterationNotFound", err)
+	}
+}
+
+func TestStore_BranchPointMigratesOldDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+
+	// An iterations table from before branch points existed.
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE iterations (
+		id TEXT PRIMARY KEY,
+		session_id TEXT NOT NULL,
+		parent_id TEXT,
+		operation TEXT NOT NULL,
+		prompt TEXT NOT NULL,
+		revised_prompt TEXT,
+		model TEXT NOT NULL,
+		image_path TEXT NOT NULL,
+		timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		metadata_json TEXT
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO iterations (id, session_id, parent_id, operation, prompt, model, image_path)
+		VALUES ('first', 'old', NULL, 'generate', 'a fox', 'gpt-image-1', '/first.png'),
+		       ('second', 'old', 'first', 'edit', 'red', 'gpt-image-1', '/second.png')`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatalf("NewStoreWithPath() error = %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	iterations, err := store.ListIterations(ctx, "old")
+	if err != nil || len(iterations) != 2 || iterations[0].BranchPoint {
+		t.Fatalf("ListIterations() = %d, %v; want the old iterations without branch points", len(iterations), err)
+	}
+	if err := store.SetBranchPoint(ctx, "first", true); err != nil {
+		t.Fatalf("SetBranchPoint() error = %v", err)
+	}
+	children, err := store.ListChildren(ctx, "first")
+	if err != nil || len(children) != 1 || children[0].ID != "second" {
+		t.Errorf("ListChildren() = %v, %v; want the old edit", children, err)
+	}
+}
+
+func TestStore_ListAllIterations(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	now := time.Now()
+	for _, id := range []string{"s1", "s2"} {
+		if err := store.CreateSession(ctx, &Session{ID: id, CreatedAt: now, UpdatedAt: now, Model: "gpt-image-1"}); err != nil {
+			t.Fatalf("CreateSession() error = %v", err)
+		}
+	}
+
+	iterations := []*Iteration{
+		{ID: "i2", SessionID: "s2", Operation: "generate", Prompt: "second", Model: "dall-e-3", ImagePath: "/p2.png", Timestamp: now.Add(-1 * time.Second)},
+		{ID: "i1", SessionID: "s1", Operation: "generate", Prompt: "first", Model: "gpt-image-1", ImagePath: "/p1.png", Timestamp: now.Add(-2 * time.Second)},
+		{ID: "i3", SessionID: "s1", Operation: "edit", Prompt: "third", Model: "gpt-image-1", ImagePath: "/p3.png", Timestamp: now},
+	}
+	for _, i := range iterations {
+		if err := store.CreateIteration(ctx, i); err != nil {
+			t.Fatalf("CreateIteration() error = %v", err)
+		}
+	}
+
+	got, err := store.ListAllIterations(ctx)
+	if err != nil {
+		t.Fatalf("ListAllIterations() error = %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("ListAllIterations() returned %d iterations, want 3", len(got))
+	}
+	for i, want := range []string{"i1", "i2", "i3"} {
+		if got[i].ID != want {
+			t.Errorf("iteration %d = %s, want %s (oldest first across sessions)", i, got[i].ID, want)
+		}
+	}
+}
+
+func TestStore_SearchIterations(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	now := time.Now()
+	for _, id := range []string{"s1", "s2"} {
+		if err := store.CreateSession(ctx, &Session{ID: id, CreatedAt: now, UpdatedAt: now, Model: "gpt-image-1"}); err != nil {
+			t.Fatalf("CreateSession() error = %v", err)
+		}
+	}
+
+	iterations := []*Iteration{
+		{ID: "i1", SessionID: "s1", Operation: "generate", Prompt: "a minimal Logo for a bakery", Model: "gpt-image-1", ImagePath: "/p1.png", Timestamp: now.Add(-3 * time.Second)},
+		{ID: "i2", SessionID: "s1", Operation: "edit", Prompt: "make it blue", RevisedPrompt: "a blue bakery logo", Model: "gpt-image-1", ImagePath: "/p2.png", Timestamp: now.Add(-2 * time.Second)},
+		{ID: "i3", SessionID: "s2", Operation: "generate", Prompt: "a red fox in snow", Model: "dall-e-3", ImagePath: "/p3.png", Timestamp: now.Add(-1 * time.Second)},
+		{ID: "i4", SessionID: "s2", Operation: "generate", Prompt: "LOGO with 100% contrast", Model: "dall-e-3", ImagePath: "/p4.png", Timestamp: now},
+	}
+	for _, i := range iterations {
+		if err := store.CreateIteration(ctx, i); err != nil {
+			t.Fatalf("CreateIteration() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"logo", []string{"i4", "i2", "i1"}},
+		{"blue bakery", []string{"i2"}},
+		{"100%", []string{"i4"}},
+		{"%", []string{"i4"}},
+		{"a_red", nil},
+		{"zebra", nil},
+	}
+	for _, tt := range tests {
+		got, err := store.SearchIterations(ctx, tt.query)
+		if err != nil {
+			t.Fatalf("SearchIterations(%q) error = %v", tt.query, err)
+		}
+		var ids []string
+		for _, iter := range got {
+			ids = append(ids, iter.ID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("SearchIterations(%q) = %v, want %v (most recent first)", tt.query, ids, tt.want)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := "a watercolor painting of a lighthouse on a cliff at dusk with a small red logo in the corner and gulls overhead"
+	tests := []struct {
+		name string
+		iter *Iteration
+		text string
+		want string
+	}{
+		{"short prompt", &Iteration{Prompt: "a bakery logo"}, "LOGO", "a bakery logo"},
+		{"middle of long prompt", &Iteration{Prompt: long}, "red logo", "...with a small red logo in the corne..."},
+		{"start of long prompt", &Iteration{Prompt: long}, "watercolor", "a watercolor painting of a lightho..."},
+		{"revised prompt", &Iteration{Prompt: "make it blue", RevisedPrompt: "a blue bakery logo"}, "bakery", "a blue bakery logo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Snippet(tt.iter, tt.text, 34); got != tt.want {
+				t.Errorf("Snippet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestStore_CountIterations(t *testing.T) {
 	store, cleanup := testStore(t)
 	defer cleanup()
@@ -431,6 +645,171 @@ func TestStore_LogCost(t *testing.T) {
 	}
 }
 
+func TestStore_LogCost_CacheHitMigration(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+
+	// A cost log from before cache hits were recorded.
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE cost_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		iteration_id TEXT,
+		session_id TEXT,
+		provider TEXT NOT NULL,
+		model TEXT NOT NULL,
+		cost REAL NOT NULL,
+		image_count INTEGER NOT NULL DEFAULT 1,
+		timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec(`INSERT INTO cost_log (provider, model, cost) VALUES ('openai', 'dall-e-3', 0.04)`)
+	db.Close()
+
+	store, err := NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatalf("NewStoreWithPath() error = %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	entry := &CostEntry{Provider: "openai", Model: "dall-e-3", ImageCount: 1, Timestamp: time.Now(), CacheHit: true}
+	if err := store.LogCost(ctx, entry); err != nil {
+		t.Fatalf("LogCost() error = %v", err)
+	}
+
+	var hits int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM cost_log WHERE cache_hit = 1`).Scan(&hits); err != nil {
+		t.Fatal(err)
+	}
+	if hits != 1 {
+		t.Errorf("cache hits = %d, want 1 (existing rows default to 0)", hits)
+	}
+}
+
+func TestStore_Tags(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	now := time.Now()
+	for i, id := range []string{"s1", "s2", "s3"} {
+		updated := now.Add(time.Duration(i) * time.Minute)
+		if err := store.CreateSession(ctx, &Session{ID: id, CreatedAt: now, UpdatedAt: updated, Model: "gpt-image-1"}); err != nil {
+			t.Fatalf("CreateSession() error = %v", err)
+		}
+	}
+	for _, tt := range []struct{ id, tag string }{
+		{"s1", "client-a"}, {"s1", "experiments"}, {"s2", "Client-A "}, {"s1", "client-a"},
+	} {
+		if err := store.AddTag(ctx, tt.id, tt.tag); err != nil {
+			t.Fatalf("AddTag(%s, %q) error = %v", tt.id, tt.tag, err)
+		}
+	}
+
+	got, err := store.ListByTag(ctx, "CLIENT-A")
+	if err != nil {
+		t.Fatalf("ListByTag() error = %v", err)
+	}
+	if len(got) != 2 || got[0].ID != "s2" || got[1].ID != "s1" {
+		t.Fatalf("ListByTag(client-a) = %v, want s2 then s1 (most recently updated first)", sessionIDs(got))
+	}
+	if !slices.Equal(got[1].Tags, []string{"client-a", "experiments"}) {
+		t.Errorf("s1 tags = %v, want [client-a experiments]", got[1].Tags)
+	}
+
+	sess, err := store.GetSession(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if !slices.Equal(sess.Tags, []string{"client-a", "experiments"}) {
+		t.Errorf("GetSession() tags = %v, want [client-a experiments]", sess.Tags)
+	}
+
+	removed, err := store.RemoveTag(ctx, "s1", "client-a")
+	if err != nil || !removed {
+		t.Fatalf("RemoveTag() = %v, %v; want true", removed, err)
+	}
+	if removed, _ := store.RemoveTag(ctx, "s1", "client-a"); removed {
+		t.Error("RemoveTag() of a missing tag reported removal")
+	}
+	if got, _ := store.ListByTag(ctx, "client-a"); len(got) != 1 || got[0].ID != "s2" {
+		t.Errorf("ListByTag(client-a) after removal = %v, want [s2]", sessionIDs(got))
+	}
+	if got, _ := store.ListByTag(ctx, "unused"); len(got) != 0 {
+		t.Errorf("ListByTag(unused) = %v, want none", sessionIDs(got))
+	}
+
+	if err := store.AddTag(ctx, "missing", "x"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("AddTag() on unknown session error = %v, want ErrSessionNotFound", err)
+	}
+	for _, bad := range []string{"", "  ", "two words", "a,b"} {
+		if err := store.AddTag(ctx, "s1", bad); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("AddTag(%q) error = %v, want ErrInvalidTag", bad, err)
+		}
+	}
+
+	if err := store.DeleteSession(ctx, "s2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.ListByTag(ctx, "client-a"); len(got) != 0 {
+		t.Errorf("deleted session still listed under its tag: %v", sessionIDs(got))
+	}
+}
+
+func TestStore_Tags_MigratesOldDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+
+	// A sessions table from before tags existed.
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE sessions (
+		id TEXT PRIMARY KEY,
+		name TEXT,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		current_iteration_id TEXT,
+		model TEXT NOT NULL DEFAULT 'gpt-image-1'
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO sessions (id, name) VALUES ('old', 'before tags')`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatalf("NewStoreWithPath() error = %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	sessions, err := store.ListSessions(ctx)
+	if err != nil || len(sessions) != 1 || len(sessions[0].Tags) != 0 {
+		t.Fatalf("ListSessions() = %v, %v; want the old session without tags", sessionIDs(sessions), err)
+	}
+	if err := store.AddTag(ctx, "old", "archive"); err != nil {
+		t.Fatalf("AddTag() error = %v", err)
+	}
+	got, err := store.ListByTag(ctx, "archive")
+	if err != nil || len(got) != 1 || got[0].Name != "before tags" {
+		t.Errorf("ListByTag() = %v, %v; want the old session", sessionIDs(got), err)
+	}
+}
+
+func sessionIDs(sessions []*Session) []string {
+	var ids []string
+	for _, sess := range sessions {
+		ids = append(ids, sess.ID)
+	}
+	return ids
+}
+
 func TestStore_GetTotalCost_Empty(t *testing.T) {
 	store, cleanup := testStore(t)
 	defer cleanup()
@@ -669,6 +1048,96 @@ func TestStore_GetCostByDateRange(t *testing.T) {
 	}
 }
 
+func TestStore_GetCostByDateRange_MidnightInZone(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	ist := time.FixedZone("IST", 5*3600+1800)
+	pst := time.FixedZone("PST", -8*3600)
+
+	// Entries either side of midnight IST, logged with timestamps in
+	// different zones as a machine that moved between them would.
+	entries := []struct {
+		ts   time.Time
+		cost float64
+	}{
+		{time.Date(2025, 3, 14, 23, 59, 0, 0, ist).UTC(), 0.01},   // 18:29 UTC on the 14th
+		{time.Date(2025, 3, 15, 0, 1, 0, 0, ist), 0.02},           // 18:31 UTC on the 14th
+		{time.Date(2025, 3, 15, 23, 59, 0, 0, ist).In(pst), 0.04}, // 18:29 UTC on the 15th
+	}
+	for _, e := range entries {
+		if err := store.LogCost(ctx, &CostEntry{Provider: "openai", Model: "dall-e-3", Cost: e.cost, ImageCount: 1, Timestamp: e.ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		start time.Time
+		want  float64
+	}{
+		{"IST day", time.Date(2025, 3, 15, 0, 0, 0, 0, ist), 0.02 + 0.04},
+		{"previous IST day", time.Date(2025, 3, 14, 0, 0, 0, 0, ist), 0.01},
+		{"UTC day", time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC), 0.01 + 0.02},
+		{"PST day", time.Date(2025, 3, 15, 0, 0, 0, 0, pst), 0.04},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, err := store.GetCostByDateRange(ctx, tt.start, tt.start.AddDate(0, 0, 1))
+			if err != nil {
+				t.Fatalf("GetCostByDateRange() error = %v", err)
+			}
+			if !floatEquals(summary.TotalCost, tt.want) {
+				t.Errorf("GetCostByDateRange() TotalCost = %v, want %v", summary.TotalCost, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewStoreWithPath_NormalizesTimestampsToUTC(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "local.db")
+	store, err := NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows written in local time by earlier versions.
+	ist := time.FixedZone("IST", 5*3600+1800)
+	for _, ts := range []time.Time{
+		time.Date(2025, 3, 15, 0, 1, 0, 0, ist), // 18:31 UTC on the 14th
+		time.Date(2025, 3, 15, 6, 0, 0, 0, ist), // 00:30 UTC on the 15th
+	} {
+		if _, err := store.db.Exec(`INSERT INTO cost_log (provider, model, cost, timestamp) VALUES ('openai', 'dall-e-3', 0.04, ?)`, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	store, err = NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatalf("NewStoreWithPath() error = %v", err)
+	}
+	defer store.Close()
+
+	var local int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM cost_log WHERE timestamp NOT LIKE '%+0000 UTC'`).Scan(&local); err != nil {
+		t.Fatal(err)
+	}
+	if local != 0 {
+		t.Errorf("%d timestamps still have a local offset, want 0", local)
+	}
+
+	start := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)
+	summary, err := store.GetCostByDateRange(context.Background(), start, start.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("GetCostByDateRange() error = %v", err)
+	}
+	if summary.EntryCount != 1 {
+		t.Errorf("entries on the UTC day = %d, want 1", summary.EntryCount)
+	}
+}
+
 func TestStore_GetCostByDateRange_NoResults(t *testing.T) {
 	store, cleanup := testStore(t)
 	defer cleanup()
@@ -692,6 +1161,151 @@ func TestStore_GetCostByDateRange_NoResults(t *testing.T) {
 	}
 }
 
+func TestStore_ListCostEntries(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	base := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	for i, model := range []string{"dall-e-3", "gpt-image-1", "stable-diffusion-xl"} {
+		entry := &CostEntry{Provider: "openai", Model: model, Cost: 0.04 * float64(i+1), ImageCount: i + 1, Timestamp: base.AddDate(0, 0, i)}
+		if err := store.LogCost(ctx, entry); err != nil {
+			t.Fatalf("LogCost() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       []string
+	}{
+		{"open range", time.Time{}, time.Time{}, []string{"dall-e-3", "gpt-image-1", "stable-diffusion-xl"}},
+		{"from only", base.AddDate(0, 0, 1), time.Time{}, []string{"gpt-image-1", "stable-diffusion-xl"}},
+		{"to only, exclusive", time.Time{}, base.AddDate(0, 0, 1), []string{"dall-e-3"}},
+		{"closed range", base.Add(time.Hour), base.AddDate(0, 0, 2), []string{"gpt-image-1"}},
+		{"empty range", base.AddDate(0, 1, 0), time.Time{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := store.ListCostEntries(ctx, tt.start, tt.end)
+			if err != nil {
+				t.Fatalf("ListCostEntries() error = %v", err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Model)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ListCostEntries() models = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	entries, _ := store.ListCostEntries(ctx, time.Time{}, time.Time{})
+	if e := entries[2]; !floatEquals(e.Cost, 0.12) || e.ImageCount != 3 || !e.Timestamp.Equal(base.AddDate(0, 0, 2)) {
+		t.Errorf("entry = %+v, want cost 0.12, 3 images at %v", e, base.AddDate(0, 0, 2))
+	}
+}
+
+// seedCostGroups logs entries for two models and two providers over three
+// days, plus one entry outside [base, base+3 days).
+func seedCostGroups(t *testing.T, store *Store, base time.Time) {
+	t.Helper()
+	entries := []CostEntry{
+		{Provider: "openai", Model: "dall-e-3", Cost: 0.04, ImageCount: 1, Timestamp: base.Add(time.Hour)},
+		{Provider: "openai", Model: "gpt-image-1", Cost: 0.167, ImageCount: 1, Timestamp: base.Add(2 * time.Hour)},
+		{Provider: "openai", Model: "dall-e-3", Cost: 0.08, ImageCount: 1, Timestamp: base.Add(25 * time.Hour)},
+		{Provider: "stability", Model: "sd3", Cost: 0.065, ImageCount: 2, Timestamp: base.Add(50 * time.Hour)},
+		{Provider: "openai", Model: "dall-e-2", Cost: 0.02, ImageCount: 1, Timestamp: base.AddDate(0, 0, -1)},
+	}
+	for i := range entries {
+		if err := store.LogCost(context.Background(), &entries[i]); err != nil {
+			t.Fatalf("LogCost() error = %v", err)
+		}
+	}
+}
+
+func TestStore_GetCostByModel(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+	base := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	seedCostGroups(t, store, base)
+
+	groups, err := store.GetCostByModel(context.Background(), base, base.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatalf("GetCostByModel() error = %v", err)
+	}
+	want := []CostGroup{
+		{Key: "gpt-image-1", TotalCost: 0.167, ImageCount: 1, EntryCount: 1},
+		{Key: "dall-e-3", TotalCost: 0.12, ImageCount: 2, EntryCount: 2},
+		{Key: "sd3", TotalCost: 0.065, ImageCount: 2, EntryCount: 1},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("GetCostByModel() = %+v, want %+v", groups, want)
+	}
+	for i, g := range groups {
+		if g.Key != want[i].Key || !floatEquals(g.TotalCost, want[i].TotalCost) || g.ImageCount != want[i].ImageCount || g.EntryCount != want[i].EntryCount {
+			t.Errorf("group %d = %+v, want %+v", i, g, want[i])
+		}
+	}
+
+	all, err := store.GetCostByModel(context.Background(), time.Time{}, time.Time{})
+	if err != nil || len(all) != 4 {
+		t.Errorf("GetCostByModel(open range) = %+v, %v; want 4 models", all, err)
+	}
+}
+
+func TestStore_GetCostByProviderRange(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+	base := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	seedCostGroups(t, store, base)
+
+	groups, err := store.GetCostByProviderRange(context.Background(), base, time.Time{})
+	if err != nil {
+		t.Fatalf("GetCostByProviderRange() error = %v", err)
+	}
+	if len(groups) != 2 || groups[0].Key != "openai" || !floatEquals(groups[0].TotalCost, 0.287) || groups[1].Key != "stability" || groups[1].ImageCount != 2 {
+		t.Errorf("GetCostByProviderRange() = %+v, want openai $0.287 then stability", groups)
+	}
+}
+
+func TestStore_GetCostByDay(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+	base := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	seedCostGroups(t, store, base)
+
+	groups, err := store.GetCostByDay(context.Background(), base, base.AddDate(0, 0, 3), time.UTC)
+	if err != nil {
+		t.Fatalf("GetCostByDay() error = %v", err)
+	}
+	var keys []string
+	for _, g := range groups {
+		keys = append(keys, g.Key)
+	}
+	if !slices.Equal(keys, []string{"2025-06-01", "2025-06-02", "2025-06-03"}) {
+		t.Fatalf("GetCostByDay() days = %v", keys)
+	}
+	if !floatEquals(groups[0].TotalCost, 0.207) || groups[0].EntryCount != 2 {
+		t.Errorf("first day = %+v, want $0.207 over 2 entries", groups[0])
+	}
+
+	// Six hours behind UTC, the first two entries fall on the day before.
+	groups, err = store.GetCostByDay(context.Background(), base, base.AddDate(0, 0, 3), time.FixedZone("CST", -6*3600))
+	if err != nil {
+		t.Fatalf("GetCostByDay() error = %v", err)
+	}
+	if len(groups) != 3 || groups[0].Key != "2025-05-31" || groups[0].EntryCount != 2 {
+		t.Errorf("GetCostByDay(CST) = %+v, want the first entries on 2025-05-31", groups)
+	}
+
+	empty, err := store.GetCostByDay(context.Background(), base.AddDate(1, 0, 0), time.Time{}, time.UTC)
+	if err != nil || len(empty) != 0 {
+		t.Errorf("GetCostByDay(empty range) = %+v, %v", empty, err)
+	}
+}
+
 func TestStore_GetCostByProvider_Empty(t *testing.T) {
 	store, cleanup := testStore(t)
 	defer cleanup()
@@ -821,6 +1435,109 @@ func TestIterationMetadata_WithCost(t *testing.T) {
 	}
 }
 
+func TestStore_Vacuum(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	now := time.Now()
+	prompt := strings.Repeat("a very detailed prompt ", 100)
+	for i := range 50 {
+		id := fmt.Sprintf("s%d", i)
+		if err := store.CreateSession(ctx, &Session{ID: id, CreatedAt: now, UpdatedAt: now, Model: "gpt-image-1"}); err != nil {
+			t.Fatal(err)
+		}
+		iter := &Iteration{ID: id + "-1", SessionID: id, Operation: "generate", Prompt: prompt, Model: "gpt-image-1", ImagePath: "/x.png", Timestamp: now}
+		if err := store.CreateIteration(ctx, iter); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 49 {
+		if err := store.DeleteSession(ctx, fmt.Sprintf("s%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, _ := os.Stat(dbPath)
+
+	if err := store.Vacuum(ctx); err != nil {
+		t.Fatalf("Vacuum() error = %v", err)
+	}
+
+	after, _ := os.Stat(dbPath)
+	if after.Size() >= before.Size() {
+		t.Errorf("size after vacuum = %d, want less than %d", after.Size(), before.Size())
+	}
+	iterations, err := store.ListIterations(ctx, "s49")
+	if err != nil || len(iterations) != 1 || iterations[0].Prompt != prompt {
+		t.Errorf("ListIterations() = %d, %v; want the surviving iteration", len(iterations), err)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "my sessions.db")
+	if _, err := OpenReadOnly(dbPath); err == nil {
+		t.Error("OpenReadOnly() of a missing file should fail rather than create it")
+	}
+
+	store, err := NewStoreWithPath(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	before, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ro, err := OpenReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("OpenReadOnly() error = %v", err)
+	}
+	ctx := context.Background()
+	if problems, err := ro.IntegrityCheck(ctx); err != nil || problems != nil {
+		t.Errorf("IntegrityCheck() = %v, %v, want no problems", problems, err)
+	}
+	now := time.Now()
+	if err := ro.CreateSession(ctx, &Session{ID: "s1", CreatedAt: now, UpdatedAt: now, Model: "gpt-image-1"}); err == nil {
+		t.Error("CreateSession() on a read-only store should fail")
+	}
+	ro.Close()
+
+	after, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("OpenReadOnly() changed the database file")
+	}
+}
+
+func TestStore_IntegrityCheck(t *testing.T) {
+	store, cleanup := testStore(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	now := time.Now()
+	if err := store.CreateSession(ctx, &Session{ID: "s1", CreatedAt: now, UpdatedAt: now, Model: "gpt-image-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.LogCost(ctx, &CostEntry{Provider: "openai", Model: "dall-e-3", Cost: 0.04, ImageCount: 1, Timestamp: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := store.IntegrityCheck(ctx)
+	if err != nil {
+		t.Fatalf("IntegrityCheck() error = %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("IntegrityCheck() = %v, want no problems", problems)
+	}
+}
+
 func floatEquals(a, b float64) bool {
 	const epsilon = 0.0001
 	return (a-b) < epsilon && (b-a) < epsilon
@@ -0,0 +1,52 @@
+-- A sessions.db from before schema versioning: cost_log requires an
+-- iteration, and neither cache hits nor branch points are recorded.
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    name TEXT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    current_iteration_id TEXT,
+    model TEXT NOT NULL DEFAULT 'gpt-image-1'
+);
+
+CREATE TABLE iterations (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    parent_id TEXT,
+    operation TEXT NOT NULL,
+    prompt TEXT NOT NULL,
+    revised_prompt TEXT,
+    model TEXT NOT NULL,
+    image_path TEXT NOT NULL,
+    timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    metadata_json TEXT,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE TABLE cost_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    iteration_id TEXT NOT NULL,
+    session_id TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    model TEXT NOT NULL,
+    cost REAL NOT NULL,
+    image_count INTEGER NOT NULL DEFAULT 1,
+    timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (iteration_id) REFERENCES iterations(id) ON DELETE CASCADE,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_iterations_session_id ON iterations(session_id);
+CREATE INDEX idx_sessions_updated_at ON sessions(updated_at);
+CREATE INDEX idx_cost_log_timestamp ON cost_log(timestamp);
+
+INSERT INTO sessions (id, name, created_at, updated_at, current_iteration_id, model)
+VALUES ('old', 'fox', '2025-03-15 10:00:00 +0000 UTC', '2025-03-15 10:05:00 +0000 UTC', 'second', 'gpt-image-1');
+
+INSERT INTO iterations (id, session_id, parent_id, operation, prompt, model, image_path, timestamp)
+VALUES ('first', 'old', NULL, 'generate', 'a fox', 'gpt-image-1', '/first.png', '2025-03-15 10:00:00 +0000 UTC'),
+       ('second', 'old', 'first', 'edit', 'make it red', 'gpt-image-1', '/second.png', '2025-03-15 10:05:00 +0000 UTC');
+
+INSERT INTO cost_log (iteration_id, session_id, provider, model, cost, image_count, timestamp)
+VALUES ('first', 'old', 'openai', 'gpt-image-1', 0.04, 1, '2025-03-15 10:00:00 +0000 UTC'),
+       ('second', 'old', 'openai', 'gpt-image-1', 0.04, 1, '2025-03-15 10:05:00 +0000 UTC');
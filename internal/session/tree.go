@@ -0,0 +1,59 @@
+package session
+
+// TreeNode is an iteration with the iterations made from it.
+type TreeNode struct {
+	Iteration *Iteration
+	Children  []*TreeNode
+}
+
+// BuildTree arranges iterations by parent, keeping their order among
+// siblings. Iterations whose parent is not among them are roots.
+func BuildTree(iterations []*Iteration) []*TreeNode {
+	nodes := make(map[string]*TreeNode, len(iterations))
+	for _, iter := range iterations {
+		nodes[iter.ID] = &TreeNode{Iteration: iter}
+	}
+
+	var roots []*TreeNode
+	for _, iter := range iterations {
+		node := nodes[iter.ID]
+		if parent, ok := nodes[iter.ParentID]; ok && iter.ParentID != iter.ID {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	return roots
+}
+
+// TreeLines draws the trees under roots one iteration per line, labeled by
+// label. A line of edits without forks stays in one column; where an
+// iteration has several children, each starts an indented branch:
+//
+//	generate "a fox"
+//	edit "make it red"
+//	├─ edit "add a hat"
+//	│  edit "bigger hat"
+//	└─ edit "add a scarf"
+func TreeLines(roots []*TreeNode, label func(*Iteration) string) []string {
+	var lines []string
+	var draw func(node *TreeNode, first, rest string)
+	draw = func(node *TreeNode, first, rest string) {
+		lines = append(lines, first+label(node.Iteration))
+		if len(node.Children) == 1 {
+			draw(node.Children[0], rest, rest)
+			return
+		}
+		for i, child := range node.Children {
+			if i == len(node.Children)-1 {
+				draw(child, rest+"└─ ", rest+"   ")
+			} else {
+				draw(child, rest+"├─ ", rest+"│  ")
+			}
+		}
+	}
+	for _, root := range roots {
+		draw(root, "", "")
+	}
+	return lines
+}
@@ -0,0 +1,81 @@
+package session
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBuildTree(t *testing.T) {
+	iterations := []*Iteration{
+		{ID: "fox", Prompt: "fox"},
+		{ID: "red", ParentID: "fox", Prompt: "red"},
+		{ID: "hat", ParentID: "red", Prompt: "hat"},
+		{ID: "scarf", ParentID: "red", Prompt: "scarf"},
+		{ID: "big", ParentID: "hat", Prompt: "big"},
+		{ID: "orphan", ParentID: "deleted", Prompt: "orphan"},
+	}
+	roots := BuildTree(iterations)
+
+	if len(roots) != 2 || roots[0].Iteration.ID != "fox" || roots[1].Iteration.ID != "orphan" {
+		t.Fatalf("BuildTree() roots = %v, want fox and orphan", roots)
+	}
+	red := roots[0].Children[0]
+	var children []string
+	for _, child := range red.Children {
+		children = append(children, child.Iteration.ID)
+	}
+	if !slices.Equal(children, []string{"hat", "scarf"}) {
+		t.Errorf("children of red = %v, want [hat scarf]", children)
+	}
+
+	// Every iteration appears exactly once in a depth-first walk.
+	var walked []string
+	var walk func([]*TreeNode)
+	walk = func(nodes []*TreeNode) {
+		for _, n := range nodes {
+			walked = append(walked, n.Iteration.ID)
+			walk(n.Children)
+		}
+	}
+	walk(roots)
+	if want := []string{"fox", "red", "hat", "big", "scarf", "orphan"}; !slices.Equal(walked, want) {
+		t.Errorf("walk = %v, want %v", walked, want)
+	}
+}
+
+func TestTreeLines(t *testing.T) {
+	iterations := []*Iteration{
+		{ID: "1", Prompt: "fox"},
+		{ID: "2", ParentID: "1", Prompt: "red", BranchPoint: true},
+		{ID: "3", ParentID: "2", Prompt: "hat"},
+		{ID: "4", ParentID: "3", Prompt: "big hat"},
+		{ID: "5", ParentID: "4", Prompt: "blue hat"},
+		{ID: "6", ParentID: "4", Prompt: "green hat"},
+		{ID: "7", ParentID: "2", Prompt: "scarf"},
+	}
+	label := func(iter *Iteration) string {
+		if iter.BranchPoint {
+			return iter.Prompt + " *"
+		}
+		return iter.Prompt
+	}
+
+	got := strings.Join(TreeLines(BuildTree(iterations), label), "\n")
+	want := strings.Join([]string{
+		"fox",
+		"red *",
+		"├─ hat",
+		"│  big hat",
+		"│  ├─ blue hat",
+		"│  └─ green hat",
+		"└─ scarf",
+	}, "\n")
+	if got != want {
+		t.Errorf("TreeLines() =\n%s\nwant\n%s", got, want)
+	}
+
+	if lines := TreeLines(nil, label); len(lines) != 0 {
+		t.Errorf("TreeLines(nil) = %v, want none", lines)
+	}
+}
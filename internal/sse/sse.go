@@ -0,0 +1,164 @@
+// Package sse reads Server-Sent Events streams, as returned by streaming
+// API endpoints.
+package sse
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"strings"
+)
+
+// Done is the data payload OpenAI-style APIs send as their last event.
+const Done = "[DONE]"
+
+// maxLineSize bounds a single line of the stream. Streamed chunks are small,
+// but a final event can carry a whole response.
+const maxLineSize = 4 << 20
+
+// Event is one dispatched event.
+type Event struct {
+	// Type is the event: field, or "message" when the event had none.
+	Type string
+	// Data is the data: fields joined with newlines.
+	Data string
+	// ID is the most recent id: field in the stream, if any.
+	ID string
+}
+
+// Reader parses an event stream following the WHATWG EventSource rules:
+// comment lines starting with ':' are ignored, repeated data: lines are
+// joined with newlines, and a blank line dispatches the event. An event
+// still incomplete when the stream ends is discarded.
+type Reader struct {
+	scanner *bufio.Scanner
+	done    bool
+	lastID  string
+}
+
+// NewReader returns a Reader that parses events from r.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	scanner.Split(scanLines)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next event. It returns io.EOF once the stream ends or
+// an event with Done as its data arrives, and ctx's error once ctx is
+// canceled. Cancellation is checked between lines; to interrupt a read that
+// is blocked, tie the underlying reader to ctx, as an HTTP response body
+// from a request made with ctx is.
+func (r *Reader) Next(ctx context.Context) (Event, error) {
+	if r.done {
+		return Event{}, io.EOF
+	}
+
+	var (
+		event = Event{ID: r.lastID}
+		data  strings.Builder
+		has   bool
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return Event{}, err
+		}
+		if !r.scanner.Scan() {
+			r.done = true
+			if err := r.scanner.Err(); err != nil {
+				return Event{}, err
+			}
+			return Event{}, io.EOF
+		}
+
+		line := r.scanner.Text()
+		if line == "" {
+			if !has {
+				// Nothing to dispatch; the spec resets the event type too.
+				event.Type = ""
+				continue
+			}
+			event.Data = data.String()
+			if event.Type == "" {
+				event.Type = "message"
+			}
+			if event.Data == Done {
+				r.done = true
+				return Event{}, io.EOF
+			}
+			return event, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			if has {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			has = true
+		case "event":
+			event.Type = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				event.ID = value
+				r.lastID = value
+			}
+		}
+		// retry: and unknown fields are ignored.
+	}
+}
+
+// Events returns an iterator over the remaining events. Iteration ends at
+// the end of the stream or Done; any other error is yielded once with a
+// zero Event, after which iteration stops.
+func (r *Reader) Events(ctx context.Context) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		for {
+			event, err := r.Next(ctx)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(Event{}, err)
+				return
+			}
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
+
+// scanLines splits on "\n", "\r\n", or a lone "\r", as event streams allow
+// all three line endings.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for i, b := range data {
+		switch b {
+		case '\n':
+			return i + 1, data[:i], nil
+		case '\r':
+			if i+1 < len(data) {
+				if data[i+1] == '\n' {
+					return i + 2, data[:i], nil
+				}
+				return i + 1, data[:i], nil
+			}
+			if atEOF {
+				return i + 1, data[:i], nil
+			}
+			// Wait for the next byte to tell "\r" from "\r\n".
+			return 0, nil, nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,199 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, stream string) ([]Event, error) {
+	t.Helper()
+	var events []Event
+	for event, err := range NewReader(strings.NewReader(stream)).Events(context.Background()) {
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func TestReader_Events(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []Event
+	}{
+		{
+			name:   "single data line",
+			stream: "data: hello\n\n",
+			want:   []Event{{Type: "message", Data: "hello"}},
+		},
+		{
+			name:   "multi-line data joined with newlines",
+			stream: "data: first\ndata: second\ndata:\ndata: fourth\n\n",
+			want:   []Event{{Type: "message", Data: "first\nsecond\n\nfourth"}},
+		},
+		{
+			name:   "event type and id",
+			stream: "event: delta\nid: 7\ndata: {\"x\":1}\n\n",
+			want:   []Event{{Type: "delta", ID: "7", Data: `{"x":1}`}},
+		},
+		{
+			name:   "comments and unknown fields ignored",
+			stream: ": keep-alive\ndata: a\n: another comment\nretry: 1000\nfoo: bar\n\n",
+			want:   []Event{{Type: "message", Data: "a"}},
+		},
+		{
+			name:   "only one leading space is stripped",
+			stream: "data:no space\n\ndata:   three spaces\n\n",
+			want:   []Event{{Type: "message", Data: "no space"}, {Type: "message", Data: "  three spaces"}},
+		},
+		{
+			name:   "field without colon",
+			stream: "data\n\n",
+			want:   []Event{{Type: "message", Data: ""}},
+		},
+		{
+			name:   "blank lines without data dispatch nothing",
+			stream: "\n\nevent: ignored\n\ndata: x\n\n",
+			want:   []Event{{Type: "message", Data: "x"}},
+		},
+		{
+			name:   "id carries over to later events",
+			stream: "id: 1\ndata: a\n\ndata: b\n\n",
+			want:   []Event{{Type: "message", ID: "1", Data: "a"}, {Type: "message", ID: "1", Data: "b"}},
+		},
+		{
+			name:   "CRLF and CR line endings",
+			stream: "data: a\r\ndata: b\r\n\r\ndata: c\r\rdata: d\n\n",
+			want:   []Event{{Type: "message", Data: "a\nb"}, {Type: "message", Data: "c"}, {Type: "message", Data: "d"}},
+		},
+		{
+			name:   "incomplete final event is discarded",
+			stream: "data: complete\n\ndata: partial",
+			want:   []Event{{Type: "message", Data: "complete"}},
+		},
+		{
+			name:   "DONE ends the stream",
+			stream: "data: a\n\ndata: [DONE]\n\ndata: after\n\n",
+			want:   []Event{{Type: "message", Data: "a"}},
+		},
+		{
+			name:   "empty stream",
+			stream: "",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readAll(t, tt.stream)
+			if err != nil {
+				t.Fatalf("Events() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Events() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("event %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReader_NextAfterDone(t *testing.T) {
+	r := NewReader(strings.NewReader("data: [DONE]\n\ndata: later\n\n"))
+	for range 2 {
+		if _, err := r.Next(context.Background()); !errors.Is(err, io.EOF) {
+			t.Fatalf("Next() error = %v, want io.EOF", err)
+		}
+	}
+}
+
+func TestReader_EarlyBreak(t *testing.T) {
+	stream := "data: 1\n\ndata: 2\n\ndata: 3\n\n"
+	r := NewReader(strings.NewReader(stream))
+
+	for event := range r.Events(context.Background()) {
+		if event.Data == "1" {
+			break
+		}
+	}
+
+	// The reader picks up where the loop stopped.
+	event, err := r.Next(context.Background())
+	if err != nil || event.Data != "2" {
+		t.Errorf("Next() = %+v, %v; want event 2", event, err)
+	}
+}
+
+func TestReader_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewReader(strings.NewReader("data: 1\n\ndata: 2\n\n"))
+
+	event, err := r.Next(ctx)
+	if err != nil || event.Data != "1" {
+		t.Fatalf("Next() = %+v, %v; want event 1", event, err)
+	}
+
+	cancel()
+	var got []error
+	for _, err := range r.Events(ctx) {
+		got = append(got, err)
+	}
+	if len(got) != 1 || !errors.Is(got[0], context.Canceled) {
+		t.Errorf("Events() after cancel yielded %v, want a single context.Canceled", got)
+	}
+}
+
+// errReader returns its data and then err, like a connection dropping.
+type errReader struct {
+	data string
+	err  error
+}
+
+func (e *errReader) Read(p []byte) (int, error) {
+	if e.data == "" {
+		return 0, e.err
+	}
+	n := copy(p, e.data)
+	e.data = e.data[n:]
+	return n, nil
+}
+
+func TestReader_ReadError(t *testing.T) {
+	dropped := errors.New("connection reset")
+	got, err := func() ([]Event, error) {
+		var events []Event
+		r := NewReader(&errReader{data: "data: a\n\ndata: b", err: dropped})
+		for event, err := range r.Events(context.Background()) {
+			if err != nil {
+				return events, err
+			}
+			events = append(events, event)
+		}
+		return events, nil
+	}()
+	if !errors.Is(err, dropped) {
+		t.Fatalf("Events() error = %v, want the read error", err)
+	}
+	if len(got) != 1 || got[0].Data != "a" {
+		t.Errorf("events before the error = %+v, want event a", got)
+	}
+}
+
+func TestReader_LongLine(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
+	got, err := readAll(t, "data: "+long+"\n\n")
+	if err != nil {
+		t.Fatalf("Events() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Data != long {
+		t.Error("a 1 MiB data line should be read whole")
+	}
+}
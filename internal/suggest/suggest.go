@@ -0,0 +1,67 @@
+// Package suggest finds the closest match for a mistyped name.
+package suggest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Suggest returns the candidate closest to input by edit distance, or ""
+// when none is close enough to be a plausible typo. Matching ignores case;
+// ties go to the alphabetically first candidate so results are stable.
+func Suggest(input string, candidates []string) string {
+	input = strings.ToLower(input)
+	if input == "" {
+		return ""
+	}
+
+	best := ""
+	bestDist := maxDistance(input) + 1
+	for _, c := range candidates {
+		d := Levenshtein(input, strings.ToLower(c))
+		if d < bestDist || (d == bestDist && c < best) {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// DidYouMean formats the suggestion for input as an error-message suffix,
+// e.g. `; did you mean "dall-e-3"?`. It returns "" when there is nothing
+// to suggest.
+func DidYouMean(input string, candidates []string) string {
+	if s := Suggest(input, candidates); s != "" {
+		return fmt.Sprintf("; did you mean %q?", s)
+	}
+	return ""
+}
+
+// maxDistance scales the allowed number of edits with the input length so
+// short names only match near-identical candidates.
+func maxDistance(input string) int {
+	return max(2, len([]rune(input))/3)
+}
+
+// Levenshtein returns the number of single-rune insertions, deletions, and
+// substitutions needed to turn a into b.
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
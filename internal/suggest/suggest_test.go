@@ -0,0 +1,66 @@
+package suggest
+
+import "testing"
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"png", "png", 0},
+		{"jpg", "jpeg", 1},
+		{"pgn", "png", 2},
+		{"kitten", "sitting", 3},
+		{"dale-3", "dall-e-3", 2},
+	}
+
+	for _, tt := range tests {
+		if got := Levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("Levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	models := []string{"gpt-image-1", "dall-e-3", "dall-e-2", "stable-diffusion-xl"}
+	formats := []string{"png", "jpeg", "webp", "auto"}
+	subcommands := []string{"today", "week", "month", "total", "provider"}
+
+	tests := []struct {
+		name       string
+		input      string
+		candidates []string
+		want       string
+	}{
+		{"close model typo", "dale-3", models, "dall-e-3"},
+		{"model case insensitive", "DALL-E-2", models, "dall-e-2"},
+		{"close format typo", "jpg", formats, "jpeg"},
+		{"transposed format", "pgn", formats, "png"},
+		{"close subcommand typo", "mnth", subcommands, "month"},
+		{"far-off model", "midjourney", models, ""},
+		{"far-off format", "gif", formats, ""},
+		{"far-off subcommand", "yesterday", subcommands, ""},
+		{"empty input", "", formats, ""},
+		{"no candidates", "png", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Suggest(tt.input, tt.candidates); got != tt.want {
+				t.Errorf("Suggest(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	if got := DidYouMean("dale-3", []string{"dall-e-3"}); got != `; did you mean "dall-e-3"?` {
+		t.Errorf("DidYouMean() = %q", got)
+	}
+	if got := DidYouMean("midjourney", []string{"dall-e-3"}); got != "" {
+		t.Errorf("DidYouMean() = %q, want empty", got)
+	}
+}
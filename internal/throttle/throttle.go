@@ -0,0 +1,116 @@
+// Package throttle spaces out API requests across separate imggen processes
+// by recording the time of the last request in a shared file.
+package throttle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lockPollInterval is how often Wait retries acquiring the lock file.
+var lockPollInterval = 20 * time.Millisecond
+
+// Throttle enforces a minimum interval between requests made by any process
+// sharing the same state file.
+type Throttle struct {
+	path     string
+	interval time.Duration
+}
+
+// New creates a Throttle that records request times in path.
+func New(path string, interval time.Duration) *Throttle {
+	return &Throttle{path: path, interval: interval}
+}
+
+// DefaultPath returns the default state file, ~/.imggen/last_request.
+func DefaultPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".imggen", "last_request"), nil
+}
+
+// Wait blocks until at least the configured interval has passed since the
+// last recorded request, then records the current time. The state file is
+// guarded by a lock file so concurrent processes queue up behind each other.
+func (t *Throttle) Wait(ctx context.Context) error {
+	if t == nil || t.interval <= 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return fmt.Errorf("failed to create throttle directory: %w", err)
+	}
+
+	unlock, err := t.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if last, ok := t.lastRequest(); ok {
+		if wait := t.interval - time.Since(last); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+
+	stamp := time.Now().UTC().Format(time.RFC3339Nano)
+	if err := os.WriteFile(t.path, []byte(stamp+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record request time: %w", err)
+	}
+	return nil
+}
+
+func (t *Throttle) lastRequest() (time.Time, bool) {
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	last, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return last, true
+}
+
+// lock acquires an exclusive lock by creating path.lock, which works the same
+// on every platform we release for.
+func (t *Throttle) lock(ctx context.Context) (func(), error) {
+	lockPath := t.path + ".lock"
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to acquire throttle lock: %w", err)
+		}
+
+		// A lock held longer than any holder could need was left behind by a
+		// crashed process.
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > t.interval+time.Minute {
+			os.Remove(lockPath)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestThrottle_Wait_SpacesConsecutiveInvocations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last_request")
+	interval := 150 * time.Millisecond
+
+	// Each invocation constructs its own Throttle, as separate processes would.
+	if err := New(path, interval).Wait(context.Background()); err != nil {
+		t.Fatalf("first Wait() error = %v", err)
+	}
+
+	start := time.Now()
+	if err := New(path, interval).Wait(context.Background()); err != nil {
+		t.Fatalf("second Wait() error = %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < interval-20*time.Millisecond {
+		t.Errorf("second Wait() returned after %v, want at least %v", elapsed, interval)
+	}
+}
+
+func TestThrottle_Wait_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last_request")
+	interval := 50 * time.Millisecond
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := New(path, interval).Wait(context.Background()); err != nil {
+				t.Errorf("Wait() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Three requests need two full intervals between them.
+	if elapsed := time.Since(start); elapsed < 2*interval-20*time.Millisecond {
+		t.Errorf("concurrent waits finished after %v, want at least %v", elapsed, 2*interval)
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Error("lock file was not released")
+	}
+}
+
+func TestThrottle_Wait_ContextCanceled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last_request")
+	thr := New(path, time.Hour)
+
+	if err := thr.Wait(context.Background()); err != nil {
+		t.Fatalf("first Wait() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := thr.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestThrottle_Wait_Disabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last_request")
+
+	if err := New(path, 0).Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("disabled throttle should not write state")
+	}
+
+	var nilThrottle *Throttle
+	if err := nilThrottle.Wait(context.Background()); err != nil {
+		t.Errorf("nil Throttle Wait() error = %v", err)
+	}
+}
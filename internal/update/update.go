@@ -0,0 +1,342 @@
+// Package update checks GitHub for newer imggen releases and replaces the
+// running binary with the one built for this platform.
+package update
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the GitHub endpoint describing the latest release.
+const DefaultAPIURL = "https://api.github.com/repos/manashmandal/imggen/releases/latest"
+
+// checksumsAsset is the file goreleaser publishes alongside the archives.
+const checksumsAsset = "checksums.txt"
+
+// maxDownloadSize caps archive downloads; release archives are a few MB.
+const maxDownloadSize = 200 << 20
+
+// ErrChecksumMismatch is returned when a downloaded archive does not match
+// the digest listed in the release's checksums.txt.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Release is the part of a GitHub release the updater reads.
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	Assets []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release.
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Version returns the release tag without its leading "v".
+func (r *Release) Version() string {
+	return strings.TrimPrefix(r.Tag, "v")
+}
+
+func (r *Release) asset(name string) (Asset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
+
+// Updater fetches release metadata and assets.
+type Updater struct {
+	APIURL     string
+	httpClient *http.Client
+}
+
+// New returns an Updater reading releases from apiURL, or DefaultAPIURL when
+// apiURL is empty. Requests go through transport, or http.DefaultTransport
+// when it is nil.
+func New(apiURL string, transport http.RoundTripper) *Updater {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Updater{
+		APIURL: apiURL,
+		httpClient: &http.Client{
+			Timeout:   5 * time.Minute,
+			Transport: transport,
+		},
+	}
+}
+
+// Latest returns the latest published release.
+func (u *Updater) Latest(ctx context.Context) (*Release, error) {
+	body, err := u.get(ctx, u.APIURL, "application/vnd.github+json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check latest release: %w", err)
+	}
+
+	var rel Release
+	if err := json.Unmarshal(body, &rel); err != nil {
+		return nil, fmt.Errorf("failed to parse release: %w", err)
+	}
+	if rel.Tag == "" {
+		return nil, fmt.Errorf("release has no tag")
+	}
+	return &rel, nil
+}
+
+// Download fetches the archive for goos/goarch from rel, verifies it against
+// the release's checksums.txt, and returns the imggen binary inside it.
+func (u *Updater) Download(ctx context.Context, rel *Release, goos, goarch string) ([]byte, error) {
+	name := AssetName(rel.Version(), goos, goarch)
+	archive, ok := rel.asset(name)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no build for %s/%s", rel.Tag, goos, goarch)
+	}
+	sums, ok := rel.asset(checksumsAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s", rel.Tag, checksumsAsset)
+	}
+
+	sumData, err := u.get(ctx, sums.URL, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", checksumsAsset, err)
+	}
+	want, err := checksumFor(sumData, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := u.get(ctx, archive.URL, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	got := sha256.Sum256(data)
+	if hex.EncodeToString(got[:]) != want {
+		return nil, fmt.Errorf("%s: %w", name, ErrChecksumMismatch)
+	}
+
+	return extractBinary(data, binaryName(goos), goos == "windows")
+}
+
+func (u *Updater) get(ctx context.Context, url, accept string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDownloadSize {
+		return nil, fmt.Errorf("%s is larger than %d MB", url, maxDownloadSize>>20)
+	}
+	return data, nil
+}
+
+// AssetName returns the archive name goreleaser gives the build for
+// goos/goarch, e.g. imggen_1.4.0_linux_amd64.tar.gz.
+func AssetName(version, goos, goarch string) string {
+	ext := "tar.gz"
+	if goos == "windows" {
+		ext = "zip"
+	}
+	return fmt.Sprintf("imggen_%s_%s_%s.%s", strings.TrimPrefix(version, "v"), goos, goarch, ext)
+}
+
+func binaryName(goos string) string {
+	if goos == "windows" {
+		return "imggen.exe"
+	}
+	return "imggen"
+}
+
+// checksumFor finds name in a sha256sum-style listing.
+func checksumFor(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s does not list %s", checksumsAsset, name)
+}
+
+// extractBinary returns the file called name from a tar.gz or zip archive.
+func extractBinary(archive []byte, name string, isZip bool) ([]byte, error) {
+	if isZip {
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open archive: %w", err)
+		}
+		for _, f := range zr.File {
+			if path.Base(f.Name) != name {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(io.LimitReader(rc, maxDownloadSize))
+		}
+		return nil, fmt.Errorf("archive does not contain %s", name)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("archive does not contain %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeReg && path.Base(hdr.Name) == name {
+			return io.ReadAll(io.LimitReader(tr, maxDownloadSize))
+		}
+	}
+}
+
+// Replace swaps the executable at exe for binary. The new binary is written
+// to a temporary file beside exe and renamed over it, so exe is never left
+// half-written. Windows does not allow renaming over a running executable,
+// so there the old binary is first moved aside to exe+".old".
+func Replace(exe string, binary []byte) (err error) {
+	mode := os.FileMode(0755)
+	if info, err := os.Stat(exe); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "."+filepath.Base(exe)+".*.new")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(binary); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+
+	if filepath.Ext(exe) == ".exe" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err = os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), exe)
+}
+
+// CompareVersions compares two semantic versions, with or without a leading
+// "v", returning -1, 0, or 1. A pre-release such as 1.2.0-rc1 sorts before
+// 1.2.0. Versions that are not semantic, such as "dev", return an error.
+func CompareVersions(a, b string) (int, error) {
+	va, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range va.nums {
+		if va.nums[i] != vb.nums[i] {
+			if va.nums[i] < vb.nums[i] {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+
+	switch {
+	case va.pre == vb.pre:
+		return 0, nil
+	case va.pre == "":
+		return 1, nil
+	case vb.pre == "":
+		return -1, nil
+	case va.pre < vb.pre:
+		return -1, nil
+	default:
+		return 1, nil
+	}
+}
+
+type semver struct {
+	nums [3]int
+	pre  string
+}
+
+func parseVersion(s string) (semver, error) {
+	var v semver
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	rest, _, _ = strings.Cut(rest, "+")
+	rest, v.pre, _ = strings.Cut(rest, "-")
+
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v.nums[i] = n
+	}
+	return v, nil
+}
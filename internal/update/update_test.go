@@ -0,0 +1,233 @@
+package update
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"1.10.0", "1.9.9", 1},
+		{"2.0.0", "v1.99.99", 1},
+		{"1.2.0-rc1", "1.2.0", -1},
+		{"1.2.0", "1.2.0-rc1", 1},
+		{"1.2.0-rc1", "1.2.0-rc2", -1},
+		{"1.2.0+build5", "1.2.0", 0},
+	}
+
+	for _, tt := range tests {
+		got, err := CompareVersions(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("CompareVersions(%q, %q) error = %v", tt.a, tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersions_Invalid(t *testing.T) {
+	for _, v := range []string{"dev", "", "1.2", "1.x.0", "1.2.3.4"} {
+		if _, err := CompareVersions(v, "1.0.0"); err == nil {
+			t.Errorf("CompareVersions(%q, 1.0.0) expected error", v)
+		}
+	}
+}
+
+func TestAssetName(t *testing.T) {
+	tests := []struct {
+		version, goos, goarch, want string
+	}{
+		{"v1.4.0", "linux", "amd64", "imggen_1.4.0_linux_amd64.tar.gz"},
+		{"1.4.0", "darwin", "arm64", "imggen_1.4.0_darwin_arm64.tar.gz"},
+		{"v1.4.0", "windows", "amd64", "imggen_1.4.0_windows_amd64.zip"},
+	}
+	for _, tt := range tests {
+		if got := AssetName(tt.version, tt.goos, tt.goarch); got != tt.want {
+			t.Errorf("AssetName(%q, %q, %q) = %q, want %q", tt.version, tt.goos, tt.goarch, got, tt.want)
+		}
+	}
+}
+
+func tarGz(t *testing.T, name string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{"README.md", []byte("readme")}, {name, data}} {
+		hdr := &tar.Header{Name: f.name, Mode: 0755, Size: int64(len(f.data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// releaseServer serves a release whose only archive is archive, named for
+// linux/amd64, with checksums listing sum for it.
+func releaseServer(t *testing.T, archive []byte, sum string) *httptest.Server {
+	t.Helper()
+	name := AssetName("1.3.0", "linux", "amd64")
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest":
+			fmt.Fprintf(w, `{"tag_name": "v1.3.0", "assets": [
+				{"name": %q, "browser_download_url": "%s/%s"},
+				{"name": "checksums.txt", "browser_download_url": "%s/checksums.txt"}]}`,
+				name, server.URL, name, server.URL)
+		case "/checksums.txt":
+			fmt.Fprintf(w, "%s  imggen_1.3.0_darwin_arm64.tar.gz\n%s  %s\n", strings.Repeat("0", 64), sum, name)
+		case "/" + name:
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUpdater_LatestAndDownload(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho new imggen\n")
+	archive := tarGz(t, "imggen", binary)
+	digest := sha256.Sum256(archive)
+	server := releaseServer(t, archive, hex.EncodeToString(digest[:]))
+
+	u := New(server.URL+"/latest", nil)
+	rel, err := u.Latest(context.Background())
+	if err != nil {
+		t.Fatalf("Latest() error = %v", err)
+	}
+	if rel.Tag != "v1.3.0" || rel.Version() != "1.3.0" {
+		t.Errorf("Latest() tag = %q, version %q", rel.Tag, rel.Version())
+	}
+
+	got, err := u.Download(context.Background(), rel, "linux", "amd64")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if !bytes.Equal(got, binary) {
+		t.Errorf("Download() = %q, want %q", got, binary)
+	}
+
+	if _, err := u.Download(context.Background(), rel, "plan9", "386"); err == nil {
+		t.Error("Download() for a platform without a build expected error")
+	}
+}
+
+func TestUpdater_Download_ChecksumMismatch(t *testing.T) {
+	archive := tarGz(t, "imggen", []byte("binary"))
+	server := releaseServer(t, archive, strings.Repeat("ab", 32))
+
+	u := New(server.URL+"/latest", nil)
+	rel, err := u.Latest(context.Background())
+	if err != nil {
+		t.Fatalf("Latest() error = %v", err)
+	}
+
+	_, err = u.Download(context.Background(), rel, "linux", "amd64")
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Download() error = %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestUpdater_Latest_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	if _, err := New(server.URL, nil).Latest(context.Background()); err == nil {
+		t.Error("Latest() expected error for 403 response")
+	}
+}
+
+func TestExtractBinary_Zip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("imggen.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("MZ windows binary"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := extractBinary(buf.Bytes(), "imggen.exe", true)
+	if err != nil {
+		t.Fatalf("extractBinary() error = %v", err)
+	}
+	if string(got) != "MZ windows binary" {
+		t.Errorf("extractBinary() = %q", got)
+	}
+
+	if _, err := extractBinary(buf.Bytes(), "imggen", true); err == nil {
+		t.Error("extractBinary() expected error for missing file")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "imggen")
+	if err := os.WriteFile(exe, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Replace(exe, []byte("new")); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+
+	got, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "new" {
+		t.Errorf("executable = %q, want new", got)
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("mode = %v, want 0755", info.Mode().Perm())
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the executable", len(entries))
+	}
+}
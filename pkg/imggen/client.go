@@ -0,0 +1,118 @@
+// Package imggen is a small Go client for generating and editing images with
+// the same providers, defaults, and cost calculation as the imggen CLI.
+package imggen
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/manash/imggen/internal/image"
+	"github.com/manash/imggen/internal/provider"
+	"github.com/manash/imggen/internal/provider/openai"
+	"github.com/manash/imggen/pkg/models"
+)
+
+// DefaultModel is used when a request does not name a model.
+const DefaultModel = "gpt-image-1"
+
+// Config configures a Client.
+type Config struct {
+	// APIKey is the OpenAI API key. Required.
+	APIKey string
+	// BaseURL overrides the API endpoint, e.g. for an OpenAI-compatible
+	// gateway. Defaults to https://api.openai.com/v1.
+	BaseURL string
+	// MaxRetries retries 429 and 5xx responses with exponential backoff.
+	MaxRetries int
+	// HTTPClient sends the API requests and image downloads. Defaults to a
+	// client with the standard proxy settings; set one with a custom
+	// Transport to record or fake responses in tests.
+	HTTPClient *http.Client
+}
+
+// Client generates and edits images. It is safe for concurrent use.
+type Client struct {
+	provider *openai.Provider
+	registry *models.ModelRegistry
+}
+
+// New creates a Client backed by the OpenAI provider.
+func New(cfg *Config) (*Client, error) {
+	registry := models.DefaultRegistry()
+
+	prov, err := openai.New(&provider.Config{
+		Provider:   models.ProviderOpenAI,
+		APIKey:     cfg.APIKey,
+		BaseURL:    cfg.BaseURL,
+		MaxRetries: cfg.MaxRetries,
+		HTTPClient: cfg.HTTPClient,
+	}, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{provider: prov, registry: registry}, nil
+}
+
+// Models returns the names of the image models the client can use.
+func (c *Client) Models() []string {
+	return c.provider.ListModels()
+}
+
+// Generate applies the model's defaults to req, validates it, and generates
+// the images. Every returned image has Data populated, downloading it when
+// the API only returned a URL. Response.Cost holds the estimated cost.
+func (c *Client) Generate(ctx context.Context, req *models.Request) (*models.Response, error) {
+	if req.Model == "" {
+		req.Model = DefaultModel
+	}
+
+	caps, ok := c.registry.Get(req.Model)
+	if !ok || !c.provider.SupportsModel(req.Model) {
+		return nil, fmt.Errorf("%w: %s", provider.ErrModelNotSupported, req.Model)
+	}
+
+	caps.ApplyDefaults(req)
+	if err := caps.Validate(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.provider.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.fillImageData(ctx, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Edit edits req.Image according to req.Prompt, using an optional mask.
+func (c *Client) Edit(ctx context.Context, req *models.EditRequest) (*models.Response, error) {
+	if req.Model == "" {
+		req.Model = DefaultModel
+	}
+
+	resp, err := c.provider.Edit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.fillImageData(ctx, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) fillImageData(ctx context.Context, resp *models.Response) error {
+	start := time.Now()
+	downloaded, err := image.FetchURLs(ctx, resp.Images, c.provider.DownloadImage)
+	if err != nil {
+		return fmt.Errorf("failed to download %w", err)
+	}
+	if downloaded > 0 {
+		resp.Timing.AddDownload(time.Since(start))
+	}
+	return nil
+}
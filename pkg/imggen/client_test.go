@@ -0,0 +1,107 @@
+package imggen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/manash/imggen/internal/provider"
+	"github.com/manash/imggen/pkg/models"
+)
+
+func TestNew_RequiresAPIKey(t *testing.T) {
+	if _, err := New(&Config{}); !errors.Is(err, provider.ErrAPIKeyRequired) {
+		t.Errorf("New() error = %v, want ErrAPIKeyRequired", err)
+	}
+}
+
+// fakeTransport answers requests from a map of URL path to body.
+type fakeTransport map[string]string
+
+func (f fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, ok := f[req.URL.Path]
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusNotFound
+	}
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+}
+
+func TestNew_HTTPClient(t *testing.T) {
+	client, err := New(&Config{APIKey: "test-key", HTTPClient: &http.Client{Transport: fakeTransport{
+		"/v1/images/generations": `{"data":[{"url":"https://files.example.com/1.png"}]}`,
+		"/1.png":                 "png-bytes",
+	}}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	resp, err := client.Generate(context.Background(), &models.Request{Prompt: "a fox", Count: 1})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if len(resp.Images) != 1 || string(resp.Images[0].Data) != "png-bytes" {
+		t.Errorf("Generate() images = %+v, want the faked download", resp.Images)
+	}
+}
+
+func TestClient_Generate(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/images/generations":
+			json.NewDecoder(r.Body).Decode(&got)
+			w.Write([]byte(`{"data":[{"url":"` + "http://" + r.Host + `/files/1.png"}]}`))
+		case "/files/1.png":
+			w.Write([]byte("png-bytes"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := New(&Config{APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := models.NewRequest("a lighthouse")
+	req.Model = "dall-e-2"
+
+	resp, err := client.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if got["size"] != "1024x1024" {
+		t.Errorf("request size = %v, want the model default", got["size"])
+	}
+	if len(resp.Images) != 1 || string(resp.Images[0].Data) != "png-bytes" {
+		t.Errorf("images = %+v, want downloaded data", resp.Images)
+	}
+	if resp.Cost == nil || resp.Cost.Total <= 0 {
+		t.Errorf("Cost = %+v, want estimated cost", resp.Cost)
+	}
+}
+
+func TestClient_Generate_Validation(t *testing.T) {
+	client, _ := New(&Config{APIKey: "test-key", BaseURL: "http://127.0.0.1:0"})
+
+	req := models.NewRequest("a lighthouse")
+	req.Model = "dall-e-3"
+	req.Count = 2
+	if _, err := client.Generate(context.Background(), req); !errors.Is(err, models.ErrCountExceedsMax) {
+		t.Errorf("Generate() error = %v, want ErrCountExceedsMax", err)
+	}
+
+	req = models.NewRequest("a lighthouse")
+	req.Model = "stable-diffusion-xl"
+	if _, err := client.Generate(context.Background(), req); !errors.Is(err, provider.ErrModelNotSupported) {
+		t.Errorf("Generate() error = %v, want ErrModelNotSupported", err)
+	}
+}
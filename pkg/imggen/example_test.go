@@ -0,0 +1,31 @@
+package imggen_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/manash/imggen/pkg/imggen"
+	"github.com/manash/imggen/pkg/models"
+)
+
+func Example() {
+	client, err := imggen.New(&imggen.Config{APIKey: os.Getenv("OPENAI_API_KEY")})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	req := models.NewRequest("a watercolor lighthouse at dusk")
+	req.Quality = "low"
+
+	resp, err := client.Generate(context.Background(), req)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile("lighthouse.png", resp.Images[0].Data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("saved lighthouse.png ($%.4f)\n", resp.Cost.Total)
+}
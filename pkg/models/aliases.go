@@ -0,0 +1,78 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/manash/imggen/internal/suggest"
+)
+
+var ErrUnknownModel = errors.New("unknown model")
+
+// defaultAliases maps common shorthands to canonical image model names.
+var defaultAliases = map[string]string{
+	"gpt4o":     "gpt-image-1",
+	"gpt-4o":    "gpt-image-1",
+	"4o":        "gpt-image-1",
+	"gpt-image": "gpt-image-1",
+	"dalle3":    "dall-e-3",
+	"dalle-3":   "dall-e-3",
+	"dalle2":    "dall-e-2",
+	"dalle-2":   "dall-e-2",
+	"sdxl":      "stable-diffusion-xl",
+	"sd3":       "stable-diffusion-3",
+}
+
+// RegisterAlias makes alias resolve to the image model named model,
+// replacing any existing alias with the same name. Aliases are matched
+// case-insensitively and cannot shadow a registered model name.
+func (r *ModelRegistry) RegisterAlias(alias, model string) error {
+	alias = strings.ToLower(strings.TrimSpace(alias))
+	if alias == "" {
+		return fmt.Errorf("alias for %q cannot be empty", model)
+	}
+	if _, ok := r.models[alias]; ok {
+		return fmt.Errorf("alias %q conflicts with a model name", alias)
+	}
+	if _, ok := r.models[model]; !ok {
+		return fmt.Errorf("alias %q: %w %q", alias, ErrUnknownModel, model)
+	}
+	r.aliases[alias] = model
+	return nil
+}
+
+// Aliases returns a copy of the registered aliases.
+func (r *ModelRegistry) Aliases() map[string]string {
+	return maps.Clone(r.aliases)
+}
+
+// Resolve maps name to a canonical image model name. It accepts canonical
+// names and aliases in any case, but not prefixes, so registering a new
+// model never changes what an existing name means. Anything else returns
+// ErrUnknownModel, suggesting the closest name when there is one.
+func (r *ModelRegistry) Resolve(name string) (string, error) {
+	if _, ok := r.models[name]; ok {
+		return name, nil
+	}
+
+	key := strings.ToLower(strings.TrimSpace(name))
+	if _, ok := r.models[key]; ok {
+		return key, nil
+	}
+	if model, ok := r.aliases[key]; ok {
+		return model, nil
+	}
+
+	known := slices.Concat(r.List(), slices.Collect(maps.Keys(r.aliases)))
+	if match := suggest.Suggest(name, known); match != "" {
+		// Suggest the canonical name even when the typo was closer to an alias.
+		if model, ok := r.aliases[match]; ok {
+			match = model
+		}
+		return "", fmt.Errorf("%w %q; did you mean %q?", ErrUnknownModel, name, match)
+	}
+	return "", fmt.Errorf("%w %q: available models: %s", ErrUnknownModel, name, strings.Join(slices.Sorted(slices.Values(r.List())), ", "))
+}
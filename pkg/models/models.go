@@ -3,7 +3,11 @@ package models
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"regexp"
 	"slices"
+	"strings"
+	"time"
 )
 
 var (
@@ -17,7 +21,10 @@ var (
 	ErrInvalidTransparencyFormat = errors.New("transparent background requires png or webp format")
 	ErrEditNotSupported          = errors.New("image editing not supported by model")
 	ErrNoImageData               = errors.New("image data is required for editing")
+	ErrTooManyEditImages         = errors.New("too many input images for model")
 	ErrInvalidDuration           = errors.New("invalid duration for model")
+	ErrSeedNotSupported          = errors.New("seed not supported by model")
+	ErrVariationsNotSupported    = errors.New("image variations not supported by model")
 )
 
 type ProviderType string
@@ -33,6 +40,10 @@ const (
 	FormatPNG  OutputFormat = "png"
 	FormatJPEG OutputFormat = "jpeg"
 	FormatWebP OutputFormat = "webp"
+
+	// FormatAuto lets the saver pick png or jpeg per image after decoding,
+	// depending on whether the image has transparency.
+	FormatAuto OutputFormat = "auto"
 )
 
 func ValidFormats() []OutputFormat {
@@ -43,6 +54,11 @@ func (f OutputFormat) IsValid() bool {
 	return slices.Contains(ValidFormats(), f)
 }
 
+// IsAuto reports whether the output format is chosen per image at save time.
+func (f OutputFormat) IsAuto() bool {
+	return f == FormatAuto
+}
+
 func (f OutputFormat) String() string {
 	return string(f)
 }
@@ -62,6 +78,12 @@ type Request struct {
 	Style       string
 	Format      OutputFormat
 	Transparent bool
+	// Seed makes generation reproducible on models that support it.
+	// Zero lets the provider pick a random seed.
+	Seed int64
+	// NoRevise asks dall-e-3 to use the prompt as written instead of
+	// rewriting it. Other models ignore it.
+	NoRevise bool
 }
 
 func NewRequest(prompt string) *Request {
@@ -73,7 +95,12 @@ func NewRequest(prompt string) *Request {
 }
 
 type EditRequest struct {
-	Image  []byte
+	// Image is the image to edit, and the first of Images when several
+	// are combined.
+	Image []byte
+	// Images are the input images for models that composite several into
+	// one edit. When empty, Image is the only input.
+	Images [][]byte
 	Mask   []byte
 	Prompt string
 	Model  string
@@ -91,26 +118,131 @@ func NewEditRequest(image []byte, prompt string) *EditRequest {
 	}
 }
 
+// NewMultiImageEditRequest returns an edit that combines images, keeping
+// the first in Image.
+func NewMultiImageEditRequest(images [][]byte, prompt string) *EditRequest {
+	req := NewEditRequest(nil, prompt)
+	if len(images) > 0 {
+		req.Image = images[0]
+	}
+	req.Images = images
+	return req
+}
+
+// InputImages returns the images to upload: Images, or Image alone.
+func (r *EditRequest) InputImages() [][]byte {
+	if len(r.Images) > 0 {
+		return r.Images
+	}
+	if len(r.Image) > 0 {
+		return [][]byte{r.Image}
+	}
+	return nil
+}
+
 func (r *EditRequest) Validate() error {
-	if len(r.Image) == 0 {
+	images := r.InputImages()
+	if len(images) == 0 {
 		return ErrNoImageData
 	}
+	for _, img := range images {
+		if len(img) == 0 {
+			return ErrNoImageData
+		}
+	}
 	if r.Prompt == "" {
 		return ErrEmptyPrompt
 	}
 	return nil
 }
 
+// VariationRequest asks for variants of a source image. Unlike an edit it
+// takes no prompt.
+type VariationRequest struct {
+	Image []byte
+	Model string
+	Size  string
+	Count int
+}
+
+func NewVariationRequest(image []byte) *VariationRequest {
+	return &VariationRequest{
+		Image: image,
+		Model: "dall-e-2",
+		Count: 1,
+	}
+}
+
+func (r *VariationRequest) Validate() error {
+	if len(r.Image) == 0 {
+		return ErrNoImageData
+	}
+	if r.Count < 1 {
+		return ErrInvalidCount
+	}
+	return nil
+}
+
+// Cost sources recorded in CostInfo.Source.
+const (
+	CostSourceTable    = "table"    // static per-image price table
+	CostSourceUsage    = "usage"    // token usage reported by the provider
+	CostSourceCache    = "cache"    // served from the local cache at no charge
+	CostSourceOverride = "override" // user price from ~/.imggen/pricing.json
+)
+
 type CostInfo struct {
 	PerImage float64 `json:"per_image"`
 	Total    float64 `json:"total"`
 	Currency string  `json:"currency"`
+	Source   string  `json:"source,omitempty"`
 }
 
 type Response struct {
 	Images        []GeneratedImage
 	RevisedPrompt string
 	Cost          *CostInfo
+
+	// InputTokens and OutputTokens are the usage reported by models that
+	// bill by token. Both are zero when the API reports no usage.
+	InputTokens  int
+	OutputTokens int
+
+	// CreatedAt is when the API says it created the images, and ModelUsed
+	// the model it reports having used, which can differ from the one
+	// requested. Each is zero when the API does not report it.
+	CreatedAt time.Time
+	ModelUsed string
+
+	// Timing is how long the response took to produce. It is zero for
+	// providers that do not measure it.
+	Timing Timing
+}
+
+// Timing breaks down how long a response took. RequestDuration is the API
+// call, including retries; DownloadDuration is the time spent fetching
+// images returned as URLs, which are downloaded in parallel; TotalDuration
+// covers both plus encoding the request and decoding the response.
+type Timing struct {
+	RequestDuration  time.Duration
+	DownloadDuration time.Duration
+	TotalDuration    time.Duration
+}
+
+// AddDownload records d spent downloading images.
+func (t *Timing) AddDownload(d time.Duration) {
+	t.DownloadDuration += d
+	t.TotalDuration += d
+}
+
+// String formats t for display, e.g. "1.52s (request 1.20s, download
+// 0.30s)". The download part is left out when nothing was downloaded.
+func (t Timing) String() string {
+	s := fmt.Sprintf("%.2fs (request %.2fs", t.TotalDuration.Seconds(), t.RequestDuration.Seconds())
+	if t.DownloadDuration > 0 {
+		s += fmt.Sprintf(", download %.2fs", t.DownloadDuration.Seconds())
+	}
+	return s + ")"
 }
 
 type GeneratedImage struct {
@@ -160,7 +292,46 @@ type ModelCapabilities struct {
 	SupportsStyle        bool
 	SupportsTransparency bool
 	SupportsEdit         bool
+	SupportsVariations   bool
+	SupportsSeed         bool
 	StyleOptions         []string
+	// DefaultFormat is the output format used when a request leaves it
+	// unset; PNG is used when the model does not set one.
+	DefaultFormat OutputFormat
+	// SizeAliases maps friendly size names such as "landscape" to one of
+	// SupportedSizes. ApplyDefaults resolves them.
+	SizeAliases map[string]string
+	// SupportsPromptWeights reports whether the model understands weighted
+	// terms such as "(term:1.2)" in prompts.
+	SupportsPromptWeights bool
+	// MaxEditImages is how many input images one edit can combine; zero
+	// means one.
+	MaxEditImages int
+}
+
+// ResolveSize returns the size that alias size stands for on this model,
+// matched case-insensitively. Anything else is returned unchanged for
+// Validate to check.
+func (c *ModelCapabilities) ResolveSize(size string) string {
+	if resolved, ok := c.SizeAliases[strings.ToLower(size)]; ok {
+		return resolved
+	}
+	return size
+}
+
+// EditImageLimit returns how many input images one edit accepts.
+func (c *ModelCapabilities) EditImageLimit() int {
+	return max(1, c.MaxEditImages)
+}
+
+// SizeError reports that size is not supported, listing the size aliases
+// the model does accept.
+func (c *ModelCapabilities) SizeError(size string) error {
+	if len(c.SizeAliases) == 0 {
+		return fmt.Errorf("%w: %q not in %v", ErrInvalidSize, size, c.SupportedSizes)
+	}
+	aliases := slices.Sorted(maps.Keys(c.SizeAliases))
+	return fmt.Errorf("%w: %q not in %v or aliases %v", ErrInvalidSize, size, c.SupportedSizes, aliases)
 }
 
 func (c *ModelCapabilities) Validate(req *Request) error {
@@ -177,7 +348,7 @@ func (c *ModelCapabilities) Validate(req *Request) error {
 	}
 
 	if req.Size != "" && !slices.Contains(c.SupportedSizes, req.Size) {
-		return fmt.Errorf("%w: %q not in %v", ErrInvalidSize, req.Size, c.SupportedSizes)
+		return c.SizeError(req.Size)
 	}
 
 	if req.Quality != "" && len(c.SupportedQualities) > 0 && !slices.Contains(c.SupportedQualities, req.Quality) {
@@ -192,6 +363,10 @@ func (c *ModelCapabilities) Validate(req *Request) error {
 		return fmt.Errorf("%w: %q not in %v", ErrStyleNotSupported, req.Style, c.StyleOptions)
 	}
 
+	if req.Seed != 0 && !c.SupportsSeed {
+		return ErrSeedNotSupported
+	}
+
 	if req.Transparent && !c.SupportsTransparency {
 		return ErrTransparencyNotSupported
 	}
@@ -203,16 +378,52 @@ func (c *ModelCapabilities) Validate(req *Request) error {
 	return nil
 }
 
+// promptWeightPattern matches one weighted term, "(term:1.2)", capturing
+// the term. The term must contain a letter so ratios like "(16:9)" are kept.
+var promptWeightPattern = regexp.MustCompile(`\(([^()]*?\pL[^()]*?):\s*[+-]?(?:\d+(?:\.\d*)?|\.\d+)\s*\)`)
+
+// StripPromptWeights replaces every weighted term "(term:1.2)" in prompt,
+// including nested ones, with the bare term and reports whether any were
+// found. Other parentheses are left alone.
+func StripPromptWeights(prompt string) (string, bool) {
+	stripped := prompt
+	for promptWeightPattern.MatchString(stripped) {
+		stripped = promptWeightPattern.ReplaceAllString(stripped, "$1")
+	}
+	return stripped, stripped != prompt
+}
+
+// StripWeights strips weighted terms from prompt when the model does not
+// support them, reporting whether any were removed. Prompts for models that
+// do support them are returned unchanged.
+func (c *ModelCapabilities) StripWeights(prompt string) (string, bool) {
+	if c.SupportsPromptWeights {
+		return prompt, false
+	}
+	return StripPromptWeights(prompt)
+}
+
 func (c *ModelCapabilities) ApplyDefaults(req *Request) {
 	if req.Size == "" {
 		req.Size = c.DefaultSize
 	}
+	req.Size = c.ResolveSize(req.Size)
 	if req.Quality == "" && c.DefaultQuality != "" {
 		req.Quality = c.DefaultQuality
 	}
 	if req.Model == "" {
 		req.Model = c.Name
 	}
+	if req.Format == "" {
+		req.Format = c.DefaultFormat
+	}
+	if req.Format == "" {
+		req.Format = FormatPNG
+	}
+	if req.Format.IsAuto() {
+		// Request a lossless encoding; the saver settles the final format.
+		req.Format = FormatPNG
+	}
 }
 
 // VideoModelCapabilities defines the capabilities of a video generation model
@@ -259,6 +470,7 @@ type ModelRegistry struct {
 	models      map[string]*ModelCapabilities
 	ocrModels   map[string]*OCRModelCapabilities
 	videoModels map[string]*VideoModelCapabilities
+	aliases     map[string]string
 }
 
 func NewModelRegistry() *ModelRegistry {
@@ -266,6 +478,7 @@ func NewModelRegistry() *ModelRegistry {
 		models:      make(map[string]*ModelCapabilities),
 		ocrModels:   make(map[string]*OCRModelCapabilities),
 		videoModels: make(map[string]*VideoModelCapabilities),
+		aliases:     make(map[string]string),
 	}
 }
 
@@ -330,6 +543,9 @@ func DefaultRegistry() *ModelRegistry {
 		SupportsStyle:        false,
 		SupportsTransparency: true,
 		SupportsEdit:         true,
+		MaxEditImages:        16,
+		DefaultFormat:        FormatPNG,
+		SizeAliases:          map[string]string{"square": "1024x1024", "landscape": "1536x1024", "portrait": "1024x1536"},
 	})
 
 	r.Register(&ModelCapabilities{
@@ -344,6 +560,8 @@ func DefaultRegistry() *ModelRegistry {
 		SupportsTransparency: false,
 		SupportsEdit:         false,
 		StyleOptions:         []string{"vivid", "natural"},
+		DefaultFormat:        FormatPNG,
+		SizeAliases:          map[string]string{"square": "1024x1024", "landscape": "1792x1024", "portrait": "1024x1792"},
 	})
 
 	r.Register(&ModelCapabilities{
@@ -357,30 +575,39 @@ func DefaultRegistry() *ModelRegistry {
 		SupportsStyle:        false,
 		SupportsTransparency: false,
 		SupportsEdit:         true,
+		SupportsVariations:   true,
+		DefaultFormat:        FormatPNG,
+		SizeAliases:          map[string]string{"square": "1024x1024"},
 	})
 
 	r.Register(&ModelCapabilities{
-		Name:                 "stable-diffusion-xl",
-		Provider:             ProviderStability,
-		SupportedSizes:       []string{"1024x1024", "1152x896", "896x1152", "1216x832", "832x1216"},
-		SupportedQualities:   nil,
-		MaxImages:            10,
-		DefaultSize:          "1024x1024",
-		DefaultQuality:       "",
-		SupportsStyle:        false,
-		SupportsTransparency: false,
+		Name:                  "stable-diffusion-xl",
+		Provider:              ProviderStability,
+		SupportedSizes:        []string{"1024x1024", "1152x896", "896x1152", "1216x832", "832x1216"},
+		SupportedQualities:    nil,
+		MaxImages:             10,
+		DefaultSize:           "1024x1024",
+		DefaultQuality:        "",
+		SupportsStyle:         false,
+		SupportsTransparency:  false,
+		SupportsSeed:          true,
+		SizeAliases:           map[string]string{"square": "1024x1024", "landscape": "1216x832", "portrait": "832x1216"},
+		SupportsPromptWeights: true,
 	})
 
 	r.Register(&ModelCapabilities{
-		Name:                 "stable-diffusion-3",
-		Provider:             ProviderStability,
-		SupportedSizes:       []string{"1024x1024", "1536x1024", "1024x1536"},
-		SupportedQualities:   nil,
-		MaxImages:            10,
-		DefaultSize:          "1024x1024",
-		DefaultQuality:       "",
-		SupportsStyle:        false,
-		SupportsTransparency: false,
+		Name:                  "stable-diffusion-3",
+		Provider:              ProviderStability,
+		SupportedSizes:        []string{"1024x1024", "1536x1024", "1024x1536"},
+		SupportedQualities:    nil,
+		MaxImages:             10,
+		DefaultSize:           "1024x1024",
+		DefaultQuality:        "",
+		SupportsStyle:         false,
+		SupportsTransparency:  false,
+		SupportsSeed:          true,
+		SizeAliases:           map[string]string{"square": "1024x1024", "landscape": "1536x1024", "portrait": "1024x1536"},
+		SupportsPromptWeights: true,
 	})
 
 	// OCR models (GPT-5 series with vision capabilities)
@@ -427,5 +654,9 @@ func DefaultRegistry() *ModelRegistry {
 		DefaultSize:        "720x1280",
 	})
 
+	for alias, model := range defaultAliases {
+		r.aliases[alias] = model
+	}
+
 	return r
 }
@@ -2,7 +2,10 @@ package models
 
 import (
 	"errors"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestOutputFormat_IsValid(t *testing.T) {
@@ -188,6 +191,20 @@ func TestModelCapabilities_Validate_NoStyleSupport(t *testing.T) {
 	}
 }
 
+func TestModelCapabilities_Validate_Seed(t *testing.T) {
+	req := &Request{Prompt: "test", Count: 1, Seed: 42}
+
+	noSeed := &ModelCapabilities{Name: "no-seed-model", MaxImages: 1}
+	if err := noSeed.Validate(req); !errors.Is(err, ErrSeedNotSupported) {
+		t.Errorf("Validate() error = %v, want %v", err, ErrSeedNotSupported)
+	}
+
+	withSeed := &ModelCapabilities{Name: "seed-model", MaxImages: 1, SupportsSeed: true}
+	if err := withSeed.Validate(req); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+}
+
 func TestModelCapabilities_Validate_NoTransparencySupport(t *testing.T) {
 	cap := &ModelCapabilities{
 		Name:                 "no-transparency-model",
@@ -280,6 +297,59 @@ func TestModelCapabilities_ApplyDefaults_EmptyQuality(t *testing.T) {
 	}
 }
 
+func TestModelCapabilities_ApplyDefaults_AutoFormat(t *testing.T) {
+	cap := &ModelCapabilities{Name: "test-model", DefaultSize: "1024x1024"}
+
+	req := &Request{Prompt: "test", Count: 1, Format: FormatAuto}
+	cap.ApplyDefaults(req)
+
+	if req.Format != FormatPNG {
+		t.Errorf("ApplyDefaults() Format = %v, want png for auto", req.Format)
+	}
+	if FormatAuto.IsValid() {
+		t.Error("FormatAuto.IsValid() = true, want false (not a concrete encoding)")
+	}
+}
+
+func TestModelCapabilities_ApplyDefaults_DefaultFormat(t *testing.T) {
+	r := DefaultRegistry()
+
+	tests := []struct {
+		model  string
+		format OutputFormat
+		want   OutputFormat
+	}{
+		{"gpt-image-1", "", FormatPNG},
+		{"dall-e-3", "", FormatPNG},
+		{"dall-e-2", "", FormatPNG},
+		{"stable-diffusion-xl", "", FormatPNG}, // no model default: global png
+		{"stable-diffusion-3", "", FormatPNG},
+		{"dall-e-3", FormatWebP, FormatWebP}, // an explicit format wins
+		{"dall-e-3", FormatAuto, FormatPNG},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model+"/"+string(tt.format), func(t *testing.T) {
+			cap, ok := r.Get(tt.model)
+			if !ok {
+				t.Fatalf("model %s not registered", tt.model)
+			}
+			req := &Request{Prompt: "test", Count: 1, Format: tt.format}
+			cap.ApplyDefaults(req)
+			if req.Format != tt.want {
+				t.Errorf("ApplyDefaults() Format = %v, want %v", req.Format, tt.want)
+			}
+		})
+	}
+
+	cap := &ModelCapabilities{Name: "jpeg-model", DefaultFormat: FormatJPEG}
+	req := &Request{Prompt: "test", Count: 1}
+	cap.ApplyDefaults(req)
+	if req.Format != FormatJPEG {
+		t.Errorf("ApplyDefaults() Format = %v, want the model's %v", req.Format, FormatJPEG)
+	}
+}
+
 func TestModelRegistry(t *testing.T) {
 	r := NewModelRegistry()
 
@@ -414,6 +484,25 @@ func TestDefaultRegistry_DallE2(t *testing.T) {
 	}
 }
 
+func TestVariationRequest_Validate(t *testing.T) {
+	req := NewVariationRequest([]byte("png"))
+	if req.Model != "dall-e-2" || req.Count != 1 {
+		t.Errorf("NewVariationRequest() = %+v, want dall-e-2 with count 1", req)
+	}
+	if err := req.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	if err := NewVariationRequest(nil).Validate(); !errors.Is(err, ErrNoImageData) {
+		t.Errorf("Validate() error = %v, want ErrNoImageData", err)
+	}
+
+	req.Count = 0
+	if err := req.Validate(); !errors.Is(err, ErrInvalidCount) {
+		t.Errorf("Validate() error = %v, want ErrInvalidCount", err)
+	}
+}
+
 func TestProviderType_Constants(t *testing.T) {
 	if ProviderOpenAI != "openai" {
 		t.Errorf("ProviderOpenAI = %v, want openai", ProviderOpenAI)
@@ -629,3 +718,200 @@ func TestDefaultRegistry_VideoModels(t *testing.T) {
 		t.Errorf("ListVideoModels() returned %d models, want 2", len(models))
 	}
 }
+
+func TestModelRegistry_Resolve(t *testing.T) {
+	r := DefaultRegistry()
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{name: "canonical name", input: "dall-e-3", want: "dall-e-3"},
+		{name: "canonical name any case", input: "DALL-E-3", want: "dall-e-3"},
+		{name: "alias gpt4o", input: "gpt4o", want: "gpt-image-1"},
+		{name: "alias 4o", input: "4o", want: "gpt-image-1"},
+		{name: "alias sdxl", input: "sdxl", want: "stable-diffusion-xl"},
+		{name: "alias sd3", input: "SD3", want: "stable-diffusion-3"},
+		{name: "prefix of one model", input: "stable-diffusion-x", wantErr: ErrUnknownModel},
+		{name: "prefix of aliases", input: "gpt", wantErr: ErrUnknownModel},
+		{name: "prefix of several models", input: "sd", wantErr: ErrUnknownModel},
+		{name: "unknown", input: "midjourney", wantErr: ErrUnknownModel},
+		{name: "empty", input: "", wantErr: ErrUnknownModel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(tt.input)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Resolve(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q) error = %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelRegistry_ResolveErrorMessages(t *testing.T) {
+	r := DefaultRegistry()
+
+	_, err := r.Resolve("gpt-imag")
+	if err == nil || !strings.Contains(err.Error(), `did you mean "gpt-image-1"?`) {
+		t.Errorf("prefix error = %v, want the full name suggested", err)
+	}
+
+	_, err = r.Resolve("dale-3")
+	if err == nil || !strings.Contains(err.Error(), `did you mean "dall-e-3"?`) {
+		t.Errorf("typo error = %v, want suggestion", err)
+	}
+
+	_, err = r.Resolve("midjourney")
+	if err == nil || !strings.Contains(err.Error(), "available models: dall-e-2") {
+		t.Errorf("unknown error = %v, want available models listed", err)
+	}
+}
+
+func TestModelRegistry_RegisterAlias(t *testing.T) {
+	r := DefaultRegistry()
+
+	if err := r.RegisterAlias("Fast", "dall-e-2"); err != nil {
+		t.Fatalf("RegisterAlias() error = %v", err)
+	}
+	if got, _ := r.Resolve("fast"); got != "dall-e-2" {
+		t.Errorf("Resolve(fast) = %q, want dall-e-2", got)
+	}
+
+	if err := r.RegisterAlias("4o", "dall-e-3"); err != nil {
+		t.Fatalf("RegisterAlias() override error = %v", err)
+	}
+	if got, _ := r.Resolve("4o"); got != "dall-e-3" {
+		t.Errorf("Resolve(4o) = %q, want overridden dall-e-3", got)
+	}
+
+	if err := r.RegisterAlias("x", "no-such-model"); !errors.Is(err, ErrUnknownModel) {
+		t.Errorf("RegisterAlias() unknown target error = %v, want ErrUnknownModel", err)
+	}
+	if err := r.RegisterAlias("dall-e-3", "dall-e-2"); err == nil {
+		t.Error("RegisterAlias() should reject aliases that shadow a model name")
+	}
+	if err := r.RegisterAlias(" ", "dall-e-2"); err == nil {
+		t.Error("RegisterAlias() should reject empty aliases")
+	}
+
+	aliases := r.Aliases()
+	aliases["fast"] = "gpt-image-1"
+	if got, _ := r.Resolve("fast"); got != "dall-e-2" {
+		t.Error("Aliases() should return a copy")
+	}
+}
+
+func TestTiming(t *testing.T) {
+	timing := Timing{RequestDuration: 1200 * time.Millisecond, TotalDuration: 1250 * time.Millisecond}
+	if got, want := timing.String(), "1.25s (request 1.20s)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	timing.AddDownload(200 * time.Millisecond)
+	timing.AddDownload(100 * time.Millisecond)
+	if timing.DownloadDuration != 300*time.Millisecond || timing.TotalDuration != 1550*time.Millisecond {
+		t.Errorf("after AddDownload: %+v, want downloads summed into the total", timing)
+	}
+	if got, want := timing.String(), "1.55s (request 1.20s, download 0.30s)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestModelCapabilities_SizeAliases(t *testing.T) {
+	r := DefaultRegistry()
+	tests := []struct {
+		model, size, want string
+	}{
+		{"gpt-image-1", "landscape", "1536x1024"},
+		{"gpt-image-1", "Portrait", "1024x1536"},
+		{"dall-e-3", "landscape", "1792x1024"},
+		{"dall-e-3", "portrait", "1024x1792"},
+		{"dall-e-2", "square", "1024x1024"},
+		{"stable-diffusion-xl", "landscape", "1216x832"},
+		{"dall-e-3", "1024x1024", "1024x1024"},
+		{"dall-e-2", "landscape", "landscape"},
+	}
+	for _, tt := range tests {
+		caps, _ := r.Get(tt.model)
+		if got := caps.ResolveSize(tt.size); got != tt.want {
+			t.Errorf("%s ResolveSize(%q) = %q, want %q", tt.model, tt.size, got, tt.want)
+		}
+	}
+
+	for name := range r.models {
+		caps, _ := r.Get(name)
+		for alias, size := range caps.SizeAliases {
+			if !slices.Contains(caps.SupportedSizes, size) {
+				t.Errorf("%s alias %q maps to unsupported size %q", name, alias, size)
+			}
+		}
+	}
+}
+
+func TestModelCapabilities_SizeAliasesValidate(t *testing.T) {
+	r := DefaultRegistry()
+
+	caps, _ := r.Get("dall-e-3")
+	req := &Request{Prompt: "a fox", Count: 1, Size: "landscape"}
+	caps.ApplyDefaults(req)
+	if req.Size != "1792x1024" {
+		t.Errorf("ApplyDefaults() size = %q, want 1792x1024", req.Size)
+	}
+	if err := caps.Validate(req); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	caps, _ = r.Get("dall-e-2")
+	req = &Request{Prompt: "a fox", Count: 1, Size: "landscape"}
+	caps.ApplyDefaults(req)
+	err := caps.Validate(req)
+	if !errors.Is(err, ErrInvalidSize) || !strings.Contains(err.Error(), "aliases [square]") {
+		t.Errorf("Validate() error = %v, want ErrInvalidSize listing the square alias", err)
+	}
+}
+
+func TestStripPromptWeights(t *testing.T) {
+	tests := []struct {
+		prompt, want string
+		stripped     bool
+	}{
+		{"a (red:1.2) fox", "a red fox", true},
+		{"(a castle:0.8), (misty hills: 1.5)", "a castle, misty hills", true},
+		{"((glowing eyes:1.3):1.1) cat", "glowing eyes cat", true},
+		{"a fox (in the snow)", "a fox (in the snow)", false},
+		{"ratio (16:9) poster", "ratio (16:9) poster", false},
+		{"time 12:30 (noon)", "time 12:30 (noon)", false},
+	}
+	for _, tt := range tests {
+		got, stripped := StripPromptWeights(tt.prompt)
+		if got != tt.want || stripped != tt.stripped {
+			t.Errorf("StripPromptWeights(%q) = %q, %v, want %q, %v", tt.prompt, got, stripped, tt.want, tt.stripped)
+		}
+	}
+}
+
+func TestModelCapabilities_StripWeights(t *testing.T) {
+	r := DefaultRegistry()
+	const prompt = "a (red:1.2) fox"
+
+	sdxl, _ := r.Get("stable-diffusion-xl")
+	if got, stripped := sdxl.StripWeights(prompt); got != prompt || stripped {
+		t.Errorf("stable-diffusion-xl StripWeights() = %q, %v, want the prompt unchanged", got, stripped)
+	}
+	gpt, _ := r.Get("gpt-image-1")
+	if got, stripped := gpt.StripWeights(prompt); got != "a red fox" || !stripped {
+		t.Errorf("gpt-image-1 StripWeights() = %q, %v, want %q", got, stripped, "a red fox")
+	}
+}
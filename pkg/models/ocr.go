@@ -6,8 +6,9 @@ import (
 )
 
 var (
-	ErrNoImageSource = errors.New("image source is required (file path or URL)")
-	ErrInvalidSchema = errors.New("invalid JSON schema")
+	ErrNoImageSource    = errors.New("image source is required (file path or URL)")
+	ErrInvalidSchema    = errors.New("invalid JSON schema")
+	ErrInvalidThreshold = errors.New("confidence threshold must be between 0 and 1")
 )
 
 type OCRRequest struct {
@@ -20,6 +21,11 @@ type OCRRequest struct {
 	Prompt      string          `json:"prompt,omitempty"`
 	MaxTokens   int             `json:"max_tokens,omitempty"`
 	Temperature float64         `json:"temperature,omitempty"`
+
+	// ConfidenceThreshold, when set with a schema, asks the model for
+	// per-field confidence scores and re-prompts once for fields scoring
+	// below the threshold.
+	ConfidenceThreshold float64 `json:"confidence_threshold,omitempty"`
 }
 
 func NewOCRRequest() *OCRRequest {
@@ -40,6 +46,9 @@ func (r *OCRRequest) Validate() error {
 			return ErrInvalidSchema
 		}
 	}
+	if r.ConfidenceThreshold < 0 || r.ConfidenceThreshold > 1 {
+		return ErrInvalidThreshold
+	}
 	return nil
 }
 
@@ -49,6 +58,14 @@ type OCRResponse struct {
 	Cost        *CostInfo       `json:"cost,omitempty"`
 	InputTokens int             `json:"input_tokens,omitempty"`
 	OutputTokens int            `json:"output_tokens,omitempty"`
+
+	// Confidence holds the model's per-field confidence (0-1) for the
+	// top-level fields of Structured when a confidence threshold was set.
+	Confidence map[string]float64 `json:"confidence,omitempty"`
+
+	// Truncated is set when the model stopped at the output token cap
+	// (finish_reason "length"), so the text or JSON may be cut short.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 type OCRModelCapabilities struct {